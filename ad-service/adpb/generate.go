@@ -0,0 +1,4 @@
+// Package adpb holds the protobuf and gRPC definitions for ad-service.
+package adpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ad.proto
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"platform"
+)
+
+// maxAssetPixels bounds the decoded size of an upload, so a small file
+// can't expand into gigabytes of pixels
+const maxAssetPixels = 40_000_000
+
+// AssetSlot is a standard ad size every upload is resized to
+type AssetSlot struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// assetSlots are the IAB sizes the demo frontend places ads in
+var assetSlots = []AssetSlot{
+	{Name: "medium_rectangle", Width: 300, Height: 250},
+	{Name: "leaderboard", Width: 728, Height: 90},
+	{Name: "wide_skyscraper", Width: 160, Height: 600},
+	{Name: "mobile_banner", Width: 320, Height: 50},
+}
+
+var validAssetHash = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+var assetUploads = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ad_service_asset_uploads_total",
+		Help: "Number of POST /assets uploads by result: created, existing or rejected",
+	},
+	[]string{"result"},
+)
+
+// Asset is an uploaded image and its resized variants, addressed by the
+// SHA-256 of the uploaded bytes
+type Asset struct {
+	Hash        string `json:"hash"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int    `json:"size"`
+	URL         string `json:"url"`
+	// Slots maps each slot name to the URL of the image resized for it
+	Slots map[string]string `json:"slots"`
+
+	data     []byte
+	variants map[string][]byte
+}
+
+// AssetStore keeps assets in memory and, with ASSET_DIR set, on disk so
+// they survive restarts. Assets are immutable, so a file is never
+// rewritten once it exists.
+type AssetStore struct {
+	mu       sync.RWMutex
+	assets   map[string]*Asset
+	dir      string
+	maxBytes int64
+	baseURL  string
+}
+
+var assetStore *AssetStore
+
+// NewAssetStoreFromEnv reads ASSET_DIR (default: memory only),
+// ASSET_MAX_BYTES (default 5 MiB) and ASSET_BASE_URL, the public URL of
+// ad-service that asset URLs are built on (default: relative URLs)
+func NewAssetStoreFromEnv() (*AssetStore, error) {
+	maxBytes, err := strconv.ParseInt(platform.GetEnv("ASSET_MAX_BYTES", "5242880"), 10, 64)
+	if err != nil || maxBytes <= 0 {
+		maxBytes = 5 << 20
+	}
+	s := &AssetStore{
+		assets:   make(map[string]*Asset),
+		dir:      platform.GetEnv("ASSET_DIR", ""),
+		maxBytes: maxBytes,
+		baseURL:  strings.TrimRight(platform.GetEnv("ASSET_BASE_URL", ""), "/"),
+	}
+	if s.dir != "" {
+		if err := os.MkdirAll(s.dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Put stores an upload and its slot variants. It reports false when an
+// identical upload was already stored.
+func (s *AssetStore) Put(data []byte) (*Asset, bool, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if asset, ok := s.get(hash); ok {
+		return asset, false, nil
+	}
+
+	asset, err := s.build(hash, data)
+	if err != nil {
+		return nil, false, err
+	}
+	if s.dir != "" {
+		if err := s.persist(asset); err != nil {
+			return nil, false, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.assets[hash]; ok {
+		return existing, false, nil
+	}
+	s.assets[hash] = asset
+	return asset, true, nil
+}
+
+var errUnsupportedImage = errors.New("file must be a JPEG, PNG or GIF image")
+
+// build decodes an upload and resizes it to every slot. JPEGs stay JPEGs;
+// PNGs and GIFs are resized to PNG.
+func (s *AssetStore) build(hash string, data []byte) (*Asset, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errUnsupportedImage
+	}
+	if cfg.Width*cfg.Height > maxAssetPixels {
+		return nil, errors.New("image is too large: at most " + strconv.Itoa(maxAssetPixels) + " pixels")
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errUnsupportedImage
+	}
+
+	asset := &Asset{
+		Hash:        hash,
+		ContentType: "image/" + format,
+		Width:       cfg.Width,
+		Height:      cfg.Height,
+		Size:        len(data),
+		data:        data,
+		variants:    make(map[string][]byte, len(assetSlots)),
+	}
+	for _, slot := range assetSlots {
+		var buf bytes.Buffer
+		resized := resizeToFill(img, slot.Width, slot.Height)
+		if format == "jpeg" {
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, resized)
+		}
+		if err != nil {
+			return nil, err
+		}
+		asset.variants[slot.Name] = buf.Bytes()
+	}
+	s.addURLs(asset)
+	return asset, nil
+}
+
+func (s *AssetStore) addURLs(asset *Asset) {
+	asset.URL = s.baseURL + "/assets/" + asset.Hash
+	asset.Slots = make(map[string]string, len(assetSlots))
+	for _, slot := range assetSlots {
+		asset.Slots[slot.Name] = asset.URL + "?slot=" + slot.Name
+	}
+}
+
+func (s *AssetStore) get(hash string) (*Asset, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	asset, ok := s.assets[hash]
+	return asset, ok
+}
+
+// Get returns an asset, loading it from ASSET_DIR if it isn't in memory
+func (s *AssetStore) Get(hash string) (*Asset, error) {
+	if asset, ok := s.get(hash); ok {
+		return asset, nil
+	}
+	if s.dir == "" {
+		return nil, ErrNotFound
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Variants are rebuilt rather than read back, which also picks up
+	// slots added since the upload
+	asset, err := s.build(hash, data)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.assets[hash]; ok {
+		return existing, nil
+	}
+	s.assets[hash] = asset
+	return asset, nil
+}
+
+func (s *AssetStore) persist(asset *Asset) error {
+	path := filepath.Join(s.dir, asset.Hash)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, asset.data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// resizeToFill scales img to cover width x height and crops the overflow
+// evenly from both sides, sampling bilinearly
+func resizeToFill(img image.Image, width, height int) *image.NRGBA {
+	src := image.NewNRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	sw, sh := float64(src.Bounds().Dx()), float64(src.Bounds().Dy())
+
+	scale := float64(width) / sw
+	if s := float64(height) / sh; s > scale {
+		scale = s
+	}
+	offsetX := (sw*scale - float64(width)) / 2
+	offsetY := (sh*scale - float64(height)) / 2
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy := (float64(y)+offsetY+0.5)/scale - 0.5
+		for x := 0; x < width; x++ {
+			sx := (float64(x)+offsetX+0.5)/scale - 0.5
+			dst.SetNRGBA(x, y, bilinear(src, sx, sy))
+		}
+	}
+	return dst
+}
+
+func bilinear(src *image.NRGBA, x, y float64) color.NRGBA {
+	maxX, maxY := src.Bounds().Dx()-1, src.Bounds().Dy()-1
+	clamp := func(v, max int) int {
+		if v < 0 {
+			return 0
+		}
+		if v > max {
+			return max
+		}
+		return v
+	}
+	x0, y0 := int(x), int(y)
+	if x < 0 {
+		x0 = -1
+	}
+	if y < 0 {
+		y0 = -1
+	}
+	fx, fy := x-float64(x0), y-float64(y0)
+	c00 := src.NRGBAAt(clamp(x0, maxX), clamp(y0, maxY))
+	c10 := src.NRGBAAt(clamp(x0+1, maxX), clamp(y0, maxY))
+	c01 := src.NRGBAAt(clamp(x0, maxX), clamp(y0+1, maxY))
+	c11 := src.NRGBAAt(clamp(x0+1, maxX), clamp(y0+1, maxY))
+	mix := func(a, b, c, d uint8) uint8 {
+		top := float64(a)*(1-fx) + float64(b)*fx
+		bottom := float64(c)*(1-fx) + float64(d)*fx
+		return uint8(top*(1-fy) + bottom*fy + 0.5)
+	}
+	return color.NRGBA{
+		R: mix(c00.R, c10.R, c01.R, c11.R),
+		G: mix(c00.G, c10.G, c01.G, c11.G),
+		B: mix(c00.B, c10.B, c01.B, c11.B),
+		A: mix(c00.A, c10.A, c01.A, c11.A),
+	}
+}
+
+// uploadAsset stores the image in the "file" field of a multipart form.
+// Uploading the same bytes again returns the existing asset with 200.
+func uploadAsset(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "upload_asset")
+	defer span.End()
+	start := time.Now()
+
+	// Leave room for the multipart framing around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, assetStore.maxBytes+64<<10)
+	header, err := c.FormFile("file")
+	if err != nil {
+		assetUploads.WithLabelValues("rejected").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload an image in the multipart field \"file\""})
+		recordRequest("POST", "/assets", http.StatusBadRequest, start)
+		return
+	}
+	if header.Size > assetStore.maxBytes {
+		assetUploads.WithLabelValues("rejected").Inc()
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image too large", "limit_bytes": assetStore.maxBytes})
+		recordRequest("POST", "/assets", http.StatusRequestEntityTooLarge, start)
+		return
+	}
+	f, err := header.Open()
+	if err != nil {
+		assetUploads.WithLabelValues("rejected").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload"})
+		recordRequest("POST", "/assets", http.StatusBadRequest, start)
+		return
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		assetUploads.WithLabelValues("rejected").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload"})
+		recordRequest("POST", "/assets", http.StatusBadRequest, start)
+		return
+	}
+
+	asset, created, err := assetStore.Put(data)
+	if err != nil {
+		assetUploads.WithLabelValues("rejected").Inc()
+		status := http.StatusUnprocessableEntity
+		if !errors.Is(err, errUnsupportedImage) && !strings.HasPrefix(err.Error(), "image is too large") {
+			status = http.StatusInternalServerError
+			logger.Error(ctx, "Failed to store asset", map[string]interface{}{"error": err.Error()})
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		recordRequest("POST", "/assets", status, start)
+		return
+	}
+
+	status := http.StatusOK
+	result := "existing"
+	if created {
+		status = http.StatusCreated
+		result = "created"
+		logger.Info(ctx, "Asset uploaded", map[string]interface{}{
+			"hash":         asset.Hash,
+			"content_type": asset.ContentType,
+			"size":         asset.Size,
+		})
+	}
+	assetUploads.WithLabelValues(result).Inc()
+	span.SetAttributes(attribute.String("asset.hash", asset.Hash), attribute.Bool("asset.created", created))
+	c.Header("Location", asset.URL)
+	c.JSON(status, asset)
+	recordRequest("POST", "/assets", status, start)
+}
+
+// getAsset serves an asset, or with ?slot= its variant for that slot.
+// Content never changes for a hash, so responses may be cached forever.
+func getAsset(c *gin.Context) {
+	start := time.Now()
+	hash := c.Param("hash")
+	if !validAssetHash.MatchString(hash) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+		recordRequest("GET", "/assets/:hash", http.StatusNotFound, start)
+		return
+	}
+
+	asset, err := assetStore.Get(hash)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+		recordRequest("GET", "/assets/:hash", http.StatusNotFound, start)
+		return
+	}
+	if err != nil {
+		logger.Error(c.Request.Context(), "Failed to load asset", map[string]interface{}{"hash": hash, "error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load asset"})
+		recordRequest("GET", "/assets/:hash", http.StatusInternalServerError, start)
+		return
+	}
+
+	data, contentType, etag := asset.data, asset.ContentType, `"`+hash+`"`
+	if slot := c.Query("slot"); slot != "" {
+		variant, ok := asset.variants[slot]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown slot", "slots": assetSlots})
+			recordRequest("GET", "/assets/:hash", http.StatusBadRequest, start)
+			return
+		}
+		data, etag = variant, `"`+hash+"-"+slot+`"`
+		if contentType != "image/jpeg" {
+			contentType = "image/png"
+		}
+	}
+
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		recordRequest("GET", "/assets/:hash", http.StatusNotModified, start)
+		return
+	}
+	c.Data(http.StatusOK, contentType, data)
+	recordRequest("GET", "/assets/:hash", http.StatusOK, start)
+}
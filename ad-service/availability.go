@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+// Stock filter modes
+const (
+	StockFilterOff     = "off"
+	StockFilterDemote  = "demote"
+	StockFilterExclude = "exclude"
+)
+
+var stockSuppressed = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ad_service_stock_suppressed_total",
+		Help: "Number of selected ads excluded or demoted because their product is out of stock",
+	},
+	[]string{"action"},
+)
+
+type stockEntry struct {
+	inStock bool
+	expires time.Time
+}
+
+// StockFilter keeps ads for sold-out products out of the top slots. Stock
+// levels come from inventory-service and are cached for a short TTL, so a
+// busy ad path costs one inventory lookup per product per TTL. Products
+// inventory-service doesn't know, or can't answer for, count as in stock.
+type StockFilter struct {
+	mu           sync.Mutex
+	mode         string
+	inventoryURL string
+	ttl          time.Duration
+	client       *http.Client
+	entries      map[int]stockEntry
+}
+
+var stockFilter *StockFilter
+
+// NewStockFilterFromEnv reads STOCK_FILTER_MODE (off, demote or exclude;
+// default off), STOCK_CACHE_TTL (default 10s), STOCK_CHECK_TIMEOUT
+// (default 300ms) and INVENTORY_SERVICE
+func NewStockFilterFromEnv() *StockFilter {
+	mode := platform.GetEnv("STOCK_FILTER_MODE", StockFilterOff)
+	switch mode {
+	case StockFilterOff, StockFilterDemote, StockFilterExclude:
+	default:
+		logger.Warn(context.Background(), "Unknown STOCK_FILTER_MODE, stock filtering disabled", map[string]interface{}{"mode": mode})
+		mode = StockFilterOff
+	}
+	ttl, err := time.ParseDuration(platform.GetEnv("STOCK_CACHE_TTL", "10s"))
+	if err != nil || ttl <= 0 {
+		ttl = 10 * time.Second
+	}
+	timeout, err := time.ParseDuration(platform.GetEnv("STOCK_CHECK_TIMEOUT", "300ms"))
+	if err != nil || timeout <= 0 {
+		timeout = 300 * time.Millisecond
+	}
+	return &StockFilter{
+		mode:         mode,
+		inventoryURL: platform.GetEnv("INVENTORY_SERVICE", "http://inventory-service:8085"),
+		ttl:          ttl,
+		client:       platform.NewHTTPClient(logger, timeout),
+		entries:      make(map[int]stockEntry),
+	}
+}
+
+func (s *StockFilter) Enabled() bool {
+	return s != nil && s.mode != StockFilterOff
+}
+
+// Apply excludes or demotes the selected ads whose product is out of stock.
+// Excluded slots are backfilled from candidates that are in stock, like
+// frequency capping does.
+func (s *StockFilter) Apply(ctx context.Context, selected, candidates []Ad) []Ad {
+	if !s.Enabled() || len(selected) == 0 {
+		return selected
+	}
+	s.prefetch(ctx, selected)
+
+	if s.mode == StockFilterDemote {
+		inStock := make([]Ad, 0, len(selected))
+		var soldOut []Ad
+		for _, ad := range selected {
+			if s.InStock(ctx, ad.ProductID) {
+				inStock = append(inStock, ad)
+			} else {
+				soldOut = append(soldOut, ad)
+			}
+		}
+		if len(soldOut) > 0 {
+			stockSuppressed.WithLabelValues(StockFilterDemote).Add(float64(len(soldOut)))
+		}
+		return append(inStock, soldOut...)
+	}
+
+	result := make([]Ad, 0, len(selected))
+	used := make(map[string]bool)
+	excluded := 0
+	for _, ad := range selected {
+		used[ad.ID] = true
+		if s.InStock(ctx, ad.ProductID) {
+			result = append(result, ad)
+		} else {
+			excluded++
+		}
+	}
+	if excluded == 0 {
+		return result
+	}
+	stockSuppressed.WithLabelValues(StockFilterExclude).Add(float64(excluded))
+
+	for _, ad := range candidates {
+		if len(result) >= len(selected) {
+			break
+		}
+		if used[ad.ID] || !s.InStock(ctx, ad.ProductID) {
+			continue
+		}
+		result = append(result, ad)
+		used[ad.ID] = true
+	}
+	return result
+}
+
+// prefetch looks up the uncached products of ads concurrently, so a cold
+// cache costs one round trip rather than one per ad
+func (s *StockFilter) prefetch(ctx context.Context, ads []Ad) {
+	s.mu.Lock()
+	now := time.Now()
+	missing := make(map[int]bool)
+	for _, ad := range ads {
+		if entry, ok := s.entries[ad.ProductID]; ad.ProductID > 0 && (!ok || now.After(entry.expires)) {
+			missing[ad.ProductID] = true
+		}
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for productID := range missing {
+		wg.Add(1)
+		go func(productID int) {
+			defer wg.Done()
+			defer platform.RecoverPanic(ctx, logger, "stock-check")
+			s.InStock(ctx, productID)
+		}(productID)
+	}
+	wg.Wait()
+}
+
+// InStock reports whether the product has stock available, from the cache
+// when it is fresh. Ads without a product are always in stock.
+func (s *StockFilter) InStock(ctx context.Context, productID int) bool {
+	if productID <= 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	entry, ok := s.entries[productID]
+	s.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.inStock
+	}
+
+	inStock := true
+	available, err := s.fetch(ctx, productID)
+	if err != nil {
+		logger.Warn(ctx, "Stock check failed, treating product as in stock", map[string]interface{}{
+			"product_id": productID,
+			"error":      err.Error(),
+		})
+	} else {
+		inStock = available > 0
+	}
+
+	// Failures are cached too, so an inventory outage doesn't add a
+	// timeout to every ad request
+	s.mu.Lock()
+	s.entries[productID] = stockEntry{inStock: inStock, expires: time.Now().Add(s.ttl)}
+	s.mu.Unlock()
+	return inStock
+}
+
+// fetch returns the product's available quantity. Products inventory-service
+// doesn't track are reported as available.
+func (s *StockFilter) fetch(ctx context.Context, productID int) (int, error) {
+	ctx, span := tracer.Start(ctx, "check_stock")
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.inventoryURL+"/inventory/"+strconv.Itoa(productID), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 1, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("inventory-service returned status %d", resp.StatusCode)
+	}
+
+	var inventory struct {
+		Available int `json:"available"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&inventory); err != nil {
+		return 0, fmt.Errorf("failed to decode inventory: %w", err)
+	}
+	return inventory.Available, nil
+}
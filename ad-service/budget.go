@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Campaign pacing modes
+const (
+	// PacingASAP spends the daily budget as fast as traffic allows
+	PacingASAP = "asap"
+	// PacingEven spreads the daily budget evenly across the day
+	PacingEven = "even"
+)
+
+// defaultCostPerImpression is charged when a campaign doesn't set its own
+const defaultCostPerImpression = 0.01
+
+var campaignBudgetRemaining = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "ad_service_campaign_budget_remaining",
+		Help: "Remaining daily budget per campaign",
+	},
+	[]string{"campaign_id"},
+)
+
+// BudgetStatus is a campaign's spend against its budgets at a point in time
+type BudgetStatus struct {
+	CampaignID     string  `json:"campaign_id"`
+	Pacing         string  `json:"pacing"`
+	DailyBudget    float64 `json:"daily_budget"`
+	SpentToday     float64 `json:"spent_today"`
+	RemainingToday float64 `json:"remaining_today"`
+	Budget         float64 `json:"budget"`
+	SpentTotal     float64 `json:"spent_total"`
+	Exhausted      bool    `json:"exhausted"`
+	Throttled      bool    `json:"throttled"`
+}
+
+// BudgetTracker records campaign spend per day and in total
+type BudgetTracker struct {
+	mu    sync.Mutex
+	day   string
+	today map[string]float64
+	total map[string]float64
+}
+
+var budgets = NewBudgetTracker()
+
+func NewBudgetTracker() *BudgetTracker {
+	return &BudgetTracker{
+		today: make(map[string]float64),
+		total: make(map[string]float64),
+	}
+}
+
+// rollover resets daily spend when the UTC day changes; callers hold mu
+func (b *BudgetTracker) rollover(now time.Time) {
+	day := now.UTC().Format("2006-01-02")
+	if day != b.day {
+		b.day = day
+		b.today = make(map[string]float64)
+	}
+}
+
+// Charge records one impression against the campaign's budgets
+func (b *BudgetTracker) Charge(campaign Campaign, now time.Time) BudgetStatus {
+	cost := campaign.CostPerImpression
+	if cost <= 0 {
+		cost = defaultCostPerImpression
+	}
+
+	b.mu.Lock()
+	b.rollover(now)
+	b.today[campaign.ID] += cost
+	b.total[campaign.ID] += cost
+	b.mu.Unlock()
+
+	return b.Status(campaign, now)
+}
+
+// Status reports the campaign's spend and whether it may serve at now
+func (b *BudgetTracker) Status(campaign Campaign, now time.Time) BudgetStatus {
+	b.mu.Lock()
+	b.rollover(now)
+	spentToday := b.today[campaign.ID]
+	spentTotal := b.total[campaign.ID]
+	b.mu.Unlock()
+
+	status := BudgetStatus{
+		CampaignID:  campaign.ID,
+		Pacing:      campaign.Pacing,
+		DailyBudget: campaign.DailyBudget,
+		SpentToday:  spentToday,
+		Budget:      campaign.Budget,
+		SpentTotal:  spentTotal,
+	}
+	if status.Pacing == "" {
+		status.Pacing = PacingASAP
+	}
+
+	if campaign.Budget > 0 && spentTotal >= campaign.Budget {
+		status.Exhausted = true
+	}
+	if campaign.DailyBudget > 0 {
+		status.RemainingToday = campaign.DailyBudget - spentToday
+		if status.RemainingToday <= 0 {
+			status.RemainingToday = 0
+			status.Exhausted = true
+		}
+
+		// Even pacing only allows the share of the daily budget that
+		// corresponds to how much of the day has elapsed
+		if status.Pacing == PacingEven && !status.Exhausted {
+			midnight := now.UTC().Truncate(24 * time.Hour)
+			elapsed := now.UTC().Sub(midnight).Seconds() / (24 * time.Hour).Seconds()
+			if spentToday >= campaign.DailyBudget*elapsed {
+				status.Throttled = true
+			}
+		}
+
+		campaignBudgetRemaining.WithLabelValues(campaign.ID).Set(status.RemainingToday)
+	}
+
+	return status
+}
+
+// CanServe reports whether the campaign has budget left to serve at now
+func (b *BudgetTracker) CanServe(campaign Campaign, now time.Time) bool {
+	status := b.Status(campaign, now)
+	return !status.Exhausted && !status.Throttled
+}
+
+func getCampaignBudget(c *gin.Context) {
+	start := time.Now()
+	id := c.Param("id")
+
+	campaign, err := adStore.GetCampaign(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		recordRequest("GET", "/campaign/:id/budget", http.StatusNotFound, start)
+		return
+	}
+
+	c.JSON(http.StatusOK, budgets.Status(campaign, time.Now()))
+	recordRequest("GET", "/campaign/:id/budget", http.StatusOK, start)
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// recordRequest updates the request metrics for a handler
+func recordRequest(method, endpoint string, status int, start time.Time) {
+	requestCount.WithLabelValues(method, endpoint, strconv.Itoa(status)).Inc()
+	responseTime.WithLabelValues(method, endpoint).Observe(time.Since(start).Seconds())
+}
+
+// servableAds returns house ads plus ads whose campaign is currently live
+// and has budget left
+func servableAds() []Ad {
+	now := time.Now()
+	live := make(map[string]bool)
+	for _, campaign := range adStore.ListCampaigns() {
+		live[campaign.ID] = campaign.IsLive(now) && budgets.CanServe(campaign, now)
+	}
+
+	var result []Ad
+	for _, ad := range adStore.ListAds() {
+		if ad.CampaignID == "" || live[ad.CampaignID] {
+			result = append(result, ad)
+		}
+	}
+	return priceAds(result)
+}
+
+func validateAd(ad Ad) string {
+	if ad.Text == "" {
+		return "text is required"
+	}
+	if ad.RedirectURL == "" {
+		return "redirect_url is required"
+	}
+	if ad.Category == "" {
+		return "category is required"
+	}
+	if strings.Contains(ad.Text, pricePlaceholder) && ad.ProductID == 0 {
+		return "text with " + pricePlaceholder + " requires a product_id"
+	}
+	if ad.CampaignID != "" {
+		if _, err := adStore.GetCampaign(ad.CampaignID); err != nil {
+			return "campaign_id does not exist"
+		}
+	}
+	return ""
+}
+
+func validateCampaign(campaign Campaign) string {
+	if campaign.Name == "" {
+		return "name is required"
+	}
+	switch campaign.Status {
+	case CampaignDraft, CampaignActive, CampaignPaused, CampaignCompleted:
+	default:
+		return "status must be one of draft, active, paused, completed"
+	}
+	if campaign.Budget < 0 {
+		return "budget must not be negative"
+	}
+	if campaign.DailyBudget < 0 {
+		return "daily_budget must not be negative"
+	}
+	if campaign.CostPerImpression < 0 {
+		return "cost_per_impression must not be negative"
+	}
+	switch campaign.Pacing {
+	case PacingASAP, PacingEven:
+	default:
+		return "pacing must be one of asap, even"
+	}
+	if !campaign.StartDate.IsZero() && !campaign.EndDate.IsZero() && campaign.EndDate.Before(campaign.StartDate) {
+		return "end_date must be after start_date"
+	}
+	return ""
+}
+
+func createAd(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "create_ad")
+	defer span.End()
+	start := time.Now()
+
+	var ad Ad
+	if err := c.ShouldBindJSON(&ad); err != nil {
+		logger.Warn(ctx, "Invalid ad payload", map[string]interface{}{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ad payload"})
+		recordRequest("POST", "/ads", http.StatusBadRequest, start)
+		return
+	}
+
+	if msg := validateAd(ad); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		recordRequest("POST", "/ads", http.StatusBadRequest, start)
+		return
+	}
+
+	created, err := adStore.CreateAd(ad)
+	if errors.Is(err, ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ad already exists"})
+		recordRequest("POST", "/ads", http.StatusConflict, start)
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to create ad", map[string]interface{}{"error": err.Error()})
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ad"})
+		recordRequest("POST", "/ads", http.StatusInternalServerError, start)
+		return
+	}
+
+	span.SetAttributes(attribute.String("ad.id", created.ID))
+	logger.Info(ctx, "Ad created", map[string]interface{}{"ad_id": created.ID, "campaign_id": created.CampaignID})
+	c.JSON(http.StatusCreated, created)
+	recordRequest("POST", "/ads", http.StatusCreated, start)
+}
+
+func updateAd(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "update_ad")
+	defer span.End()
+	start := time.Now()
+
+	id := c.Param("id")
+	span.SetAttributes(attribute.String("ad.id", id))
+
+	var ad Ad
+	if err := c.ShouldBindJSON(&ad); err != nil {
+		logger.Warn(ctx, "Invalid ad payload", map[string]interface{}{"ad_id": id, "error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ad payload"})
+		recordRequest("PUT", "/ad/:id", http.StatusBadRequest, start)
+		return
+	}
+	ad.ID = id
+
+	if msg := validateAd(ad); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		recordRequest("PUT", "/ad/:id", http.StatusBadRequest, start)
+		return
+	}
+
+	updated, err := adStore.UpdateAd(ad)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		recordRequest("PUT", "/ad/:id", http.StatusNotFound, start)
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to update ad", map[string]interface{}{"ad_id": id, "error": err.Error()})
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ad"})
+		recordRequest("PUT", "/ad/:id", http.StatusInternalServerError, start)
+		return
+	}
+
+	logger.Info(ctx, "Ad updated", map[string]interface{}{"ad_id": id})
+	c.JSON(http.StatusOK, updated)
+	recordRequest("PUT", "/ad/:id", http.StatusOK, start)
+}
+
+func deleteAd(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "delete_ad")
+	defer span.End()
+	start := time.Now()
+
+	id := c.Param("id")
+	span.SetAttributes(attribute.String("ad.id", id))
+
+	err := adStore.DeleteAd(id)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		recordRequest("DELETE", "/ad/:id", http.StatusNotFound, start)
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to delete ad", map[string]interface{}{"ad_id": id, "error": err.Error()})
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete ad"})
+		recordRequest("DELETE", "/ad/:id", http.StatusInternalServerError, start)
+		return
+	}
+
+	logger.Info(ctx, "Ad deleted", map[string]interface{}{"ad_id": id})
+	c.Status(http.StatusNoContent)
+	recordRequest("DELETE", "/ad/:id", http.StatusNoContent, start)
+}
+
+func listCampaigns(c *gin.Context) {
+	start := time.Now()
+	c.JSON(http.StatusOK, adStore.ListCampaigns())
+	recordRequest("GET", "/campaigns", http.StatusOK, start)
+}
+
+func getCampaign(c *gin.Context) {
+	start := time.Now()
+	id := c.Param("id")
+
+	campaign, err := adStore.GetCampaign(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		recordRequest("GET", "/campaign/:id", http.StatusNotFound, start)
+		return
+	}
+
+	var campaignAds []Ad
+	for _, ad := range adStore.ListAds() {
+		if ad.CampaignID == id {
+			campaignAds = append(campaignAds, ad)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"campaign": campaign,
+		"ads":      campaignAds,
+		"live":     campaign.IsLive(time.Now()),
+		"budget":   budgets.Status(campaign, time.Now()),
+	})
+	recordRequest("GET", "/campaign/:id", http.StatusOK, start)
+}
+
+func createCampaign(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "create_campaign")
+	defer span.End()
+	start := time.Now()
+
+	var campaign Campaign
+	if err := c.ShouldBindJSON(&campaign); err != nil {
+		logger.Warn(ctx, "Invalid campaign payload", map[string]interface{}{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign payload"})
+		recordRequest("POST", "/campaigns", http.StatusBadRequest, start)
+		return
+	}
+	if campaign.Status == "" {
+		campaign.Status = CampaignDraft
+	}
+	if campaign.Pacing == "" {
+		campaign.Pacing = PacingASAP
+	}
+
+	if msg := validateCampaign(campaign); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		recordRequest("POST", "/campaigns", http.StatusBadRequest, start)
+		return
+	}
+
+	created, err := adStore.CreateCampaign(campaign)
+	if errors.Is(err, ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Campaign already exists"})
+		recordRequest("POST", "/campaigns", http.StatusConflict, start)
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to create campaign", map[string]interface{}{"error": err.Error()})
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create campaign"})
+		recordRequest("POST", "/campaigns", http.StatusInternalServerError, start)
+		return
+	}
+
+	span.SetAttributes(attribute.String("campaign.id", created.ID))
+	logger.Info(ctx, "Campaign created", map[string]interface{}{"campaign_id": created.ID, "status": created.Status})
+	c.JSON(http.StatusCreated, created)
+	recordRequest("POST", "/campaigns", http.StatusCreated, start)
+}
+
+func updateCampaign(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "update_campaign")
+	defer span.End()
+	start := time.Now()
+
+	id := c.Param("id")
+	span.SetAttributes(attribute.String("campaign.id", id))
+
+	var campaign Campaign
+	if err := c.ShouldBindJSON(&campaign); err != nil {
+		logger.Warn(ctx, "Invalid campaign payload", map[string]interface{}{"campaign_id": id, "error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign payload"})
+		recordRequest("PUT", "/campaign/:id", http.StatusBadRequest, start)
+		return
+	}
+	campaign.ID = id
+	if campaign.Status == "" {
+		campaign.Status = CampaignDraft
+	}
+	if campaign.Pacing == "" {
+		campaign.Pacing = PacingASAP
+	}
+
+	if msg := validateCampaign(campaign); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		recordRequest("PUT", "/campaign/:id", http.StatusBadRequest, start)
+		return
+	}
+
+	updated, err := adStore.UpdateCampaign(campaign)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		recordRequest("PUT", "/campaign/:id", http.StatusNotFound, start)
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to update campaign", map[string]interface{}{"campaign_id": id, "error": err.Error()})
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update campaign"})
+		recordRequest("PUT", "/campaign/:id", http.StatusInternalServerError, start)
+		return
+	}
+
+	logger.Info(ctx, "Campaign updated", map[string]interface{}{"campaign_id": id, "status": updated.Status})
+	c.JSON(http.StatusOK, updated)
+	recordRequest("PUT", "/campaign/:id", http.StatusOK, start)
+}
+
+func deleteCampaign(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "delete_campaign")
+	defer span.End()
+	start := time.Now()
+
+	id := c.Param("id")
+	span.SetAttributes(attribute.String("campaign.id", id))
+
+	err := adStore.DeleteCampaign(id)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		recordRequest("DELETE", "/campaign/:id", http.StatusNotFound, start)
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to delete campaign", map[string]interface{}{"campaign_id": id, "error": err.Error()})
+		span.RecordError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete campaign"})
+		recordRequest("DELETE", "/campaign/:id", http.StatusInternalServerError, start)
+		return
+	}
+
+	logger.Info(ctx, "Campaign deleted", map[string]interface{}{"campaign_id": id})
+	c.Status(http.StatusNoContent)
+	recordRequest("DELETE", "/campaign/:id", http.StatusNoContent, start)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Creative limits
+const (
+	minAdTextLength = 10
+	maxAdTextLength = 140
+)
+
+// creativeClient records a span per probe but sends no trace headers, since
+// creative URLs point at third-party servers
+var creativeClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: otelhttp.NewTransport(http.DefaultTransport,
+		otelhttp.WithPropagators(propagation.NewCompositeTextMapPropagator())),
+}
+
+// CreativeCheck is the outcome of one validation rule
+type CreativeCheck struct {
+	Field   string `json:"field"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message"`
+}
+
+// probeURL fetches rawURL with HEAD, falling back to GET for servers that
+// don't support HEAD, and returns the final response
+func probeURL(ctx context.Context, rawURL string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("not an absolute http(s) URL")
+	}
+
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := creativeClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusMethodNotAllowed && method == http.MethodHead {
+			continue
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("no usable response")
+}
+
+func checkText(ad Ad) CreativeCheck {
+	n := len([]rune(strings.TrimSpace(ad.Text)))
+	switch {
+	case n < minAdTextLength:
+		return CreativeCheck{Field: "text", Message: fmt.Sprintf("text is %d characters, minimum is %d", n, minAdTextLength)}
+	case n > maxAdTextLength:
+		return CreativeCheck{Field: "text", Message: fmt.Sprintf("text is %d characters, maximum is %d", n, maxAdTextLength)}
+	}
+	return CreativeCheck{Field: "text", OK: true, Message: fmt.Sprintf("%d characters", n)}
+}
+
+func checkRedirectURL(ctx context.Context, ad Ad) CreativeCheck {
+	resp, err := probeURL(ctx, ad.RedirectURL)
+	if err != nil {
+		return CreativeCheck{Field: "redirect_url", Message: err.Error()}
+	}
+	if resp.StatusCode >= 400 {
+		return CreativeCheck{Field: "redirect_url", Message: fmt.Sprintf("returned status %d", resp.StatusCode)}
+	}
+	return CreativeCheck{Field: "redirect_url", OK: true, Message: fmt.Sprintf("returned status %d", resp.StatusCode)}
+}
+
+func checkImageURL(ctx context.Context, ad Ad) CreativeCheck {
+	resp, err := probeURL(ctx, ad.ImageURL)
+	if err != nil {
+		return CreativeCheck{Field: "image_url", Message: err.Error()}
+	}
+	if resp.StatusCode >= 400 {
+		return CreativeCheck{Field: "image_url", Message: fmt.Sprintf("returned status %d", resp.StatusCode)}
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		return CreativeCheck{Field: "image_url", Message: fmt.Sprintf("content type %q is not an image", contentType)}
+	}
+	return CreativeCheck{Field: "image_url", OK: true, Message: contentType}
+}
+
+// validateCreative runs all creative checks, probing URLs in parallel
+func validateCreative(ctx context.Context, ad Ad) []CreativeCheck {
+	checks := make([]CreativeCheck, 3)
+	checks[0] = checkText(ad)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		checks[1] = checkRedirectURL(ctx, ad)
+	}()
+	go func() {
+		defer wg.Done()
+		checks[2] = checkImageURL(ctx, ad)
+	}()
+	wg.Wait()
+
+	return checks
+}
+
+func validateAdCreative(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "validate_ad_creative")
+	defer span.End()
+	start := time.Now()
+
+	var ad Ad
+	if err := c.ShouldBindJSON(&ad); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ad payload"})
+		recordRequest("POST", "/ads/validate", http.StatusBadRequest, start)
+		return
+	}
+
+	checks := validateCreative(ctx, ad)
+	valid := true
+	for _, check := range checks {
+		valid = valid && check.OK
+	}
+
+	logger.Info(ctx, "Ad creative validated", map[string]interface{}{"ad_id": ad.ID, "valid": valid})
+	c.JSON(http.StatusOK, gin.H{"valid": valid, "checks": checks})
+	recordRequest("POST", "/ads/validate", http.StatusOK, start)
+}
+
+var previewTemplate = template.Must(template.New("preview").Parse(`<div class="ad-slot" data-ad-id="{{.ID}}" style="font-family: sans-serif; max-width: 320px; border: 1px solid #ddd; border-radius: 8px; overflow: hidden;">
+  <a href="{{.RedirectURL}}" target="_blank" rel="noopener" style="text-decoration: none; color: inherit;">
+    <img src="{{.ImageURL}}" alt="{{.Text}}" style="width: 100%; display: block;">
+    <p style="margin: 12px; font-size: 14px;">{{.Text}}</p>
+    <span style="display: block; margin: 0 12px 12px; font-size: 11px; color: #888;">Sponsored &middot; {{.Category}}</span>
+  </a>
+</div>`))
+
+func previewAd(c *gin.Context) {
+	start := time.Now()
+	id := c.Param("id")
+
+	ad, err := adStore.GetAd(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		recordRequest("GET", "/ad/:id/preview", http.StatusNotFound, start)
+		return
+	}
+
+	// Show the price the ad would quote now, or the placeholder if none
+	if rendered, ok := priceCache.Render(ad); ok {
+		ad = rendered
+	}
+
+	var buf bytes.Buffer
+	if err := previewTemplate.Execute(&buf, ad); err != nil {
+		logger.Error(c.Request.Context(), "Failed to render ad preview", map[string]interface{}{"ad_id": id, "error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render preview"})
+		recordRequest("GET", "/ad/:id/preview", http.StatusInternalServerError, start)
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+	recordRequest("GET", "/ad/:id/preview", http.StatusOK, start)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+var frequencyCapped = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "ad_service_frequency_capped_total",
+		Help: "Number of ads withheld because the session hit its frequency cap",
+	},
+)
+
+// FrequencyCapper limits how often a session sees the same ad within a
+// sliding window
+type FrequencyCapper struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	exposures map[string]map[string][]time.Time
+	lastSweep time.Time
+}
+
+var frequencyCapper *FrequencyCapper
+
+// NewFrequencyCapperFromEnv reads FREQUENCY_CAP (max impressions per ad per
+// session, 0 disables capping) and FREQUENCY_CAP_WINDOW (default 1h)
+func NewFrequencyCapperFromEnv() *FrequencyCapper {
+	limit, _ := strconv.Atoi(config.Get("FREQUENCY_CAP"))
+	window, err := time.ParseDuration(platform.GetEnv("FREQUENCY_CAP_WINDOW", "1h"))
+	if err != nil || window <= 0 {
+		window = time.Hour
+	}
+	return &FrequencyCapper{
+		limit:     limit,
+		window:    window,
+		exposures: make(map[string]map[string][]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+func (f *FrequencyCapper) Enabled() bool {
+	return f != nil && f.limit > 0
+}
+
+// recent drops expired exposures and returns the ones still in the window.
+// Callers must hold f.mu.
+func (f *FrequencyCapper) recent(sessionID, adID string, now time.Time) []time.Time {
+	seen := f.exposures[sessionID][adID]
+	cutoff := now.Add(-f.window)
+	i := 0
+	for i < len(seen) && seen[i].Before(cutoff) {
+		i++
+	}
+	return seen[i:]
+}
+
+// Apply removes capped ads from selected, backfills from candidates that are
+// still under the cap, and records an exposure for every ad returned
+func (f *FrequencyCapper) Apply(sessionID string, selected, candidates []Ad) []Ad {
+	if !f.Enabled() || sessionID == "" {
+		return selected
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	f.sweep(now)
+
+	sessionExposures, ok := f.exposures[sessionID]
+	if !ok {
+		sessionExposures = make(map[string][]time.Time)
+		f.exposures[sessionID] = sessionExposures
+	}
+
+	underCap := func(ad Ad) bool {
+		seen := f.recent(sessionID, ad.ID, now)
+		sessionExposures[ad.ID] = seen
+		return len(seen) < f.limit
+	}
+
+	result := make([]Ad, 0, len(selected))
+	used := make(map[string]bool)
+	capped := 0
+	for _, ad := range selected {
+		if underCap(ad) {
+			result = append(result, ad)
+			used[ad.ID] = true
+		} else {
+			capped++
+		}
+	}
+
+	// Fall back to other eligible ads for the slots we freed up
+	for _, ad := range candidates {
+		if len(result) >= len(selected) {
+			break
+		}
+		if used[ad.ID] || !underCap(ad) {
+			continue
+		}
+		result = append(result, ad)
+		used[ad.ID] = true
+	}
+
+	for _, ad := range result {
+		sessionExposures[ad.ID] = append(sessionExposures[ad.ID], now)
+	}
+
+	if capped > 0 {
+		frequencyCapped.Add(float64(capped))
+	}
+	return result
+}
+
+// sweep forgets sessions with no exposures inside the window. Callers must
+// hold f.mu.
+func (f *FrequencyCapper) sweep(now time.Time) {
+	if now.Sub(f.lastSweep) < f.window {
+		return
+	}
+	f.lastSweep = now
+
+	for sessionID, ads := range f.exposures {
+		for adID := range ads {
+			if seen := f.recent(sessionID, adID, now); len(seen) > 0 {
+				ads[adID] = seen
+			} else {
+				delete(ads, adID)
+			}
+		}
+		if len(ads) == 0 {
+			delete(f.exposures, sessionID)
+		}
+	}
+}
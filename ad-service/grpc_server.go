@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"ad-service/adpb"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"platform"
+)
+
+// adServiceServer implements the gRPC AdService on top of the same
+// selection logic as the HTTP API
+type adServiceServer struct {
+	adpb.UnimplementedAdServiceServer
+}
+
+func (adServiceServer) GetAds(ctx context.Context, in *adpb.GetAdsRequest) (*adpb.GetAdsResponse, error) {
+	ctx, span := tracer.Start(ctx, "grpc_get_ads")
+	defer span.End()
+
+	logger.Info(ctx, "Handling gRPC get ads request", map[string]interface{}{"method": "GetAds"})
+
+	req := AdRequest{
+		ProductIDs: in.GetProductIds(),
+		Category:   in.GetCategory(),
+		SessionID:  in.GetSessionId(),
+		Strategy:   in.GetStrategy(),
+		User: UserContext{
+			Region:         in.GetRegion(),
+			Device:         in.GetDevice(),
+			PastCategories: in.GetPastCategories(),
+			Category:       in.GetCategory(),
+		},
+		Limit: defaultAdsLimit,
+	}
+	// The x-debug-seed metadata key works like the HTTP X-Debug-Seed header
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("x-debug-seed")) > 0 {
+		rng, ok := parseDebugSeed(md.Get("x-debug-seed")[0])
+		if !ok {
+			return nil, status.Error(codes.InvalidArgument, "x-debug-seed must be an integer")
+		}
+		req.Random = rng
+	}
+	for _, idStr := range in.GetProductIds() {
+		if id, err := strconv.Atoi(idStr); err == nil {
+			req.User.ProductIDs = append(req.User.ProductIDs, id)
+		}
+	}
+
+	selection, err := selectAds(ctx, req)
+	if errors.Is(err, errUnknownStrategy) {
+		return nil, status.Error(codes.InvalidArgument, "unknown rotation strategy")
+	}
+
+	resp := &adpb.GetAdsResponse{Strategy: selection.Strategy}
+	for _, ad := range selection.Ads {
+		resp.Ads = append(resp.Ads, adToProto(ad))
+	}
+	return resp, nil
+}
+
+func (adServiceServer) GetAd(ctx context.Context, in *adpb.GetAdRequest) (*adpb.Ad, error) {
+	ctx, span := tracer.Start(ctx, "grpc_get_ad_by_id")
+	defer span.End()
+
+	logger.Info(ctx, "Handling gRPC get ad by ID request", map[string]interface{}{"method": "GetAd", "ad_id": in.GetId()})
+
+	ad, err := adStore.GetAd(in.GetId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "ad not found")
+	}
+	return adToProto(ad), nil
+}
+
+func adToProto(ad Ad) *adpb.Ad {
+	pb := &adpb.Ad{
+		Id:          ad.ID,
+		RedirectUrl: ad.RedirectURL,
+		Text:        ad.Text,
+		ImageUrl:    ad.ImageURL,
+		ProductId:   int32(ad.ProductID),
+		Category:    ad.Category,
+		CampaignId:  ad.CampaignID,
+		Priority:    int32(ad.Priority),
+	}
+	if ad.Targeting != nil {
+		pb.Targeting = &adpb.Targeting{
+			Regions:   ad.Targeting.Regions,
+			Devices:   ad.Targeting.Devices,
+			Interests: ad.Targeting.Interests,
+		}
+	}
+	return pb
+}
+
+// grpcMetricsInterceptor records gRPC calls in the same request metrics as
+// HTTP so the two transports can be compared
+func grpcMetricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	requestCount.WithLabelValues("GRPC", info.FullMethod, status.Code(err).String()).Inc()
+	responseTime.WithLabelValues("GRPC", info.FullMethod).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// runGRPCServer serves the AdService on addr until ctx is cancelled, then
+// stops gracefully
+func runGRPCServer(ctx context.Context, addr string) error {
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.UnaryInterceptor(grpcMetricsInterceptor),
+	}
+	// Same certificates and client verification as the HTTP listener
+	tlsConfig, err := platform.ServerTLSConfig(logger)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := grpc.NewServer(opts...)
+	adpb.RegisterAdServiceServer(srv, adServiceServer{})
+
+	go func() {
+		<-ctx.Done()
+		srv.GracefulStop()
+	}()
+
+	return srv.Serve(lis)
+}
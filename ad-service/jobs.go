@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"platform"
+)
+
+// Job status values
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// maxJobHistory bounds how many finished jobs are kept for the status API
+const maxJobHistory = 200
+
+var (
+	ErrQueueFull          = errors.New("job queue is full")
+	ErrStepBudgetExceeded = errors.New("step budget exceeded")
+	ErrJobFinished        = errors.New("job already finished")
+	ErrProductBusy        = errors.New("too many jobs for this product")
+)
+
+var (
+	jobsProcessed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ad_service_jobs_total",
+			Help: "Number of product data processing jobs by final status",
+		},
+		[]string{"status"},
+	)
+	jobDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "ad_service_job_duration_seconds",
+			Help:    "Time product data processing jobs spent running, by final status",
+			Buckets: []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60},
+		},
+		[]string{"status"},
+	)
+	jobQueueWait = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "ad_service_job_queue_wait_seconds",
+			Help:    "Time product data processing jobs waited for a worker",
+			Buckets: []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60},
+		},
+	)
+	jobsRunning = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ad_service_jobs_running",
+			Help: "Number of product data processing jobs currently running",
+		},
+	)
+)
+
+// JobConfig tunes the product data processing workers
+type JobConfig struct {
+	Workers         int `json:"workers"`
+	QueueSize       int `json:"queue_size"`
+	Depth           int `json:"depth"`
+	FanOut          int `json:"fan_out"`
+	FanOutThreshold int `json:"fan_out_threshold"`
+	MaxSteps        int `json:"max_steps"`
+	// MaxPerProduct bounds the queued and running jobs for one product;
+	// 0 means unlimited
+	MaxPerProduct int `json:"max_per_product"`
+}
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(config.Get(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func jobConfigFromEnv() JobConfig {
+	return JobConfig{
+		Workers:         envInt("JOB_WORKERS", 2),
+		QueueSize:       envInt("JOB_QUEUE_SIZE", 16),
+		Depth:           envInt("JOB_DEPTH", 35),
+		FanOut:          envInt("JOB_FAN_OUT", 1),
+		FanOutThreshold: envInt("JOB_FAN_OUT_THRESHOLD", 20),
+		MaxSteps:        envInt("JOB_MAX_STEPS", 100000),
+		MaxPerProduct:   envInt("JOB_MAX_PER_PRODUCT", 0),
+	}
+}
+
+// Job is a unit of product data processing
+type Job struct {
+	ID         string     `json:"id"`
+	ProductID  string     `json:"product_id"`
+	Status     string     `json:"status"`
+	Depth      int        `json:"depth"`
+	FanOut     int        `json:"fan_out"`
+	Steps      int        `json:"steps"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	link   trace.Link
+}
+
+// JobQueue runs jobs on a fixed pool of workers fed by a bounded queue
+type JobQueue struct {
+	mu    sync.RWMutex
+	cfg   JobConfig
+	ctx   context.Context
+	jobs  map[string]*Job
+	order []string
+	queue chan *Job
+}
+
+var jobQueue *JobQueue
+
+func NewJobQueue(cfg JobConfig) *JobQueue {
+	return &JobQueue{
+		cfg:   cfg,
+		ctx:   context.Background(),
+		jobs:  make(map[string]*Job),
+		queue: make(chan *Job, cfg.QueueSize),
+	}
+}
+
+// Start launches the workers. Cancelling ctx cancels all running jobs.
+func (q *JobQueue) Start(ctx context.Context) {
+	q.mu.Lock()
+	q.ctx = ctx
+	q.mu.Unlock()
+
+	for i := 0; i < q.cfg.Workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-q.queue:
+					q.run(job)
+				}
+			}
+		}()
+	}
+}
+
+// Submit enqueues a job for productID, linking its span to the caller's
+func (q *JobQueue) Submit(ctx context.Context, productID string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.cfg.MaxPerProduct > 0 && q.active(productID) >= q.cfg.MaxPerProduct {
+		jobsProcessed.WithLabelValues("rejected").Inc()
+		return Job{}, ErrProductBusy
+	}
+
+	jobCtx, cancel := context.WithCancel(q.ctx)
+	job := &Job{
+		ID:        newID("job-"),
+		ProductID: productID,
+		Status:    JobQueued,
+		Depth:     q.cfg.Depth,
+		FanOut:    q.cfg.FanOut,
+		CreatedAt: time.Now().UTC(),
+		ctx:       jobCtx,
+		cancel:    cancel,
+		link:      trace.LinkFromContext(ctx),
+	}
+
+	select {
+	case q.queue <- job:
+	default:
+		cancel()
+		jobsProcessed.WithLabelValues("rejected").Inc()
+		return Job{}, ErrQueueFull
+	}
+
+	q.jobs[job.ID] = job
+	q.order = append(q.order, job.ID)
+	q.trim()
+	return *job, nil
+}
+
+// active counts the product's queued and running jobs. Callers must hold
+// q.mu.
+func (q *JobQueue) active(productID string) int {
+	n := 0
+	for _, job := range q.jobs {
+		if job.ProductID == productID && (job.Status == JobQueued || job.Status == JobRunning) {
+			n++
+		}
+	}
+	return n
+}
+
+// trim forgets the oldest finished jobs. Callers must hold q.mu.
+func (q *JobQueue) trim() {
+	for len(q.order) > maxJobHistory {
+		oldest := q.jobs[q.order[0]]
+		if oldest != nil && (oldest.Status == JobQueued || oldest.Status == JobRunning) {
+			return
+		}
+		delete(q.jobs, q.order[0])
+		q.order = q.order[1:]
+	}
+}
+
+func (q *JobQueue) Get(id string) (Job, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns all tracked jobs, newest first
+func (q *JobQueue) List() []Job {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	result := make([]Job, 0, len(q.order))
+	for i := len(q.order) - 1; i >= 0; i-- {
+		result = append(result, *q.jobs[q.order[i]])
+	}
+	return result
+}
+
+func (q *JobQueue) Cancel(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if job.Status != JobQueued && job.Status != JobRunning {
+		return ErrJobFinished
+	}
+	job.cancel()
+	return nil
+}
+
+// Depth is the number of jobs waiting for a worker
+func (q *JobQueue) Depth() int {
+	return len(q.queue)
+}
+
+func (q *JobQueue) setStatus(job *Job, status string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now().UTC()
+	job.Status = status
+	switch status {
+	case JobRunning:
+		job.StartedAt = &now
+	case JobCompleted, JobFailed, JobCancelled:
+		job.FinishedAt = &now
+	}
+}
+
+func (q *JobQueue) run(job *Job) {
+	defer job.cancel()
+
+	ctx, span := tracer.Start(job.ctx, "process_product_data",
+		trace.WithLinks(job.link),
+		trace.WithAttributes(
+			attribute.String("job.id", job.ID),
+			attribute.String("product.id", job.ProductID),
+			attribute.Int("job.depth", job.Depth),
+			attribute.Int("job.fan_out", job.FanOut),
+		),
+	)
+	defer span.End()
+	defer platform.RecoverPanic(ctx, logger, "product-data-job")
+
+	if ctx.Err() != nil {
+		q.setStatus(job, JobCancelled)
+		jobsProcessed.WithLabelValues(JobCancelled).Inc()
+		return
+	}
+
+	q.setStatus(job, JobRunning)
+	started := time.Now()
+	jobQueueWait.Observe(started.Sub(job.CreatedAt).Seconds())
+	jobsRunning.Inc()
+	defer jobsRunning.Dec()
+	logger.Info(ctx, "Processing product data", map[string]interface{}{"job_id": job.ID, "product_id": job.ProductID})
+
+	dataPoints := make(map[string]int)
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("%s-data-%d", job.ProductID, i)
+		dataPoints[key] = len(key) * i
+	}
+
+	steps, err := processItemsData(ctx, q.cfg, dataPoints)
+
+	q.mu.Lock()
+	job.Steps = steps
+	if err != nil {
+		job.Error = err.Error()
+	}
+	q.mu.Unlock()
+
+	span.SetAttributes(attribute.Int("job.steps", steps))
+
+	status := JobCompleted
+	switch {
+	case errors.Is(err, context.Canceled):
+		status = JobCancelled
+	case err != nil:
+		status = JobFailed
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	q.setStatus(job, status)
+	jobsProcessed.WithLabelValues(status).Inc()
+	jobDuration.WithLabelValues(status).Observe(time.Since(started).Seconds())
+
+	logger.Info(ctx, "Product data processing finished", map[string]interface{}{
+		"job_id":     job.ID,
+		"product_id": job.ProductID,
+		"status":     status,
+		"steps":      steps,
+	})
+}
+
+// processItemsData walks the processing tree iteratively. Nodes deeper than
+// FanOutThreshold spawn FanOut children; the walk stops once MaxSteps nodes
+// have been visited or ctx is cancelled.
+func processItemsData(ctx context.Context, cfg JobConfig, data map[string]int) (int, error) {
+	stack := []int{cfg.Depth}
+	steps := 0
+
+	for len(stack) > 0 {
+		if steps%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return steps, err
+			}
+		}
+
+		depth := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		steps++
+		if cfg.MaxSteps > 0 && steps > cfg.MaxSteps {
+			return steps, ErrStepBudgetExceeded
+		}
+		if depth <= 1 {
+			continue
+		}
+
+		for k := range data {
+			data[k] = len(k) + depth
+		}
+
+		children := 1
+		if depth > cfg.FanOutThreshold && cfg.FanOut > 1 {
+			children = cfg.FanOut
+		}
+		for i := 1; i <= children; i++ {
+			stack = append(stack, depth-i)
+		}
+	}
+
+	return steps, nil
+}
+
+func listJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"config":      jobQueue.cfg,
+		"queue_depth": jobQueue.Depth(),
+		"jobs":        jobQueue.List(),
+	})
+}
+
+// submitJob answers POST /jobs/process with {"product_id"}, queueing the
+// same product data processing that ad requests trigger
+func submitJob(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		ProductID string `json:"product_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.ProductID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "product_id is required"})
+		return
+	}
+
+	job, err := jobQueue.Submit(ctx, req.ProductID)
+	switch {
+	case errors.Is(err, ErrQueueFull):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Job queue is full", "queue_depth": jobQueue.Depth()})
+		return
+	case errors.Is(err, ErrProductBusy):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many jobs for this product", "max_per_product": jobQueue.cfg.MaxPerProduct})
+		return
+	}
+
+	logger.Info(ctx, "Job submitted", map[string]interface{}{"job_id": job.ID, "product_id": job.ProductID})
+	c.Header("Location", "/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+func getJob(c *gin.Context) {
+	job, ok := jobQueue.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func cancelJob(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	err := jobQueue.Cancel(id)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	case errors.Is(err, ErrJobFinished):
+		c.JSON(http.StatusConflict, gin.H{"error": "Job already finished"})
+		return
+	}
+
+	logger.Info(ctx, "Job cancellation requested", map[string]interface{}{"job_id": id})
+	job, _ := jobQueue.Get(id)
+	c.JSON(http.StatusAccepted, job)
+}
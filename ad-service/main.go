@@ -2,112 +2,53 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log"
-	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/attribute"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
-	"go.opentelemetry.io/otel/trace"
+	"platform"
 )
 
+// OpenTelemetry export settings
+var telemetry = platform.Telemetry{ServiceName: "ad-service"}
+
 // Tracer
-var tracer trace.Tracer
+var tracer = telemetry.Tracer()
 
 // Logger
-var logger *StructuredLogger
+var logger = platform.NewStructuredLogger("ad-service")
 
 // Prometheus metrics
-var (
-	requestCount = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "ad_service_request_count",
-			Help: "Number of requests received by the ad service",
-		},
-		[]string{"method", "endpoint", "status"},
-	)
-	responseTime = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "ad_service_response_time",
-			Help:    "Response time of the ad service",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "endpoint"},
-	)
-)
+var requestCount, responseTime = platform.NewRequestMetrics("ad_service", "ad service")
 
 // Ad represents an advertisement
 type Ad struct {
-	ID          string `json:"id"`
-	RedirectURL string `json:"redirect_url"`
-	Text        string `json:"text"`
-	ImageURL    string `json:"image_url"`
-	ProductID   int    `json:"product_id,omitempty"`
-	Category    string `json:"category"`
-}
-
-// Initialize OpenTelemetry
-func initTracer() *sdktrace.TracerProvider {
-	// Create a new OTLP exporter
-	exporter, err := otlptracehttp.New(
-		context.Background(),
-		otlptracehttp.WithEndpoint(getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "otel-collector:4318")),
-		otlptracehttp.WithInsecure(),
-	)
-	if err != nil {
-		log.Fatalf("Failed to create exporter: %v", err)
-	}
-
-	// Create a new resource with service information
-	res, err := resource.New(
-		context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String("ad-service"),
-			semconv.DeploymentEnvironmentKey.String(getEnv("DEPLOYMENT_ENVIRONMENT", "production")),
-		),
-	)
-	if err != nil {
-		log.Fatalf("Failed to create resource: %v", err)
-	}
-
-	// Create a new tracer provider
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(res),
-	)
-
-	// Set the global tracer provider
-	otel.SetTracerProvider(tp)
-
-	// Get a tracer
-	tracer = tp.Tracer("ad-service")
-
-	// Initialize logger
-	logger = NewStructuredLogger("ad-service")
-
-	return tp
+	ID          string     `json:"id"`
+	RedirectURL string     `json:"redirect_url"`
+	Text        string     `json:"text"`
+	ImageURL    string     `json:"image_url"`
+	ProductID   int        `json:"product_id,omitempty"`
+	Category    string     `json:"category"`
+	CampaignID  string     `json:"campaign_id,omitempty"`
+	Targeting   *Targeting `json:"targeting,omitempty"`
+	Priority    int        `json:"priority,omitempty"`
+	// Price is the product's live catalog price, set when the ad is served
+	Price *AdPrice `json:"price,omitempty"`
 }
 
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return fallback
-}
-
-// Global variables
+// Seed ads loaded into the store on first start
 var ads []Ad
 
 func initAds() {
@@ -123,7 +64,7 @@ func initAds() {
 		{
 			ID:          "ad2",
 			RedirectURL: "https://example.com/promo/laptop",
-			Text:        "Back to school sale! Laptops starting at $699",
+			Text:        "Back to school sale! Laptops starting at {price}",
 			ImageURL:    "https://example.com/assets/ad2.jpg",
 			ProductID:   2,
 			Category:    "Electronics",
@@ -164,28 +105,164 @@ func initAds() {
 
 func init() {
 	// Register prometheus metrics
-	prometheus.MustRegister(requestCount)
-	prometheus.MustRegister(responseTime)
+	prometheus.MustRegister(rateLimitedRequests)
+	prometheus.MustRegister(requestTimeouts)
+	prometheus.MustRegister(configReloads)
+	prometheus.MustRegister(chaosInjections)
+	prometheus.MustRegister(chaosActiveFaults)
+	prometheus.MustRegister(adImpressions)
+	prometheus.MustRegister(adClicks)
+	prometheus.MustRegister(frequencyCapped)
+	prometheus.MustRegister(jobsProcessed)
+	prometheus.MustRegister(jobDuration)
+	prometheus.MustRegister(jobQueueWait)
+	prometheus.MustRegister(jobsRunning)
+	prometheus.MustRegister(campaignBudgetRemaining)
+	prometheus.MustRegister(stockSuppressed)
+	prometheus.MustRegister(priceRefreshes)
+	prometheus.MustRegister(priceUnavailable)
+	prometheus.MustRegister(priceCacheAge)
+	prometheus.MustRegister(adRedirects)
+	prometheus.MustRegister(assetUploads)
 
 	// Initialize ads
 	initAds()
+	adStore = NewMemoryAdStore(ads)
+	frequencyCapper = NewFrequencyCapperFromEnv()
+	stockFilter = NewStockFilterFromEnv()
+	initRotationStrategies()
 }
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Re-read CONFIG_FILE on SIGHUP
+	watchConfigReload(ctx)
+	config.OnReload(logger.LoadSettings)
+
 	// Initialize OpenTelemetry
-	tp := initTracer()
+	tp, err := platform.InitTracer(ctx, telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
 	defer func() {
-		ctx := context.Background()
+		// Flush buffered spans before exiting
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+		defer cancel()
 		if err := tp.Shutdown(ctx); err != nil {
 			logger.Error(ctx, "Error shutting down tracer provider", map[string]interface{}{"error": err.Error()})
 		}
 	}()
 
-	// Set up Gin
-	router := gin.Default()
+	mp := initMeter()
+	if mp != nil {
+		defer func() {
+			// Push the last metrics before exiting
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := mp.Shutdown(ctx); err != nil {
+				logger.Error(ctx, "Error shutting down meter provider", map[string]interface{}{"error": err.Error()})
+			}
+		}()
+	}
+
+	// Send logs to the collector too when OTEL_LOGS_ENABLED=true
+	logExporter, err := platform.InitLogExport(ctx, logger, telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize log export: %v", err)
+	}
+	if logExporter != nil {
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := logExporter.Shutdown(ctx); err != nil {
+				log.Printf("Error shutting down log exporter: %v", err)
+			}
+		}()
+	}
+
+	// Persist ads and campaigns to disk when configured
+	if path := config.Get("AD_STORE_PATH"); path != "" {
+		fileStore, err := NewFileAdStore(path, ads)
+		if err != nil {
+			log.Fatalf("Failed to open ad store %s: %v", path, err)
+		}
+		adStore = fileStore
+	}
+
+	// Uploaded creative images, on disk when ASSET_DIR is set
+	assetStore, err = NewAssetStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to open asset store: %v", err)
+	}
+
+	// Background product data processing workers
+	jobQueue = NewJobQueue(jobConfigFromEnv())
+	jobQueue.Start(ctx)
+
+	// Keep ad categories in line with product-catalog's taxonomy
+	syncInterval, err := time.ParseDuration(platform.GetEnv("CATEGORY_SYNC_INTERVAL", "5m"))
+	if err != nil {
+		syncInterval = 5 * time.Minute
+	}
+	catalogURL := platform.GetEnv("PRODUCT_CATALOG_SERVICE", "http://product-catalog:8081")
+	categorySyncer = NewCategorySyncer(catalogURL, syncInterval)
+	categorySyncer.Start(ctx)
+
+	// Keep the prices quoted in ad text in line with the catalog
+	priceCache = NewPriceCacheFromEnv(catalogURL)
+	priceCache.Start(ctx)
+
+	// Set up Gin without gin.Default's plain-text request logger; the
+	// access log below replaces it
+	router := gin.New()
+
+	// Gzip responses for clients that accept it
+	router.Use(platform.CompressionMiddleware())
+
+	// Correlate logs and errors by X-Request-ID, across services
+	router.Use(platform.RequestIDMiddleware())
 
 	// Add OpenTelemetry middleware
 	router.Use(otelgin.Middleware("ad-service"))
+	router.Use(platform.MetricsMiddleware("ad-service"))
+	router.Use(platform.AccessLogMiddleware(logger))
+
+	// Per-route SLO compliance, summarized on /slo
+	slo := platform.NewSLOTrackerFromEnv("ad-service")
+	router.Use(slo.Middleware())
+
+	// Tag requests slower than their route's recent p99 on the span
+	outliers := platform.NewOutlierDetectorFromEnv("ad-service", logger)
+	outliers.AddQueue("jobs", jobQueue.Depth)
+	router.Use(outliers.Middleware())
+
+	// Turn handler panics into logged, traced and counted 500s
+	router.Use(platform.RecoveryMiddleware(logger))
+
+	// Browser access from the storefront, including impression and click
+	// tracking (CORS_* settings)
+	router.Use(platform.CORSMiddleware(platform.CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "HEAD", "POST"},
+		AllowedHeaders: []string{"Content-Type", "X-Request-ID", "X-Debug-Seed"},
+		ExposedHeaders: []string{"X-Request-ID", "X-Debug-Seed", "X-Ad-Strategy", "X-Total-Count"},
+		MaxAge:         10 * time.Minute,
+	}))
+
+	// Opt-in capture of request and response bodies (DEBUG_RECORDER_*)
+	router.Use(platform.RecorderMiddleware())
+
+	// Per-client rate limiting (disabled unless RATE_LIMIT_RPS is set)
+	router.Use(rateLimitMiddleware(NewRateLimiterFromEnv))
+
+	// Per-request deadlines (REQUEST_TIMEOUT, ROUTE_TIMEOUTS)
+	router.Use(timeoutMiddleware(nil))
+
+	// Injected faults from CHAOS_FAULTS and the /chaos API
+	StartChaosFromConfig()
+	router.Use(chaosMiddleware())
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
@@ -195,7 +272,29 @@ func main() {
 	})
 
 	// Metrics endpoint
-	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	if platform.PrometheusEnabled() {
+		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
+	router.POST("/config/reload", postConfigReload)
+	registerChaosRoutes(router)
+	platform.RegisterLogLevelRoutes(router, logger)
+	platform.RegisterAuditRoutes(router)
+	platform.RegisterRecordingRoutes(router)
+	platform.RegisterSLORoutes(router, slo)
+	platform.RegisterDependencyRoutes(router, "ad-service")
+
+	// Hold /readyz at 503 until the collector and downstream services answer
+	checks := []platform.DependencyCheck{
+		telemetry.CollectorDependency(),
+		platform.HTTPDependency("product-catalog", catalogURL),
+	}
+	if stockFilter.Enabled() {
+		// Only consulted when STOCK_FILTER_MODE is set
+		checks = append(checks, platform.HTTPDependency("inventory-service", stockFilter.inventoryURL))
+	}
+	startup := platform.NewStartupCheckerFromEnv("ad-service", logger, checks...)
+	startup.Start(ctx)
+	platform.RegisterStartupRoutes(router, startup)
 
 	// Get ads based on product IDs
 	router.GET("/ads", func(c *gin.Context) {
@@ -204,7 +303,7 @@ func main() {
 		defer span.End()
 
 		start := time.Now()
-		
+
 		logger.Info(ctx, "Handling get ads request", map[string]interface{}{"method": "GET", "path": "/ads"})
 
 		productIDsStr := c.Query("product_ids")
@@ -223,84 +322,78 @@ func main() {
 			span.SetAttributes(semconv.HTTPRouteKey.String("/ads?category=" + category))
 		}
 
-		var resultAds []Ad
-
-		if productIDsStr != "" && rand.Float64() < 0.1 {
-			productIDsSlice := strings.Split(productIDsStr, ",")
-
-			for _, idStr := range productIDsSlice {
-				if idStr == "3" {
-					go func() {
-						ctxCopy := otel.GetTextMapPropagator().Extract(ctx, nil)
-						ctxCopy, processSpan := tracer.Start(ctxCopy, "process_product_data")
-
-						// Run in background to not block response
-						defer func() {
-							// Catch any panics
-							if r := recover(); r != nil {
-								logger.Error(ctxCopy, "Recovered from internal processing error", map[string]interface{}{"error": fmt.Sprintf("%v", r), "product_id": idStr})
-								processSpan.RecordError(fmt.Errorf("process panic: %v", r))
-							}
-							processSpan.End()
-						}()
-
-						processDataForProductID(idStr)
-					}()
-					break
-				}
-			}
+		sessionID := c.Query("session_id")
+		if sessionID == "" {
+			sessionID = c.GetHeader("X-Session-ID")
 		}
 
-		if productIDsStr != "" {
-			// Get ads for specific product IDs
-			productIDsSlice := strings.Split(productIDsStr, ",")
-			productIDs := make([]int, 0, len(productIDsSlice))
-
-			for _, idStr := range productIDsSlice {
-				id, err := strconv.Atoi(idStr)
-				if err == nil {
-					productIDs = append(productIDs, id)
-				}
+		limit := defaultAdsLimit
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+				recordRequest("GET", "/ads", http.StatusBadRequest, start)
+				return
 			}
-
-			// Find matching ads
-			for _, ad := range ads {
-				for _, id := range productIDs {
-					if ad.ProductID == id {
-						resultAds = append(resultAds, ad)
-						break
-					}
-				}
+			if n > maxAdsLimit {
+				n = maxAdsLimit
 			}
+			limit = n
+		}
 
-			// If no product-specific ads found, add some general ones
-			if len(resultAds) == 0 {
-				for _, ad := range ads {
-					if ad.Category == "General" {
-						resultAds = append(resultAds, ad)
-						if len(resultAds) >= 2 {
-							break
-						}
-					}
-				}
-			}
-		} else if category != "" {
-			// Get ads for a specific category
-			for _, ad := range ads {
-				if ad.Category == category {
-					resultAds = append(resultAds, ad)
-				}
-			}
-		} else {
-			// If no parameters, return random ads (up to 3)
-			indexes := rand.Perm(len(ads))
-			count := min(3, len(ads))
-			for i := 0; i < count; i++ {
-				resultAds = append(resultAds, ads[indexes[i]])
+		offset := 0
+		if v := c.Query("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+				recordRequest("GET", "/ads", http.StatusBadRequest, start)
+				return
 			}
+			offset = n
 		}
 
-		c.JSON(http.StatusOK, resultAds)
+		// A fixed seed makes the ads served reproducible
+		rng, ok := parseDebugSeed(c.GetHeader("X-Debug-Seed"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "X-Debug-Seed must be an integer"})
+			recordRequest("GET", "/ads", http.StatusBadRequest, start)
+			return
+		}
+		if rng != nil {
+			span.SetAttributes(attribute.String("ad.debug_seed", c.GetHeader("X-Debug-Seed")))
+			c.Header("X-Debug-Seed", c.GetHeader("X-Debug-Seed"))
+		}
+
+		req := AdRequest{
+			Category:  category,
+			SessionID: sessionID,
+			Strategy:  c.Query("strategy"),
+			User:      userContextFromQuery(c),
+			Debug:     c.Query("debug") == "true",
+			Limit:     limit,
+			Offset:    offset,
+			Random:    rng,
+		}
+		if productIDsStr != "" {
+			req.ProductIDs = strings.Split(productIDsStr, ",")
+		}
+
+		selection, err := selectAds(ctx, req)
+		if errors.Is(err, errUnknownStrategy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown rotation strategy"})
+			requestCount.WithLabelValues("GET", "/ads", "400").Inc()
+			return
+		}
+		if selection.Strategy != "" {
+			c.Header("X-Ad-Strategy", selection.Strategy)
+		}
+		c.Header("X-Total-Count", strconv.Itoa(selection.Total))
+
+		if req.Debug {
+			c.JSON(http.StatusOK, gin.H{"ads": selection.Ads, "decisions": selection.Decisions})
+		} else {
+			c.JSON(http.StatusOK, selection.Ads)
+		}
 
 		duration := time.Since(start).Seconds()
 		requestCount.WithLabelValues("GET", "/ads", "200").Inc()
@@ -314,34 +407,73 @@ func main() {
 		defer span.End()
 
 		start := time.Now()
-		
+
 		logger.Info(ctx, "Handling get ad by ID request", map[string]interface{}{"method": "GET", "path": "/ad/:id", "ad_id": c.Param("id")})
 
 		id := c.Param("id")
 		span.SetAttributes(semconv.HTTPRouteKey.String("/ad/" + id))
 
-		for _, ad := range ads {
-			if ad.ID == id {
-				c.JSON(http.StatusOK, ad)
-				duration := time.Since(start).Seconds()
-				requestCount.WithLabelValues("GET", "/ad/:id", "200").Inc()
-				responseTime.WithLabelValues("GET", "/ad/:id").Observe(duration)
-				return
-			}
+		if ad, err := adStore.GetAd(id); err == nil {
+			c.JSON(http.StatusOK, ad)
+			duration := time.Since(start).Seconds()
+			requestCount.WithLabelValues("GET", "/ad/:id", "200").Inc()
+			responseTime.WithLabelValues("GET", "/ad/:id").Observe(duration)
+			return
 		}
 
 		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
 		requestCount.WithLabelValues("GET", "/ad/:id", "404").Inc()
 	})
 
+	// Ad and campaign management
+	router.POST("/ads", createAd)
+	router.PUT("/ad/:id", updateAd)
+	router.DELETE("/ad/:id", deleteAd)
+	router.POST("/ads/validate", validateAdCreative)
+	router.GET("/ad/:id/preview", previewAd)
+	router.GET("/ads/unmatched", getUnmatchedAds)
+	router.GET("/campaigns", listCampaigns)
+	router.POST("/campaigns", createCampaign)
+	router.GET("/campaign/:id", getCampaign)
+	router.PUT("/campaign/:id", updateCampaign)
+	router.DELETE("/campaign/:id", deleteCampaign)
+	router.GET("/campaign/:id/budget", getCampaignBudget)
+
+	// Creative images
+	router.POST("/assets", uploadAsset)
+	router.GET("/assets/:hash", getAsset)
+
+	// Impression and click tracking
+	router.POST("/ad/:id/impression", trackEvent(EventImpression))
+	router.POST("/ad/:id/click", trackEvent(EventClick))
+	router.GET("/ad/:id/redirect", redirectAd)
+	router.GET("/ad/:id/stats", getAdStats)
+
+	// Background job status
+	router.GET("/jobs", listJobs)
+	router.POST("/jobs/process", submitJob)
+	router.GET("/jobs/:id", getJob)
+	router.POST("/jobs/:id/cancel", cancelJob)
+
 	// Get server port from environment or use default
-	port := os.Getenv("PORT")
+	port := config.Get("PORT")
 	if port == "" {
 		port = "8083"
 	}
 
-	logger.Info(context.Background(), "Ad Service starting", map[string]interface{}{"port": port})
-	router.Run(":" + port)
+	// gRPC API mirroring GET /ads and GET /ad/:id
+	grpcPort := platform.GetEnv("GRPC_PORT", "9083")
+	go func() {
+		logger.Info(ctx, "Ad Service gRPC starting", map[string]interface{}{"port": grpcPort})
+		if err := runGRPCServer(ctx, ":"+grpcPort); err != nil {
+			logger.Error(ctx, "gRPC server error", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+
+	logger.Info(ctx, "Ad Service starting", map[string]interface{}{"port": port})
+	if err := runServer(ctx, ":"+port, router); err != nil {
+		logger.Error(ctx, "Server error", map[string]interface{}{"error": err.Error()})
+	}
 }
 
 func min(a, b int) int {
@@ -350,44 +482,3 @@ func min(a, b int) int {
 	}
 	return b
 }
-
-func processData(items []string) {
-	dataPoints := make(map[string]int)
-
-	for _, item := range items {
-		dataPoints[item] = len(item)
-	}
-
-	processItemsData(len(items)*10, dataPoints)
-}
-
-func processItemsData(depth int, data map[string]int) int {
-	if depth <= 1 {
-		return 1
-	}
-
-	sum := 0
-	for k := range data {
-		data[k] = len(k) + depth
-
-		if depth > 20 {
-			sum += processItemsData(depth-1, data) +
-				processItemsData(depth-2, data) +
-				processItemsData(depth-3, data)
-		} else {
-			sum += processItemsData(depth-1, data)
-		}
-	}
-	return sum + 1
-}
-
-func processDataForProductID(productID string) {
-	dataPoints := make(map[string]int)
-
-	for i := 0; i < 5; i++ {
-		key := fmt.Sprintf("%s-data-%d", productID, i)
-		dataPoints[key] = len(key) * i
-	}
-
-	processItemsData(35, dataPoints)
-}
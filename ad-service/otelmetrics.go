@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"platform"
+)
+
+// OpenTelemetry instruments, exported over OTLP alongside the Prometheus
+// metrics on /metrics
+var (
+	adImpressionCounter metric.Int64Counter
+	adClickCounter      metric.Int64Counter
+)
+
+// initMeter exports metrics over OTLP and creates the business instruments.
+// It returns nil when OTEL_METRICS_ENABLED=false; the instruments are then
+// no-ops.
+func initMeter() *sdkmetric.MeterProvider {
+	mp, err := platform.InitMeter(context.Background(), telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize metrics: %v", err)
+	}
+
+	meter := otel.Meter("ad-service")
+	adImpressionCounter, _ = meter.Int64Counter("ad.impressions", metric.WithDescription("Number of ad impressions recorded"))
+	adClickCounter, _ = meter.Int64Counter("ad.clicks", metric.WithDescription("Number of ad clicks recorded"))
+
+	return mp
+}
+
+// recordAdEvent counts a tracked impression or click
+func recordAdEvent(ctx context.Context, eventType, adID string) {
+	attrs := metric.WithAttributes(attribute.String("ad.id", adID))
+	switch eventType {
+	case EventImpression:
+		adImpressionCounter.Add(ctx, 1, attrs)
+	case EventClick:
+		adClickCounter.Add(ctx, 1, attrs)
+	}
+}
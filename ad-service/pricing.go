@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"platform"
+)
+
+// pricePlaceholder in an ad's text is replaced with its product's current
+// catalog price, e.g. "Laptops starting at {price}"
+const pricePlaceholder = "{price}"
+
+var (
+	priceRefreshes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ad_service_price_refreshes_total",
+			Help: "Number of product price refreshes from product-catalog by result",
+		},
+		[]string{"result"},
+	)
+	priceUnavailable = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ad_service_price_unavailable_total",
+			Help: "Number of times an ad quoting a price was withheld because the price was missing or too stale",
+		},
+	)
+	priceCacheAge = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "ad_service_price_cache_age_seconds",
+			Help: "Seconds since product prices were last refreshed from product-catalog",
+		},
+		func() float64 {
+			if priceCache == nil {
+				return 0
+			}
+			return priceCache.Age().Seconds()
+		},
+	)
+)
+
+// AdPrice is the live price attached to an ad for a product
+type AdPrice struct {
+	Amount    float64   `json:"amount"`
+	Currency  string    `json:"currency"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// ListPrice and PriceRule are set while a product-catalog pricing
+	// rule, e.g. a flash sale, overrides the list price
+	ListPrice *float64 `json:"list_price,omitempty"`
+	PriceRule string   `json:"price_rule,omitempty"`
+}
+
+// currencySymbols are the currencies formatted with a leading symbol;
+// others are written as "699.99 JPY"
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+}
+
+// Format renders the price for ad text, dropping a zero fraction
+func (p AdPrice) Format() string {
+	amount := strconv.FormatFloat(p.Amount, 'f', 2, 64)
+	amount = strings.TrimSuffix(amount, ".00")
+	if symbol, ok := currencySymbols[p.Currency]; ok {
+		return symbol + amount
+	}
+	return amount + " " + p.Currency
+}
+
+// PriceCache holds product prices from product-catalog, refreshed in the
+// background. Prices older than maxStaleness are not used, so an ad never
+// quotes a price the catalog may have changed long ago.
+type PriceCache struct {
+	mu           sync.RWMutex
+	catalogURL   string
+	interval     time.Duration
+	jitter       float64
+	maxStaleness time.Duration
+	prices       map[int]AdPrice
+	lastRefresh  time.Time
+	lastError    string
+}
+
+var priceCache *PriceCache
+
+// NewPriceCacheFromEnv reads PRICE_REFRESH_INTERVAL (default 1m),
+// PRICE_REFRESH_JITTER (fraction of the interval, default 0.2) and
+// PRICE_MAX_STALENESS (default 10m)
+func NewPriceCacheFromEnv(catalogURL string) *PriceCache {
+	interval, err := time.ParseDuration(platform.GetEnv("PRICE_REFRESH_INTERVAL", "1m"))
+	if err != nil || interval <= 0 {
+		interval = time.Minute
+	}
+	jitter, err := strconv.ParseFloat(platform.GetEnv("PRICE_REFRESH_JITTER", "0.2"), 64)
+	if err != nil || jitter < 0 || jitter > 1 {
+		jitter = 0.2
+	}
+	maxStaleness, err := time.ParseDuration(platform.GetEnv("PRICE_MAX_STALENESS", "10m"))
+	if err != nil || maxStaleness <= 0 {
+		maxStaleness = 10 * time.Minute
+	}
+	return &PriceCache{
+		catalogURL:   catalogURL,
+		interval:     interval,
+		jitter:       jitter,
+		maxStaleness: maxStaleness,
+		prices:       make(map[int]AdPrice),
+	}
+}
+
+// nextInterval spreads refreshes over interval ± jitter, so replicas
+// started together don't all hit product-catalog at once
+func (p *PriceCache) nextInterval() time.Duration {
+	spread := (rand.Float64()*2 - 1) * p.jitter
+	return time.Duration(float64(p.interval) * (1 + spread))
+}
+
+// Start refreshes immediately and then every jittered interval until ctx
+// is done
+func (p *PriceCache) Start(ctx context.Context) {
+	go func() {
+		for {
+			if err := p.Refresh(ctx); err != nil {
+				logger.Warn(ctx, "Price refresh failed", map[string]interface{}{"error": err.Error()})
+			}
+			timer := time.NewTimer(p.nextInterval())
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// Refresh replaces the cached prices with the catalog's current ones. On
+// failure the previous prices are kept until they go stale.
+func (p *PriceCache) Refresh(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "refresh_prices")
+	defer span.End()
+
+	prices, err := p.fetch(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		span.RecordError(err)
+		p.lastError = err.Error()
+		priceRefreshes.WithLabelValues("error").Inc()
+		return err
+	}
+
+	p.prices = prices
+	p.lastRefresh = time.Now().UTC()
+	p.lastError = ""
+	priceRefreshes.WithLabelValues("success").Inc()
+	span.SetAttributes(attribute.Int("prices_count", len(prices)))
+	return nil
+}
+
+func (p *PriceCache) fetch(ctx context.Context) (map[int]AdPrice, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.catalogURL+"/products", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := catalogClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("product-catalog returned status %d", resp.StatusCode)
+	}
+
+	var products []struct {
+		ID        int      `json:"id"`
+		Price     float64  `json:"price"`
+		Currency  string   `json:"currency"`
+		ListPrice *float64 `json:"list_price"`
+		PriceRule *struct {
+			ID string `json:"id"`
+		} `json:"price_rule"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&products); err != nil {
+		return nil, fmt.Errorf("failed to decode products: %w", err)
+	}
+
+	now := time.Now().UTC()
+	prices := make(map[int]AdPrice, len(products))
+	for _, product := range products {
+		price := AdPrice{Amount: product.Price, Currency: product.Currency, UpdatedAt: now, ListPrice: product.ListPrice}
+		if product.PriceRule != nil {
+			price.PriceRule = product.PriceRule.ID
+		}
+		prices[product.ID] = price
+	}
+	return prices, nil
+}
+
+// Age is the time since the last successful refresh
+func (p *PriceCache) Age() time.Duration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.lastRefresh.IsZero() {
+		return 0
+	}
+	return time.Since(p.lastRefresh)
+}
+
+// Price returns the product's price if it is within the staleness bound
+func (p *PriceCache) Price(productID int) (AdPrice, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	price, ok := p.prices[productID]
+	if !ok || time.Since(price.UpdatedAt) > p.maxStaleness {
+		return AdPrice{}, false
+	}
+	return price, true
+}
+
+// Render attaches the product's live price to the ad and fills in
+// pricePlaceholder. It reports false when the text quotes a price that
+// isn't available, in which case the ad shouldn't be served.
+func (p *PriceCache) Render(ad Ad) (Ad, bool) {
+	ad.Price = nil
+	if p == nil || ad.ProductID == 0 {
+		return ad, !strings.Contains(ad.Text, pricePlaceholder)
+	}
+	price, ok := p.Price(ad.ProductID)
+	if !ok {
+		return ad, !strings.Contains(ad.Text, pricePlaceholder)
+	}
+	ad.Price = &price
+	ad.Text = strings.ReplaceAll(ad.Text, pricePlaceholder, price.Format())
+	return ad, true
+}
+
+// priceAds renders live prices into ads, dropping those quoting a price
+// that isn't available
+func priceAds(ads []Ad) []Ad {
+	result := ads[:0]
+	for _, ad := range ads {
+		rendered, ok := priceCache.Render(ad)
+		if !ok {
+			priceUnavailable.Inc()
+			continue
+		}
+		result = append(result, rendered)
+	}
+	return result
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"platform"
+)
+
+var adRedirects = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ad_service_redirects_total",
+		Help: "Number of GET /ad/:id/redirect requests by result: redirected, blocked (destination not allowed) or not_found",
+	},
+	[]string{"result"},
+)
+
+// redirectAllowedHosts are the destinations GET /ad/:id/redirect may send
+// users to, from REDIRECT_ALLOWED_HOSTS (default example.com). A host also
+// allows its subdomains.
+var redirectAllowedHosts = redirectAllowedHostsFromEnv()
+
+func redirectAllowedHostsFromEnv() []string {
+	var hosts []string
+	for _, h := range strings.Split(platform.GetEnv("REDIRECT_ALLOWED_HOSTS", "example.com"), ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// redirectAllowed reports whether u is an http(s) URL on an allowed host.
+// Ads can be written through the API, so without this check the redirect
+// endpoint would send users anywhere a stored ad points.
+func redirectAllowed(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range redirectAllowedHosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// withUTM adds utm_* parameters identifying the ad, keeping any the
+// advertiser already set
+func withUTM(u *url.URL, ad Ad) string {
+	campaign := ad.CampaignID
+	if campaign == "" {
+		campaign = ad.ID
+	}
+	query := u.Query()
+	for key, value := range map[string]string{
+		"utm_source":   platform.GetEnv("UTM_SOURCE", "ad-service"),
+		"utm_medium":   "display",
+		"utm_campaign": campaign,
+		"utm_content":  ad.ID,
+	} {
+		if query.Get(key) == "" {
+			query.Set(key, value)
+		}
+	}
+	redirect := *u
+	redirect.RawQuery = query.Encode()
+	return redirect.String()
+}
+
+// redirectAd records a click and sends the browser on to the ad's
+// redirect_url, so ad links can point here instead of at the destination.
+// user_id and session_id query parameters are recorded with the click.
+func redirectAd(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "redirect_ad")
+	defer span.End()
+	start := time.Now()
+
+	id := c.Param("id")
+	span.SetAttributes(attribute.String("ad.id", id))
+	ad, err := adStore.GetAd(id)
+	if err != nil {
+		adRedirects.WithLabelValues("not_found").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		recordRequest("GET", "/ad/:id/redirect", http.StatusNotFound, start)
+		return
+	}
+
+	destination, err := url.Parse(ad.RedirectURL)
+	if err != nil || !redirectAllowed(destination) {
+		adRedirects.WithLabelValues("blocked").Inc()
+		logger.Warn(ctx, "Ad redirect destination not allowed", map[string]interface{}{
+			"ad_id":        id,
+			"redirect_url": ad.RedirectURL,
+		})
+		c.JSON(http.StatusForbidden, gin.H{"error": "Ad redirect destination is not allowed"})
+		recordRequest("GET", "/ad/:id/redirect", http.StatusForbidden, start)
+		return
+	}
+
+	event := TrackingEvent{
+		Type:      EventClick,
+		AdID:      id,
+		UserID:    c.Query("user_id"),
+		SessionID: c.Query("session_id"),
+		Timestamp: time.Now().UTC(),
+	}
+	tracker.Record(event)
+	recordAdEvent(ctx, EventClick, id)
+	adRedirects.WithLabelValues("redirected").Inc()
+
+	location := withUTM(destination, ad)
+	span.SetAttributes(
+		attribute.String("session.id", event.SessionID),
+		attribute.String("redirect.host", destination.Hostname()),
+	)
+	logger.Info(ctx, "Ad click redirected", map[string]interface{}{
+		"ad_id":      id,
+		"user_id":    event.UserID,
+		"session_id": event.SessionID,
+		"location":   location,
+	})
+
+	// Every click has to reach us to be counted
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, location)
+	recordRequest("GET", "/ad/:id/redirect", http.StatusFound, start)
+}
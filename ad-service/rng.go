@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"platform"
+)
+
+// Random is the source of randomness for ad selection. *rand.Rand satisfies
+// it; selection takes one per request so tests can pin the ads served.
+type Random interface {
+	Intn(n int) int
+	Float64() float64
+	Perm(n int) []int
+}
+
+// lockedRandom shares one *rand.Rand between concurrent requests
+type lockedRandom struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func (r *lockedRandom) Intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rng.Intn(n)
+}
+
+func (r *lockedRandom) Float64() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rng.Float64()
+}
+
+func (r *lockedRandom) Perm(n int) []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rng.Perm(n)
+}
+
+// adRandom serves requests without their own seed
+var adRandom Random = newAdRandomFromEnv()
+
+// newAdRandomFromEnv seeds selection from AD_RANDOM_SEED when it is set, so
+// a fresh process serves the same sequence of ads for the same requests.
+// Concurrent requests still interleave; use X-Debug-Seed to pin a single
+// request regardless of other traffic.
+func newAdRandomFromEnv() Random {
+	seed := time.Now().UnixNano()
+	if v := platform.GetEnv("AD_RANDOM_SEED", ""); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			seed = n
+		}
+	}
+	return &lockedRandom{rng: rand.New(rand.NewSource(seed))}
+}
+
+// parseDebugSeed reads an X-Debug-Seed value. An empty value means the
+// request uses the shared source.
+func parseDebugSeed(v string) (Random, bool) {
+	if v == "" {
+		return nil, true
+	}
+	seed, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	// Only this request uses it, so it needs no lock
+	return rand.New(rand.NewSource(seed)), true
+}
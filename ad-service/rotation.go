@@ -0,0 +1,167 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"platform"
+)
+
+const defaultRotationSlots = 3
+
+// RotationStrategy picks which ads fill the slots when the request carries
+// no product or category context
+type RotationStrategy interface {
+	Name() string
+	Select(rng Random, candidates []Ad, n int) []Ad
+}
+
+// randomRotation is the original behaviour: a uniform random sample
+type randomRotation struct{}
+
+func (randomRotation) Name() string { return "random" }
+
+func (randomRotation) Select(rng Random, candidates []Ad, n int) []Ad {
+	indexes := rng.Perm(len(candidates))
+	count := min(n, len(candidates))
+	result := make([]Ad, 0, count)
+	for i := 0; i < count; i++ {
+		result = append(result, candidates[indexes[i]])
+	}
+	return result
+}
+
+// roundRobinRotation cycles through the ads in order across requests
+type roundRobinRotation struct {
+	mu   sync.Mutex
+	next int
+}
+
+func (*roundRobinRotation) Name() string { return "round-robin" }
+
+func (r *roundRobinRotation) Select(_ Random, candidates []Ad, n int) []Ad {
+	if len(candidates) == 0 {
+		return nil
+	}
+	sorted := make([]Ad, len(candidates))
+	copy(sorted, candidates)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	r.mu.Lock()
+	start := r.next % len(sorted)
+	r.next = start + min(n, len(sorted))
+	r.mu.Unlock()
+
+	count := min(n, len(sorted))
+	result := make([]Ad, 0, count)
+	for i := 0; i < count; i++ {
+		result = append(result, sorted[(start+i)%len(sorted)])
+	}
+	return result
+}
+
+// weightedRotation samples without replacement, weighting ads by priority
+type weightedRotation struct{}
+
+func (weightedRotation) Name() string { return "weighted" }
+
+func adWeight(ad Ad) int {
+	if ad.Priority > 0 {
+		return ad.Priority
+	}
+	return 1
+}
+
+func (weightedRotation) Select(rng Random, candidates []Ad, n int) []Ad {
+	pool := make([]Ad, len(candidates))
+	copy(pool, candidates)
+
+	var result []Ad
+	for len(result) < n && len(pool) > 0 {
+		total := 0
+		for _, ad := range pool {
+			total += adWeight(ad)
+		}
+		pick := rng.Intn(total)
+		for i, ad := range pool {
+			pick -= adWeight(ad)
+			if pick < 0 {
+				result = append(result, ad)
+				pool = append(pool[:i], pool[i+1:]...)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// epsilonGreedyRotation is a bandit over click-through rate: each slot
+// explores a random ad with probability epsilon and otherwise exploits the
+// ad with the best observed CTR
+type epsilonGreedyRotation struct {
+	epsilon float64
+}
+
+func (epsilonGreedyRotation) Name() string { return "epsilon-greedy" }
+
+func (e epsilonGreedyRotation) Select(rng Random, candidates []Ad, n int) []Ad {
+	pool := make([]Ad, len(candidates))
+	copy(pool, candidates)
+
+	var result []Ad
+	for len(result) < n && len(pool) > 0 {
+		choice := 0
+		if rng.Float64() < e.epsilon {
+			choice = rng.Intn(len(pool))
+		} else {
+			best := -1.0
+			for i, ad := range pool {
+				if ctr := tracker.Stats(ad.ID).CTR; ctr > best {
+					best, choice = ctr, i
+				}
+			}
+		}
+		result = append(result, pool[choice])
+		pool = append(pool[:choice], pool[choice+1:]...)
+	}
+	return result
+}
+
+var (
+	rotationStrategies  map[string]RotationStrategy
+	defaultRotationName string
+)
+
+func initRotationStrategies() {
+	epsilon, err := strconv.ParseFloat(config.Get("AD_ROTATION_EPSILON"), 64)
+	if err != nil || epsilon < 0 || epsilon > 1 {
+		epsilon = 0.1
+	}
+
+	strategies := []RotationStrategy{
+		randomRotation{},
+		&roundRobinRotation{},
+		weightedRotation{},
+		epsilonGreedyRotation{epsilon: epsilon},
+	}
+	rotationStrategies = make(map[string]RotationStrategy)
+	for _, s := range strategies {
+		rotationStrategies[s.Name()] = s
+	}
+
+	defaultRotationName = platform.GetEnv("AD_ROTATION_STRATEGY", "random")
+	if _, ok := rotationStrategies[defaultRotationName]; !ok {
+		defaultRotationName = "random"
+	}
+}
+
+// rotationStrategyFor resolves a per-request override, falling back to the
+// configured default when name is empty
+func rotationStrategyFor(name string) (RotationStrategy, bool) {
+	if name == "" {
+		name = defaultRotationName
+	}
+	s, ok := rotationStrategies[name]
+	return s, ok
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var errUnknownStrategy = errors.New("unknown rotation strategy")
+
+// Page sizes for ad listings. Product and category listings are ordered by
+// ad ID so offsets stay stable between requests.
+const (
+	defaultAdsLimit = 20
+	maxAdsLimit     = 100
+)
+
+// AdRequest is a transport-neutral ad selection request shared by the HTTP
+// and gRPC APIs
+type AdRequest struct {
+	ProductIDs []string
+	Category   string
+	SessionID  string
+	Strategy   string
+	User       UserContext
+	Debug      bool
+	// Limit and Offset page through the matching ads; a zero Limit returns
+	// them all
+	Limit  int
+	Offset int
+	// Random overrides the shared source, e.g. one seeded from
+	// X-Debug-Seed; nil uses adRandom
+	Random Random
+}
+
+func (r AdRequest) random() Random {
+	if r.Random != nil {
+		return r.Random
+	}
+	return adRandom
+}
+
+// AdSelection is the result of selectAds
+type AdSelection struct {
+	Ads       []Ad
+	Decisions []TargetingDecision
+	Strategy  string
+	// Total is the number of matching ads before paging
+	Total int
+}
+
+// pageAds returns the ads in [offset, offset+limit)
+func pageAds(ads []Ad, offset, limit int) []Ad {
+	if limit <= 0 {
+		return ads
+	}
+	if offset > len(ads) {
+		offset = len(ads)
+	}
+	end := offset + limit
+	if end > len(ads) {
+		end = len(ads)
+	}
+	return ads[offset:end]
+}
+
+// sortAdsByID orders ads by ID in place
+func sortAdsByID(ads []Ad) {
+	sort.Slice(ads, func(i, j int) bool { return ads[i].ID < ads[j].ID })
+}
+
+// selectAds picks the ads to serve for a request. Ads are chosen by the
+// targeting engine when user attributes are present, by product or category
+// otherwise, and by the rotation strategy when there is no context at all.
+func selectAds(ctx context.Context, req AdRequest) (AdSelection, error) {
+	span := trace.SpanFromContext(ctx)
+
+	var result AdSelection
+	ads := servableAds()
+	rng := req.random()
+
+	if len(req.ProductIDs) > 0 && rng.Float64() < 0.1 {
+		for _, idStr := range req.ProductIDs {
+			if idStr == "3" {
+				// Processed in the background by the job workers
+				if job, err := jobQueue.Submit(ctx, idStr); err != nil {
+					logger.Warn(ctx, "Dropping product data processing job", map[string]interface{}{"error": err.Error(), "product_id": idStr})
+				} else {
+					span.SetAttributes(attribute.String("job.id", job.ID))
+				}
+				break
+			}
+		}
+	}
+
+	// Score ads with the targeting engine when user attributes are
+	// supplied; Debug also explains every decision
+	if req.User.HasAttributes() || req.Debug {
+		selected, decisions := selectTargetedAds(ads, req.User, defaultTargetedLimit)
+		result.Total = len(selected)
+		selected = pageAds(selected, req.Offset, req.Limit)
+		if !req.Debug {
+			selected = stockFilter.Apply(ctx, selected, ads)
+			selected = frequencyCapper.Apply(req.SessionID, selected, ads)
+		}
+		span.SetAttributes(
+			attribute.Bool("ads.targeted", true),
+			attribute.Int("ads.selected", len(selected)),
+		)
+		result.Ads = selected
+		result.Decisions = decisions
+		return result, nil
+	}
+
+	if len(req.ProductIDs) > 0 {
+		// Get ads for specific product IDs
+		productIDs := make([]int, 0, len(req.ProductIDs))
+		for _, idStr := range req.ProductIDs {
+			id, err := strconv.Atoi(idStr)
+			if err == nil {
+				productIDs = append(productIDs, id)
+			}
+		}
+
+		// Find matching ads
+		for _, ad := range ads {
+			for _, id := range productIDs {
+				if ad.ProductID == id {
+					result.Ads = append(result.Ads, ad)
+					break
+				}
+			}
+		}
+
+		// If no product-specific ads found, add some general ones
+		if len(result.Ads) == 0 {
+			for _, ad := range ads {
+				if ad.Category == "General" {
+					result.Ads = append(result.Ads, ad)
+					if len(result.Ads) >= 2 {
+						break
+					}
+				}
+			}
+		}
+		sortAdsByID(result.Ads)
+	} else if req.Category != "" {
+		// Get ads for a specific category
+		for _, ad := range ads {
+			if ad.Category == req.Category {
+				result.Ads = append(result.Ads, ad)
+			}
+		}
+		sortAdsByID(result.Ads)
+	} else {
+		// If no parameters, fill the slots using a rotation strategy
+		strategy, ok := rotationStrategyFor(req.Strategy)
+		if !ok {
+			return result, errUnknownStrategy
+		}
+		result.Ads = strategy.Select(rng, ads, defaultRotationSlots)
+		result.Strategy = strategy.Name()
+		span.SetAttributes(attribute.String("ad.rotation_strategy", strategy.Name()))
+	}
+
+	// Page before filtering, so only the ads actually returned count
+	// towards frequency caps
+	result.Total = len(result.Ads)
+	result.Ads = pageAds(result.Ads, req.Offset, req.Limit)
+	span.SetAttributes(attribute.Int("ads.total", result.Total))
+
+	result.Ads = stockFilter.Apply(ctx, result.Ads, ads)
+	result.Ads = frequencyCapper.Apply(req.SessionID, result.Ads, ads)
+	return result, nil
+}
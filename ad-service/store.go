@@ -0,0 +1,309 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("already exists")
+)
+
+// Campaign status values
+const (
+	CampaignDraft     = "draft"
+	CampaignActive    = "active"
+	CampaignPaused    = "paused"
+	CampaignCompleted = "completed"
+)
+
+// Campaign groups ads that run together over a date range with a budget
+type Campaign struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	Budget    float64   `json:"budget"`
+	Status    string    `json:"status"`
+
+	DailyBudget       float64 `json:"daily_budget,omitempty"`
+	Pacing            string  `json:"pacing,omitempty"`
+	CostPerImpression float64 `json:"cost_per_impression,omitempty"`
+}
+
+// IsLive reports whether the campaign's ads should be served at t
+func (c Campaign) IsLive(t time.Time) bool {
+	if c.Status != CampaignActive {
+		return false
+	}
+	if !c.StartDate.IsZero() && t.Before(c.StartDate) {
+		return false
+	}
+	if !c.EndDate.IsZero() && t.After(c.EndDate) {
+		return false
+	}
+	return true
+}
+
+// AdStore persists ads and campaigns
+type AdStore interface {
+	ListAds() []Ad
+	GetAd(id string) (Ad, error)
+	CreateAd(ad Ad) (Ad, error)
+	UpdateAd(ad Ad) (Ad, error)
+	DeleteAd(id string) error
+
+	ListCampaigns() []Campaign
+	GetCampaign(id string) (Campaign, error)
+	CreateCampaign(campaign Campaign) (Campaign, error)
+	UpdateCampaign(campaign Campaign) (Campaign, error)
+	DeleteCampaign(id string) error
+}
+
+var adStore AdStore
+
+func newID(prefix string) string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// MemoryAdStore keeps ads and campaigns in memory, ordered by insertion
+type MemoryAdStore struct {
+	mu        sync.RWMutex
+	ads       []Ad
+	campaigns []Campaign
+}
+
+func NewMemoryAdStore(seed []Ad) *MemoryAdStore {
+	s := &MemoryAdStore{}
+	s.ads = append(s.ads, seed...)
+	return s
+}
+
+func (s *MemoryAdStore) ListAds() []Ad {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]Ad, len(s.ads))
+	copy(result, s.ads)
+	return result
+}
+
+func (s *MemoryAdStore) GetAd(id string) (Ad, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, ad := range s.ads {
+		if ad.ID == id {
+			return ad, nil
+		}
+	}
+	return Ad{}, ErrNotFound
+}
+
+func (s *MemoryAdStore) CreateAd(ad Ad) (Ad, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ad.ID == "" {
+		ad.ID = newID("ad-")
+	}
+	for _, existing := range s.ads {
+		if existing.ID == ad.ID {
+			return Ad{}, ErrConflict
+		}
+	}
+	s.ads = append(s.ads, ad)
+	return ad, nil
+}
+
+func (s *MemoryAdStore) UpdateAd(ad Ad) (Ad, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.ads {
+		if existing.ID == ad.ID {
+			s.ads[i] = ad
+			return ad, nil
+		}
+	}
+	return Ad{}, ErrNotFound
+}
+
+func (s *MemoryAdStore) DeleteAd(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.ads {
+		if existing.ID == id {
+			s.ads = append(s.ads[:i], s.ads[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryAdStore) ListCampaigns() []Campaign {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]Campaign, len(s.campaigns))
+	copy(result, s.campaigns)
+	return result
+}
+
+func (s *MemoryAdStore) GetCampaign(id string) (Campaign, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, campaign := range s.campaigns {
+		if campaign.ID == id {
+			return campaign, nil
+		}
+	}
+	return Campaign{}, ErrNotFound
+}
+
+func (s *MemoryAdStore) CreateCampaign(campaign Campaign) (Campaign, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if campaign.ID == "" {
+		campaign.ID = newID("cmp-")
+	}
+	for _, existing := range s.campaigns {
+		if existing.ID == campaign.ID {
+			return Campaign{}, ErrConflict
+		}
+	}
+	s.campaigns = append(s.campaigns, campaign)
+	return campaign, nil
+}
+
+func (s *MemoryAdStore) UpdateCampaign(campaign Campaign) (Campaign, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.campaigns {
+		if existing.ID == campaign.ID {
+			s.campaigns[i] = campaign
+			return campaign, nil
+		}
+	}
+	return Campaign{}, ErrNotFound
+}
+
+// DeleteCampaign removes the campaign and detaches its ads
+func (s *MemoryAdStore) DeleteCampaign(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.campaigns {
+		if existing.ID == id {
+			s.campaigns = append(s.campaigns[:i], s.campaigns[i+1:]...)
+			for j := range s.ads {
+				if s.ads[j].CampaignID == id {
+					s.ads[j].CampaignID = ""
+				}
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// FileAdStore is a MemoryAdStore that writes a JSON snapshot to disk after
+// every change and loads it on startup
+type FileAdStore struct {
+	*MemoryAdStore
+	path    string
+	writeMu sync.Mutex
+}
+
+type adSnapshot struct {
+	Ads       []Ad       `json:"ads"`
+	Campaigns []Campaign `json:"campaigns"`
+}
+
+// NewFileAdStore loads the snapshot at path, falling back to seed when the
+// file does not exist yet
+func NewFileAdStore(path string, seed []Ad) (*FileAdStore, error) {
+	s := &FileAdStore{MemoryAdStore: NewMemoryAdStore(nil), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.ads = append(s.ads, seed...)
+		return s, s.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot adSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	s.ads = snapshot.Ads
+	s.campaigns = snapshot.Campaigns
+	return s, nil
+}
+
+func (s *FileAdStore) save() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	snapshot := adSnapshot{Ads: s.ListAds(), Campaigns: s.ListCampaigns()}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *FileAdStore) CreateAd(ad Ad) (Ad, error) {
+	ad, err := s.MemoryAdStore.CreateAd(ad)
+	if err != nil {
+		return ad, err
+	}
+	return ad, s.save()
+}
+
+func (s *FileAdStore) UpdateAd(ad Ad) (Ad, error) {
+	ad, err := s.MemoryAdStore.UpdateAd(ad)
+	if err != nil {
+		return ad, err
+	}
+	return ad, s.save()
+}
+
+func (s *FileAdStore) DeleteAd(id string) error {
+	if err := s.MemoryAdStore.DeleteAd(id); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *FileAdStore) CreateCampaign(campaign Campaign) (Campaign, error) {
+	campaign, err := s.MemoryAdStore.CreateCampaign(campaign)
+	if err != nil {
+		return campaign, err
+	}
+	return campaign, s.save()
+}
+
+func (s *FileAdStore) UpdateCampaign(campaign Campaign) (Campaign, error) {
+	campaign, err := s.MemoryAdStore.UpdateCampaign(campaign)
+	if err != nil {
+		return campaign, err
+	}
+	return campaign, s.save()
+}
+
+func (s *FileAdStore) DeleteCampaign(id string) error {
+	if err := s.MemoryAdStore.DeleteCampaign(id); err != nil {
+		return err
+	}
+	return s.save()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scoring weights for the targeting engine
+const (
+	scoreBase            = 1.0
+	scoreProductMatch    = 5.0
+	scoreCategoryMatch   = 3.0
+	scorePastCategory    = 2.0
+	scoreRegionMatch     = 1.0
+	scoreDeviceMatch     = 1.0
+	defaultTargetedLimit = 3
+)
+
+// Targeting restricts and boosts an ad for particular audiences
+type Targeting struct {
+	Regions   []string `json:"regions,omitempty"`
+	Devices   []string `json:"devices,omitempty"`
+	Interests []string `json:"interests,omitempty"`
+}
+
+// UserContext is what we know about the viewer of an ad slot
+type UserContext struct {
+	Region         string
+	Device         string
+	PastCategories []string
+	ProductIDs     []int
+	Category       string
+}
+
+// HasAttributes reports whether any user attribute was supplied
+func (uc UserContext) HasAttributes() bool {
+	return uc.Region != "" || uc.Device != "" || len(uc.PastCategories) > 0
+}
+
+// TargetingDecision explains how an ad was scored
+type TargetingDecision struct {
+	AdID     string   `json:"ad_id"`
+	Eligible bool     `json:"eligible"`
+	Selected bool     `json:"selected"`
+	Score    float64  `json:"score"`
+	Reasons  []string `json:"reasons"`
+}
+
+func userContextFromQuery(c *gin.Context) UserContext {
+	uc := UserContext{
+		Region:   c.Query("region"),
+		Device:   c.Query("device"),
+		Category: c.Query("category"),
+	}
+	if v := c.Query("past_categories"); v != "" {
+		uc.PastCategories = strings.Split(v, ",")
+	}
+	if v := c.Query("product_ids"); v != "" {
+		for _, idStr := range strings.Split(v, ",") {
+			if id, err := strconv.Atoi(idStr); err == nil {
+				uc.ProductIDs = append(uc.ProductIDs, id)
+			}
+		}
+	}
+	return uc
+}
+
+func containsFold(values []string, v string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// scoreAd applies the targeting rules to a single ad
+func scoreAd(ad Ad, uc UserContext) TargetingDecision {
+	d := TargetingDecision{AdID: ad.ID, Eligible: true, Score: scoreBase}
+
+	if ad.Targeting != nil {
+		if len(ad.Targeting.Regions) > 0 && uc.Region != "" {
+			if !containsFold(ad.Targeting.Regions, uc.Region) {
+				d.Eligible = false
+				d.Reasons = append(d.Reasons, fmt.Sprintf("region %q not targeted", uc.Region))
+			} else {
+				d.Score += scoreRegionMatch
+				d.Reasons = append(d.Reasons, "region matched")
+			}
+		}
+		if len(ad.Targeting.Devices) > 0 && uc.Device != "" {
+			if !containsFold(ad.Targeting.Devices, uc.Device) {
+				d.Eligible = false
+				d.Reasons = append(d.Reasons, fmt.Sprintf("device %q not targeted", uc.Device))
+			} else {
+				d.Score += scoreDeviceMatch
+				d.Reasons = append(d.Reasons, "device matched")
+			}
+		}
+	}
+
+	if !d.Eligible {
+		d.Score = 0
+		return d
+	}
+
+	for _, id := range uc.ProductIDs {
+		if ad.ProductID == id {
+			d.Score += scoreProductMatch
+			d.Reasons = append(d.Reasons, fmt.Sprintf("product %d matched", id))
+			break
+		}
+	}
+
+	if uc.Category != "" && strings.EqualFold(ad.Category, uc.Category) {
+		d.Score += scoreCategoryMatch
+		d.Reasons = append(d.Reasons, "requested category matched")
+	}
+
+	for _, past := range uc.PastCategories {
+		interested := strings.EqualFold(ad.Category, past)
+		if !interested && ad.Targeting != nil {
+			interested = containsFold(ad.Targeting.Interests, past)
+		}
+		if interested {
+			d.Score += scorePastCategory
+			d.Reasons = append(d.Reasons, fmt.Sprintf("past category %q matched", past))
+		}
+	}
+
+	return d
+}
+
+// selectTargetedAds scores every ad and returns the best limit of them along
+// with a decision for each candidate
+func selectTargetedAds(candidates []Ad, uc UserContext, limit int) ([]Ad, []TargetingDecision) {
+	decisions := make([]TargetingDecision, len(candidates))
+	order := make([]int, 0, len(candidates))
+	for i, ad := range candidates {
+		decisions[i] = scoreAd(ad, uc)
+		if decisions[i].Eligible {
+			order = append(order, i)
+		}
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		da, db := decisions[order[a]], decisions[order[b]]
+		if da.Score != db.Score {
+			return da.Score > db.Score
+		}
+		return da.AdID < db.AdID
+	})
+
+	var selected []Ad
+	for _, i := range order {
+		if len(selected) >= limit {
+			decisions[i].Reasons = append(decisions[i].Reasons, "outscored by higher ranked ads")
+			continue
+		}
+		decisions[i].Selected = true
+		selected = append(selected, candidates[i])
+	}
+
+	return selected, decisions
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"platform"
+)
+
+// houseCategory is used by ads that are not tied to a product category
+const houseCategory = "General"
+
+var catalogClient = platform.NewHTTPClient(logger, 5*time.Second)
+
+// CategorySyncer keeps a copy of product-catalog's category list
+type CategorySyncer struct {
+	mu         sync.RWMutex
+	catalogURL string
+	interval   time.Duration
+	categories map[string]bool
+	lastSync   time.Time
+	lastError  string
+}
+
+var categorySyncer *CategorySyncer
+
+func NewCategorySyncer(catalogURL string, interval time.Duration) *CategorySyncer {
+	return &CategorySyncer{
+		catalogURL: catalogURL,
+		interval:   interval,
+	}
+}
+
+// Start syncs immediately and then on every interval until ctx is done
+func (s *CategorySyncer) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			if err := s.Sync(ctx); err != nil {
+				logger.Warn(ctx, "Category sync failed", map[string]interface{}{"error": err.Error()})
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *CategorySyncer) Sync(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "sync_categories")
+	defer span.End()
+
+	categories, err := s.fetch(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		span.RecordError(err)
+		s.lastError = err.Error()
+		return err
+	}
+
+	s.categories = make(map[string]bool, len(categories))
+	for _, name := range categories {
+		s.categories[name] = true
+	}
+	s.lastSync = time.Now().UTC()
+	s.lastError = ""
+	span.SetAttributes(attribute.Int("categories_count", len(categories)))
+	return nil
+}
+
+func (s *CategorySyncer) fetch(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.catalogURL+"/categories", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := catalogClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("product-catalog returned status %d", resp.StatusCode)
+	}
+
+	var categories []string
+	if err := json.NewDecoder(resp.Body).Decode(&categories); err != nil {
+		return nil, fmt.Errorf("failed to decode categories: %w", err)
+	}
+	return categories, nil
+}
+
+// Synced reports whether at least one sync has succeeded
+func (s *CategorySyncer) Synced() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.categories != nil
+}
+
+// Unmatched returns ads whose category is not in the catalog taxonomy
+func (s *CategorySyncer) Unmatched(candidates []Ad) []Ad {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []Ad
+	for _, ad := range candidates {
+		if ad.Category != houseCategory && !s.categories[ad.Category] {
+			result = append(result, ad)
+		}
+	}
+	return result
+}
+
+func getUnmatchedAds(c *gin.Context) {
+	start := time.Now()
+
+	if !categorySyncer.Synced() {
+		categorySyncer.mu.RLock()
+		lastError := categorySyncer.lastError
+		categorySyncer.mu.RUnlock()
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Category taxonomy not synced yet", "last_error": lastError})
+		recordRequest("GET", "/ads/unmatched", http.StatusServiceUnavailable, start)
+		return
+	}
+
+	unmatched := categorySyncer.Unmatched(adStore.ListAds())
+
+	categorySyncer.mu.RLock()
+	categories := make([]string, 0, len(categorySyncer.categories))
+	for name := range categorySyncer.categories {
+		categories = append(categories, name)
+	}
+	lastSync := categorySyncer.lastSync
+	lastError := categorySyncer.lastError
+	categorySyncer.mu.RUnlock()
+	sort.Strings(categories)
+
+	c.JSON(http.StatusOK, gin.H{
+		"last_sync":  lastSync,
+		"last_error": lastError,
+		"categories": categories,
+		"unmatched":  unmatched,
+	})
+	recordRequest("GET", "/ads/unmatched", http.StatusOK, start)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Tracking event types
+const (
+	EventImpression = "impression"
+	EventClick      = "click"
+)
+
+// maxEventsPerAd bounds the raw event history kept for each ad
+const maxEventsPerAd = 1000
+
+var (
+	adImpressions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ad_service_impressions_total",
+			Help: "Number of recorded ad impressions",
+		},
+		[]string{"ad_id"},
+	)
+	adClicks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ad_service_clicks_total",
+			Help: "Number of recorded ad clicks",
+		},
+		[]string{"ad_id"},
+	)
+)
+
+// TrackingEvent is a single impression or click
+type TrackingEvent struct {
+	Type      string    `json:"type"`
+	AdID      string    `json:"ad_id"`
+	UserID    string    `json:"user_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AdStats aggregates tracking events for an ad
+type AdStats struct {
+	AdID           string     `json:"ad_id"`
+	Impressions    int64      `json:"impressions"`
+	Clicks         int64      `json:"clicks"`
+	CTR            float64    `json:"ctr"`
+	LastImpression *time.Time `json:"last_impression,omitempty"`
+	LastClick      *time.Time `json:"last_click,omitempty"`
+}
+
+// Tracker records impressions and clicks in memory
+type Tracker struct {
+	mu     sync.RWMutex
+	stats  map[string]*AdStats
+	events map[string][]TrackingEvent
+}
+
+var tracker = NewTracker()
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		stats:  make(map[string]*AdStats),
+		events: make(map[string][]TrackingEvent),
+	}
+}
+
+func (t *Tracker) Record(event TrackingEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats, ok := t.stats[event.AdID]
+	if !ok {
+		stats = &AdStats{AdID: event.AdID}
+		t.stats[event.AdID] = stats
+	}
+
+	ts := event.Timestamp
+	switch event.Type {
+	case EventImpression:
+		stats.Impressions++
+		stats.LastImpression = &ts
+		adImpressions.WithLabelValues(event.AdID).Inc()
+	case EventClick:
+		stats.Clicks++
+		stats.LastClick = &ts
+		adClicks.WithLabelValues(event.AdID).Inc()
+	}
+
+	history := append(t.events[event.AdID], event)
+	if len(history) > maxEventsPerAd {
+		history = history[len(history)-maxEventsPerAd:]
+	}
+	t.events[event.AdID] = history
+}
+
+// Stats returns a snapshot of the aggregate counters for an ad
+func (t *Tracker) Stats(adID string) AdStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	stats, ok := t.stats[adID]
+	if !ok {
+		return AdStats{AdID: adID}
+	}
+
+	result := *stats
+	if result.Impressions > 0 {
+		result.CTR = float64(result.Clicks) / float64(result.Impressions)
+	}
+	return result
+}
+
+func trackEvent(eventType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, span := tracer.Start(c.Request.Context(), "track_"+eventType)
+		defer span.End()
+		start := time.Now()
+		endpoint := "/ad/:id/" + eventType
+
+		id := c.Param("id")
+		ad, err := adStore.GetAd(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+			recordRequest("POST", endpoint, http.StatusNotFound, start)
+			return
+		}
+
+		var req struct {
+			UserID    string `json:"user_id"`
+			SessionID string `json:"session_id"`
+		}
+		// The body is optional; fall back to query parameters
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tracking payload"})
+				recordRequest("POST", endpoint, http.StatusBadRequest, start)
+				return
+			}
+		}
+		if req.UserID == "" {
+			req.UserID = c.Query("user_id")
+		}
+		if req.SessionID == "" {
+			req.SessionID = c.Query("session_id")
+		}
+
+		event := TrackingEvent{
+			Type:      eventType,
+			AdID:      id,
+			UserID:    req.UserID,
+			SessionID: req.SessionID,
+			Timestamp: time.Now().UTC(),
+		}
+		tracker.Record(event)
+		recordAdEvent(ctx, eventType, id)
+
+		// Impressions are what campaigns pay for
+		if eventType == EventImpression && ad.CampaignID != "" {
+			if campaign, err := adStore.GetCampaign(ad.CampaignID); err == nil {
+				status := budgets.Charge(campaign, event.Timestamp)
+				if status.Exhausted {
+					logger.Info(ctx, "Campaign budget exhausted", map[string]interface{}{
+						"campaign_id": campaign.ID,
+						"spent_today": status.SpentToday,
+						"spent_total": status.SpentTotal,
+					})
+				}
+			}
+		}
+
+		span.SetAttributes(
+			attribute.String("ad.id", id),
+			attribute.String("session.id", req.SessionID),
+		)
+		logger.Info(ctx, "Ad "+eventType+" recorded", map[string]interface{}{
+			"ad_id":      id,
+			"user_id":    req.UserID,
+			"session_id": req.SessionID,
+		})
+
+		c.JSON(http.StatusAccepted, event)
+		recordRequest("POST", endpoint, http.StatusAccepted, start)
+	}
+}
+
+func getAdStats(c *gin.Context) {
+	start := time.Now()
+	id := c.Param("id")
+
+	if _, err := adStore.GetAd(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		recordRequest("GET", "/ad/:id/stats", http.StatusNotFound, start)
+		return
+	}
+
+	c.JSON(http.StatusOK, tracker.Stats(id))
+	recordRequest("GET", "/ad/:id/stats", http.StatusOK, start)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cacheService is the service whose token authentication the dashboard
+// can switch, in place of instabook-cache's own /admin page
+const cacheService = "instabook-cache"
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Round(time.Second).String() + " ago"
+	},
+	"mb": func(bytes float64) string {
+		return fmt.Sprintf("%.0f MB", bytes/(1<<20))
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <title>Service Status</title>
+    <meta http-equiv="refresh" content="{{.Refresh}}">
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; margin: 30px; background: #f5f5f5; color: #333; }
+        table { border-collapse: collapse; width: 100%; background: white; box-shadow: 0 2px 10px rgba(0,0,0,0.1); }
+        th, td { padding: 10px 14px; text-align: left; border-bottom: 1px solid #e9ecef; vertical-align: top; }
+        th { background: #e9ecef; }
+        .state { font-weight: 600; padding: 3px 10px; border-radius: 6px; }
+        .healthy { background: #d4edda; color: #155724; }
+        .degraded { background: #fff3cd; color: #856404; }
+        .not_ready, .down { background: #f8d7da; color: #721c24; }
+        .unknown { background: #e9ecef; color: #666; }
+        .muted { color: #888; font-size: 13px; }
+        button { padding: 6px 14px; cursor: pointer; border: none; border-radius: 6px; background: #007bff; color: white; }
+        button:hover { background: #0056b3; }
+    </style>
+</head>
+<body>
+    <h1>Service Status</h1>
+    <p class="muted">Polled {{ago .LastPoll}}. JSON at <a href="/api/services">/api/services</a>.</p>
+    <table>
+        <tr><th>Service</th><th>State</th><th>Readiness</th><th>Requests</th><th>Chaos faults</th><th>Details</th></tr>
+        {{range .Services}}
+        <tr>
+            <td><strong>{{.Name}}</strong><br><span class="muted">{{.URL}}</span></td>
+            <td><span class="state {{.State}}">{{.State}}</span></td>
+            <td>{{if .ReadinessPath}}{{.ReadinessPath}} {{.ReadinessStatus}}<br><span class="muted">{{.LatencyMs}} ms</span>{{else}}-{{end}}</td>
+            <td>{{with .Metrics}}{{printf "%.0f" .Requests}}<br><span class="muted">{{printf "%.0f" .Errors}} 5xx{{if .ResidentBytes}}, {{mb .ResidentBytes}}{{end}}</span>{{else}}-{{end}}</td>
+            <td>{{if not .ChaosEnabled}}<span class="muted">API off</span>{{else if not .Faults}}none{{else}}{{range .Faults}}{{.Name}} <span class="muted">({{.Type}}{{if .Route}}, {{.Route}}{{end}})</span><br>{{end}}{{end}}</td>
+            <td>
+                {{range .Reasons}}{{.}}<br>{{end}}
+                {{if .Error}}{{.Error}}<br>{{end}}
+                {{if eq .Name "instabook-cache"}}{{if .ReadinessPath}}
+                <form method="post" action="/services/instabook-cache/token">
+                    <button type="submit">Toggle Token Authentication</button>
+                </form>
+                {{end}}{{end}}
+                <span class="muted">checked {{ago .CheckedAt}}</span>
+            </td>
+        </tr>
+        {{end}}
+    </table>
+</body>
+</html>
+`))
+
+func getDashboard(c *gin.Context) {
+	start := time.Now()
+
+	services, lastPoll := poller.Snapshot()
+	var buf bytes.Buffer
+	err := dashboardTemplate.Execute(&buf, gin.H{
+		"Services": services,
+		"LastPoll": lastPoll,
+		"Refresh":  int(poller.interval.Seconds()),
+	})
+	if err != nil {
+		logger.Error(c.Request.Context(), "Failed to render dashboard", map[string]interface{}{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render dashboard"})
+		recordRequest("GET", "/", http.StatusInternalServerError, start)
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+	recordRequest("GET", "/", http.StatusOK, start)
+}
+
+// listServices returns every service's latest status and a count by state
+func listServices(c *gin.Context) {
+	start := time.Now()
+
+	services, lastPoll := poller.Snapshot()
+	states := make(map[string]int)
+	for _, s := range services {
+		states[s.State]++
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"polled_at": lastPoll,
+		"states":    states,
+		"services":  services,
+	})
+	recordRequest("GET", "/api/services", http.StatusOK, start)
+}
+
+func getService(c *gin.Context) {
+	start := time.Now()
+
+	status, ok := poller.Get(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service not found"})
+		recordRequest("GET", "/api/services/:name", http.StatusNotFound, start)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+	recordRequest("GET", "/api/services/:name", http.StatusOK, start)
+}
+
+// pollService polls one service now instead of waiting for the next round
+func pollService(c *gin.Context) {
+	start := time.Now()
+
+	name := c.Param("name")
+	if _, ok := poller.Get(name); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service not found"})
+		recordRequest("POST", "/api/services/:name/poll", http.StatusNotFound, start)
+		return
+	}
+	c.JSON(http.StatusOK, poller.Poll(c.Request.Context(), name))
+	recordRequest("POST", "/api/services/:name/poll", http.StatusOK, start)
+}
+
+// toggleCacheToken flips instabook-cache's token authentication through
+// its /admin/token endpoint, then re-polls it so the page shows the change.
+// Form posts from the dashboard are redirected back to it.
+func toggleCacheToken(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+
+	base, _ := serviceURL(cacheService)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/admin/token", nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		recordRequest("POST", "/services/instabook-cache/token", http.StatusInternalServerError, start)
+		return
+	}
+	// Shows up as the actor in instabook-cache's audit log
+	actor := "admin-dashboard"
+	if caller := c.GetHeader("X-Actor"); caller != "" {
+		actor = caller + " via admin-dashboard"
+	}
+	req.Header.Set("X-Actor", actor)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		logger.Error(ctx, "Failed to toggle cache token authentication", map[string]interface{}{"error": err.Error()})
+		c.JSON(http.StatusBadGateway, gin.H{"error": "instabook-cache unreachable: " + err.Error()})
+		recordRequest("POST", "/services/instabook-cache/token", http.StatusBadGateway, start)
+		return
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	resp.Body.Close()
+
+	logger.Warn(ctx, "Cache token authentication toggled from the dashboard", map[string]interface{}{
+		"status_code": resp.StatusCode,
+		"client_ip":   c.ClientIP(),
+	})
+	poller.Poll(ctx, cacheService)
+
+	if c.ContentType() == "application/x-www-form-urlencoded" {
+		c.Redirect(http.StatusSeeOther, "/")
+		recordRequest("POST", "/services/instabook-cache/token", http.StatusSeeOther, start)
+		return
+	}
+	c.Data(resp.StatusCode, "application/json", body)
+	recordRequest("POST", "/services/instabook-cache/token", resp.StatusCode, start)
+}
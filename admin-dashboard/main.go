@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"platform"
+)
+
+// OpenTelemetry export settings
+var telemetry = platform.Telemetry{ServiceName: "admin-dashboard"}
+
+// Logger
+var logger = platform.NewStructuredLogger("admin-dashboard")
+
+// Tracer
+var tracer = telemetry.Tracer()
+
+// HTTP client for polling the services
+var httpClient *http.Client
+
+// Prometheus metrics
+var requestCount, responseTime = platform.NewRequestMetrics("admin_dashboard", "admin dashboard")
+
+func init() {
+	prometheus.MustRegister(servicePolls)
+	prometheus.MustRegister(serviceUp)
+	prometheus.MustRegister(rateLimitedRequests)
+	prometheus.MustRegister(requestTimeouts)
+	prometheus.MustRegister(configReloads)
+	prometheus.MustRegister(chaosInjections)
+	prometheus.MustRegister(chaosActiveFaults)
+
+	// Outgoing calls carry the caller's trace context, over TLS when
+	// TLS_CA_FILE or a client certificate is configured
+	httpClient = platform.NewHTTPClient(logger, 10*time.Second)
+}
+
+func recordRequest(method, endpoint string, status int, start time.Time) {
+	requestCount.WithLabelValues(method, endpoint, strconv.Itoa(status)).Inc()
+	responseTime.WithLabelValues(method, endpoint).Observe(time.Since(start).Seconds())
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Re-read CONFIG_FILE on SIGHUP
+	watchConfigReload(ctx)
+	config.OnReload(logger.LoadSettings)
+
+	tp, err := platform.InitTracer(ctx, telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		// Flush buffered spans before exiting
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			logger.Error(ctx, "Error shutting down tracer provider", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+
+	mp := initMeter()
+	if mp != nil {
+		defer func() {
+			// Push the last metrics before exiting
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := mp.Shutdown(ctx); err != nil {
+				logger.Error(ctx, "Error shutting down meter provider", map[string]interface{}{"error": err.Error()})
+			}
+		}()
+	}
+
+	// Send logs to the collector too when OTEL_LOGS_ENABLED=true
+	logExporter, err := platform.InitLogExport(ctx, logger, telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize log export: %v", err)
+	}
+	if logExporter != nil {
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := logExporter.Shutdown(ctx); err != nil {
+				log.Printf("Error shutting down log exporter: %v", err)
+			}
+		}()
+	}
+
+	// Poll every service's readiness, metrics and chaos faults
+	poller = NewPollerFromEnv()
+	poller.Start(ctx)
+
+	// gin.New rather than gin.Default: the access log below replaces gin's
+	// plain-text request logger
+	router := gin.New()
+
+	// Gzip responses for clients that accept it
+	router.Use(platform.CompressionMiddleware())
+
+	// Correlate logs and errors by X-Request-ID, across services
+	router.Use(platform.RequestIDMiddleware())
+
+	// Add OpenTelemetry middleware
+	router.Use(otelgin.Middleware("admin-dashboard"))
+	router.Use(platform.MetricsMiddleware("admin-dashboard"))
+	router.Use(platform.AccessLogMiddleware(logger))
+
+	// Per-route SLO compliance, summarized on /slo
+	slo := platform.NewSLOTrackerFromEnv("admin-dashboard")
+	router.Use(slo.Middleware())
+
+	// Tag requests slower than their route's recent p99 on the span
+	outliers := platform.NewOutlierDetectorFromEnv("admin-dashboard", logger)
+	router.Use(outliers.Middleware())
+
+	// Turn handler panics into logged, traced and counted 500s
+	router.Use(platform.RecoveryMiddleware(logger))
+
+	// Per-client rate limiting (disabled unless RATE_LIMIT_RPS is set)
+	router.Use(rateLimitMiddleware(NewRateLimiterFromEnv))
+
+	// Per-request deadlines (REQUEST_TIMEOUT, ROUTE_TIMEOUTS)
+	router.Use(timeoutMiddleware(nil))
+
+	// Injected faults from CHAOS_FAULTS and the /chaos API
+	StartChaosFromConfig()
+	router.Use(chaosMiddleware())
+
+	// Health check
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "UP"})
+	})
+
+	// Metrics
+	if platform.PrometheusEnabled() {
+		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
+	router.POST("/config/reload", postConfigReload)
+	registerChaosRoutes(router)
+	platform.RegisterLogLevelRoutes(router, logger)
+	platform.RegisterAuditRoutes(router)
+	platform.RegisterSLORoutes(router, slo)
+	platform.RegisterDependencyRoutes(router, "admin-dashboard")
+
+	// Hold /readyz at 503 until the collector answers
+	startup := platform.NewStartupCheckerFromEnv("admin-dashboard", logger,
+		telemetry.CollectorDependency(),
+	)
+	startup.Start(ctx)
+	platform.RegisterStartupRoutes(router, startup)
+
+	// Status page and its JSON API
+	router.GET("/", getDashboard)
+	router.GET("/api/services", listServices)
+	router.GET("/api/services/:name", getService)
+	router.POST("/api/services/:name/poll", pollService)
+	router.POST("/services/instabook-cache/token", toggleCacheToken)
+
+	port := platform.GetEnv("PORT", "8091")
+	logger.Info(ctx, "Admin Dashboard starting", map[string]interface{}{
+		"port":     port,
+		"services": len(poller.services),
+		"interval": poller.interval.String(),
+	})
+	if err := runServer(ctx, ":"+port, router); err != nil {
+		logger.Error(ctx, "Server error", map[string]interface{}{"error": err.Error()})
+	}
+
+	// Release pooled connections to the other services
+	httpClient.CloseIdleConnections()
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"go.opentelemetry.io/otel/attribute"
+	"platform"
+)
+
+// Service states, from best to worst
+const (
+	StateHealthy  = "healthy"
+	StateDegraded = "degraded"
+	StateNotReady = "not_ready"
+	StateDown     = "down"
+	StateUnknown  = "unknown"
+)
+
+// defaultPorts are the ports services listen on in docker-compose and the
+// Helm chart
+var defaultPorts = map[string]int{
+	"gateway":              8080,
+	"product-catalog":      8081,
+	"currency-service":     8082,
+	"ad-service":           8083,
+	"checkout-service":     8084,
+	"inventory-service":    8085,
+	"instabook-cache":      8086,
+	"instabook":            8087,
+	"order-service":        8088,
+	"notification-service": 8089,
+	"scenario-controller":  8090,
+}
+
+// readinessPaths are tried in order until one exists: /readyz where a Go
+// service has one, /health for the other Go services and /healthz/ready for
+// the Flask services
+var readinessPaths = []string{"/readyz", "/health", "/healthz/ready"}
+
+// maxBodyBytes bounds what is read from a service's endpoints
+const maxBodyBytes = 4 << 20
+
+var (
+	servicePolls = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "admin_dashboard_polls_total",
+			Help: "Number of service polls by service and resulting state",
+		},
+		[]string{"service", "state"},
+	)
+	serviceUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "admin_dashboard_service_ready",
+			Help: "Whether the service answered its readiness check with 2xx (1) or not (0)",
+		},
+		[]string{"service"},
+	)
+)
+
+// serviceEnvKey is the setting holding a service's base URL, following the
+// names the services already use for each other, e.g. INVENTORY_SERVICE
+func serviceEnvKey(service string) string {
+	key := strings.ToUpper(strings.ReplaceAll(service, "-", "_"))
+	if !strings.HasSuffix(key, "_SERVICE") {
+		key += "_SERVICE"
+	}
+	return key
+}
+
+// serviceURL returns the base URL for service: its <NAME>_SERVICE setting,
+// or http://<service>:<port> for the services in defaultPorts
+func serviceURL(service string) (string, bool) {
+	if base := platform.Get(serviceEnvKey(service)); base != "" {
+		return strings.TrimSuffix(base, "/"), true
+	}
+	if port, ok := defaultPorts[service]; ok {
+		return fmt.Sprintf("http://%s:%d", service, port), true
+	}
+	return "", false
+}
+
+// FaultSummary is an enabled chaos fault as the dashboard shows it
+type FaultSummary struct {
+	Name      string     `json:"name"`
+	Type      string     `json:"type"`
+	Route     string     `json:"route,omitempty"`
+	Source    string     `json:"source"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// MetricsSummary is the part of a service's /metrics the dashboard shows
+type MetricsSummary struct {
+	Requests float64 `json:"requests"`
+	// Errors counts requests that returned a 5xx
+	Errors float64 `json:"errors"`
+	// SLOExhausted lists the routes and objectives whose error budget is
+	// spent, e.g. "GET /products availability"
+	SLOExhausted  []string `json:"slo_exhausted,omitempty"`
+	Goroutines    float64  `json:"goroutines,omitempty"`
+	ResidentBytes float64  `json:"resident_bytes,omitempty"`
+}
+
+// ServiceStatus is the result of the latest poll of one service
+type ServiceStatus struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	State     string    `json:"state"`
+	Reasons   []string  `json:"reasons,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+
+	ReadinessPath   string          `json:"readiness_path,omitempty"`
+	ReadinessStatus int             `json:"readiness_status,omitempty"`
+	Readiness       json.RawMessage `json:"readiness,omitempty"`
+	LatencyMs       int64           `json:"latency_ms"`
+
+	// ChaosEnabled is false when the service doesn't serve the /chaos API
+	ChaosEnabled bool            `json:"chaos_enabled"`
+	Faults       []FaultSummary  `json:"faults"`
+	Metrics      *MetricsSummary `json:"metrics,omitempty"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// Poller polls every service on an interval and keeps the latest result
+type Poller struct {
+	mu       sync.RWMutex
+	services []string
+	interval time.Duration
+	timeout  time.Duration
+	statuses map[string]ServiceStatus
+	// readiness remembers which readiness path each service answers on
+	readiness map[string]string
+	lastPoll  time.Time
+}
+
+var poller *Poller
+
+// NewPollerFromEnv reads DASHBOARD_SERVICES (comma-separated, default every
+// service in defaultPorts), DASHBOARD_POLL_INTERVAL (default 10s) and
+// DASHBOARD_POLL_TIMEOUT (default 3s)
+func NewPollerFromEnv() *Poller {
+	var services []string
+	for _, name := range strings.Split(platform.Get("DASHBOARD_SERVICES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			services = append(services, name)
+		}
+	}
+	if len(services) == 0 {
+		for name := range defaultPorts {
+			services = append(services, name)
+		}
+	}
+	sort.Strings(services)
+
+	interval, err := time.ParseDuration(platform.GetEnv("DASHBOARD_POLL_INTERVAL", "10s"))
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Second
+	}
+	timeout, err := time.ParseDuration(platform.GetEnv("DASHBOARD_POLL_TIMEOUT", "3s"))
+	if err != nil || timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+
+	p := &Poller{
+		services:  services,
+		interval:  interval,
+		timeout:   timeout,
+		statuses:  make(map[string]ServiceStatus),
+		readiness: make(map[string]string),
+	}
+	for _, name := range services {
+		url, _ := serviceURL(name)
+		p.statuses[name] = ServiceStatus{Name: name, URL: url, State: StateUnknown, Faults: []FaultSummary{}}
+	}
+	return p
+}
+
+// Start polls immediately and then on every interval until ctx is done
+func (p *Poller) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			p.PollAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// PollAll polls every service concurrently
+func (p *Poller) PollAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, name := range p.services {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			defer platform.RecoverPanic(ctx, logger, "service-poll")
+			p.Poll(ctx, name)
+		}(name)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	p.lastPoll = time.Now().UTC()
+	p.mu.Unlock()
+}
+
+// Poll checks one service's readiness, metrics and chaos faults
+func (p *Poller) Poll(ctx context.Context, name string) ServiceStatus {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	ctx, span := tracer.Start(ctx, "poll_service")
+	defer span.End()
+	span.SetAttributes(attribute.String("dashboard.service", name))
+
+	base, ok := serviceURL(name)
+	status := ServiceStatus{Name: name, URL: base, CheckedAt: time.Now().UTC(), Faults: []FaultSummary{}}
+	if !ok {
+		status.State = StateUnknown
+		status.Error = "no URL configured; set " + serviceEnvKey(name)
+		p.store(status)
+		return status
+	}
+
+	if err := p.checkReadiness(ctx, base, &status); err != nil {
+		status.State = StateDown
+		status.Error = err.Error()
+		span.RecordError(err)
+		p.store(status)
+		return status
+	}
+
+	// Metrics and faults are best effort; a service without them is still
+	// judged on readiness
+	if metrics, err := fetchMetrics(ctx, base); err == nil {
+		status.Metrics = metrics
+	}
+	if faults, enabled, err := fetchFaults(ctx, base); err == nil {
+		status.Faults = faults
+		status.ChaosEnabled = enabled
+	}
+
+	status.State = StateHealthy
+	if status.ReadinessStatus < 200 || status.ReadinessStatus >= 300 {
+		status.State = StateNotReady
+		status.Reasons = append(status.Reasons, fmt.Sprintf("%s returned %d", status.ReadinessPath, status.ReadinessStatus))
+	}
+	// Faults from CHAOS_FAULTS are the service's configured baseline, such as
+	// inventory-service's simulated processing time, so only the ones
+	// injected through the API count against it
+	var injected []string
+	for _, f := range status.Faults {
+		if f.Source != "config" {
+			injected = append(injected, f.Name)
+		}
+	}
+	if len(injected) > 0 {
+		status.Reasons = append(status.Reasons, "chaos faults enabled: "+strings.Join(injected, ", "))
+	}
+	if status.Metrics != nil && len(status.Metrics.SLOExhausted) > 0 {
+		status.Reasons = append(status.Reasons, "error budget exhausted: "+strings.Join(status.Metrics.SLOExhausted, ", "))
+	}
+	if status.State == StateHealthy && len(status.Reasons) > 0 {
+		status.State = StateDegraded
+	}
+
+	p.store(status)
+	return status
+}
+
+func (p *Poller) store(status ServiceStatus) {
+	ready := 0.0
+	if status.State == StateHealthy || status.State == StateDegraded {
+		ready = 1
+	}
+	serviceUp.WithLabelValues(status.Name).Set(ready)
+	servicePolls.WithLabelValues(status.Name, status.State).Inc()
+
+	p.mu.Lock()
+	p.statuses[status.Name] = status
+	p.mu.Unlock()
+}
+
+// checkReadiness tries the service's readiness paths, starting with the
+// one that answered last time. Only an unreachable service is an error.
+func (p *Poller) checkReadiness(ctx context.Context, base string, status *ServiceStatus) error {
+	p.mu.RLock()
+	known := p.readiness[status.Name]
+	p.mu.RUnlock()
+
+	paths := readinessPaths
+	if known != "" {
+		paths = append([]string{known}, readinessPaths...)
+	}
+
+	for _, path := range paths {
+		start := time.Now()
+		code, body, err := get(ctx, base+path, false)
+		if err != nil {
+			return err
+		}
+		if code == http.StatusNotFound {
+			continue
+		}
+		status.ReadinessPath = path
+		status.ReadinessStatus = code
+		status.LatencyMs = time.Since(start).Milliseconds()
+		if json.Valid(body) {
+			status.Readiness = body
+		}
+		p.mu.Lock()
+		p.readiness[status.Name] = path
+		p.mu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("no readiness endpoint found at %s", strings.Join(readinessPaths, ", "))
+}
+
+// fetchFaults lists the service's enabled chaos faults. enabled is false
+// when the service doesn't serve the /chaos API.
+func fetchFaults(ctx context.Context, base string) ([]FaultSummary, bool, error) {
+	code, body, err := get(ctx, base+"/chaos/faults", true)
+	if err != nil {
+		return nil, false, err
+	}
+	if code == http.StatusNotFound {
+		return []FaultSummary{}, false, nil
+	}
+	if code != http.StatusOK {
+		return nil, false, fmt.Errorf("/chaos/faults returned %d", code)
+	}
+	var response struct {
+		Faults []FaultSummary `json:"faults"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, false, err
+	}
+	if response.Faults == nil {
+		response.Faults = []FaultSummary{}
+	}
+	return response.Faults, true, nil
+}
+
+// fetchMetrics summarizes the service's Prometheus metrics. Request counts
+// come from the Go services' <prefix>_request_count and the Flask services'
+// <prefix>_request_count_total counters.
+func fetchMetrics(ctx context.Context, base string) (*MetricsSummary, error) {
+	code, body, err := get(ctx, base+"/metrics", false)
+	if err != nil {
+		return nil, err
+	}
+	if code != http.StatusOK {
+		return nil, fmt.Errorf("/metrics returned %d", code)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &MetricsSummary{}
+	for name, family := range families {
+		switch {
+		case strings.HasSuffix(name, "request_count") || strings.HasSuffix(name, "request_count_total"):
+			for _, m := range family.GetMetric() {
+				value := m.GetCounter().GetValue()
+				summary.Requests += value
+				status := label(m, "status")
+				if status == "" {
+					status = label(m, "http_status")
+				}
+				if strings.HasPrefix(status, "5") {
+					summary.Errors += value
+				}
+			}
+		case name == "slo_error_budget_remaining":
+			for _, m := range family.GetMetric() {
+				if m.GetGauge().GetValue() <= 0 {
+					summary.SLOExhausted = append(summary.SLOExhausted, label(m, "route")+" "+label(m, "slo"))
+				}
+			}
+		case name == "go_goroutines":
+			summary.Goroutines = firstGauge(family)
+		case name == "process_resident_memory_bytes":
+			summary.ResidentBytes = firstGauge(family)
+		}
+	}
+	sort.Strings(summary.SLOExhausted)
+	return summary, nil
+}
+
+func label(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+func firstGauge(family *dto.MetricFamily) float64 {
+	if metrics := family.GetMetric(); len(metrics) > 0 {
+		return metrics[0].GetGauge().GetValue()
+	}
+	return 0
+}
+
+// get fetches target. chaos adds the CHAOS_TOKEN the /chaos APIs expect.
+func get(ctx context.Context, target string, chaos bool) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	if token := config.Get("CHAOS_TOKEN"); chaos && token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	return resp.StatusCode, body, err
+}
+
+// Snapshot returns the latest status of every service, sorted by name, and
+// when they were last polled
+func (p *Poller) Snapshot() ([]ServiceStatus, time.Time) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	statuses := make([]ServiceStatus, 0, len(p.services))
+	for _, name := range p.services {
+		statuses = append(statuses, p.statuses[name])
+	}
+	return statuses, p.lastPoll
+}
+
+func (p *Poller) Get(name string) (ServiceStatus, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	status, ok := p.statuses[name]
+	return status, ok
+}
@@ -23,7 +23,7 @@ fi
 docker buildx inspect --bootstrap
 
 # Define available services
-AVAILABLE_SERVICES=("gateway" "product-catalog" "currency-service" "ad-service" "checkout-service" "inventory-service" "load-generator" "instabook-cache" "instabook" "load-generator-instabook")
+AVAILABLE_SERVICES=("gateway" "product-catalog" "currency-service" "ad-service" "checkout-service" "inventory-service" "load-generator" "instabook-cache" "instabook" "load-generator-instabook" "order-service" "notification-service" "scenario-controller" "admin-dashboard")
 
 # Function to display usage information
 show_usage() {
@@ -44,6 +44,12 @@ build_and_push() {
   SERVICE=$1
   TAG="$REPO:$SERVICE-$VERSION"
   LATEST_TAG="$REPO:$SERVICE-latest"
+
+  # Go services build from the repository root to include internal/platform
+  CONTEXT=./$SERVICE
+  if [ -f "$SERVICE/go.mod" ]; then
+    CONTEXT=.
+  fi
   
   echo "===================================="
   echo "Building $SERVICE service for amd64 and arm64..."
@@ -55,7 +61,8 @@ build_and_push() {
     --tag $TAG \
     --tag $LATEST_TAG \
     --push \
-    ./$SERVICE
+    --file $SERVICE/Dockerfile \
+    $CONTEXT
 
   if [ $? -eq 0 ]; then
     echo "✅ Successfully built and pushed $SERVICE service for multiple architectures"
@@ -117,6 +124,10 @@ echo "  $REPO:load-generator-$VERSION (and :load-generator-latest)"
 echo "  $REPO:instabook-cache-$VERSION (and :instabook-cache-latest)"
 echo "  $REPO:instabook-$VERSION (and :instabook-latest)"
 echo "  $REPO:load-generator-instabook-$VERSION (and :load-generator-instabook-latest)"
+echo "  $REPO:order-service-$VERSION (and :order-service-latest)"
+echo "  $REPO:notification-service-$VERSION (and :notification-service-latest)"
+echo "  $REPO:scenario-controller-$VERSION (and :scenario-controller-latest)"
+echo "  $REPO:admin-dashboard-$VERSION (and :admin-dashboard-latest)"
 echo ""
 echo "Images support both amd64 and arm64 architectures."
 echo ""
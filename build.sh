@@ -5,7 +5,12 @@ echo "Building all services..."
 # Function to build a service
 build_service() {
     echo "Building $1 service..."
-    docker build -t $1:latest ./$1
+    # Go services build from the repository root to include internal/platform
+    if [ -f "$1/go.mod" ]; then
+        docker build -t $1:latest -f $1/Dockerfile .
+    else
+        docker build -t $1:latest ./$1
+    fi
     if [ $? -eq 0 ]; then
         echo "✅ Successfully built $1 service"
     else
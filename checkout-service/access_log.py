@@ -0,0 +1,43 @@
+"""Structured access logs, shared by the Python services.
+
+Every request is logged as "HTTP request processed" with the same fields as
+the Go services: method, path, route (the URL rule, or "unmatched"),
+status_code, latency_ms, request_size, response_size, client_ip and
+user_agent. The line carries the request's trace and request IDs.
+"""
+import logging
+import time
+
+from flask import g, request
+
+
+def init_access_log(app, logger):
+    """Log every request in app. Call it before init_chaos so injected faults
+    are logged and timed too."""
+    # These lines replace werkzeug's plain-text request log
+    logging.getLogger('werkzeug').setLevel(logging.WARNING)
+
+    @app.before_request
+    def start_timer():
+        g.access_log_start = time.time()
+
+    @app.after_request
+    def log_request(response):
+        start = g.get('access_log_start')
+        fields = {
+            "method": request.method,
+            "path": request.path,
+            "route": request.url_rule.rule if request.url_rule else "unmatched",
+            "status_code": response.status_code,
+            "latency_ms": int((time.time() - start) * 1000) if start else 0,
+            "request_size": request.content_length or 0,
+            "response_size": response.content_length or 0,
+            "client_ip": request.remote_addr,
+            "user_agent": request.user_agent.string,
+        }
+        # Server errors survive INFO sampling
+        if response.status_code >= 500:
+            logger.warning("HTTP request processed", **fields)
+        else:
+            logger.info("HTTP request processed", **fields)
+        return response
@@ -16,11 +16,20 @@ from opentelemetry.sdk.trace.export import BatchSpanProcessor
 from opentelemetry.sdk.resources import Resource
 from opentelemetry.semconv.resource import ResourceAttributes
 from opentelemetry.exporter.otlp.proto.http.trace_exporter import OTLPSpanExporter
+from opentelemetry import metrics as otel_metrics
+from opentelemetry.sdk.metrics import MeterProvider
+from opentelemetry.sdk.metrics.export import PeriodicExportingMetricReader
+from opentelemetry.exporter.otlp.proto.http.metric_exporter import OTLPMetricExporter
 from opentelemetry.instrumentation.flask import FlaskInstrumentor
-from opentelemetry.instrumentation.requests import RequestsInstrumentor
 
 # Import structured logger
-from structured_logger import StructuredLogger
+from structured_logger import StructuredLogger, register_log_level_routes
+from chaos import init_chaos
+from dependencies import init_dependencies
+from compression import init_compression
+from request_id import init_request_id
+from access_log import init_access_log
+from tls import server_ssl_context
 
 # Initialize OpenTelemetry
 resource = Resource.create({
@@ -43,6 +52,16 @@ trace_provider.add_span_processor(span_processor)
 # Create the tracer
 tracer = trace.get_tracer(__name__)
 
+# Configure the meter provider to push metrics over OTLP every
+# OTEL_METRIC_EXPORT_INTERVAL ms; FlaskInstrumentor records request durations with it
+if os.getenv("OTEL_METRICS_ENABLED", "true") != "false":
+    metric_exporter = OTLPMetricExporter(endpoint=os.getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "http://otel-collector:4318/v1/metrics"))
+    metric_reader = PeriodicExportingMetricReader(metric_exporter)
+    otel_metrics.set_meter_provider(MeterProvider(resource=resource, metric_readers=[metric_reader]))
+
+# Create the meter
+meter = otel_metrics.get_meter(__name__)
+
 # Initialize structured logger
 logger = StructuredLogger("checkout-service")
 
@@ -51,18 +70,34 @@ app = Flask(__name__)
 # Instrument Flask
 FlaskInstrumentor().instrument_app(app)
 
-# Instrument requests library
-RequestsInstrumentor().instrument()
+# Instrument requests library and record each downstream call for
+# /debug/dependencies
+init_dependencies(app, "checkout-service")
 
 app.register_blueprint(healthz, url_prefix="/healthz")
 
+# X-Request-ID on every response, log line and outgoing call, and one
+# access log line per request
+init_compression(app)
+init_request_id(app)
+init_access_log(app, logger)
+
+# Injected faults from CHAOS_FAULTS and the /chaos API
+init_chaos(app, logger)
+register_log_level_routes(app, logger)
+
 # Prometheus metrics
 REQUEST_COUNT = Counter('checkout_request_count', 'Checkout Service Request Count', ['method', 'endpoint', 'http_status'])
 REQUEST_LATENCY = Histogram('checkout_request_latency_seconds', 'Checkout Service Request Latency', ['method', 'endpoint'])
 
+# OpenTelemetry metrics
+ORDER_COUNTER = meter.create_counter('checkout.orders', description='Number of processed orders')
+
 # Service URLs from environment variables with defaults for local development
 PRODUCT_CATALOG_SERVICE = os.getenv('PRODUCT_CATALOG_SERVICE', 'http://localhost:8081')
 CURRENCY_SERVICE = os.getenv('CURRENCY_SERVICE', 'http://localhost:8082')
+INSTABOOK_CACHE_SERVICE = os.getenv('INSTABOOK_CACHE_SERVICE', 'http://localhost:8086')
+INSTABOOK_API_TOKEN = os.getenv('INSTABOOK_API_TOKEN', 'instabook-secret-token-2024')
 
 # In-memory order storage (in a real app, this would be a database)
 orders = {}
@@ -75,13 +110,6 @@ app.config["HEALTHZ"] = {
     "ready": healthz_status,
 }
 
-@app.before_request
-def before_request():
-    from flask import g
-    request_id = request.headers.get('X-Request-ID')
-    if request_id:
-        g.request_id = request_id
-
 @app.route('/')
 def home():
     logger.info("Handling home request", method="GET", path="/")
@@ -90,6 +118,30 @@ def home():
         "status": "UP"
     })
 
+def cart_headers():
+    return {"Authorization": f"Bearer {INSTABOOK_API_TOKEN}", "X-Actor": "checkout-service"}
+
+def fetch_cart_items(cart_id):
+    """Returns the items of a cart held in instabook-cache, or None if there is no such cart"""
+    with tracer.start_as_current_span("fetch_cart") as cart_span:
+        cart_span.set_attribute("cart_id", cart_id)
+        response = requests.get(f"{INSTABOOK_CACHE_SERVICE}/cache/cart/{cart_id}", headers=cart_headers(), timeout=5)
+        if response.status_code == 404:
+            return None
+        response.raise_for_status()
+        items = [{'product_id': item['product_id'], 'quantity': item['quantity']} for item in response.json().get('items', [])]
+        cart_span.set_attribute("items_count", len(items))
+        return items
+
+def clear_cart(cart_id):
+    """Deletes a checked-out cart. The order is already placed, so failures are only logged."""
+    try:
+        response = requests.delete(f"{INSTABOOK_CACHE_SERVICE}/cache/cart/{cart_id}", headers=cart_headers(), timeout=5)
+        if response.status_code not in (204, 404):
+            logger.warning("Failed to clear cart", cart_id=cart_id, http_status=response.status_code)
+    except requests.RequestException as e:
+        logger.warning("Failed to clear cart", cart_id=cart_id, error=str(e))
+
 @app.route('/process', methods=['POST'])
 def process_checkout():
     with tracer.start_as_current_span("process_checkout") as span:
@@ -107,15 +159,35 @@ def process_checkout():
             span.set_attribute("user_currency", checkout_data.get('user_currency', 'USD'))
             span.set_attribute("items_count", len(checkout_data.get('items', [])))
             
-            # Check if required fields are present
-            required_fields = ['user_id', 'user_currency', 'address', 'email', 'items']
+            # Items come in the request, or from a cart in instabook-cache
+            cart_id = checkout_data.get('cart_id')
+            required_fields = ['user_id', 'user_currency', 'address', 'email']
+            if not cart_id:
+                required_fields.append('items')
             for field in required_fields:
                 if field not in checkout_data:
                     REQUEST_COUNT.labels('post', '/process', 400).inc()
                     return jsonify({"error": f"Missing required field: {field}"}), 400
             
+            if cart_id:
+                span.set_attribute("cart_id", cart_id)
+                try:
+                    items = fetch_cart_items(cart_id)
+                except requests.RequestException as e:
+                    logger.error("Cart lookup error", error=str(e), cart_id=cart_id)
+                    REQUEST_COUNT.labels('post', '/process', 502).inc()
+                    return jsonify({"error": f"Failed to retrieve cart: {str(e)}"}), 502
+                if items is None:
+                    REQUEST_COUNT.labels('post', '/process', 404).inc()
+                    return jsonify({"error": "Cart not found", "cart_id": cart_id}), 404
+                if not items:
+                    REQUEST_COUNT.labels('post', '/process', 400).inc()
+                    return jsonify({"error": "Cart is empty", "cart_id": cart_id}), 400
+                span.set_attribute("items_count", len(items))
+            else:
+                items = checkout_data['items']
+            
             # Get product information for each item in the cart
-            items = checkout_data['items']
             products = []
             
             with tracer.start_as_current_span("fetch_product_details") as items_span:
@@ -201,6 +273,9 @@ def process_checkout():
             
             # Store order (in a real app, this would be in a database)
             orders[order_id] = order
+            ORDER_COUNTER.add(1, {"currency": checkout_data['user_currency']})
+            if cart_id:
+                clear_cart(cart_id)
             
             # Return success response
             response = {
@@ -242,9 +317,12 @@ def get_order(order_id):
 
 @app.route('/metrics')
 def metrics():
+    # Scraping can be switched off once everything reads the OTLP metrics
+    if os.getenv('PROMETHEUS_METRICS_ENABLED', 'true') == 'false':
+        return jsonify({"error": "Prometheus metrics are disabled"}), 404
     return prometheus_client.generate_latest()
 
 if __name__ == '__main__':
     port = os.getenv('PORT', '8084')
     logger.info("Checkout service starting", port=int(port))
-    app.run(host='0.0.0.0', port=int(port)) 
\ No newline at end of file
+    app.run(host='0.0.0.0', port=int(port), ssl_context=server_ssl_context()) 
\ No newline at end of file
@@ -0,0 +1,70 @@
+"""Gzip response compression, shared by the Python services.
+
+Matches the Go services' CompressionMiddleware: responses are gzipped for
+clients that send Accept-Encoding: gzip when the body is at least
+COMPRESSION_MIN_BYTES (default 1024) and its Content-Type is JSON,
+JavaScript, XML, SVG or text. COMPRESSION_ENABLED=false turns it off.
+"""
+import gzip
+import os
+
+from flask import request
+
+COMPRESSIBLE_TYPES = (
+    'application/json',
+    'application/javascript',
+    'application/xml',
+    'image/svg+xml',
+    'text/',
+)
+
+
+def _accepts_gzip(header):
+    for part in header.split(','):
+        coding, _, params = part.strip().partition(';')
+        if coding.strip() not in ('gzip', '*'):
+            continue
+        # "gzip;q=0" refuses it
+        params = params.strip()
+        if params.startswith('q='):
+            try:
+                if float(params[2:]) == 0:
+                    return False
+            except ValueError:
+                pass
+        return True
+    return False
+
+
+def init_compression(app):
+    """Compress responses in app. Call it before init_request_id: Flask runs
+    after_request hooks in reverse, and request IDs are added to error
+    bodies, which must happen before they are compressed."""
+    if os.getenv('COMPRESSION_ENABLED', 'true') == 'false':
+        return
+    try:
+        min_size = int(os.getenv('COMPRESSION_MIN_BYTES', '1024'))
+    except ValueError:
+        min_size = 1024
+
+    @app.after_request
+    def compress_response(response):
+        response.vary.add('Accept-Encoding')
+        if request.method == 'HEAD' or not _accepts_gzip(request.headers.get('Accept-Encoding', '')):
+            return response
+        # Streamed and file responses, and bodies that are already encoded
+        if response.direct_passthrough or response.is_streamed:
+            return response
+        if 'Content-Encoding' in response.headers or 'Content-Range' in response.headers:
+            return response
+        if response.status_code < 200 or response.status_code in (204, 304):
+            return response
+        if not (response.mimetype or '').startswith(COMPRESSIBLE_TYPES):
+            return response
+
+        data = response.get_data()
+        if len(data) < min_size:
+            return response
+        response.set_data(gzip.compress(data))
+        response.headers['Content-Encoding'] = 'gzip'
+        return response
@@ -0,0 +1,84 @@
+"""X-Request-ID handling, shared by the Python services.
+
+Every request gets an ID, taken from the caller's X-Request-ID header or
+generated. It is returned in the X-Request-ID response header, added to JSON
+error bodies as request_id and to every log line, and forwarded on outgoing
+calls by the same propagation that carries the trace context.
+"""
+import json
+import re
+import uuid
+
+from flask import g, request
+from opentelemetry import context as otel_context
+from opentelemetry import propagate
+from opentelemetry.context import Context
+from opentelemetry.propagators.composite import CompositePropagator
+from opentelemetry.propagators.textmap import TextMapPropagator, default_getter, default_setter
+
+HEADER = 'X-Request-ID'
+
+# Letters, digits and "-_.:", so a caller can't inject anything into log
+# lines or headers
+VALID_REQUEST_ID = re.compile(r'^[A-Za-z0-9\-_.:]{1,128}$')
+
+_KEY = otel_context.create_key('request_id')
+
+
+def current_request_id():
+    """The ID of the request being handled, or None outside a request."""
+    return otel_context.get_value(_KEY)
+
+
+class RequestIDPropagator(TextMapPropagator):
+    """Reads X-Request-ID on incoming requests and sets it on outgoing ones."""
+
+    def extract(self, carrier, context=None, getter=default_getter):
+        if context is None:
+            context = Context()
+        values = getter.get(carrier, HEADER)
+        if values and VALID_REQUEST_ID.match(values[0]):
+            return otel_context.set_value(_KEY, values[0], context)
+        return context
+
+    def inject(self, carrier, context=None, setter=default_setter):
+        request_id = otel_context.get_value(_KEY, context)
+        if request_id:
+            setter.set(carrier, HEADER, request_id)
+
+    @property
+    def fields(self):
+        return {HEADER}
+
+
+def init_request_id(app):
+    """Assign request IDs in app. Call it before init_chaos so injected
+    faults carry the ID too."""
+    propagate.set_global_textmap(CompositePropagator([propagate.get_global_textmap(), RequestIDPropagator()]))
+
+    @app.before_request
+    def assign_request_id():
+        request_id = request.headers.get(HEADER, '')
+        if not VALID_REQUEST_ID.match(request_id):
+            request_id = uuid.uuid4().hex
+        g.request_id = request_id
+        g.request_id_token = otel_context.attach(otel_context.set_value(_KEY, request_id))
+
+    @app.after_request
+    def return_request_id(response):
+        request_id = g.get('request_id')
+        if not request_id:
+            return response
+        response.headers[HEADER] = request_id
+        if response.status_code >= 400 and response.is_json:
+            body = response.get_json(silent=True)
+            if isinstance(body, dict) and 'request_id' not in body:
+                body['request_id'] = request_id
+                response.set_data(json.dumps(body))
+        return response
+
+    @app.teardown_request
+    def release_request_id(exc):
+        token = g.pop('request_id_token', None)
+        if token is not None:
+            otel_context.detach(token)
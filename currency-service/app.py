@@ -14,11 +14,20 @@ from opentelemetry.sdk.trace.export import BatchSpanProcessor
 from opentelemetry.sdk.resources import Resource
 from opentelemetry.semconv.resource import ResourceAttributes
 from opentelemetry.exporter.otlp.proto.http.trace_exporter import OTLPSpanExporter
+from opentelemetry import metrics as otel_metrics
+from opentelemetry.sdk.metrics import MeterProvider
+from opentelemetry.sdk.metrics.export import PeriodicExportingMetricReader
+from opentelemetry.exporter.otlp.proto.http.metric_exporter import OTLPMetricExporter
 from opentelemetry.instrumentation.flask import FlaskInstrumentor
-from opentelemetry.instrumentation.requests import RequestsInstrumentor
 
 # Import structured logger
-from structured_logger import StructuredLogger
+from structured_logger import StructuredLogger, register_log_level_routes
+from chaos import init_chaos
+from dependencies import init_dependencies
+from compression import init_compression
+from request_id import init_request_id
+from access_log import init_access_log
+from tls import server_ssl_context
 
 # Initialize OpenTelemetry
 resource = Resource.create({
@@ -41,6 +50,16 @@ trace_provider.add_span_processor(span_processor)
 # Create the tracer
 tracer = trace.get_tracer(__name__)
 
+# Configure the meter provider to push metrics over OTLP every
+# OTEL_METRIC_EXPORT_INTERVAL ms; FlaskInstrumentor records request durations with it
+if os.getenv("OTEL_METRICS_ENABLED", "true") != "false":
+    metric_exporter = OTLPMetricExporter(endpoint=os.getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "http://otel-collector:4318/v1/metrics"))
+    metric_reader = PeriodicExportingMetricReader(metric_exporter)
+    otel_metrics.set_meter_provider(MeterProvider(resource=resource, metric_readers=[metric_reader]))
+
+# Create the meter
+meter = otel_metrics.get_meter(__name__)
+
 # Initialize structured logger
 logger = StructuredLogger("currency-service")
 
@@ -49,15 +68,29 @@ app = Flask(__name__)
 # Instrument Flask
 FlaskInstrumentor().instrument_app(app)
 
-# Instrument requests library
-RequestsInstrumentor().instrument()
+# Instrument requests library and record each downstream call for
+# /debug/dependencies
+init_dependencies(app, "currency-service")
 
 app.register_blueprint(healthz, url_prefix="/healthz")
 
+# X-Request-ID on every response, log line and outgoing call, and one
+# access log line per request
+init_compression(app)
+init_request_id(app)
+init_access_log(app, logger)
+
+# Injected faults from CHAOS_FAULTS and the /chaos API
+init_chaos(app, logger)
+register_log_level_routes(app, logger)
+
 # Prometheus metrics
 REQUEST_COUNT = Counter('currency_request_count', 'Currency Service Request Count', ['method', 'endpoint', 'http_status'])
 REQUEST_LATENCY = Histogram('currency_request_latency_seconds', 'Currency Service Request Latency', ['method', 'endpoint'])
 
+# OpenTelemetry metrics
+CONVERSION_COUNTER = meter.create_counter('currency.conversions', description='Number of currency conversions by currency pair')
+
 # Exchange rates (relative to USD)
 EXCHANGE_RATES = {
     'USD': 1.0,
@@ -77,13 +110,6 @@ app.config["HEALTHZ"] = {
     "ready": healthz_status,
 }
 
-@app.before_request
-def before_request():
-    from flask import g
-    request_id = request.headers.get('X-Request-ID')
-    if request_id:
-        g.request_id = request_id
-
 @app.route('/')
 def home():
     logger.info("Handling home request", method="GET", path="/")
@@ -150,6 +176,7 @@ def convert_currency():
                 REQUEST_COUNT.labels('get', '/convert', 400).inc()
                 return jsonify({"error": "Invalid amount provided"}), 400
         
+        CONVERSION_COUNTER.add(1, {"currency.from": from_currency, "currency.to": to_currency})
         duration = time.time() - start_time
         REQUEST_COUNT.labels('get', '/convert', 200).inc()
         REQUEST_LATENCY.labels('get', '/convert').observe(duration)
@@ -187,10 +214,13 @@ def get_rates():
 
 @app.route('/metrics')
 def metrics():
+    # Scraping can be switched off once everything reads the OTLP metrics
+    if os.getenv('PROMETHEUS_METRICS_ENABLED', 'true') == 'false':
+        return jsonify({"error": "Prometheus metrics are disabled"}), 404
     return prometheus_client.generate_latest()
 
 if __name__ == '__main__':
     # Start with a separate thread to serve Prometheus metrics
     port = os.getenv('PORT', '8082')
     logger.info("Currency service starting", port=int(port))
-    app.run(host='0.0.0.0', port=int(port)) 
\ No newline at end of file
+    app.run(host='0.0.0.0', port=int(port), ssl_context=server_ssl_context()) 
\ No newline at end of file
@@ -0,0 +1,273 @@
+import hmac
+import json
+import os
+import random
+import re
+import threading
+import time
+from datetime import datetime
+
+from flask import Blueprint, abort, jsonify, request
+from prometheus_client import Counter, Gauge
+from werkzeug.http import HTTP_STATUS_CODES
+
+# Fault types. latency, error and panic apply to matching requests;
+# memory_leak and cpu_burn run in the background while enabled.
+REQUEST_FAULTS = ('latency', 'error', 'panic')
+BACKGROUND_FAULTS = ('memory_leak', 'cpu_burn')
+
+# Latency distributions. fixed waits delay_ms plus up to jitter_ms; uniform
+# picks between delay_ms and max_delay_ms; pareto has a heavy tail starting
+# at delay_ms, capped at max_delay_ms.
+DISTRIBUTIONS = ('fixed', 'uniform', 'pareto')
+
+CHAOS_INJECTIONS = Counter('chaos_injections_total', 'Number of requests affected by an injected fault', ['fault', 'type'])
+CHAOS_ACTIVE_FAULTS = Gauge('chaos_active_faults', 'Number of enabled faults by type', ['type'])
+
+# Requests to these paths are never faulted
+EXEMPT_PATHS = ('/healthz', '/metrics', '/admin/', '/chaos')
+
+
+class InjectedPanic(Exception):
+    pass
+
+
+DURATION_PART = re.compile(r'(\d+(?:\.\d+)?)(ms|s|m|h)')
+DURATION_UNITS = {'ms': 0.001, 's': 1, 'm': 60, 'h': 3600}
+
+
+def _parse_duration(value):
+    """Parse a Go-style duration such as "500ms" or "1m30s" into seconds."""
+    parts = DURATION_PART.findall(value)
+    if not parts or ''.join(n + u for n, u in parts) != value:
+        raise ValueError(f'invalid duration {value!r}')
+    return sum(float(n) * DURATION_UNITS[u] for n, u in parts)
+
+
+def _validate_latency(fault):
+    distribution = fault.setdefault('distribution', 'fixed')
+    if distribution not in DISTRIBUTIONS:
+        raise ValueError(f'unknown distribution {distribution!r}')
+    delay_ms = int(fault.get('delay_ms', 0))
+    if distribution == 'uniform':
+        if delay_ms < 0 or int(fault.get('max_delay_ms', 0)) <= delay_ms:
+            raise ValueError('uniform latency needs 0 <= delay_ms < max_delay_ms')
+        return
+    if delay_ms <= 0:
+        raise ValueError('delay_ms must be positive')
+    if distribution == 'pareto':
+        fault.setdefault('shape', 1.5)
+        if float(fault['shape']) <= 0:
+            raise ValueError('shape must be positive')
+        fault.setdefault('max_delay_ms', 10 * delay_ms)
+        if int(fault['max_delay_ms']) < delay_ms:
+            raise ValueError('max_delay_ms must be at least delay_ms')
+
+
+def _delay_ms(fault):
+    """Draw a delay for a latency fault from its distribution."""
+    delay_ms = int(fault.get('delay_ms', 0))
+    if fault['distribution'] == 'uniform':
+        return random.uniform(delay_ms, int(fault['max_delay_ms']))
+    if fault['distribution'] == 'pareto':
+        return min(delay_ms * random.paretovariate(float(fault['shape'])), int(fault['max_delay_ms']))
+    return delay_ms + random.randint(0, int(fault.get('jitter_ms', 0)))
+
+
+def _validate(fault):
+    """Validate a fault definition and fill in defaults, mirroring the Go services."""
+    if not fault.get('name'):
+        raise ValueError('name is required')
+    fault_type = fault.get('type')
+    if fault_type not in REQUEST_FAULTS + BACKGROUND_FAULTS:
+        raise ValueError(f'unknown fault type {fault_type!r}')
+
+    fault.setdefault('probability', 1)
+    if not 0 < float(fault['probability']) <= 1:
+        raise ValueError('probability must be between 0 and 1')
+    if fault.get('route'):
+        parts = fault['route'].split()
+        if len(parts) != 2:
+            raise ValueError(f'route must look like "GET /path", got {fault["route"]!r}')
+        fault['route'] = ' '.join(parts)
+
+    if fault_type == 'latency':
+        _validate_latency(fault)
+    if fault_type == 'error':
+        fault.setdefault('status_code', 500)
+        if not 400 <= int(fault['status_code']) <= 599:
+            raise ValueError('status_code must be between 400 and 599')
+    if fault_type == 'memory_leak':
+        fault.setdefault('memory_mb', 10)
+        fault.setdefault('max_memory_mb', 512)
+        fault.setdefault('interval', '1s')
+        if _parse_duration(fault['interval']) <= 0:
+            raise ValueError('interval must be a positive duration')
+    if fault_type == 'cpu_burn':
+        fault.setdefault('cores', 1)
+        fault.setdefault('percent', 100)
+        if not 1 <= int(fault['percent']) <= 100:
+            raise ValueError('percent must be between 1 and 100')
+    if fault.get('duration'):
+        _parse_duration(fault['duration'])
+    return fault
+
+
+class ChaosController:
+    """Holds the enabled faults and the threads running background faults."""
+
+    def __init__(self, logger):
+        self.logger = logger
+        self.lock = threading.Lock()
+        self.faults = {}
+
+    def enable(self, fault):
+        fault = _validate(dict(fault))
+        with self.lock:
+            self._disable_locked(fault['name'])
+
+            now = time.time()
+            fault['enabled_at'] = datetime.utcfromtimestamp(now).isoformat() + 'Z'
+            stop = threading.Event()
+            if fault.get('duration'):
+                timer = threading.Timer(_parse_duration(fault['duration']), self._expire, (fault['name'], stop))
+                timer.daemon = True
+                timer.start()
+
+            self.faults[fault['name']] = (fault, stop)
+            CHAOS_ACTIVE_FAULTS.labels(fault['type']).inc()
+
+            if fault['type'] == 'memory_leak':
+                threading.Thread(target=_leak_memory, args=(fault, stop), daemon=True).start()
+            elif fault['type'] == 'cpu_burn':
+                # The GIL keeps Python to roughly one busy core however many threads run
+                for _ in range(int(fault['cores'])):
+                    threading.Thread(target=_burn_cpu, args=(int(fault['percent']), stop), daemon=True).start()
+
+        self.logger.warning("Fault enabled", fault=fault['name'], type=fault['type'], route=fault.get('route', ''))
+        return fault
+
+    def _expire(self, name, stop):
+        with self.lock:
+            current = self.faults.get(name)
+            # Only expire the fault this timer was started for
+            if current and current[1] is stop:
+                self._disable_locked(name)
+
+    def disable(self, name):
+        with self.lock:
+            return self._disable_locked(name)
+
+    def _disable_locked(self, name):
+        entry = self.faults.pop(name, None)
+        if entry is None:
+            return False
+        fault, stop = entry
+        stop.set()
+        CHAOS_ACTIVE_FAULTS.labels(fault['type']).dec()
+        self.logger.info("Fault disabled", fault=name, type=fault['type'])
+        return True
+
+    def disable_all(self):
+        with self.lock:
+            names = list(self.faults)
+            for name in names:
+                self._disable_locked(name)
+            return len(names)
+
+    def list(self):
+        with self.lock:
+            return [fault for _, (fault, _) in sorted(self.faults.items())]
+
+    def request_faults(self, method, route):
+        with self.lock:
+            faults = [
+                fault for fault, _ in self.faults.values()
+                if fault['type'] in REQUEST_FAULTS
+                and (not fault.get('route') or fault['route'] == f'{method} {route}')
+                and random.random() < float(fault['probability'])
+            ]
+        # Delays go first so an injected error still arrives late
+        return sorted(faults, key=lambda f: f['type'] != 'latency')
+
+
+def _leak_memory(fault, stop):
+    leaked = []
+    while not stop.wait(_parse_duration(fault['interval'])):
+        if len(leaked) * int(fault['memory_mb']) < int(fault['max_memory_mb']):
+            # bytearray zero-fills, so the memory is actually resident
+            leaked.append(bytearray(int(fault['memory_mb']) << 20))
+
+
+def _burn_cpu(percent, stop):
+    busy = percent / 1000.0
+    idle = 0.1 - busy
+    while not stop.is_set():
+        deadline = time.time() + busy
+        while time.time() < deadline:
+            pass
+        if idle > 0:
+            stop.wait(idle)
+
+
+def init_chaos(app, logger):
+    """Apply CHAOS_FAULTS, fault matching requests and, when CHAOS_ENABLED=true, mount the /chaos API."""
+    controller = ChaosController(logger)
+    for fault in json.loads(os.getenv('CHAOS_FAULTS') or '[]'):
+        fault['source'] = 'config'
+        controller.enable(fault)
+
+    @app.before_request
+    def inject_faults():
+        if request.path.startswith(EXEMPT_PATHS) or request.url_rule is None:
+            return None
+        for fault in controller.request_faults(request.method, request.url_rule.rule):
+            CHAOS_INJECTIONS.labels(fault['name'], fault['type']).inc()
+            if fault['type'] == 'latency':
+                time.sleep(_delay_ms(fault) / 1000.0)
+            elif fault['type'] == 'error':
+                status = int(fault['status_code'])
+                return jsonify({"error": HTTP_STATUS_CODES.get(status, 'Error')}), status
+            elif fault['type'] == 'panic':
+                raise InjectedPanic(f"injected panic (fault {fault['name']})")
+        return None
+
+    if os.getenv('CHAOS_ENABLED') != 'true':
+        return controller
+
+    chaos_api = Blueprint('chaos', __name__)
+    token = os.getenv('CHAOS_TOKEN', '')
+
+    @chaos_api.before_request
+    def check_token():
+        if token and not hmac.compare_digest(request.headers.get('Authorization', ''), f'Bearer {token}'):
+            abort(401)
+
+    @chaos_api.route('/faults', methods=['GET'])
+    def list_faults():
+        return jsonify({"faults": controller.list()})
+
+    @chaos_api.route('/faults', methods=['POST'])
+    def enable_fault():
+        fault = request.get_json(silent=True)
+        if not isinstance(fault, dict):
+            return jsonify({"error": "Invalid fault"}), 400
+        fault['source'] = 'api'
+        try:
+            controller.enable(fault)
+        except (ValueError, TypeError) as e:
+            return jsonify({"error": str(e)}), 400
+        return jsonify({"faults": controller.list()}), 201
+
+    @chaos_api.route('/faults/<name>', methods=['DELETE'])
+    def disable_fault(name):
+        if not controller.disable(name):
+            return jsonify({"error": "Fault not found"}), 404
+        return '', 204
+
+    @chaos_api.route('/faults', methods=['DELETE'])
+    def disable_all_faults():
+        return jsonify({"disabled": controller.disable_all()})
+
+    app.register_blueprint(chaos_api, url_prefix='/chaos')
+    return controller
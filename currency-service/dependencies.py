@@ -0,0 +1,72 @@
+"""Downstream call map, shared by the Python services.
+
+Every call made with requests is recorded by host: call and error counts,
+and the last call's status, latency and error. GET /debug/dependencies
+returns them in the same shape as the Go services. Transport errors and 5xx
+responses count as errors.
+"""
+import threading
+import time
+from datetime import datetime, timezone
+from urllib.parse import urlsplit
+
+from flask import jsonify
+from opentelemetry.instrumentation.requests import RequestsInstrumentor
+
+_lock = threading.Lock()
+_hosts = {}
+
+
+def _now():
+    return datetime.now(timezone.utc).isoformat().replace('+00:00', 'Z')
+
+
+def _record(host, status, error, latency_ms):
+    with _lock:
+        stats = _hosts.setdefault(host, {
+            'host': host,
+            'calls': 0,
+            'errors': 0,
+        })
+        stats['calls'] += 1
+        stats['last_latency_ms'] = round(latency_ms, 3)
+        stats['last_called_at'] = _now()
+        stats.pop('last_status', None)
+        stats.pop('last_error', None)
+        if status:
+            stats['last_status'] = status
+        if error:
+            stats['last_error'] = error
+        if error or status >= 500:
+            stats['errors'] += 1
+            stats['last_error_at'] = stats['last_called_at']
+
+
+def _request_hook(span, request):
+    request.dependency_start = time.monotonic()
+
+
+def _response_hook(span, request, response):
+    start = getattr(request, 'dependency_start', None)
+    latency_ms = (time.monotonic() - start) * 1000 if start is not None else 0
+    host = urlsplit(request.url).netloc
+    if response is None:
+        _record(host, 0, 'request failed', latency_ms)
+    else:
+        _record(host, response.status_code, None, latency_ms)
+
+
+def dependencies():
+    """What is known about each downstream host, sorted by host."""
+    with _lock:
+        return [dict(_hosts[host]) for host in sorted(_hosts)]
+
+
+def init_dependencies(app, service):
+    """Trace calls made with requests, record them and serve
+    GET /debug/dependencies. It replaces RequestsInstrumentor().instrument()."""
+    RequestsInstrumentor().instrument(request_hook=_request_hook, response_hook=_response_hook)
+
+    @app.route('/debug/dependencies', methods=['GET'])
+    def get_dependencies():
+        return jsonify({'service': service, 'dependencies': dependencies()})
@@ -1,13 +1,51 @@
+import hmac
 import json
+import os
+import random
 import sys
 from datetime import datetime
 from typing import Optional, Dict, Any
+
+from flask import jsonify, request
 from opentelemetry import trace
 
+from request_id import current_request_id
+
+LEVELS = {"DEBUG": 0, "INFO": 1, "WARN": 2, "ERROR": 3}
+
+
+def parse_level(value: str) -> str:
+    """Parse debug, info, warn (or warning) and error in any case."""
+    level = value.strip().upper()
+    if level == "WARNING":
+        level = "WARN"
+    if level not in LEVELS:
+        raise ValueError(f"level must be debug, info, warn or error, got {value!r}")
+    return level
+
+
+def parse_sample_rate(value) -> float:
+    rate = float(value)
+    if not 0 <= rate <= 1:
+        raise ValueError(f"info_sample_rate must be between 0 and 1, got {value!r}")
+    return rate
+
+
+def _fnv32a(data: str) -> int:
+    """FNV-1a, as the Go services use, so a trace is sampled the same way everywhere."""
+    h = 0x811c9dc5
+    for b in data.encode():
+        h = ((h ^ b) * 0x01000193) & 0xffffffff
+    return h
+
 
 class StructuredLogger:
     def __init__(self, service_name: str):
         self.service_name = service_name
+        # LOG_LEVEL (default info) drops lower levels; LOG_INFO_SAMPLE_RATE
+        # is the fraction of INFO lines to keep (default 1)
+        self.level = parse_level(os.getenv("LOG_LEVEL", "info"))
+        self.info_sample_rate = parse_sample_rate(os.getenv("LOG_INFO_SAMPLE_RATE", "1"))
         
     def _extract_trace_info(self) -> tuple[Optional[str], Optional[str]]:
         """Extract trace and span IDs from the current OpenTelemetry context."""
@@ -18,10 +56,23 @@ class StructuredLogger:
             span_id = format(span_context.span_id, '016x')
             return trace_id, span_id
         return None, None
+
+    def _enabled(self, level: str, trace_id: Optional[str]) -> bool:
+        """INFO lines in a trace are sampled by trace ID, so a trace keeps all of its lines or none."""
+        if LEVELS[level] < LEVELS[self.level]:
+            return False
+        rate = self.info_sample_rate
+        if level != "INFO" or rate >= 1:
+            return True
+        if not trace_id:
+            return random.random() < rate
+        return _fnv32a(trace_id) / 2**32 < rate
     
     def _log(self, level: str, message: str, fields: Optional[Dict[str, Any]] = None):
         """Write a structured log entry to stdout."""
         trace_id, span_id = self._extract_trace_info()
+        if not self._enabled(level, trace_id):
+            return
         
         log_entry = {
             "timestamp": datetime.utcnow().isoformat() + "Z",
@@ -34,6 +85,9 @@ class StructuredLogger:
             log_entry["trace_id"] = trace_id
         if span_id:
             log_entry["span_id"] = span_id
+        request_id = current_request_id()
+        if request_id:
+            log_entry["request_id"] = request_id
         if fields:
             log_entry["fields"] = fields
             
@@ -53,4 +107,36 @@ class StructuredLogger:
     
     def error(self, message: str, **kwargs):
         """Log an error message."""
-        self._log("ERROR", message, kwargs if kwargs else None)
\ No newline at end of file
+        self._log("ERROR", message, kwargs if kwargs else None)
+
+
+def register_log_level_routes(app, logger: StructuredLogger):
+    """Mount GET and PUT /admin/loglevel to read and change logger's level and
+    INFO sampling at runtime. Requests must carry ADMIN_TOKEN as a Bearer
+    token when it is set."""
+    token = os.getenv("ADMIN_TOKEN", "")
+
+    def settings():
+        return jsonify({"level": logger.level.lower(), "info_sample_rate": logger.info_sample_rate})
+
+    @app.route("/admin/loglevel", methods=["GET", "PUT"])
+    def log_level():
+        if token and not hmac.compare_digest(request.headers.get("Authorization", ""), f"Bearer {token}"):
+            return jsonify({"error": "Unauthorized"}), 401
+        if request.method == "GET":
+            return settings()
+
+        body = request.get_json(silent=True)
+        if not isinstance(body, dict):
+            return jsonify({"error": "Invalid request"}), 400
+        try:
+            # Validate both before applying either
+            level = parse_level(body["level"]) if body.get("level") is not None else logger.level
+            rate = parse_sample_rate(body["info_sample_rate"]) if body.get("info_sample_rate") is not None else logger.info_sample_rate
+        except (ValueError, TypeError, AttributeError) as e:
+            return jsonify({"error": str(e)}), 400
+
+        logger.level = level
+        logger.info_sample_rate = rate
+        logger.warning("Log settings changed", level=level, info_sample_rate=rate)
+        return settings()
@@ -0,0 +1,239 @@
+import hmac
+import os
+import time
+from concurrent.futures import ThreadPoolExecutor
+
+import requests
+from flask import Blueprint, jsonify, request
+from opentelemetry import context
+from prometheus_client import Counter, Histogram
+
+# Per-dependency timeouts in seconds, overridable with API_TIMEOUTS, e.g.
+# "ads=0.25,inventory=2"
+DEFAULT_TIMEOUTS = {
+    'catalog': 2.0,
+    'currency': 1.0,
+    'ads': 0.5,
+    'inventory': 1.0,
+    'instabook': 10.0,
+}
+
+# Availability is looked up for at most this many products per page
+MAX_INVENTORY_LOOKUPS = 20
+
+DEPENDENCY_REQUESTS = Counter('api_dependency_requests_total', 'Number of calls from the /api surface to backing services', ['dependency', 'result'])
+DEPENDENCY_LATENCY = Histogram('api_dependency_latency_seconds', 'Latency of calls from the /api surface to backing services', ['dependency'])
+
+api = Blueprint('api', __name__)
+
+# Filled in by init_api
+services = {}
+timeouts = dict(DEFAULT_TIMEOUTS)
+api_keys = []
+executor = None
+logger = None
+
+
+class DependencyError(Exception):
+    """A backing service failed, timed out or returned a server error."""
+
+    def __init__(self, dependency, message, status=502):
+        super().__init__(message)
+        self.dependency = dependency
+        self.status = status
+
+
+def parse_timeouts(value):
+    parsed = dict(DEFAULT_TIMEOUTS)
+    for entry in (value or '').split(','):
+        name, _, seconds = entry.strip().partition('=')
+        if name in parsed and seconds:
+            parsed[name] = float(seconds)
+    return parsed
+
+
+def call(dependency, method, path, **kwargs):
+    """Call a backing service with its timeout. Server errors, timeouts and
+    connection failures raise DependencyError; other responses are returned."""
+    start = time.time()
+    try:
+        response = requests.request(method, services[dependency] + path, timeout=timeouts[dependency], **kwargs)
+    except requests.Timeout:
+        DEPENDENCY_REQUESTS.labels(dependency, 'timeout').inc()
+        raise DependencyError(dependency, f'{dependency} timed out after {timeouts[dependency]}s', status=504)
+    except requests.RequestException as e:
+        DEPENDENCY_REQUESTS.labels(dependency, 'error').inc()
+        raise DependencyError(dependency, f'{dependency} unavailable: {e}')
+    finally:
+        DEPENDENCY_LATENCY.labels(dependency).observe(time.time() - start)
+
+    if response.status_code >= 500:
+        DEPENDENCY_REQUESTS.labels(dependency, 'error').inc()
+        raise DependencyError(dependency, f'{dependency} returned {response.status_code}')
+    DEPENDENCY_REQUESTS.labels(dependency, 'success').inc()
+    return response
+
+
+def fan_out(calls):
+    """Run calls (name -> zero-argument function) in parallel and return
+    name -> result, or the exception the call raised. Each worker runs in
+    the caller's trace context, so downstream spans share the request's trace."""
+    ctx = context.get_current()
+
+    def run(fn):
+        token = context.attach(ctx)
+        try:
+            return fn()
+        finally:
+            context.detach(token)
+
+    futures = {name: executor.submit(run, fn) for name, fn in calls.items()}
+    results = {}
+    for name, future in futures.items():
+        try:
+            results[name] = future.result()
+        except Exception as e:
+            results[name] = e
+    return results
+
+
+def dependency_error(e):
+    logger.error("Dependency call failed", dependency=e.dependency, error=str(e))
+    return jsonify({"error": str(e), "dependency": e.dependency}), e.status
+
+
+def fetch_rate(currency):
+    response = call('currency', 'GET', '/convert', params={"from": "USD", "to": currency})
+    if response.status_code != 200:
+        raise DependencyError('currency', f'currency returned {response.status_code}')
+    return response.json().get('rate', 1.0)
+
+
+def fetch_ads(product_ids):
+    response = call('ads', 'GET', '/ads', params={"product_ids": ",".join(str(i) for i in product_ids)})
+    return response.json() if response.status_code == 200 else []
+
+
+def fetch_availability(product_id):
+    response = call('inventory', 'GET', f'/inventory/{product_id}')
+    return response.json() if response.status_code == 200 else None
+
+
+def convert_price(product, rate, currency):
+    product['price'] = round(float(product['price']) * rate, 2)
+    product['currency'] = currency
+
+
+@api.before_request
+def authenticate():
+    if not api_keys:
+        return None
+    auth = request.headers.get('Authorization', '')
+    key = auth[len('Bearer '):] if auth.startswith('Bearer ') else request.headers.get('X-API-Key', '')
+    if not any(hmac.compare_digest(key, k) for k in api_keys):
+        return jsonify({"error": "Unauthorized"}), 401
+    return None
+
+
+@api.route('/products', methods=['GET'])
+def list_products():
+    """Products with their ads and availability. Ads, availability and
+    currency conversion are best effort and listed in "degraded" when a
+    dependency fails."""
+    currency = request.args.get('currency', 'USD')
+    params = {k: v for k, v in request.args.items() if k != 'currency'}
+    try:
+        response = call('catalog', 'GET', '/products', params=params)
+    except DependencyError as e:
+        return dependency_error(e)
+    if response.status_code != 200:
+        return jsonify(response.json()), response.status_code
+    products = response.json()
+
+    calls = {'ads': lambda: fetch_ads([p['id'] for p in products[:3]])}
+    if currency != 'USD':
+        calls['currency'] = lambda: fetch_rate(currency)
+    for product in products[:MAX_INVENTORY_LOOKUPS]:
+        calls[f"inventory:{product['id']}"] = lambda product_id=product['id']: fetch_availability(product_id)
+    results = fan_out(calls)
+
+    degraded = sorted({name.split(':')[0] for name, result in results.items() if isinstance(result, Exception)})
+    for name in degraded:
+        logger.warning("Serving degraded products response", dependency=name)
+
+    rate = results.get('currency')
+    for product in products:
+        availability = results.get(f"inventory:{product['id']}")
+        product['availability'] = None if isinstance(availability, Exception) else availability
+        if currency != 'USD' and not isinstance(rate, Exception):
+            convert_price(product, rate, currency)
+
+    ads = results['ads']
+    return jsonify({
+        "products": products,
+        "ads": [] if isinstance(ads, Exception) else ads,
+        "degraded": degraded,
+    })
+
+
+@api.route('/products/<int:product_id>', methods=['GET'])
+def get_product(product_id):
+    """One product with its ads and availability, fetched in parallel"""
+    currency = request.args.get('currency', 'USD')
+    calls = {
+        'catalog': lambda: call('catalog', 'GET', f'/product/{product_id}'),
+        'ads': lambda: fetch_ads([product_id]),
+        'inventory': lambda: fetch_availability(product_id),
+    }
+    if currency != 'USD':
+        calls['currency'] = lambda: fetch_rate(currency)
+    results = fan_out(calls)
+
+    if isinstance(results['catalog'], DependencyError):
+        return dependency_error(results['catalog'])
+    response = results['catalog']
+    if response.status_code != 200:
+        return jsonify(response.json()), response.status_code
+
+    degraded = sorted(name for name, result in results.items() if isinstance(result, Exception))
+    product = response.json()
+    if currency != 'USD' and not isinstance(results['currency'], Exception):
+        convert_price(product, results['currency'], currency)
+    product['availability'] = None if isinstance(results['inventory'], Exception) else results['inventory']
+
+    ads = results['ads']
+    return jsonify({
+        "product": product,
+        "ads": [] if isinstance(ads, Exception) else ads,
+        "degraded": degraded,
+    })
+
+
+@api.route('/bookings', methods=['POST'])
+def create_booking():
+    try:
+        response = call('instabook', 'POST', '/booking', json=request.get_json(silent=True))
+    except DependencyError as e:
+        return dependency_error(e)
+    return jsonify(response.json()), response.status_code
+
+
+@api.route('/bookings/<booking_id>', methods=['GET'])
+def get_booking(booking_id):
+    try:
+        response = call('instabook', 'GET', f'/booking/{booking_id}')
+    except DependencyError as e:
+        return dependency_error(e)
+    return jsonify(response.json()), response.status_code
+
+
+def init_api(app, service_urls, api_logger):
+    """Mount the /api surface. Clients authenticate with one of API_KEYS
+    (comma-separated) as a Bearer token or X-API-Key when it is set."""
+    global executor, logger, timeouts, api_keys
+    services.update(service_urls)
+    timeouts = parse_timeouts(os.getenv('API_TIMEOUTS'))
+    api_keys = [k.strip() for k in os.getenv('API_KEYS', '').split(',') if k.strip()]
+    executor = ThreadPoolExecutor(max_workers=int(os.getenv('API_FANOUT_WORKERS', '16')))
+    logger = api_logger
+    app.register_blueprint(api, url_prefix='/api')
@@ -13,11 +13,21 @@ from opentelemetry.sdk.trace.export import BatchSpanProcessor
 from opentelemetry.sdk.resources import Resource
 from opentelemetry.semconv.resource import ResourceAttributes
 from opentelemetry.exporter.otlp.proto.http.trace_exporter import OTLPSpanExporter
+from opentelemetry import metrics as otel_metrics
+from opentelemetry.sdk.metrics import MeterProvider
+from opentelemetry.sdk.metrics.export import PeriodicExportingMetricReader
+from opentelemetry.exporter.otlp.proto.http.metric_exporter import OTLPMetricExporter
 from opentelemetry.instrumentation.flask import FlaskInstrumentor
-from opentelemetry.instrumentation.requests import RequestsInstrumentor
 
 # Import structured logger
-from structured_logger import StructuredLogger
+from structured_logger import StructuredLogger, register_log_level_routes
+from chaos import init_chaos
+from dependencies import init_dependencies
+from compression import init_compression
+from request_id import init_request_id
+from access_log import init_access_log
+from tls import server_ssl_context
+from api import init_api
 
 # Initialize OpenTelemetry
 resource = Resource.create({
@@ -40,6 +50,16 @@ trace_provider.add_span_processor(span_processor)
 # Create the tracer
 tracer = trace.get_tracer(__name__)
 
+# Configure the meter provider to push metrics over OTLP every
+# OTEL_METRIC_EXPORT_INTERVAL ms; FlaskInstrumentor records request durations with it
+if os.getenv("OTEL_METRICS_ENABLED", "true") != "false":
+    metric_exporter = OTLPMetricExporter(endpoint=os.getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "http://otel-collector:4318/v1/metrics"))
+    metric_reader = PeriodicExportingMetricReader(metric_exporter)
+    otel_metrics.set_meter_provider(MeterProvider(resource=resource, metric_readers=[metric_reader]))
+
+# Create the meter
+meter = otel_metrics.get_meter(__name__)
+
 # Initialize structured logger
 logger = StructuredLogger("gateway")
 
@@ -48,21 +68,45 @@ app = Flask(__name__)
 # Instrument Flask
 FlaskInstrumentor().instrument_app(app)
 
-# Instrument requests library
-RequestsInstrumentor().instrument()
+# Instrument requests library and record each downstream call for
+# /debug/dependencies
+init_dependencies(app, "gateway")
 
 app.register_blueprint(healthz, url_prefix="/healthz")
 
+# X-Request-ID on every response, log line and outgoing call, and one
+# access log line per request
+init_compression(app)
+init_request_id(app)
+init_access_log(app, logger)
+
+# Injected faults from CHAOS_FAULTS and the /chaos API
+init_chaos(app, logger)
+register_log_level_routes(app, logger)
+
 # Service URLs from environment variables with defaults for local development
 PRODUCT_CATALOG_SERVICE = os.getenv('PRODUCT_CATALOG_SERVICE', 'http://localhost:8081')
 CURRENCY_SERVICE = os.getenv('CURRENCY_SERVICE', 'http://localhost:8082')
 AD_SERVICE = os.getenv('AD_SERVICE', 'http://localhost:8083')
 CHECKOUT_SERVICE = os.getenv('CHECKOUT_SERVICE', 'http://localhost:8084')
 INVENTORY_SERVICE = os.getenv('INVENTORY_SERVICE', 'http://localhost:8085')
+INSTABOOK_SERVICE = os.getenv('INSTABOOK_SERVICE', 'http://localhost:8087')
+
+# Unified /api surface for frontends
+init_api(app, {
+    'catalog': PRODUCT_CATALOG_SERVICE,
+    'currency': CURRENCY_SERVICE,
+    'ads': AD_SERVICE,
+    'inventory': INVENTORY_SERVICE,
+    'instabook': INSTABOOK_SERVICE,
+}, logger)
 
 # Prometheus metrics
 REQUEST_COUNT = Counter('request_count', 'App Request Count', ['method', 'endpoint', 'http_status'])
 
+# OpenTelemetry metrics
+CHECKOUT_COUNTER = meter.create_counter('gateway.checkouts', description='Number of checkouts by result')
+
 def healthz_status():
     return True
 
@@ -241,17 +285,22 @@ def checkout():
             response.raise_for_status()
             
             REQUEST_COUNT.labels('post', '/checkout', 200).inc()
+            CHECKOUT_COUNTER.add(1, {"result": "success"})
             return jsonify(response.json())
         
     except requests.RequestException as e:
         logger.error("Error handling checkout request", error=str(e), exception_type=type(e).__name__)
         REQUEST_COUNT.labels('post', '/checkout', 500).inc()
+        CHECKOUT_COUNTER.add(1, {"result": "error"})
         return jsonify({"error": str(e)}), 500
 
 @app.route('/metrics')
 def metrics():
+    # Scraping can be switched off once everything reads the OTLP metrics
+    if os.getenv('PROMETHEUS_METRICS_ENABLED', 'true') == 'false':
+        return jsonify({"error": "Prometheus metrics are disabled"}), 404
     return prometheus_client.generate_latest()
 
 if __name__ == '__main__':
     logger.info("Gateway service starting", port=8080)
-    app.run(host='0.0.0.0', port=8080) 
\ No newline at end of file
+    app.run(host='0.0.0.0', port=8080, ssl_context=server_ssl_context()) 
\ No newline at end of file
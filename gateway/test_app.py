@@ -4,6 +4,8 @@ import sys
 import os
 from unittest.mock import patch, MagicMock
 
+import requests
+
 # Add parent directory to path so we can import the app
 sys.path.insert(0, os.path.abspath(os.path.dirname(__file__)))
 from app import app
@@ -118,5 +120,119 @@ class GatewayServiceTest(unittest.TestCase):
         self.assertEqual(data['order_id'], 'test-order-id')
         self.assertEqual(data['total'], 20.0)
 
+    @patch('api.requests.request')
+    def test_api_products(self, mock_request):
+        def side_effect(method, url, **kwargs):
+            response = MagicMock()
+            response.status_code = 200
+            if url.endswith('/products'):
+                response.json.return_value = [{"id": 1, "name": "Test Product", "price": 10.0, "currency": "USD"}]
+            elif '/ads' in url:
+                response.json.return_value = [{"id": "ad1", "text": "Ad text"}]
+            elif '/inventory/' in url:
+                response.json.return_value = {"product_id": "1", "quantity": 5}
+            return response
+
+        mock_request.side_effect = side_effect
+
+        response = self.app.get('/api/products')
+        data = json.loads(response.data)
+
+        self.assertEqual(response.status_code, 200)
+        self.assertEqual(data['products'][0]['availability']['quantity'], 5)
+        self.assertEqual(len(data['ads']), 1)
+        self.assertEqual(data['degraded'], [])
+
+    @patch('api.requests.request')
+    def test_api_products_degraded(self, mock_request):
+        def side_effect(method, url, **kwargs):
+            if '/ads' in url:
+                raise requests.Timeout()
+            response = MagicMock()
+            response.status_code = 200
+            if url.endswith('/products'):
+                response.json.return_value = [{"id": 1, "name": "Test Product", "price": 10.0, "currency": "USD"}]
+            else:
+                response.json.return_value = {"product_id": "1", "quantity": 5}
+            return response
+
+        mock_request.side_effect = side_effect
+
+        response = self.app.get('/api/products')
+        data = json.loads(response.data)
+
+        self.assertEqual(response.status_code, 200)
+        self.assertEqual(data['ads'], [])
+        self.assertEqual(data['degraded'], ['ads'])
+
+    @patch('api.requests.request')
+    def test_api_catalog_timeout(self, mock_request):
+        mock_request.side_effect = requests.Timeout()
+
+        response = self.app.get('/api/products')
+        data = json.loads(response.data)
+
+        self.assertEqual(response.status_code, 504)
+        self.assertEqual(data['dependency'], 'catalog')
+
+    @patch('api.api_keys', ['secret-key'])
+    def test_api_requires_key(self):
+        response = self.app.get('/api/products')
+        self.assertEqual(response.status_code, 401)
+
+    @patch('api.requests.request')
+    def test_api_create_booking(self, mock_request):
+        mock_response = MagicMock()
+        mock_response.status_code = 201
+        mock_response.json.return_value = {"id": "bk-1", "status": "confirmed"}
+        mock_request.return_value = mock_response
+
+        response = self.app.post(
+            '/api/bookings',
+            data=json.dumps({"user_id": "user-1", "product_id": "1", "quantity": 1}),
+            content_type='application/json'
+        )
+        data = json.loads(response.data)
+
+        self.assertEqual(response.status_code, 201)
+        self.assertEqual(data['status'], 'confirmed')
+        self.assertEqual(mock_request.call_args[0][0], 'POST')
+
+    @patch('app.logger.info_sample_rate', 1.0)
+    @patch('app.logger.level', 'INFO')
+    def test_set_log_level(self):
+        response = self.app.put(
+            '/admin/loglevel',
+            data=json.dumps({"level": "warning", "info_sample_rate": 0.25}),
+            content_type='application/json'
+        )
+        self.assertEqual(response.status_code, 200)
+
+        data = json.loads(self.app.get('/admin/loglevel').data)
+        self.assertEqual(data, {"level": "warn", "info_sample_rate": 0.25})
+
+        response = self.app.put(
+            '/admin/loglevel',
+            data=json.dumps({"level": "verbose"}),
+            content_type='application/json'
+        )
+        self.assertEqual(response.status_code, 400)
+
+    def test_request_id(self):
+        response = self.app.get('/', headers={'X-Request-ID': 'req-123'})
+        self.assertEqual(response.headers['X-Request-ID'], 'req-123')
+
+        response = self.app.put(
+            '/admin/loglevel',
+            data=json.dumps({"level": "verbose"}),
+            content_type='application/json',
+            headers={'X-Request-ID': 'req-456'}
+        )
+        self.assertEqual(response.status_code, 400)
+        self.assertEqual(json.loads(response.data)['request_id'], 'req-456')
+
+        response = self.app.get('/', headers={'X-Request-ID': 'bad id'})
+        self.assertRegex(response.headers['X-Request-ID'], r'^[0-9a-f]{32}$')
+
 if __name__ == '__main__':
     unittest.main() 
\ No newline at end of file
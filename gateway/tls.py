@@ -0,0 +1,25 @@
+import os
+import ssl
+
+
+def server_ssl_context():
+    """TLS for the Flask listener when TLS_CERT_FILE is set, or None for plain
+    HTTP. With TLS_CLIENT_CA_FILE, clients must present a certificate signed
+    by that CA unless TLS_CLIENT_AUTH=optional. Unlike the Go services, the
+    certificates are only read at startup."""
+    cert_file = os.getenv('TLS_CERT_FILE')
+    if not cert_file:
+        return None
+
+    context = ssl.SSLContext(ssl.PROTOCOL_TLS_SERVER)
+    context.minimum_version = ssl.TLSVersion.TLSv1_2
+    context.load_cert_chain(cert_file, os.getenv('TLS_KEY_FILE'))
+
+    client_ca_file = os.getenv('TLS_CLIENT_CA_FILE')
+    if client_ca_file:
+        context.load_verify_locations(client_ca_file)
+        if os.getenv('TLS_CLIENT_AUTH', 'require') == 'optional':
+            context.verify_mode = ssl.CERT_OPTIONAL
+        else:
+            context.verify_mode = ssl.CERT_REQUIRED
+    return context
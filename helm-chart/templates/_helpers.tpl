@@ -13,4 +13,18 @@ Selector labels
 {{- define "microservice-demo.selectorLabels" -}}
 app.kubernetes.io/name: {{ .name }}
 app.kubernetes.io/part-of: microservice-demo
-{{- end -}} 
\ No newline at end of file
+{{- end -}} 
+
+{{/*
+Domain event publishing settings, empty unless events.broker is set
+*/}}
+{{- define "microservice-demo.eventsEnv" -}}
+{{- if .Values.events.broker }}
+- name: EVENTS_BROKER
+  value: "{{ .Values.events.broker }}"
+- name: KAFKA_BROKERS
+  value: "{{ .Values.events.kafkaBrokers }}"
+- name: NATS_URL
+  value: "{{ .Values.events.natsURL }}"
+{{- end }}
+{{- end -}}
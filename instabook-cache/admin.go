@@ -0,0 +1,550 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"platform"
+)
+
+// memoryBackend is the in-memory session store when CACHE_BACKEND=memory,
+// for the admin eviction stats; nil with Redis
+var memoryBackend *MemoryStore
+
+// MemoryStats describes the in-memory store's occupancy against its bounds
+type MemoryStats struct {
+	Entries    int   `json:"entries"`
+	MaxEntries int   `json:"max_entries"`
+	UsedBytes  int64 `json:"used_bytes"`
+	SoftLimit  int64 `json:"soft_limit_bytes"`
+	HardLimit  int64 `json:"hard_limit_bytes"`
+}
+
+func (s *MemoryStore) Stats() MemoryStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return MemoryStats{
+		Entries:    len(s.entries),
+		MaxEntries: s.maxEntries,
+		UsedBytes:  s.usedBytes,
+		SoftLimit:  s.softLimit,
+		HardLimit:  s.hardLimit,
+	}
+}
+
+// EvictionTally counts evictions by reason since the process started, for
+// GET /admin/stats. Prometheus has the same counts, but not in a form the
+// admin page can read.
+type EvictionTally struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	last   time.Time
+}
+
+var evictions = &EvictionTally{counts: make(map[string]int64)}
+
+func (t *EvictionTally) Record(reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.counts[reason]++
+	t.last = time.Now().UTC()
+}
+
+// Snapshot returns a copy of the counts and when the last eviction was
+func (t *EvictionTally) Snapshot() (map[string]int64, *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := map[string]int64{evictExpired: 0, evictCapacity: 0, evictMemory: 0}
+	for reason, n := range t.counts {
+		counts[reason] = n
+	}
+	if t.last.IsZero() {
+		return counts, nil
+	}
+	last := t.last
+	return counts, &last
+}
+
+// registerAdminRoutes mounts the admin page and the JSON APIs it is built
+// on. Everything but the page and the token toggle requires
+// INSTABOOK_ADMIN_TOKEN when it is set.
+func registerAdminRoutes(router *gin.Engine) {
+	// The admin dashboard shows this alongside every other service, so
+	// send people there when it is deployed
+	router.GET("/admin", func(c *gin.Context) {
+		if dashboard := config.Get("ADMIN_DASHBOARD_URL"); dashboard != "" {
+			c.Redirect(http.StatusFound, dashboard)
+			return
+		}
+		c.Header("Content-Type", "text/html")
+		c.String(http.StatusOK, adminHTML)
+	})
+
+	// Token status and toggle, open as before for the scenario's runbooks
+	router.GET("/admin/token", func(c *gin.Context) {
+		c.JSON(http.StatusOK, tokenAuth.Status())
+	})
+	router.POST("/admin/token", func(c *gin.Context) {
+		logTokenAuthChange(c, tokenAuth.Toggle(tokenReEnableAfter()), "token_auth.toggle")
+	})
+
+	admin := router.Group("/admin", adminAuthMiddleware(config.Get("INSTABOOK_ADMIN_TOKEN")))
+	admin.PUT("/token", setTokenAuth)
+
+	// Named API token management
+	admin.GET("/tokens", listTokens)
+	admin.POST("/tokens", createToken)
+	admin.DELETE("/tokens/:id", revokeToken)
+
+	// Session browsing across every tenant, with the /cache/sessions filters
+	admin.GET("/sessions", listSessions)
+	admin.GET("/stats", getAdminStats)
+
+	admin.GET("/chaos", listAdminChaos)
+	admin.POST("/chaos/faults", enableAdminChaos)
+	admin.DELETE("/chaos/faults/:name", disableAdminChaos)
+
+	// Snapshot export and warm-up
+	admin.GET("/snapshot", exportSnapshot)
+	admin.POST("/warmup", platform.DecompressRequestMiddleware(maxWarmupBytes), warmupSessions)
+}
+
+// logTokenAuthChange logs and audits a change to token authentication and
+// responds with the new status
+func logTokenAuthChange(c *gin.Context, status TokenAuthStatus, action string) {
+	fields := map[string]interface{}{"enabled": status.Enabled}
+	if status.ReEnableAt != nil {
+		fields["re_enable_at"] = status.ReEnableAt.Format(time.RFC3339)
+	}
+	if status.Enabled {
+		logger.Info(c.Request.Context(), "Token authentication toggled", fields)
+	} else {
+		// Every cache request fails until it is switched back on
+		logger.Warn(c.Request.Context(), "Token authentication toggled", fields)
+	}
+	platform.RecordAudit(c, action, fields)
+
+	c.JSON(http.StatusOK, status)
+}
+
+// setTokenAuth turns token authentication on or off explicitly, so a
+// repeated request can't flip it back the way POST /admin/token does
+func setTokenAuth(c *gin.Context) {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Enabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "enabled is required"})
+		return
+	}
+	logTokenAuthChange(c, tokenAuth.Set(*req.Enabled, tokenReEnableAfter()), "token_auth.set")
+}
+
+// getAdminStats reports live sessions, evictions by reason and, for the
+// in-memory backend, occupancy against its bounds
+func getAdminStats(c *gin.Context) {
+	ctx := c.Request.Context()
+	all, err := sessions.List(ctx)
+	if err != nil {
+		logger.Error(ctx, "Failed to list sessions from store", map[string]interface{}{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
+	}
+
+	counts, last := evictions.Snapshot()
+	stats := gin.H{
+		"backend":       platform.GetEnv("CACHE_BACKEND", "memory"),
+		"sessions":      len(all),
+		"evictions":     counts,
+		"last_eviction": last,
+		"token_auth":    tokenAuth.Status(),
+	}
+	if memoryBackend != nil {
+		stats["memory"] = memoryBackend.Stats()
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// The admin chaos endpoints drive the same controller as /chaos, so the
+// page works with INSTABOOK_ADMIN_TOKEN alone. They are off unless
+// CHAOS_ENABLED=true, like /chaos.
+func chaosEnabled(c *gin.Context) bool {
+	if config.Get("CHAOS_ENABLED") != "true" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chaos is disabled; set CHAOS_ENABLED=true"})
+		return false
+	}
+	return true
+}
+
+func listAdminChaos(c *gin.Context) {
+	enabled := config.Get("CHAOS_ENABLED") == "true"
+	faults := []Fault{}
+	if enabled {
+		faults = chaos.List()
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": enabled, "faults": faults})
+}
+
+func enableAdminChaos(c *gin.Context) {
+	if !chaosEnabled(c) {
+		return
+	}
+	var f Fault
+	if err := c.ShouldBindJSON(&f); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fault"})
+		return
+	}
+	f.Source = "admin"
+	if err := chaos.Enable(f); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	platform.RecordAudit(c, "chaos.enable", map[string]interface{}{"name": f.Name, "type": f.Type, "route": f.Route})
+	c.JSON(http.StatusCreated, gin.H{"faults": chaos.List()})
+}
+
+func disableAdminChaos(c *gin.Context) {
+	if !chaosEnabled(c) {
+		return
+	}
+	if !chaos.Disable(c.Param("name")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Fault not found"})
+		return
+	}
+	platform.RecordAudit(c, "chaos.disable", map[string]interface{}{"name": c.Param("name")})
+	c.Status(http.StatusNoContent)
+}
+
+// adminHTML is the admin page: tabs over the JSON APIs above. The admin
+// token, when one is needed, is kept in sessionStorage.
+const adminHTML = `<!DOCTYPE html>
+<html>
+<head>
+    <title>Instabook Cache Admin</title>
+    <style>
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, sans-serif;
+            max-width: 960px;
+            margin: 40px auto;
+            padding: 20px;
+            background: #f5f5f5;
+        }
+        .container {
+            background: white;
+            padding: 30px;
+            border-radius: 10px;
+            box-shadow: 0 2px 10px rgba(0,0,0,0.1);
+        }
+        h1 { color: #333; margin: 0 0 20px; }
+        h2 { font-size: 18px; color: #333; }
+        nav { display: flex; gap: 4px; border-bottom: 1px solid #ddd; margin-bottom: 20px; }
+        nav a {
+            padding: 10px 16px;
+            color: #555;
+            text-decoration: none;
+            border-radius: 6px 6px 0 0;
+        }
+        nav a.active { background: #007bff; color: white; }
+        .tab { display: none; }
+        .tab.active { display: block; }
+        .status {
+            padding: 15px 20px;
+            border-radius: 8px;
+            margin-bottom: 20px;
+            font-size: 18px;
+            font-weight: 500;
+        }
+        .enabled { background: #d4edda; color: #155724; border: 1px solid #c3e6cb; }
+        .disabled { background: #f8d7da; color: #721c24; border: 1px solid #f5c6cb; }
+        button {
+            padding: 8px 16px;
+            font-size: 14px;
+            cursor: pointer;
+            border: none;
+            border-radius: 6px;
+            background: #007bff;
+            color: white;
+        }
+        button:hover { background: #0056b3; }
+        button.danger { background: #dc3545; }
+        input, select, textarea { padding: 7px; font-size: 14px; border: 1px solid #ccc; border-radius: 4px; }
+        textarea { width: 100%; box-sizing: border-box; font-family: monospace; }
+        table { width: 100%; border-collapse: collapse; font-size: 14px; margin: 10px 0; }
+        th, td { text-align: left; padding: 6px 8px; border-bottom: 1px solid #eee; }
+        .row { display: flex; gap: 8px; align-items: center; margin: 10px 0; flex-wrap: wrap; }
+        .info { padding: 12px; background: #e9ecef; border-radius: 6px; font-size: 14px; color: #666; }
+        .error { color: #721c24; min-height: 20px; margin-bottom: 10px; }
+        pre { background: #f8f9fa; padding: 10px; border-radius: 6px; overflow-x: auto; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>Instabook Cache Admin</h1>
+        <div class="row">
+            <label for="adminToken">Admin token</label>
+            <input id="adminToken" type="password" placeholder="INSTABOOK_ADMIN_TOKEN, if set">
+            <button onclick="saveAdminToken()">Use</button>
+        </div>
+        <div id="error" class="error"></div>
+        <nav>
+            <a href="#tokens" data-tab="tokens">Tokens</a>
+            <a href="#sessions" data-tab="sessions">Sessions</a>
+            <a href="#evictions" data-tab="evictions">Evictions</a>
+            <a href="#chaos" data-tab="chaos">Chaos</a>
+        </nav>
+
+        <section id="tokens" class="tab">
+            <div id="status" class="status">Loading...</div>
+            <div class="row">
+                <button onclick="setTokenAuth(true)">Enable</button>
+                <button class="danger" onclick="setTokenAuth(false)">Disable</button>
+            </div>
+            <div class="info">
+                When enabled, all /cache/* endpoints require a valid Bearer token.
+                When disabled, all /cache/* endpoints return 401 Unauthorized.
+            </div>
+            <h2>API tokens</h2>
+            <table>
+                <thead><tr><th>ID</th><th>Name</th><th>Scope</th><th>Tenants</th><th>Created</th><th>Revoked</th><th></th></tr></thead>
+                <tbody id="tokenRows"></tbody>
+            </table>
+            <div class="row">
+                <input id="tokenName" placeholder="Name">
+                <select id="tokenScope"><option>read</option><option>read-write</option></select>
+                <input id="tokenTenants" placeholder="Tenants, comma separated">
+                <button onclick="createToken()">Create token</button>
+            </div>
+            <pre id="tokenSecret" hidden></pre>
+        </section>
+
+        <section id="sessions" class="tab">
+            <div class="row">
+                <input id="sessionUser" placeholder="User ID">
+                <input id="sessionStatus" placeholder="Status">
+                <button onclick="loadSessions(0)">Search</button>
+                <button onclick="loadSessions(sessionOffset - sessionLimit)">Previous</button>
+                <button onclick="loadSessions(sessionOffset + sessionLimit)">Next</button>
+                <span id="sessionRange"></span>
+            </div>
+            <table>
+                <thead><tr><th>ID</th><th>Tenant</th><th>User</th><th>Booking</th><th>Status</th><th>Created</th><th>Expires</th></tr></thead>
+                <tbody id="sessionRows"></tbody>
+            </table>
+        </section>
+
+        <section id="evictions" class="tab">
+            <div class="row"><button onclick="loadStats()">Refresh</button></div>
+            <table><tbody id="statRows"></tbody></table>
+        </section>
+
+        <section id="chaos" class="tab">
+            <div id="chaosState" class="info"></div>
+            <table>
+                <thead><tr><th>Name</th><th>Type</th><th>Route</th><th>Probability</th><th>Source</th><th>Expires</th><th></th></tr></thead>
+                <tbody id="faultRows"></tbody>
+            </table>
+            <h2>Enable a fault</h2>
+            <textarea id="faultJSON" rows="4">{"name": "slow-reads", "type": "latency", "route": "GET /cache/session/:id", "delay_ms": 500, "duration": "5m"}</textarea>
+            <div class="row"><button onclick="enableFault()">Enable</button></div>
+        </section>
+    </div>
+    <script>
+        const sessionLimit = 50;
+        let sessionOffset = 0;
+
+        document.getElementById('adminToken').value = sessionStorage.getItem('adminToken') || '';
+
+        function saveAdminToken() {
+            sessionStorage.setItem('adminToken', document.getElementById('adminToken').value);
+            showTab();
+        }
+
+        async function api(method, path, body) {
+            const headers = {};
+            const token = sessionStorage.getItem('adminToken');
+            if (token) {
+                headers['Authorization'] = 'Bearer ' + token;
+            }
+            if (body !== undefined) {
+                headers['Content-Type'] = 'application/json';
+            }
+            const resp = await fetch(path, { method, headers, body: body === undefined ? undefined : JSON.stringify(body) });
+            const data = resp.status === 204 ? null : await resp.json();
+            if (!resp.ok) {
+                throw new Error((data && data.error) || resp.statusText);
+            }
+            return data;
+        }
+
+        function fail(e) {
+            document.getElementById('error').textContent = e.message;
+        }
+
+        // Rows are built with textContent so session data can't inject markup
+        function fillRows(id, rows) {
+            const body = document.getElementById(id);
+            body.replaceChildren();
+            for (const cells of rows) {
+                const tr = document.createElement('tr');
+                for (const cell of cells) {
+                    const td = document.createElement('td');
+                    if (cell instanceof Node) {
+                        td.appendChild(cell);
+                    } else {
+                        td.textContent = cell === undefined || cell === null ? '' : cell;
+                    }
+                    tr.appendChild(td);
+                }
+                body.appendChild(tr);
+            }
+        }
+
+        function button(label, onclick) {
+            const b = document.createElement('button');
+            b.className = 'danger';
+            b.textContent = label;
+            b.onclick = onclick;
+            return b;
+        }
+
+        function renderStatus(data) {
+            const statusEl = document.getElementById('status');
+            if (data.enabled) {
+                statusEl.className = 'status enabled';
+                statusEl.textContent = 'Token Authentication: ENABLED';
+            } else {
+                statusEl.className = 'status disabled';
+                statusEl.textContent = 'Token Authentication: DISABLED since ' + data.disabled_since + ' (all cache requests will fail with 401)';
+                if (data.re_enable_at) {
+                    statusEl.textContent += ', re-enabling at ' + data.re_enable_at;
+                }
+            }
+        }
+
+        async function loadTokens() {
+            renderStatus(await api('GET', '/admin/token'));
+            const tokens = await api('GET', '/admin/tokens');
+            fillRows('tokenRows', tokens.map(t => [
+                t.id, t.name, t.scope, (t.tenants || []).join(', '), t.created_at, t.revoked_at,
+                t.revoked_at ? '' : button('Revoke', () => revokeToken(t.id)),
+            ]));
+        }
+
+        async function setTokenAuth(enabled) {
+            try {
+                renderStatus(await api('PUT', '/admin/token', { enabled }));
+            } catch (e) {
+                fail(e);
+            }
+        }
+
+        async function createToken() {
+            const tenants = document.getElementById('tokenTenants').value.split(',').map(s => s.trim()).filter(s => s);
+            try {
+                const created = await api('POST', '/admin/tokens', {
+                    name: document.getElementById('tokenName').value,
+                    scope: document.getElementById('tokenScope').value,
+                    tenants,
+                });
+                const secret = document.getElementById('tokenSecret');
+                secret.hidden = false;
+                secret.textContent = 'Secret for ' + created.token.id + ' (shown once): ' + created.secret;
+                await loadTokens();
+            } catch (e) {
+                fail(e);
+            }
+        }
+
+        async function revokeToken(id) {
+            try {
+                await api('DELETE', '/admin/tokens/' + encodeURIComponent(id));
+                await loadTokens();
+            } catch (e) {
+                fail(e);
+            }
+        }
+
+        async function loadSessions(offset) {
+            sessionOffset = Math.max(offset || 0, 0);
+            const params = new URLSearchParams({ limit: sessionLimit, offset: sessionOffset });
+            const user = document.getElementById('sessionUser').value;
+            const status = document.getElementById('sessionStatus').value;
+            if (user) params.set('user_id', user);
+            if (status) params.set('status', status);
+            const page = await api('GET', '/admin/sessions?' + params);
+            document.getElementById('sessionRange').textContent =
+                (page.total ? page.offset + 1 : 0) + '-' + (page.offset + page.items.length) + ' of ' + page.total;
+            fillRows('sessionRows', page.items.map(s => [
+                s.id, s.tenant || 'default', s.user_id, s.booking_id, s.status, s.created_at, s.expires_at,
+            ]));
+        }
+
+        async function loadStats() {
+            const stats = await api('GET', '/admin/stats');
+            const rows = [['Backend', stats.backend], ['Live sessions', stats.sessions]];
+            for (const [reason, count] of Object.entries(stats.evictions)) {
+                rows.push(['Evicted (' + reason + ')', count]);
+            }
+            rows.push(['Last eviction', stats.last_eviction || 'never']);
+            if (stats.memory) {
+                rows.push(['Entries / max', stats.memory.entries + ' / ' + (stats.memory.max_entries || 'unbounded')]);
+                rows.push(['Bytes used', stats.memory.used_bytes]);
+                rows.push(['Soft / hard limit', (stats.memory.soft_limit_bytes || 'none') + ' / ' + (stats.memory.hard_limit_bytes || 'none')]);
+            }
+            fillRows('statRows', rows);
+        }
+
+        async function loadChaos() {
+            const state = await api('GET', '/admin/chaos');
+            document.getElementById('chaosState').textContent = state.enabled
+                ? state.faults.length + ' fault(s) enabled'
+                : 'Chaos is disabled; set CHAOS_ENABLED=true to inject faults';
+            fillRows('faultRows', state.faults.map(f => [
+                f.name, f.type, f.route || 'all', f.probability, f.source, f.expires_at,
+                button('Disable', () => disableFault(f.name)),
+            ]));
+        }
+
+        async function enableFault() {
+            try {
+                await api('POST', '/admin/chaos/faults', JSON.parse(document.getElementById('faultJSON').value));
+                await loadChaos();
+            } catch (e) {
+                fail(e);
+            }
+        }
+
+        async function disableFault(name) {
+            try {
+                await api('DELETE', '/admin/chaos/faults/' + encodeURIComponent(name));
+                await loadChaos();
+            } catch (e) {
+                fail(e);
+            }
+        }
+
+        const loaders = { tokens: loadTokens, sessions: () => loadSessions(sessionOffset), evictions: loadStats, chaos: loadChaos };
+
+        async function showTab() {
+            const tab = loaders[location.hash.slice(1)] ? location.hash.slice(1) : 'tokens';
+            for (const el of document.querySelectorAll('.tab')) {
+                el.classList.toggle('active', el.id === tab);
+            }
+            for (const el of document.querySelectorAll('nav a')) {
+                el.classList.toggle('active', el.dataset.tab === tab);
+            }
+            document.getElementById('error').textContent = '';
+            try {
+                await loaders[tab]();
+            } catch (e) {
+                fail(e);
+            }
+        }
+
+        window.addEventListener('hashchange', showTab);
+        showTab();
+    </script>
+</body>
+</html>`
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var tokenEnabledGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "instabook_cache_token_enabled",
+		Help: "1 while API token authentication is enabled, 0 while every cache request is rejected",
+	},
+)
+
+// TokenAuthStatus is the token authentication state reported by
+// /admin/token, /admin/stats and /readyz
+type TokenAuthStatus struct {
+	Enabled       bool       `json:"enabled"`
+	DisabledSince *time.Time `json:"disabled_since,omitempty"`
+	// ReEnableAt is when authentication turns itself back on, when
+	// TOKEN_AUTH_REENABLE_AFTER is set
+	ReEnableAt *time.Time `json:"re_enable_at,omitempty"`
+}
+
+// TokenAuthState is the admin toggle for API token authentication. While
+// it is disabled every cache request is rejected with a 401.
+type TokenAuthState struct {
+	mu         sync.Mutex
+	enabled    bool
+	disabledAt time.Time
+	reEnableAt time.Time
+	timer      *time.Timer
+}
+
+var tokenAuth = NewTokenAuthState()
+
+func NewTokenAuthState() *TokenAuthState {
+	tokenEnabledGauge.Set(1)
+	return &TokenAuthState{enabled: true}
+}
+
+func (s *TokenAuthState) Enabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enabled
+}
+
+func (s *TokenAuthState) Status() TokenAuthStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statusLocked()
+}
+
+func (s *TokenAuthState) statusLocked() TokenAuthStatus {
+	status := TokenAuthStatus{Enabled: s.enabled}
+	if !s.enabled {
+		disabledAt := s.disabledAt
+		status.DisabledSince = &disabledAt
+		if !s.reEnableAt.IsZero() {
+			reEnableAt := s.reEnableAt
+			status.ReEnableAt = &reEnableAt
+		}
+	}
+	return status
+}
+
+// Toggle flips authentication on or off. Disabling it schedules it to be
+// re-enabled after reEnableAfter, unless that is zero.
+func (s *TokenAuthState) Toggle(reEnableAfter time.Duration) TokenAuthStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.enabled {
+		s.disableLocked(reEnableAfter)
+	} else {
+		s.enableLocked()
+	}
+	return s.statusLocked()
+}
+
+// Set turns authentication on or off, leaving it as it is when it already
+// is. Disabling it schedules it to be re-enabled as Toggle does.
+func (s *TokenAuthState) Set(enabled bool, reEnableAfter time.Duration) TokenAuthStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case enabled && !s.enabled:
+		s.enableLocked()
+	case !enabled && s.enabled:
+		s.disableLocked(reEnableAfter)
+	}
+	return s.statusLocked()
+}
+
+func (s *TokenAuthState) disableLocked(reEnableAfter time.Duration) {
+	s.enabled = false
+	s.disabledAt = time.Now().UTC()
+	if reEnableAfter > 0 {
+		s.reEnableAt = s.disabledAt.Add(reEnableAfter)
+		s.timer = time.AfterFunc(reEnableAfter, s.expire)
+	}
+	tokenEnabledGauge.Set(0)
+}
+
+func (s *TokenAuthState) enableLocked() {
+	s.enabled = true
+	s.disabledAt = time.Time{}
+	s.reEnableAt = time.Time{}
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	tokenEnabledGauge.Set(1)
+}
+
+// expire re-enables authentication once TOKEN_AUTH_REENABLE_AFTER has
+// passed since it was disabled
+func (s *TokenAuthState) expire() {
+	s.mu.Lock()
+	if s.enabled || s.reEnableAt.IsZero() || time.Now().Before(s.reEnableAt) {
+		s.mu.Unlock()
+		return
+	}
+	disabledFor := time.Since(s.disabledAt)
+	s.enableLocked()
+	s.mu.Unlock()
+
+	logger.Warn(context.Background(), "Token authentication re-enabled automatically", map[string]interface{}{
+		"disabled_for_s": int(disabledFor.Seconds()),
+	})
+}
+
+// tokenReEnableAfter reads TOKEN_AUTH_REENABLE_AFTER (default 0, never).
+// It is re-read on every toggle, so config reloads apply to the next one.
+func tokenReEnableAfter() time.Duration {
+	d, err := time.ParseDuration(config.Get("TOKEN_AUTH_REENABLE_AFTER"))
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
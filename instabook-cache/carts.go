@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+// Carts are stored as sessions, so they get the same tenancy, replication,
+// journaling and eviction as everything else in the cache. A cart's
+// session ID is cartSessionPrefix plus the cart ID, its status is
+// cartStatus and its data is the JSON of cartContents.
+const (
+	cartSessionPrefix = "cart:"
+	cartStatus        = "cart"
+	// maxCartQuantity bounds the quantity of one product in a cart
+	maxCartQuantity = 100
+)
+
+// Cart settings, read at startup
+var (
+	cartTTL      = 24 * time.Hour
+	maxCartItems = 50
+)
+
+var errNotACart = errors.New("session is not a cart")
+
+var cartOperations = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "instabook_cache_cart_operations_total",
+		Help: "Number of cart operations by operation (get, add_item, remove_item, clear) and result",
+	},
+	[]string{"operation", "result"},
+)
+
+// CartItem is one product line of a cart
+type CartItem struct {
+	ProductID string    `json:"product_id"`
+	Quantity  int       `json:"quantity"`
+	AddedAt   time.Time `json:"added_at"`
+}
+
+// cartContents is what a cart session's data holds
+type cartContents struct {
+	Items []CartItem `json:"items"`
+}
+
+// Cart is the API view of a cart session
+type Cart struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Items     []CartItem `json:"items"`
+	ItemCount int        `json:"item_count"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
+// cartSettingsFromEnv reads CART_TTL (default 24h) and CART_MAX_ITEMS
+// (default 50 distinct products)
+func cartSettingsFromEnv() {
+	if d, err := time.ParseDuration(platform.GetEnv("CART_TTL", "")); err == nil && d > 0 {
+		cartTTL = d
+	}
+	if n, err := strconv.Atoi(platform.GetEnv("CART_MAX_ITEMS", "")); err == nil && n > 0 {
+		maxCartItems = n
+	}
+}
+
+func cartSessionID(cartID string) string {
+	return cartSessionPrefix + cartID
+}
+
+func decodeCart(session *Session) (cartContents, error) {
+	var contents cartContents
+	if session.Status != cartStatus {
+		return contents, errNotACart
+	}
+	if session.Data == "" {
+		return contents, nil
+	}
+	if err := json.Unmarshal([]byte(session.Data), &contents); err != nil {
+		return contents, fmt.Errorf("%w: %v", errNotACart, err)
+	}
+	return contents, nil
+}
+
+func encodeCart(session *Session, contents cartContents) {
+	if contents.Items == nil {
+		contents.Items = []CartItem{}
+	}
+	data, _ := json.Marshal(contents)
+	session.Data = string(data)
+	// Every change keeps the cart alive for another cartTTL
+	session.TTLSeconds = int(cartTTL.Seconds())
+	session.ExpiresAt = time.Now().Add(cartTTL)
+}
+
+func cartView(cartID string, session *Session, contents cartContents) Cart {
+	cart := Cart{
+		ID:        cartID,
+		UserID:    session.UserID,
+		Items:     contents.Items,
+		UpdatedAt: session.UpdatedAt,
+		ExpiresAt: session.ExpiresAt,
+	}
+	if cart.Items == nil {
+		cart.Items = []CartItem{}
+	}
+	if cart.UpdatedAt.IsZero() {
+		cart.UpdatedAt = session.CreatedAt
+	}
+	for _, item := range cart.Items {
+		cart.ItemCount += item.Quantity
+	}
+	return cart
+}
+
+// getCart returns a cart; a missing cart is a 404
+func getCart(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+	id := c.Param("id")
+
+	session, err := sessions.Get(ctx, cartSessionID(id))
+	var contents cartContents
+	if err == nil {
+		contents, err = decodeCart(session)
+	}
+	if errors.Is(err, ErrSessionNotFound) || errors.Is(err, errNotACart) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+		cartOperations.WithLabelValues("get", "not_found").Inc()
+		recordRequest("GET", "/cache/cart/:id", http.StatusNotFound, start)
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to read cart from store", map[string]interface{}{
+			"cart_id": id,
+			"error":   err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read cart"})
+		cartOperations.WithLabelValues("get", "error").Inc()
+		recordRequest("GET", "/cache/cart/:id", http.StatusInternalServerError, start)
+		return
+	}
+
+	c.JSON(http.StatusOK, cartView(id, session, contents))
+	cartOperations.WithLabelValues("get", "ok").Inc()
+	recordRequest("GET", "/cache/cart/:id", http.StatusOK, start)
+}
+
+// addCartItem adds quantity of a product to a cart, creating the cart on
+// its first item. Adding a product already in the cart raises its quantity.
+func addCartItem(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+	id := c.Param("id")
+
+	var req struct {
+		UserID    string `json:"user_id"`
+		ProductID string `json:"product_id"`
+		Quantity  int    `json:"quantity"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if isTooLarge(err) {
+			respondTooLarge(c)
+			recordRequest("POST", "/cache/cart/:id/items", http.StatusRequestEntityTooLarge, start)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cart item"})
+		recordRequest("POST", "/cache/cart/:id/items", http.StatusBadRequest, start)
+		return
+	}
+	var fields []FieldError
+	if req.ProductID == "" {
+		fields = append(fields, FieldError{Field: "product_id", Message: "is required"})
+	}
+	if req.Quantity < 1 || req.Quantity > maxCartQuantity {
+		fields = append(fields, FieldError{Field: "quantity", Message: fmt.Sprintf("must be between 1 and %d", maxCartQuantity)})
+	}
+	if len(fields) > 0 {
+		respondInvalid(c, fields)
+		cartOperations.WithLabelValues("add_item", "invalid").Inc()
+		recordRequest("POST", "/cache/cart/:id/items", http.StatusUnprocessableEntity, start)
+		return
+	}
+
+	// Checks that fail inside the update leave the cart as it was
+	var rejected error
+	add := func(s *Session) {
+		contents, err := decodeCart(s)
+		if err != nil {
+			rejected = err
+			return
+		}
+		if req.UserID != "" && req.UserID != s.UserID {
+			rejected = errors.New("cart belongs to another user")
+			return
+		}
+		for i := range contents.Items {
+			if contents.Items[i].ProductID != req.ProductID {
+				continue
+			}
+			if contents.Items[i].Quantity+req.Quantity > maxCartQuantity {
+				rejected = fmt.Errorf("quantity of product %s would exceed %d", req.ProductID, maxCartQuantity)
+				return
+			}
+			contents.Items[i].Quantity += req.Quantity
+			encodeCart(s, contents)
+			return
+		}
+		if len(contents.Items) >= maxCartItems {
+			rejected = fmt.Errorf("cart already holds %d products", maxCartItems)
+			return
+		}
+		contents.Items = append(contents.Items, CartItem{ProductID: req.ProductID, Quantity: req.Quantity, AddedAt: time.Now()})
+		encodeCart(s, contents)
+	}
+
+	status := http.StatusOK
+	session, err := sessions.Update(ctx, cartSessionID(id), add)
+	if errors.Is(err, ErrSessionNotFound) {
+		if req.UserID == "" {
+			respondInvalid(c, []FieldError{{Field: "user_id", Message: "is required to start a cart"}})
+			cartOperations.WithLabelValues("add_item", "invalid").Inc()
+			recordRequest("POST", "/cache/cart/:id/items", http.StatusUnprocessableEntity, start)
+			return
+		}
+		created := &Session{ID: cartSessionID(id), UserID: req.UserID, Status: cartStatus, CreatedAt: time.Now()}
+		encodeCart(created, cartContents{Items: []CartItem{{ProductID: req.ProductID, Quantity: req.Quantity, AddedAt: time.Now()}}})
+		session, err = sessions.Create(ctx, created)
+		status = http.StatusCreated
+		if errors.Is(err, ErrSessionExists) {
+			// Another request started the cart first; add to that one
+			session, err = sessions.Update(ctx, cartSessionID(id), add)
+			status = http.StatusOK
+		}
+	}
+	if rejected != nil {
+		logger.Warn(ctx, "Rejected cart item", map[string]interface{}{
+			"cart_id":    id,
+			"product_id": req.ProductID,
+			"error":      rejected.Error(),
+		})
+		c.JSON(http.StatusConflict, gin.H{"error": rejected.Error()})
+		cartOperations.WithLabelValues("add_item", "conflict").Inc()
+		recordRequest("POST", "/cache/cart/:id/items", http.StatusConflict, start)
+		return
+	}
+	if errors.Is(err, ErrInsufficientStorage) {
+		logger.Warn(ctx, "Session cache is full, rejecting write", map[string]interface{}{
+			"cart_id": id,
+		})
+		respondInsufficientStorage(c)
+		cartOperations.WithLabelValues("add_item", "error").Inc()
+		recordRequest("POST", "/cache/cart/:id/items", http.StatusInsufficientStorage, start)
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to add item to cart", map[string]interface{}{
+			"cart_id": id,
+			"error":   err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
+		cartOperations.WithLabelValues("add_item", "error").Inc()
+		recordRequest("POST", "/cache/cart/:id/items", http.StatusInternalServerError, start)
+		return
+	}
+
+	contents, _ := decodeCart(session)
+	logger.Info(ctx, "Added item to cart", map[string]interface{}{
+		"cart_id":    id,
+		"user_id":    session.UserID,
+		"product_id": req.ProductID,
+		"quantity":   req.Quantity,
+	})
+	c.JSON(status, cartView(id, session, contents))
+	cartOperations.WithLabelValues("add_item", "ok").Inc()
+	recordRequest("POST", "/cache/cart/:id/items", status, start)
+}
+
+// removeCartItem removes a product from a cart, or with ?quantity= lowers
+// its quantity, removing it when none is left
+func removeCartItem(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+	id := c.Param("id")
+	productID := c.Param("product_id")
+
+	quantity := 0
+	if v := c.Query("quantity"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quantity"})
+			recordRequest("DELETE", "/cache/cart/:id/items/:product_id", http.StatusBadRequest, start)
+			return
+		}
+		quantity = n
+	}
+
+	var missing error
+	session, err := sessions.Update(ctx, cartSessionID(id), func(s *Session) {
+		contents, err := decodeCart(s)
+		if err != nil {
+			missing = err
+			return
+		}
+		for i := range contents.Items {
+			if contents.Items[i].ProductID != productID {
+				continue
+			}
+			if quantity > 0 && quantity < contents.Items[i].Quantity {
+				contents.Items[i].Quantity -= quantity
+			} else {
+				contents.Items = append(contents.Items[:i], contents.Items[i+1:]...)
+			}
+			encodeCart(s, contents)
+			return
+		}
+		missing = errors.New("product is not in the cart")
+	})
+	if errors.Is(err, ErrSessionNotFound) || errors.Is(missing, errNotACart) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+		cartOperations.WithLabelValues("remove_item", "not_found").Inc()
+		recordRequest("DELETE", "/cache/cart/:id/items/:product_id", http.StatusNotFound, start)
+		return
+	}
+	if missing != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not in cart", "product_id": productID})
+		cartOperations.WithLabelValues("remove_item", "not_found").Inc()
+		recordRequest("DELETE", "/cache/cart/:id/items/:product_id", http.StatusNotFound, start)
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to remove item from cart", map[string]interface{}{
+			"cart_id":    id,
+			"product_id": productID,
+			"error":      err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
+		cartOperations.WithLabelValues("remove_item", "error").Inc()
+		recordRequest("DELETE", "/cache/cart/:id/items/:product_id", http.StatusInternalServerError, start)
+		return
+	}
+
+	contents, _ := decodeCart(session)
+	logger.Info(ctx, "Removed item from cart", map[string]interface{}{
+		"cart_id":    id,
+		"product_id": productID,
+	})
+	c.JSON(http.StatusOK, cartView(id, session, contents))
+	cartOperations.WithLabelValues("remove_item", "ok").Inc()
+	recordRequest("DELETE", "/cache/cart/:id/items/:product_id", http.StatusOK, start)
+}
+
+// clearCart deletes a cart, which checkout does once the order is placed
+func clearCart(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+	id := c.Param("id")
+
+	err := sessions.Delete(ctx, cartSessionID(id))
+	if errors.Is(err, ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+		cartOperations.WithLabelValues("clear", "not_found").Inc()
+		recordRequest("DELETE", "/cache/cart/:id", http.StatusNotFound, start)
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to delete cart from store", map[string]interface{}{
+			"cart_id": id,
+			"error":   err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cart"})
+		cartOperations.WithLabelValues("clear", "error").Inc()
+		recordRequest("DELETE", "/cache/cart/:id", http.StatusInternalServerError, start)
+		return
+	}
+
+	logger.Info(ctx, "Cleared cart", map[string]interface{}{
+		"cart_id": id,
+	})
+	c.Status(http.StatusNoContent)
+	cartOperations.WithLabelValues("clear", "ok").Inc()
+	recordRequest("DELETE", "/cache/cart/:id", http.StatusNoContent, start)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+var (
+	coalescedRequests = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "instabook_cache_coalesced_requests_total",
+			Help: "Number of session lookups that shared an in-flight lookup for the same ID",
+		},
+	)
+	negativeCacheHits = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "instabook_cache_negative_cache_hits_total",
+			Help: "Number of session lookups answered from the negative cache",
+		},
+	)
+)
+
+// inflightGet is a lookup that concurrent callers for the same ID wait on
+type inflightGet struct {
+	done    chan struct{}
+	session *Session
+	err     error
+	source  string
+}
+
+// CoalescingStore wraps a Store so concurrent lookups for the same session
+// share one call to the underlying store, and IDs that were just found
+// missing are answered without touching it again for a short while
+type CoalescingStore struct {
+	Store
+	negativeTTL time.Duration
+
+	mu       sync.Mutex
+	inflight map[string]*inflightGet
+	missing  map[string]time.Time
+}
+
+// NewCoalescingStoreFromEnv reads NEGATIVE_CACHE_TTL (default 2s; 0 disables
+// negative caching but keeps coalescing)
+func NewCoalescingStoreFromEnv(inner Store) *CoalescingStore {
+	ttl, err := time.ParseDuration(platform.GetEnv("NEGATIVE_CACHE_TTL", "2s"))
+	if err != nil || ttl < 0 {
+		ttl = 2 * time.Second
+	}
+	return &CoalescingStore{
+		Store:       inner,
+		negativeTTL: ttl,
+		inflight:    make(map[string]*inflightGet),
+		missing:     make(map[string]time.Time),
+	}
+}
+
+func (s *CoalescingStore) Get(ctx context.Context, id string) (*Session, error) {
+	s.mu.Lock()
+	if until, ok := s.missing[id]; ok {
+		if time.Now().Before(until) {
+			s.mu.Unlock()
+			negativeCacheHits.Inc()
+			recordLookupSource(ctx, sourceNegative)
+			return nil, ErrSessionNotFound
+		}
+		delete(s.missing, id)
+	}
+	if call, ok := s.inflight[id]; ok {
+		s.mu.Unlock()
+		coalescedRequests.Inc()
+		select {
+		case <-call.done:
+			recordLookupSource(ctx, call.source)
+			return call.session, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &inflightGet{done: make(chan struct{})}
+	s.inflight[id] = call
+	s.mu.Unlock()
+
+	// Detach from the first caller's cancellation so one client giving up
+	// doesn't fail every request waiting on it
+	lookupCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	lookupCtx = withLookupTrace(lookupCtx)
+	call.session, call.err = s.Store.Get(lookupCtx, id)
+	call.source = lookupSource(lookupCtx)
+	cancel()
+
+	s.mu.Lock()
+	delete(s.inflight, id)
+	if errors.Is(call.err, ErrSessionNotFound) && s.negativeTTL > 0 {
+		s.missing[id] = time.Now().Add(s.negativeTTL)
+		s.sweepMissing()
+	}
+	s.mu.Unlock()
+	close(call.done)
+
+	recordLookupSource(ctx, call.source)
+	return call.session, call.err
+}
+
+// sweepMissing drops stale negative entries once the map gets large;
+// callers hold mu
+func (s *CoalescingStore) sweepMissing() {
+	if len(s.missing) < 10000 {
+		return
+	}
+	now := time.Now()
+	for id, until := range s.missing {
+		if now.After(until) {
+			delete(s.missing, id)
+		}
+	}
+}
+
+// forget clears a negative entry once the session is written
+func (s *CoalescingStore) forget(id string) {
+	s.mu.Lock()
+	delete(s.missing, id)
+	s.mu.Unlock()
+}
+
+func (s *CoalescingStore) Put(ctx context.Context, session *Session) error {
+	err := s.Store.Put(ctx, session)
+	s.forget(session.ID)
+	return err
+}
+
+func (s *CoalescingStore) Create(ctx context.Context, session *Session) (*Session, error) {
+	created, err := s.Store.Create(ctx, session)
+	s.forget(session.ID)
+	return created, err
+}
+
+func (s *CoalescingStore) Close() error {
+	if closer, ok := s.Store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
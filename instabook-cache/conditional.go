@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionETag is a strong validator over the session's JSON, so every
+// replica computes the same tag for the same content
+func sessionETag(session *Session) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// lastModified is when the session was last written
+func (s *Session) lastModified() time.Time {
+	if s.UpdatedAt.IsZero() {
+		return s.CreatedAt
+	}
+	return s.UpdatedAt
+}
+
+// setValidators sets ETag and Last-Modified for the session and reports
+// whether the request's conditional headers say the caller's copy is
+// current. If-None-Match takes precedence over If-Modified-Since.
+func setValidators(c *gin.Context, session *Session) (notModified bool, err error) {
+	etag, err := sessionETag(session)
+	if err != nil {
+		return false, err
+	}
+	modified := session.lastModified().UTC()
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", modified.Format(http.TimeFormat))
+
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag), nil
+	}
+	if ims := c.GetHeader("If-Modified-Since"); ims != "" {
+		since, err := http.ParseTime(ims)
+		// Last-Modified only has second precision
+		return err == nil && !modified.Truncate(time.Second).After(since), nil
+	}
+	return false, nil
+}
+
+// etagMatches applies the weak comparison If-None-Match uses
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
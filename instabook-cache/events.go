@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"platform"
+)
+
+// Session event operations queued by instabook
+const (
+	EventCreate = "create"
+	EventUpdate = "update"
+	EventDelete = "delete"
+)
+
+// SessionEvent is a session write that instabook queued instead of sending
+// to the cache directly. ID doubles as the Idempotency-Key for creates, so a
+// redelivered create is recognized rather than rejected as a duplicate.
+type SessionEvent struct {
+	ID        string    `json:"id"`
+	Op        string    `json:"op"`
+	SessionID string    `json:"session_id"`
+	Session   *Session  `json:"session,omitempty"`
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
+	// Tenant is the X-Tenant-ID to apply a queued event under; events
+	// received over HTTP use the request's header instead
+	Tenant string `json:"tenant,omitempty"`
+	// Trace is the context of the instabook request that queued the write
+	Trace platform.TraceCarrier `json:"trace,omitempty"`
+}
+
+var (
+	sessionEventsConsumed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "instabook_cache_session_events_total",
+			Help: "Number of queued session events consumed by result",
+		},
+		[]string{"op", "result"},
+	)
+	sessionEventsPending = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "instabook_cache_session_events_pending",
+			Help: "Number of session events received from the broker but not yet applied",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(sessionEventsConsumed)
+	prometheus.MustRegister(sessionEventsPending)
+}
+
+// permanentEventError marks events that will never apply, however often
+// they are retried, and belong in the dead letter queue
+type permanentEventError struct {
+	status int
+	err    error
+}
+
+func (e *permanentEventError) Error() string { return e.err.Error() }
+
+func permanent(status int, format string, args ...interface{}) error {
+	return &permanentEventError{status: status, err: fmt.Errorf(format, args...)}
+}
+
+// applySessionEvent applies a queued write through the normal store chain.
+// Deleting a missing session counts as applied so redeliveries are harmless.
+func applySessionEvent(ctx context.Context, event SessionEvent) error {
+	var err error
+	switch event.Op {
+	case EventCreate:
+		if event.Session == nil {
+			return permanent(http.StatusBadRequest, "missing session")
+		}
+		if fields := validateSession(*event.Session, true); len(fields) > 0 {
+			return permanent(http.StatusUnprocessableEntity, "session failed validation: %s %s", fields[0].Field, fields[0].Message)
+		}
+		session := *event.Session
+		session.CreatedAt = event.CreatedAt
+		session.IdempotencyKey = event.ID
+		var existing *Session
+		existing, err = sessions.Create(ctx, &session)
+		if errors.Is(err, ErrSessionExists) {
+			if existing.IdempotencyKey == event.ID {
+				return nil
+			}
+			return permanent(http.StatusConflict, "session %s already exists", event.SessionID)
+		}
+	case EventUpdate:
+		if event.Session == nil {
+			return permanent(http.StatusBadRequest, "missing session")
+		}
+		if fields := validateSession(*event.Session, false); len(fields) > 0 {
+			return permanent(http.StatusUnprocessableEntity, "session failed validation: %s %s", fields[0].Field, fields[0].Message)
+		}
+		req := event.Session
+		_, err = sessions.Update(ctx, event.SessionID, func(s *Session) {
+			s.UserID = req.UserID
+			s.BookingID = req.BookingID
+			s.Status = req.Status
+			s.Data = req.Data
+			if req.TTLSeconds > 0 {
+				s.TTLSeconds = req.TTLSeconds
+				s.ExpiresAt = time.Now().Add(time.Duration(req.TTLSeconds) * time.Second)
+			}
+		})
+		if errors.Is(err, ErrSessionNotFound) {
+			return permanent(http.StatusNotFound, "session %s not found", event.SessionID)
+		}
+	case EventDelete:
+		err = sessions.Delete(ctx, event.SessionID)
+		if errors.Is(err, ErrSessionNotFound) {
+			err = nil
+		}
+	default:
+		return permanent(http.StatusBadRequest, "unknown op %q", event.Op)
+	}
+	return err
+}
+
+// consumeSessionEvent applies an event and records the outcome
+func consumeSessionEvent(ctx context.Context, event SessionEvent) error {
+	err := applySessionEvent(ctx, event)
+
+	result := "applied"
+	var perm *permanentEventError
+	switch {
+	case errors.As(err, &perm):
+		result = "rejected"
+		logger.Warn(ctx, "Rejected session event", map[string]interface{}{
+			"event_id":   event.ID,
+			"op":         event.Op,
+			"session_id": event.SessionID,
+			"error":      err.Error(),
+		})
+	case err != nil:
+		result = "failed"
+		logger.Error(ctx, "Failed to apply session event", map[string]interface{}{
+			"event_id":   event.ID,
+			"op":         event.Op,
+			"session_id": event.SessionID,
+			"error":      err.Error(),
+		})
+	}
+	sessionEventsConsumed.WithLabelValues(event.Op, result).Inc()
+	return err
+}
+
+// receiveSessionEvent is the HTTP consumer used by instabook's in-process
+// queue. Permanent failures return 4xx so instabook dead-letters the event
+// instead of retrying it.
+func receiveSessionEvent(c *gin.Context) {
+	start := time.Now()
+
+	var event SessionEvent
+	if err := c.ShouldBindJSON(&event); err != nil {
+		if isTooLarge(err) {
+			respondTooLarge(c)
+			recordRequest("POST", "/cache/events", http.StatusRequestEntityTooLarge, start)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session event"})
+		recordRequest("POST", "/cache/events", http.StatusBadRequest, start)
+		return
+	}
+
+	err := consumeSessionEvent(c.Request.Context(), event)
+	var perm *permanentEventError
+	switch {
+	case errors.As(err, &perm):
+		c.JSON(perm.status, gin.H{"error": perm.Error()})
+		recordRequest("POST", "/cache/events", perm.status, start)
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply session event"})
+		recordRequest("POST", "/cache/events", http.StatusInternalServerError, start)
+	default:
+		c.Status(http.StatusNoContent)
+		recordRequest("POST", "/cache/events", http.StatusNoContent, start)
+	}
+}
+
+// NATSConsumer applies session events published by instabook to a NATS
+// subject. Events that fail are republished to the dead letter subject;
+// transient failures are redelivered up to maxAttempts times first.
+type NATSConsumer struct {
+	conn        *nats.Conn
+	subject     string
+	dlqSubject  string
+	maxAttempts int
+}
+
+// NewNATSConsumerFromEnv connects to NATS_URL. It returns nil when NATS is
+// not configured.
+func NewNATSConsumerFromEnv() (*NATSConsumer, error) {
+	url := platform.GetEnv("NATS_URL", "")
+	if url == "" {
+		return nil, nil
+	}
+
+	conn, err := nats.Connect(url, nats.Name("instabook-cache"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+
+	maxAttempts, err := strconv.Atoi(platform.GetEnv("SESSION_QUEUE_MAX_ATTEMPTS", "5"))
+	if err != nil || maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+
+	subject := platform.GetEnv("SESSION_QUEUE_SUBJECT", "instabook.sessions")
+	return &NATSConsumer{
+		conn:        conn,
+		subject:     subject,
+		dlqSubject:  platform.GetEnv("SESSION_QUEUE_DLQ_SUBJECT", subject+".dlq"),
+		maxAttempts: maxAttempts,
+	}, nil
+}
+
+// Start subscribes in a queue group, so each event is applied by only one
+// replica, and unsubscribes when ctx is done
+func (n *NATSConsumer) Start(ctx context.Context) error {
+	sub, err := n.conn.QueueSubscribe(n.subject, "instabook-cache", func(msg *nats.Msg) {
+		n.handle(ctx, msg)
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				sub.Drain()
+				return
+			case <-ticker.C:
+				if pending, _, err := sub.Pending(); err == nil {
+					sessionEventsPending.Set(float64(pending))
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (n *NATSConsumer) handle(ctx context.Context, msg *nats.Msg) {
+	defer platform.RecoverPanic(ctx, logger, "session-event-consumer")
+	var event SessionEvent
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		logger.Error(ctx, "Invalid session event on queue", map[string]interface{}{
+			"subject": msg.Subject,
+			"error":   err.Error(),
+		})
+		n.conn.Publish(n.dlqSubject, msg.Data)
+		return
+	}
+
+	ctx, span := platform.StartLinked(ctx, tracer, "session_event.consume", event.Trace,
+		trace.WithSpanKind(trace.SpanKindConsumer))
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("event.id", event.ID),
+		attribute.String("event.op", event.Op),
+		attribute.Int("event.attempts", event.Attempts),
+	)
+
+	tenant, err := parseTenant(event.Tenant)
+	if err != nil {
+		err = permanent(http.StatusBadRequest, "%v", err)
+	} else {
+		err = consumeSessionEvent(withTenant(ctx, tenant), event)
+	}
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+
+	event.Attempts++
+	var perm *permanentEventError
+	subject := n.subject
+	if errors.As(err, &perm) || event.Attempts >= n.maxAttempts {
+		subject = n.dlqSubject
+		sessionEventsConsumed.WithLabelValues(event.Op, "dead_lettered").Inc()
+	} else {
+		// Back off before redelivering so a struggling store isn't hammered
+		time.Sleep(time.Duration(event.Attempts) * 100 * time.Millisecond)
+	}
+	data, _ := json.Marshal(event)
+	if err := n.conn.Publish(subject, data); err != nil {
+		logger.Error(ctx, "Failed to requeue session event", map[string]interface{}{
+			"event_id": event.ID,
+			"subject":  subject,
+			"error":    err.Error(),
+		})
+	}
+}
+
+func (n *NATSConsumer) Close() error {
+	n.conn.Close()
+	return nil
+}
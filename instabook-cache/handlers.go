@@ -0,0 +1,409 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pagination bounds for GET /cache/sessions
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// maxBatchIDs bounds POST /cache/sessions/batch
+const maxBatchIDs = 100
+
+func recordRequest(method, endpoint string, status int, start time.Time) {
+	requestCount.WithLabelValues(method, endpoint, strconv.Itoa(status)).Inc()
+	responseTime.WithLabelValues(method, endpoint).Observe(time.Since(start).Seconds())
+}
+
+// replaceSession overwrites everything but the session's ID and creation time
+func replaceSession(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+	id := c.Param("id")
+
+	var req Session
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if isTooLarge(err) {
+			respondTooLarge(c)
+			recordRequest("PUT", "/cache/session/:id", http.StatusRequestEntityTooLarge, start)
+			return
+		}
+		logger.Error(ctx, "Failed to parse session data", map[string]interface{}{
+			"session_id": id,
+			"error":      err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session data"})
+		recordRequest("PUT", "/cache/session/:id", http.StatusBadRequest, start)
+		return
+	}
+
+	if fields := validateSession(req, false); len(fields) > 0 {
+		respondInvalid(c, fields)
+		recordRequest("PUT", "/cache/session/:id", http.StatusUnprocessableEntity, start)
+		return
+	}
+
+	session, err := sessions.Update(ctx, id, func(s *Session) {
+		s.UserID = req.UserID
+		s.BookingID = req.BookingID
+		s.Status = req.Status
+		s.Data = req.Data
+		if req.TTLSeconds > 0 {
+			s.TTLSeconds = req.TTLSeconds
+			s.ExpiresAt = time.Now().Add(time.Duration(req.TTLSeconds) * time.Second)
+		}
+	})
+	if errors.Is(err, ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		recordRequest("PUT", "/cache/session/:id", http.StatusNotFound, start)
+		return
+	}
+	if errors.Is(err, ErrInsufficientStorage) {
+		logger.Warn(ctx, "Session cache is full, rejecting write", map[string]interface{}{
+			"session_id": id,
+		})
+		respondInsufficientStorage(c)
+		recordRequest("PUT", "/cache/session/:id", http.StatusInsufficientStorage, start)
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to update session in store", map[string]interface{}{
+			"session_id": id,
+			"error":      err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session"})
+		recordRequest("PUT", "/cache/session/:id", http.StatusInternalServerError, start)
+		return
+	}
+
+	logger.Info(ctx, "Replaced session in cache", map[string]interface{}{
+		"session_id": id,
+		"user_id":    session.UserID,
+	})
+	c.JSON(http.StatusOK, session)
+	recordRequest("PUT", "/cache/session/:id", http.StatusOK, start)
+}
+
+// patchSession updates only the fields present in the request body
+func patchSession(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+	id := c.Param("id")
+
+	var req struct {
+		Status *string `json:"status"`
+		Data   *string `json:"data"`
+	}
+	err := c.ShouldBindJSON(&req)
+	if isTooLarge(err) {
+		respondTooLarge(c)
+		recordRequest("PATCH", "/cache/session/:id", http.StatusRequestEntityTooLarge, start)
+		return
+	}
+	if err != nil || (req.Status == nil && req.Data == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request must set status or data"})
+		recordRequest("PATCH", "/cache/session/:id", http.StatusBadRequest, start)
+		return
+	}
+
+	session, err := sessions.Update(ctx, id, func(s *Session) {
+		if req.Status != nil {
+			s.Status = *req.Status
+		}
+		if req.Data != nil {
+			s.Data = *req.Data
+		}
+	})
+	if errors.Is(err, ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		recordRequest("PATCH", "/cache/session/:id", http.StatusNotFound, start)
+		return
+	}
+	if errors.Is(err, ErrInsufficientStorage) {
+		logger.Warn(ctx, "Session cache is full, rejecting write", map[string]interface{}{
+			"session_id": id,
+		})
+		respondInsufficientStorage(c)
+		recordRequest("PATCH", "/cache/session/:id", http.StatusInsufficientStorage, start)
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to update session in store", map[string]interface{}{
+			"session_id": id,
+			"error":      err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session"})
+		recordRequest("PATCH", "/cache/session/:id", http.StatusInternalServerError, start)
+		return
+	}
+
+	logger.Info(ctx, "Updated session in cache", map[string]interface{}{
+		"session_id": id,
+		"status":     session.Status,
+	})
+	c.JSON(http.StatusOK, session)
+	recordRequest("PATCH", "/cache/session/:id", http.StatusOK, start)
+}
+
+func deleteSession(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+	id := c.Param("id")
+
+	err := sessions.Delete(ctx, id)
+	if errors.Is(err, ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		recordRequest("DELETE", "/cache/session/:id", http.StatusNotFound, start)
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to delete session from store", map[string]interface{}{
+			"session_id": id,
+			"error":      err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete session"})
+		recordRequest("DELETE", "/cache/session/:id", http.StatusInternalServerError, start)
+		return
+	}
+
+	logger.Info(ctx, "Deleted session from cache", map[string]interface{}{
+		"session_id": id,
+	})
+	c.Status(http.StatusNoContent)
+	recordRequest("DELETE", "/cache/session/:id", http.StatusNoContent, start)
+}
+
+// listSessions lets operators see what is in the cache, newest first
+func listSessions(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+	// Also served as GET /admin/sessions
+	route := c.FullPath()
+
+	limit := defaultListLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			recordRequest("GET", route, http.StatusBadRequest, start)
+			return
+		}
+		if n > maxListLimit {
+			n = maxListLimit
+		}
+		limit = n
+	}
+
+	offset := 0
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			recordRequest("GET", route, http.StatusBadRequest, start)
+			return
+		}
+		offset = n
+	}
+
+	var createdAfter time.Time
+	if v := c.Query("created_after"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "created_after must be an RFC 3339 timestamp"})
+			recordRequest("GET", route, http.StatusBadRequest, start)
+			return
+		}
+		createdAfter = t
+	}
+
+	userID := c.Query("user_id")
+	status := c.Query("status")
+
+	logger.Info(ctx, "Listing sessions", map[string]interface{}{
+		"limit":         limit,
+		"offset":        offset,
+		"user_id":       userID,
+		"status":        status,
+		"created_after": c.Query("created_after"),
+	})
+
+	all, err := sessions.List(ctx)
+	if err != nil {
+		logger.Error(ctx, "Failed to list sessions from store", map[string]interface{}{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		recordRequest("GET", route, http.StatusInternalServerError, start)
+		return
+	}
+
+	items := make([]*Session, 0, len(all))
+	for _, session := range all {
+		if userID != "" && session.UserID != userID {
+			continue
+		}
+		if status != "" && session.Status != status {
+			continue
+		}
+		if !createdAfter.IsZero() && !session.CreatedAt.After(createdAfter) {
+			continue
+		}
+		items = append(items, session)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].CreatedAt.Equal(items[j].CreatedAt) {
+			return items[i].CreatedAt.After(items[j].CreatedAt)
+		}
+		return items[i].ID < items[j].ID
+	})
+
+	total := len(items)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":  items[offset:end],
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+	recordRequest("GET", route, http.StatusOK, start)
+}
+
+// listUserSessions lets support find a customer's sessions, newest first,
+// optionally filtered by status
+func listUserSessions(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+	userID := c.Param("user_id")
+	status := c.Query("status")
+
+	logger.Info(ctx, "Listing user sessions", map[string]interface{}{
+		"user_id": userID,
+		"status":  status,
+	})
+
+	all, err := sessions.ListByUser(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Failed to list user sessions from store", map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		recordRequest("GET", "/cache/user/:user_id/sessions", http.StatusInternalServerError, start)
+		return
+	}
+
+	items := make([]*Session, 0, len(all))
+	for _, session := range all {
+		if status == "" || session.Status == status {
+			items = append(items, session)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].CreatedAt.Equal(items[j].CreatedAt) {
+			return items[i].CreatedAt.After(items[j].CreatedAt)
+		}
+		return items[i].ID < items[j].ID
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": userID,
+		"items":   items,
+		"total":   len(items),
+	})
+	recordRequest("GET", "/cache/user/:user_id/sessions", http.StatusOK, start)
+}
+
+// batchGetSessions looks up several sessions in one round trip. Missing and
+// expired IDs are listed in "missing" rather than failing the request.
+func batchGetSessions(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	err := c.ShouldBindJSON(&req)
+	if isTooLarge(err) {
+		respondTooLarge(c)
+		recordRequest("POST", "/cache/sessions/batch", http.StatusRequestEntityTooLarge, start)
+		return
+	}
+	if err != nil || len(req.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request must set ids"})
+		recordRequest("POST", "/cache/sessions/batch", http.StatusBadRequest, start)
+		return
+	}
+
+	// Duplicates are looked up and reported once
+	ids := make([]string, 0, len(req.IDs))
+	seen := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxBatchIDs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At most " + strconv.Itoa(maxBatchIDs) + " ids per request"})
+		recordRequest("POST", "/cache/sessions/batch", http.StatusBadRequest, start)
+		return
+	}
+
+	found := make([]*Session, 0, len(ids))
+	missing := make([]string, 0)
+	failed := make([]ItemFailure, 0)
+	failer := chaos.batchFaults("POST", "/cache/sessions/batch")
+	for _, id := range ids {
+		if failure, ok := failer.fail(id); ok {
+			failed = append(failed, failure)
+			continue
+		}
+		lookupCtx := withLookupTrace(ctx)
+		session, err := sessions.Get(lookupCtx, id)
+		if err == nil || errors.Is(err, ErrSessionNotFound) {
+			recordLookup(err == nil, lookupSource(lookupCtx))
+		}
+		if errors.Is(err, ErrSessionNotFound) {
+			missing = append(missing, id)
+			continue
+		}
+		if err != nil {
+			logger.Error(ctx, "Failed to read session from store", map[string]interface{}{
+				"session_id": id,
+				"error":      err.Error(),
+			})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read sessions"})
+			recordRequest("POST", "/cache/sessions/batch", http.StatusInternalServerError, start)
+			return
+		}
+		found = append(found, session)
+	}
+
+	logger.Info(ctx, "Batch read sessions from cache", map[string]interface{}{
+		"requested": len(ids),
+		"found":     len(found),
+		"missing":   len(missing),
+		"failed":    len(failed),
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"found":   found,
+		"missing": missing,
+		"failed":  failed,
+	})
+	recordRequest("POST", "/cache/sessions/batch", http.StatusOK, start)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"platform"
+)
+
+// journalRecord is one line of the write-through journal
+type journalRecord struct {
+	Op      string   `json:"op"`
+	ID      string   `json:"id,omitempty"`
+	Session *Session `json:"session,omitempty"`
+}
+
+// JournalStore wraps a Store and appends every write to a JSON-lines
+// journal so sessions can be restored after a restart
+type JournalStore struct {
+	Store
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewJournalStore replays the journal at path into inner, compacts it to the
+// sessions that are still live and returns the store with the number of
+// sessions restored
+func NewJournalStore(inner Store, path string) (*JournalStore, int, error) {
+	s := &JournalStore{Store: inner, path: path}
+
+	live, err := s.replay()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx := context.Background()
+	for _, session := range live {
+		if err := inner.Put(ctx, session); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if err := s.compact(live); err != nil {
+		return nil, 0, err
+	}
+	return s, len(live), nil
+}
+
+// replay reads the journal and returns the latest state of each unexpired
+// session
+func (s *JournalStore) replay() ([]*Session, error) {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	latest := make(map[string]*Session)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A torn final write from a crash; keep what we have
+			break
+		}
+		switch record.Op {
+		case "put":
+			if record.Session != nil {
+				latest[record.Session.ID] = record.Session
+			}
+		case "delete":
+			delete(latest, record.ID)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	live := make([]*Session, 0, len(latest))
+	for _, session := range latest {
+		if now.Before(session.ExpiresAt) {
+			live = append(live, session)
+		}
+	}
+	return live, nil
+}
+
+// compact rewrites the journal with only the given sessions and reopens it
+// for appending
+func (s *JournalStore) compact(live []*Session) error {
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, session := range live {
+		if err := enc.Encode(journalRecord{Op: "put", Session: session}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	return err
+}
+
+func (s *JournalStore) append(record journalRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+func (s *JournalStore) Put(ctx context.Context, session *Session) error {
+	if err := s.Store.Put(ctx, session); err != nil {
+		return err
+	}
+	return s.append(journalRecord{Op: "put", Session: session})
+}
+
+func (s *JournalStore) Create(ctx context.Context, session *Session) (*Session, error) {
+	created, err := s.Store.Create(ctx, session)
+	if err != nil {
+		return created, err
+	}
+	return created, s.append(journalRecord{Op: "put", Session: created})
+}
+
+func (s *JournalStore) Update(ctx context.Context, id string, fn func(*Session)) (*Session, error) {
+	session, err := s.Store.Update(ctx, id, fn)
+	if err != nil {
+		return nil, err
+	}
+	return session, s.append(journalRecord{Op: "put", Session: session})
+}
+
+func (s *JournalStore) Delete(ctx context.Context, id string) error {
+	if err := s.Store.Delete(ctx, id); err != nil {
+		return err
+	}
+	return s.append(journalRecord{Op: "delete", ID: id})
+}
+
+func (s *JournalStore) Close() error {
+	s.mu.Lock()
+	err := s.file.Close()
+	s.mu.Unlock()
+
+	if closer, ok := s.Store.(io.Closer); ok {
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// exportSnapshot returns every live session so another replica can be
+// warmed up with it
+func exportSnapshot(c *gin.Context) {
+	all, err := sessions.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, all)
+}
+
+// maxWarmupBytes caps a gzipped snapshot once decompressed
+const maxWarmupBytes = 256 << 20
+
+// warmupSessions preloads a snapshot of sessions, skipping ones that are
+// expired or already cached
+func warmupSessions(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var snapshot []*Session
+	if err := c.ShouldBindJSON(&snapshot); err != nil {
+		if isTooLarge(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Snapshot too large", "limit_bytes": maxWarmupBytes})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Body must be a JSON array of sessions"})
+		return
+	}
+
+	now := time.Now()
+	loaded, skipped := 0, 0
+	for _, session := range snapshot {
+		if session == nil || session.ID == "" || (!session.ExpiresAt.IsZero() && !now.Before(session.ExpiresAt)) {
+			skipped++
+			continue
+		}
+		if _, err := sessions.Get(ctx, session.ID); err == nil {
+			skipped++
+			continue
+		}
+		if session.CreatedAt.IsZero() {
+			session.CreatedAt = now
+		}
+		if err := sessions.Put(ctx, session); err != nil {
+			logger.Error(ctx, "Failed to warm up session", map[string]interface{}{
+				"session_id": session.ID,
+				"error":      err.Error(),
+			})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store session", "loaded": loaded})
+			return
+		}
+		loaded++
+	}
+
+	logger.Info(ctx, "Cache warmed up from snapshot", map[string]interface{}{
+		"loaded":  loaded,
+		"skipped": skipped,
+	})
+	platform.RecordAudit(c, "sessions.warmup", map[string]interface{}{"loaded": loaded, "skipped": skipped})
+	c.JSON(http.StatusOK, gin.H{"loaded": loaded, "skipped": skipped})
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+// jwksRefetchInterval limits how often an unknown kid triggers a JWKS fetch,
+// so tokens with made-up key IDs can't hammer the issuer
+const jwksRefetchInterval = time.Minute
+
+var (
+	errJWTMalformed = errors.New("malformed JWT")
+	errJWTAlgorithm = errors.New("unsupported JWT algorithm")
+	errJWTSignature = errors.New("JWT signature does not match")
+	errJWTExpired   = errors.New("JWT has expired")
+	errJWTNotYet    = errors.New("JWT is not valid yet")
+	errJWTIssuer    = errors.New("JWT issuer is not accepted")
+	errJWTAudience  = errors.New("JWT audience is not accepted")
+	errJWTKey       = errors.New("no JWKS key matches the JWT")
+)
+
+var jwtValidations = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "instabook_cache_jwt_validations_total",
+		Help: "Number of JWT Bearer tokens checked, by result",
+	},
+	[]string{"result"},
+)
+
+// jwtClaims are the registered claims checked by JWTValidator, plus the
+// scope and tenants that map the token onto an APIToken
+type jwtClaims struct {
+	Issuer    string      `json:"iss"`
+	Subject   string      `json:"sub"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt *int64      `json:"exp"`
+	NotBefore *int64      `json:"nbf"`
+
+	// Scope is read or read-write, like API tokens; missing means read
+	Scope   string   `json:"scope"`
+	Tenants []string `json:"tenants"`
+}
+
+// jwtAudience accepts aud as a string or a list of strings
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// JWTValidator checks JWT Bearer tokens signed with HS256 by JWT_HS256_SECRET
+// or with RS256 by a key from JWT_JWKS_URL
+type JWTValidator struct {
+	hmacSecret []byte
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	jwks       *jwksCache
+}
+
+// NewJWTValidatorFromEnv reads JWT_HS256_SECRET, JWT_JWKS_URL,
+// JWT_JWKS_REFRESH (default 10m), JWT_ISSUER, JWT_AUDIENCE and JWT_LEEWAY
+// (default 30s). It returns nil when neither a secret nor a JWKS URL is set.
+func NewJWTValidatorFromEnv() (*JWTValidator, error) {
+	secret := platform.GetEnv("JWT_HS256_SECRET", "")
+	jwksURL := platform.GetEnv("JWT_JWKS_URL", "")
+	if secret == "" && jwksURL == "" {
+		return nil, nil
+	}
+
+	leeway, err := time.ParseDuration(platform.GetEnv("JWT_LEEWAY", "30s"))
+	if err != nil || leeway < 0 {
+		return nil, fmt.Errorf("invalid JWT_LEEWAY: %q", platform.GetEnv("JWT_LEEWAY", ""))
+	}
+	v := &JWTValidator{
+		issuer:   platform.GetEnv("JWT_ISSUER", ""),
+		audience: platform.GetEnv("JWT_AUDIENCE", ""),
+		leeway:   leeway,
+	}
+	if secret != "" {
+		v.hmacSecret = []byte(secret)
+	}
+	if jwksURL != "" {
+		refresh, err := time.ParseDuration(platform.GetEnv("JWT_JWKS_REFRESH", "10m"))
+		if err != nil || refresh <= 0 {
+			return nil, fmt.Errorf("invalid JWT_JWKS_REFRESH: %q", platform.GetEnv("JWT_JWKS_REFRESH", ""))
+		}
+		v.jwks = &jwksCache{
+			url:     jwksURL,
+			refresh: refresh,
+			client:  platform.NewHTTPClient(logger, 5*time.Second),
+		}
+	}
+	return v, nil
+}
+
+// looksLikeJWT tells JWTs apart from API token secrets, which have no dots
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Validate checks token and returns the APIToken it stands for
+func (v *JWTValidator) Validate(ctx context.Context, token string) (APIToken, error) {
+	claims, err := v.validate(ctx, token, time.Now())
+	result := "valid"
+	if err != nil {
+		result = jwtFailureReason(err)
+	}
+	jwtValidations.WithLabelValues(result).Inc()
+	if err != nil {
+		return APIToken{}, err
+	}
+
+	scope := claims.Scope
+	if scope == "" {
+		scope = ScopeRead
+	}
+	return APIToken{
+		ID:      "jwt:" + claims.Subject,
+		Name:    claims.Subject,
+		Scope:   scope,
+		Tenants: claims.Tenants,
+	}, nil
+}
+
+func (v *JWTValidator) validate(ctx context.Context, token string, now time.Time) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errJWTMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, errJWTMalformed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errJWTMalformed
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	// The algorithm must match a configured key, so an RS256 public key can
+	// never be used as an HS256 secret
+	switch {
+	case header.Alg == "HS256" && v.hmacSecret != nil:
+		mac := hmac.New(sha256.New, v.hmacSecret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errJWTSignature
+		}
+	case header.Alg == "RS256" && v.jwks != nil:
+		key, err := v.jwks.key(ctx, header.Kid)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return nil, errJWTSignature
+		}
+	default:
+		return nil, errJWTAlgorithm
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, errJWTMalformed
+	}
+	if claims.ExpiresAt == nil || now.After(time.Unix(*claims.ExpiresAt, 0).Add(v.leeway)) {
+		return nil, errJWTExpired
+	}
+	if claims.NotBefore != nil && now.Add(v.leeway).Before(time.Unix(*claims.NotBefore, 0)) {
+		return nil, errJWTNotYet
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, errJWTIssuer
+	}
+	if v.audience != "" && !claims.Audience.contains(v.audience) {
+		return nil, errJWTAudience
+	}
+	return &claims, nil
+}
+
+func (a jwtAudience) contains(audience string) bool {
+	for _, aud := range a {
+		if aud == audience {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func jwtFailureReason(err error) string {
+	switch {
+	case errors.Is(err, errJWTExpired), errors.Is(err, errJWTNotYet):
+		return "expired"
+	case errors.Is(err, errJWTSignature):
+		return "bad_signature"
+	case errors.Is(err, errJWTIssuer):
+		return "wrong_issuer"
+	case errors.Is(err, errJWTAudience):
+		return "wrong_audience"
+	case errors.Is(err, errJWTKey):
+		return "unknown_key"
+	default:
+		return "malformed"
+	}
+}
+
+// jwksCache holds the RSA keys published at a JWKS URL. Keys are refetched
+// every refresh, or sooner when a token names a kid it doesn't know.
+type jwksCache struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func (c *jwksCache) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stale := time.Since(c.fetchedAt) > c.refresh
+	_, known := c.keys[kid]
+	if stale || (!known && time.Since(c.fetchedAt) > jwksRefetchInterval) {
+		if err := c.fetch(ctx); err != nil {
+			// Keep serving the keys we have; the issuer being briefly down
+			// shouldn't fail every request
+			logger.Warn(ctx, "Failed to fetch JWKS", map[string]interface{}{"url": c.url, "error": err.Error()})
+		}
+	}
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	// A token without a kid can use the only key there is
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, nil
+		}
+	}
+	return nil, errJWTKey
+}
+
+// fetch replaces the keys with the JWKS at c.url; callers hold c.mu
+func (c *jwksCache) fetch(ctx context.Context) error {
+	// Failed fetches also wait for the next refetch window
+	c.fetchedAt = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS returned %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	c.keys = keys
+	return nil
+}
@@ -2,32 +2,34 @@ package main
 
 import (
 	"context"
+	"errors"
+	"io"
+	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"platform"
 )
 
+// OpenTelemetry export settings
+var telemetry = platform.Telemetry{ServiceName: "instabook-cache"}
+
 // Logger
-var logger *StructuredLogger
+var logger = platform.NewStructuredLogger("instabook-cache")
 
-// Token configuration
-var (
-	tokenEnabled = true
-	tokenMutex   sync.RWMutex
-	apiToken     string
-)
+// Tracer
+var tracer = telemetry.Tracer()
 
 // Session storage
-var (
-	sessions     = make(map[string]*Session)
-	sessionMutex sync.RWMutex
-)
+var sessions Store
 
 // Session represents a booking session
 type Session struct {
@@ -37,155 +39,67 @@ type Session struct {
 	Status    string    `json:"status"`
 	CreatedAt time.Time `json:"created_at"`
 	Data      string    `json:"data"`
-}
 
-// Prometheus metrics
-var (
-	requestCount = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "instabook_cache_request_count",
-			Help: "Number of requests received by the instabook cache service",
-		},
-		[]string{"method", "endpoint", "status"},
-	)
-	responseTime = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "instabook_cache_response_time",
-			Help:    "Response time of the instabook cache service",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "endpoint"},
-	)
-)
+	// TTLSeconds overrides the default SESSION_TTL for this session
+	TTLSeconds int       `json:"ttl_seconds,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
 
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return fallback
+	// IdempotencyKey is the Idempotency-Key the session was created with
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+
+	// UpdatedAt is when the session was last changed, or zero if it
+	// hasn't been since it was created
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// SchemaVersion is the layout the session was stored in; see schema.go
+	SchemaVersion int `json:"schema_version"`
+
+	// Tenant is the X-Tenant-ID the session was written under, or empty
+	// for the default tenant; see tenants.go
+	Tenant string `json:"tenant,omitempty"`
 }
 
+// Prometheus metrics
+var requestCount, responseTime = platform.NewRequestMetrics("instabook_cache", "instabook cache service")
+
 func init() {
-	prometheus.MustRegister(requestCount)
-	prometheus.MustRegister(responseTime)
-	apiToken = getEnv("INSTABOOK_API_TOKEN", "instabook-secret-token-2024")
-	logger = NewStructuredLogger("instabook-cache")
+	prometheus.MustRegister(rateLimitedRequests)
+	prometheus.MustRegister(requestTimeouts)
+	prometheus.MustRegister(configReloads)
+	prometheus.MustRegister(chaosInjections)
+	prometheus.MustRegister(chaosActiveFaults)
+	prometheus.MustRegister(liveSessions)
+	prometheus.MustRegister(sessionEvictions)
+	prometheus.MustRegister(replicationEvents)
+	prometheus.MustRegister(signatureFailures)
+	prometheus.MustRegister(jwtValidations)
+	prometheus.MustRegister(readRepairs)
+	prometheus.MustRegister(coalescedRequests)
+	prometheus.MustRegister(sessionUpgradeCount)
+	prometheus.MustRegister(negativeCacheHits)
+	prometheus.MustRegister(cacheLookups)
+	prometheus.MustRegister(cacheHitRatio)
+	prometheus.MustRegister(originFetches)
+	prometheus.MustRegister(memoryUsedBytes)
+	prometheus.MustRegister(memoryLimitBytes)
+	prometheus.MustRegister(memoryRejections)
+	prometheus.MustRegister(tokenEnabledGauge)
+	prometheus.MustRegister(tenantRequests)
+	prometheus.MustRegister(cartOperations)
+	// The shared token from the environment is the bootstrap read-write token
+	tokens = NewTokenStore()
+	tokens.Add("default", ScopeReadWrite, platform.GetEnv("INSTABOOK_API_TOKEN", "instabook-secret-token-2024"), nil)
+	maxSessionBytes = maxSessionBytesFromEnv()
+	cartSettingsFromEnv()
 }
 
-// Admin HTML page
-const adminHTML = `<!DOCTYPE html>
-<html>
-<head>
-    <title>Instabook Cache Admin</title>
-    <style>
-        body {
-            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, sans-serif;
-            max-width: 600px;
-            margin: 50px auto;
-            padding: 20px;
-            background: #f5f5f5;
-        }
-        .container {
-            background: white;
-            padding: 30px;
-            border-radius: 10px;
-            box-shadow: 0 2px 10px rgba(0,0,0,0.1);
-        }
-        h1 {
-            color: #333;
-            margin-bottom: 30px;
-        }
-        .status {
-            padding: 15px 20px;
-            border-radius: 8px;
-            margin-bottom: 20px;
-            font-size: 18px;
-            font-weight: 500;
-        }
-        .enabled {
-            background: #d4edda;
-            color: #155724;
-            border: 1px solid #c3e6cb;
-        }
-        .disabled {
-            background: #f8d7da;
-            color: #721c24;
-            border: 1px solid #f5c6cb;
-        }
-        button {
-            padding: 12px 24px;
-            font-size: 16px;
-            cursor: pointer;
-            border: none;
-            border-radius: 6px;
-            background: #007bff;
-            color: white;
-            transition: background 0.2s;
-        }
-        button:hover {
-            background: #0056b3;
-        }
-        .info {
-            margin-top: 20px;
-            padding: 15px;
-            background: #e9ecef;
-            border-radius: 6px;
-            font-size: 14px;
-            color: #666;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <h1>Instabook Cache Admin</h1>
-        <div id="status" class="status">Loading...</div>
-        <button id="toggleBtn" onclick="toggleToken()">Toggle Token Authentication</button>
-        <div class="info">
-            <strong>API Token Authentication</strong><br>
-            When enabled, all /cache/* endpoints require a valid Bearer token.<br>
-            When disabled, all /cache/* endpoints return 401 Unauthorized.
-        </div>
-    </div>
-    <script>
-        async function fetchStatus() {
-            try {
-                const resp = await fetch('/admin/token');
-                const data = await resp.json();
-                const statusEl = document.getElementById('status');
-                if (data.enabled) {
-                    statusEl.className = 'status enabled';
-                    statusEl.textContent = 'Token Authentication: ENABLED';
-                } else {
-                    statusEl.className = 'status disabled';
-                    statusEl.textContent = 'Token Authentication: DISABLED (all cache requests will fail with 401)';
-                }
-            } catch (e) {
-                console.error('Error fetching status:', e);
-            }
-        }
-
-        async function toggleToken() {
-            try {
-                await fetch('/admin/token', { method: 'POST' });
-                await fetchStatus();
-            } catch (e) {
-                console.error('Error toggling token:', e);
-            }
-        }
-
-        fetchStatus();
-    </script>
-</body>
-</html>`
-
-// Authorization middleware for cache endpoints
-func authMiddleware() gin.HandlerFunc {
+// Authorization middleware for cache endpoints. Bearer values that look like
+// JWTs are validated as JWTs when JWT validation is configured. The token
+// toggle applies to signed requests and JWTs too, so the scenario's 401s
+// show up in every mode.
+func authMiddleware(signing *requestSigning, jwtValidator *JWTValidator) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenMutex.RLock()
-		enabled := tokenEnabled
-		tokenMutex.RUnlock()
-
-		if !enabled {
+		if !tokenAuth.Enabled() {
 			logger.Warn(context.Background(), "Token authentication is disabled, rejecting request", map[string]interface{}{
 				"path":   c.Request.URL.Path,
 				"method": c.Request.Method,
@@ -195,6 +109,11 @@ func authMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if signing.authenticates(c) {
+			signing.verify(c)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			logger.Warn(context.Background(), "Missing Authorization header", map[string]interface{}{
@@ -217,7 +136,24 @@ func authMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		if parts[1] != apiToken {
+		if jwtValidator != nil && looksLikeJWT(parts[1]) {
+			token, err := jwtValidator.Validate(c.Request.Context(), parts[1])
+			if err != nil {
+				logger.Warn(context.Background(), "Invalid JWT", map[string]interface{}{
+					"path":   c.Request.URL.Path,
+					"method": c.Request.Method,
+					"error":  err.Error(),
+				})
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid JWT: " + err.Error()})
+				c.Abort()
+				return
+			}
+			authorizeToken(c, token)
+			return
+		}
+
+		token, ok := tokens.Lookup(parts[1])
+		if !ok {
 			logger.Warn(context.Background(), "Invalid API token", map[string]interface{}{
 				"path":   c.Request.URL.Path,
 				"method": c.Request.Method,
@@ -227,52 +163,249 @@ func authMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		c.Next()
+		authorizeToken(c, token)
 	}
 }
 
+// authorizeToken continues as token if its scope allows the request
+func authorizeToken(c *gin.Context, token APIToken) {
+	if !token.Allows(c.Request.Method) {
+		logger.Warn(context.Background(), "API token scope does not allow request", map[string]interface{}{
+			"path":     c.Request.URL.Path,
+			"method":   c.Request.Method,
+			"token_id": token.ID,
+			"scope":    token.Scope,
+		})
+		c.JSON(http.StatusForbidden, gin.H{"error": "API token scope does not allow this request"})
+		c.Abort()
+		return
+	}
+
+	c.Set(apiTokenKey, token)
+	c.Next()
+}
+
 func main() {
-	router := gin.Default()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Re-read CONFIG_FILE on SIGHUP
+	watchConfigReload(ctx)
+	config.OnReload(logger.LoadSettings)
+
+	// A toggle left off fails every instabook request, so refuse to start
+	// with an auto re-enable delay that can't be applied
+	if v := config.Get("TOKEN_AUTH_REENABLE_AFTER"); v != "" {
+		if err := validDuration(v); err != nil {
+			log.Fatalf("Invalid TOKEN_AUTH_REENABLE_AFTER: %v", err)
+		}
+	}
 
-	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "UP"})
-	})
+	// Signed requests from instabook instead of, or as well as, Bearer tokens
+	signing, err := newRequestSigningFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid request signing configuration: %v", err)
+	}
 
-	// Metrics
-	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	// JWT Bearer tokens alongside the static API tokens
+	jwtValidator, err := NewJWTValidatorFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid JWT configuration: %v", err)
+	}
 
-	// Admin UI
-	router.GET("/admin", func(c *gin.Context) {
-		c.Header("Content-Type", "text/html")
-		c.String(http.StatusOK, adminHTML)
-	})
+	tp, err := platform.InitTracer(ctx, telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		// Flush buffered spans before exiting
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			logger.Error(ctx, "Error shutting down tracer provider", map[string]interface{}{"error": err.Error()})
+		}
+	}()
 
-	// Token status endpoint
-	router.GET("/admin/token", func(c *gin.Context) {
-		tokenMutex.RLock()
-		enabled := tokenEnabled
-		tokenMutex.RUnlock()
-		c.JSON(http.StatusOK, gin.H{"enabled": enabled})
-	})
+	// Session storage backend (in-memory unless CACHE_BACKEND=redis)
+	sessions, err = NewStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize session store: %v", err)
+	}
 
-	// Token toggle endpoint
-	router.POST("/admin/token", func(c *gin.Context) {
-		tokenMutex.Lock()
-		tokenEnabled = !tokenEnabled
-		newState := tokenEnabled
-		tokenMutex.Unlock()
+	// Background eviction of expired sessions; Redis expires keys itself
+	if memoryStore, ok := sessions.(*MemoryStore); ok {
+		memoryBackend = memoryStore
+		evictionInterval, err := time.ParseDuration(platform.GetEnv("SESSION_EVICTION_INTERVAL", "1m"))
+		if err != nil || evictionInterval <= 0 {
+			evictionInterval = time.Minute
+		}
+		memoryStore.StartEviction(ctx, evictionInterval)
+	}
 
-		logger.Info(context.Background(), "Token authentication toggled", map[string]interface{}{
-			"enabled": newState,
+	// Optional write-through journal so sessions survive restarts
+	if path := config.Get("SESSION_PERSIST_PATH"); path != "" {
+		journal, restored, err := NewJournalStore(sessions, path)
+		if err != nil {
+			log.Fatalf("Failed to open session journal %s: %v", path, err)
+		}
+		logger.Info(ctx, "Restored sessions from journal", map[string]interface{}{
+			"path":     path,
+			"restored": restored,
 		})
+		sessions = journal
+	}
+
+	// Replicate writes to peer replicas when CACHE_PEERS is set
+	if r := NewReplicatedStoreFromEnv(sessions); r != nil {
+		replicator = r
+		replicator.Start(ctx)
+		sessions = replicator
+	}
+
+	// Populate misses from CACHE_ORIGIN_URL when it is set
+	if r := NewReadThroughStoreFromEnv(sessions); r != nil {
+		sessions = r
+	}
+
+	// Coalesce concurrent lookups and briefly remember missing IDs
+	sessions = NewCoalescingStoreFromEnv(sessions)
+	if closer, ok := sessions.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	// Give each X-Tenant-ID its own session ID space
+	sessions = NewTenantStore(sessions)
 
-		c.JSON(http.StatusOK, gin.H{"enabled": newState})
+	// Consume session events from NATS when NATS_URL is set
+	consumer, err := NewNATSConsumerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	if consumer != nil {
+		if err := consumer.Start(ctx); err != nil {
+			log.Fatalf("Failed to subscribe to session events: %v", err)
+		}
+		defer consumer.Close()
+	}
+
+	mp := initMeter()
+	if mp != nil {
+		defer func() {
+			// Push the last metrics before exiting
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := mp.Shutdown(ctx); err != nil {
+				logger.Error(ctx, "Error shutting down meter provider", map[string]interface{}{"error": err.Error()})
+			}
+		}()
+	}
+
+	// Send logs to the collector too when OTEL_LOGS_ENABLED=true
+	logExporter, err := platform.InitLogExport(ctx, logger, telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize log export: %v", err)
+	}
+	if logExporter != nil {
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := logExporter.Shutdown(ctx); err != nil {
+				log.Printf("Error shutting down log exporter: %v", err)
+			}
+		}()
+	}
+
+	// gin.New rather than gin.Default: the access log below replaces gin's
+	// plain-text request logger
+	router := gin.New()
+
+	// Gzip responses for clients that accept it
+	router.Use(platform.CompressionMiddleware())
+
+	// Correlate logs and errors by X-Request-ID, across services
+	router.Use(platform.RequestIDMiddleware())
+
+	// Add OpenTelemetry middleware
+	router.Use(otelgin.Middleware("instabook-cache"))
+	router.Use(platform.MetricsMiddleware("instabook-cache"))
+	router.Use(platform.AccessLogMiddleware(logger))
+
+	// Per-route SLO compliance, summarized on /slo
+	slo := platform.NewSLOTrackerFromEnv("instabook-cache")
+	router.Use(slo.Middleware())
+
+	// Tag requests slower than their route's recent p99 on the span
+	outliers := platform.NewOutlierDetectorFromEnv("instabook-cache", logger)
+	router.Use(outliers.Middleware())
+
+	// Turn handler panics into logged, traced and counted 500s
+	router.Use(platform.RecoveryMiddleware(logger))
+
+	// Per-client rate limiting (disabled unless RATE_LIMIT_RPS is set)
+	router.Use(rateLimitMiddleware(NewRateLimiterFromEnv))
+
+	// Per-request deadlines (REQUEST_TIMEOUT, ROUTE_TIMEOUTS)
+	router.Use(timeoutMiddleware(nil))
+
+	// Injected faults from CHAOS_FAULTS and the /chaos API
+	StartChaosFromConfig()
+	router.Use(chaosMiddleware())
+
+	// Health check
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "UP"})
+	})
+
+	// Hold readiness until the collector answers. The Redis backend is
+	// already pinged above.
+	startup := platform.NewStartupCheckerFromEnv("instabook-cache", logger, telemetry.CollectorDependency())
+	startup.Start(ctx)
+
+	// Readiness to serve instabook: 503 while starting up, and while token
+	// authentication is disabled, since every cache request is then rejected
+	router.GET("/readyz", func(c *gin.Context) {
+		auth := tokenAuth.Status()
+		if !startup.Ready() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "STARTING", "token_auth": auth, "dependencies": startup.Report()})
+			return
+		}
+		if !auth.Enabled {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "NOT_READY", "token_auth": auth, "dependencies": startup.Report()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "READY", "token_auth": auth, "dependencies": startup.Report()})
 	})
 
+	// Metrics
+	if platform.PrometheusEnabled() {
+		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
+	router.POST("/config/reload", postConfigReload)
+	registerChaosRoutes(router)
+	platform.RegisterLogLevelRoutes(router, logger)
+	platform.RegisterAuditRoutes(router)
+	platform.RegisterSLORoutes(router, slo)
+	platform.RegisterDependencyRoutes(router, "instabook-cache")
+
+	// Admin page and the JSON admin APIs behind it
+	registerAdminRoutes(router)
+
+	// Peer replication endpoints
+	if replicator != nil {
+		internal := router.Group("/internal")
+		internal.Use(peerAuthMiddleware(replicator.token))
+		{
+			internal.POST("/replicate", applyReplicated)
+			internal.GET("/session/*id", getLocalSession)
+		}
+	}
+
 	// Cache endpoints with auth middleware
 	cache := router.Group("/cache")
-	cache.Use(authMiddleware())
+	// Bodies are capped first, since signature checks read them
+	cache.Use(limitBodyMiddleware())
+	cache.Use(authMiddleware(signing, jwtValidator))
+	cache.Use(tenantMiddleware())
 	{
 		// Get session
 		cache.GET("/session/:id", func(c *gin.Context) {
@@ -283,15 +416,46 @@ func main() {
 				"session_id": id,
 			})
 
-			sessionMutex.RLock()
-			session, exists := sessions[id]
-			sessionMutex.RUnlock()
-
-			if !exists {
+			lookupCtx := withLookupTrace(c.Request.Context())
+			session, err := sessions.Get(lookupCtx, id)
+			source := lookupSource(lookupCtx)
+			if err == nil || errors.Is(err, ErrSessionNotFound) {
+				c.Header("X-Cache", recordLookup(err == nil, source))
+				c.Header("X-Cache-Source", source)
+			}
+			if errors.Is(err, ErrSessionNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
 				requestCount.WithLabelValues("GET", "/cache/session/:id", "404").Inc()
 				return
 			}
+			if errors.Is(err, errOriginUnavailable) {
+				c.JSON(http.StatusBadGateway, gin.H{"error": "Session not cached and origin unavailable"})
+				requestCount.WithLabelValues("GET", "/cache/session/:id", "502").Inc()
+				return
+			}
+			if err != nil {
+				logger.Error(context.Background(), "Failed to read session from store", map[string]interface{}{
+					"session_id": id,
+					"error":      err.Error(),
+				})
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read session"})
+				requestCount.WithLabelValues("GET", "/cache/session/:id", "500").Inc()
+				return
+			}
+
+			notModified, err := setValidators(c, session)
+			if err != nil {
+				logger.Error(context.Background(), "Failed to compute session ETag", map[string]interface{}{
+					"session_id": id,
+					"error":      err.Error(),
+				})
+			}
+			if notModified {
+				c.Status(http.StatusNotModified)
+				requestCount.WithLabelValues("GET", "/cache/session/:id", "304").Inc()
+				responseTime.WithLabelValues("GET", "/cache/session/:id").Observe(time.Since(start).Seconds())
+				return
+			}
 
 			c.JSON(http.StatusOK, session)
 
@@ -306,6 +470,11 @@ func main() {
 
 			var session Session
 			if err := c.ShouldBindJSON(&session); err != nil {
+				if isTooLarge(err) {
+					respondTooLarge(c)
+					requestCount.WithLabelValues("POST", "/cache/session", "413").Inc()
+					return
+				}
 				logger.Error(context.Background(), "Failed to parse session data", map[string]interface{}{
 					"error": err.Error(),
 				})
@@ -314,26 +483,81 @@ func main() {
 				return
 			}
 
+			if fields := validateSession(session, true); len(fields) > 0 {
+				respondInvalid(c, fields)
+				requestCount.WithLabelValues("POST", "/cache/session", "422").Inc()
+				return
+			}
+
 			session.CreatedAt = time.Now()
+			session.IdempotencyKey = c.GetHeader("Idempotency-Key")
 
 			logger.Info(context.Background(), "Creating session in cache", map[string]interface{}{
 				"session_id": session.ID,
 				"user_id":    session.UserID,
 			})
 
-			sessionMutex.Lock()
-			sessions[session.ID] = &session
-			sessionMutex.Unlock()
+			existing, err := sessions.Create(c.Request.Context(), &session)
+			if errors.Is(err, ErrSessionExists) {
+				// A retry with the same key gets the original session back
+				if session.IdempotencyKey != "" && existing.IdempotencyKey == session.IdempotencyKey {
+					c.JSON(http.StatusOK, existing)
+					requestCount.WithLabelValues("POST", "/cache/session", "200").Inc()
+					return
+				}
+				logger.Warn(context.Background(), "Session already exists", map[string]interface{}{
+					"session_id": session.ID,
+				})
+				c.JSON(http.StatusConflict, gin.H{"error": "Session already exists", "id": session.ID})
+				requestCount.WithLabelValues("POST", "/cache/session", "409").Inc()
+				return
+			}
+			if errors.Is(err, ErrInsufficientStorage) {
+				logger.Warn(context.Background(), "Session cache is full, rejecting write", map[string]interface{}{
+					"session_id": session.ID,
+				})
+				respondInsufficientStorage(c)
+				requestCount.WithLabelValues("POST", "/cache/session", "507").Inc()
+				return
+			}
+			if err != nil {
+				logger.Error(context.Background(), "Failed to write session to store", map[string]interface{}{
+					"session_id": session.ID,
+					"error":      err.Error(),
+				})
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store session"})
+				requestCount.WithLabelValues("POST", "/cache/session", "500").Inc()
+				return
+			}
 
+			recordSessionCreated(c.Request.Context())
 			c.JSON(http.StatusCreated, session)
 
 			duration := time.Since(start).Seconds()
 			requestCount.WithLabelValues("POST", "/cache/session", "201").Inc()
 			responseTime.WithLabelValues("POST", "/cache/session").Observe(duration)
 		})
+
+		cache.GET("/sessions", listSessions)
+		cache.POST("/sessions/batch", batchGetSessions)
+		cache.GET("/user/:user_id/sessions", listUserSessions)
+		cache.PUT("/session/:id", replaceSession)
+		cache.PATCH("/session/:id", patchSession)
+		cache.DELETE("/session/:id", deleteSession)
+
+		// Shopping carts, stored as sessions
+		cache.GET("/cart/:id", getCart)
+		cache.POST("/cart/:id/items", addCartItem)
+		cache.DELETE("/cart/:id/items/:product_id", removeCartItem)
+		cache.DELETE("/cart/:id", clearCart)
+
+		// Consumer for session writes queued by instabook
+		cache.POST("/events", receiveSessionEvent)
 	}
 
-	port := getEnv("PORT", "8086")
-	logger.Info(context.Background(), "Instabook Cache Service starting", map[string]interface{}{"port": port})
-	router.Run(":" + port)
+	port := platform.GetEnv("PORT", "8086")
+	logger.Info(ctx, "Instabook Cache Service starting", map[string]interface{}{"port": port})
+	if err := runServer(ctx, ":"+port, router); err != nil {
+		logger.Error(ctx, "Server error", map[string]interface{}{"error": err.Error()})
+	}
 }
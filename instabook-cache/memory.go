@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+// evictMemory is the eviction reason for sessions dropped at the soft
+// memory limit
+const evictMemory = "memory"
+
+// sessionOverhead approximates what a session costs beyond its strings: the
+// struct, its map entry, LRU element and user index entry
+const sessionOverhead = 256
+
+// ErrInsufficientStorage is returned for writes that would take the cache
+// past its hard memory limit
+var ErrInsufficientStorage = errors.New("session cache memory limit reached")
+
+var (
+	memoryUsedBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "instabook_cache_memory_used_bytes",
+			Help: "Estimated bytes used by sessions held in memory",
+		},
+	)
+	memoryLimitBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "instabook_cache_memory_limit_bytes",
+			Help: "Configured session memory limits; 0 means unlimited",
+		},
+		[]string{"limit"},
+	)
+	memoryRejections = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "instabook_cache_memory_rejected_writes_total",
+			Help: "Number of session writes rejected with 507 at the hard memory limit",
+		},
+	)
+)
+
+// estimateSessionSize approximates the memory a session takes up in the
+// in-memory store
+func estimateSessionSize(s *Session) int64 {
+	return int64(sessionOverhead + len(s.ID) + len(s.UserID) + len(s.BookingID) +
+		len(s.Status) + len(s.Data) + len(s.IdempotencyKey) + len(s.Tenant))
+}
+
+// memoryLimitsFromEnv reads SESSION_MEMORY_SOFT_LIMIT and
+// SESSION_MEMORY_HARD_LIMIT in bytes. Either can be 0 (the default) to
+// disable it.
+func memoryLimitsFromEnv() (soft, hard int64) {
+	soft, err := strconv.ParseInt(platform.GetEnv("SESSION_MEMORY_SOFT_LIMIT", "0"), 10, 64)
+	if err != nil || soft < 0 {
+		soft = 0
+	}
+	hard, err = strconv.ParseInt(platform.GetEnv("SESSION_MEMORY_HARD_LIMIT", "0"), 10, 64)
+	if err != nil || hard < 0 {
+		hard = 0
+	}
+	return soft, hard
+}
+
+// SetMemoryLimits bounds the estimated bytes held. Past soft, the least
+// recently used sessions are evicted; writes that would pass hard are
+// rejected with ErrInsufficientStorage.
+func (s *MemoryStore) SetMemoryLimits(soft, hard int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.softLimit = soft
+	s.hardLimit = hard
+	memoryLimitBytes.WithLabelValues("soft").Set(float64(soft))
+	memoryLimitBytes.WithLabelValues("hard").Set(float64(hard))
+}
+
+// admit checks that growing the cache by delta bytes stays within the hard
+// limit; callers hold mu
+func (s *MemoryStore) admit(delta int64) error {
+	if s.hardLimit > 0 && delta > 0 && s.usedBytes+delta > s.hardLimit {
+		memoryRejections.Inc()
+		return ErrInsufficientStorage
+	}
+	return nil
+}
+
+// track adjusts the bytes in use; callers hold mu
+func (s *MemoryStore) track(delta int64) {
+	s.usedBytes += delta
+	memoryUsedBytes.Set(float64(s.usedBytes))
+}
+
+// shed evicts the least recently used sessions until the cache is back
+// under the soft limit, never evicting keep; callers hold mu
+func (s *MemoryStore) shed(keep string) {
+	for s.softLimit > 0 && s.usedBytes > s.softLimit {
+		oldest := s.lru.Back()
+		if oldest == nil || oldest.Value.(string) == keep {
+			return
+		}
+		s.remove(oldest.Value.(string), evictMemory)
+	}
+}
+
+func respondInsufficientStorage(c *gin.Context) {
+	c.JSON(http.StatusInsufficientStorage, gin.H{"error": "Session cache is full"})
+}
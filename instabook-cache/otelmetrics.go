@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"platform"
+)
+
+// OpenTelemetry instruments, exported over OTLP alongside the Prometheus
+// metrics on /metrics
+var (
+	sessionCreatedCounter  metric.Int64Counter
+	sessionEvictionCounter metric.Int64Counter
+)
+
+// initMeter exports metrics over OTLP and creates the business instruments.
+// It returns nil when OTEL_METRICS_ENABLED=false; the instruments are then
+// no-ops.
+func initMeter() *sdkmetric.MeterProvider {
+	mp, err := platform.InitMeter(context.Background(), telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize metrics: %v", err)
+	}
+
+	meter := otel.Meter("instabook-cache")
+	sessionCreatedCounter, _ = meter.Int64Counter("session.created", metric.WithDescription("Number of booking sessions created"))
+	sessionEvictionCounter, _ = meter.Int64Counter("session.evictions", metric.WithDescription("Number of sessions evicted by reason"))
+
+	return mp
+}
+
+// recordSessionCreated counts a newly created session
+func recordSessionCreated(ctx context.Context) {
+	sessionCreatedCounter.Add(ctx, 1)
+}
+
+// recordSessionEviction counts a session removed by expiry or the LRU bound
+func recordSessionEviction(reason string) {
+	sessionEvictions.WithLabelValues(reason).Inc()
+	evictions.Record(reason)
+	sessionEvictionCounter.Add(context.Background(), 1, metric.WithAttributes(attribute.String("reason", reason)))
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"platform"
+)
+
+// Where a session lookup was answered from, reported in X-Cache-Source
+const (
+	sourceLocal    = "local"
+	sourcePeer     = "peer"
+	sourceOrigin   = "origin"
+	sourceNegative = "negative"
+)
+
+// errOriginUnavailable is returned when a miss couldn't be checked against
+// the origin, so the session may well exist there
+var errOriginUnavailable = errors.New("origin unavailable")
+
+var (
+	cacheLookups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "instabook_cache_lookups_total",
+			Help: "Number of session lookups by result (hit or miss) and where they were answered from",
+		},
+		[]string{"result", "source"},
+	)
+	cacheHitRatio = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "instabook_cache_hit_ratio",
+			Help: "Fraction of session lookups since startup answered without going to the origin",
+		},
+		func() float64 {
+			hits, misses := lookupHits.Load(), lookupMisses.Load()
+			if hits+misses == 0 {
+				return 0
+			}
+			return float64(hits) / float64(hits+misses)
+		},
+	)
+	originFetches = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "instabook_cache_origin_fetches_total",
+			Help: "Number of read-through fetches from the origin by result",
+		},
+		[]string{"result"},
+	)
+
+	lookupHits, lookupMisses atomic.Int64
+)
+
+// lookupTrace collects where a lookup was answered from as it passes
+// through the store wrappers
+type lookupTrace struct {
+	source string
+}
+
+type lookupTraceKey struct{}
+
+// withLookupTrace returns a context that records where lookups made with it
+// are answered from
+func withLookupTrace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lookupTraceKey{}, &lookupTrace{})
+}
+
+// recordLookupSource notes where a lookup was answered from. It is a no-op
+// for contexts without a lookupTrace.
+func recordLookupSource(ctx context.Context, source string) {
+	if t, ok := ctx.Value(lookupTraceKey{}).(*lookupTrace); ok {
+		t.source = source
+	}
+}
+
+// lookupSource returns the recorded source; a lookup no wrapper claimed
+// was answered by the local store
+func lookupSource(ctx context.Context) string {
+	if t, ok := ctx.Value(lookupTraceKey{}).(*lookupTrace); ok && t.source != "" {
+		return t.source
+	}
+	return sourceLocal
+}
+
+// recordLookup counts a finished lookup. Sessions held locally or by a peer
+// are hits; sessions fetched from the origin, and sessions not found at
+// all, are misses.
+func recordLookup(found bool, source string) string {
+	result := "MISS"
+	if found && source != sourceOrigin {
+		result = "HIT"
+		lookupHits.Add(1)
+	} else {
+		lookupMisses.Add(1)
+	}
+	cacheLookups.WithLabelValues(strings.ToLower(result), source).Inc()
+	return result
+}
+
+// ReadThroughStore wraps a Store so a miss is populated from an origin
+// service that owns the sessions
+type ReadThroughStore struct {
+	Store
+	origin string
+	token  string
+	client *http.Client
+}
+
+// NewReadThroughStoreFromEnv reads CACHE_ORIGIN_URL and CACHE_ORIGIN_TOKEN.
+// The URL may contain {id}; otherwise the session ID is appended as a path
+// segment. It returns nil when no origin is configured.
+func NewReadThroughStoreFromEnv(inner Store) *ReadThroughStore {
+	origin := strings.TrimRight(platform.GetEnv("CACHE_ORIGIN_URL", ""), "/")
+	if origin == "" {
+		return nil
+	}
+	return &ReadThroughStore{
+		Store:  inner,
+		origin: origin,
+		token:  platform.GetEnv("CACHE_ORIGIN_TOKEN", ""),
+		client: platform.NewHTTPClient(logger, 2*time.Second),
+	}
+}
+
+func (s *ReadThroughStore) originURL(id string) string {
+	if strings.Contains(s.origin, "{id}") {
+		return strings.ReplaceAll(s.origin, "{id}", url.PathEscape(id))
+	}
+	return s.origin + "/" + url.PathEscape(id)
+}
+
+// Get asks the origin on a miss and stores what it returns. A session the
+// origin doesn't have is ErrSessionNotFound; an origin that can't be
+// reached is errOriginUnavailable.
+func (s *ReadThroughStore) Get(ctx context.Context, id string) (*Session, error) {
+	session, err := s.Store.Get(ctx, id)
+	if !errors.Is(err, ErrSessionNotFound) {
+		return session, err
+	}
+
+	ctx, span := tracer.Start(ctx, "cache.read_through")
+	defer span.End()
+	span.SetAttributes(attribute.String("session.id", id))
+
+	session, err = s.fetch(ctx, id)
+	recordLookupSource(ctx, sourceOrigin)
+	if errors.Is(err, ErrSessionNotFound) {
+		originFetches.WithLabelValues("not_found").Inc()
+		return nil, err
+	}
+	if err != nil {
+		span.RecordError(err)
+		originFetches.WithLabelValues("error").Inc()
+		logger.Warn(ctx, "Failed to read session from origin", map[string]interface{}{
+			"session_id": id,
+			"error":      err.Error(),
+		})
+		return nil, fmt.Errorf("%w: %v", errOriginUnavailable, err)
+	}
+
+	if err := s.Store.Put(ctx, session); err != nil {
+		return nil, err
+	}
+	originFetches.WithLabelValues("filled").Inc()
+	span.AddEvent("cache.filled")
+	logger.Info(ctx, "Session filled from origin", map[string]interface{}{
+		"session_id": id,
+	})
+	return session, nil
+}
+
+// fetch asks the origin for the session stored under id. A tenant's
+// session is requested by its plain ID with X-Tenant-ID set.
+func (s *ReadThroughStore) fetch(ctx context.Context, id string) (*Session, error) {
+	tenant, plainID := "", id
+	if i := strings.Index(id, tenantSeparator); i >= 0 {
+		tenant, plainID = id[:i], id[i+len(tenantSeparator):]
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.originURL(plainID), nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	if tenant != "" {
+		req.Header.Set("X-Tenant-ID", tenant)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrSessionNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("origin returned status %d", resp.StatusCode)
+	}
+
+	var session Session
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, err
+	}
+	// Store it under the key it was asked for, whatever ID the origin uses
+	session.ID = id
+	session.Tenant = tenant
+	return &session, nil
+}
+
+func (s *ReadThroughStore) Close() error {
+	if closer, ok := s.Store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisKeyPrefix = "instabook:session:"
+	// redisUserPrefix keys each user's index: a sorted set of session IDs
+	// scored by expiry
+	redisUserPrefix = "instabook:user:"
+)
+
+// indexScript adds a session to its user's index, drops expired members
+// and keeps the index alive until its last session expires
+var indexScript = redis.NewScript(`
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[3])
+local last = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+if last[2] then
+	redis.call('EXPIREAT', KEYS[1], math.ceil(tonumber(last[2])))
+end
+return 0
+`)
+
+// RedisStore keeps sessions in Redis so they survive restarts and can be
+// shared between replicas. Expiry uses native key TTLs.
+type RedisStore struct {
+	client     *redis.Client
+	defaultTTL time.Duration
+}
+
+func NewRedisStore(addr, password string, db int, defaultTTL time.Duration) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisStore{client: client, defaultTTL: defaultTTL}, nil
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+func (s *RedisStore) Get(ctx context.Context, id string) (*Session, error) {
+	data, err := s.client.Get(ctx, redisKeyPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *RedisStore) Put(ctx context.Context, session *Session) error {
+	ttl := sessionTTL(session, s.defaultTTL)
+	session.ExpiresAt = session.CreatedAt.Add(ttl)
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if err := s.client.Set(ctx, redisKeyPrefix+session.ID, data, time.Until(session.ExpiresAt)).Err(); err != nil {
+		return err
+	}
+	return s.index(ctx, session)
+}
+
+// Create relies on SET NX so concurrent replicas can't both create the
+// same session
+func (s *RedisStore) Create(ctx context.Context, session *Session) (*Session, error) {
+	ttl := sessionTTL(session, s.defaultTTL)
+	session.ExpiresAt = session.CreatedAt.Add(ttl)
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	created, err := s.client.SetNX(ctx, redisKeyPrefix+session.ID, data, time.Until(session.ExpiresAt)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		return session, s.index(ctx, session)
+	}
+
+	existing, err := s.Get(ctx, session.ID)
+	if errors.Is(err, ErrSessionNotFound) {
+		// Expired between SETNX and GET; try again
+		return s.Create(ctx, session)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return existing, ErrSessionExists
+}
+
+// Update uses an optimistic WATCH transaction so concurrent replicas don't
+// overwrite each other's changes
+func (s *RedisStore) Update(ctx context.Context, id string, fn func(*Session)) (*Session, error) {
+	key := redisKeyPrefix + id
+	var updated Session
+
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return ErrSessionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &updated); err != nil {
+			return err
+		}
+
+		fn(&updated)
+		updated.ID = id
+		updated.UpdatedAt = time.Now()
+
+		data, err = json.Marshal(&updated)
+		if err != nil {
+			return err
+		}
+		ttl := time.Until(updated.ExpiresAt)
+		if ttl <= 0 {
+			return ErrSessionNotFound
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, ttl)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, s.index(ctx, &updated)
+}
+
+// List scans the session keyspace; it is meant for operators, not the
+// request path
+func (s *RedisStore) List(ctx context.Context) ([]*Session, error) {
+	var result []*Session
+	iter := s.client.Scan(ctx, 0, redisKeyPrefix+"*", 100).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < len(keys); start += 100 {
+		end := start + 100
+		if end > len(keys) {
+			end = len(keys)
+		}
+		values, err := s.client.MGet(ctx, keys[start:end]...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			// Keys can expire between SCAN and MGET
+			data, ok := value.(string)
+			if !ok {
+				continue
+			}
+			var session Session
+			if err := json.Unmarshal([]byte(data), &session); err != nil {
+				return nil, err
+			}
+			result = append(result, &session)
+		}
+	}
+	return result, nil
+}
+
+// index records the session under its user. Deleted sessions and sessions
+// moved to another user are left in the old index and dropped by
+// ListByUser when it finds them gone.
+func (s *RedisStore) index(ctx context.Context, session *Session) error {
+	if session.UserID == "" {
+		return nil
+	}
+	return indexScript.Run(ctx, s.client, []string{redisUserPrefix + session.UserID},
+		session.ExpiresAt.Unix(), session.ID, time.Now().Unix()).Err()
+}
+
+func (s *RedisStore) ListByUser(ctx context.Context, userID string) ([]*Session, error) {
+	key := redisUserPrefix + userID
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	ids, err := s.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "(" + now, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = redisKeyPrefix + id
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*Session, 0, len(ids))
+	var stale []interface{}
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			stale = append(stale, ids[i])
+			continue
+		}
+		var session Session
+		if err := json.Unmarshal([]byte(data), &session); err != nil {
+			return nil, err
+		}
+		if session.UserID != userID {
+			stale = append(stale, ids[i])
+			continue
+		}
+		result = append(result, &session)
+	}
+	if len(stale) > 0 {
+		s.client.ZRem(ctx, key, stale...)
+	}
+	return result, nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	deleted, err := s.client.Del(ctx, redisKeyPrefix+id).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
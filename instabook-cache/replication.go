@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"platform"
+)
+
+var (
+	replicationEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "instabook_cache_replication_total",
+			Help: "Number of session writes replicated to peers",
+		},
+		[]string{"peer", "result"},
+	)
+	readRepairs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "instabook_cache_read_repairs_total",
+			Help: "Number of local cache misses answered by a peer",
+		},
+		[]string{"result"},
+	)
+)
+
+// peerQueueSize bounds the writes buffered for a slow or unreachable peer
+const peerQueueSize = 1024
+
+type peer struct {
+	url   string
+	queue chan peerWrite
+}
+
+// peerWrite is a write waiting to be copied to a peer, with the trace of
+// the request that made it
+type peerWrite struct {
+	record journalRecord
+	trace  platform.TraceCarrier
+}
+
+// ReplicatedStore wraps a Store, asynchronously copying writes to peer
+// replicas and repairing local misses by asking peers
+type ReplicatedStore struct {
+	Store
+	peers  []*peer
+	token  string
+	client *http.Client
+}
+
+var replicator *ReplicatedStore
+
+// NewReplicatedStoreFromEnv reads CACHE_PEERS (comma-separated base URLs of
+// the other replicas) and CACHE_PEER_TOKEN. It returns nil when no peers are
+// configured.
+func NewReplicatedStoreFromEnv(inner Store) *ReplicatedStore {
+	var urls []string
+	for _, u := range strings.Split(platform.GetEnv("CACHE_PEERS", ""), ",") {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+
+	s := &ReplicatedStore{
+		Store:  inner,
+		token:  platform.GetEnv("CACHE_PEER_TOKEN", ""),
+		client: platform.NewHTTPClient(logger, 2*time.Second),
+	}
+	for _, u := range urls {
+		s.peers = append(s.peers, &peer{url: u, queue: make(chan peerWrite, peerQueueSize)})
+	}
+	return s
+}
+
+// Start runs one replication worker per peer until ctx is done
+func (s *ReplicatedStore) Start(ctx context.Context) {
+	for _, p := range s.peers {
+		go s.replicate(ctx, p)
+	}
+}
+
+func (s *ReplicatedStore) replicate(ctx context.Context, p *peer) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case write := <-p.queue:
+			s.replicateWrite(ctx, p, write)
+		}
+	}
+}
+
+// replicateWrite sends one write to p in a span linked to the request that
+// made it
+func (s *ReplicatedStore) replicateWrite(ctx context.Context, p *peer, write peerWrite) {
+	record := write.record
+	ctx, span := platform.StartLinked(ctx, tracer, "cache.replicate", write.trace)
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("peer.url", p.url),
+		attribute.String("replication.op", record.Op),
+	)
+
+	if err := s.send(ctx, p, record); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		replicationEvents.WithLabelValues(p.url, "error").Inc()
+		logger.Warn(ctx, "Failed to replicate session write", map[string]interface{}{
+			"peer":  p.url,
+			"op":    record.Op,
+			"error": err.Error(),
+		})
+		return
+	}
+	replicationEvents.WithLabelValues(p.url, "ok").Inc()
+}
+
+func (s *ReplicatedStore) newPeerRequest(ctx context.Context, method, url string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func (s *ReplicatedStore) send(ctx context.Context, p *peer, record journalRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	req, err := s.newPeerRequest(ctx, http.MethodPost, p.url+"/internal/replicate", data)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("peer returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// enqueue hands a write to every peer without blocking the request path
+func (s *ReplicatedStore) enqueue(ctx context.Context, record journalRecord) {
+	write := peerWrite{record: record, trace: platform.InjectTrace(ctx)}
+	for _, p := range s.peers {
+		select {
+		case p.queue <- write:
+		default:
+			replicationEvents.WithLabelValues(p.url, "dropped").Inc()
+		}
+	}
+}
+
+// Get falls back to the peers on a local miss and stores what they return
+func (s *ReplicatedStore) Get(ctx context.Context, id string) (*Session, error) {
+	session, err := s.Store.Get(ctx, id)
+	if !errors.Is(err, ErrSessionNotFound) {
+		return session, err
+	}
+
+	for _, p := range s.peers {
+		session, err := s.fetch(ctx, p, id)
+		if err != nil {
+			continue
+		}
+		if err := s.Store.Put(ctx, session); err != nil {
+			return nil, err
+		}
+		readRepairs.WithLabelValues("repaired").Inc()
+		recordLookupSource(ctx, sourcePeer)
+		logger.Info(ctx, "Session repaired from peer", map[string]interface{}{
+			"session_id": id,
+			"peer":       p.url,
+		})
+		return session, nil
+	}
+	readRepairs.WithLabelValues("miss").Inc()
+	return nil, ErrSessionNotFound
+}
+
+func (s *ReplicatedStore) fetch(ctx context.Context, p *peer, id string) (*Session, error) {
+	req, err := s.newPeerRequest(ctx, http.MethodGet, p.url+"/internal/session/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrSessionNotFound
+	}
+
+	var session Session
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *ReplicatedStore) Put(ctx context.Context, session *Session) error {
+	if err := s.Store.Put(ctx, session); err != nil {
+		return err
+	}
+	s.enqueue(ctx, journalRecord{Op: "put", Session: session})
+	return nil
+}
+
+func (s *ReplicatedStore) Create(ctx context.Context, session *Session) (*Session, error) {
+	created, err := s.Store.Create(ctx, session)
+	if err != nil {
+		return created, err
+	}
+	s.enqueue(ctx, journalRecord{Op: "put", Session: created})
+	return created, nil
+}
+
+func (s *ReplicatedStore) Update(ctx context.Context, id string, fn func(*Session)) (*Session, error) {
+	session, err := s.Store.Update(ctx, id, fn)
+	if err != nil {
+		return nil, err
+	}
+	s.enqueue(ctx, journalRecord{Op: "put", Session: session})
+	return session, nil
+}
+
+func (s *ReplicatedStore) Delete(ctx context.Context, id string) error {
+	if err := s.Store.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.enqueue(ctx, journalRecord{Op: "delete", ID: id})
+	return nil
+}
+
+func (s *ReplicatedStore) Close() error {
+	if closer, ok := s.Store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// peerAuthMiddleware guards the internal endpoints with CACHE_PEER_TOKEN
+// when it is set
+func peerAuthMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token != "" && c.GetHeader("Authorization") != "Bearer "+token {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid peer token"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// applyReplicated applies a peer's write to the local store only, so writes
+// are never re-replicated
+func applyReplicated(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var record journalRecord
+	if err := c.ShouldBindJSON(&record); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid replication record"})
+		return
+	}
+
+	var err error
+	switch record.Op {
+	case "put":
+		if record.Session == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing session"})
+			return
+		}
+		err = replicator.Store.Put(ctx, record.Session)
+	case "delete":
+		err = replicator.Store.Delete(ctx, record.ID)
+		if errors.Is(err, ErrSessionNotFound) {
+			err = nil
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown op"})
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to apply replicated write", map[string]interface{}{
+			"op":    record.Op,
+			"error": err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply write"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// getLocalSession serves read-repair lookups from the local store only. The
+// route is a wildcard because tenants' store keys contain a slash.
+func getLocalSession(c *gin.Context) {
+	session, err := replicator.Store.Get(c.Request.Context(), strings.TrimPrefix(c.Param("id"), "/"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	c.JSON(http.StatusOK, session)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+// sessionSchemaVersion is the Session layout this build writes. Bump it
+// when a field is renamed, retyped or changes meaning, and add an upgrade
+// from the previous version to sessionUpgrades. Adding an optional field
+// needs no new version.
+const sessionSchemaVersion = 2
+
+// sessionUpgrades convert a stored session from version n to n+1 and
+// report whether they changed anything. They work on the raw JSON object,
+// so old layouts need no Go type.
+var sessionUpgrades = map[int]func(raw map[string]interface{}) bool{
+	// Version 1 sessions were stored before TTLs existed and have no
+	// expires_at, which reads as already expired
+	1: func(raw map[string]interface{}) bool {
+		if _, ok := raw["expires_at"]; ok {
+			return false
+		}
+		created, ok := raw["created_at"].(string)
+		if !ok {
+			return false
+		}
+		t, err := time.Parse(time.RFC3339Nano, created)
+		if err != nil {
+			return false
+		}
+		raw["expires_at"] = t.Add(defaultSessionTTL()).Format(time.RFC3339Nano)
+		return true
+	},
+}
+
+var sessionUpgradeCount = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "instabook_cache_session_upgrades_total",
+		Help: "Number of sessions read in an older schema and upgraded, by the version they were stored in",
+	},
+	[]string{"from_version"},
+)
+
+// defaultSessionTTL reads SESSION_TTL (default 30m)
+func defaultSessionTTL() time.Duration {
+	ttl, err := time.ParseDuration(platform.GetEnv("SESSION_TTL", "30m"))
+	if err != nil || ttl <= 0 {
+		return 30 * time.Minute
+	}
+	return ttl
+}
+
+// sessionFields has Session's fields without its JSON methods
+type sessionFields Session
+
+// MarshalJSON stamps the current schema version on every session written,
+// whether to a store, the journal, a peer or a client
+func (s Session) MarshalJSON() ([]byte, error) {
+	fields := sessionFields(s)
+	fields.SchemaVersion = sessionSchemaVersion
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON upgrades sessions stored by older builds to the current
+// schema, so replicas and stores with mixed versions keep working during a
+// rolling deploy. A session without schema_version is version 1. Sessions
+// from a newer build are decoded as far as this build understands them.
+func (s *Session) UnmarshalJSON(data []byte) error {
+	var tag struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &tag); err != nil {
+		return err
+	}
+	version := 1
+	if tag.SchemaVersion != nil && *tag.SchemaVersion > 1 {
+		version = *tag.SchemaVersion
+	}
+	if version >= sessionSchemaVersion {
+		return json.Unmarshal(data, (*sessionFields)(s))
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	from, changed := version, false
+	for ; version < sessionSchemaVersion; version++ {
+		upgrade, ok := sessionUpgrades[version]
+		if !ok {
+			return fmt.Errorf("no upgrade from session schema version %d", version)
+		}
+		if upgrade(raw) {
+			changed = true
+		}
+	}
+	raw["schema_version"] = version
+	// Client request bodies carry no version either; only count sessions
+	// that actually needed upgrading
+	if changed {
+		sessionUpgradeCount.WithLabelValues(strconv.Itoa(from)).Inc()
+	}
+
+	upgraded, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(upgraded, (*sessionFields)(s))
+}
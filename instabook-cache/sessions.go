@@ -0,0 +1,287 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Eviction reasons
+const (
+	evictExpired  = "expired"
+	evictCapacity = "capacity"
+)
+
+var (
+	liveSessions = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "instabook_cache_sessions",
+			Help: "Number of sessions currently held in the cache",
+		},
+	)
+	sessionEvictions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "instabook_cache_session_evictions_total",
+			Help: "Number of sessions evicted from the cache",
+		},
+		[]string{"reason"},
+	)
+)
+
+type sessionEntry struct {
+	session *Session
+	element *list.Element
+	size    int64
+}
+
+// MemoryStore holds sessions in process with a per-session TTL and
+// optional LRU bounds on the number of entries and their estimated size
+type MemoryStore struct {
+	mu         sync.Mutex
+	defaultTTL time.Duration
+	maxEntries int
+	entries    map[string]*sessionEntry
+	lru        *list.List // front is most recently used; values are session IDs
+	byUser     map[string]map[string]struct{}
+
+	// Estimated bytes held, and the limits set by SetMemoryLimits
+	usedBytes int64
+	softLimit int64
+	hardLimit int64
+}
+
+func NewMemoryStore(defaultTTL time.Duration, maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		defaultTTL: defaultTTL,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*sessionEntry),
+		lru:        list.New(),
+		byUser:     make(map[string]map[string]struct{}),
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if time.Now().After(entry.session.ExpiresAt) {
+		s.remove(id, evictExpired)
+		return nil, ErrSessionNotFound
+	}
+	s.lru.MoveToFront(entry.element)
+	return entry.session, nil
+}
+
+// Put evicts the least recently used session when over capacity
+func (s *MemoryStore) Put(ctx context.Context, session *Session) error {
+	session.ExpiresAt = session.CreatedAt.Add(sessionTTL(session, s.defaultTTL))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.put(session)
+}
+
+func (s *MemoryStore) Create(ctx context.Context, session *Session) (*Session, error) {
+	session.ExpiresAt = session.CreatedAt.Add(sessionTTL(session, s.defaultTTL))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[session.ID]; ok && !time.Now().After(entry.session.ExpiresAt) {
+		return entry.session, ErrSessionExists
+	}
+	if err := s.put(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// put stores the session with s.mu held, unless it would take the store
+// past its hard memory limit
+func (s *MemoryStore) put(session *Session) error {
+	size := estimateSessionSize(session)
+	if entry, ok := s.entries[session.ID]; ok {
+		if err := s.admit(size - entry.size); err != nil {
+			return err
+		}
+		s.reindex(session.ID, entry.session.UserID, session.UserID)
+		s.track(size - entry.size)
+		entry.session = session
+		entry.size = size
+		s.lru.MoveToFront(entry.element)
+		s.shed(session.ID)
+		return nil
+	}
+
+	if err := s.admit(size); err != nil {
+		return err
+	}
+	s.entries[session.ID] = &sessionEntry{session: session, element: s.lru.PushFront(session.ID), size: size}
+	s.reindex(session.ID, "", session.UserID)
+	s.track(size)
+	for s.maxEntries > 0 && len(s.entries) > s.maxEntries {
+		oldest := s.lru.Back()
+		s.remove(oldest.Value.(string), evictCapacity)
+	}
+	s.shed(session.ID)
+	liveSessions.Set(float64(len(s.entries)))
+	return nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, id string, fn func(*Session)) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if time.Now().After(entry.session.ExpiresAt) {
+		s.remove(id, evictExpired)
+		return nil, ErrSessionNotFound
+	}
+
+	updated := *entry.session
+	fn(&updated)
+	updated.ID = id
+	updated.UpdatedAt = time.Now()
+	size := estimateSessionSize(&updated)
+	if err := s.admit(size - entry.size); err != nil {
+		return nil, err
+	}
+	s.reindex(id, entry.session.UserID, updated.UserID)
+	s.track(size - entry.size)
+	entry.session = &updated
+	entry.size = size
+	s.lru.MoveToFront(entry.element)
+	s.shed(id)
+	return &updated, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	expired := time.Now().After(entry.session.ExpiresAt)
+	s.unlink(id)
+	if expired {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListByUser(ctx context.Context, userID string) ([]*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	result := make([]*Session, 0, len(s.byUser[userID]))
+	for id := range s.byUser[userID] {
+		if session := s.entries[id].session; !now.After(session.ExpiresAt) {
+			result = append(result, session)
+		}
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	result := make([]*Session, 0, len(s.entries))
+	for _, entry := range s.entries {
+		if !now.After(entry.session.ExpiresAt) {
+			result = append(result, entry.session)
+		}
+	}
+	return result, nil
+}
+
+// unlink drops a session from the map and LRU list; callers hold mu
+func (s *MemoryStore) unlink(id string) {
+	entry, ok := s.entries[id]
+	if !ok {
+		return
+	}
+	s.lru.Remove(entry.element)
+	delete(s.entries, id)
+	s.reindex(id, entry.session.UserID, "")
+	s.track(-entry.size)
+	liveSessions.Set(float64(len(s.entries)))
+}
+
+// reindex moves a session between users in the byUser index; "" means
+// none. Callers hold mu.
+func (s *MemoryStore) reindex(id, from, to string) {
+	if from == to {
+		return
+	}
+	if ids, ok := s.byUser[from]; ok {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(s.byUser, from)
+		}
+	}
+	if to != "" {
+		if s.byUser[to] == nil {
+			s.byUser[to] = make(map[string]struct{})
+		}
+		s.byUser[to][id] = struct{}{}
+	}
+}
+
+// remove evicts a session and records why; callers hold mu
+func (s *MemoryStore) remove(id, reason string) {
+	if _, ok := s.entries[id]; !ok {
+		return
+	}
+	s.unlink(id)
+	recordSessionEviction(reason)
+}
+
+// EvictExpired removes every session whose TTL has passed and returns how
+// many were evicted
+func (s *MemoryStore) EvictExpired(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evicted := 0
+	for id, entry := range s.entries {
+		if now.After(entry.session.ExpiresAt) {
+			s.remove(id, evictExpired)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// StartEviction runs EvictExpired every interval until ctx is done
+func (s *MemoryStore) StartEviction(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if evicted := s.EvictExpired(now); evicted > 0 {
+					logger.Info(ctx, "Evicted expired sessions", map[string]interface{}{"evicted": evicted})
+				}
+			}
+		}
+	}()
+}
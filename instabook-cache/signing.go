@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+// Values of CACHE_AUTH_MODE
+const (
+	authModeBearer = "bearer"
+	authModeHMAC   = "hmac"
+	authModeAny    = "any"
+)
+
+// signedRequestToken is the identity of a request signed with
+// CACHE_SIGNING_SECRET; it may read and write every tenant
+var signedRequestToken = APIToken{ID: "signed", Name: "request-signing", Scope: ScopeReadWrite}
+
+var signatureFailures = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "instabook_cache_signature_failures_total",
+		Help: "Number of signed cache API requests rejected, by reason",
+	},
+	[]string{"reason"},
+)
+
+// requestSigning is how /cache requests authenticate when CACHE_AUTH_MODE
+// is hmac or any
+type requestSigning struct {
+	mode     string
+	verifier *platform.RequestVerifier
+}
+
+// newRequestSigningFromEnv reads CACHE_AUTH_MODE (default bearer),
+// CACHE_SIGNING_SECRET and CACHE_SIGNATURE_MAX_AGE (default 5m). It returns
+// nil in bearer mode.
+func newRequestSigningFromEnv() (*requestSigning, error) {
+	mode := platform.GetEnv("CACHE_AUTH_MODE", authModeBearer)
+	switch mode {
+	case authModeBearer:
+		return nil, nil
+	case authModeHMAC, authModeAny:
+	default:
+		return nil, fmt.Errorf("CACHE_AUTH_MODE must be %s, %s or %s, got %q", authModeBearer, authModeHMAC, authModeAny, mode)
+	}
+
+	secret := platform.GetEnv("CACHE_SIGNING_SECRET", "")
+	if secret == "" {
+		return nil, fmt.Errorf("CACHE_AUTH_MODE=%s requires CACHE_SIGNING_SECRET", mode)
+	}
+	maxAge, err := time.ParseDuration(platform.GetEnv("CACHE_SIGNATURE_MAX_AGE", "5m"))
+	if err != nil || maxAge <= 0 {
+		return nil, fmt.Errorf("invalid CACHE_SIGNATURE_MAX_AGE: %q", platform.GetEnv("CACHE_SIGNATURE_MAX_AGE", ""))
+	}
+	return &requestSigning{mode: mode, verifier: platform.NewRequestVerifier([]byte(secret), maxAge)}, nil
+}
+
+// authenticates reports whether signing handles c's authentication: every
+// request in hmac mode, and signed ones in any mode
+func (s *requestSigning) authenticates(c *gin.Context) bool {
+	return s != nil && (s.mode == authModeHMAC || platform.Signed(c.Request))
+}
+
+// verify checks c's signature and continues as signedRequestToken. The body
+// is read here and put back for the handler.
+func (s *requestSigning) verify(c *gin.Context) {
+	var body []byte
+	if c.Request.Body != nil {
+		var err error
+		body, err = io.ReadAll(c.Request.Body)
+		if isTooLarge(err) {
+			respondTooLarge(c)
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if err := s.verifier.Verify(c.Request, body); err != nil {
+		reason := signatureFailureReason(err)
+		signatureFailures.WithLabelValues(reason).Inc()
+		logger.Warn(c.Request.Context(), "Rejected signed request", map[string]interface{}{
+			"path":   c.Request.URL.Path,
+			"method": c.Request.Method,
+			"reason": reason,
+		})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.Set(apiTokenKey, signedRequestToken)
+	c.Next()
+}
+
+func signatureFailureReason(err error) string {
+	switch {
+	case errors.Is(err, platform.ErrSignatureMissing):
+		return "missing"
+	case errors.Is(err, platform.ErrSignatureExpired):
+		return "expired"
+	case errors.Is(err, platform.ErrSignatureReplayed):
+		return "replayed"
+	default:
+		return "invalid"
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"platform"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionExists   = errors.New("session already exists")
+)
+
+// Store persists booking sessions. Expired sessions behave as if they do
+// not exist.
+type Store interface {
+	Get(ctx context.Context, id string) (*Session, error)
+	// Put stores the session, stamping ExpiresAt from TTLSeconds or the
+	// store's default TTL
+	Put(ctx context.Context, session *Session) error
+	// Create stores the session only if no live session has its ID. When
+	// one does, it returns the existing session and ErrSessionExists.
+	Create(ctx context.Context, session *Session) (*Session, error)
+	// Update applies fn to a copy of the live session and stores the result
+	Update(ctx context.Context, id string, fn func(*Session)) (*Session, error)
+	Delete(ctx context.Context, id string) error
+	// List returns every live session in no particular order
+	List(ctx context.Context) ([]*Session, error)
+	// ListByUser returns every live session with the given UserID in no
+	// particular order, from an index rather than a scan
+	ListByUser(ctx context.Context, userID string) ([]*Session, error)
+}
+
+// sessionTTL resolves the TTL to apply to a session being stored
+func sessionTTL(session *Session, defaultTTL time.Duration) time.Duration {
+	if session.TTLSeconds > 0 {
+		return time.Duration(session.TTLSeconds) * time.Second
+	}
+	return defaultTTL
+}
+
+// NewStoreFromEnv picks the session store from CACHE_BACKEND ("memory" or
+// "redis"). SESSION_TTL (default 30m) applies to both; SESSION_MAX_ENTRIES
+// and the SESSION_MEMORY_*_LIMIT budgets only bound the in-memory store.
+func NewStoreFromEnv() (Store, error) {
+	ttl := defaultSessionTTL()
+
+	switch backend := platform.GetEnv("CACHE_BACKEND", "memory"); backend {
+	case "redis":
+		db, _ := strconv.Atoi(config.Get("REDIS_DB"))
+		return NewRedisStore(platform.GetEnv("REDIS_ADDR", "redis:6379"), config.Get("REDIS_PASSWORD"), db, ttl)
+	case "memory":
+		maxEntries, _ := strconv.Atoi(config.Get("SESSION_MAX_ENTRIES"))
+		store := NewMemoryStore(ttl, maxEntries)
+		store.SetMemoryLimits(memoryLimitsFromEnv())
+		return store, nil
+	default:
+		return nil, errors.New("unknown CACHE_BACKEND " + strconv.Quote(backend))
+	}
+}
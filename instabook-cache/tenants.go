@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+// defaultTenant is the tenant of requests without X-Tenant-ID. Its sessions
+// keep their plain IDs, so caches from before tenants existed still work.
+const defaultTenant = "default"
+
+// otherTenants is the metric label for tenants past TENANT_METRIC_LIMIT
+const otherTenants = "other"
+
+// tenantSeparator joins a tenant and a session ID into a store key. Session
+// IDs may not contain it.
+const tenantSeparator = "/"
+
+var validTenant = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+var errInvalidTenant = errors.New("X-Tenant-ID must be 1-63 lowercase letters, digits, '-' or '_'")
+
+var tenantRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "instabook_cache_tenant_requests_total",
+		Help: "Number of cache API requests by tenant, method and status; tenants past TENANT_METRIC_LIMIT are counted as other",
+	},
+	[]string{"tenant", "method", "status"},
+)
+
+// tenantLabels hands out metric labels to the first TENANT_METRIC_LIMIT
+// tenants seen and "other" to the rest, so a misbehaving client can't
+// create unbounded series
+type tenantLabels struct {
+	mu    sync.Mutex
+	limit int
+	seen  map[string]bool
+}
+
+var tenantMetricLabels = newTenantLabelsFromEnv()
+
+// newTenantLabelsFromEnv reads TENANT_METRIC_LIMIT (default 20). The default
+// tenant is always labeled by name and doesn't count against it.
+func newTenantLabelsFromEnv() *tenantLabels {
+	limit, err := strconv.Atoi(platform.GetEnv("TENANT_METRIC_LIMIT", "20"))
+	if err != nil || limit < 0 {
+		limit = 20
+	}
+	return &tenantLabels{limit: limit, seen: make(map[string]bool)}
+}
+
+func (l *tenantLabels) label(tenant string) string {
+	if tenant == defaultTenant {
+		return tenant
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seen[tenant] {
+		return tenant
+	}
+	if len(l.seen) >= l.limit {
+		return otherTenants
+	}
+	l.seen[tenant] = true
+	return tenant
+}
+
+type tenantKey struct{}
+
+// withTenant returns a context whose session lookups and writes are scoped
+// to tenant
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// tenantFrom returns the tenant ctx is scoped to. Contexts without one, such
+// as peer replication, snapshots and warm-up, see the raw store keys.
+func tenantFrom(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+// parseTenant validates an X-Tenant-ID value; empty means the default tenant
+func parseTenant(value string) (string, error) {
+	if value == "" {
+		return defaultTenant, nil
+	}
+	if !validTenant.MatchString(value) {
+		return "", errInvalidTenant
+	}
+	return value, nil
+}
+
+// tenantMiddleware scopes /cache requests to the X-Tenant-ID tenant and
+// checks that the API token authenticated by authMiddleware may use it
+func tenantMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, err := parseTenant(c.GetHeader("X-Tenant-ID"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		if token, ok := c.Get(apiTokenKey); ok && !token.(APIToken).AllowsTenant(tenant) {
+			logger.Warn(c.Request.Context(), "API token is not scoped to tenant", map[string]interface{}{
+				"path":     c.Request.URL.Path,
+				"method":   c.Request.Method,
+				"token_id": token.(APIToken).ID,
+				"tenant":   tenant,
+			})
+			c.JSON(http.StatusForbidden, gin.H{"error": "API token does not allow this tenant"})
+			c.Abort()
+			return
+		}
+
+		c.Request = c.Request.WithContext(withTenant(c.Request.Context(), tenant))
+		c.Header("X-Tenant-ID", tenant)
+		c.Next()
+
+		tenantRequests.WithLabelValues(tenantMetricLabels.label(tenant), c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+	}
+}
+
+// TenantStore wraps a Store so each tenant has its own session ID space.
+// Sessions of tenants other than the default one are stored under
+// "<tenant>/<id>" with Tenant set, and are handed back with their plain ID.
+type TenantStore struct {
+	Store
+}
+
+func NewTenantStore(inner Store) *TenantStore {
+	return &TenantStore{Store: inner}
+}
+
+// storeKey maps a tenant's session ID to the ID it is stored under
+func storeKey(tenant, id string) string {
+	if tenant == defaultTenant {
+		return id
+	}
+	return tenant + tenantSeparator + id
+}
+
+// scope returns the tenant ctx is scoped to and the store key for id. A
+// scoped ID containing tenantSeparator would reach into another tenant, so
+// callers treat it as not found.
+func (s *TenantStore) scope(ctx context.Context, id string) (string, string, bool) {
+	tenant, ok := tenantFrom(ctx)
+	if !ok {
+		return "", id, false
+	}
+	return tenant, storeKey(tenant, id), true
+}
+
+// inbound returns a copy of session as it is stored for tenant
+func inbound(tenant string, session *Session) *Session {
+	stored := *session
+	stored.ID = storeKey(tenant, session.ID)
+	stored.Tenant = ""
+	if tenant != defaultTenant {
+		stored.Tenant = tenant
+	}
+	return &stored
+}
+
+// outbound returns a copy of a stored session with its tenant's plain ID
+func outbound(session *Session) *Session {
+	if session == nil || session.Tenant == "" {
+		return session
+	}
+	out := *session
+	out.ID = strings.TrimPrefix(session.ID, session.Tenant+tenantSeparator)
+	return &out
+}
+
+// owns reports whether a stored session belongs to tenant
+func owns(tenant string, session *Session) bool {
+	if tenant == defaultTenant {
+		return session.Tenant == ""
+	}
+	return session.Tenant == tenant
+}
+
+func (s *TenantStore) Get(ctx context.Context, id string) (*Session, error) {
+	_, key, ok := s.scope(ctx, id)
+	if ok && strings.Contains(id, tenantSeparator) {
+		return nil, ErrSessionNotFound
+	}
+	session, err := s.Store.Get(ctx, key)
+	return outbound(session), err
+}
+
+func (s *TenantStore) Put(ctx context.Context, session *Session) error {
+	tenant, ok := tenantFrom(ctx)
+	if !ok {
+		return s.Store.Put(ctx, session)
+	}
+	stored := inbound(tenant, session)
+	if err := s.Store.Put(ctx, stored); err != nil {
+		return err
+	}
+	*session = *outbound(stored)
+	return nil
+}
+
+func (s *TenantStore) Create(ctx context.Context, session *Session) (*Session, error) {
+	tenant, ok := tenantFrom(ctx)
+	if !ok {
+		return s.Store.Create(ctx, session)
+	}
+	stored := inbound(tenant, session)
+	existing, err := s.Store.Create(ctx, stored)
+	if err != nil {
+		return outbound(existing), err
+	}
+	*session = *outbound(stored)
+	return session, nil
+}
+
+// Update hands fn the session with its plain ID and keeps it in the tenant
+func (s *TenantStore) Update(ctx context.Context, id string, fn func(*Session)) (*Session, error) {
+	_, key, ok := s.scope(ctx, id)
+	if !ok {
+		return s.Store.Update(ctx, id, fn)
+	}
+	if strings.Contains(id, tenantSeparator) {
+		return nil, ErrSessionNotFound
+	}
+	session, err := s.Store.Update(ctx, key, func(stored *Session) {
+		stored.ID = id
+		fn(stored)
+		stored.ID = key
+	})
+	return outbound(session), err
+}
+
+func (s *TenantStore) Delete(ctx context.Context, id string) error {
+	_, key, ok := s.scope(ctx, id)
+	if ok && strings.Contains(id, tenantSeparator) {
+		return ErrSessionNotFound
+	}
+	return s.Store.Delete(ctx, key)
+}
+
+// List returns only the tenant's sessions
+func (s *TenantStore) List(ctx context.Context) ([]*Session, error) {
+	all, err := s.Store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.filter(ctx, all), nil
+}
+
+// ListByUser returns only the tenant's sessions for userID; user IDs are
+// not namespaced, so the index may hold other tenants' sessions too
+func (s *TenantStore) ListByUser(ctx context.Context, userID string) ([]*Session, error) {
+	all, err := s.Store.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.filter(ctx, all), nil
+}
+
+func (s *TenantStore) filter(ctx context.Context, all []*Session) []*Session {
+	tenant, ok := tenantFrom(ctx)
+	if !ok {
+		return all
+	}
+	result := make([]*Session, 0, len(all))
+	for _, session := range all {
+		if owns(tenant, session) {
+			result = append(result, outbound(session))
+		}
+	}
+	return result
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"platform"
+)
+
+// Token scopes
+const (
+	ScopeRead      = "read"
+	ScopeReadWrite = "read-write"
+)
+
+var ErrTokenNotFound = errors.New("token not found")
+
+// apiTokenKey is the gin context key authMiddleware stores the request's
+// APIToken under
+const apiTokenKey = "api_token"
+
+// APIToken is a named credential for the cache API. Only the SHA-256 hash
+// of the secret is kept.
+type APIToken struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scope     string     `json:"scope"`
+	Hash      string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+
+	// Tenants limits the token to these X-Tenant-ID tenants; empty allows
+	// every tenant
+	Tenants []string `json:"tenants,omitempty"`
+}
+
+// Allows reports whether the token may perform an HTTP method
+func (t APIToken) Allows(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return t.Scope == ScopeRead || t.Scope == ScopeReadWrite
+	default:
+		return t.Scope == ScopeReadWrite
+	}
+}
+
+// AllowsTenant reports whether the token may read and write tenant's sessions
+func (t APIToken) AllowsTenant(tenant string) bool {
+	if len(t.Tenants) == 0 {
+		return true
+	}
+	for _, allowed := range t.Tenants {
+		if allowed == tenant {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenStore holds the set of API tokens keyed by hash
+type TokenStore struct {
+	mu     sync.RWMutex
+	byHash map[string]*APIToken
+	byID   map[string]*APIToken
+}
+
+var tokens *TokenStore
+
+func NewTokenStore() *TokenStore {
+	return &TokenStore{
+		byHash: make(map[string]*APIToken),
+		byID:   make(map[string]*APIToken),
+	}
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Add registers an existing secret, e.g. the INSTABOOK_API_TOKEN bootstrap
+// token. tenants limits the token to those tenants; nil allows every tenant.
+func (s *TokenStore) Add(name, scope, secret string, tenants []string) APIToken {
+	token := &APIToken{
+		ID:        "tok-" + randomHex(6),
+		Name:      name,
+		Scope:     scope,
+		Tenants:   tenants,
+		Hash:      hashToken(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	s.byHash[token.Hash] = token
+	s.byID[token.ID] = token
+	s.mu.Unlock()
+	return *token
+}
+
+// Create generates a new secret and returns it alongside the token; the
+// secret cannot be recovered afterwards
+func (s *TokenStore) Create(name, scope string, tenants []string) (APIToken, string) {
+	secret := "ibk_" + randomHex(24)
+	return s.Add(name, scope, secret, tenants), secret
+}
+
+// Lookup returns the active token matching secret
+func (s *TokenStore) Lookup(secret string) (APIToken, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, ok := s.byHash[hashToken(secret)]
+	if !ok || token.RevokedAt != nil {
+		return APIToken{}, false
+	}
+	return *token, true
+}
+
+func (s *TokenStore) Revoke(id string) (APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.byID[id]
+	if !ok {
+		return APIToken{}, ErrTokenNotFound
+	}
+	if token.RevokedAt == nil {
+		now := time.Now().UTC()
+		token.RevokedAt = &now
+	}
+	return *token, nil
+}
+
+// List returns all tokens, including revoked ones, oldest first
+func (s *TokenStore) List() []APIToken {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]APIToken, 0, len(s.byID))
+	for _, token := range s.byID {
+		result = append(result, *token)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// adminAuthMiddleware protects token management with INSTABOOK_ADMIN_TOKEN
+// when it is set
+func adminAuthMiddleware(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminToken != "" && c.GetHeader("Authorization") != "Bearer "+adminToken {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid admin token"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func listTokens(c *gin.Context) {
+	c.JSON(http.StatusOK, tokens.List())
+}
+
+func createToken(c *gin.Context) {
+	var req struct {
+		Name    string   `json:"name"`
+		Scope   string   `json:"scope"`
+		Tenants []string `json:"tenants"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if req.Scope == "" {
+		req.Scope = ScopeRead
+	}
+	if req.Scope != ScopeRead && req.Scope != ScopeReadWrite {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be read or read-write"})
+		return
+	}
+
+	for _, tenant := range req.Tenants {
+		if _, err := parseTenant(tenant); err != nil || tenant == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tenants must be valid X-Tenant-ID values"})
+			return
+		}
+	}
+
+	token, secret := tokens.Create(req.Name, req.Scope, req.Tenants)
+	logger.Info(c.Request.Context(), "API token created", map[string]interface{}{
+		"token_id": token.ID,
+		"name":     token.Name,
+		"scope":    token.Scope,
+		"tenants":  token.Tenants,
+	})
+	platform.RecordAudit(c, "api_token.create", map[string]interface{}{
+		"token_id": token.ID,
+		"name":     token.Name,
+		"scope":    token.Scope,
+		"tenants":  token.Tenants,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{"token": token, "secret": secret})
+}
+
+func revokeToken(c *gin.Context) {
+	token, err := tokens.Revoke(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+
+	logger.Info(c.Request.Context(), "API token revoked", map[string]interface{}{
+		"token_id": token.ID,
+		"name":     token.Name,
+	})
+	platform.RecordAudit(c, "api_token.revoke", map[string]interface{}{"token_id": token.ID, "name": token.Name})
+	c.JSON(http.StatusOK, token)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"platform"
+)
+
+// defaultMaxSessionBytes bounds session request bodies unless
+// SESSION_MAX_BYTES says otherwise
+const defaultMaxSessionBytes = 64 * 1024
+
+var maxSessionBytes int64 = defaultMaxSessionBytes
+
+// FieldError describes why one field of a session failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func maxSessionBytesFromEnv() int64 {
+	n, err := strconv.ParseInt(platform.GetEnv("SESSION_MAX_BYTES", ""), 10, 64)
+	if err != nil || n <= 0 {
+		return defaultMaxSessionBytes
+	}
+	return n
+}
+
+// limitBodyMiddleware rejects oversized session writes before they are
+// decoded and caps the body for requests without a Content-Length
+func limitBodyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Method == http.MethodGet {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > maxSessionBytes {
+			respondTooLarge(c)
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSessionBytes)
+		c.Next()
+	}
+}
+
+func isTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+func respondTooLarge(c *gin.Context) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error":       "Session payload too large",
+		"limit_bytes": maxSessionBytes,
+	})
+}
+
+// validateSession checks the fields every stored session must have
+func validateSession(session Session, requireID bool) []FieldError {
+	var fields []FieldError
+	if requireID && session.ID == "" {
+		fields = append(fields, FieldError{Field: "id", Message: "is required"})
+	}
+	if requireID && strings.Contains(session.ID, tenantSeparator) {
+		fields = append(fields, FieldError{Field: "id", Message: "must not contain " + strconv.Quote(tenantSeparator)})
+	}
+	if session.UserID == "" {
+		fields = append(fields, FieldError{Field: "user_id", Message: "is required"})
+	}
+	if session.TTLSeconds < 0 {
+		fields = append(fields, FieldError{Field: "ttl_seconds", Message: "must not be negative"})
+	}
+	return fields
+}
+
+func respondInvalid(c *gin.Context, fields []FieldError) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":  "Session failed validation",
+		"fields": fields,
+	})
+}
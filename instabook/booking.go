@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"platform"
+)
+
+// Booking statuses. A booking moves pending → reserved → confirmed, or ends
+// in rolled_back once the completed steps have been compensated. failed
+// means a compensation step could not be completed either. Confirmed
+// bookings can also be cancelled (see cancel.go).
+const (
+	BookingPending    = "pending"
+	BookingReserved   = "reserved"
+	BookingConfirmed  = "confirmed"
+	BookingRolledBack = "rolled_back"
+	BookingFailed     = "failed"
+)
+
+// maxBookings bounds the in-memory booking history; the oldest bookings are
+// forgotten first
+const maxBookings = 10000
+
+var inventoryServiceURL string
+
+var bookingOutcomes = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "instabook_bookings_total",
+		Help: "Number of booking workflows by final status",
+	},
+	[]string{"status"},
+)
+
+func init() {
+	prometheus.MustRegister(bookingOutcomes)
+}
+
+type BookingTransition struct {
+	Status string    `json:"status"`
+	Step   string    `json:"step"`
+	At     time.Time `json:"at"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Booking tracks one run of the create → reserve → confirm workflow
+type Booking struct {
+	ID            string              `json:"id"`
+	SessionID     string              `json:"session_id"`
+	UserID        string              `json:"user_id"`
+	ProductID     string              `json:"product_id"`
+	Quantity      int                 `json:"quantity"`
+	Status        string              `json:"status"`
+	ReservationID string              `json:"reservation_id,omitempty"`
+	Error         string              `json:"error,omitempty"`
+	Transitions   []BookingTransition `json:"transitions"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+}
+
+// BookingStore keeps recent bookings in memory, ordered by creation
+type BookingStore struct {
+	mu       sync.RWMutex
+	bookings map[string]*Booking
+	order    []string
+}
+
+var bookings = NewBookingStore()
+
+func NewBookingStore() *BookingStore {
+	return &BookingStore{bookings: make(map[string]*Booking)}
+}
+
+func (s *BookingStore) Add(b *Booking) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bookings[b.ID] = b
+	s.order = append(s.order, b.ID)
+	for len(s.order) > maxBookings {
+		delete(s.bookings, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// Get returns a copy so callers can't race with an in-flight workflow
+func (s *BookingStore) Get(id string) (Booking, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	b, ok := s.bookings[id]
+	if !ok {
+		return Booking{}, false
+	}
+	copied := *b
+	copied.Transitions = append([]BookingTransition(nil), b.Transitions...)
+	return copied, true
+}
+
+// transition records a status change for the booking
+func (s *BookingStore) transition(b *Booking, status, step string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	t := BookingTransition{Status: status, Step: step, At: now}
+	if err != nil {
+		t.Error = err.Error()
+		b.Error = err.Error()
+	}
+	b.Status = status
+	b.UpdatedAt = now
+	b.Transitions = append(b.Transitions, t)
+}
+
+func (s *BookingStore) setReservation(b *Booking, reservationID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b.ReservationID = reservationID
+}
+
+func newID(prefix string) string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// stepError carries the HTTP status a failed step maps to
+type stepError struct {
+	status int
+	err    error
+}
+
+func (e *stepError) Error() string { return e.err.Error() }
+
+// runStep wraps a workflow step in its own span
+func runStep(ctx context.Context, b *Booking, name string, fn func(context.Context) error) error {
+	ctx, span := tracer.Start(ctx, "booking."+name)
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("booking.id", b.ID),
+		attribute.String("booking.step", name),
+	)
+
+	err := fn(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		logger.Error(ctx, "Booking step failed", map[string]interface{}{
+			"booking_id": b.ID,
+			"step":       name,
+			"error":      err.Error(),
+		})
+	}
+	return err
+}
+
+func createBooking(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+
+	var req struct {
+		UserID    string `json:"user_id"`
+		ProductID string `json:"product_id"`
+		Quantity  int    `json:"quantity"`
+		Data      string `json:"data"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == "" || req.ProductID == "" || req.Quantity <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id, product_id and a positive quantity are required"})
+		recordRequest("POST", "/booking", http.StatusBadRequest, start)
+		return
+	}
+
+	now := time.Now()
+	id := newID("bk-")
+	booking := &Booking{
+		ID:        id,
+		SessionID: id,
+		UserID:    req.UserID,
+		ProductID: req.ProductID,
+		Quantity:  req.Quantity,
+		Status:    BookingPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	bookings.Add(booking)
+
+	// Tag every downstream span of the booking, including those in
+	// instabook-cache and inventory-service
+	ctx = platform.WithBaggage(ctx, "booking.id", id)
+	ctx = platform.WithBaggage(ctx, "user.id", req.UserID)
+
+	logger.Info(ctx, "Starting booking", map[string]interface{}{
+		"booking_id": id,
+		"user_id":    req.UserID,
+		"product_id": req.ProductID,
+		"quantity":   req.Quantity,
+	})
+
+	status := runBooking(ctx, booking, req.Data)
+	result, _ := bookings.Get(id)
+	recordBookingOutcome(ctx, result.Status)
+	publishBookingEvent(ctx, &result)
+	if result.Status == BookingConfirmed {
+		recordBookingOrder(ctx, &result)
+	}
+
+	logger.Info(ctx, "Booking finished", map[string]interface{}{
+		"booking_id": id,
+		"status":     result.Status,
+	})
+	c.JSON(status, result)
+	recordRequest("POST", "/booking", status, start)
+}
+
+// runBooking executes the workflow, compensating completed steps in reverse
+// order when a later one fails. It returns the HTTP status for the caller.
+func runBooking(ctx context.Context, b *Booking, data string) int {
+	err := runStep(ctx, b, "create_session", func(ctx context.Context) error {
+		session := Session{
+			ID:        b.SessionID,
+			UserID:    b.UserID,
+			BookingID: b.ID,
+			Status:    SessionPending,
+			Data:      data,
+		}
+		return expectCacheStatus(callCache(ctx, "POST", "/cache/session", session))
+	})
+	if err != nil {
+		bookings.transition(b, BookingFailed, "create_session", err)
+		return stepStatus(err)
+	}
+	bookings.transition(b, BookingPending, "create_session", nil)
+	publishSessionCreated(ctx, Session{
+		ID:        b.SessionID,
+		UserID:    b.UserID,
+		BookingID: b.ID,
+		Status:    SessionPending,
+	})
+
+	var reservationID string
+	err = runStep(ctx, b, "reserve_inventory", func(ctx context.Context) (err error) {
+		reservationID, err = reserveInventory(ctx, b.ProductID, b.Quantity)
+		return err
+	})
+	if err != nil {
+		return rollbackBooking(ctx, b, "reserve_inventory", err, false)
+	}
+	bookings.setReservation(b, reservationID)
+	bookings.transition(b, BookingReserved, "reserve_inventory", nil)
+
+	err = runStep(ctx, b, "confirm", func(ctx context.Context) error {
+		return setSessionStatus(ctx, b.SessionID, SessionPending, SessionConfirmed)
+	})
+	if err != nil {
+		return rollbackBooking(ctx, b, "confirm", err, true)
+	}
+	bookings.transition(b, BookingConfirmed, "confirm", nil)
+	return http.StatusCreated
+}
+
+// rollbackBooking undoes the steps completed before failedStep
+func rollbackBooking(ctx context.Context, b *Booking, failedStep string, cause error, reserved bool) int {
+	bookings.transition(b, b.Status, failedStep, cause)
+	status := stepStatus(cause)
+
+	if reserved {
+		err := runStep(ctx, b, "release_inventory", func(ctx context.Context) error {
+			return releaseInventory(ctx, b)
+		})
+		if err != nil {
+			bookings.transition(b, BookingFailed, "release_inventory", err)
+			return http.StatusInternalServerError
+		}
+	}
+
+	err := runStep(ctx, b, "cancel_session", func(ctx context.Context) error {
+		return setSessionStatus(ctx, b.SessionID, SessionPending, SessionRolledBack)
+	})
+	if err != nil {
+		bookings.transition(b, BookingFailed, "cancel_session", err)
+		return http.StatusInternalServerError
+	}
+	bookings.transition(b, BookingRolledBack, "cancel_session", nil)
+	return status
+}
+
+func stepStatus(err error) int {
+	if se, ok := err.(*stepError); ok {
+		return se.status
+	}
+	return http.StatusInternalServerError
+}
+
+func expectCacheStatus(resp *http.Response, err error) error {
+	if err != nil {
+		return &stepError{status: http.StatusServiceUnavailable, err: fmt.Errorf("cache service: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		status := http.StatusInternalServerError
+		if isClientError(resp.StatusCode) {
+			status = resp.StatusCode
+		}
+		return &stepError{status: status, err: fmt.Errorf("cache service returned %d", resp.StatusCode)}
+	}
+	return nil
+}
+
+// setSessionStatus moves the workflow's session from one status to another.
+// The workflow only makes transitions the state machine allows.
+func setSessionStatus(ctx context.Context, id, from, to string) error {
+	err := expectCacheStatus(callCache(ctx, "PATCH", "/cache/session/"+id, map[string]string{"status": to}))
+	if err == nil {
+		recordSessionTransition(ctx, id, from, to, true)
+	}
+	return err
+}
+
+// callInventory posts a JSON body to inventory-service and decodes the
+// response into out when it is non-nil
+func callInventory(ctx context.Context, path string, body, out interface{}) error {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", inventoryServiceURL+path, bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Actor", "instabook")
+
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	observeDependency("inventory", "POST", start, resp, err)
+	if err != nil {
+		return &stepError{status: http.StatusServiceUnavailable, err: fmt.Errorf("inventory service: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusConflict:
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &stepError{status: http.StatusConflict, err: fmt.Errorf("inventory service returned %d: %s", resp.StatusCode, bytes.TrimSpace(bodyBytes))}
+	case resp.StatusCode >= 400:
+		return &stepError{status: http.StatusInternalServerError, err: fmt.Errorf("inventory service returned %d", resp.StatusCode)}
+	}
+
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+func reserveInventory(ctx context.Context, productID string, quantity int) (string, error) {
+	var reservation struct {
+		ReservationID string `json:"reservation_id"`
+	}
+	body := map[string]interface{}{
+		"product_id": productID,
+		"quantity":   quantity,
+	}
+	if reservationCallbackURL != "" {
+		body["callback_url"] = reservationCallbackURL
+	}
+	err := callInventory(ctx, "/inventory/reserve", body, &reservation)
+	return reservation.ReservationID, err
+}
+
+// releaseInventory returns the booking's reserved stock. The reservation ID
+// is sent along so inventory-service's logs can be matched to the booking.
+func releaseInventory(ctx context.Context, b *Booking) error {
+	return callInventory(ctx, "/inventory/release", map[string]interface{}{
+		"product_id":     b.ProductID,
+		"quantity":       b.Quantity,
+		"reservation_id": b.ReservationID,
+	}, nil)
+}
+
+func getBooking(c *gin.Context) {
+	start := time.Now()
+
+	booking, ok := bookings.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		recordRequest("GET", "/booking/:id", http.StatusNotFound, start)
+		return
+	}
+	c.JSON(http.StatusOK, booking)
+	recordRequest("GET", "/booking/:id", http.StatusOK, start)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+// Circuit breaker states, also the values of the state gauge
+const (
+	CircuitClosed   = "closed"
+	CircuitHalfOpen = "half-open"
+	CircuitOpen     = "open"
+)
+
+var ErrCircuitOpen = errors.New("cache circuit breaker is open")
+
+var (
+	circuitState = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "instabook_cache_circuit_state",
+			Help: "State of the instabook-cache circuit breaker (0 closed, 1 half-open, 2 open)",
+		},
+	)
+	circuitTransitions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "instabook_cache_circuit_transitions_total",
+			Help: "Number of circuit breaker state changes",
+		},
+		[]string{"to"},
+	)
+	cacheRetries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "instabook_cache_retries_total",
+			Help: "Number of retried cache requests",
+		},
+	)
+)
+
+var circuitStateValues = map[string]float64{
+	CircuitClosed:   0,
+	CircuitHalfOpen: 1,
+	CircuitOpen:     2,
+}
+
+// CircuitBreaker stops calling the cache after consecutive failures and
+// lets a single probe through once the open timeout has passed
+type CircuitBreaker struct {
+	mu            sync.Mutex
+	threshold     int
+	openTimeout   time.Duration
+	state         string
+	failures      int
+	openedAt      time.Time
+	probeInFlight bool
+}
+
+var breaker *CircuitBreaker
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(config.Get(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+// NewCircuitBreakerFromEnv reads CB_FAILURE_THRESHOLD (default 5) and
+// CB_OPEN_TIMEOUT (default 30s)
+func NewCircuitBreakerFromEnv() *CircuitBreaker {
+	threshold := envInt("CB_FAILURE_THRESHOLD", 5)
+	openTimeout, err := time.ParseDuration(platform.GetEnv("CB_OPEN_TIMEOUT", "30s"))
+	if err != nil || openTimeout <= 0 {
+		openTimeout = 30 * time.Second
+	}
+	return &CircuitBreaker{threshold: threshold, openTimeout: openTimeout, state: CircuitClosed}
+}
+
+// setState records a transition; callers hold mu
+func (b *CircuitBreaker) setState(state string) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	circuitState.Set(circuitStateValues[state])
+	circuitTransitions.WithLabelValues(state).Inc()
+	logger.Warn(context.Background(), "Cache circuit breaker state changed", map[string]interface{}{
+		"state":    state,
+		"failures": b.failures,
+	})
+}
+
+// Allow reports whether a request may be sent to the cache
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.setState(CircuitHalfOpen)
+		b.probeInFlight = true
+		return true
+	case CircuitHalfOpen:
+		if b.probeInFlight {
+			return false
+		}
+		b.probeInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Record reports the outcome of a request that Allow let through
+func (b *CircuitBreaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probeInFlight = false
+	if success {
+		b.failures = 0
+		b.setState(CircuitClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.setState(CircuitOpen)
+	}
+}
+
+func (b *CircuitBreaker) Snapshot() gin.H {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snapshot := gin.H{
+		"state":                b.state,
+		"consecutive_failures": b.failures,
+		"failure_threshold":    b.threshold,
+		"open_timeout":         b.openTimeout.String(),
+	}
+	if b.state != CircuitClosed {
+		snapshot["opened_at"] = b.openedAt
+	}
+	return snapshot
+}
+
+func getCircuitState(c *gin.Context) {
+	c.JSON(http.StatusOK, breaker.Snapshot())
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"platform"
+)
+
+// Cancellation statuses. A confirmed booking moves to cancelling while its
+// session is cancelled and its stock released, then to cancelled.
+const (
+	BookingCancelling = "cancelling"
+	BookingCancelled  = "cancelled"
+)
+
+var (
+	cancelRetryMax     = 3
+	cancelRetryBackoff = 200 * time.Millisecond
+)
+
+var bookingCompensations = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "instabook_booking_compensations_total",
+		Help: "Number of cancellation compensation steps by step and result",
+	},
+	[]string{"step", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(bookingCompensations)
+
+	cancelRetryMax = envInt("CANCEL_RETRY_MAX", 3)
+	if d, err := time.ParseDuration(platform.GetEnv("CANCEL_RETRY_BACKOFF", "200ms")); err == nil && d > 0 {
+		cancelRetryBackoff = d
+	}
+}
+
+var (
+	// ErrBookingNotFound is returned for bookings that were never made or
+	// have been forgotten (see maxBookings)
+	ErrBookingNotFound = errors.New("booking not found")
+	// errNotCancellable is returned by beginCancel for bookings that aren't
+	// confirmed
+	errNotCancellable = errors.New("booking is not cancellable")
+)
+
+// beginCancel moves a confirmed booking to cancelling, so concurrent cancels
+// of the same booking can't both run
+func (s *BookingStore) beginCancel(id string) (*Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.bookings[id]
+	if !ok {
+		return nil, ErrBookingNotFound
+	}
+	if !s.startCancellingLocked(b, "cancel") {
+		return b, errNotCancellable
+	}
+	return b, nil
+}
+
+// startCancellingLocked moves a confirmed booking to cancelling, recording
+// step as the cause. Callers must hold s.mu.
+func (s *BookingStore) startCancellingLocked(b *Booking, step string) bool {
+	if b.Status != BookingConfirmed {
+		return false
+	}
+	now := time.Now()
+	b.Status = BookingCancelling
+	b.UpdatedAt = now
+	b.Transitions = append(b.Transitions, BookingTransition{Status: BookingCancelling, Step: step, At: now})
+	return true
+}
+
+// retryable reports whether a failed compensation step is worth retrying.
+// Conflicts, such as stock that is no longer reserved, won't change.
+func retryable(err error) bool {
+	return stepStatus(err) != http.StatusConflict
+}
+
+// runCompensation runs a cancellation step in its own span, retrying it
+// with doubling backoff up to cancelRetryMax times. Each attempt is a span
+// event, and the outcome is logged and counted.
+func runCompensation(ctx context.Context, b *Booking, name string, fn func(context.Context) error) error {
+	attempts := 0
+	err := runStep(ctx, b, name, func(ctx context.Context) error {
+		span := trace.SpanFromContext(ctx)
+		backoff := cancelRetryBackoff
+		for {
+			attempts++
+			err := fn(ctx)
+			span.AddEvent("attempt", trace.WithAttributes(
+				attribute.Int("attempt", attempts),
+				attribute.Bool("success", err == nil),
+			))
+			if err == nil || attempts > cancelRetryMax || !retryable(err) {
+				return err
+			}
+			logger.Warn(ctx, "Compensation step failed, retrying", map[string]interface{}{
+				"booking_id": b.ID,
+				"step":       name,
+				"attempt":    attempts,
+				"error":      err.Error(),
+			})
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	})
+
+	result := "success"
+	if err != nil {
+		result = "failed"
+	}
+	bookingCompensations.WithLabelValues(name, result).Inc()
+	logger.Info(ctx, "Compensation step finished", map[string]interface{}{
+		"booking_id": b.ID,
+		"step":       name,
+		"result":     result,
+		"attempts":   attempts,
+	})
+	return err
+}
+
+// cancelBooking cancels a confirmed booking: it cancels the session, then
+// releases the reserved stock. A session that can't be cancelled leaves the
+// booking confirmed. Stock that can't be released after the session was
+// cancelled leaves the booking failed, with the error, for an operator to
+// release by hand.
+func cancelBooking(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+	id := c.Param("id")
+
+	b, err := bookings.beginCancel(id)
+	if errors.Is(err, ErrBookingNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		recordRequest("POST", "/booking/:id/cancel", http.StatusNotFound, start)
+		return
+	}
+	if err != nil {
+		current, _ := bookings.Get(id)
+		// Cancelling twice is not an error
+		if current.Status == BookingCancelled {
+			c.JSON(http.StatusOK, current)
+			recordRequest("POST", "/booking/:id/cancel", http.StatusOK, start)
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "Only confirmed bookings can be cancelled", "status": current.Status})
+		recordRequest("POST", "/booking/:id/cancel", http.StatusConflict, start)
+		return
+	}
+
+	ctx = platform.WithBaggage(ctx, "booking.id", id)
+	ctx = platform.WithBaggage(ctx, "user.id", b.UserID)
+	logger.Info(ctx, "Cancelling booking", map[string]interface{}{
+		"booking_id":     id,
+		"reservation_id": b.ReservationID,
+	})
+
+	status := runCancellation(ctx, b)
+	result, _ := bookings.Get(id)
+	recordBookingOutcome(ctx, result.Status)
+	publishBookingEvent(ctx, &result)
+
+	logger.Info(ctx, "Booking cancellation finished", map[string]interface{}{
+		"booking_id": id,
+		"status":     result.Status,
+	})
+	c.JSON(status, result)
+	recordRequest("POST", "/booking/:id/cancel", status, start)
+}
+
+// runCancellation runs the compensation steps for a cancelling booking and
+// returns the HTTP status for the caller
+func runCancellation(ctx context.Context, b *Booking) int {
+	err := runCompensation(ctx, b, "cancel_session", func(ctx context.Context) error {
+		return cancelSession(ctx, b)
+	})
+	if err != nil {
+		bookings.transition(b, BookingConfirmed, "cancel_session", err)
+		return stepStatus(err)
+	}
+
+	err = runCompensation(ctx, b, "release_inventory", func(ctx context.Context) error {
+		return releaseInventory(ctx, b)
+	})
+	if err != nil {
+		bookings.transition(b, BookingFailed, "release_inventory", err)
+		return http.StatusInternalServerError
+	}
+	bookings.transition(b, BookingCancelled, "release_inventory", nil)
+	return http.StatusOK
+}
+
+// cancelSession sets the booking's session to cancelled. A session that has
+// already expired from the cache has nothing left to cancel.
+func cancelSession(ctx context.Context, b *Booking) error {
+	resp, err := callCache(ctx, "PATCH", "/cache/session/"+b.SessionID, map[string]string{"status": SessionCancelled})
+	if err == nil && resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		logger.Info(ctx, "Booking session already expired, nothing to cancel", map[string]interface{}{
+			"booking_id": b.ID,
+			"session_id": b.SessionID,
+		})
+		return nil
+	}
+	if err := expectCacheStatus(resp, err); err != nil {
+		return err
+	}
+	recordSessionTransition(ctx, b.SessionID, SessionConfirmed, SessionCancelled, true)
+	return nil
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+	"platform"
+)
+
+var configReloads = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "config_reloads_total",
+		Help: "Number of configuration reloads by result",
+	},
+	[]string{"result"},
+)
+
+// Config holds settings from CONFIG_FILE, a flat YAML or JSON map keyed by
+// the same names as the environment variables, e.g.
+//
+//	REQUEST_TIMEOUT: 5s
+//	RATE_LIMIT_RPS: 20
+//
+// Environment variables take precedence over the file.
+type Config struct {
+	mu       sync.RWMutex
+	path     string
+	values   map[string]string
+	onReload []func()
+}
+
+// config is loaded before any other package state, so a service with an
+// invalid configuration fails at startup
+var config = mustLoadConfig()
+
+func mustLoadConfig() *Config {
+	cfg := &Config{path: os.Getenv("CONFIG_FILE"), values: make(map[string]string)}
+	values, err := cfg.read()
+	if err == nil {
+		err = validateConfig(values)
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	cfg.values = values
+	// The shared platform helpers read the same settings
+	platform.SetLookup(cfg.Lookup)
+	return cfg
+}
+
+// Lookup returns the environment variable for key, falling back to the
+// config file
+func (cfg *Config) Lookup(key string) (string, bool) {
+	if value, ok := os.LookupEnv(key); ok {
+		return value, true
+	}
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	value, ok := cfg.values[key]
+	return value, ok
+}
+
+// Get returns the value for key, or "" when it is unset
+func (cfg *Config) Get(key string) string {
+	value, _ := cfg.Lookup(key)
+	return value
+}
+
+// OnReload registers fn to run after every successful reload
+func (cfg *Config) OnReload(fn func()) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.onReload = append(cfg.onReload, fn)
+}
+
+// Reload re-reads the config file. An invalid file leaves the current
+// settings in place. It returns the keys whose values changed.
+func (cfg *Config) Reload() ([]string, error) {
+	values, err := cfg.read()
+	if err == nil {
+		err = validateConfig(values)
+	}
+	if err != nil {
+		configReloads.WithLabelValues("failed").Inc()
+		return nil, err
+	}
+
+	cfg.mu.Lock()
+	var changed []string
+	for key, value := range values {
+		if old, ok := cfg.values[key]; !ok || old != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range cfg.values {
+		if _, ok := values[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	cfg.values = values
+	callbacks := append([]func(){}, cfg.onReload...)
+	cfg.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn()
+	}
+	sort.Strings(changed)
+	configReloads.WithLabelValues("success").Inc()
+	return changed, nil
+}
+
+// read parses the config file by its extension; .json files are JSON and
+// anything else is YAML
+func (cfg *Config) read() (map[string]string, error) {
+	values := make(map[string]string)
+	if cfg.path == "" {
+		return values, nil
+	}
+
+	data, err := os.ReadFile(cfg.path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]interface{})
+	if strings.EqualFold(filepath.Ext(cfg.path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.path, err)
+	}
+
+	for key, value := range raw {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("%s: %s must be a single value", cfg.path, key)
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+	return values, nil
+}
+
+// configRules validate the shared tunables. Each sees the effective value,
+// so a bad environment variable is caught as well as a bad file entry.
+var configRules = map[string]func(string) error{
+	"SHUTDOWN_TIMEOUT": validDuration,
+	"REQUEST_TIMEOUT":  validDuration,
+	"ROUTE_TIMEOUTS":   validRouteTimeouts,
+	"RATE_LIMIT_RPS":   validNumber,
+	"RATE_LIMIT_BURST": validNumber,
+	"CHAOS_FAULTS":     validChaosFaults,
+	"CACHE_SHADOW_PERCENT": func(v string) error {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		if n < 0 || n > 100 {
+			return fmt.Errorf("must be between 0 and 100, got %s", v)
+		}
+		return nil
+	},
+	"CACHE_SHADOW_TIMEOUT": validDuration,
+	"LOG_LEVEL": func(v string) error {
+		_, err := platform.ParseLogLevel(v)
+		return err
+	},
+	"LOG_INFO_SAMPLE_RATE": func(v string) error {
+		_, err := platform.ParseSampleRate(v)
+		return err
+	},
+	"RATE_LIMIT_KEY": func(v string) error {
+		if v != "ip" && v != "token" {
+			return fmt.Errorf("must be ip or token, got %q", v)
+		}
+		return nil
+	},
+}
+
+func validateConfig(values map[string]string) error {
+	keys := make([]string, 0, len(configRules))
+	for key := range configRules {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, ok := os.LookupEnv(key)
+		if !ok {
+			value, ok = values[key]
+		}
+		if !ok || value == "" {
+			continue
+		}
+		if err := configRules[key](value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func validDuration(v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+	if d < 0 {
+		return fmt.Errorf("must not be negative, got %s", v)
+	}
+	return nil
+}
+
+func validNumber(v string) error {
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("must not be negative, got %s", v)
+	}
+	return nil
+}
+
+func validRouteTimeouts(v string) error {
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, value, ok := strings.Cut(entry, "=")
+		if !ok || len(strings.Fields(route)) != 2 {
+			return fmt.Errorf("expected METHOD /route=duration, got %q", entry)
+		}
+		if err := validDuration(strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("%s: %w", strings.TrimSpace(route), err)
+		}
+	}
+	return nil
+}
+
+// reloadable builds a value from the config and rebuilds it after every
+// reload. The returned func returns the current value.
+func reloadable[T any](build func() T) func() T {
+	var mu sync.RWMutex
+	current := build()
+	config.OnReload(func() {
+		next := build()
+		mu.Lock()
+		current = next
+		mu.Unlock()
+	})
+	return func() T {
+		mu.RLock()
+		defer mu.RUnlock()
+		return current
+	}
+}
+
+// reloadConfig applies the config file and logs what changed
+func reloadConfig(ctx context.Context, trigger string) ([]string, error) {
+	changed, err := config.Reload()
+	if err != nil {
+		logger.Error(ctx, "Failed to reload configuration", map[string]interface{}{
+			"trigger": trigger,
+			"error":   err.Error(),
+		})
+		return nil, err
+	}
+	logger.Info(ctx, "Reloaded configuration", map[string]interface{}{
+		"trigger": trigger,
+		"changed": changed,
+	})
+	return changed, nil
+}
+
+// watchConfigReload reloads the config file on SIGHUP until ctx is done
+func watchConfigReload(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				reloadConfig(context.Background(), "signal")
+			}
+		}
+	}()
+}
+
+// postConfigReload reloads the config file on request
+func postConfigReload(c *gin.Context) {
+	changed, err := reloadConfig(c.Request.Context(), "api")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if changed == nil {
+		changed = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "reloaded", "changed": changed})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	dependencyDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "instabook_dependency_request_duration_seconds",
+			Help:    "Duration of each request instabook makes to a dependency, by response status or error",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"dependency", "method", "status"},
+	)
+	dependencyTimeouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "instabook_dependency_timeouts_total",
+			Help: "Number of requests to a dependency that timed out",
+		},
+		[]string{"dependency", "method"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(dependencyDuration)
+	prometheus.MustRegister(dependencyTimeouts)
+}
+
+// observeDependency records one request to dependency. status is the
+// response code, "timeout" or "error"; retries are observed separately, so
+// this is the dependency's own latency rather than the caller's.
+func observeDependency(dependency, method string, start time.Time, resp *http.Response, err error) {
+	status := "error"
+	switch {
+	case err == nil:
+		status = strconv.Itoa(resp.StatusCode)
+	case isTimeout(err):
+		status = "timeout"
+		dependencyTimeouts.WithLabelValues(dependency, method).Inc()
+	}
+	dependencyDuration.WithLabelValues(dependency, method, status).Observe(time.Since(start).Seconds())
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	eventbus "platform/events"
+)
+
+// EventSessionCreated is published to the broker when instabook-cache
+// confirms a new session
+const EventSessionCreated = "session.created"
+
+// domainEvents is nil unless EVENTS_BROKER is set
+var domainEvents *eventbus.Emitter
+
+// SessionCreated is the payload of session.created. The session's data is
+// left out; consumers read it from the cache if they need it.
+type SessionCreated struct {
+	SessionID string    `json:"session_id"`
+	UserID    string    `json:"user_id"`
+	BookingID string    `json:"booking_id,omitempty"`
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// publishSessionCreated adds the event to the outbox, keyed by session
+func publishSessionCreated(ctx context.Context, session Session) {
+	if domainEvents == nil {
+		return
+	}
+	event := SessionCreated{
+		SessionID: session.ID,
+		UserID:    session.UserID,
+		BookingID: session.BookingID,
+		Status:    session.Status,
+		ExpiresAt: session.ExpiresAt,
+	}
+	if err := domainEvents.Emit(ctx, EventSessionCreated, session.ID, event); err != nil {
+		logger.Error(ctx, "Failed to record session event", map[string]interface{}{
+			"session_id": session.ID,
+			"error":      err.Error(),
+		})
+	}
+}
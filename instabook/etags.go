@@ -0,0 +1,125 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var notModifiedResponses = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "instabook_cache_not_modified_total",
+		Help: "Number of session reads the cache service answered with 304 Not Modified",
+	},
+)
+
+func init() {
+	prometheus.MustRegister(notModifiedResponses)
+}
+
+// sessionCopies is nil when SESSION_ETAG_CACHE_ENTRIES is 0
+var sessionCopies = NewSessionCopiesFromEnv()
+
+type sessionCopy struct {
+	etag    string
+	session Session
+	element *list.Element
+}
+
+// SessionCopies remembers the last session read from the cache service and
+// its ETag, so polling a session sends If-None-Match and only transfers it
+// again once it has changed. Bounded to maxEntries with least recently used
+// eviction.
+type SessionCopies struct {
+	mu         sync.Mutex
+	entries    map[string]*sessionCopy
+	lru        *list.List
+	maxEntries int
+}
+
+func NewSessionCopies(maxEntries int) *SessionCopies {
+	return &SessionCopies{
+		entries:    make(map[string]*sessionCopy),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+// NewSessionCopiesFromEnv reads SESSION_ETAG_CACHE_ENTRIES (default 1000)
+func NewSessionCopiesFromEnv() *SessionCopies {
+	maxEntries := envInt("SESSION_ETAG_CACHE_ENTRIES", 1000)
+	if maxEntries <= 0 {
+		return nil
+	}
+	return NewSessionCopies(maxEntries)
+}
+
+// ETag returns the ETag of the copy held for id, or "" if there is none
+func (s *SessionCopies) ETag(id string) string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[id]; ok {
+		return entry.etag
+	}
+	return ""
+}
+
+// Get returns the copy held for id if its ETag is still etag
+func (s *SessionCopies) Get(id, etag string) (Session, bool) {
+	if s == nil {
+		return Session{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok || entry.etag != etag {
+		return Session{}, false
+	}
+	s.lru.MoveToFront(entry.element)
+	return entry.session, true
+}
+
+func (s *SessionCopies) Put(id, etag string, session Session) {
+	if s == nil {
+		return
+	}
+	if etag == "" {
+		s.Delete(id)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[id]; ok {
+		entry.etag = etag
+		entry.session = session
+		s.lru.MoveToFront(entry.element)
+		return
+	}
+
+	s.entries[id] = &sessionCopy{etag: etag, session: session, element: s.lru.PushFront(id)}
+	for len(s.entries) > s.maxEntries {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(string))
+	}
+}
+
+func (s *SessionCopies) Delete(id string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[id]; ok {
+		s.lru.Remove(entry.element)
+		delete(s.entries, id)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BookingEvent announces a finished booking workflow; Type is its final
+// status
+type BookingEvent struct {
+	Type      string    `json:"type"`
+	BookingID string    `json:"booking_id"`
+	UserID    string    `json:"user_id"`
+	ProductID string    `json:"product_id"`
+	Quantity  int       `json:"quantity"`
+	Error     string    `json:"error,omitempty"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// EventBroker fans out booking events to stream subscribers
+type EventBroker struct {
+	mu          sync.RWMutex
+	subscribers map[chan BookingEvent]struct{}
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+var events = NewEventBroker()
+
+func NewEventBroker() *EventBroker {
+	return &EventBroker{
+		subscribers: make(map[chan BookingEvent]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Close signals all open streams to finish, e.g. during shutdown
+func (b *EventBroker) Close() {
+	b.closeOnce.Do(func() { close(b.done) })
+}
+
+// Done is closed once the broker has been closed
+func (b *EventBroker) Done() <-chan struct{} {
+	return b.done
+}
+
+func (b *EventBroker) Subscribe() chan BookingEvent {
+	ch := make(chan BookingEvent, 64)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *EventBroker) Unsubscribe(ch chan BookingEvent) {
+	b.mu.Lock()
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+	close(ch)
+}
+
+// Publish never blocks; slow subscribers miss events rather than
+// stalling the request path.
+func (b *EventBroker) Publish(event BookingEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// publishBookingEvent announces the booking's final status to stream
+// subscribers
+func publishBookingEvent(ctx context.Context, b *Booking) {
+	event := BookingEvent{
+		Type:      b.Status,
+		BookingID: b.ID,
+		UserID:    b.UserID,
+		ProductID: b.ProductID,
+		Quantity:  b.Quantity,
+		Error:     b.Error,
+		Timestamp: time.Now().UTC(),
+	}
+	if sc := trace.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		event.TraceID = sc.TraceID().String()
+	}
+	events.Publish(event)
+}
+
+func streamBookingEvents(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Query("user_id")
+
+	logger.Info(ctx, "Booking event stream opened", map[string]interface{}{
+		"user_id":   userID,
+		"client_ip": c.ClientIP(),
+	})
+
+	ch := events.Subscribe()
+	defer events.Unsubscribe(ch)
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-events.Done():
+			return false
+		case <-heartbeat.C:
+			c.SSEvent("heartbeat", gin.H{"timestamp": time.Now().UTC()})
+			return true
+		case event := <-ch:
+			if userID != "" && event.UserID != userID {
+				return true
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		}
+	})
+
+	logger.Info(ctx, "Booking event stream closed", map[string]interface{}{
+		"user_id": userID,
+	})
+}
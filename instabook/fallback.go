@@ -0,0 +1,345 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+// fallbackHeader marks responses served from the local fallback store
+const fallbackHeader = "X-Instabook-Fallback"
+
+// fallback is nil unless SESSION_FALLBACK_ENABLED is set
+var fallback *FallbackStore
+
+var (
+	fallbackRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "instabook_fallback_requests_total",
+			Help: "Number of session requests served from the local fallback store",
+		},
+		[]string{"method"},
+	)
+	fallbackSessions = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "instabook_fallback_sessions",
+			Help: "Number of sessions held in the local fallback store",
+		},
+	)
+	fallbackReconciled = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "instabook_fallback_reconciled_total",
+			Help: "Number of fallback changes written back to the cache service",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(fallbackRequests)
+	prometheus.MustRegister(fallbackSessions)
+	prometheus.MustRegister(fallbackReconciled)
+}
+
+type fallbackEntry struct {
+	session *Session
+	// deleted entries are tombstones waiting to be deleted from the cache
+	deleted bool
+	element *list.Element
+}
+
+// FallbackStore holds sessions written while the cache service is
+// unavailable, bounded to maxEntries with least recently used eviction.
+// Every entry is pending until it has been reconciled to the cache.
+type FallbackStore struct {
+	mu         sync.Mutex
+	entries    map[string]*fallbackEntry
+	lru        *list.List
+	maxEntries int
+}
+
+func NewFallbackStore(maxEntries int) *FallbackStore {
+	return &FallbackStore{
+		entries:    make(map[string]*fallbackEntry),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+// NewFallbackStoreFromEnv returns nil unless SESSION_FALLBACK_ENABLED=true
+func NewFallbackStoreFromEnv() *FallbackStore {
+	if platform.GetEnv("SESSION_FALLBACK_ENABLED", "false") != "true" {
+		return nil
+	}
+	return NewFallbackStore(envInt("SESSION_FALLBACK_MAX_ENTRIES", 1000))
+}
+
+// Get returns a pending session. Deleted sessions are reported as found so
+// callers don't fall through to a stale copy in the cache.
+func (f *FallbackStore) Get(id string) (session Session, deleted, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.entries[id]
+	if !ok {
+		return Session{}, false, false
+	}
+	f.lru.MoveToFront(entry.element)
+	if entry.deleted {
+		return Session{}, true, true
+	}
+	return *entry.session, false, true
+}
+
+func (f *FallbackStore) Put(session Session) {
+	f.set(session.ID, &session, false)
+}
+
+func (f *FallbackStore) Delete(id string) {
+	f.set(id, nil, true)
+}
+
+func (f *FallbackStore) set(id string, session *Session, deleted bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if entry, ok := f.entries[id]; ok {
+		entry.session = session
+		entry.deleted = deleted
+		f.lru.MoveToFront(entry.element)
+		return
+	}
+
+	f.entries[id] = &fallbackEntry{session: session, deleted: deleted, element: f.lru.PushFront(id)}
+	for f.maxEntries > 0 && len(f.entries) > f.maxEntries {
+		oldest := f.lru.Back()
+		f.lru.Remove(oldest)
+		delete(f.entries, oldest.Value.(string))
+		fallbackReconciled.WithLabelValues("dropped").Inc()
+	}
+	fallbackSessions.Set(float64(len(f.entries)))
+}
+
+// remove drops an entry once it has been reconciled, unless it changed
+// again in the meantime
+func (f *FallbackStore) remove(id string, session *Session, deleted bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.entries[id]
+	if !ok || entry.session != session || entry.deleted != deleted {
+		return
+	}
+	f.lru.Remove(entry.element)
+	delete(f.entries, id)
+	fallbackSessions.Set(float64(len(f.entries)))
+}
+
+// Discard drops any pending change for id after a direct write to the cache
+// has superseded it
+func (f *FallbackStore) Discard(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if entry, ok := f.entries[id]; ok {
+		f.lru.Remove(entry.element)
+		delete(f.entries, id)
+		fallbackSessions.Set(float64(len(f.entries)))
+	}
+}
+
+type pendingChange struct {
+	id      string
+	session *Session
+	deleted bool
+}
+
+// pending returns the queued changes, oldest first
+func (f *FallbackStore) pending() []pendingChange {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	changes := make([]pendingChange, 0, len(f.entries))
+	for e := f.lru.Back(); e != nil; e = e.Prev() {
+		id := e.Value.(string)
+		entry := f.entries[id]
+		changes = append(changes, pendingChange{id: id, session: entry.session, deleted: entry.deleted})
+	}
+	return changes
+}
+
+// StartReconciler periodically writes pending changes back to the cache
+// until ctx is cancelled
+func (f *FallbackStore) StartReconciler(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				func() {
+					defer platform.RecoverPanic(ctx, logger, "fallback-reconcile")
+					f.Reconcile(ctx)
+				}()
+			}
+		}
+	}()
+}
+
+// Reconcile replays pending changes against the cache, stopping at the
+// first sign that it is still unavailable
+func (f *FallbackStore) Reconcile(ctx context.Context) {
+	changes := f.pending()
+	if len(changes) == 0 {
+		return
+	}
+
+	synced := 0
+	for _, change := range changes {
+		var resp *http.Response
+		var err error
+		if change.deleted {
+			resp, err = callCache(ctx, "DELETE", "/cache/session/"+change.id, nil)
+		} else {
+			resp, err = callCache(ctx, "POST", "/cache/session", change.session)
+		}
+		if err == nil && resp.StatusCode == http.StatusConflict {
+			// The session already exists, so replay the change as an update
+			resp.Body.Close()
+			resp, err = callCache(ctx, "PUT", "/cache/session/"+change.id, change.session)
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if cacheUnavailable(resp, err) {
+			fallbackReconciled.WithLabelValues("unavailable").Inc()
+			break
+		}
+
+		result := "synced"
+		if resp.StatusCode >= 400 && !(change.deleted && resp.StatusCode == http.StatusNotFound) {
+			// The cache rejected the change; retrying won't help
+			result = "rejected"
+			logger.Warn(ctx, "Cache rejected fallback session", map[string]interface{}{
+				"session_id":  change.id,
+				"status_code": resp.StatusCode,
+			})
+		}
+		fallbackReconciled.WithLabelValues(result).Inc()
+		f.remove(change.id, change.session, change.deleted)
+		synced++
+	}
+
+	logger.Info(ctx, "Reconciled fallback sessions", map[string]interface{}{
+		"synced":  synced,
+		"pending": len(changes) - synced,
+	})
+}
+
+// cacheUnavailable reports whether a cache call failed in a way that the
+// fallback store should absorb: the cache is unreachable, the circuit is
+// open, it rejected our token or it returned a server error
+func cacheUnavailable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusUnauthorized || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// serveFromFallback handles a session request locally when the fallback
+// store is enabled and the cache is unavailable. It returns true when it
+// has written a response.
+func serveFromFallback(ctx context.Context, c *gin.Context, resp *http.Response, err error, method, endpoint string, session *Session, start time.Time) bool {
+	if fallback == nil || !cacheUnavailable(resp, err) {
+		return false
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	reason := "cache_error"
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		reason = "circuit_open"
+	case err != nil:
+		reason = "connection_error"
+	case resp.StatusCode == http.StatusUnauthorized:
+		reason = "auth_failure"
+	}
+	recordCacheError(ctx, reason)
+	fallbackRequests.WithLabelValues(method).Inc()
+	c.Header(fallbackHeader, "true")
+
+	id := session.ID
+	logger.Warn(ctx, "Serving session from fallback store", map[string]interface{}{
+		"session_id": id,
+		"reason":     reason,
+	})
+
+	switch method {
+	case "GET":
+		if cached, deleted, ok := fallback.Get(id); ok && !deleted {
+			c.JSON(http.StatusOK, cached)
+			recordRequest(method, endpoint, http.StatusOK, start)
+			return true
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		recordRequest(method, endpoint, http.StatusNotFound, start)
+	case "DELETE":
+		fallback.Delete(id)
+		c.Status(http.StatusNoContent)
+		recordRequest(method, endpoint, http.StatusNoContent, start)
+	default:
+		if session.CreatedAt.IsZero() {
+			session.CreatedAt = time.Now()
+		}
+		fallback.Put(*session)
+		status := http.StatusOK
+		if method == "POST" {
+			status = http.StatusCreated
+		}
+		c.JSON(status, session)
+		recordRequest(method, endpoint, status, start)
+	}
+	return true
+}
+
+// discardFallback forgets a pending fallback change once the cache has
+// accepted a newer write for the same session
+func discardFallback(id string) {
+	if fallback != nil {
+		fallback.Discard(id)
+	}
+}
+
+// servePendingSession answers a GET from the fallback store when the
+// session has changes that haven't reached the cache yet
+func servePendingSession(c *gin.Context, id string, start time.Time) bool {
+	if fallback == nil {
+		return false
+	}
+	session, deleted, ok := fallback.Get(id)
+	if !ok {
+		return false
+	}
+
+	fallbackRequests.WithLabelValues("GET").Inc()
+	c.Header(fallbackHeader, "true")
+	if deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		recordRequest("GET", "/booking/session/:id", http.StatusNotFound, start)
+		return true
+	}
+	c.JSON(http.StatusOK, session)
+	recordRequest("GET", "/booking/session/:id", http.StatusOK, start)
+	return true
+}
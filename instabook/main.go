@@ -4,27 +4,47 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"platform"
+	eventbus "platform/events"
 )
 
+// OpenTelemetry export settings
+var telemetry = platform.Telemetry{ServiceName: "instabook"}
+
 // Logger
-var logger *StructuredLogger
+var logger = platform.NewStructuredLogger("instabook")
+
+// Tracer
+var tracer = telemetry.Tracer()
 
 // HTTP client
 var httpClient *http.Client
 
 // Configuration
 var (
-	cacheServiceURL string
-	apiToken        string
+	cacheServiceURL   string
+	apiToken          string
+	cacheRetryMax     int
+	cacheRetryBackoff = 100 * time.Millisecond
+
+	// cacheSigningSecret signs cache requests instead of sending apiToken
+	// when CACHE_AUTH_MODE=hmac
+	cacheSigningSecret []byte
 )
 
 // Session represents a booking session
@@ -35,25 +55,18 @@ type Session struct {
 	Status    string    `json:"status"`
 	CreatedAt time.Time `json:"created_at"`
 	Data      string    `json:"data"`
+
+	TTLSeconds int       `json:"ttl_seconds,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+
+	// SchemaVersion is set by instabook-cache; kept so updates round-trip it
+	SchemaVersion int `json:"schema_version,omitempty"`
 }
 
 // Prometheus metrics
 var (
-	requestCount = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "instabook_request_count",
-			Help: "Number of requests received by the instabook service",
-		},
-		[]string{"method", "endpoint", "status"},
-	)
-	responseTime = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "instabook_response_time",
-			Help:    "Response time of the instabook service",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "endpoint"},
-	)
+	requestCount, responseTime = platform.NewRequestMetrics("instabook", "instabook service")
+
 	cacheErrors = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "instabook_cache_errors",
@@ -63,54 +76,275 @@ var (
 	)
 )
 
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return fallback
-}
-
 func init() {
-	prometheus.MustRegister(requestCount)
-	prometheus.MustRegister(responseTime)
 	prometheus.MustRegister(cacheErrors)
+	prometheus.MustRegister(rateLimitedRequests)
+	prometheus.MustRegister(requestTimeouts)
+	prometheus.MustRegister(configReloads)
+	prometheus.MustRegister(chaosInjections)
+	prometheus.MustRegister(chaosActiveFaults)
+	prometheus.MustRegister(circuitState)
+	prometheus.MustRegister(circuitTransitions)
+	prometheus.MustRegister(cacheRetries)
+	prometheus.MustRegister(cacheShadowReads)
+
+	cacheServiceURL = platform.GetEnv("INSTABOOK_CACHE_SERVICE", "http://localhost:8086")
+	inventoryServiceURL = platform.GetEnv("INVENTORY_SERVICE", "http://localhost:8085")
+	apiToken = platform.GetEnv("INSTABOOK_API_TOKEN", "instabook-secret-token-2024")
+	if platform.GetEnv("CACHE_AUTH_MODE", "bearer") == "hmac" {
+		cacheSigningSecret = []byte(platform.GetEnv("CACHE_SIGNING_SECRET", ""))
+		if len(cacheSigningSecret) == 0 {
+			log.Fatalf("CACHE_AUTH_MODE=hmac requires CACHE_SIGNING_SECRET")
+		}
+	}
 
-	cacheServiceURL = getEnv("INSTABOOK_CACHE_SERVICE", "http://localhost:8086")
-	apiToken = getEnv("INSTABOOK_API_TOKEN", "instabook-secret-token-2024")
-	logger = NewStructuredLogger("instabook")
-
-	httpClient = &http.Client{
-		Timeout: 10 * time.Second,
+	// Outgoing cache calls carry the caller's trace context, over TLS when
+	// TLS_CA_FILE or a client certificate is configured
+	httpClient = platform.NewHTTPClient(logger, 10*time.Second)
+
+	breaker = NewCircuitBreakerFromEnv()
+	cacheShadow = reloadable(NewShadowConfigFromEnv)
+	shadowSlots = make(chan struct{}, envInt("CACHE_SHADOW_MAX_INFLIGHT", 20))
+	fallback = NewFallbackStoreFromEnv()
+	cacheRetryMax = envInt("CACHE_RETRY_MAX", 2)
+	if d, err := time.ParseDuration(platform.GetEnv("CACHE_RETRY_BACKOFF", "100ms")); err == nil && d > 0 {
+		cacheRetryBackoff = d
 	}
 }
 
-// callCache makes a request to the cache service with proper auth
+// callCache makes a request to the cache service with proper auth. Idempotent
+// GETs are retried with jittered backoff on connection errors and 5xx
+// responses; every attempt goes through the circuit breaker.
 func callCache(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
-	var reqBody io.Reader
+	return callCacheWithHeaders(ctx, method, path, body, nil)
+}
+
+// callCacheWithHeaders is callCache with extra request headers
+func callCacheWithHeaders(ctx context.Context, method, path string, body interface{}, header http.Header) (*http.Response, error) {
+	var jsonData []byte
 	if body != nil {
-		jsonData, err := json.Marshal(body)
+		var err error
+		jsonData, err = json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request body: %w", err)
 		}
-		reqBody = bytes.NewReader(jsonData)
 	}
 
-	url := cacheServiceURL + path
+	attempts := 1
+	if method == http.MethodGet {
+		attempts += cacheRetryMax
+	}
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			// Full jitter: sleep a random duration up to base * 2^attempt
+			backoff := time.Duration(rand.Int63n(int64(cacheRetryBackoff) << attempt))
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			cacheRetries.Inc()
+		}
+
+		resp, err = sendCacheRequest(ctx, method, cacheServiceURL+path, jsonData, header)
+		retryable := (err != nil && !errors.Is(err, ErrCircuitOpen)) || (err == nil && resp.StatusCode >= 500)
+		if !retryable || attempt == attempts-1 {
+			break
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}
+	if method == http.MethodGet && err == nil {
+		resp = shadowCacheRead(ctx, path, header, resp)
+	}
+	return resp, err
+}
+
+func sendCacheRequest(ctx context.Context, method, url string, body []byte, header http.Header) (*http.Response, error) {
+	if !breaker.Allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
 	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 	if err != nil {
+		breaker.Record(true)
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+apiToken)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	authenticateCacheRequest(req, body)
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
 
-	return httpClient.Do(req)
+	// Only unreachable or failing caches trip the breaker; a 401 is a
+	// healthy cache rejecting our token
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	observeDependency("cache", method, start, resp, err)
+	breaker.Record(err == nil && resp.StatusCode < 500)
+	return resp, err
+}
+
+// authenticateCacheRequest adds instabook's credentials to a cache request.
+// Signed requests carry no secret, so there's nothing to leak from a
+// captured request.
+func authenticateCacheRequest(req *http.Request, body []byte) {
+	if cacheSigningSecret != nil {
+		platform.SignRequest(req, body, cacheSigningSecret)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+apiToken)
+	}
 }
 
 func main() {
-	router := gin.Default()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Re-read CONFIG_FILE on SIGHUP
+	watchConfigReload(ctx)
+	config.OnReload(logger.LoadSettings)
+
+	// Write sessions held locally back to the cache once it recovers
+	if fallback != nil {
+		reconcileInterval, err := time.ParseDuration(platform.GetEnv("SESSION_FALLBACK_RECONCILE_INTERVAL", "10s"))
+		if err != nil || reconcileInterval <= 0 {
+			reconcileInterval = 10 * time.Second
+		}
+		fallback.StartReconciler(ctx, reconcileInterval)
+	}
+
+	// Optional asynchronous delivery of session writes
+	queue, err := NewSessionQueueFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize session queue: %v", err)
+	}
+	if queue != nil {
+		if memoryQueue, ok := queue.(*MemoryQueue); ok {
+			memoryQueue.Start(ctx)
+		}
+		sessionQueue = queue
+		defer queue.Close()
+	}
+
+	// Publish session.created to Kafka or NATS when EVENTS_BROKER is set
+	domainEvents, err = eventbus.NewEmitterFromEnv("instabook", logger)
+	if err != nil {
+		log.Fatalf("Failed to initialize event publishing: %v", err)
+	}
+	if domainEvents != nil {
+		domainEvents.Start(ctx)
+		defer domainEvents.Close()
+	}
+
+	tp, err := platform.InitTracer(ctx, telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		// Flush buffered spans before exiting
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			logger.Error(ctx, "Error shutting down tracer provider", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+
+	mp := initMeter()
+	if mp != nil {
+		defer func() {
+			// Push the last metrics before exiting
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := mp.Shutdown(ctx); err != nil {
+				logger.Error(ctx, "Error shutting down meter provider", map[string]interface{}{"error": err.Error()})
+			}
+		}()
+	}
+
+	// Send logs to the collector too when OTEL_LOGS_ENABLED=true
+	logExporter, err := platform.InitLogExport(ctx, logger, telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize log export: %v", err)
+	}
+	if logExporter != nil {
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := logExporter.Shutdown(ctx); err != nil {
+				log.Printf("Error shutting down log exporter: %v", err)
+			}
+		}()
+	}
+
+	// gin.New rather than gin.Default: the access log below replaces gin's
+	// plain-text request logger
+	router := gin.New()
+
+	// Gzip responses for clients that accept it
+	router.Use(platform.CompressionMiddleware())
+
+	// Correlate logs and errors by X-Request-ID, across services
+	router.Use(platform.RequestIDMiddleware())
+
+	// Add OpenTelemetry middleware
+	router.Use(otelgin.Middleware("instabook"))
+	router.Use(platform.MetricsMiddleware("instabook"))
+	router.Use(platform.AccessLogMiddleware(logger))
+
+	// Per-route SLO compliance, summarized on /slo. Event streams stay open
+	// until the client disconnects, so they are left out
+	slo := platform.NewSLOTrackerFromEnv("instabook", "GET /booking/events")
+	router.Use(slo.Middleware())
+
+	// Tag requests slower than their route's recent p99 on the span
+	outliers := platform.NewOutlierDetectorFromEnv("instabook", logger, "GET /booking/events")
+	outliers.AddQueue("session_queue", func() int {
+		if q, ok := sessionQueue.(*MemoryQueue); ok {
+			return q.Depth()
+		}
+		return 0
+	})
+	outliers.AddQueue("cache_shadow_reads", func() int { return len(shadowSlots) })
+	router.Use(outliers.Middleware())
+
+	// Turn handler panics into logged, traced and counted 500s
+	router.Use(platform.RecoveryMiddleware(logger))
+
+	// Browser access from the booking UI (CORS_* settings)
+	router.Use(platform.CORSMiddleware(platform.CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "DELETE"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-Request-ID", "Idempotency-Key"},
+		ExposedHeaders: []string{"X-Request-ID", "X-Instabook-Fallback", "Retry-After", "Location"},
+		MaxAge:         10 * time.Minute,
+	}))
+
+	// Opt-in capture of request and response bodies (DEBUG_RECORDER_*)
+	router.Use(platform.RecorderMiddleware())
+
+	// Per-client rate limiting (disabled unless RATE_LIMIT_RPS is set)
+	router.Use(rateLimitMiddleware(NewRateLimiterFromEnv))
+
+	// Per-request deadlines (REQUEST_TIMEOUT, ROUTE_TIMEOUTS)
+	router.Use(timeoutMiddleware(map[string]time.Duration{
+		// Event streams stay open until the client disconnects
+		"GET /booking/events": 0,
+	}))
+
+	// Injected faults from CHAOS_FAULTS and the /chaos API
+	StartChaosFromConfig()
+	router.Use(chaosMiddleware())
 
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
@@ -118,7 +352,33 @@ func main() {
 	})
 
 	// Metrics
-	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	if platform.PrometheusEnabled() {
+		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
+	router.POST("/config/reload", postConfigReload)
+	registerChaosRoutes(router)
+	platform.RegisterLogLevelRoutes(router, logger)
+	platform.RegisterAuditRoutes(router)
+	platform.RegisterRecordingRoutes(router)
+	platform.RegisterSLORoutes(router, slo)
+	platform.RegisterDependencyRoutes(router, "instabook")
+
+	// Hold /readyz at 503 until the collector and downstream services answer
+	startup := platform.NewStartupCheckerFromEnv("instabook", logger,
+		telemetry.CollectorDependency(),
+		platform.HTTPDependency("instabook-cache", cacheServiceURL),
+		platform.HTTPDependency("inventory-service", inventoryServiceURL),
+		platform.HTTPDependency("order-service", orderServiceURL),
+	)
+	startup.Start(ctx)
+	platform.RegisterStartupRoutes(router, startup)
+
+	// Cache circuit breaker state
+	router.GET("/debug/circuit", getCircuitState)
+
+	// Session queue depth and dead letters
+	router.GET("/debug/queue", getQueueState)
+	router.POST("/debug/queue/replay", replayDeadLetters)
 
 	// Get booking session
 	router.GET("/booking/session/:id", func(c *gin.Context) {
@@ -130,14 +390,33 @@ func main() {
 			"session_id": id,
 		})
 
-		// Call cache service
-		resp, err := callCache(ctx, "GET", "/cache/session/"+id, nil)
+		// Changes made while the cache was down are newer than its copy
+		if servePendingSession(c, id, start) {
+			return
+		}
+
+		// Call cache service, only transferring the session if it changed
+		// since the copy we last read
+		var header http.Header
+		if etag := sessionCopies.ETag(id); etag != "" {
+			header = http.Header{"If-None-Match": {etag}}
+		}
+		resp, err := callCacheWithHeaders(ctx, "GET", "/cache/session/"+id, nil, header)
+		if serveFromFallback(ctx, c, resp, err, "GET", "/booking/session/:id", &Session{ID: id}, start) {
+			return
+		}
+		if errors.Is(err, ErrCircuitOpen) {
+			recordCacheError(ctx, "circuit_open")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Cache service unavailable"})
+			requestCount.WithLabelValues("GET", "/booking/session/:id", "503").Inc()
+			return
+		}
 		if err != nil {
 			logger.Error(ctx, "Failed to call cache service", map[string]interface{}{
 				"session_id": id,
 				"error":      err.Error(),
 			})
-			cacheErrors.WithLabelValues("connection_error").Inc()
+			recordCacheError(ctx, "connection_error")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal service error"})
 			requestCount.WithLabelValues("GET", "/booking/session/:id", "500").Inc()
 			return
@@ -150,14 +429,39 @@ func main() {
 				"session_id":  id,
 				"status_code": resp.StatusCode,
 			})
-			cacheErrors.WithLabelValues("auth_failure").Inc()
+			recordCacheError(ctx, "auth_failure")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal service authentication failure"})
 			requestCount.WithLabelValues("GET", "/booking/session/:id", "500").Inc()
 			return
 		}
 
+		// The copy we sent the ETag of is still current
+		if resp.StatusCode == http.StatusNotModified {
+			if session, ok := sessionCopies.Get(id, resp.Header.Get("ETag")); ok {
+				notModifiedResponses.Inc()
+				c.JSON(http.StatusOK, session)
+				requestCount.WithLabelValues("GET", "/booking/session/:id", "200").Inc()
+				responseTime.WithLabelValues("GET", "/booking/session/:id").Observe(time.Since(start).Seconds())
+				return
+			}
+			// Evicted or replaced since the request went out; fetch it in full
+			resp, err = callCache(ctx, "GET", "/cache/session/"+id, nil)
+			if err != nil {
+				logger.Error(ctx, "Failed to call cache service", map[string]interface{}{
+					"session_id": id,
+					"error":      err.Error(),
+				})
+				recordCacheError(ctx, "connection_error")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal service error"})
+				requestCount.WithLabelValues("GET", "/booking/session/:id", "500").Inc()
+				return
+			}
+			defer resp.Body.Close()
+		}
+
 		// Handle 404 from cache
 		if resp.StatusCode == http.StatusNotFound {
+			sessionCopies.Delete(id)
 			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
 			requestCount.WithLabelValues("GET", "/booking/session/:id", "404").Inc()
 			return
@@ -171,7 +475,7 @@ func main() {
 				"status_code": resp.StatusCode,
 				"response":    string(bodyBytes),
 			})
-			cacheErrors.WithLabelValues("cache_error").Inc()
+			recordCacheError(ctx, "cache_error")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal service error"})
 			requestCount.WithLabelValues("GET", "/booking/session/:id", "500").Inc()
 			return
@@ -189,6 +493,7 @@ func main() {
 			return
 		}
 
+		sessionCopies.Put(id, resp.Header.Get("ETag"), session)
 		c.JSON(http.StatusOK, session)
 
 		duration := time.Since(start).Seconds()
@@ -216,14 +521,42 @@ func main() {
 			"user_id":    session.UserID,
 		})
 
-		// Call cache service to store session
-		resp, err := callCache(ctx, "POST", "/cache/session", session)
+		// New sessions start in any known status, pending by default
+		if session.Status == "" {
+			session.Status = SessionPending
+		}
+		if !validSessionStatus(session.Status) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Unknown session status", "status": session.Status, "valid": sessionStatuses()})
+			recordRequest("POST", "/booking/session", http.StatusUnprocessableEntity, start)
+			return
+		}
+
+		if enqueueSessionWrite(c, EventCreate, session.ID, &session, "POST", "/booking/session", start) {
+			return
+		}
+
+		// Call cache service to store session, forwarding the caller's
+		// Idempotency-Key so retries get the original session back
+		var header http.Header
+		if key := c.GetHeader("Idempotency-Key"); key != "" {
+			header = http.Header{"Idempotency-Key": []string{key}}
+		}
+		resp, err := callCacheWithHeaders(ctx, "POST", "/cache/session", session, header)
+		if serveFromFallback(ctx, c, resp, err, "POST", "/booking/session", &session, start) {
+			return
+		}
+		if errors.Is(err, ErrCircuitOpen) {
+			recordCacheError(ctx, "circuit_open")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Cache service unavailable"})
+			requestCount.WithLabelValues("POST", "/booking/session", "503").Inc()
+			return
+		}
 		if err != nil {
 			logger.Error(ctx, "Failed to call cache service", map[string]interface{}{
 				"session_id": session.ID,
 				"error":      err.Error(),
 			})
-			cacheErrors.WithLabelValues("connection_error").Inc()
+			recordCacheError(ctx, "connection_error")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal service error"})
 			requestCount.WithLabelValues("POST", "/booking/session", "500").Inc()
 			return
@@ -236,12 +569,19 @@ func main() {
 				"session_id":  session.ID,
 				"status_code": resp.StatusCode,
 			})
-			cacheErrors.WithLabelValues("auth_failure").Inc()
+			recordCacheError(ctx, "auth_failure")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal service authentication failure"})
 			requestCount.WithLabelValues("POST", "/booking/session", "500").Inc()
 			return
 		}
 
+		// Pass payload validation errors back to the caller
+		if isClientError(resp.StatusCode) {
+			passThrough(c, resp)
+			recordRequest("POST", "/booking/session", resp.StatusCode, start)
+			return
+		}
+
 		// Handle other errors
 		if resp.StatusCode >= 400 {
 			bodyBytes, _ := io.ReadAll(resp.Body)
@@ -250,7 +590,7 @@ func main() {
 				"status_code": resp.StatusCode,
 				"response":    string(bodyBytes),
 			})
-			cacheErrors.WithLabelValues("cache_error").Inc()
+			recordCacheError(ctx, "cache_error")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal service error"})
 			requestCount.WithLabelValues("POST", "/booking/session", "500").Inc()
 			return
@@ -268,17 +608,37 @@ func main() {
 			return
 		}
 
-		c.JSON(http.StatusCreated, createdSession)
-
-		duration := time.Since(start).Seconds()
-		requestCount.WithLabelValues("POST", "/booking/session", "201").Inc()
-		responseTime.WithLabelValues("POST", "/booking/session").Observe(duration)
+		// 200 for a recognized retry, 201 for a new session
+		discardFallback(createdSession.ID)
+		if resp.StatusCode == http.StatusCreated {
+			publishSessionCreated(ctx, createdSession)
+		}
+		c.JSON(resp.StatusCode, createdSession)
+		recordRequest("POST", "/booking/session", resp.StatusCode, start)
 	})
 
-	port := getEnv("PORT", "8087")
-	logger.Info(context.Background(), "Instabook Service starting", map[string]interface{}{
+	// Update and delete booking sessions
+	router.PUT("/booking/session/:id", updateBookingSession)
+	router.DELETE("/booking/session/:id", deleteBookingSession)
+	router.GET("/booking/sessions", getBookingSessions)
+
+	// Booking workflow: create session → reserve inventory → confirm
+	router.POST("/booking", createBooking)
+	router.GET("/booking/events", streamBookingEvents)
+	router.GET("/booking/:id", getBooking)
+	router.POST("/booking/:id/cancel", cancelBooking)
+	router.POST(inventoryWebhookPath, receiveInventoryWebhook)
+
+	port := platform.GetEnv("PORT", "8087")
+	logger.Info(ctx, "Instabook Service starting", map[string]interface{}{
 		"port":              port,
 		"cache_service_url": cacheServiceURL,
+		"inventory_service": inventoryServiceURL,
 	})
-	router.Run(":" + port)
+	if err := runServer(ctx, ":"+port, router); err != nil {
+		logger.Error(ctx, "Server error", map[string]interface{}{"error": err.Error()})
+	}
+
+	// Release pooled connections to the cache service
+	httpClient.CloseIdleConnections()
 }
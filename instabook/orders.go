@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+// orderServiceURL is where confirmed bookings are recorded; empty disables
+// recording
+var orderServiceURL string
+
+var orderRecords = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "instabook_order_records_total",
+		Help: "Number of confirmed bookings sent to order-service, by result",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(orderRecords)
+	orderServiceURL = platform.GetEnv("ORDER_SERVICE", "")
+}
+
+// recordBookingOrder writes a confirmed booking to order-service's order
+// history. The booking ID doubles as the order ID, so a retried write
+// replaces the earlier one. Failures are logged and counted but never undo
+// the booking.
+func recordBookingOrder(ctx context.Context, b *Booking) {
+	if orderServiceURL == "" {
+		return
+	}
+
+	err := runStep(ctx, b, "record_order", func(ctx context.Context) error {
+		body, err := json.Marshal(map[string]interface{}{
+			"id":        b.ID,
+			"user_id":   b.UserID,
+			"source":    "booking",
+			"reference": b.ID,
+			"status":    "placed",
+			"lines": []map[string]interface{}{
+				{"product_id": b.ProductID, "quantity": b.Quantity},
+			},
+			"created_at": b.CreatedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal order: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "POST", orderServiceURL+"/orders", bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Actor", "instabook")
+
+		start := time.Now()
+		resp, err := httpClient.Do(req)
+		observeDependency("orders", "POST", start, resp, err)
+		if err != nil {
+			return fmt.Errorf("order service: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("order service returned %d", resp.StatusCode)
+		}
+		return nil
+	})
+	if err != nil {
+		orderRecords.WithLabelValues("error").Inc()
+		return
+	}
+	orderRecords.WithLabelValues("success").Inc()
+}
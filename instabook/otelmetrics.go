@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"platform"
+)
+
+// OpenTelemetry instruments, exported over OTLP alongside the Prometheus
+// metrics on /metrics
+var (
+	bookingCounter    metric.Int64Counter
+	cacheErrorCounter metric.Int64Counter
+)
+
+// initMeter exports metrics over OTLP and creates the business instruments.
+// It returns nil when OTEL_METRICS_ENABLED=false; the instruments are then
+// no-ops.
+func initMeter() *sdkmetric.MeterProvider {
+	mp, err := platform.InitMeter(context.Background(), telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize metrics: %v", err)
+	}
+
+	meter := otel.Meter("instabook")
+	bookingCounter, _ = meter.Int64Counter("booking.outcomes", metric.WithDescription("Number of booking workflows by final status"))
+	cacheErrorCounter, _ = meter.Int64Counter("cache.errors", metric.WithDescription("Number of failed calls to instabook-cache by error type"))
+
+	return mp
+}
+
+// recordBookingOutcome counts a finished booking workflow
+func recordBookingOutcome(ctx context.Context, status string) {
+	bookingOutcomes.WithLabelValues(status).Inc()
+	bookingCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("booking.status", status)))
+}
+
+// recordCacheError counts a failed call to instabook-cache
+func recordCacheError(ctx context.Context, errorType string) {
+	cacheErrors.WithLabelValues(errorType).Inc()
+	cacheErrorCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("error.type", errorType)))
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"platform"
+)
+
+// Session event operations, matching instabook-cache's consumer
+const (
+	EventCreate = "create"
+	EventUpdate = "update"
+	EventDelete = "delete"
+)
+
+// SessionEvent is a session write queued for instabook-cache. ID doubles as
+// the Idempotency-Key for creates so redeliveries aren't rejected as
+// duplicates.
+type SessionEvent struct {
+	ID        string    `json:"id"`
+	Op        string    `json:"op"`
+	SessionID string    `json:"session_id"`
+	Session   *Session  `json:"session,omitempty"`
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
+	// Trace links delivery back to the request that queued the write
+	Trace platform.TraceCarrier `json:"trace,omitempty"`
+	// Error is the last delivery error, set on dead-lettered events
+	Error string `json:"error,omitempty"`
+}
+
+var ErrQueueFull = errors.New("session queue is full")
+
+// SessionQueue accepts session writes for asynchronous delivery to the cache
+type SessionQueue interface {
+	Enqueue(ctx context.Context, event SessionEvent) error
+	Close() error
+}
+
+// sessionQueue is nil unless SESSION_QUEUE is set; writes then go to the
+// cache synchronously
+var sessionQueue SessionQueue
+
+var (
+	queueEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "instabook_session_queue_events_total",
+			Help: "Number of queued session events by result",
+		},
+		[]string{"op", "result"},
+	)
+	queueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "instabook_session_queue_depth",
+			Help: "Number of session events waiting to be delivered to the cache",
+		},
+	)
+	dlqDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "instabook_session_queue_dlq_depth",
+			Help: "Number of session events in the dead letter queue",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(queueEvents)
+	prometheus.MustRegister(queueDepth)
+	prometheus.MustRegister(dlqDepth)
+}
+
+// NewSessionQueueFromEnv picks the queue from SESSION_QUEUE: "memory" for
+// the in-process queue, "nats" to publish to NATS_URL. It returns nil when
+// queueing is disabled.
+func NewSessionQueueFromEnv() (SessionQueue, error) {
+	switch platform.GetEnv("SESSION_QUEUE", "") {
+	case "memory":
+		backoff, err := time.ParseDuration(platform.GetEnv("SESSION_QUEUE_RETRY_BACKOFF", "1s"))
+		if err != nil || backoff <= 0 {
+			backoff = time.Second
+		}
+		return NewMemoryQueue(
+			envInt("SESSION_QUEUE_SIZE", 1000),
+			envInt("SESSION_QUEUE_MAX_ATTEMPTS", 10),
+			envInt("SESSION_DLQ_SIZE", 1000),
+			backoff,
+		), nil
+	case "nats":
+		return NewNATSQueue(platform.GetEnv("NATS_URL", "nats://nats:4222"), platform.GetEnv("SESSION_QUEUE_SUBJECT", "instabook.sessions"))
+	case "":
+		return nil, nil
+	default:
+		return nil, errors.New("unknown SESSION_QUEUE " + platform.GetEnv("SESSION_QUEUE", ""))
+	}
+}
+
+// maxQueueBackoff caps the delay between delivery attempts
+const maxQueueBackoff = 30 * time.Second
+
+// MemoryQueue delivers events to instabook-cache's /cache/events consumer
+// from a single worker, so writes to a session are applied in order. A
+// failing event is retried with exponential backoff and holds up the events
+// behind it; after maxAttempts, or on a permanent rejection, it moves to the
+// dead letter queue.
+type MemoryQueue struct {
+	events      chan SessionEvent
+	maxAttempts int
+	backoff     time.Duration
+
+	mu      sync.Mutex
+	dlq     []SessionEvent
+	dlqSize int
+}
+
+func NewMemoryQueue(size, maxAttempts, dlqSize int, backoff time.Duration) *MemoryQueue {
+	return &MemoryQueue{
+		events:      make(chan SessionEvent, size),
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		dlqSize:     dlqSize,
+	}
+}
+
+func (q *MemoryQueue) Enqueue(ctx context.Context, event SessionEvent) error {
+	select {
+	case q.events <- event:
+		queueEvents.WithLabelValues(event.Op, "enqueued").Inc()
+		queueDepth.Set(float64(len(q.events)))
+		return nil
+	default:
+		queueEvents.WithLabelValues(event.Op, "rejected_full").Inc()
+		return ErrQueueFull
+	}
+}
+
+// Start runs the delivery worker until ctx is done
+func (q *MemoryQueue) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-q.events:
+				queueDepth.Set(float64(len(q.events)))
+				q.deliver(ctx, event)
+			}
+		}
+	}()
+}
+
+func (q *MemoryQueue) deliver(ctx context.Context, event SessionEvent) {
+	ctx, span := platform.StartLinked(ctx, tracer, "session_queue.deliver", event.Trace)
+	defer span.End()
+	defer platform.RecoverPanic(ctx, logger, "session-queue-delivery")
+	span.SetAttributes(
+		attribute.String("event.id", event.ID),
+		attribute.String("event.op", event.Op),
+		attribute.String("session.id", event.SessionID),
+	)
+
+	for {
+		event.Attempts++
+		permanent, err := sendSessionEvent(ctx, event)
+		if err == nil {
+			queueEvents.WithLabelValues(event.Op, "delivered").Inc()
+			return
+		}
+
+		if permanent || event.Attempts >= q.maxAttempts {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			event.Error = err.Error()
+			q.deadLetter(ctx, event)
+			return
+		}
+
+		queueEvents.WithLabelValues(event.Op, "retried").Inc()
+		delay := q.backoff << (event.Attempts - 1)
+		if delay > maxQueueBackoff || delay <= 0 {
+			delay = maxQueueBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// sendSessionEvent posts the event to the cache. permanent is true when the
+// cache rejected the event outright, so retrying won't help.
+func sendSessionEvent(ctx context.Context, event SessionEvent) (permanent bool, err error) {
+	resp, err := callCache(ctx, "POST", "/cache/events", event)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 400 {
+		return false, nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	err = errors.New(resp.Status + ": " + string(body))
+	// 401s are retried like outages; the token toggle is usually flipped back
+	permanent = resp.StatusCode < 500 && resp.StatusCode != http.StatusUnauthorized
+	return permanent, err
+}
+
+func (q *MemoryQueue) deadLetter(ctx context.Context, event SessionEvent) {
+	logger.Error(ctx, "Session event moved to dead letter queue", map[string]interface{}{
+		"event_id":   event.ID,
+		"op":         event.Op,
+		"session_id": event.SessionID,
+		"attempts":   event.Attempts,
+		"error":      event.Error,
+	})
+	queueEvents.WithLabelValues(event.Op, "dead_lettered").Inc()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.dlq = append(q.dlq, event)
+	if len(q.dlq) > q.dlqSize {
+		q.dlq = q.dlq[len(q.dlq)-q.dlqSize:]
+	}
+	dlqDepth.Set(float64(len(q.dlq)))
+}
+
+// DeadLetters returns a copy of the dead letter queue, oldest first
+func (q *MemoryQueue) DeadLetters() []SessionEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]SessionEvent(nil), q.dlq...)
+}
+
+// Replay moves every dead-lettered event back onto the queue with a fresh
+// attempt budget. Events that don't fit stay in the dead letter queue.
+func (q *MemoryQueue) Replay(ctx context.Context) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	replayed := 0
+	for _, event := range q.dlq {
+		event.Attempts = 0
+		event.Error = ""
+		if err := q.Enqueue(ctx, event); err != nil {
+			break
+		}
+		replayed++
+	}
+	q.dlq = q.dlq[replayed:]
+	dlqDepth.Set(float64(len(q.dlq)))
+	return replayed
+}
+
+func (q *MemoryQueue) Depth() int {
+	return len(q.events)
+}
+
+func (q *MemoryQueue) Close() error {
+	return nil
+}
+
+// NATSQueue publishes events to a NATS subject consumed by instabook-cache,
+// which handles retries and dead-lettering. The client buffers publishes
+// while reconnecting, so brief broker outages are absorbed too.
+type NATSQueue struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func NewNATSQueue(url, subject string) (*NATSQueue, error) {
+	conn, err := nats.Connect(url, nats.Name("instabook"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	return &NATSQueue{conn: conn, subject: subject}, nil
+}
+
+func (q *NATSQueue) Enqueue(ctx context.Context, event SessionEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := q.conn.Publish(q.subject, data); err != nil {
+		queueEvents.WithLabelValues(event.Op, "rejected_full").Inc()
+		return err
+	}
+	queueEvents.WithLabelValues(event.Op, "enqueued").Inc()
+	return nil
+}
+
+func (q *NATSQueue) Close() error {
+	return q.conn.Drain()
+}
+
+// enqueueSessionWrite queues a session write when queueing is enabled and
+// answers 202 Accepted. It returns true when it has written a response.
+func enqueueSessionWrite(c *gin.Context, op, id string, session *Session, method, endpoint string, start time.Time) bool {
+	if sessionQueue == nil {
+		return false
+	}
+	ctx := c.Request.Context()
+
+	if op != EventDelete && (id == "" || session.UserID == "") {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Session requires id and user_id"})
+		recordRequest(method, endpoint, http.StatusUnprocessableEntity, start)
+		return true
+	}
+
+	// A caller's Idempotency-Key becomes the event ID, so a retried create
+	// is recognized by the cache
+	eventID := c.GetHeader("Idempotency-Key")
+	if eventID == "" {
+		eventID = newID("evt-")
+	}
+	event := SessionEvent{
+		ID:        eventID,
+		Op:        op,
+		SessionID: id,
+		Session:   session,
+		CreatedAt: time.Now(),
+		Trace:     platform.InjectTrace(ctx),
+	}
+	if err := sessionQueue.Enqueue(ctx, event); err != nil {
+		logger.Error(ctx, "Failed to queue session write", map[string]interface{}{
+			"session_id": id,
+			"op":         op,
+			"error":      err.Error(),
+		})
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session queue unavailable"})
+		recordRequest(method, endpoint, http.StatusServiceUnavailable, start)
+		return true
+	}
+
+	logger.Info(ctx, "Queued session write", map[string]interface{}{
+		"session_id": id,
+		"op":         op,
+		"event_id":   eventID,
+	})
+	c.JSON(http.StatusAccepted, gin.H{"status": "queued", "event_id": eventID, "session_id": id})
+	recordRequest(method, endpoint, http.StatusAccepted, start)
+	return true
+}
+
+// getQueueState reports the in-process queue's depth and dead letters
+func getQueueState(c *gin.Context) {
+	q, ok := sessionQueue.(*MemoryQueue)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "In-process session queue not enabled"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"depth":        q.Depth(),
+		"dead_letters": q.DeadLetters(),
+	})
+}
+
+// replayDeadLetters requeues dead-lettered events
+func replayDeadLetters(c *gin.Context) {
+	q, ok := sessionQueue.(*MemoryQueue)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "In-process session queue not enabled"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"replayed": q.Replay(c.Request.Context())})
+}
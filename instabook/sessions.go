@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBatchIDs matches the limit of instabook-cache's batch endpoint
+const maxBatchIDs = 100
+
+func recordRequest(method, endpoint string, status int, start time.Time) {
+	requestCount.WithLabelValues(method, endpoint, strconv.Itoa(status)).Inc()
+	responseTime.WithLabelValues(method, endpoint).Observe(time.Since(start).Seconds())
+}
+
+// handleCacheFailure maps a failed cache call onto the booking response in
+// the same way as the GET and POST handlers. It returns true when it has
+// written a response.
+func handleCacheFailure(ctx context.Context, c *gin.Context, resp *http.Response, err error, method, endpoint, id string, start time.Time) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		recordCacheError(ctx, "circuit_open")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Cache service unavailable"})
+		recordRequest(method, endpoint, http.StatusServiceUnavailable, start)
+		return true
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to call cache service", map[string]interface{}{
+			"session_id": id,
+			"error":      err.Error(),
+		})
+		recordCacheError(ctx, "connection_error")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal service error"})
+		recordRequest(method, endpoint, http.StatusInternalServerError, start)
+		return true
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		// Token authentication disabled on the cache
+		logger.Error(ctx, "Cache authentication failed", map[string]interface{}{
+			"session_id":  id,
+			"status_code": resp.StatusCode,
+		})
+		recordCacheError(ctx, "auth_failure")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal service authentication failure"})
+		recordRequest(method, endpoint, http.StatusInternalServerError, start)
+		return true
+	case resp.StatusCode == http.StatusNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		recordRequest(method, endpoint, http.StatusNotFound, start)
+		return true
+	case isClientError(resp.StatusCode):
+		passThrough(c, resp)
+		recordRequest(method, endpoint, resp.StatusCode, start)
+		return true
+	case resp.StatusCode >= 400:
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		logger.Error(ctx, "Cache service returned error", map[string]interface{}{
+			"session_id":  id,
+			"status_code": resp.StatusCode,
+			"response":    string(bodyBytes),
+		})
+		recordCacheError(ctx, "cache_error")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal service error"})
+		recordRequest(method, endpoint, http.StatusInternalServerError, start)
+		return true
+	}
+	return false
+}
+
+// isClientError reports cache responses caused by the caller's request,
+// which are passed through rather than turned into a 500
+func isClientError(status int) bool {
+	return status == http.StatusConflict || status == http.StatusRequestEntityTooLarge || status == http.StatusUnprocessableEntity
+}
+
+func passThrough(c *gin.Context, resp *http.Response) {
+	body, _ := io.ReadAll(resp.Body)
+	c.Data(resp.StatusCode, "application/json", body)
+}
+
+func updateBookingSession(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+	id := c.Param("id")
+
+	var session Session
+	if err := c.ShouldBindJSON(&session); err != nil {
+		logger.Error(ctx, "Failed to parse session data", map[string]interface{}{
+			"session_id": id,
+			"error":      err.Error(),
+		})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session data"})
+		recordRequest("PUT", "/booking/session/:id", http.StatusBadRequest, start)
+		return
+	}
+
+	logger.Info(ctx, "Updating booking session", map[string]interface{}{
+		"session_id": id,
+		"user_id":    session.UserID,
+	})
+
+	if session.Status != "" && !validSessionStatus(session.Status) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Unknown session status", "status": session.Status, "valid": sessionStatuses()})
+		recordRequest("PUT", "/booking/session/:id", http.StatusUnprocessableEntity, start)
+		return
+	}
+	// Enforce the session state machine. A session that can't be read is
+	// left to the write below, which reports the same failure.
+	if from, ok := currentSessionStatus(ctx, id); ok {
+		if session.Status == "" {
+			session.Status = from
+		}
+		allowed := allowedTransition(from, session.Status)
+		if from != session.Status {
+			recordSessionTransition(ctx, id, from, session.Status, allowed)
+		}
+		if !allowed {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":   "Invalid status transition",
+				"from":    from,
+				"to":      session.Status,
+				"allowed": nextStatuses(from),
+			})
+			recordRequest("PUT", "/booking/session/:id", http.StatusUnprocessableEntity, start)
+			return
+		}
+	}
+
+	if enqueueSessionWrite(c, EventUpdate, id, &session, "PUT", "/booking/session/:id", start) {
+		return
+	}
+
+	resp, err := callCache(ctx, "PUT", "/cache/session/"+id, session)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	session.ID = id
+	if serveFromFallback(ctx, c, resp, err, "PUT", "/booking/session/:id", &session, start) {
+		return
+	}
+	if handleCacheFailure(ctx, c, resp, err, "PUT", "/booking/session/:id", id, start) {
+		return
+	}
+
+	var updated Session
+	if err := json.NewDecoder(resp.Body).Decode(&updated); err != nil {
+		logger.Error(ctx, "Failed to decode cache response", map[string]interface{}{
+			"session_id": id,
+			"error":      err.Error(),
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal service error"})
+		recordRequest("PUT", "/booking/session/:id", http.StatusInternalServerError, start)
+		return
+	}
+
+	discardFallback(id)
+	c.JSON(http.StatusOK, updated)
+	recordRequest("PUT", "/booking/session/:id", http.StatusOK, start)
+}
+
+func deleteBookingSession(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+	id := c.Param("id")
+
+	logger.Info(ctx, "Deleting booking session", map[string]interface{}{
+		"session_id": id,
+	})
+
+	if enqueueSessionWrite(c, EventDelete, id, nil, "DELETE", "/booking/session/:id", start) {
+		return
+	}
+
+	resp, err := callCache(ctx, "DELETE", "/cache/session/"+id, nil)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if serveFromFallback(ctx, c, resp, err, "DELETE", "/booking/session/:id", &Session{ID: id}, start) {
+		return
+	}
+	if handleCacheFailure(ctx, c, resp, err, "DELETE", "/booking/session/:id", id, start) {
+		return
+	}
+
+	discardFallback(id)
+	c.Status(http.StatusNoContent)
+	recordRequest("DELETE", "/booking/session/:id", http.StatusNoContent, start)
+}
+
+// getBookingSessions reads every session in ?ids= (comma separated) with a
+// single call to the cache, for the booking dashboard. Sessions with changes
+// still pending in the fallback store are answered from it.
+func getBookingSessions(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, value := range c.QueryArray("ids") {
+		for _, id := range strings.Split(value, ",") {
+			id = strings.TrimSpace(id)
+			if id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids is required"})
+		recordRequest("GET", "/booking/sessions", http.StatusBadRequest, start)
+		return
+	}
+	if len(ids) > maxBatchIDs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At most " + strconv.Itoa(maxBatchIDs) + " ids per request"})
+		recordRequest("GET", "/booking/sessions", http.StatusBadRequest, start)
+		return
+	}
+
+	logger.Info(ctx, "Getting booking sessions", map[string]interface{}{
+		"count": len(ids),
+	})
+
+	found := make(map[string]Session, len(ids))
+	missing := make(map[string]bool)
+	failed := make(map[string]ItemFailure)
+	failer := chaos.batchFaults("GET", "/booking/sessions")
+	var fromCache []string
+	for _, id := range ids {
+		if failure, ok := failer.fail(id); ok {
+			failed[id] = failure
+			continue
+		}
+		if fallback != nil {
+			if session, deleted, ok := fallback.Get(id); ok {
+				fallbackRequests.WithLabelValues("GET").Inc()
+				if deleted {
+					missing[id] = true
+				} else {
+					found[id] = session
+				}
+				continue
+			}
+		}
+		fromCache = append(fromCache, id)
+	}
+
+	if len(fromCache) > 0 {
+		resp, err := callCache(ctx, "POST", "/cache/sessions/batch", map[string][]string{"ids": fromCache})
+		if resp != nil {
+			defer resp.Body.Close()
+		}
+		if handleCacheFailure(ctx, c, resp, err, "GET", "/booking/sessions", strings.Join(fromCache, ","), start) {
+			return
+		}
+
+		var batch struct {
+			Found   []Session     `json:"found"`
+			Missing []string      `json:"missing"`
+			Failed  []ItemFailure `json:"failed"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+			logger.Error(ctx, "Failed to decode cache response", map[string]interface{}{
+				"error": err.Error(),
+			})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal service error"})
+			recordRequest("GET", "/booking/sessions", http.StatusInternalServerError, start)
+			return
+		}
+		for _, session := range batch.Found {
+			found[session.ID] = session
+		}
+		for _, id := range batch.Missing {
+			missing[id] = true
+		}
+		for _, failure := range batch.Failed {
+			failed[failure.ID] = failure
+		}
+	}
+
+	// All three lists follow the order of ?ids=
+	foundList := make([]Session, 0, len(found))
+	missingList := make([]string, 0, len(missing))
+	failedList := make([]ItemFailure, 0, len(failed))
+	for _, id := range ids {
+		if session, ok := found[id]; ok {
+			foundList = append(foundList, session)
+		} else if missing[id] {
+			missingList = append(missingList, id)
+		} else if failure, ok := failed[id]; ok {
+			failedList = append(failedList, failure)
+		}
+	}
+	if len(failedList) > 0 {
+		logger.Warn(ctx, "Some booking sessions failed to load", map[string]interface{}{
+			"requested": len(ids),
+			"failed":    len(failedList),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"found":   foundList,
+		"missing": missingList,
+		"failed":  failedList,
+	})
+	recordRequest("GET", "/booking/sessions", http.StatusOK, start)
+}
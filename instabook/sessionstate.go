@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Session statuses. A session moves pending → confirmed → completed, and
+// can be cancelled until it completes. rolled_back is set by the booking
+// workflow when it compensates a failed booking.
+const (
+	SessionPending    = "pending"
+	SessionConfirmed  = "confirmed"
+	SessionCompleted  = "completed"
+	SessionCancelled  = "cancelled"
+	SessionRolledBack = "rolled_back"
+)
+
+// sessionTransitions lists the statuses each status can move to. Completed,
+// cancelled and rolled back sessions are final.
+var sessionTransitions = map[string][]string{
+	SessionPending:    {SessionConfirmed, SessionCancelled, SessionRolledBack},
+	SessionConfirmed:  {SessionCompleted, SessionCancelled, SessionRolledBack},
+	SessionCompleted:  {},
+	SessionCancelled:  {},
+	SessionRolledBack: {},
+}
+
+var sessionStatusChanges = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "instabook_session_transitions_total",
+		Help: "Number of session status changes by from and to status and whether they were allowed",
+	},
+	[]string{"from", "to", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(sessionStatusChanges)
+}
+
+// sessionStatuses returns every known status, for error responses
+func sessionStatuses() []string {
+	statuses := make([]string, 0, len(sessionTransitions))
+	for status := range sessionTransitions {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	return statuses
+}
+
+func validSessionStatus(status string) bool {
+	_, ok := sessionTransitions[status]
+	return ok
+}
+
+// allowedTransition reports whether a session can move from one status to
+// another. Keeping the same status is always allowed, and so is any move
+// from a status outside the state machine, which only sessions written
+// before it existed can have.
+func allowedTransition(from, to string) bool {
+	if from == to {
+		return true
+	}
+	next, ok := sessionTransitions[from]
+	if !ok {
+		return true
+	}
+	for _, status := range next {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// nextStatuses returns the statuses a session can move to from status, for
+// error responses
+func nextStatuses(status string) []string {
+	next := append([]string{}, sessionTransitions[status]...)
+	sort.Strings(next)
+	return next
+}
+
+// statusLabel keeps metric labels to the known statuses
+func statusLabel(status string) string {
+	if validSessionStatus(status) {
+		return status
+	}
+	return "other"
+}
+
+// recordSessionTransition logs, traces and counts a session status change
+// as it is accepted or rejected. Rejected changes are logged at WARN so
+// scenarios can assert on them.
+func recordSessionTransition(ctx context.Context, id, from, to string, allowed bool) {
+	result := "allowed"
+	if !allowed {
+		result = "rejected"
+	}
+	sessionStatusChanges.WithLabelValues(statusLabel(from), statusLabel(to), result).Inc()
+	trace.SpanFromContext(ctx).AddEvent("session.transition", trace.WithAttributes(
+		attribute.String("session.id", id),
+		attribute.String("session.status.from", from),
+		attribute.String("session.status.to", to),
+		attribute.String("result", result),
+	))
+
+	fields := map[string]interface{}{
+		"session_id": id,
+		"from":       from,
+		"to":         to,
+	}
+	if !allowed {
+		logger.Warn(ctx, "Rejected invalid session status transition", fields)
+		return
+	}
+	logger.Info(ctx, "Session status transition accepted", fields)
+}
+
+// currentSessionStatus reads the session's status, preferring a change still
+// pending in the fallback store. ok is false when the session can't be read,
+// in which case the update goes ahead and fails or succeeds on its own.
+func currentSessionStatus(ctx context.Context, id string) (status string, ok bool) {
+	if fallback != nil {
+		if session, deleted, found := fallback.Get(id); found {
+			return session.Status, !deleted
+		}
+	}
+
+	resp, err := callCache(ctx, "GET", "/cache/session/"+id, nil)
+	if err != nil {
+		return "", false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", false
+	}
+
+	var session Session
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return "", false
+	}
+	return session.Status, true
+}
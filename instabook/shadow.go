@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"platform"
+)
+
+// maxShadowDiffs caps how many differing fields a mismatch log lists
+const maxShadowDiffs = 10
+
+var cacheShadowReads = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "instabook_cache_shadow_reads_total",
+		Help: "Number of cache reads mirrored to CACHE_SHADOW_URL by result: match, mismatch, error or dropped",
+	},
+	[]string{"result"},
+)
+
+// ShadowConfig mirrors a share of cache reads to a second cache, to check
+// a new deployment answers the same as the current one before switching
+type ShadowConfig struct {
+	URL string
+	// Percent of GETs mirrored, 0-100
+	Percent float64
+	Timeout time.Duration
+	// IgnoreFields are JSON field names left out of the comparison, at any
+	// depth, for values that legitimately differ between deployments
+	IgnoreFields map[string]bool
+}
+
+// cacheShadow returns the current shadow settings, nil when shadowing is off
+var cacheShadow func() *ShadowConfig
+
+// shadowSlots bounds the shadow reads in flight; reads beyond it are
+// dropped rather than queued
+var shadowSlots chan struct{}
+
+// NewShadowConfigFromEnv reads CACHE_SHADOW_URL, CACHE_SHADOW_PERCENT
+// (default 10), CACHE_SHADOW_TIMEOUT (default 2s) and
+// CACHE_SHADOW_IGNORE_FIELDS (comma-separated). It returns nil unless
+// CACHE_SHADOW_URL is set.
+func NewShadowConfigFromEnv() *ShadowConfig {
+	url := strings.TrimRight(platform.GetEnv("CACHE_SHADOW_URL", ""), "/")
+	if url == "" {
+		return nil
+	}
+	percent, err := strconv.ParseFloat(platform.GetEnv("CACHE_SHADOW_PERCENT", "10"), 64)
+	if err != nil || percent < 0 || percent > 100 {
+		percent = 10
+	}
+	timeout, err := time.ParseDuration(platform.GetEnv("CACHE_SHADOW_TIMEOUT", "2s"))
+	if err != nil || timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	ignore := make(map[string]bool)
+	for _, field := range strings.Split(platform.GetEnv("CACHE_SHADOW_IGNORE_FIELDS", ""), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			ignore[field] = true
+		}
+	}
+	return &ShadowConfig{URL: url, Percent: percent, Timeout: timeout, IgnoreFields: ignore}
+}
+
+// errorReader returns err once the bytes before it have been read
+type errorReader struct{ err error }
+
+func (r errorReader) Read([]byte) (int, error) { return 0, r.err }
+
+// shadowCacheRead mirrors a sample of cache GETs to the shadow cache. The
+// primary response body is buffered so both can be compared, and handed
+// back unchanged; the shadow request runs in the background and never
+// affects what the caller sees.
+func shadowCacheRead(ctx context.Context, path string, header http.Header, primary *http.Response) *http.Response {
+	cfg := cacheShadow()
+	if cfg == nil || rand.Float64()*100 >= cfg.Percent {
+		return primary
+	}
+	select {
+	case shadowSlots <- struct{}{}:
+	default:
+		cacheShadowReads.WithLabelValues("dropped").Inc()
+		return primary
+	}
+
+	body, err := io.ReadAll(primary.Body)
+	primary.Body.Close()
+	if err != nil {
+		// The caller still sees the read fail where it would have
+		primary.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errorReader{err}))
+		<-shadowSlots
+		return primary
+	}
+	primary.Body = io.NopCloser(bytes.NewReader(body))
+
+	// The shadow read outlives the request, so it keeps the trace but not
+	// the request's cancellation
+	shadowCtx := trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+	go func() {
+		defer func() { <-shadowSlots }()
+		compareShadowRead(shadowCtx, cfg, path, header.Clone(), primary.StatusCode, body)
+	}()
+	return primary
+}
+
+func compareShadowRead(ctx context.Context, cfg *ShadowConfig, path string, header http.Header, primaryStatus int, primaryBody []byte) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	ctx, span := tracer.Start(ctx, "cache.shadow_read")
+	defer span.End()
+	span.SetAttributes(attribute.String("cache.path", path), attribute.Int("cache.primary_status", primaryStatus))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.URL+path, nil)
+	if err != nil {
+		cacheShadowReads.WithLabelValues("error").Inc()
+		return
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	authenticateCacheRequest(req, nil)
+
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	observeDependency("cache-shadow", http.MethodGet, start, resp, err)
+	if err != nil {
+		cacheShadowReads.WithLabelValues("error").Inc()
+		span.RecordError(err)
+		logger.Warn(ctx, "Shadow cache read failed", map[string]interface{}{
+			"path":  path,
+			"error": err.Error(),
+		})
+		return
+	}
+	defer resp.Body.Close()
+	shadowBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		cacheShadowReads.WithLabelValues("error").Inc()
+		span.RecordError(err)
+		return
+	}
+	span.SetAttributes(attribute.Int("cache.shadow_status", resp.StatusCode))
+
+	diffs := diffBodies(primaryBody, shadowBody, cfg.IgnoreFields)
+	if resp.StatusCode == primaryStatus && len(diffs) == 0 {
+		cacheShadowReads.WithLabelValues("match").Inc()
+		return
+	}
+	cacheShadowReads.WithLabelValues("mismatch").Inc()
+	span.SetAttributes(attribute.Bool("cache.shadow_mismatch", true))
+	logger.Warn(ctx, "Shadow cache response differs from primary", map[string]interface{}{
+		"path":           path,
+		"primary_status": primaryStatus,
+		"shadow_status":  resp.StatusCode,
+		"fields":         diffs,
+	})
+}
+
+// diffBodies lists the JSON fields that differ between two response
+// bodies, like "data" or "items[2].status". Bodies that aren't both JSON
+// are compared byte for byte and reported as "body".
+func diffBodies(primary, shadow []byte, ignore map[string]bool) []string {
+	var a, b interface{}
+	if json.Unmarshal(primary, &a) != nil || json.Unmarshal(shadow, &b) != nil {
+		if bytes.Equal(primary, shadow) {
+			return nil
+		}
+		return []string{"body"}
+	}
+	var diffs []string
+	diffJSON("", a, b, ignore, &diffs)
+	return diffs
+}
+
+func diffJSON(path string, a, b interface{}, ignore map[string]bool, diffs *[]string) {
+	if len(*diffs) >= maxShadowDiffs {
+		return
+	}
+	name := path
+	if name == "" {
+		name = "body"
+	}
+
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok {
+			*diffs = append(*diffs, name)
+			return
+		}
+		keys := make([]string, 0, len(a)+len(b))
+		for key := range a {
+			keys = append(keys, key)
+		}
+		for key := range b {
+			if _, ok := a[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if ignore[key] {
+				continue
+			}
+			field := key
+			if path != "" {
+				field = path + "." + key
+			}
+			av, aok := a[key]
+			bv, bok := b[key]
+			if aok != bok {
+				if len(*diffs) < maxShadowDiffs {
+					*diffs = append(*diffs, field)
+				}
+				continue
+			}
+			diffJSON(field, av, bv, ignore, diffs)
+		}
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			*diffs = append(*diffs, name)
+			return
+		}
+		for i := range a {
+			diffJSON(fmt.Sprintf("%s[%d]", path, i), a[i], b[i], ignore, diffs)
+		}
+	default:
+		if a != b {
+			*diffs = append(*diffs, name)
+		}
+	}
+}
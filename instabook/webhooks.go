@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+// inventoryWebhookPath receives inventory-service's reservation webhooks
+const inventoryWebhookPath = "/booking/inventory-webhook"
+
+// maxWebhookAge rejects replayed webhooks
+const maxWebhookAge = 5 * time.Minute
+
+var (
+	// reservationCallbackURL is sent with reservations when
+	// INSTABOOK_PUBLIC_URL is set, so inventory-service can report
+	// reservations it releases on its own
+	reservationCallbackURL string
+	webhookSecret          []byte
+)
+
+var inventoryWebhooks = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "instabook_inventory_webhooks_total",
+		Help: "Number of reservation webhooks received from inventory-service by event and result",
+	},
+	[]string{"event", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(inventoryWebhooks)
+
+	if base := platform.Get("INSTABOOK_PUBLIC_URL"); base != "" {
+		reservationCallbackURL = base + inventoryWebhookPath
+	}
+	webhookSecret = []byte(platform.Get("RESERVATION_WEBHOOK_SECRET"))
+}
+
+// claimReservation finds the confirmed booking holding the reservation and
+// moves it to cancelling. Bookings are scanned; there are at most
+// maxBookings of them.
+func (s *BookingStore) claimReservation(reservationID, step string) (*Booking, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.bookings {
+		if b.ReservationID == reservationID {
+			return b, s.startCancellingLocked(b, step)
+		}
+	}
+	return nil, false
+}
+
+// validWebhookSignature checks the X-Inventory-Signature of body. Without
+// RESERVATION_WEBHOOK_SECRET every webhook is accepted.
+func validWebhookSignature(timestamp, signature string, body []byte) bool {
+	if len(webhookSecret) == 0 {
+		return true
+	}
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(sent, 0)).Abs() > maxWebhookAge {
+		return false
+	}
+	mac := hmac.New(sha256.New, webhookSecret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// receiveInventoryWebhook cancels the booking whose reservation
+// inventory-service expired or force-released. The stock is already back,
+// so only the session is cancelled.
+func receiveInventoryWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 64<<10))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook"})
+		recordRequest("POST", inventoryWebhookPath, http.StatusBadRequest, start)
+		return
+	}
+	if !validWebhookSignature(c.GetHeader("X-Inventory-Timestamp"), c.GetHeader("X-Inventory-Signature"), body) {
+		logger.Warn(ctx, "Rejected inventory webhook with a bad signature", map[string]interface{}{
+			"client_ip": c.ClientIP(),
+		})
+		inventoryWebhooks.WithLabelValues("unverified", "bad_signature").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		recordRequest("POST", inventoryWebhookPath, http.StatusUnauthorized, start)
+		return
+	}
+
+	var webhook struct {
+		Event         string `json:"event"`
+		ReservationID string `json:"reservation_id"`
+		Reason        string `json:"reason"`
+	}
+	err = json.Unmarshal(body, &webhook)
+	if err != nil || webhook.ReservationID == "" || (webhook.Event != "reservation.expired" && webhook.Event != "reservation.released") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook"})
+		recordRequest("POST", inventoryWebhookPath, http.StatusBadRequest, start)
+		return
+	}
+
+	// Unknown or already finished bookings are acknowledged, so
+	// inventory-service doesn't retry them
+	b, ok := bookings.claimReservation(webhook.ReservationID, webhook.Event)
+	if !ok {
+		inventoryWebhooks.WithLabelValues(webhook.Event, "ignored").Inc()
+		c.JSON(http.StatusOK, gin.H{"status": "ignored"})
+		recordRequest("POST", inventoryWebhookPath, http.StatusOK, start)
+		return
+	}
+
+	ctx = platform.WithBaggage(ctx, "booking.id", b.ID)
+	logger.Warn(ctx, "Reservation released by inventory-service, cancelling booking", map[string]interface{}{
+		"booking_id":     b.ID,
+		"reservation_id": webhook.ReservationID,
+		"event":          webhook.Event,
+		"reason":         webhook.Reason,
+	})
+
+	err = runCompensation(ctx, b, "cancel_session", func(ctx context.Context) error {
+		return cancelSession(ctx, b)
+	})
+	if err != nil {
+		// The stock is gone either way, so the booking can't go back to
+		// confirmed
+		bookings.transition(b, BookingFailed, "cancel_session", err)
+	} else {
+		bookings.transition(b, BookingCancelled, "cancel_session", nil)
+	}
+	result, _ := bookings.Get(b.ID)
+	recordBookingOutcome(ctx, result.Status)
+	publishBookingEvent(ctx, &result)
+
+	inventoryWebhooks.WithLabelValues(webhook.Event, result.Status).Inc()
+	c.JSON(http.StatusOK, gin.H{"status": result.Status, "booking_id": b.ID})
+	recordRequest("POST", inventoryWebhookPath, http.StatusOK, start)
+}
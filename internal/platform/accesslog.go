@@ -0,0 +1,52 @@
+package platform
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessLogMiddleware writes one "HTTP request processed" line per request
+// with the same fields in every service: method, path, route (the route
+// template, or "unmatched"), status_code, latency_ms, request_size,
+// response_size, client_ip and user_agent. Mount it after otelgin so the
+// line carries the request's trace ID. Server errors are logged as Warn so
+// they survive Info sampling.
+func AccessLogMiddleware(logger *StructuredLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		requestSize := c.Request.ContentLength
+		if requestSize < 0 {
+			requestSize = 0
+		}
+		responseSize := c.Writer.Size()
+		if responseSize < 0 {
+			responseSize = 0
+		}
+		status := c.Writer.Status()
+
+		fields := map[string]interface{}{
+			"method":        c.Request.Method,
+			"path":          c.Request.URL.Path,
+			"route":         route,
+			"status_code":   status,
+			"latency_ms":    time.Since(start).Milliseconds(),
+			"request_size":  requestSize,
+			"response_size": responseSize,
+			"client_ip":     c.ClientIP(),
+			"user_agent":    c.Request.UserAgent(),
+		}
+		if status >= http.StatusInternalServerError {
+			logger.Warn(c.Request.Context(), "HTTP request processed", fields)
+			return
+		}
+		logger.Info(c.Request.Context(), "HTTP request processed", fields)
+	}
+}
@@ -0,0 +1,88 @@
+package platform
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BearerAuth rejects requests without "Authorization: Bearer <token>". An
+// empty token allows every request.
+func BearerAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.Next()
+			return
+		}
+		got, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
+type logLevelRequest struct {
+	Level          *string  `json:"level"`
+	InfoSampleRate *float64 `json:"info_sample_rate"`
+}
+
+// RegisterLogLevelRoutes mounts GET and PUT /admin/loglevel to read and
+// change logger's minimum level and Info sampling at runtime. Requests must
+// carry ADMIN_TOKEN as a Bearer token when it is set.
+func RegisterLogLevelRoutes(router gin.IRouter, logger *StructuredLogger) {
+	group := router.Group("/admin", BearerAuth(Get("ADMIN_TOKEN")))
+
+	settings := func() gin.H {
+		return gin.H{
+			"level":            strings.ToLower(string(logger.Level())),
+			"info_sample_rate": logger.InfoSampleRate(),
+		}
+	}
+
+	group.GET("/loglevel", func(c *gin.Context) {
+		c.JSON(http.StatusOK, settings())
+	})
+	group.PUT("/loglevel", func(c *gin.Context) {
+		var req logLevelRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		// Validate both before applying either
+		level := logger.Level()
+		if req.Level != nil {
+			parsed, err := ParseLogLevel(*req.Level)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "level " + err.Error()})
+				return
+			}
+			level = parsed
+		}
+		rate := logger.InfoSampleRate()
+		if req.InfoSampleRate != nil {
+			if *req.InfoSampleRate < 0 || *req.InfoSampleRate > 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "info_sample_rate must be between 0 and 1"})
+				return
+			}
+			rate = *req.InfoSampleRate
+		}
+
+		logger.SetLevel(level)
+		logger.SetInfoSampleRate(rate)
+		RecordAudit(c, "loglevel.set", map[string]interface{}{
+			"level":            string(level),
+			"info_sample_rate": rate,
+		})
+		// Warn so the change is logged at any level but error
+		logger.Warn(c.Request.Context(), "Log settings changed", map[string]interface{}{
+			"level":            string(level),
+			"info_sample_rate": rate,
+		})
+		c.JSON(http.StatusOK, settings())
+	})
+}
@@ -0,0 +1,225 @@
+package platform
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditEntry is one admin operation. Hash covers every other field and the
+// previous entry's hash, so editing or removing an entry breaks the chain.
+type AuditEntry struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	// Actor is the caller's X-Actor header, or its IP without one
+	Actor string `json:"actor"`
+	// Credential identifies the Bearer token used without revealing it
+	Credential string                 `json:"credential,omitempty"`
+	RemoteAddr string                 `json:"remote_addr"`
+	RequestID  string                 `json:"request_id,omitempty"`
+	Action     string                 `json:"action"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	PrevHash   string                 `json:"prev_hash"`
+	Hash       string                 `json:"hash"`
+}
+
+// hash computes the entry's chain hash from everything but Hash itself
+func (e AuditEntry) hash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditLog is an append-only, hash-chained record of admin operations. The
+// newest maxEntries are kept in memory; with a file every entry is also
+// appended there, and the chain continues across restarts.
+type AuditLog struct {
+	mu         sync.Mutex
+	entries    []AuditEntry
+	maxEntries int
+	seq        uint64
+	head       string
+	file       *os.File
+}
+
+var (
+	auditOnce sync.Once
+	auditLog  *AuditLog
+)
+
+// Audit returns the process's audit log, reading AUDIT_LOG_FILE and
+// AUDIT_LOG_MAX_ENTRIES (default 1000) the first time
+func Audit() *AuditLog {
+	auditOnce.Do(func() {
+		maxEntries, err := strconv.Atoi(GetEnv("AUDIT_LOG_MAX_ENTRIES", "1000"))
+		if err != nil || maxEntries <= 0 {
+			maxEntries = 1000
+		}
+		auditLog = NewAuditLog(maxEntries)
+		if path := GetEnv("AUDIT_LOG_FILE", ""); path != "" {
+			if err := auditLog.open(path); err != nil {
+				log.Printf("Audit log file %s unavailable, keeping the audit log in memory: %v", path, err)
+			}
+		}
+	})
+	return auditLog
+}
+
+func NewAuditLog(maxEntries int) *AuditLog {
+	return &AuditLog{maxEntries: maxEntries}
+}
+
+// open loads the entries already in path and appends new ones to it
+func (l *AuditLog) open(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Kept out of memory, and the next entry won't link up, so
+			// verification points at the damage
+			continue
+		}
+		l.add(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return err
+	}
+	l.file = f
+	return nil
+}
+
+func (l *AuditLog) add(entry AuditEntry) {
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > l.maxEntries {
+		l.entries = append([]AuditEntry(nil), l.entries[len(l.entries)-l.maxEntries:]...)
+	}
+	l.seq = entry.Seq
+	l.head = entry.Hash
+}
+
+// Record appends an entry for the admin operation c is handling
+func (l *AuditLog) Record(c *gin.Context, action string, details map[string]interface{}) AuditEntry {
+	actor := c.GetHeader("X-Actor")
+	if actor == "" {
+		actor = c.ClientIP()
+	}
+	var credential string
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && token != "" {
+		sum := sha256.Sum256([]byte(token))
+		credential = "sha256:" + hex.EncodeToString(sum[:6])
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := AuditEntry{
+		Seq:        l.seq + 1,
+		Time:       time.Now().UTC(),
+		Actor:      actor,
+		Credential: credential,
+		RemoteAddr: c.ClientIP(),
+		RequestID:  RequestID(c.Request.Context()),
+		Action:     action,
+		Details:    details,
+		PrevHash:   l.head,
+	}
+	entry.Hash = entry.hash()
+	l.add(entry)
+
+	if l.file != nil {
+		data, _ := json.Marshal(entry)
+		if _, err := l.file.Write(append(data, '\n')); err != nil {
+			log.Printf("Failed to write audit entry %d: %v", entry.Seq, err)
+		}
+	}
+	return entry
+}
+
+// RecordAudit appends an entry to the process's audit log
+func RecordAudit(c *gin.Context, action string, details map[string]interface{}) {
+	Audit().Record(c, action, details)
+}
+
+// AuditStatus is the GET /admin/audit response
+type AuditStatus struct {
+	Entries  []AuditEntry `json:"entries"`
+	Head     string       `json:"head"`
+	Verified bool         `json:"verified"`
+	// BrokenAt is the first entry whose hash or link doesn't match
+	BrokenAt uint64 `json:"broken_at,omitempty"`
+}
+
+// Status returns the entries held in memory, oldest first, and whether
+// their chain is intact. The oldest entry held anchors the chain, so only
+// a log that still starts at seq 1 is checked back to the beginning.
+func (l *AuditLog) Status() AuditStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status := AuditStatus{
+		Entries:  append([]AuditEntry{}, l.entries...),
+		Head:     l.head,
+		Verified: true,
+	}
+	for i, entry := range l.entries {
+		linked := entry.PrevHash == ""
+		if i > 0 {
+			linked = entry.PrevHash == l.entries[i-1].Hash
+		} else if entry.Seq > 1 {
+			linked = true
+		}
+		if !linked || entry.Hash != entry.hash() {
+			status.Verified = false
+			status.BrokenAt = entry.Seq
+			break
+		}
+	}
+	return status
+}
+
+// RegisterAuditRoutes mounts GET /admin/audit, which requires ADMIN_TOKEN as
+// a Bearer token when it is set. ?action= filters by action prefix and
+// ?limit= keeps the newest entries; verification covers every entry held.
+func RegisterAuditRoutes(router gin.IRouter) {
+	router.GET("/admin/audit", BearerAuth(Get("ADMIN_TOKEN")), func(c *gin.Context) {
+		status := Audit().Status()
+
+		if action := c.Query("action"); action != "" {
+			filtered := status.Entries[:0]
+			for _, entry := range status.Entries {
+				if strings.HasPrefix(entry.Action, action) {
+					filtered = append(filtered, entry)
+				}
+			}
+			status.Entries = filtered
+		}
+		if v := c.Query("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+				return
+			}
+			if len(status.Entries) > limit {
+				status.Entries = status.Entries[len(status.Entries)-limit:]
+			}
+		}
+		c.JSON(http.StatusOK, status)
+	})
+}
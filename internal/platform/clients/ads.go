@@ -0,0 +1,156 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ad is an ad-service ad
+type Ad struct {
+	ID          string     `json:"id"`
+	RedirectURL string     `json:"redirect_url"`
+	Text        string     `json:"text"`
+	ImageURL    string     `json:"image_url"`
+	ProductID   int        `json:"product_id,omitempty"`
+	Category    string     `json:"category"`
+	CampaignID  string     `json:"campaign_id,omitempty"`
+	Targeting   *Targeting `json:"targeting,omitempty"`
+	Priority    int        `json:"priority,omitempty"`
+	// Price is the product's live catalog price, set on served ads
+	Price *AdPrice `json:"price,omitempty"`
+}
+
+// Targeting restricts which viewers an ad is shown to
+type Targeting struct {
+	Regions   []string `json:"regions,omitempty"`
+	Devices   []string `json:"devices,omitempty"`
+	Interests []string `json:"interests,omitempty"`
+}
+
+// AdPrice is the catalog price quoted in an ad
+type AdPrice struct {
+	Amount    float64   `json:"amount"`
+	Currency  string    `json:"currency"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AdStats are an ad's recorded impressions and clicks
+type AdStats struct {
+	AdID           string     `json:"ad_id"`
+	Impressions    int64      `json:"impressions"`
+	Clicks         int64      `json:"clicks"`
+	CTR            float64    `json:"ctr"`
+	LastImpression *time.Time `json:"last_impression,omitempty"`
+	LastClick      *time.Time `json:"last_click,omitempty"`
+}
+
+// AdQuery selects ads for GET /ads. Everything is optional.
+type AdQuery struct {
+	ProductIDs     []int
+	Category       string
+	Region         string
+	Device         string
+	PastCategories []string
+	SessionID      string
+	Strategy       string
+	Limit          int
+	Offset         int
+	// Seed makes the ad service's random choices reproducible
+	Seed *int64
+}
+
+// AdClient calls ad-service
+type AdClient struct {
+	c *client
+}
+
+// NewAdClient returns a client for the ad-service at opts.BaseURL
+func NewAdClient(opts Options) *AdClient {
+	return &AdClient{c: newClient("ad-service", opts)}
+}
+
+// NewAdClientFromEnv reads AD_SERVICE (default http://localhost:8083) and
+// the shared CLIENT_* settings
+func NewAdClientFromEnv() *AdClient {
+	return NewAdClient(OptionsFromEnv("AD_SERVICE", "http://localhost:8083"))
+}
+
+// GetAds returns the ads ad-service picks for q
+func (a *AdClient) GetAds(ctx context.Context, q AdQuery) ([]Ad, error) {
+	query := url.Values{}
+	if len(q.ProductIDs) > 0 {
+		ids := make([]string, len(q.ProductIDs))
+		for i, id := range q.ProductIDs {
+			ids[i] = strconv.Itoa(id)
+		}
+		query.Set("product_ids", strings.Join(ids, ","))
+	}
+	for key, value := range map[string]string{
+		"category":        q.Category,
+		"region":          q.Region,
+		"device":          q.Device,
+		"past_categories": strings.Join(q.PastCategories, ","),
+		"session_id":      q.SessionID,
+		"strategy":        q.Strategy,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset > 0 {
+		query.Set("offset", strconv.Itoa(q.Offset))
+	}
+	var header http.Header
+	if q.Seed != nil {
+		header = http.Header{"X-Debug-Seed": {strconv.FormatInt(*q.Seed, 10)}}
+	}
+
+	var ads []Ad
+	_, err := a.c.do(ctx, request{method: http.MethodGet, route: "/ads", path: "/ads", query: query, header: header}, &ads)
+	return ads, err
+}
+
+// GetAd returns one ad; a missing one is ErrNotFound
+func (a *AdClient) GetAd(ctx context.Context, id string) (*Ad, error) {
+	var ad Ad
+	path := "/ad/" + url.PathEscape(id)
+	if _, err := a.c.do(ctx, request{method: http.MethodGet, route: "/ad/:id", path: path}, &ad); err != nil {
+		return nil, err
+	}
+	return &ad, nil
+}
+
+// RecordImpression records that a viewer saw an ad. It isn't retried, so
+// an impression is never charged to the campaign twice.
+func (a *AdClient) RecordImpression(ctx context.Context, adID, userID, sessionID string) error {
+	return a.track(ctx, "impression", adID, userID, sessionID)
+}
+
+// RecordClick records that a viewer clicked an ad
+func (a *AdClient) RecordClick(ctx context.Context, adID, userID, sessionID string) error {
+	return a.track(ctx, "click", adID, userID, sessionID)
+}
+
+func (a *AdClient) track(ctx context.Context, event, adID, userID, sessionID string) error {
+	body := map[string]string{"user_id": userID, "session_id": sessionID}
+	path := "/ad/" + url.PathEscape(adID) + "/" + event
+	_, err := a.c.do(ctx, request{method: http.MethodPost, route: "/ad/:id/" + event, path: path, body: body}, nil)
+	return err
+}
+
+// GetAdStats returns an ad's impressions, clicks and click-through rate
+func (a *AdClient) GetAdStats(ctx context.Context, id string) (*AdStats, error) {
+	var stats AdStats
+	path := "/ad/" + url.PathEscape(id) + "/stats"
+	if _, err := a.c.do(ctx, request{method: http.MethodGet, route: "/ad/:id/stats", path: path}, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
@@ -0,0 +1,147 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Booking statuses
+const (
+	BookingPending    = "pending"
+	BookingReserved   = "reserved"
+	BookingConfirmed  = "confirmed"
+	BookingRolledBack = "rolled_back"
+	BookingFailed     = "failed"
+	BookingCancelled  = "cancelled"
+)
+
+// Booking is one run of instabook's create → reserve → confirm workflow
+type Booking struct {
+	ID            string              `json:"id"`
+	SessionID     string              `json:"session_id"`
+	UserID        string              `json:"user_id"`
+	ProductID     string              `json:"product_id"`
+	Quantity      int                 `json:"quantity"`
+	Status        string              `json:"status"`
+	ReservationID string              `json:"reservation_id,omitempty"`
+	Error         string              `json:"error,omitempty"`
+	Transitions   []BookingTransition `json:"transitions"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+}
+
+// BookingTransition is one step of a booking
+type BookingTransition struct {
+	Status string    `json:"status"`
+	Step   string    `json:"step"`
+	At     time.Time `json:"at"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// BookingRequest starts a booking
+type BookingRequest struct {
+	UserID    string `json:"user_id"`
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+	Data      string `json:"data,omitempty"`
+}
+
+// Session is an instabook booking session
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	BookingID  string    `json:"booking_id"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	Data       string    `json:"data"`
+	TTLSeconds int       `json:"ttl_seconds,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// BookingClient calls instabook
+type BookingClient struct {
+	c *client
+}
+
+// NewBookingClient returns a client for the instabook at opts.BaseURL
+func NewBookingClient(opts Options) *BookingClient {
+	return &BookingClient{c: newClient("instabook", opts)}
+}
+
+// NewBookingClientFromEnv reads INSTABOOK_SERVICE (default
+// http://localhost:8087) and the shared CLIENT_* settings
+func NewBookingClientFromEnv() *BookingClient {
+	return NewBookingClient(OptionsFromEnv("INSTABOOK_SERVICE", "http://localhost:8087"))
+}
+
+// CreateBooking runs a booking to completion. A booking that was rolled
+// back or failed is returned along with its APIError, so callers can see
+// which step failed.
+func (b *BookingClient) CreateBooking(ctx context.Context, req BookingRequest) (*Booking, error) {
+	var booking Booking
+	_, err := b.c.do(ctx, request{method: http.MethodPost, route: "/booking", path: "/booking", body: req}, &booking)
+	return bookingResult(&booking, err)
+}
+
+// GetBooking returns a booking; an unknown one is ErrNotFound
+func (b *BookingClient) GetBooking(ctx context.Context, id string) (*Booking, error) {
+	var booking Booking
+	path := "/booking/" + url.PathEscape(id)
+	if _, err := b.c.do(ctx, request{method: http.MethodGet, route: "/booking/:id", path: path}, &booking); err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+// CancelBooking cancels a confirmed booking. Cancelling a cancelled
+// booking succeeds, so the call is retried like a GET; a booking in any
+// other state is ErrConflict.
+func (b *BookingClient) CancelBooking(ctx context.Context, id string) (*Booking, error) {
+	var booking Booking
+	path := "/booking/" + url.PathEscape(id) + "/cancel"
+	_, err := b.c.do(ctx, request{method: http.MethodPost, route: "/booking/:id/cancel", path: path, idempotent: true}, &booking)
+	return bookingResult(&booking, err)
+}
+
+// bookingResult decodes the booking a failed saga responds with
+func bookingResult(booking *Booking, err error) (*Booking, error) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if decodeInto(apiErr.Body, booking) && booking.ID != "" {
+			return booking, err
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return booking, nil
+}
+
+// CreateSession creates a booking session. With an idempotencyKey the
+// request is retried, and a retry returns the session the first attempt
+// created.
+func (b *BookingClient) CreateSession(ctx context.Context, session Session, idempotencyKey string) (*Session, error) {
+	var header http.Header
+	if idempotencyKey != "" {
+		header = http.Header{"Idempotency-Key": {idempotencyKey}}
+	}
+	var created Session
+	if _, err := b.c.do(ctx, request{method: http.MethodPost, route: "/booking/session", path: "/booking/session", header: header, body: session}, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetSession returns a booking session; an unknown one is ErrNotFound
+func (b *BookingClient) GetSession(ctx context.Context, id string) (*Session, error) {
+	var session Session
+	path := "/booking/session/" + url.PathEscape(id)
+	if _, err := b.c.do(ctx, request{method: http.MethodGet, route: "/booking/session/:id", path: path}, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
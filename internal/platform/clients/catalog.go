@@ -0,0 +1,93 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Product is a product-catalog product
+type Product struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Price       float64  `json:"price"`
+	Currency    string   `json:"currency"`
+	ImageURL    string   `json:"image_url"`
+	Categories  []string `json:"categories"`
+	CategoryID  string   `json:"category_id,omitempty"`
+	Rating      Rating   `json:"rating"`
+}
+
+// Rating summarises a product's reviews
+type Rating struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
+
+// ListProductsOptions filter GET /products
+type ListProductsOptions struct {
+	Category string
+	// SortByRating lists the highest rated products first
+	SortByRating bool
+}
+
+// ProductCatalogClient calls product-catalog
+type ProductCatalogClient struct {
+	c *client
+}
+
+// NewProductCatalogClient returns a client for the product-catalog at
+// opts.BaseURL
+func NewProductCatalogClient(opts Options) *ProductCatalogClient {
+	return &ProductCatalogClient{c: newClient("product-catalog", opts)}
+}
+
+// NewProductCatalogClientFromEnv reads PRODUCT_CATALOG_SERVICE (default
+// http://localhost:8081) and the shared CLIENT_* settings
+func NewProductCatalogClientFromEnv() *ProductCatalogClient {
+	return NewProductCatalogClient(OptionsFromEnv("PRODUCT_CATALOG_SERVICE", "http://localhost:8081"))
+}
+
+// ListProducts returns the catalog, optionally filtered to a category
+func (p *ProductCatalogClient) ListProducts(ctx context.Context, opts ListProductsOptions) ([]Product, error) {
+	query := url.Values{}
+	if opts.Category != "" {
+		query.Set("category", opts.Category)
+	}
+	if opts.SortByRating {
+		query.Set("sort", "rating")
+	}
+	var products []Product
+	_, err := p.c.do(ctx, request{method: http.MethodGet, route: "/products", path: "/products", query: query}, &products)
+	return products, err
+}
+
+// GetProduct returns one product; a missing one is ErrNotFound
+func (p *ProductCatalogClient) GetProduct(ctx context.Context, id int) (*Product, error) {
+	var product Product
+	path := "/product/" + strconv.Itoa(id)
+	if _, err := p.c.do(ctx, request{method: http.MethodGet, route: "/product/:id", path: path}, &product); err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// PutProduct creates or replaces a product. A product that fails
+// validation is ErrInvalid, with the reasons in the APIError's Fields.
+func (p *ProductCatalogClient) PutProduct(ctx context.Context, product Product) (*Product, error) {
+	var saved Product
+	path := "/product/" + strconv.Itoa(product.ID)
+	if _, err := p.c.do(ctx, request{method: http.MethodPut, route: "/product/:id", path: path, body: product}, &saved); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// DeleteProduct removes a product
+func (p *ProductCatalogClient) DeleteProduct(ctx context.Context, id int) error {
+	path := "/product/" + strconv.Itoa(id)
+	_, err := p.c.do(ctx, request{method: http.MethodDelete, route: "/product/:id", path: path}, nil)
+	return err
+}
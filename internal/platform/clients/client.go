@@ -0,0 +1,330 @@
+// Package clients has typed Go clients for the demo services, so callers
+// share one way of authenticating, retrying, tracing and reporting errors
+// instead of each building raw HTTP requests:
+//
+//	catalog := clients.NewProductCatalogClientFromEnv()
+//	product, err := catalog.GetProduct(ctx, 1)
+//	if errors.Is(err, clients.ErrNotFound) { ... }
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"platform"
+	"platform/validate"
+)
+
+var tracer = otel.Tracer("platform/clients")
+
+// Errors an APIError matches with errors.Is, by response status
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrInvalid      = errors.New("invalid request")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrUnavailable  = errors.New("service unavailable")
+)
+
+// APIError is a response with an error status. Message is the service's
+// "error" field, and Fields its field errors on a 422.
+type APIError struct {
+	Service    string
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+	Fields     []validate.FieldError
+	// Body is the raw response, for endpoints that describe the failure
+	// in a typed body
+	Body []byte
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("%s %s %s: %d %s", e.Service, e.Method, e.Path, e.StatusCode, msg)
+}
+
+// Is maps the status to one of the Err* values
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrInvalid:
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrUnavailable:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// Options configure a client. Only BaseURL is required.
+type Options struct {
+	BaseURL string
+	// Token is sent as a Bearer token
+	Token string
+	// Actor is sent as X-Actor, naming the caller in audit logs and
+	// inventory events
+	Actor string
+	// HTTPClient defaults to platform.NewHTTPClient, which carries the
+	// trace context and uses the shared connection pool
+	HTTPClient *http.Client
+	// MaxRetries is how many times a failed idempotent request is retried
+	MaxRetries int
+	// RetryBackoff is the base of the jittered exponential backoff
+	RetryBackoff time.Duration
+	// Timeout bounds each attempt when HTTPClient is not set
+	Timeout time.Duration
+}
+
+// OptionsFromEnv reads the service URL from urlKey (falling back to
+// fallbackURL), CLIENT_MAX_RETRIES (default 2), CLIENT_RETRY_BACKOFF
+// (default 100ms) and CLIENT_TIMEOUT (default 10s)
+func OptionsFromEnv(urlKey, fallbackURL string) Options {
+	retries, err := strconv.Atoi(platform.GetEnv("CLIENT_MAX_RETRIES", "2"))
+	if err != nil || retries < 0 {
+		retries = 2
+	}
+	backoff, err := time.ParseDuration(platform.GetEnv("CLIENT_RETRY_BACKOFF", "100ms"))
+	if err != nil || backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+	timeout, err := time.ParseDuration(platform.GetEnv("CLIENT_TIMEOUT", "10s"))
+	if err != nil || timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return Options{
+		BaseURL:      platform.GetEnv(urlKey, fallbackURL),
+		MaxRetries:   retries,
+		RetryBackoff: backoff,
+		Timeout:      timeout,
+	}
+}
+
+// client is the request plumbing the typed clients share
+type client struct {
+	service string
+	opts    Options
+	http    *http.Client
+}
+
+func newClient(service string, opts Options) *client {
+	opts.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = 100 * time.Millisecond
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = platform.NewHTTPClient(platform.NewStructuredLogger(service+"-client"), opts.Timeout)
+	}
+	return &client{service: service, opts: opts, http: httpClient}
+}
+
+// request is one call. route names the endpoint in spans, e.g.
+// "/product/:id", while path is what is requested.
+type request struct {
+	method string
+	route  string
+	path   string
+	query  url.Values
+	header http.Header
+	body   interface{}
+	// idempotent marks a POST that can be repeated without changing the
+	// outcome, so it may be retried
+	idempotent bool
+}
+
+// retryable reports whether req may be sent again: idempotent methods and
+// requests, and writes that carry an Idempotency-Key
+func (r request) retryable() bool {
+	if r.idempotent {
+		return true
+	}
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return r.header.Get("Idempotency-Key") != ""
+}
+
+// do sends req and decodes a successful response into out, when it is
+// not nil. Connection errors, 429s, 502s, 503s and 504s are retried for
+// retryable requests; a Retry-After header sets the minimum wait.
+func (c *client) do(ctx context.Context, req request, out interface{}) (*http.Response, error) {
+	ctx, span := tracer.Start(ctx, c.service+" "+req.method+" "+req.route, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("peer.service", c.service),
+		attribute.String("http.method", req.method),
+		attribute.String("http.route", req.route),
+	)
+
+	var body []byte
+	if req.body != nil {
+		var err error
+		body, err = json.Marshal(req.body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: encoding request: %w", c.service, err)
+		}
+	}
+	target := c.opts.BaseURL + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+
+	attempts := 1
+	if req.retryable() {
+		attempts += c.opts.MaxRetries
+	}
+	var wait time.Duration
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			// Full jitter: a random duration up to base * 2^attempt
+			backoff := time.Duration(rand.Int63n(int64(c.opts.RetryBackoff) << attempt))
+			if backoff < wait {
+				backoff = wait
+			}
+			select {
+			case <-ctx.Done():
+				span.SetStatus(codes.Error, ctx.Err().Error())
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			span.AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt+1)))
+		}
+
+		resp, respBody, err := c.send(ctx, req, target, body)
+		last := attempt == attempts-1
+		if err != nil {
+			if last || ctx.Err() != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return nil, fmt.Errorf("%s %s %s: %w", c.service, req.method, req.path, err)
+			}
+			wait = 0
+			continue
+		}
+
+		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode), attribute.Int("http.attempts", attempt+1))
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			if !last {
+				wait = retryAfter(resp)
+				continue
+			}
+		}
+		if resp.StatusCode >= 400 {
+			apiErr := c.apiError(req, resp.StatusCode, respBody)
+			if resp.StatusCode >= 500 {
+				span.SetStatus(codes.Error, apiErr.Error())
+			}
+			return resp, apiErr
+		}
+		if out != nil && len(respBody) > 0 {
+			if err := json.Unmarshal(respBody, out); err != nil {
+				return resp, fmt.Errorf("%s %s %s: decoding response: %w", c.service, req.method, req.path, err)
+			}
+		}
+		return resp, nil
+	}
+}
+
+// send makes one attempt, reading the whole response body
+func (c *client) send(ctx context.Context, req request, target string, body []byte) (*http.Response, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, values := range req.header {
+		httpReq.Header[key] = values
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if c.opts.Token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+	if c.opts.Actor != "" {
+		httpReq.Header.Set("X-Actor", c.opts.Actor)
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, respBody, nil
+}
+
+func (c *client) apiError(req request, status int, body []byte) *APIError {
+	apiErr := &APIError{
+		Service:    c.service,
+		Method:     req.method,
+		Path:       req.path,
+		StatusCode: status,
+		Body:       body,
+	}
+	var envelope struct {
+		Error  string                `json:"error"`
+		Fields []validate.FieldError `json:"fields"`
+	}
+	if json.Unmarshal(body, &envelope) == nil {
+		apiErr.Message = envelope.Error
+		apiErr.Fields = envelope.Fields
+	}
+	return apiErr
+}
+
+// retryAfter reads a Retry-After header given in seconds, capped so a
+// misbehaving service can't stall the caller
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	if d := time.Duration(seconds) * time.Second; d < 5*time.Second {
+		return d
+	}
+	return 5 * time.Second
+}
+
+// decodeInto decodes a JSON body into v, reporting whether it could
+func decodeInto(body []byte, v interface{}) bool {
+	return len(body) > 0 && json.Unmarshal(body, v) == nil
+}
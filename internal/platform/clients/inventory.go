@@ -0,0 +1,123 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Stock is one product's inventory-service stock level
+type Stock struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+	Reserved  int    `json:"reserved"`
+	Available int    `json:"available"`
+	// Version increases with every change; pass it as ExpectedVersion to
+	// fail with ErrConflict if the stock changed since it was read
+	Version int64 `json:"version"`
+}
+
+// CheckItem is one line of an availability check
+type CheckItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// CheckResult says whether one product can cover the requested quantity
+type CheckResult struct {
+	ProductID  string `json:"product_id"`
+	Requested  int    `json:"requested"`
+	Available  int    `json:"available"`
+	Found      bool   `json:"found"`
+	Sufficient bool   `json:"sufficient"`
+}
+
+// Availability is the answer to CheckAvailability
+type Availability struct {
+	Available bool          `json:"available"`
+	Items     []CheckResult `json:"items"`
+}
+
+// ReserveRequest reserves stock. CallbackURL and TTLSeconds track the
+// reservation, so inventory-service releases it when the TTL passes and
+// notifies the callback.
+type ReserveRequest struct {
+	ProductID       string `json:"product_id"`
+	Quantity        int    `json:"quantity"`
+	ExpectedVersion *int64 `json:"expected_version,omitempty"`
+	CallbackURL     string `json:"callback_url,omitempty"`
+	TTLSeconds      int    `json:"ttl_seconds,omitempty"`
+}
+
+// ReserveResult is a successful reservation
+type ReserveResult struct {
+	ProductID     string     `json:"product_id"`
+	Reserved      int        `json:"reserved"`
+	Version       int64      `json:"version"`
+	ReservationID string     `json:"reservation_id"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+}
+
+// ReleaseRequest returns reserved stock
+type ReleaseRequest struct {
+	ProductID     string `json:"product_id"`
+	Quantity      int    `json:"quantity"`
+	ReservationID string `json:"reservation_id,omitempty"`
+}
+
+// InventoryClient calls inventory-service
+type InventoryClient struct {
+	c *client
+}
+
+// NewInventoryClient returns a client for the inventory-service at
+// opts.BaseURL
+func NewInventoryClient(opts Options) *InventoryClient {
+	return &InventoryClient{c: newClient("inventory-service", opts)}
+}
+
+// NewInventoryClientFromEnv reads INVENTORY_SERVICE (default
+// http://localhost:8085) and the shared CLIENT_* settings
+func NewInventoryClientFromEnv() *InventoryClient {
+	return NewInventoryClient(OptionsFromEnv("INVENTORY_SERVICE", "http://localhost:8085"))
+}
+
+// GetStock returns a product's stock; an unknown product is ErrNotFound
+func (i *InventoryClient) GetStock(ctx context.Context, productID string) (*Stock, error) {
+	var stock Stock
+	path := "/inventory/" + url.PathEscape(productID)
+	if _, err := i.c.do(ctx, request{method: http.MethodGet, route: "/inventory/:product_id", path: path}, &stock); err != nil {
+		return nil, err
+	}
+	return &stock, nil
+}
+
+// CheckAvailability reports whether every item could be reserved now,
+// without reserving anything
+func (i *InventoryClient) CheckAvailability(ctx context.Context, items []CheckItem) (*Availability, error) {
+	var result Availability
+	body := map[string][]CheckItem{"items": items}
+	// A check changes nothing, so it is as safe to retry as a GET
+	if _, err := i.c.do(ctx, request{method: http.MethodPost, route: "/inventory/check", path: "/inventory/check", body: body, idempotent: true}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Reserve reserves stock. Insufficient stock and a stale ExpectedVersion
+// are both ErrConflict. Reservations are not retried, since a retry after
+// a lost response would reserve twice.
+func (i *InventoryClient) Reserve(ctx context.Context, req ReserveRequest) (*ReserveResult, error) {
+	var result ReserveResult
+	if _, err := i.c.do(ctx, request{method: http.MethodPost, route: "/inventory/reserve", path: "/inventory/reserve", body: req}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Release returns reserved stock
+func (i *InventoryClient) Release(ctx context.Context, req ReleaseRequest) error {
+	_, err := i.c.do(ctx, request{method: http.MethodPost, route: "/inventory/release", path: "/inventory/release", body: req}, nil)
+	return err
+}
@@ -0,0 +1,224 @@
+package platform
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// compressibleTypes are the response content types worth compressing
+var compressibleTypes = []string{
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+	"text/",
+}
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return w
+	},
+}
+
+// compressWriter holds back the start of the body until it knows whether
+// the response is big enough, and of the right type, to compress
+type compressWriter struct {
+	gin.ResponseWriter
+	minSize int
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+	decided bool
+	size    int
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	w.size += len(b)
+	if !w.decided {
+		w.buf.Write(b)
+		if w.buf.Len() < w.minSize {
+			return len(b), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written counts a held back body as written
+func (w *compressWriter) Written() bool {
+	return w.buf.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// Size is the uncompressed body size, so access logs and metrics don't
+// depend on the client's Accept-Encoding
+func (w *compressWriter) Size() int {
+	if w.size == 0 {
+		return w.ResponseWriter.Size()
+	}
+	return w.size
+}
+
+// Flush decides on compression early so streamed responses aren't held
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.decided = true
+	return w.ResponseWriter.Hijack()
+}
+
+// decide starts the compressed or plain response and writes what has been
+// held back
+func (w *compressWriter) decide() error {
+	w.decided = true
+	if w.buf.Len() >= w.minSize && w.compressible() {
+		header := w.Header()
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.gz = gzipWriters.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+func (w *compressWriter) compressible() bool {
+	header := w.Header()
+	// Already encoded, e.g. by promhttp, or a ranged response
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	if status := w.Status(); status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// close writes out a body too small to have been decided on and finishes
+// the gzip stream
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide()
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		w.gz.Reset(io.Discard)
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) != "gzip" && strings.TrimSpace(coding) != "*" {
+			continue
+		}
+		// "gzip;q=0" refuses it
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// CompressionMiddleware gzips responses for clients that send
+// Accept-Encoding: gzip, when the body is at least COMPRESSION_MIN_BYTES
+// (default 1024) and its Content-Type is JSON, JavaScript, XML, SVG or
+// text. COMPRESSION_ENABLED=false turns it off. Mount it before
+// RequestIDMiddleware, which rewrites error bodies and must see them
+// uncompressed.
+func CompressionMiddleware() gin.HandlerFunc {
+	if GetEnv("COMPRESSION_ENABLED", "true") == "false" {
+		return func(c *gin.Context) { c.Next() }
+	}
+	minSize, err := strconv.Atoi(GetEnv("COMPRESSION_MIN_BYTES", "1024"))
+	if err != nil || minSize < 0 {
+		minSize = 1024
+	}
+
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		if c.Request.Method == http.MethodHead || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, minSize: minSize}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+		w.close()
+	}
+}
+
+// DecompressRequestMiddleware accepts request bodies sent with
+// Content-Encoding: gzip, for import endpoints that take large payloads.
+// The decompressed body is capped at maxBytes, so a small compressed body
+// can't expand without bound. Other encodings get a 415.
+func DecompressRequestMiddleware(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding"))); encoding {
+		case "", "identity":
+		case "gzip":
+			gz, err := gzip.NewReader(c.Request.Body)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid gzip request body"})
+				return
+			}
+			defer gz.Close()
+			c.Request.Body = http.MaxBytesReader(c.Writer, gz, maxBytes)
+			c.Request.Header.Del("Content-Encoding")
+			c.Request.Header.Del("Content-Length")
+			c.Request.ContentLength = -1
+		default:
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported Content-Encoding " + strconv.Quote(encoding)})
+			return
+		}
+		c.Next()
+	}
+}
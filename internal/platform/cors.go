@@ -0,0 +1,159 @@
+package platform
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSConfig is which browser origins may call a service and how. Each
+// service passes its own defaults; CORS_* settings replace them.
+type CORSConfig struct {
+	// AllowedOrigins are exact origins, "*" for any origin, or patterns
+	// like "https://*.example.com" matching any subdomain. Empty disables
+	// CORS.
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// corsList reads a comma-separated setting, keeping fallback when unset
+func corsList(key string, fallback []string) []string {
+	v, ok := Lookup(key)
+	if !ok {
+		return fallback
+	}
+	var values []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+// CORSConfigFromEnv applies CORS_ALLOWED_ORIGINS, CORS_ALLOWED_METHODS,
+// CORS_ALLOWED_HEADERS, CORS_EXPOSED_HEADERS, CORS_ALLOW_CREDENTIALS and
+// CORS_MAX_AGE to defaults. Setting CORS_ALLOWED_ORIGINS to "" turns CORS
+// off.
+func CORSConfigFromEnv(defaults CORSConfig) CORSConfig {
+	cfg := defaults
+	cfg.AllowedOrigins = corsList("CORS_ALLOWED_ORIGINS", defaults.AllowedOrigins)
+	cfg.AllowedMethods = corsList("CORS_ALLOWED_METHODS", defaults.AllowedMethods)
+	cfg.AllowedHeaders = corsList("CORS_ALLOWED_HEADERS", defaults.AllowedHeaders)
+	cfg.ExposedHeaders = corsList("CORS_EXPOSED_HEADERS", defaults.ExposedHeaders)
+	if v := GetEnv("CORS_ALLOW_CREDENTIALS", ""); v != "" {
+		cfg.AllowCredentials = v == "true"
+	}
+	if d, err := time.ParseDuration(GetEnv("CORS_MAX_AGE", "")); err == nil && d >= 0 {
+		cfg.MaxAge = d
+	}
+	return cfg
+}
+
+// allowsOrigin reports whether origin may call the service, and whether it
+// was allowed by "*" rather than by name
+func (cfg CORSConfig) allowsOrigin(origin string) (allowed, wildcard bool) {
+	for _, pattern := range cfg.AllowedOrigins {
+		if pattern == "*" {
+			return true, true
+		}
+		if strings.EqualFold(pattern, origin) {
+			return true, false
+		}
+		// "https://*.example.com" matches "https://shop.example.com"
+		if prefix, suffix, ok := strings.Cut(pattern, "*"); ok &&
+			len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) &&
+			!strings.Contains(origin[len(prefix):len(origin)-len(suffix)], "/") {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// CORSMiddleware answers preflight requests and adds CORS headers to
+// responses for allowed origins. Requests from other origins are served
+// without the headers, so the browser blocks the response; their
+// preflights get a 403. It runs ahead of rate limiting and fault
+// injection, so a preflight is never throttled or failed by a fault, and
+// rejections such as 429s still carry the headers a script needs to read
+// them.
+func CORSMiddleware(defaults CORSConfig) gin.HandlerFunc {
+	cfg := CORSConfigFromEnv(defaults)
+	if len(cfg.AllowedOrigins) == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	credentials := cfg.AllowCredentials
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" && credentials {
+			// Browsers reject credentials with a wildcard, and reflecting
+			// every origin instead would let any site act as the user
+			log.Printf("CORS_ALLOW_CREDENTIALS ignored: not allowed with CORS_ALLOWED_ORIGINS=*")
+			credentials = false
+		}
+	}
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		allowed, wildcard := cfg.allowsOrigin(origin)
+		if !wildcard {
+			// The answer depends on the origin, so caches must key on it
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+		if !allowed {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		if wildcard {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			h.Set("Access-Control-Allow-Methods", methods)
+			if headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			}
+			if cfg.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		if exposed != "" {
+			h.Set("Access-Control-Expose-Headers", exposed)
+		}
+		c.Next()
+	}
+}
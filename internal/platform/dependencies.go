@@ -0,0 +1,103 @@
+package platform
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DependencyStats summarizes the calls a service made to one downstream
+// host. Transport errors and 5xx responses count as errors.
+type DependencyStats struct {
+	Host          string     `json:"host"`
+	Calls         int64      `json:"calls"`
+	Errors        int64      `json:"errors"`
+	LastStatus    int        `json:"last_status,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastLatencyMs float64    `json:"last_latency_ms"`
+	LastCalledAt  time.Time  `json:"last_called_at"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+}
+
+// dependencyRegistry records every call made through ServiceTransport
+type dependencyRegistry struct {
+	mu    sync.Mutex
+	hosts map[string]*DependencyStats
+}
+
+var dependencies = &dependencyRegistry{hosts: make(map[string]*DependencyStats)}
+
+func (r *dependencyRegistry) record(host string, status int, err error, latency time.Duration) {
+	now := time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats, ok := r.hosts[host]
+	if !ok {
+		stats = &DependencyStats{Host: host}
+		r.hosts[host] = stats
+	}
+	stats.Calls++
+	stats.LastStatus = status
+	stats.LastLatencyMs = float64(latency.Microseconds()) / 1000
+	stats.LastCalledAt = now
+	stats.LastError = ""
+	if err != nil {
+		stats.LastError = err.Error()
+	}
+	if err != nil || status >= http.StatusInternalServerError {
+		stats.Errors++
+		stats.LastErrorAt = &now
+	}
+}
+
+// Dependencies returns what is known about each downstream host this
+// process has called, sorted by host
+func Dependencies() []DependencyStats {
+	dependencies.mu.Lock()
+	defer dependencies.mu.Unlock()
+	result := make([]DependencyStats, 0, len(dependencies.hosts))
+	for _, stats := range dependencies.hosts {
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Host < result[j].Host })
+	return result
+}
+
+// dependencyTransport records each call's host, status and latency in the
+// dependency registry
+type dependencyTransport struct {
+	base http.RoundTripper
+}
+
+func (t *dependencyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	dependencies.record(req.URL.Host, status, err, time.Since(start))
+	return resp, err
+}
+
+func (t *dependencyTransport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// RegisterDependencyRoutes serves GET /debug/dependencies: the downstream
+// hosts service has called through NewHTTPClient or ServiceTransport, with
+// call and error counts and the last call's status and latency
+func RegisterDependencyRoutes(router gin.IRouter, service string) {
+	router.GET("/debug/dependencies", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"service":      service,
+			"dependencies": Dependencies(),
+		})
+	})
+}
@@ -0,0 +1,52 @@
+// Package platform holds the plumbing shared by the Go services: structured
+// logging, OpenTelemetry setup, request metrics and the TLS-aware HTTP
+// client used for service-to-service calls.
+package platform
+
+import (
+	"os"
+	"sync"
+)
+
+var (
+	lookupMu sync.RWMutex
+	lookup   = os.LookupEnv
+)
+
+// SetLookup makes the platform helpers read their settings through fn, e.g.
+// a service's CONFIG_FILE loader, instead of straight from the environment
+func SetLookup(fn func(key string) (string, bool)) {
+	lookupMu.Lock()
+	defer lookupMu.Unlock()
+	lookup = fn
+}
+
+// Lookup returns the setting for key
+func Lookup(key string) (string, bool) {
+	lookupMu.RLock()
+	fn := lookup
+	lookupMu.RUnlock()
+	return fn(key)
+}
+
+// Get returns the setting for key, or "" when it is unset
+func Get(key string) string {
+	value, _ := Lookup(key)
+	return value
+}
+
+// GetEnv returns the setting for key, or fallback when it is unset
+func GetEnv(key, fallback string) string {
+	if value, ok := Lookup(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// getOr returns the setting for key, or fallback when it is unset or empty
+func getOr(key, fallback string) string {
+	if value := Get(key); value != "" {
+		return value
+	}
+	return fallback
+}
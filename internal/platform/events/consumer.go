@@ -0,0 +1,256 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"platform"
+)
+
+// Handler processes one consumed event. Returning an error has the event
+// redelivered, up to EVENTS_CONSUMER_MAX_ATTEMPTS times in total.
+type Handler func(ctx context.Context, event Event) error
+
+// Consumer delivers events of the subscribed types to a handler. Replicas
+// sharing a group split the events between them, and each event is
+// acknowledged only after the handler has succeeded.
+type Consumer interface {
+	Run(ctx context.Context, handler Handler) error
+	Close() error
+}
+
+// consumerSettings are shared by both consumers
+type consumerSettings struct {
+	group       string
+	maxAttempts int
+	backoff     time.Duration
+	logger      *platform.StructuredLogger
+}
+
+// NewConsumerFromEnv subscribes group to eventTypes on the broker in
+// EVENTS_BROKER. It returns nil when EVENTS_BROKER is unset.
+func NewConsumerFromEnv(group string, logger *platform.StructuredLogger, eventTypes ...string) (Consumer, error) {
+	cfg, err := ConfigFromEnv()
+	if err != nil || cfg.Broker == "" {
+		return nil, err
+	}
+	registerMetrics()
+
+	settings := consumerSettings{
+		group:       group,
+		maxAttempts: envInt("EVENTS_CONSUMER_MAX_ATTEMPTS", 5),
+		backoff:     envDuration("EVENTS_CONSUMER_RETRY_BACKOFF", 500*time.Millisecond),
+		logger:      logger,
+	}
+	topics := make([]string, len(eventTypes))
+	for i, eventType := range eventTypes {
+		topics[i] = cfg.Topic(eventType)
+	}
+
+	switch cfg.Broker {
+	case BrokerKafka:
+		return newKafkaConsumer(cfg.Brokers, topics, settings), nil
+	case BrokerNATS:
+		return newNATSConsumer(cfg, topics, settings)
+	default:
+		return nil, errors.New("unknown EVENTS_BROKER " + cfg.Broker)
+	}
+}
+
+// handle decodes and traces one event for the handler. invalid is true
+// when the message isn't an event at all, so redelivering it won't help.
+func (s consumerSettings) handle(ctx context.Context, broker, topic string, data []byte, handler Handler) (invalid bool, err error) {
+	var event Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		s.logger.Error(ctx, "Invalid event on topic", map[string]interface{}{
+			"topic": topic,
+			"group": s.group,
+			"error": err.Error(),
+		})
+		eventsConsumed.WithLabelValues(topic, s.group, "invalid").Inc()
+		return true, err
+	}
+
+	ctx, span := platform.StartLinked(ctx, tracer, "events.consume", event.Trace,
+		trace.WithSpanKind(trace.SpanKindConsumer))
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("messaging.system", broker),
+		attribute.String("messaging.destination.name", topic),
+		attribute.String("messaging.consumer.group.name", s.group),
+		attribute.String("messaging.message.id", event.ID),
+		attribute.String("event.type", event.Type),
+	)
+
+	if err := handler(ctx, event); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return false, err
+	}
+	eventsConsumed.WithLabelValues(topic, s.group, "handled").Inc()
+	return false, nil
+}
+
+// giveUp logs and counts an event that failed its last attempt
+func (s consumerSettings) giveUp(ctx context.Context, topic string, attempts int, err error) {
+	s.logger.Error(ctx, "Dropping event after failed attempts", map[string]interface{}{
+		"topic":    topic,
+		"group":    s.group,
+		"attempts": attempts,
+		"error":    err.Error(),
+	})
+	eventsConsumed.WithLabelValues(topic, s.group, "failed").Inc()
+}
+
+// KafkaConsumer reads the topics as a consumer group, committing each
+// message's offset once it has been handled. A failing event is retried in
+// place, holding up its partition, and skipped after the last attempt.
+type KafkaConsumer struct {
+	consumerSettings
+	reader *kafka.Reader
+}
+
+func newKafkaConsumer(brokers, topics []string, settings consumerSettings) *KafkaConsumer {
+	return &KafkaConsumer{
+		consumerSettings: settings,
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     brokers,
+			GroupID:     settings.group,
+			GroupTopics: topics,
+			MinBytes:    1,
+			MaxBytes:    10e6,
+		}),
+	}
+}
+
+func (c *KafkaConsumer) Run(ctx context.Context, handler Handler) error {
+	for {
+		msg, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		for attempt := 1; ; attempt++ {
+			invalid, err := c.handle(ctx, BrokerKafka, msg.Topic, msg.Value, handler)
+			if err == nil || invalid {
+				break
+			}
+			if attempt >= c.maxAttempts {
+				c.giveUp(ctx, msg.Topic, attempt, err)
+				break
+			}
+			eventsConsumed.WithLabelValues(msg.Topic, c.group, "retried").Inc()
+			if !sleep(ctx, time.Duration(attempt)*c.backoff) {
+				return nil
+			}
+		}
+
+		if err := c.reader.CommitMessages(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		partition := strconv.Itoa(msg.Partition)
+		consumerOffset.WithLabelValues(msg.Topic, partition, c.group).Set(float64(msg.Offset))
+		consumerLag.WithLabelValues(msg.Topic, partition, c.group).Set(float64(msg.HighWaterMark - msg.Offset - 1))
+	}
+}
+
+func (c *KafkaConsumer) Close() error {
+	return c.reader.Close()
+}
+
+// NATSConsumer reads each topic through a durable JetStream consumer shared
+// by the group. A failing event is negatively acknowledged for redelivery
+// and terminated after the last attempt. NATS has no partitions, so the
+// offset metrics report the stream sequence under partition "0".
+type NATSConsumer struct {
+	consumerSettings
+	conn   *nats.Conn
+	js     nats.JetStreamContext
+	topics []string
+}
+
+func newNATSConsumer(cfg Config, topics []string, settings consumerSettings) (*NATSConsumer, error) {
+	conn, js, err := connectJetStream(cfg, settings.group)
+	if err != nil {
+		return nil, err
+	}
+	return &NATSConsumer{consumerSettings: settings, conn: conn, js: js, topics: topics}, nil
+}
+
+// durableName derives a JetStream consumer name, which can't contain
+// subject tokens, from the group and topic
+var durableName = strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace
+
+func (c *NATSConsumer) Run(ctx context.Context, handler Handler) error {
+	var subs []*nats.Subscription
+	defer func() {
+		for _, sub := range subs {
+			sub.Drain()
+		}
+	}()
+
+	for _, topic := range c.topics {
+		topic := topic
+		sub, err := c.js.QueueSubscribe(topic, c.group, func(msg *nats.Msg) {
+			c.receive(ctx, topic, msg, handler)
+		},
+			nats.Durable(durableName(c.group+"-"+topic)),
+			nats.DeliverAll(),
+			nats.ManualAck(),
+			nats.AckExplicit(),
+			nats.MaxDeliver(c.maxAttempts),
+		)
+		if err != nil {
+			return err
+		}
+		subs = append(subs, sub)
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+func (c *NATSConsumer) receive(ctx context.Context, topic string, msg *nats.Msg, handler Handler) {
+	meta, err := msg.Metadata()
+	if err != nil {
+		msg.Term()
+		return
+	}
+
+	invalid, err := c.handle(ctx, BrokerNATS, topic, msg.Data, handler)
+	switch {
+	case err == nil:
+		msg.Ack()
+	case invalid:
+		msg.Term()
+	case int(meta.NumDelivered) >= c.maxAttempts:
+		c.giveUp(ctx, topic, int(meta.NumDelivered), err)
+		msg.Term()
+	default:
+		eventsConsumed.WithLabelValues(topic, c.group, "retried").Inc()
+		msg.NakWithDelay(time.Duration(meta.NumDelivered) * c.backoff)
+	}
+
+	consumerOffset.WithLabelValues(topic, "0", c.group).Set(float64(meta.Sequence.Stream))
+	consumerLag.WithLabelValues(topic, "0", c.group).Set(float64(meta.NumPending))
+}
+
+func (c *NATSConsumer) Close() error {
+	c.conn.Close()
+	return nil
+}
@@ -0,0 +1,111 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"platform"
+)
+
+// Emitter writes a service's domain events to its outbox and relays them
+// to the broker in the background
+type Emitter struct {
+	source    string
+	outbox    Outbox
+	publisher Publisher
+	relay     *Relay
+	logger    *platform.StructuredLogger
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewEmitterFromEnv sets up publishing for the service named source. It
+// returns nil when EVENTS_BROKER is unset.
+func NewEmitterFromEnv(source string, logger *platform.StructuredLogger) (*Emitter, error) {
+	cfg, err := ConfigFromEnv()
+	if err != nil || cfg.Broker == "" {
+		return nil, err
+	}
+	registerMetrics()
+
+	outbox, err := NewOutboxFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	publisher, err := NewPublisher(cfg, source)
+	if err != nil {
+		outbox.Close()
+		return nil, err
+	}
+	return &Emitter{
+		source:    source,
+		outbox:    outbox,
+		publisher: publisher,
+		relay:     NewRelay(cfg, outbox, publisher, logger),
+		logger:    logger,
+	}, nil
+}
+
+// Start runs the relay, including for events left in the outbox by a
+// previous run
+func (e *Emitter) Start(ctx context.Context) {
+	ctx, e.cancel = context.WithCancel(ctx)
+	e.done = make(chan struct{})
+	go func() {
+		defer close(e.done)
+		e.relay.Run(ctx)
+	}()
+}
+
+// Emit adds an event of eventType with data as its payload to the outbox.
+// key orders it relative to other events with the same key. The event is
+// published after Emit returns; an error means it was not recorded at all.
+func (e *Emitter) Emit(ctx context.Context, eventType, key string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	event := Event{
+		ID:     newEventID(),
+		Type:   eventType,
+		Source: e.source,
+		Key:    key,
+		Time:   time.Now().UTC(),
+		Data:   payload,
+		Trace:  platform.InjectTrace(ctx),
+	}
+	if err := e.outbox.Add(event); err != nil {
+		outboxWrites.WithLabelValues(eventType, "failed").Inc()
+		return err
+	}
+	outboxWrites.WithLabelValues(eventType, "written").Inc()
+	e.relay.Notify()
+	return nil
+}
+
+// Broker names the broker events are published to
+func (e *Emitter) Broker() string {
+	return e.publisher.Name()
+}
+
+// Pending returns the number of events not yet published
+func (e *Emitter) Pending() int {
+	return e.outbox.Len()
+}
+
+// Close stops the relay and disconnects. Events still pending stay in a
+// file outbox for the next run.
+func (e *Emitter) Close() error {
+	if e.cancel != nil {
+		e.cancel()
+		<-e.done
+	}
+	if err := e.publisher.Close(); err != nil {
+		e.logger.Warn(context.Background(), "Error closing event publisher", map[string]interface{}{"error": err.Error()})
+	}
+	if pending := e.outbox.Len(); pending > 0 {
+		e.logger.Warn(context.Background(), "Events left unpublished at shutdown", map[string]interface{}{"pending": pending})
+	}
+	return e.outbox.Close()
+}
@@ -0,0 +1,189 @@
+// Package events publishes domain events, e.g. reservation.created, to Kafka
+// or NATS JetStream and consumes them again. Events are written to an outbox
+// first and relayed to the broker in the background, so a broker outage
+// delays events instead of dropping them.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"platform"
+)
+
+// Brokers supported by EVENTS_BROKER
+const (
+	BrokerKafka = "kafka"
+	BrokerNATS  = "nats"
+)
+
+// Event is the envelope every domain event is published in. Key orders
+// events: events with the same key land on the same Kafka partition.
+type Event struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Source string          `json:"source"`
+	Key    string          `json:"key,omitempty"`
+	Time   time.Time       `json:"time"`
+	Data   json.RawMessage `json:"data"`
+	// Trace links publishing and consuming back to the request that
+	// emitted the event
+	Trace platform.TraceCarrier `json:"trace,omitempty"`
+}
+
+// Decode unmarshals the event's data into v
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+var tracer = otel.Tracer("platform/events")
+
+var (
+	outboxPending = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "events_outbox_pending",
+			Help: "Number of events in the outbox waiting to be published",
+		},
+	)
+	outboxWrites = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_outbox_writes_total",
+			Help: "Number of events written to the outbox by type and result",
+		},
+		[]string{"type", "result"},
+	)
+	eventsPublished = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_published_total",
+			Help: "Number of attempts to publish an event to the broker by topic and result",
+		},
+		[]string{"broker", "topic", "result"},
+	)
+	publishDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "events_publish_duration_seconds",
+			Help:    "Time taken to publish an event to the broker",
+			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		},
+		[]string{"broker"},
+	)
+	eventsConsumed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_consumed_total",
+			Help: "Number of events consumed by topic, consumer group and result",
+		},
+		[]string{"topic", "group", "result"},
+	)
+	consumerOffset = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "events_consumer_offset",
+			Help: "Offset of the last event handled per partition; the stream sequence for NATS",
+		},
+		[]string{"topic", "partition", "group"},
+	)
+	consumerLag = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "events_consumer_lag",
+			Help: "Number of events behind the last handled one per partition",
+		},
+		[]string{"topic", "partition", "group"},
+	)
+
+	registerOnce sync.Once
+)
+
+// registerMetrics registers the events_* metrics the first time a service
+// sets up an emitter or consumer, so services without one don't export them
+func registerMetrics() {
+	registerOnce.Do(func() {
+		prometheus.MustRegister(outboxPending, outboxWrites, eventsPublished, publishDuration)
+		prometheus.MustRegister(eventsConsumed, consumerOffset, consumerLag)
+	})
+}
+
+// Config holds the EVENTS_* broker settings shared by emitters and consumers
+type Config struct {
+	Broker      string
+	Brokers     []string
+	NATSURL     string
+	Stream      string
+	TopicPrefix string
+}
+
+// ConfigFromEnv reads the broker settings. Broker is empty when
+// EVENTS_BROKER is unset, which disables publishing and consuming.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Broker:      platform.GetEnv("EVENTS_BROKER", ""),
+		NATSURL:     platform.GetEnv("NATS_URL", "nats://nats:4222"),
+		Stream:      platform.GetEnv("EVENTS_NATS_STREAM", "EVENTS"),
+		TopicPrefix: platform.GetEnv("EVENTS_TOPIC_PREFIX", "events."),
+	}
+	for _, broker := range strings.Split(platform.GetEnv("KAFKA_BROKERS", "kafka:9092"), ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			cfg.Brokers = append(cfg.Brokers, broker)
+		}
+	}
+
+	switch cfg.Broker {
+	case "", BrokerNATS:
+	case BrokerKafka:
+		if len(cfg.Brokers) == 0 {
+			return cfg, errors.New("KAFKA_BROKERS is empty")
+		}
+	default:
+		return cfg, errors.New("unknown EVENTS_BROKER " + cfg.Broker)
+	}
+	return cfg, nil
+}
+
+// Topic is the Kafka topic or NATS subject events of eventType are
+// published on
+func (c Config) Topic(eventType string) string {
+	return c.TopicPrefix + eventType
+}
+
+// newEventID returns a random ID; brokers use it to drop redelivered
+// duplicates and consumers can do the same
+func newEventID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "evt-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return "evt-" + hex.EncodeToString(b)
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(platform.Get(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(platform.Get(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
+
+// sleep waits for d, returning false if ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,289 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"platform"
+)
+
+// compactAfter is how many acknowledged events the file outbox keeps
+// logged before it rewrites the file with only the pending ones
+const compactAfter = 1000
+
+var ErrOutboxFull = errors.New("event outbox is full")
+
+// Outbox holds events until the relay has published them. Pending returns
+// events in the order they were added.
+type Outbox interface {
+	Add(event Event) error
+	Pending(limit int) ([]Event, error)
+	Ack(ids ...string) error
+	Len() int
+	Close() error
+}
+
+// NewOutboxFromEnv opens the file outbox at OUTBOX_PATH, or an in-memory
+// outbox when it is unset. Either holds up to OUTBOX_MAX_PENDING events.
+func NewOutboxFromEnv() (Outbox, error) {
+	maxPending := envInt("OUTBOX_MAX_PENDING", 10000)
+	if path := platform.Get("OUTBOX_PATH"); path != "" {
+		return OpenFileOutbox(path, maxPending)
+	}
+	return NewMemoryOutbox(maxPending), nil
+}
+
+// MemoryOutbox keeps pending events in process. It rides out broker outages
+// but loses its events if the service restarts.
+type MemoryOutbox struct {
+	mu         sync.Mutex
+	events     []Event
+	maxPending int
+}
+
+func NewMemoryOutbox(maxPending int) *MemoryOutbox {
+	return &MemoryOutbox{maxPending: maxPending}
+}
+
+func (o *MemoryOutbox) Add(event Event) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.events) >= o.maxPending {
+		return ErrOutboxFull
+	}
+	o.events = append(o.events, event)
+	outboxPending.Set(float64(len(o.events)))
+	return nil
+}
+
+func (o *MemoryOutbox) Pending(limit int) ([]Event, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	pending := o.events
+	if limit > 0 && len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return append([]Event(nil), pending...), nil
+}
+
+func (o *MemoryOutbox) Ack(ids ...string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	acked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		acked[id] = true
+	}
+	remaining := o.events[:0]
+	for _, event := range o.events {
+		if !acked[event.ID] {
+			remaining = append(remaining, event)
+		}
+	}
+	// Clear the tail so published events can be collected
+	for i := len(remaining); i < len(o.events); i++ {
+		o.events[i] = Event{}
+	}
+	o.events = remaining
+	outboxPending.Set(float64(len(o.events)))
+	return nil
+}
+
+func (o *MemoryOutbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.events)
+}
+
+func (o *MemoryOutbox) Close() error {
+	return nil
+}
+
+// outboxRecord is one line of the file outbox: an added event or the ID of
+// a published one
+type outboxRecord struct {
+	Op    string `json:"op"`
+	Event *Event `json:"event,omitempty"`
+	ID    string `json:"id,omitempty"`
+}
+
+// FileOutbox logs events to a file before they are published, so events
+// emitted while the broker is unreachable survive a restart. Adds are
+// synced to disk before Add returns; an ack that is lost in a crash only
+// means the event is published again.
+type FileOutbox struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	memory *MemoryOutbox
+	acked  int
+}
+
+// OpenFileOutbox loads the events still pending in the file at path,
+// creating it if needed
+func OpenFileOutbox(path string, maxPending int) (*FileOutbox, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	o := &FileOutbox{path: path, memory: NewMemoryOutbox(maxPending)}
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+	if err := o.compact(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// load replays the file. A torn last line, left by a crash mid-write, is
+// skipped; that event was never acknowledged to its caller.
+func (o *FileOutbox) load() error {
+	file, err := os.Open(o.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var order []string
+	pending := make(map[string]Event)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var record outboxRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		switch record.Op {
+		case "add":
+			if record.Event != nil {
+				order = append(order, record.Event.ID)
+				pending[record.Event.ID] = *record.Event
+			}
+		case "ack":
+			delete(pending, record.ID)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range order {
+		if event, ok := pending[id]; ok {
+			o.memory.events = append(o.memory.events, event)
+			delete(pending, id)
+		}
+	}
+	outboxPending.Set(float64(len(o.memory.events)))
+	return nil
+}
+
+// compact rewrites the file with only the pending events and reopens it
+// for appending
+func (o *FileOutbox) compact() error {
+	tmp := o.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	for i := range o.memory.events {
+		if err := writeRecord(w, outboxRecord{Op: "add", Event: &o.memory.events[i]}); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		return err
+	}
+
+	if o.file != nil {
+		o.file.Close()
+	}
+	o.file, err = os.OpenFile(o.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	o.acked = 0
+	return nil
+}
+
+func writeRecord(w io.Writer, record outboxRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+func (o *FileOutbox) Add(event Event) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.memory.Len() >= o.memory.maxPending {
+		return ErrOutboxFull
+	}
+	if err := writeRecord(o.file, outboxRecord{Op: "add", Event: &event}); err != nil {
+		return err
+	}
+	if err := o.file.Sync(); err != nil {
+		return err
+	}
+	return o.memory.Add(event)
+}
+
+func (o *FileOutbox) Pending(limit int) ([]Event, error) {
+	return o.memory.Pending(limit)
+}
+
+func (o *FileOutbox) Ack(ids ...string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	w := bufio.NewWriter(o.file)
+	for _, id := range ids {
+		if err := writeRecord(w, outboxRecord{Op: "ack", ID: id}); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	o.memory.Ack(ids...)
+
+	if o.acked += len(ids); o.acked >= compactAfter {
+		return o.compact()
+	}
+	return nil
+}
+
+func (o *FileOutbox) Len() int {
+	return o.memory.Len()
+}
+
+func (o *FileOutbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.file.Close()
+}
@@ -0,0 +1,260 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"platform"
+)
+
+// Publisher sends a single event to the broker, returning once the broker
+// has accepted it
+type Publisher interface {
+	Name() string
+	Publish(ctx context.Context, topic string, event Event) error
+	Close() error
+}
+
+// NewPublisher connects to the broker in cfg. name identifies the service
+// to the broker.
+func NewPublisher(cfg Config, name string) (Publisher, error) {
+	switch cfg.Broker {
+	case BrokerKafka:
+		return NewKafkaPublisher(cfg.Brokers), nil
+	case BrokerNATS:
+		return NewNATSPublisher(cfg, name)
+	default:
+		return nil, errors.New("unknown EVENTS_BROKER " + cfg.Broker)
+	}
+}
+
+// KafkaPublisher writes events keyed by Event.Key, so a key's events keep
+// their order within a partition. Topics are created on first use when the
+// cluster allows it.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaPublisher(brokers []string) *KafkaPublisher {
+	return &KafkaPublisher{writer: &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+		// The relay writes one event at a time; don't hold it back waiting
+		// for a fuller batch
+		BatchTimeout: 10 * time.Millisecond,
+	}}
+}
+
+func (p *KafkaPublisher) Name() string { return BrokerKafka }
+
+func (p *KafkaPublisher) Publish(ctx context.Context, topic string, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Topic: topic,
+		Key:   []byte(event.Key),
+		Value: data,
+		Headers: []kafka.Header{
+			{Key: "event-id", Value: []byte(event.ID)},
+			{Key: "event-type", Value: []byte(event.Type)},
+		},
+	})
+}
+
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
+
+// NATSPublisher publishes events to a JetStream stream, creating the stream
+// over TopicPrefix+">" if it doesn't exist. The event ID is sent as the
+// message ID, so JetStream drops events the relay publishes twice.
+type NATSPublisher struct {
+	conn *nats.Conn
+	js   nats.JetStreamContext
+}
+
+func NewNATSPublisher(cfg Config, name string) (*NATSPublisher, error) {
+	conn, js, err := connectJetStream(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+	return &NATSPublisher{conn: conn, js: js}, nil
+}
+
+// connectJetStream connects to NATS_URL and makes sure the events stream
+// exists
+func connectJetStream(cfg Config, name string) (*nats.Conn, nats.JetStreamContext, error) {
+	conn, err := nats.Connect(cfg.NATSURL, nats.Name(name), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, nil, err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	_, err = js.StreamInfo(cfg.Stream)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     cfg.Stream,
+			Subjects: []string{cfg.TopicPrefix + ">"},
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, js, nil
+}
+
+func (p *NATSPublisher) Name() string { return BrokerNATS }
+
+func (p *NATSPublisher) Publish(ctx context.Context, topic string, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(topic)
+	msg.Data = data
+	msg.Header.Set("Event-Type", event.Type)
+	_, err = p.js.PublishMsg(msg, nats.Context(ctx), nats.MsgId(event.ID))
+	return err
+}
+
+func (p *NATSPublisher) Close() error {
+	return p.conn.Drain()
+}
+
+// Relay publishes the outbox's events in order. An event that fails holds
+// up the ones behind it until the broker accepts it, so consumers see each
+// key's events in the order they were emitted.
+type Relay struct {
+	cfg        Config
+	outbox     Outbox
+	publisher  Publisher
+	logger     *platform.StructuredLogger
+	batchSize  int
+	interval   time.Duration
+	maxBackoff time.Duration
+	wake       chan struct{}
+}
+
+func NewRelay(cfg Config, outbox Outbox, publisher Publisher, logger *platform.StructuredLogger) *Relay {
+	return &Relay{
+		cfg:        cfg,
+		outbox:     outbox,
+		publisher:  publisher,
+		logger:     logger,
+		batchSize:  envInt("OUTBOX_BATCH_SIZE", 100),
+		interval:   envDuration("OUTBOX_POLL_INTERVAL", time.Second),
+		maxBackoff: envDuration("OUTBOX_MAX_BACKOFF", 30*time.Second),
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes the relay to publish newly added events straight away
+// rather than at the next poll
+func (r *Relay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes events until ctx is done, backing off while the broker is
+// failing
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	backoff := r.interval
+	for {
+		if err := r.drain(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Warn(ctx, "Failed to publish outbox events", map[string]interface{}{
+				"broker":   r.publisher.Name(),
+				"pending":  r.outbox.Len(),
+				"retry_in": backoff.String(),
+				"error":    err.Error(),
+			})
+			if !sleep(ctx, backoff) {
+				return
+			}
+			if backoff *= 2; backoff > r.maxBackoff {
+				backoff = r.maxBackoff
+			}
+			continue
+		}
+		backoff = r.interval
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain publishes pending events until the outbox is empty or an event
+// fails. Published events are acknowledged even when a later one fails.
+func (r *Relay) drain(ctx context.Context) error {
+	for {
+		pending, err := r.outbox.Pending(r.batchSize)
+		if err != nil || len(pending) == 0 {
+			return err
+		}
+
+		published := make([]string, 0, len(pending))
+		var publishErr error
+		for _, event := range pending {
+			if publishErr = r.publish(ctx, event); publishErr != nil {
+				break
+			}
+			published = append(published, event.ID)
+		}
+		if len(published) > 0 {
+			if err := r.outbox.Ack(published...); err != nil {
+				return err
+			}
+		}
+		if publishErr != nil {
+			return publishErr
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, event Event) error {
+	topic := r.cfg.Topic(event.Type)
+	ctx, span := platform.StartLinked(ctx, tracer, "events.publish", event.Trace,
+		trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("messaging.system", r.publisher.Name()),
+		attribute.String("messaging.destination.name", topic),
+		attribute.String("messaging.message.id", event.ID),
+		attribute.String("event.type", event.Type),
+	)
+
+	start := time.Now()
+	err := r.publisher.Publish(ctx, topic, event)
+	publishDuration.WithLabelValues(r.publisher.Name()).Observe(time.Since(start).Seconds())
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		eventsPublished.WithLabelValues(r.publisher.Name(), topic, "failed").Inc()
+		return err
+	}
+	eventsPublished.WithLabelValues(r.publisher.Name(), topic, "published").Inc()
+	return nil
+}
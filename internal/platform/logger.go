@@ -0,0 +1,264 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type LogLevel string
+
+const (
+	LevelDebug LogLevel = "DEBUG"
+	LevelInfo  LogLevel = "INFO"
+	LevelWarn  LogLevel = "WARN"
+	LevelError LogLevel = "ERROR"
+)
+
+var levelSeverity = map[LogLevel]int{
+	LevelDebug: 0,
+	LevelInfo:  1,
+	LevelWarn:  2,
+	LevelError: 3,
+}
+
+// ParseLogLevel parses debug, info, warn (or warning) and error in any case
+func ParseLogLevel(s string) (LogLevel, error) {
+	level := LogLevel(strings.ToUpper(strings.TrimSpace(s)))
+	if level == "WARNING" {
+		level = LevelWarn
+	}
+	if _, ok := levelSeverity[level]; !ok {
+		return "", fmt.Errorf("must be debug, info, warn or error, got %q", s)
+	}
+	return level, nil
+}
+
+// ParseSampleRate parses a sampling rate between 0 and 1
+func ParseSampleRate(s string) (float64, error) {
+	rate, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("must be between 0 and 1, got %s", s)
+	}
+	return rate, nil
+}
+
+// StructuredLogger writes one JSON object per line to stdout, tagged with
+// the trace and span IDs of the span in ctx and the request ID, when there
+// are some. Lines below the minimum level are dropped, and Info lines are
+// sampled.
+type StructuredLogger struct {
+	serviceName string
+	output      io.Writer
+
+	mu             sync.RWMutex
+	minLevel       LogLevel
+	infoSampleRate float64
+	exporter       *LogExporter
+}
+
+type LogEntry struct {
+	Timestamp   string                 `json:"timestamp"`
+	Level       LogLevel               `json:"level"`
+	ServiceName string                 `json:"service_name"`
+	TraceID     string                 `json:"trace_id,omitempty"`
+	SpanID      string                 `json:"span_id,omitempty"`
+	RequestID   string                 `json:"request_id,omitempty"`
+	Message     string                 `json:"message"`
+	Fields      map[string]interface{} `json:"fields,omitempty"`
+}
+
+func NewStructuredLogger(serviceName string) *StructuredLogger {
+	l := &StructuredLogger{
+		serviceName:    serviceName,
+		output:         os.Stdout,
+		minLevel:       LevelInfo,
+		infoSampleRate: 1,
+	}
+	l.LoadSettings()
+	return l
+}
+
+// LoadSettings applies LOG_LEVEL (default info) and LOG_INFO_SAMPLE_RATE,
+// the fraction of Info lines to keep (default 1). Invalid values are
+// ignored; services reject them at startup.
+func (l *StructuredLogger) LoadSettings() {
+	level, err := ParseLogLevel(GetEnv("LOG_LEVEL", "info"))
+	if err != nil {
+		level = LevelInfo
+	}
+	rate, err := ParseSampleRate(GetEnv("LOG_INFO_SAMPLE_RATE", "1"))
+	if err != nil {
+		rate = 1
+	}
+	l.SetLevel(level)
+	l.SetInfoSampleRate(rate)
+}
+
+// Level returns the minimum level that is written
+func (l *StructuredLogger) Level() LogLevel {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.minLevel
+}
+
+// SetLevel changes the minimum level that is written
+func (l *StructuredLogger) SetLevel(level LogLevel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.minLevel = level
+}
+
+// InfoSampleRate returns the fraction of Info lines that are written
+func (l *StructuredLogger) InfoSampleRate() float64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.infoSampleRate
+}
+
+// SetInfoSampleRate changes the fraction of Info lines that are written
+func (l *StructuredLogger) SetInfoSampleRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.infoSampleRate = rate
+}
+
+// enabled reports whether a line at level should be written. Info lines
+// in a trace are sampled by trace ID, so a trace keeps all of its lines or
+// none of them.
+func (l *StructuredLogger) enabled(level LogLevel, traceID string) bool {
+	l.mu.RLock()
+	minLevel, rate := l.minLevel, l.infoSampleRate
+	l.mu.RUnlock()
+
+	if levelSeverity[level] < levelSeverity[minLevel] {
+		return false
+	}
+	if level != LevelInfo || rate >= 1 {
+		return true
+	}
+	if traceID == "" {
+		return rand.Float64() < rate
+	}
+	h := fnv.New32a()
+	h.Write([]byte(traceID))
+	return float64(h.Sum32())/(1<<32) < rate
+}
+
+// setExporter also sends every line that is written to e
+func (l *StructuredLogger) setExporter(e *LogExporter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.exporter = e
+}
+
+func (l *StructuredLogger) extractTraceInfo(ctx context.Context) (traceID, spanID string) {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		traceID = span.SpanContext().TraceID().String()
+		spanID = span.SpanContext().SpanID().String()
+	}
+	return
+}
+
+func (l *StructuredLogger) log(ctx context.Context, level LogLevel, message string, fields map[string]interface{}) {
+	traceID, spanID := l.extractTraceInfo(ctx)
+	if !l.enabled(level, traceID) {
+		return
+	}
+
+	now := time.Now()
+	entry := LogEntry{
+		Timestamp:   now.UTC().Format(time.RFC3339),
+		Level:       level,
+		ServiceName: l.serviceName,
+		TraceID:     traceID,
+		SpanID:      spanID,
+		RequestID:   RequestID(ctx),
+		Message:     message,
+		Fields:      fields,
+	}
+
+	data, _ := json.Marshal(entry)
+	fmt.Fprintln(l.output, string(data))
+
+	l.mu.RLock()
+	exporter := l.exporter
+	l.mu.RUnlock()
+	if exporter != nil {
+		exporter.export(entry, trace.SpanContextFromContext(ctx), now)
+	}
+}
+
+func (l *StructuredLogger) Debug(ctx context.Context, message string, fields ...map[string]interface{}) {
+	var f map[string]interface{}
+	if len(fields) > 0 {
+		f = fields[0]
+	}
+	l.log(ctx, LevelDebug, message, f)
+}
+
+func (l *StructuredLogger) Info(ctx context.Context, message string, fields ...map[string]interface{}) {
+	var f map[string]interface{}
+	if len(fields) > 0 {
+		f = fields[0]
+	}
+	l.log(ctx, LevelInfo, message, f)
+}
+
+func (l *StructuredLogger) Warn(ctx context.Context, message string, fields ...map[string]interface{}) {
+	var f map[string]interface{}
+	if len(fields) > 0 {
+		f = fields[0]
+	}
+	l.log(ctx, LevelWarn, message, f)
+}
+
+func (l *StructuredLogger) Error(ctx context.Context, message string, fields ...map[string]interface{}) {
+	var f map[string]interface{}
+	if len(fields) > 0 {
+		f = fields[0]
+	}
+	l.log(ctx, LevelError, message, f)
+}
+
+func (l *StructuredLogger) WithFields(fields map[string]interface{}) *LoggerWithFields {
+	return &LoggerWithFields{
+		logger: l,
+		fields: fields,
+	}
+}
+
+type LoggerWithFields struct {
+	logger *StructuredLogger
+	fields map[string]interface{}
+}
+
+func (lf *LoggerWithFields) Debug(ctx context.Context, message string) {
+	lf.logger.Debug(ctx, message, lf.fields)
+}
+
+func (lf *LoggerWithFields) Info(ctx context.Context, message string) {
+	lf.logger.Info(ctx, message, lf.fields)
+}
+
+func (lf *LoggerWithFields) Warn(ctx context.Context, message string) {
+	lf.logger.Warn(ctx, message, lf.fields)
+}
+
+func (lf *LoggerWithFields) Error(ctx context.Context, message string) {
+	lf.logger.Error(ctx, message, lf.fields)
+}
@@ -0,0 +1,61 @@
+package platform
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// NewRequestMetrics registers the Prometheus request counter and latency
+// histogram every service reports, named <prefix>_request_count and
+// <prefix>_response_time. service names the service in the help text.
+func NewRequestMetrics(prefix, service string) (*prometheus.CounterVec, *prometheus.HistogramVec) {
+	requestCount := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: prefix + "_request_count",
+			Help: "Number of requests received by the " + service,
+		},
+		[]string{"method", "endpoint", "status"},
+	)
+	responseTime := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    prefix + "_response_time",
+			Help:    "Response time of the " + service,
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method", "endpoint"},
+	)
+	prometheus.MustRegister(requestCount, responseTime)
+	return requestCount, responseTime
+}
+
+// MetricsMiddleware records the duration of every request as the OTel
+// http.server.request.duration histogram by method, route and status code.
+// Instruments follow the global MeterProvider, so it may be set up first.
+func MetricsMiddleware(serviceName string) gin.HandlerFunc {
+	duration, _ := otel.Meter(serviceName).Float64Histogram(
+		"http.server.request.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of HTTP requests handled by the service"),
+	)
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		duration.Record(c.Request.Context(), time.Since(start).Seconds(), metric.WithAttributes(
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", c.FullPath()),
+			attribute.Int("http.response.status_code", c.Writer.Status()),
+		))
+	}
+}
+
+// PrometheusEnabled reports whether to keep serving /metrics for scrapers;
+// set PROMETHEUS_METRICS_ENABLED=false once everything reads OTLP
+func PrometheusEnabled() bool {
+	return Get("PROMETHEUS_METRICS_ENABLED") != "false"
+}
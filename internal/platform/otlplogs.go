@@ -0,0 +1,209 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	logBatchSize     = 512
+	logQueueSize     = 2048
+	logFlushInterval = time.Second
+)
+
+var logSeverityNumber = map[LogLevel]logspb.SeverityNumber{
+	LevelDebug: logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG,
+	LevelInfo:  logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+	LevelWarn:  logspb.SeverityNumber_SEVERITY_NUMBER_WARN,
+	LevelError: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+}
+
+// LogExporter batches log lines and posts them to the collector over
+// OTLP/HTTP. Lines are dropped rather than blocking the caller when the
+// queue is full.
+type LogExporter struct {
+	endpoint string
+	client   *http.Client
+	resource *resourcepb.Resource
+	scope    *commonpb.InstrumentationScope
+
+	queue chan *logspb.LogRecord
+	flush chan chan struct{}
+	done  chan struct{}
+}
+
+// logsEndpoint is OTEL_EXPORTER_OTLP_LOGS_ENDPOINT, or /v1/logs on the
+// collector's OTLP/HTTP port. Logs always use OTLP/HTTP, even for services
+// exporting traces over gRPC.
+func (t Telemetry) logsEndpoint() string {
+	if endpoint := Get("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	host, insecure := t.endpoint()
+	if t.GRPC {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = net.JoinHostPort(h, "4318")
+		}
+	}
+	scheme := "https"
+	if insecure {
+		scheme = "http"
+	}
+	return scheme + "://" + host + "/v1/logs"
+}
+
+// InitLogExport sends everything logger writes to the collector as well as
+// stdout when OTEL_LOGS_ENABLED=true. It returns nil when log export is
+// disabled.
+func InitLogExport(ctx context.Context, logger *StructuredLogger, t Telemetry) (*LogExporter, error) {
+	if Get("OTEL_LOGS_ENABLED") != "true" {
+		return nil, nil
+	}
+	res, err := t.resource(ctx)
+	if err != nil {
+		return nil, err
+	}
+	attrs := make([]*commonpb.KeyValue, 0, res.Len())
+	for _, kv := range res.Attributes() {
+		attrs = append(attrs, stringAttr(string(kv.Key), kv.Value.Emit()))
+	}
+
+	e := &LogExporter{
+		endpoint: t.logsEndpoint(),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		resource: &resourcepb.Resource{Attributes: attrs},
+		scope:    &commonpb.InstrumentationScope{Name: t.ServiceName, Version: t.ServiceVersion},
+		queue:    make(chan *logspb.LogRecord, logQueueSize),
+		flush:    make(chan chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	logger.setExporter(e)
+	return e, nil
+}
+
+// Shutdown sends any queued lines and stops the exporter
+func (e *LogExporter) Shutdown(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case e.flush <- flushed:
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *LogExporter) export(entry LogEntry, sc trace.SpanContext, at time.Time) {
+	record := &logspb.LogRecord{
+		TimeUnixNano:         uint64(at.UnixNano()),
+		ObservedTimeUnixNano: uint64(at.UnixNano()),
+		SeverityNumber:       logSeverityNumber[entry.Level],
+		SeverityText:         string(entry.Level),
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: entry.Message}},
+	}
+	for k, v := range entry.Fields {
+		record.Attributes = append(record.Attributes, stringAttr(k, fmt.Sprint(v)))
+	}
+	if entry.RequestID != "" {
+		record.Attributes = append(record.Attributes, stringAttr("request_id", entry.RequestID))
+	}
+	if sc.IsValid() {
+		traceID, spanID := sc.TraceID(), sc.SpanID()
+		record.TraceId = traceID[:]
+		record.SpanId = spanID[:]
+		record.Flags = uint32(sc.TraceFlags())
+	}
+
+	select {
+	case e.queue <- record:
+	default:
+	}
+}
+
+func (e *LogExporter) run() {
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*logspb.LogRecord, 0, logBatchSize)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.post(batch); err != nil {
+			// Not through the logger, which would queue another line
+			fmt.Fprintf(os.Stderr, "failed to export %d log records: %v\n", len(batch), err)
+		}
+		batch = make([]*logspb.LogRecord, 0, logBatchSize)
+	}
+
+	for {
+		select {
+		case record := <-e.queue:
+			batch = append(batch, record)
+			if len(batch) >= logBatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case flushed := <-e.flush:
+			for len(e.queue) > 0 {
+				batch = append(batch, <-e.queue)
+			}
+			send()
+			close(e.done)
+			close(flushed)
+			return
+		}
+	}
+}
+
+func (e *LogExporter) post(records []*logspb.LogRecord) error {
+	body, err := proto.Marshal(&collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: e.resource,
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope:      e.scope,
+				LogRecords: records,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Post(e.endpoint, "application/x-protobuf", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
@@ -0,0 +1,226 @@
+package platform
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// latencyWindow holds a route's most recent latencies in a ring, and the
+// quantile of them that marks an outlier
+type latencyWindow struct {
+	samples     []time.Duration
+	next        int
+	count       int
+	sinceUpdate int
+	threshold   time.Duration
+}
+
+func (w *latencyWindow) add(latency time.Duration) {
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % len(w.samples)
+	if w.count < len(w.samples) {
+		w.count++
+	}
+	w.sinceUpdate++
+}
+
+// update recomputes the threshold from the samples in the window
+func (w *latencyWindow) update(quantile float64) {
+	sorted := make([]time.Duration, w.count)
+	copy(sorted, w.samples[:w.count])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	w.threshold = sorted[int(math.Ceil(quantile*float64(w.count)))-1]
+	w.sinceUpdate = 0
+}
+
+// OutlierDetector flags requests slower than a quantile of their route's
+// recent latencies, so slow-request exemplars can be found in the trace
+// backend by attribute instead of by scrolling through latency charts.
+// An outlier's span gets latency.outlier=true with the threshold it
+// crossed, and a sample of outliers is logged with the process state at
+// the time: goroutines, heap and the depth of any registered queues.
+//
+// Settings: OUTLIER_QUANTILE (percent, default 99), OUTLIER_WINDOW_SIZE
+// (latencies kept per route, default 1000), OUTLIER_MIN_SAMPLES (default
+// 100, before which nothing is flagged), OUTLIER_MIN_LATENCY (default
+// 50ms, so fast routes don't flag 3ms requests) and
+// OUTLIER_LOG_SAMPLE_RATE (fraction of outliers logged, default 0.1).
+type OutlierDetector struct {
+	mu         sync.Mutex
+	service    string
+	logger     *StructuredLogger
+	quantile   float64
+	windowSize int
+	minSamples int
+	minLatency time.Duration
+	logRate    float64
+	exclude    map[string]bool
+	routes     map[string]*latencyWindow
+	queues     map[string]func() int
+
+	outliers   *prometheus.CounterVec
+	thresholds *prometheus.GaugeVec
+}
+
+// NewOutlierDetectorFromEnv registers the detector's metrics. exclude
+// lists routes, as "METHOD /path", that are never flagged, such as event
+// streams that stay open until the client leaves.
+func NewOutlierDetectorFromEnv(service string, logger *StructuredLogger, exclude ...string) *OutlierDetector {
+	atoi := func(key string, fallback int) int {
+		n, err := strconv.Atoi(Get(key))
+		if err != nil || n <= 0 {
+			return fallback
+		}
+		return n
+	}
+	logRate, err := strconv.ParseFloat(getOr("OUTLIER_LOG_SAMPLE_RATE", "0.1"), 64)
+	if err != nil || logRate < 0 || logRate > 1 {
+		logRate = 0.1
+	}
+	d := &OutlierDetector{
+		service:    service,
+		logger:     logger,
+		quantile:   parsePercent(Get("OUTLIER_QUANTILE"), 0.99),
+		windowSize: atoi("OUTLIER_WINDOW_SIZE", 1000),
+		minSamples: atoi("OUTLIER_MIN_SAMPLES", 100),
+		minLatency: parseDuration(Get("OUTLIER_MIN_LATENCY"), 50*time.Millisecond),
+		logRate:    logRate,
+		exclude:    make(map[string]bool),
+		routes:     make(map[string]*latencyWindow),
+		queues:     make(map[string]func() int),
+		outliers: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "http_latency_outliers_total",
+				Help: "Number of requests slower than their route's outlier threshold",
+			},
+			[]string{"service", "route"},
+		),
+		thresholds: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "http_latency_outlier_threshold_seconds",
+				Help: "Latency above which a route's requests are flagged as outliers",
+			},
+			[]string{"service", "route"},
+		),
+	}
+	if d.minSamples > d.windowSize {
+		d.minSamples = d.windowSize
+	}
+	for _, route := range exclude {
+		d.exclude[route] = true
+	}
+	prometheus.MustRegister(d.outliers, d.thresholds)
+	return d
+}
+
+// AddQueue includes a queue's depth in outlier logs
+func (d *OutlierDetector) AddQueue(name string, depth func() int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queues[name] = depth
+}
+
+// observe records a latency and returns the route's threshold before it,
+// or 0 while the route has too few samples
+func (d *OutlierDetector) observe(route string, latency time.Duration) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w, ok := d.routes[route]
+	if !ok {
+		w = &latencyWindow{samples: make([]time.Duration, d.windowSize)}
+		d.routes[route] = w
+	}
+	var threshold time.Duration
+	if w.count >= d.minSamples {
+		threshold = w.threshold
+	}
+	w.add(latency)
+	// Re-sorting on every request would cost more than the requests it
+	// measures, so the threshold trails the window slightly
+	if w.count >= d.minSamples && (w.threshold == 0 || w.sinceUpdate >= d.windowSize/20) {
+		w.update(d.quantile)
+		d.thresholds.WithLabelValues(d.service, route).Set(w.threshold.Seconds())
+	}
+	return threshold
+}
+
+func (d *OutlierDetector) queueDepths() map[string]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	depths := make(map[string]int, len(d.queues))
+	for name, depth := range d.queues {
+		depths[name] = depth()
+	}
+	return depths
+}
+
+// Middleware flags outliers on every matched route, except health checks,
+// /metrics, the admin and chaos APIs and the excluded routes. Mount it
+// after otelgin so the request's span is still open.
+func (d *OutlierDetector) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		path := c.FullPath()
+		if path == "" || path == "/health" || path == "/readyz" || path == "/metrics" || path == "/slo" ||
+			path == "/config/reload" || strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "/chaos") {
+			return
+		}
+		route := c.Request.Method + " " + path
+		if d.exclude[route] {
+			return
+		}
+		latency := time.Since(start)
+		threshold := d.observe(route, latency)
+		if threshold == 0 || latency <= threshold || latency < d.minLatency {
+			return
+		}
+
+		d.outliers.WithLabelValues(d.service, route).Inc()
+		ctx := c.Request.Context()
+		goroutines := runtime.NumGoroutine()
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(
+			attribute.Bool("latency.outlier", true),
+			attribute.Float64("latency.outlier.threshold_ms", float64(threshold.Microseconds())/1000),
+			attribute.Float64("latency.outlier.quantile", d.quantile),
+			attribute.Int("runtime.goroutines", goroutines),
+		)
+		if rand.Float64() >= d.logRate {
+			return
+		}
+
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		fields := map[string]interface{}{
+			"method":           c.Request.Method,
+			"path":             c.Request.URL.Path,
+			"route":            path,
+			"status_code":      c.Writer.Status(),
+			"latency_ms":       float64(latency.Microseconds()) / 1000,
+			"threshold_ms":     float64(threshold.Microseconds()) / 1000,
+			"quantile":         d.quantile,
+			"goroutines":       goroutines,
+			"heap_alloc_bytes": mem.HeapAlloc,
+			"gc_count":         mem.NumGC,
+		}
+		for name, depth := range d.queueDepths() {
+			fields["queue_depth."+name] = depth
+		}
+		span.AddEvent("latency.outlier.logged")
+		// Warn, so the entry survives Info sampling
+		d.logger.Warn(ctx, "Slow request outlier", fields)
+	}
+}
@@ -0,0 +1,157 @@
+package platform
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	clientOpenConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "http_client_open_connections",
+			Help: "Number of open connections to other services, idle or in use",
+		},
+		[]string{"host"},
+	)
+	clientDials = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_client_dials_total",
+			Help: "Number of new connections dialed to other services",
+		},
+		[]string{"host", "result"},
+	)
+	clientConnsAcquired = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_client_connections_acquired_total",
+			Help: "Number of requests to other services by whether they reused a pooled connection",
+		},
+		[]string{"host", "reused"},
+	)
+	clientConnWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_client_connection_wait_seconds",
+			Help:    "Time requests to other services waited for a connection, including dialing",
+			Buckets: []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		},
+		[]string{"host"},
+	)
+)
+
+// PoolSettings tune the connection pool shared by every client built on
+// ServiceTransport
+type PoolSettings struct {
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int
+	IdleConnTimeout       time.Duration
+	DialTimeout           time.Duration
+	KeepAlive             time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+}
+
+// PoolSettingsFromEnv reads the HTTP_CLIENT_* settings. net/http keeps only
+// 2 idle connections per host by default, so busy callers dial a new
+// connection for most requests; the default here keeps 32.
+func PoolSettingsFromEnv() PoolSettings {
+	return PoolSettings{
+		MaxIdleConns:          envInt("HTTP_CLIENT_MAX_IDLE_CONNS", 100),
+		MaxIdleConnsPerHost:   envInt("HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST", 32),
+		MaxConnsPerHost:       envInt("HTTP_CLIENT_MAX_CONNS_PER_HOST", 0),
+		IdleConnTimeout:       envDuration("HTTP_CLIENT_IDLE_CONN_TIMEOUT", 90*time.Second),
+		DialTimeout:           envDuration("HTTP_CLIENT_DIAL_TIMEOUT", 5*time.Second),
+		KeepAlive:             envDuration("HTTP_CLIENT_KEEP_ALIVE", 30*time.Second),
+		TLSHandshakeTimeout:   envDuration("HTTP_CLIENT_TLS_HANDSHAKE_TIMEOUT", 5*time.Second),
+		ResponseHeaderTimeout: envDuration("HTTP_CLIENT_RESPONSE_HEADER_TIMEOUT", 0),
+	}
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(Get(key)); err == nil && n >= 0 {
+		return n
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(Get(key)); err == nil && d >= 0 {
+		return d
+	}
+	return fallback
+}
+
+// newPooledTransport builds a transport with the pool settings whose
+// connections are counted in the http_client_* metrics
+func newPooledTransport(settings PoolSettings, tlsConfig *tls.Config) http.RoundTripper {
+	dialer := &net.Dialer{
+		Timeout:   settings.DialTimeout,
+		KeepAlive: settings.KeepAlive,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			clientDials.WithLabelValues(addr, "error").Inc()
+			return nil, err
+		}
+		clientDials.WithLabelValues(addr, "success").Inc()
+		clientOpenConnections.WithLabelValues(addr).Inc()
+		return &countedConn{Conn: conn, host: addr}, nil
+	}
+	transport.MaxIdleConns = settings.MaxIdleConns
+	transport.MaxIdleConnsPerHost = settings.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = settings.MaxConnsPerHost
+	transport.IdleConnTimeout = settings.IdleConnTimeout
+	transport.TLSHandshakeTimeout = settings.TLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = settings.ResponseHeaderTimeout
+	transport.TLSClientConfig = tlsConfig
+	return &poolStatsTransport{base: transport}
+}
+
+// countedConn keeps http_client_open_connections up to date
+type countedConn struct {
+	net.Conn
+	host   string
+	closed sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.closed.Do(func() {
+		clientOpenConnections.WithLabelValues(c.host).Dec()
+	})
+	return c.Conn.Close()
+}
+
+// poolStatsTransport records how long each request waited for a connection
+// and whether it got a pooled one
+type poolStatsTransport struct {
+	base *http.Transport
+}
+
+func (t *poolStatsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	var start time.Time
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			start = time.Now()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			clientConnsAcquired.WithLabelValues(host, strconv.FormatBool(info.Reused)).Inc()
+			clientConnWait.WithLabelValues(host).Observe(time.Since(start).Seconds())
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return t.base.RoundTrip(req)
+}
+
+func (t *poolStatsTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
@@ -0,0 +1,71 @@
+package platform
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceCarrier holds the W3C trace context and baggage of the span that
+// handed off asynchronous work, e.g. inside a queued message
+type TraceCarrier map[string]string
+
+// InjectTrace captures the trace context and baggage of ctx
+func InjectTrace(ctx context.Context) TraceCarrier {
+	carrier := TraceCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(carrier))
+	return carrier
+}
+
+// StartLinked starts a span for work queued by the span in carrier. The new
+// span continues the trace in ctx, links to the producer and inherits its
+// baggage and request ID, so the two traces can be followed in either
+// direction.
+func StartLinked(ctx context.Context, tracer trace.Tracer, name string, carrier TraceCarrier, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	producer := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(carrier))
+	if bag := baggage.FromContext(producer); bag.Len() > 0 {
+		ctx = baggage.ContextWithBaggage(ctx, bag)
+	}
+	if id := RequestID(producer); id != "" {
+		ctx = ContextWithRequestID(ctx, id)
+	}
+	if sc := trace.SpanContextFromContext(producer); sc.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: sc}))
+	}
+	return tracer.Start(ctx, name, opts...)
+}
+
+// WithBaggage adds key=value to the baggage sent with every call made from
+// ctx. Downstream services record it on each span they start. Keys or
+// values that are not valid baggage are ignored.
+func WithBaggage(ctx context.Context, key, value string) context.Context {
+	member, err := baggage.NewMember(key, value)
+	if err != nil {
+		return ctx
+	}
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// baggageSpanProcessor copies the baggage in a span's parent context onto
+// the span as attributes, so e.g. booking.id is searchable on every span of
+// a booking
+type baggageSpanProcessor struct{}
+
+func (baggageSpanProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	for _, member := range baggage.FromContext(parent).Members() {
+		s.SetAttributes(attribute.String(member.Key(), member.Value()))
+	}
+}
+
+func (baggageSpanProcessor) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (baggageSpanProcessor) Shutdown(context.Context) error   { return nil }
+func (baggageSpanProcessor) ForceFlush(context.Context) error { return nil }
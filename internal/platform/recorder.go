@@ -0,0 +1,348 @@
+package platform
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RecordHeader asks the recorder to capture a request regardless of
+// sampling; the response names the recording in RecordingIDHeader
+const (
+	RecordHeader      = "X-Debug-Record"
+	RecordingIDHeader = "X-Debug-Recording"
+)
+
+// redactedHeaders are never recorded
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"Proxy-Authorization": true,
+	"X-Api-Key":           true,
+}
+
+var (
+	debugRecordings = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "debug_recordings_total",
+			Help: "Number of requests recorded by the debug recorder, by why they were recorded",
+		},
+		[]string{"reason"},
+	)
+	registerRecorderOnce sync.Once
+)
+
+// Recording is one captured request and its response. Bodies are cut at
+// DEBUG_RECORDER_MAX_BODY_BYTES.
+type Recording struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	Reason     string    `json:"reason"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Route      string    `json:"route"`
+	Status     int       `json:"status"`
+	DurationMs float64   `json:"duration_ms"`
+	TraceID    string    `json:"trace_id,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+
+	RequestHeaders        map[string]string `json:"request_headers"`
+	RequestBody           string            `json:"request_body"`
+	RequestBodyTruncated  bool              `json:"request_body_truncated,omitempty"`
+	ResponseHeaders       map[string]string `json:"response_headers"`
+	ResponseBody          string            `json:"response_body"`
+	ResponseBodyTruncated bool              `json:"response_body_truncated,omitempty"`
+}
+
+// Recorder keeps the latest recordings in a ring buffer
+type Recorder struct {
+	sampleRate float64
+	minStatus  int
+	maxBody    int
+
+	mu         sync.Mutex
+	recordings []Recording
+	next       int
+	full       bool
+}
+
+var recorder *Recorder
+
+// NewRecorderFromEnv reads DEBUG_RECORDER_ENABLED (default false),
+// DEBUG_RECORDER_SAMPLE_RATE (default 0, so only requests with
+// X-Debug-Record are captured), DEBUG_RECORDER_MIN_STATUS (default 0),
+// DEBUG_RECORDER_MAX_BODY_BYTES (default 16384) and
+// DEBUG_RECORDER_BUFFER_SIZE (default 100). It returns nil when disabled.
+func NewRecorderFromEnv() *Recorder {
+	if GetEnv("DEBUG_RECORDER_ENABLED", "false") != "true" {
+		return nil
+	}
+	rate, err := strconv.ParseFloat(GetEnv("DEBUG_RECORDER_SAMPLE_RATE", "0"), 64)
+	if err != nil || rate < 0 || rate > 1 {
+		rate = 0
+	}
+	minStatus, err := strconv.Atoi(GetEnv("DEBUG_RECORDER_MIN_STATUS", "0"))
+	if err != nil || minStatus < 0 {
+		minStatus = 0
+	}
+	maxBody, err := strconv.Atoi(GetEnv("DEBUG_RECORDER_MAX_BODY_BYTES", "16384"))
+	if err != nil || maxBody < 0 {
+		maxBody = 16384
+	}
+	size, err := strconv.Atoi(GetEnv("DEBUG_RECORDER_BUFFER_SIZE", "100"))
+	if err != nil || size <= 0 {
+		size = 100
+	}
+	return &Recorder{
+		sampleRate: rate,
+		minStatus:  minStatus,
+		maxBody:    maxBody,
+		recordings: make([]Recording, size),
+	}
+}
+
+func (r *Recorder) add(rec Recording) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recordings[r.next] = rec
+	r.next = (r.next + 1) % len(r.recordings)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// List returns the recordings held, newest first
+func (r *Recorder) List() []Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.next
+	if r.full {
+		n = len(r.recordings)
+	}
+	result := make([]Recording, 0, n)
+	for i := 1; i <= n; i++ {
+		result = append(result, r.recordings[(r.next-i+len(r.recordings))%len(r.recordings)])
+	}
+	return result
+}
+
+// Get returns the recording with id
+func (r *Recorder) Get(id string) (Recording, bool) {
+	for _, rec := range r.List() {
+		if rec.ID == id {
+			return rec, true
+		}
+	}
+	return Recording{}, false
+}
+
+// captureWriter keeps the first max bytes written to the response
+type captureWriter struct {
+	gin.ResponseWriter
+	max       int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *captureWriter) capture(b []byte) {
+	if room := w.max - w.body.Len(); room < len(b) {
+		w.truncated = true
+		b = b[:room]
+	}
+	w.body.Write(b)
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func recordedHeaders(header http.Header) map[string]string {
+	result := make(map[string]string, len(header))
+	for key, values := range header {
+		if redactedHeaders[key] {
+			result[key] = "[redacted]"
+			continue
+		}
+		result[key] = strings.Join(values, ", ")
+	}
+	return result
+}
+
+// RecorderMiddleware captures the bodies of a DEBUG_RECORDER_SAMPLE_RATE
+// sample of requests, and of every request sent with X-Debug-Record: true.
+// Recordings are added to the request's span as a debug.recording event
+// and kept for /debug/recordings. Sampled requests are only kept when
+// their status is at least DEBUG_RECORDER_MIN_STATUS; requested ones are
+// always kept. It does nothing unless DEBUG_RECORDER_ENABLED=true.
+func RecorderMiddleware() gin.HandlerFunc {
+	recorder = NewRecorderFromEnv()
+	if recorder == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	registerRecorderOnce.Do(func() {
+		prometheus.MustRegister(debugRecordings)
+	})
+	r := recorder
+
+	return func(c *gin.Context) {
+		// Reading recordings shouldn't push the interesting ones out
+		if strings.HasPrefix(c.Request.URL.Path, "/debug/recordings") {
+			c.Next()
+			return
+		}
+
+		reason := ""
+		if v := c.GetHeader(RecordHeader); v == "true" || v == "1" {
+			reason = "requested"
+		} else if r.sampleRate > 0 && rand.Float64() < r.sampleRate {
+			reason = "sampled"
+		}
+		if reason == "" {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		id := newRequestID()
+		if reason == "requested" {
+			c.Header(RecordingIDHeader, id)
+		}
+
+		// Read as much of the body as is recorded and hand the handler the
+		// whole of it
+		var reqBody []byte
+		reqTruncated := false
+		if c.Request.Body != nil {
+			body := c.Request.Body
+			reqBody, _ = io.ReadAll(io.LimitReader(body, int64(r.maxBody)+1))
+			c.Request.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(reqBody), body), body}
+			if len(reqBody) > r.maxBody {
+				reqBody = reqBody[:r.maxBody]
+				reqTruncated = true
+			}
+		}
+
+		w := &captureWriter{ResponseWriter: c.Writer, max: r.maxBody}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		status := c.Writer.Status()
+		if reason == "sampled" && status < r.minStatus {
+			return
+		}
+
+		ctx := c.Request.Context()
+		span := trace.SpanFromContext(ctx)
+		rec := Recording{
+			ID:                    id,
+			Time:                  start.UTC(),
+			Reason:                reason,
+			Method:                c.Request.Method,
+			Path:                  c.Request.URL.RequestURI(),
+			Route:                 c.FullPath(),
+			Status:                status,
+			DurationMs:            float64(time.Since(start).Microseconds()) / 1000,
+			RequestID:             RequestID(ctx),
+			RequestHeaders:        recordedHeaders(c.Request.Header),
+			RequestBody:           string(reqBody),
+			RequestBodyTruncated:  reqTruncated,
+			ResponseHeaders:       recordedHeaders(c.Writer.Header()),
+			ResponseBody:          w.body.String(),
+			ResponseBodyTruncated: w.truncated,
+		}
+		if span.SpanContext().IsValid() {
+			rec.TraceID = span.SpanContext().TraceID().String()
+		}
+		r.add(rec)
+		debugRecordings.WithLabelValues(reason).Inc()
+
+		span.AddEvent("debug.recording", trace.WithAttributes(
+			attribute.String("recording.id", id),
+			attribute.String("recording.reason", reason),
+			attribute.String("http.request.body", rec.RequestBody),
+			attribute.Bool("http.request.body.truncated", reqTruncated),
+			attribute.String("http.response.body", rec.ResponseBody),
+			attribute.Bool("http.response.body.truncated", w.truncated),
+		))
+	}
+}
+
+// RegisterRecordingRoutes mounts GET /debug/recordings and
+// GET /debug/recordings/:id, which require ADMIN_TOKEN as a Bearer token
+// when it is set, since recordings hold request bodies. Register it after
+// RecorderMiddleware. ?status= keeps recordings with at least that status,
+// ?route= one route and ?limit= the newest ones.
+func RegisterRecordingRoutes(router gin.IRouter) {
+	group := router.Group("/debug/recordings", BearerAuth(Get("ADMIN_TOKEN")))
+	group.GET("", func(c *gin.Context) {
+		if recorder == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Debug recorder is disabled; set DEBUG_RECORDER_ENABLED=true"})
+			return
+		}
+
+		minStatus := 0
+		if v := c.Query("status"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "status must be an integer"})
+				return
+			}
+			minStatus = n
+		}
+		limit := 0
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+				return
+			}
+			limit = n
+		}
+		route := c.Query("route")
+
+		recordings := []Recording{}
+		for _, rec := range recorder.List() {
+			if rec.Status < minStatus || (route != "" && rec.Route != route) {
+				continue
+			}
+			recordings = append(recordings, rec)
+			if limit > 0 && len(recordings) == limit {
+				break
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"recordings": recordings})
+	})
+	group.GET("/:id", func(c *gin.Context) {
+		if recorder == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Debug recorder is disabled; set DEBUG_RECORDER_ENABLED=true"})
+			return
+		}
+		rec, ok := recorder.Get(c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recording not found; it may have been overwritten"})
+			return
+		}
+		c.JSON(http.StatusOK, rec)
+	})
+}
@@ -0,0 +1,118 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	panicsRecovered = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "panics_recovered_total",
+			Help: "Number of panics recovered, by where they happened: an HTTP route or a named background task",
+		},
+		[]string{"kind", "name"},
+	)
+	registerPanicsOnce sync.Once
+)
+
+func registerPanicMetrics() {
+	registerPanicsOnce.Do(func() {
+		prometheus.MustRegister(panicsRecovered)
+	})
+}
+
+// reportPanic logs a recovered panic at ERROR with its stack, records it on
+// the current span as an exception and counts it
+func reportPanic(ctx context.Context, logger *StructuredLogger, kind, name string, recovered interface{}) {
+	message := fmt.Sprint(recovered)
+	stack := string(debug.Stack())
+
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(fmt.Errorf("panic: %s", message), trace.WithAttributes(
+		attribute.String("exception.type", "panic"),
+		attribute.String("exception.stacktrace", stack),
+		attribute.String("panic.kind", kind),
+		attribute.String("panic.name", name),
+	))
+	span.SetStatus(codes.Error, "panic: "+message)
+
+	panicsRecovered.WithLabelValues(kind, name).Inc()
+	logger.Error(ctx, "Recovered from panic", map[string]interface{}{
+		"panic": message,
+		"kind":  kind,
+		"name":  name,
+		"stack": stack,
+	})
+}
+
+// RecoveryMiddleware turns a panicking handler into a 500 JSON error, logs
+// the panic with its stack, records it on the request span and counts it
+// in panics_recovered_total by route. Mount it after otelgin,
+// AccessLogMiddleware and the SLO tracker so they all see the 500; it
+// replaces gin.Recovery.
+func RecoveryMiddleware(logger *StructuredLogger) gin.HandlerFunc {
+	registerPanicMetrics()
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// The client went away; there is nobody to answer
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			route := c.FullPath()
+			if route == "" {
+				route = "unmatched"
+			}
+			reportPanic(c.Request.Context(), logger, "http", c.Request.Method+" "+route, recovered)
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}()
+		c.Next()
+	}
+}
+
+// RecoverPanic reports a panic in a background task and stops it from
+// crashing the process. Defer it directly at the top of the goroutine or
+// of each unit of work, so one bad item doesn't stop a worker:
+//
+//	defer platform.RecoverPanic(ctx, logger, "reservation-sweep")
+func RecoverPanic(ctx context.Context, logger *StructuredLogger, name string) {
+	if recovered := recover(); recovered != nil {
+		registerPanicMetrics()
+		reportPanic(ctx, logger, "goroutine", name, recovered)
+	}
+}
+
+// ReportPanic reports a panic recovered outside gin and the background task
+// helpers, such as by a gRPC interceptor; kind names the transport and name
+// the call
+func ReportPanic(ctx context.Context, logger *StructuredLogger, kind, name string, recovered interface{}) {
+	registerPanicMetrics()
+	reportPanic(ctx, logger, kind, name, recovered)
+}
+
+// Go runs fn in a new goroutine that recovers and reports a panic instead
+// of crashing the process
+func Go(ctx context.Context, logger *StructuredLogger, name string, fn func(ctx context.Context)) {
+	go func() {
+		defer RecoverPanic(ctx, logger, name)
+		fn(ctx)
+	}()
+}
@@ -0,0 +1,157 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// RequestIDHeader carries the ID that correlates one request's log lines
+// and errors across services
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds IDs accepted from callers
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying id
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID in ctx, or "" when there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts IDs of letters, digits and "-_.:" so a caller
+// can't inject anything into log lines or headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("-_.:", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDPropagator forwards the request ID on outgoing calls alongside
+// the trace context, so every client that propagates traces carries it too
+type requestIDPropagator struct{}
+
+func (requestIDPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	if id := RequestID(ctx); id != "" {
+		carrier.Set(RequestIDHeader, id)
+	}
+}
+
+func (requestIDPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	if id := carrier.Get(RequestIDHeader); validRequestID(id) {
+		return ContextWithRequestID(ctx, id)
+	}
+	return ctx
+}
+
+func (requestIDPropagator) Fields() []string {
+	return []string{RequestIDHeader}
+}
+
+// requestIDWriter holds back JSON error bodies so the request ID can be
+// added to them once the handler is done
+type requestIDWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *requestIDWriter) holding() bool {
+	return w.ResponseWriter.Status() >= 400 && !w.ResponseWriter.Written() &&
+		strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+}
+
+func (w *requestIDWriter) Write(b []byte) (int, error) {
+	if w.holding() {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *requestIDWriter) WriteString(s string) (int, error) {
+	if w.holding() {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Written counts a held back body as written, so later middleware doesn't
+// try to replace the response
+func (w *requestIDWriter) Written() bool {
+	return w.body.Len() > 0 || w.ResponseWriter.Written()
+}
+
+func (w *requestIDWriter) Size() int {
+	if w.body.Len() > 0 {
+		return w.body.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+// flush writes the held back body with request_id added when it is a JSON
+// object, or unchanged otherwise
+func (w *requestIDWriter) flush(id string) {
+	if w.body.Len() == 0 {
+		return
+	}
+	data := w.body.Bytes()
+	var envelope map[string]interface{}
+	if err := json.Unmarshal(data, &envelope); err == nil {
+		if _, ok := envelope["request_id"]; !ok {
+			envelope["request_id"] = id
+			if encoded, err := json.Marshal(envelope); err == nil {
+				data = encoded
+			}
+		}
+	}
+	w.ResponseWriter.Write(data)
+}
+
+// RequestIDMiddleware gives every request an ID, taken from a valid
+// X-Request-ID header or generated. The ID is returned in the response
+// header, added to JSON error bodies as request_id and kept in the request
+// context, where the logger and outgoing calls pick it up. It goes first so
+// that responses from the other middleware carry the ID too.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Request = c.Request.WithContext(ContextWithRequestID(c.Request.Context(), id))
+		c.Header(RequestIDHeader, id)
+
+		w := &requestIDWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+		w.flush(id)
+	}
+}
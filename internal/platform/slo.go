@@ -0,0 +1,389 @@
+package platform
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sloBucketWidth is the resolution of the SLO windows
+const sloBucketWidth = 10 * time.Second
+
+// SLO kinds
+const (
+	SLOAvailability = "availability"
+	SLOLatency      = "latency"
+)
+
+// SLOTarget is the objective for one route. A request is good for
+// availability unless it returns a 5xx, and good for latency when it also
+// finishes within LatencyThreshold.
+type SLOTarget struct {
+	// Availability is the fraction of requests that must succeed, e.g. 0.999
+	Availability float64
+	// LatencyThreshold of 0 disables the latency objective
+	LatencyThreshold time.Duration
+	LatencyObjective float64
+}
+
+type sloBucket struct {
+	start  int64
+	total  int64
+	errors int64
+	slow   int64
+}
+
+// sloRoute keeps per-bucket counts covering the longest window
+type sloRoute struct {
+	target  SLOTarget
+	buckets []sloBucket
+}
+
+func (r *sloRoute) record(now time.Time, failed, slow bool) {
+	start := now.Truncate(sloBucketWidth).Unix()
+	b := &r.buckets[(start/int64(sloBucketWidth/time.Second))%int64(len(r.buckets))]
+	if b.start != start {
+		*b = sloBucket{start: start}
+	}
+	b.total++
+	if failed {
+		b.errors++
+	}
+	if slow {
+		b.slow++
+	}
+}
+
+// sum adds up the buckets inside the window ending at now
+func (r *sloRoute) sum(now time.Time, window time.Duration) sloBucket {
+	var s sloBucket
+	cutoff := now.Add(-window).Unix()
+	for _, b := range r.buckets {
+		if b.start > cutoff {
+			s.total += b.total
+			s.errors += b.errors
+			s.slow += b.slow
+		}
+	}
+	return s
+}
+
+// SLOTracker measures every route against its SLO target over a few
+// sliding windows. The burn rate of a window is its bad-request ratio over
+// the error budget (1 - objective): 1 spends the budget exactly over the
+// window, and anything above spends it early.
+//
+// Targets come from SLO_TARGETS, e.g.
+//
+//	GET /products=99.9,300ms,99;POST /inventory/reserve=99.5,1s
+//
+// giving a route's availability objective in percent and, optionally, a
+// latency threshold and the percent of requests that must meet it. Routes
+// not listed use SLO_DEFAULT_AVAILABILITY (99.9), SLO_DEFAULT_LATENCY
+// (500ms) and SLO_DEFAULT_LATENCY_OBJECTIVE (99). SLO_WINDOWS sets the
+// windows (default 5m,1h,6h); the error budget is measured over the
+// longest.
+type SLOTracker struct {
+	mu       sync.Mutex
+	service  string
+	windows  []time.Duration
+	defaults SLOTarget
+	targets  map[string]SLOTarget
+	exclude  map[string]bool
+	routes   map[string]*sloRoute
+	requests *prometheus.CounterVec
+}
+
+// NewSLOTrackerFromEnv registers the tracker's metrics. exclude lists
+// routes, as "METHOD /path", that aren't measured, such as event streams
+// that stay open until the client leaves.
+func NewSLOTrackerFromEnv(service string, exclude ...string) *SLOTracker {
+	t := &SLOTracker{
+		service: service,
+		windows: parseSLOWindows(getOr("SLO_WINDOWS", "5m,1h,6h")),
+		defaults: SLOTarget{
+			Availability:     parsePercent(Get("SLO_DEFAULT_AVAILABILITY"), 0.999),
+			LatencyThreshold: parseDuration(Get("SLO_DEFAULT_LATENCY"), 500*time.Millisecond),
+			LatencyObjective: parsePercent(Get("SLO_DEFAULT_LATENCY_OBJECTIVE"), 0.99),
+		},
+		exclude: make(map[string]bool),
+		routes:  make(map[string]*sloRoute),
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "slo_requests_total",
+				Help: "Number of requests measured against SLOs by route and outcome (good, error or slow)",
+			},
+			[]string{"service", "route", "outcome"},
+		),
+	}
+	t.targets = parseSLOTargets(Get("SLO_TARGETS"), t.defaults)
+	for _, route := range exclude {
+		t.exclude[route] = true
+	}
+	prometheus.MustRegister(t.requests, t)
+	return t
+}
+
+func parsePercent(value string, fallback float64) float64 {
+	percent, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || percent <= 0 || percent >= 100 {
+		return fallback
+	}
+	return percent / 100
+}
+
+func parseDuration(value string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil || d < 0 {
+		return fallback
+	}
+	return d
+}
+
+func parseSLOWindows(value string) []time.Duration {
+	var windows []time.Duration
+	for _, part := range strings.Split(value, ",") {
+		if d := parseDuration(part, 0); d >= sloBucketWidth {
+			windows = append(windows, d)
+		}
+	}
+	if len(windows) == 0 {
+		windows = []time.Duration{5 * time.Minute, time.Hour, 6 * time.Hour}
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i] < windows[j] })
+	return windows
+}
+
+// parseSLOTargets reads "ROUTE=availability[,latency[,latency objective]]"
+// entries separated by semicolons. Invalid fields fall back to defaults.
+func parseSLOTargets(value string, defaults SLOTarget) map[string]SLOTarget {
+	targets := make(map[string]SLOTarget)
+	for _, entry := range strings.Split(value, ";") {
+		route, spec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		fields := strings.Split(spec, ",")
+		target := defaults
+		target.Availability = parsePercent(fields[0], defaults.Availability)
+		if len(fields) > 1 {
+			target.LatencyThreshold = parseDuration(fields[1], defaults.LatencyThreshold)
+		}
+		if len(fields) > 2 {
+			target.LatencyObjective = parsePercent(fields[2], defaults.LatencyObjective)
+		}
+		targets[strings.Join(strings.Fields(route), " ")] = target
+	}
+	return targets
+}
+
+// Middleware measures every matched route, except health checks, /metrics,
+// the admin and chaos APIs and the excluded routes
+func (t *SLOTracker) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		path := c.FullPath()
+		if path == "" || path == "/health" || path == "/readyz" || path == "/metrics" || path == "/slo" ||
+			path == "/config/reload" || strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "/chaos") {
+			return
+		}
+		route := c.Request.Method + " " + path
+		if t.exclude[route] {
+			return
+		}
+		t.Record(route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// Record counts one request to route
+func (t *SLOTracker) Record(route string, status int, elapsed time.Duration) {
+	now := time.Now()
+
+	t.mu.Lock()
+	r, ok := t.routes[route]
+	if !ok {
+		target, ok := t.targets[route]
+		if !ok {
+			target = t.defaults
+		}
+		longest := t.windows[len(t.windows)-1]
+		r = &sloRoute{target: target, buckets: make([]sloBucket, longest/sloBucketWidth+1)}
+		t.routes[route] = r
+	}
+	failed := status >= 500
+	slow := !failed && r.target.LatencyThreshold > 0 && elapsed > r.target.LatencyThreshold
+	r.record(now, failed, slow)
+	t.mu.Unlock()
+
+	outcome := "good"
+	switch {
+	case failed:
+		outcome = "error"
+	case slow:
+		outcome = "slow"
+	}
+	t.requests.WithLabelValues(t.service, route, outcome).Inc()
+}
+
+// formatWindow writes whole-unit windows the way they're configured, e.g.
+// "5m" rather than "5m0s"
+func formatWindow(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// SLOWindow is one objective's compliance over one window
+type SLOWindow struct {
+	Window   string  `json:"window"`
+	Requests int64   `json:"requests"`
+	Bad      int64   `json:"bad"`
+	Ratio    float64 `json:"good_ratio"`
+	BurnRate float64 `json:"burn_rate"`
+}
+
+// SLOStatus is one route objective's compliance across the windows
+type SLOStatus struct {
+	Objective float64     `json:"objective"`
+	Threshold string      `json:"threshold,omitempty"`
+	Windows   []SLOWindow `json:"windows"`
+	// BudgetRemaining is the fraction of the longest window's error
+	// budget left; it goes negative once the budget is overspent
+	BudgetRemaining float64 `json:"budget_remaining"`
+	Exhausted       bool    `json:"exhausted"`
+}
+
+// SLORouteStatus is a route's compliance with its objectives
+type SLORouteStatus struct {
+	Route        string     `json:"route"`
+	Availability SLOStatus  `json:"availability"`
+	Latency      *SLOStatus `json:"latency,omitempty"`
+}
+
+func sloStatus(r *sloRoute, now time.Time, windows []time.Duration, objective float64, bad func(sloBucket) int64) SLOStatus {
+	status := SLOStatus{Objective: objective, BudgetRemaining: 1}
+	budget := 1 - objective
+	for _, window := range windows {
+		s := r.sum(now, window)
+		w := SLOWindow{Window: formatWindow(window), Requests: s.total, Bad: bad(s), Ratio: 1}
+		if s.total > 0 {
+			badRatio := float64(w.Bad) / float64(s.total)
+			w.Ratio = 1 - badRatio
+			w.BurnRate = badRatio / budget
+		}
+		status.Windows = append(status.Windows, w)
+	}
+	longest := status.Windows[len(status.Windows)-1]
+	status.BudgetRemaining = 1 - longest.BurnRate
+	status.Exhausted = status.BudgetRemaining <= 0
+	return status
+}
+
+// Status returns every measured route's compliance, sorted by route
+func (t *SLOTracker) Status() []SLORouteStatus {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	statuses := make([]SLORouteStatus, 0, len(t.routes))
+	for route, r := range t.routes {
+		status := SLORouteStatus{
+			Route:        route,
+			Availability: sloStatus(r, now, t.windows, r.target.Availability, func(b sloBucket) int64 { return b.errors }),
+		}
+		if r.target.LatencyThreshold > 0 {
+			latency := sloStatus(r, now, t.windows, r.target.LatencyObjective, func(b sloBucket) int64 { return b.errors + b.slow })
+			latency.Threshold = r.target.LatencyThreshold.String()
+			status.Latency = &latency
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Route < statuses[j].Route })
+	return statuses
+}
+
+var (
+	sloBurnRateDesc = prometheus.NewDesc(
+		"slo_burn_rate",
+		"Rate the route is spending its error budget over the window; 1 spends it exactly over the window",
+		[]string{"service", "route", "slo", "window"}, nil,
+	)
+	sloBudgetDesc = prometheus.NewDesc(
+		"slo_error_budget_remaining",
+		"Fraction of the error budget left over the longest SLO window; 0 or less means it is exhausted",
+		[]string{"service", "route", "slo"}, nil,
+	)
+	sloObjectiveDesc = prometheus.NewDesc(
+		"slo_objective",
+		"The route's SLO objective as a fraction of good requests",
+		[]string{"service", "route", "slo"}, nil,
+	)
+)
+
+// Describe implements prometheus.Collector
+func (t *SLOTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sloBurnRateDesc
+	ch <- sloBudgetDesc
+	ch <- sloObjectiveDesc
+}
+
+// Collect implements prometheus.Collector, computing the burn rates at
+// scrape time
+func (t *SLOTracker) Collect(ch chan<- prometheus.Metric) {
+	for _, route := range t.Status() {
+		objectives := map[string]*SLOStatus{SLOAvailability: &route.Availability}
+		if route.Latency != nil {
+			objectives[SLOLatency] = route.Latency
+		}
+		for slo, status := range objectives {
+			for _, w := range status.Windows {
+				ch <- prometheus.MustNewConstMetric(sloBurnRateDesc, prometheus.GaugeValue, w.BurnRate, t.service, route.Route, slo, w.Window)
+			}
+			ch <- prometheus.MustNewConstMetric(sloBudgetDesc, prometheus.GaugeValue, status.BudgetRemaining, t.service, route.Route, slo)
+			ch <- prometheus.MustNewConstMetric(sloObjectiveDesc, prometheus.GaugeValue, status.Objective, t.service, route.Route, slo)
+		}
+	}
+}
+
+// RegisterSLORoutes mounts GET /slo, summarizing every route's compliance.
+// compliant is false once any route has exhausted an error budget.
+func RegisterSLORoutes(router gin.IRouter, t *SLOTracker) {
+	router.GET("/slo", func(c *gin.Context) {
+		routes := t.Status()
+		exhausted := []string{}
+		for _, route := range routes {
+			if route.Availability.Exhausted {
+				exhausted = append(exhausted, fmt.Sprintf("%s %s", route.Route, SLOAvailability))
+			}
+			if route.Latency != nil && route.Latency.Exhausted {
+				exhausted = append(exhausted, fmt.Sprintf("%s %s", route.Route, SLOLatency))
+			}
+		}
+
+		windows := make([]string, len(t.windows))
+		for i, w := range t.windows {
+			windows[i] = formatWindow(w)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"service":   t.service,
+			"windows":   windows,
+			"compliant": len(exhausted) == 0,
+			"exhausted": exhausted,
+			"routes":    routes,
+		})
+	})
+}
@@ -0,0 +1,317 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DependencyCheck is a dependency probed at startup. Build one with
+// TCPDependency, HTTPDependency or Telemetry.CollectorDependency.
+type DependencyCheck struct {
+	Name   string
+	Target string
+	probe  func(ctx context.Context, client *http.Client) error
+}
+
+// TCPDependency is reachable once a connection to addr (host:port) opens,
+// which also needs its host to resolve
+func TCPDependency(name, addr string) DependencyCheck {
+	return DependencyCheck{
+		Name:   name,
+		Target: addr,
+		probe: func(ctx context.Context, _ *http.Client) error {
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+	}
+}
+
+// HTTPDependency is reachable once GET <baseURL>/health answers below 500.
+// It probes liveness rather than /readyz, so services that depend on each
+// other can't hold each other unready.
+func HTTPDependency(name, baseURL string) DependencyCheck {
+	return DependencyCheck{
+		Name:   name,
+		Target: baseURL,
+		probe: func(ctx context.Context, client *http.Client) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(baseURL, "/")+"/health", nil)
+			if err != nil {
+				return err
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= http.StatusInternalServerError {
+				return fmt.Errorf("health check returned status %d", resp.StatusCode)
+			}
+			return nil
+		},
+	}
+}
+
+// CollectorDependency is the OTLP collector traces and metrics are
+// exported to
+func (t Telemetry) CollectorDependency() DependencyCheck {
+	host, _ := t.endpoint()
+	return TCPDependency("otel-collector", host)
+}
+
+// DependencyStatus is one dependency's line in the startup report
+type DependencyStatus struct {
+	Name     string `json:"name"`
+	Target   string `json:"target"`
+	Critical bool   `json:"critical"`
+	Ready    bool   `json:"ready"`
+	Attempts int    `json:"attempts"`
+	// ReadyAfterMs is how long after startup the dependency was reached
+	ReadyAfterMs float64 `json:"ready_after_ms,omitempty"`
+	LastError    string  `json:"last_error,omitempty"`
+}
+
+// StartupChecker probes a service's dependencies when it starts, retrying
+// each with exponential backoff, and holds /readyz at 503 until the
+// critical ones are reachable. This keeps traffic away while the collector
+// or downstream services are still coming up, instead of answering it
+// with a burst of errors. Once every dependency is reached, or
+// STARTUP_TIMEOUT passes, a dependency report is logged.
+//
+// Settings: STARTUP_CHECKS (default true; false skips probing),
+// STARTUP_GATE_READINESS (default true; false only reports),
+// STARTUP_OPTIONAL (comma-separated dependency names that are reported but
+// don't gate readiness), STARTUP_TIMEOUT (default 60s, after which the
+// service reports ready regardless; 0 waits indefinitely),
+// STARTUP_PROBE_TIMEOUT (per attempt, default 2s) and
+// STARTUP_BACKOFF_INITIAL / STARTUP_BACKOFF_MAX (default 250ms and 5s).
+type StartupChecker struct {
+	mu       sync.Mutex
+	service  string
+	logger   *StructuredLogger
+	checks   []DependencyCheck
+	statuses []DependencyStatus
+	started  time.Time
+	finished bool
+
+	enabled        bool
+	gate           bool
+	timeout        time.Duration
+	probeTimeout   time.Duration
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	ready *prometheus.GaugeVec
+}
+
+// NewStartupCheckerFromEnv registers the checker's metric. Checks with an
+// empty Target, such as an optional service that isn't configured, are
+// skipped.
+func NewStartupCheckerFromEnv(service string, logger *StructuredLogger, checks ...DependencyCheck) *StartupChecker {
+	optional := make(map[string]bool)
+	for _, name := range strings.Split(Get("STARTUP_OPTIONAL"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			optional[name] = true
+		}
+	}
+	s := &StartupChecker{
+		service:        service,
+		logger:         logger,
+		enabled:        Get("STARTUP_CHECKS") != "false",
+		gate:           Get("STARTUP_GATE_READINESS") != "false",
+		timeout:        parseDuration(Get("STARTUP_TIMEOUT"), 60*time.Second),
+		probeTimeout:   parseDuration(Get("STARTUP_PROBE_TIMEOUT"), 2*time.Second),
+		initialBackoff: parseDuration(Get("STARTUP_BACKOFF_INITIAL"), 250*time.Millisecond),
+		maxBackoff:     parseDuration(Get("STARTUP_BACKOFF_MAX"), 5*time.Second),
+		ready: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "startup_dependency_ready",
+				Help: "1 once a dependency probed at startup has been reached",
+			},
+			[]string{"service", "dependency"},
+		),
+	}
+	if s.probeTimeout == 0 {
+		s.probeTimeout = 2 * time.Second
+	}
+	if s.initialBackoff == 0 {
+		s.initialBackoff = 250 * time.Millisecond
+	}
+	if s.maxBackoff < s.initialBackoff {
+		s.maxBackoff = s.initialBackoff
+	}
+	for _, check := range checks {
+		if check.Target == "" {
+			continue
+		}
+		s.checks = append(s.checks, check)
+		s.statuses = append(s.statuses, DependencyStatus{
+			Name:     check.Name,
+			Target:   check.Target,
+			Critical: !optional[check.Name],
+		})
+		s.ready.WithLabelValues(service, check.Name).Set(0)
+	}
+	prometheus.MustRegister(s.ready)
+	return s
+}
+
+// Start probes every dependency in the background until each is reached,
+// STARTUP_TIMEOUT passes or ctx is done
+func (s *StartupChecker) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.started = time.Now()
+	if !s.enabled || len(s.checks) == 0 {
+		s.finished = true
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	cancel := func() {}
+	if s.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+	}
+
+	client := &http.Client{Transport: ServiceTransport(s.logger)}
+	var wg sync.WaitGroup
+	for i := range s.checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer RecoverPanic(ctx, s.logger, "startup-check-"+s.checks[i].Name)
+			s.probe(ctx, i, client)
+		}(i)
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+		s.finish()
+	}()
+}
+
+// probe retries one dependency, doubling the wait between attempts up to
+// maxBackoff, with jitter so replicas starting together spread out
+func (s *StartupChecker) probe(ctx context.Context, i int, client *http.Client) {
+	check := s.checks[i]
+	backoff := s.initialBackoff
+	for attempt := 1; ; attempt++ {
+		probeCtx, cancel := context.WithTimeout(ctx, s.probeTimeout)
+		err := check.probe(probeCtx, client)
+		cancel()
+		s.record(i, attempt, err)
+		if err == nil {
+			return
+		}
+
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		if attempt == 1 {
+			s.logger.Warn(ctx, "Dependency not reachable yet, retrying", map[string]interface{}{
+				"dependency": check.Name,
+				"target":     check.Target,
+				"error":      err.Error(),
+			})
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+func (s *StartupChecker) record(i, attempt int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := &s.statuses[i]
+	status.Attempts = attempt
+	if err != nil {
+		status.LastError = err.Error()
+		return
+	}
+	status.Ready = true
+	status.LastError = ""
+	status.ReadyAfterMs = float64(time.Since(s.started).Microseconds()) / 1000
+	s.ready.WithLabelValues(s.service, status.Name).Set(1)
+}
+
+// finish logs the dependency report: at Info when everything was reached,
+// at Error listing what wasn't otherwise
+func (s *StartupChecker) finish() {
+	s.mu.Lock()
+	s.finished = true
+	report := append([]DependencyStatus(nil), s.statuses...)
+	elapsed := time.Since(s.started)
+	s.mu.Unlock()
+
+	var unreachable []string
+	for _, status := range report {
+		if !status.Ready {
+			unreachable = append(unreachable, status.Name)
+		}
+	}
+	fields := map[string]interface{}{
+		"dependencies": report,
+		"elapsed_ms":   float64(elapsed.Microseconds()) / 1000,
+	}
+	ctx := context.Background()
+	if len(unreachable) == 0 {
+		s.logger.Info(ctx, "Startup dependency report: all dependencies reachable", fields)
+		return
+	}
+	fields["unreachable"] = unreachable
+	s.logger.Error(ctx, "Startup dependency report: dependencies unreachable, serving anyway", fields)
+}
+
+// Ready reports whether the service should take traffic: once every
+// critical dependency has been reached, or when the checks have finished
+// or are disabled
+func (s *StartupChecker) Ready() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.gate || s.finished {
+		return true
+	}
+	for _, status := range s.statuses {
+		if status.Critical && !status.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// Report returns each dependency's status, in the order they were given
+func (s *StartupChecker) Report() []DependencyStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]DependencyStatus(nil), s.statuses...)
+}
+
+// RegisterStartupRoutes serves GET /readyz: 200 once s is ready and 503
+// before, with the dependency report either way
+func RegisterStartupRoutes(router gin.IRouter, s *StartupChecker) {
+	router.GET("/readyz", func(c *gin.Context) {
+		if !s.Ready() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "STARTING", "dependencies": s.Report()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "READY", "dependencies": s.Report()})
+	})
+}
@@ -0,0 +1,152 @@
+package platform
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Telemetry describes how a service exports traces and metrics
+type Telemetry struct {
+	ServiceName    string
+	ServiceVersion string
+
+	// GRPC exports over OTLP/gRPC (collector port 4317) instead of
+	// OTLP/HTTP (port 4318)
+	GRPC bool
+}
+
+// Tracer returns the service's tracer from the global TracerProvider
+func (t Telemetry) Tracer() trace.Tracer {
+	return otel.Tracer(t.ServiceName)
+}
+
+// resource describes the service: its name, version and the
+// DEPLOYMENT_ENVIRONMENT it runs in (default production)
+func (t Telemetry) resource(ctx context.Context) (*resource.Resource, error) {
+	attrs := []attribute.KeyValue{
+		attribute.String("service.name", t.ServiceName),
+		attribute.String("deployment.environment", GetEnv("DEPLOYMENT_ENVIRONMENT", "production")),
+	}
+	if t.ServiceVersion != "" {
+		attrs = append(attrs, attribute.String("service.version", t.ServiceVersion))
+	}
+	return resource.New(ctx, resource.WithAttributes(attrs...))
+}
+
+// endpoint is the collector address from OTEL_EXPORTER_OTLP_ENDPOINT,
+// either host:port or a URL, defaulting to otel-collector on the
+// protocol's standard port. Only https URLs are exported over TLS.
+func (t Telemetry) endpoint() (host string, insecure bool) {
+	defaultEndpoint := "otel-collector:4318"
+	if t.GRPC {
+		defaultEndpoint = "otel-collector:4317"
+	}
+	endpoint := getOr("OTEL_EXPORTER_OTLP_ENDPOINT", defaultEndpoint)
+	if !strings.Contains(endpoint, "://") {
+		return endpoint, true
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return defaultEndpoint, true
+	}
+	return u.Host, u.Scheme != "https"
+}
+
+// InitTracer sets the global TracerProvider to batch spans to the collector
+// and propagates W3C trace context, baggage and X-Request-ID on outgoing
+// calls. Incoming baggage is recorded on every span as attributes.
+func InitTracer(ctx context.Context, t Telemetry) (*sdktrace.TracerProvider, error) {
+	host, insecure := t.endpoint()
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	if t.GRPC {
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(host)}
+		if insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	} else {
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(host)}
+		if insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := t.resource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(baggageSpanProcessor{}),
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+		requestIDPropagator{},
+	))
+	return tp, nil
+}
+
+// InitMeter sets the global MeterProvider to push metrics to the same
+// collector as the traces every OTEL_METRIC_EXPORT_INTERVAL (default 60s).
+// It returns nil when OTEL_METRICS_ENABLED=false; instruments are then
+// no-ops.
+func InitMeter(ctx context.Context, t Telemetry) (*sdkmetric.MeterProvider, error) {
+	if Get("OTEL_METRICS_ENABLED") == "false" {
+		return nil, nil
+	}
+	host, insecure := t.endpoint()
+
+	var exporter sdkmetric.Exporter
+	var err error
+	if t.GRPC {
+		opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(host)}
+		if insecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		}
+		exporter, err = otlpmetricgrpc.New(ctx, opts...)
+	} else {
+		opts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(host)}
+		if insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		exporter, err = otlpmetrichttp.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := t.resource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetMeterProvider(mp)
+	return mp, nil
+}
@@ -0,0 +1,267 @@
+package platform
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// certCheckInterval is how often certificate files are checked for changes,
+// so rotated certificates are picked up without a restart
+const certCheckInterval = 10 * time.Second
+
+// certFiles serves a certificate and key from disk, reloading them when
+// either file changes. A pair that fails to load keeps the previous one.
+type certFiles struct {
+	certFile, keyFile string
+	logger            *StructuredLogger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func newCertFiles(certFile, keyFile string, logger *StructuredLogger) (*certFiles, error) {
+	c := &certFiles{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *certFiles) load() error {
+	modTime := latestModTime(c.certFile, c.keyFile)
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+func (c *certFiles) get() (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.checked) >= certCheckInterval {
+		c.checked = time.Now()
+		if latestModTime(c.certFile, c.keyFile).After(c.modTime) {
+			if err := c.load(); err != nil {
+				c.logger.Error(context.Background(), "Failed to reload certificate", map[string]interface{}{
+					"cert_file": c.certFile,
+					"error":     err.Error(),
+				})
+			} else {
+				c.logger.Info(context.Background(), "Reloaded certificate", map[string]interface{}{"cert_file": c.certFile})
+			}
+		}
+	}
+	return c.cert, nil
+}
+
+// caFile is a CA bundle on disk, reloaded like certFiles
+type caFile struct {
+	path   string
+	logger *StructuredLogger
+
+	mu      sync.Mutex
+	pool    *x509.CertPool
+	modTime time.Time
+	checked time.Time
+}
+
+func newCAFile(path string, logger *StructuredLogger) (*caFile, error) {
+	c := &caFile{path: path, logger: logger}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *caFile) load() error {
+	modTime := latestModTime(c.path)
+	pem, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("%s: no certificates found", c.path)
+	}
+	c.pool = pool
+	c.modTime = modTime
+	return nil
+}
+
+func (c *caFile) get() *x509.CertPool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.checked) >= certCheckInterval {
+		c.checked = time.Now()
+		if latestModTime(c.path).After(c.modTime) {
+			if err := c.load(); err != nil {
+				c.logger.Error(context.Background(), "Failed to reload CA bundle", map[string]interface{}{
+					"ca_file": c.path,
+					"error":   err.Error(),
+				})
+			}
+		}
+	}
+	return c.pool
+}
+
+func latestModTime(paths ...string) time.Time {
+	var latest time.Time
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// ServerTLSConfig serves TLS_CERT_FILE/TLS_KEY_FILE when they are set
+// and returns nil otherwise. With TLS_CLIENT_CA_FILE, clients must present a
+// certificate signed by that CA; TLS_CLIENT_AUTH=optional only verifies the
+// certificates clients choose to send, e.g. so health probes still work.
+// Certificate reloads are logged to logger.
+func ServerTLSConfig(logger *StructuredLogger) (*tls.Config, error) {
+	certFile := Get("TLS_CERT_FILE")
+	if certFile == "" {
+		return nil, nil
+	}
+	cert, err := newCertFiles(certFile, Get("TLS_KEY_FILE"), logger)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return cert.get()
+		},
+	}
+
+	caPath := Get("TLS_CLIENT_CA_FILE")
+	if caPath == "" {
+		return cfg, nil
+	}
+	clientCAs, err := newCAFile(caPath, logger)
+	if err != nil {
+		return nil, fmt.Errorf("loading client CA: %w", err)
+	}
+
+	clientAuth := tls.RequireAndVerifyClientCert
+	switch Get("TLS_CLIENT_AUTH") {
+	case "", "require":
+	case "optional":
+		clientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, errors.New("TLS_CLIENT_AUTH must be require or optional")
+	}
+
+	// The client CA pool is looked up per handshake so it can be rotated
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		perConn := cfg.Clone()
+		perConn.GetConfigForClient = nil
+		perConn.ClientCAs = clientCAs.get()
+		perConn.ClientAuth = clientAuth
+		return perConn, nil
+	}
+	return cfg, nil
+}
+
+// ClientTLSConfig configures TLS for calls to other services. Servers
+// are verified against TLS_CA_FILE when set, and TLS_CLIENT_CERT_FILE and
+// TLS_CLIENT_KEY_FILE (falling back to the server pair) are presented to
+// servers that ask for a client certificate. It returns nil when none of
+// these are set.
+func ClientTLSConfig(logger *StructuredLogger) (*tls.Config, error) {
+	caPath := Get("TLS_CA_FILE")
+	certFile := getOr("TLS_CLIENT_CERT_FILE", Get("TLS_CERT_FILE"))
+	keyFile := getOr("TLS_CLIENT_KEY_FILE", Get("TLS_KEY_FILE"))
+	if caPath == "" && certFile == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" {
+		cert, err := newCertFiles(certFile, keyFile, logger)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert.get()
+		}
+	}
+
+	if caPath != "" {
+		roots, err := newCAFile(caPath, logger)
+		if err != nil {
+			return nil, fmt.Errorf("loading CA: %w", err)
+		}
+		// RootCAs can't change after the transport is built, so the chain is
+		// verified here against the current pool instead
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("server presented no certificate")
+			}
+			opts := x509.VerifyOptions{
+				Roots:         roots.get(),
+				DNSName:       cs.ServerName,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		}
+	}
+	return cfg, nil
+}
+
+var (
+	serviceTransportOnce sync.Once
+	serviceTransport     http.RoundTripper
+)
+
+// ServiceTransport is the transport for calls to other services, using the
+// client TLS settings when they are configured. Every client built on it
+// shares one connection pool, tuned by PoolSettingsFromEnv, and its calls
+// are recorded for /debug/dependencies. Invalid TLS settings are fatal.
+func ServiceTransport(logger *StructuredLogger) http.RoundTripper {
+	serviceTransportOnce.Do(func() {
+		cfg, err := ClientTLSConfig(logger)
+		if err != nil {
+			log.Fatalf("Invalid TLS configuration: %v", err)
+		}
+		prometheus.MustRegister(clientOpenConnections, clientDials, clientConnsAcquired, clientConnWait)
+		serviceTransport = &dependencyTransport{base: newPooledTransport(PoolSettingsFromEnv(), cfg)}
+	})
+	return serviceTransport
+}
+
+// NewHTTPClient returns a client for calls to other services that carries
+// the caller's trace context over ServiceTransport
+func NewHTTPClient(logger *StructuredLogger, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: otelhttp.NewTransport(ServiceTransport(logger)),
+	}
+}
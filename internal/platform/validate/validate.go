@@ -0,0 +1,121 @@
+// Package validate checks request payloads field by field and reports every
+// failure at once, in the 422 envelope the services share:
+//
+//	{"error": "Product failed validation", "fields": [{"field": "price", "message": "must not be negative"}]}
+package validate
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultCurrencies are the ISO 4217 codes currency-service converts between
+var DefaultCurrencies = []string{"USD", "EUR", "GBP", "JPY", "CAD", "AUD", "CNY"}
+
+// FieldError describes why one field failed validation. Nested and list
+// fields are named like "images[2].url".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors is every field that failed validation
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, f := range e {
+		parts[i] = f.Field + " " + f.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Validator collects field errors. The zero value is ready to use.
+type Validator struct {
+	errs Errors
+}
+
+// Fail records that field is invalid
+func (v *Validator) Fail(field, message string) {
+	v.errs = append(v.errs, FieldError{Field: field, Message: message})
+}
+
+// Check records message against field unless ok
+func (v *Validator) Check(ok bool, field, message string) {
+	if !ok {
+		v.Fail(field, message)
+	}
+}
+
+// Required checks that value is not blank
+func (v *Validator) Required(field, value string) {
+	v.Check(strings.TrimSpace(value) != "", field, "is required")
+}
+
+// NonNegative checks that value is zero or more
+func (v *Validator) NonNegative(field string, value float64) {
+	v.Check(value >= 0, field, "must not be negative")
+}
+
+// MaxLength checks that value has at most max characters
+func (v *Validator) MaxLength(field, value string, max int) {
+	v.Check(len([]rune(value)) <= max, field, fmt.Sprintf("must be at most %d characters", max))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// OneOf checks that value is one of allowed
+func (v *Validator) OneOf(field, value string, allowed []string) {
+	v.Check(contains(allowed, value), field, "must be one of "+strings.Join(allowed, ", "))
+}
+
+// Currency checks that value is one of the supported ISO 4217 codes
+func (v *Validator) Currency(field, value string, supported []string) {
+	v.Check(contains(supported, value), field, "must be a supported currency code: "+strings.Join(supported, ", "))
+}
+
+// URL checks that value is an absolute http or https URL with a host. An
+// empty value is left to Required.
+func (v *Validator) URL(field, value string) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.Fail(field, "must be an absolute http or https URL")
+	}
+}
+
+// Errors returns the failures recorded, or nil if there were none
+func (v *Validator) Errors() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// Respond writes the 422 envelope for err if it is an Errors, and reports
+// whether it did. message names what failed, e.g. "Product failed
+// validation".
+func Respond(c *gin.Context, message string, err error) bool {
+	errs, ok := err.(Errors)
+	if !ok {
+		return false
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":  message,
+		"fields": errs,
+	})
+	return true
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxCheckItems bounds POST /inventory/check
+const maxCheckItems = 100
+
+var availabilityChecks = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "inventory_service_availability_checks_total",
+		Help: "Number of POST /inventory/check requests by whether every item was available",
+	},
+	[]string{"result"},
+)
+
+// CheckItem is one line of a POST /inventory/check request
+type CheckItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// CheckResult reports whether one product can cover the requested quantity
+type CheckResult struct {
+	ProductID string `json:"product_id"`
+	Requested int    `json:"requested"`
+	Available int    `json:"available"`
+	Found     bool   `json:"found"`
+	// Sufficient is whether the product could be reserved right now
+	Sufficient bool `json:"sufficient"`
+}
+
+// checkAvailability answers "can I buy this cart?" without reserving
+// anything, so it leaves the reservation ledger, versions and reservation
+// metrics alone. Lines for the same product are combined, since a
+// reservation for each would draw on the same stock.
+func checkAvailability(c *gin.Context) {
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
+
+	var req struct {
+		Items []CheckItem `json:"items"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request must set items"})
+		return
+	}
+	if len(req.Items) > maxCheckItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At most " + strconv.Itoa(maxCheckItems) + " items per request"})
+		return
+	}
+
+	results := make([]CheckResult, 0, len(req.Items))
+	index := make(map[string]int, len(req.Items))
+	for _, item := range req.Items {
+		if item.ProductID == "" || item.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Each item needs a product_id and a positive quantity"})
+			return
+		}
+		if i, ok := index[item.ProductID]; ok {
+			results[i].Requested += item.Quantity
+			continue
+		}
+		index[item.ProductID] = len(results)
+		results = append(results, CheckResult{ProductID: item.ProductID, Requested: item.Quantity})
+	}
+
+	allAvailable := true
+	store.mu.RLock()
+	for i := range results {
+		quantity, exists := store.inventory[results[i].ProductID]
+		if exists {
+			results[i].Found = true
+			results[i].Available = quantity - store.reserved[results[i].ProductID]
+			results[i].Sufficient = results[i].Available >= results[i].Requested
+		}
+		allAvailable = allAvailable && results[i].Sufficient
+	}
+	store.mu.RUnlock()
+
+	result := "available"
+	if !allAvailable {
+		result = "unavailable"
+	}
+	availabilityChecks.WithLabelValues(result).Inc()
+	span.SetAttributes(
+		attribute.Int("check.items", len(results)),
+		attribute.Bool("check.available", allAvailable),
+	)
+	logger.Info(ctx, "Checked availability", map[string]interface{}{
+		"items":     len(results),
+		"available": allAvailable,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"available": allAvailable,
+		"items":     results,
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+
+	eventbus "platform/events"
+)
+
+// EventReservationCreated is published to the broker for every successful
+// reservation
+const EventReservationCreated = "reservation.created"
+
+// domainEvents is nil unless EVENTS_BROKER is set
+var domainEvents *eventbus.Emitter
+
+// ReservationCreated is the payload of reservation.created
+type ReservationCreated struct {
+	ReservationID string `json:"reservation_id"`
+	ProductID     string `json:"product_id"`
+	Quantity      int    `json:"quantity"`
+	Reserved      int    `json:"reserved"`
+	Total         int    `json:"total"`
+	Version       int64  `json:"version"`
+}
+
+// publishReservationCreated adds the event to the outbox, keyed by product
+// so each product's reservations are consumed in order
+func publishReservationCreated(ctx context.Context, r ReservationCreated) {
+	if domainEvents == nil {
+		return
+	}
+	if err := domainEvents.Emit(ctx, EventReservationCreated, r.ProductID, r); err != nil {
+		logger.Error(ctx, "Failed to record reservation event", map[string]interface{}{
+			"reservation_id": r.ReservationID,
+			"product_id":     r.ProductID,
+			"error":          err.Error(),
+		})
+	}
+}
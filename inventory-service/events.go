@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Event types published on the inventory event stream
+const (
+	EventReserve   = "reserve"
+	EventRelease   = "release"
+	EventAdjust    = "adjust"
+	EventReconcile = "reconcile"
+	// EventLowStock is published alongside the operation that took a
+	// product's available stock to LOW_STOCK_THRESHOLD; Quantity carries
+	// the available stock
+	EventLowStock = "low_stock"
+)
+
+// InventoryEvent describes a single change to a product's stock
+type InventoryEvent struct {
+	Type      string    `json:"type"`
+	ProductID string    `json:"product_id"`
+	Quantity  int       `json:"quantity"`
+	Total     int       `json:"total"`
+	Reserved  int       `json:"reserved"`
+	Version   int64     `json:"version"`
+	Actor     string    `json:"actor,omitempty"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// EventBroker fans out inventory events to stream subscribers
+type EventBroker struct {
+	mu          sync.RWMutex
+	subscribers map[chan InventoryEvent]struct{}
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+var events = NewEventBroker()
+
+func NewEventBroker() *EventBroker {
+	return &EventBroker{
+		subscribers: make(map[chan InventoryEvent]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Close signals all open streams to finish, e.g. during shutdown
+func (b *EventBroker) Close() {
+	b.closeOnce.Do(func() { close(b.done) })
+}
+
+// Done is closed once the broker has been closed
+func (b *EventBroker) Done() <-chan struct{} {
+	return b.done
+}
+
+func (b *EventBroker) Subscribe() chan InventoryEvent {
+	ch := make(chan InventoryEvent, 64)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *EventBroker) Unsubscribe(ch chan InventoryEvent) {
+	b.mu.Lock()
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+	close(ch)
+}
+
+// Publish never blocks; slow subscribers miss events rather than
+// stalling the request path.
+func (b *EventBroker) Publish(event InventoryEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// recordEvent stamps the event with the calling client as actor and records it
+func recordEvent(c *gin.Context, event InventoryEvent) {
+	emitEvent(c.Request.Context(), requestActor(c), event)
+}
+
+// requestActor identifies the caller by X-Actor, falling back to its IP
+func requestActor(c *gin.Context) string {
+	if actor := c.GetHeader("X-Actor"); actor != "" {
+		return actor
+	}
+	return c.ClientIP()
+}
+
+// emitEvent stamps the event with the current trace and time, appends it to
+// the ledger and publishes it to stream subscribers, followed by a low_stock
+// event if it left the product low on stock
+func emitEvent(ctx context.Context, actor string, event InventoryEvent) {
+	if sc := trace.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		event.TraceID = sc.TraceID().String()
+	}
+	event.Actor = actor
+	event.Timestamp = time.Now().UTC()
+	ledger.Append(event)
+	events.Publish(event)
+	checkLowStock(ctx, event)
+}
+
+func streamInventoryEvents(c *gin.Context) {
+	ctx := c.Request.Context()
+	productID := c.Query("product_id")
+
+	logger.Info(ctx, "Inventory event stream opened", map[string]interface{}{
+		"product_id": productID,
+		"client_ip":  c.ClientIP(),
+	})
+
+	ch := events.Subscribe()
+	defer events.Unsubscribe(ch)
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-events.Done():
+			return false
+		case <-heartbeat.C:
+			c.SSEvent("heartbeat", gin.H{"timestamp": time.Now().UTC()})
+			return true
+		case event := <-ch:
+			if productID != "" && event.ProductID != productID {
+				return true
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		}
+	})
+
+	logger.Info(ctx, "Inventory event stream closed", map[string]interface{}{
+		"product_id": productID,
+	})
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"inventory-service/inventorypb"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"platform"
+)
+
+// inventoryServiceServer implements the gRPC InventoryService on top of the
+// same reservation engine and event stream as the HTTP API
+type inventoryServiceServer struct {
+	inventorypb.UnimplementedInventoryServiceServer
+}
+
+func (inventoryServiceServer) GetInventory(ctx context.Context, in *inventorypb.GetInventoryRequest) (*inventorypb.Stock, error) {
+	logger.Info(ctx, "Handling gRPC get inventory request", map[string]interface{}{"product_id": in.GetProductId()})
+
+	item, version, ok := lookupStock(in.GetProductId())
+	if !ok {
+		return nil, status.Error(codes.NotFound, "product not found")
+	}
+	return &inventorypb.Stock{
+		ProductId: item.ProductID,
+		Quantity:  int32(item.Quantity),
+		Reserved:  int32(item.Reserved),
+		Available: int32(item.Available),
+		Version:   version,
+	}, nil
+}
+
+func (inventoryServiceServer) Reserve(ctx context.Context, in *inventorypb.ReserveRequest) (*inventorypb.ReserveResponse, error) {
+	if err := acquireReservationSlot(ctx); err != nil {
+		return nil, err
+	}
+	defer reservationLimiter.Release()
+
+	req := reserveRequest{
+		ProductID:   in.GetProductId(),
+		Quantity:    int(in.GetQuantity()),
+		CallbackURL: in.GetCallbackUrl(),
+		TTLSeconds:  int(in.GetTtlSeconds()),
+	}
+	if in.ExpectedVersion != nil {
+		expected := in.GetExpectedVersion()
+		req.ExpectedVersion = &expected
+	}
+
+	result, err := reserveStock(ctx, grpcActor(ctx), req)
+	switch {
+	case errors.Is(err, errInvalidReservation):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, errProductNotFound):
+		return nil, status.Error(codes.NotFound, "product not found")
+	case errors.Is(err, errInsufficientInventory):
+		return nil, status.Error(codes.FailedPrecondition, "insufficient inventory")
+	case errors.Is(err, errVersionMismatch):
+		return nil, status.Errorf(codes.Aborted, "version mismatch, current version is %d", result.Version)
+	}
+
+	resp := &inventorypb.ReserveResponse{
+		ProductId:     req.ProductID,
+		Reserved:      in.GetQuantity(),
+		Version:       result.Version,
+		ReservationId: result.ReservationID,
+	}
+	if result.ExpiresAt != nil {
+		resp.ExpiresAt = result.ExpiresAt.Format(time.RFC3339)
+	}
+	return resp, nil
+}
+
+func (inventoryServiceServer) Release(ctx context.Context, in *inventorypb.ReleaseRequest) (*inventorypb.ReleaseResponse, error) {
+	if err := acquireReservationSlot(ctx); err != nil {
+		return nil, err
+	}
+	defer reservationLimiter.Release()
+
+	version := releaseStock(ctx, grpcActor(ctx), releaseRequest{
+		ProductID:     in.GetProductId(),
+		Quantity:      int(in.GetQuantity()),
+		ReservationID: in.GetReservationId(),
+	})
+	return &inventorypb.ReleaseResponse{Version: version}, nil
+}
+
+// WatchInventory sends the same events as GET /inventory/events. Like the
+// SSE stream, a subscriber that falls behind misses events rather than
+// slowing down reservations; the version on each event shows the gap.
+func (inventoryServiceServer) WatchInventory(in *inventorypb.WatchInventoryRequest, stream inventorypb.InventoryService_WatchInventoryServer) error {
+	ctx := stream.Context()
+	products := make(map[string]bool, len(in.GetProductIds()))
+	for _, id := range in.GetProductIds() {
+		products[id] = true
+	}
+
+	logger.Info(ctx, "Inventory watch opened", map[string]interface{}{
+		"product_ids": in.GetProductIds(),
+		"actor":       grpcActor(ctx),
+	})
+	defer logger.Info(ctx, "Inventory watch closed", map[string]interface{}{
+		"product_ids": in.GetProductIds(),
+	})
+
+	ch := events.Subscribe()
+	defer events.Unsubscribe(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-events.Done():
+			return status.Error(codes.Unavailable, "inventory service is shutting down")
+		case event := <-ch:
+			if len(products) > 0 && !products[event.ProductID] {
+				continue
+			}
+			if err := stream.Send(eventToProto(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func eventToProto(event InventoryEvent) *inventorypb.InventoryEvent {
+	return &inventorypb.InventoryEvent{
+		Type:      event.Type,
+		ProductId: event.ProductID,
+		Quantity:  int32(event.Quantity),
+		Total:     int32(event.Total),
+		Reserved:  int32(event.Reserved),
+		Version:   event.Version,
+		Actor:     event.Actor,
+		TraceId:   event.TraceID,
+		Timestamp: event.Timestamp.Format(time.RFC3339Nano),
+	}
+}
+
+// acquireReservationSlot applies RESERVE_MAX_INFLIGHT to gRPC calls, which
+// are shed with RESOURCE_EXHAUSTED instead of 429. Callers release the slot
+// with reservationLimiter.Release.
+func acquireReservationSlot(ctx context.Context) error {
+	if reservationLimiter == nil {
+		return nil
+	}
+	if reservationLimiter.Acquire(ctx) {
+		return nil
+	}
+	reason := "saturated"
+	if ctx.Err() != nil {
+		reason = "cancelled"
+	}
+	method, _ := grpc.Method(ctx)
+	logger.Warn(ctx, "Reservation engine saturated, shedding request", map[string]interface{}{
+		"method":    method,
+		"in_flight": reservationLimiter.InFlight(),
+		"limit":     cap(reservationLimiter.slots),
+	})
+	shedRequests.WithLabelValues(method, reason).Inc()
+	return status.Error(codes.ResourceExhausted, "inventory service is overloaded, retry later")
+}
+
+// grpcActor identifies the caller by the x-actor metadata key, like the
+// X-Actor header, falling back to its address
+func grpcActor(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("x-actor")) > 0 {
+		return md.Get("x-actor")[0]
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// grpcMetricsInterceptor records unary calls in the same request metrics as
+// HTTP, and turns a panic into an INTERNAL error the way
+// platform.RecoveryMiddleware turns one into a 500
+func grpcMetricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	start := time.Now()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			platform.ReportPanic(ctx, logger, "grpc", info.FullMethod, recovered)
+			resp, err = nil, status.Error(codes.Internal, "internal server error")
+		}
+		requestCount.WithLabelValues("GRPC", info.FullMethod, status.Code(err).String()).Inc()
+		responseTime.WithLabelValues("GRPC", info.FullMethod).Observe(time.Since(start).Seconds())
+	}()
+	return handler(ctx, req)
+}
+
+// grpcStreamMetricsInterceptor counts streams when they end. Their duration
+// is how long the client watched, so it is left out of responseTime.
+func grpcStreamMetricsInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := handler(srv, ss)
+	requestCount.WithLabelValues("GRPC", info.FullMethod, status.Code(err).String()).Inc()
+	return err
+}
+
+// runGRPCServer serves the InventoryService on addr until ctx is cancelled,
+// then ends open watches and stops gracefully
+func runGRPCServer(ctx context.Context, addr string) error {
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.UnaryInterceptor(grpcMetricsInterceptor),
+		grpc.StreamInterceptor(grpcStreamMetricsInterceptor),
+	}
+	// Same certificates and client verification as the HTTP listener
+	tlsConfig, err := platform.ServerTLSConfig(logger)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := grpc.NewServer(opts...)
+	inventorypb.RegisterInventoryServiceServer(srv, inventoryServiceServer{})
+
+	go func() {
+		<-ctx.Done()
+		// Watches never finish on their own, and GracefulStop waits for them
+		events.Close()
+		srv.GracefulStop()
+	}()
+
+	return srv.Serve(lis)
+}
@@ -0,0 +1,5 @@
+// Package inventorypb holds the protobuf and gRPC definitions for
+// inventory-service.
+package inventorypb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative inventory.proto
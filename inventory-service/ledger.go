@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxLedgerEntriesPerProduct bounds memory use for hot products
+const maxLedgerEntriesPerProduct = 1000
+
+// LedgerEntry is a recorded inventory operation
+type LedgerEntry struct {
+	Sequence int64 `json:"sequence"`
+	InventoryEvent
+}
+
+// Ledger keeps an append-only, per-product history of inventory operations
+// along with the reserved totals implied by that history
+type Ledger struct {
+	mu       sync.RWMutex
+	sequence int64
+	entries  map[string][]LedgerEntry
+	reserved map[string]int
+}
+
+var ledger = NewLedger()
+
+func NewLedger() *Ledger {
+	return &Ledger{
+		entries:  make(map[string][]LedgerEntry),
+		reserved: make(map[string]int),
+	}
+}
+
+func (l *Ledger) Append(event InventoryEvent) LedgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sequence++
+	entry := LedgerEntry{Sequence: l.sequence, InventoryEvent: event}
+
+	switch event.Type {
+	case EventReserve:
+		l.reserved[event.ProductID] += event.Quantity
+	case EventRelease:
+		l.reserved[event.ProductID] = max(l.reserved[event.ProductID]-event.Quantity, 0)
+	}
+
+	history := append(l.entries[event.ProductID], entry)
+	if len(history) > maxLedgerEntriesPerProduct {
+		history = history[len(history)-maxLedgerEntriesPerProduct:]
+	}
+	l.entries[event.ProductID] = history
+
+	return entry
+}
+
+// History returns up to limit of the most recent entries for a product,
+// oldest first
+func (l *Ledger) History(productID string, limit int) []LedgerEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	history := l.entries[productID]
+	if limit > 0 && len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+
+	result := make([]LedgerEntry, len(history))
+	copy(result, history)
+	return result
+}
+
+// ExpectedReserved returns the reserved total implied by the ledger
+func (l *Ledger) ExpectedReserved(productID string) int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.reserved[productID]
+}
+
+func getInventoryHistory(c *gin.Context) {
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
+
+	productID := c.Param("product_id")
+	span.SetAttributes(attribute.String("product.id", productID))
+
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = n
+	}
+
+	store.mu.RLock()
+	_, exists := store.inventory[productID]
+	store.mu.RUnlock()
+
+	if !exists {
+		logger.Warn(ctx, "Product not found", map[string]interface{}{"product_id": productID})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	history := ledger.History(productID, limit)
+
+	logger.Info(ctx, "Inventory history retrieved", map[string]interface{}{
+		"product_id": productID,
+		"entries":    len(history),
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": productID,
+		"history":    history,
+	})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+var (
+	shedRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "inventory_service_shed_requests_total",
+			Help: "Number of requests rejected with 429 because the reservation engine was saturated",
+		},
+		[]string{"endpoint", "reason"},
+	)
+	inflightRequests = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "inventory_service_reservation_inflight",
+			Help: "Reservation engine requests currently being processed",
+		},
+		func() float64 {
+			if reservationLimiter == nil {
+				return 0
+			}
+			return float64(reservationLimiter.InFlight())
+		},
+	)
+)
+
+// ConcurrencyLimiter bounds the requests the reservation engine works on at
+// once. A request that can't get a slot within queueTimeout is shed with 429
+// and Retry-After rather than waiting, so a burst can't build a backlog that
+// makes every request slower.
+type ConcurrencyLimiter struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+	retryAfter   time.Duration
+}
+
+var reservationLimiter *ConcurrencyLimiter
+
+// NewConcurrencyLimiterFromEnv reads RESERVE_MAX_INFLIGHT (default 32; 0
+// disables shedding), RESERVE_QUEUE_TIMEOUT (default 100ms) and
+// RESERVE_RETRY_AFTER (default 1s). It returns nil when shedding is disabled.
+func NewConcurrencyLimiterFromEnv() *ConcurrencyLimiter {
+	limit, err := strconv.Atoi(platform.GetEnv("RESERVE_MAX_INFLIGHT", "32"))
+	if err != nil || limit < 0 {
+		limit = 32
+	}
+	if limit == 0 {
+		return nil
+	}
+	queueTimeout, err := time.ParseDuration(platform.GetEnv("RESERVE_QUEUE_TIMEOUT", "100ms"))
+	if err != nil || queueTimeout < 0 {
+		queueTimeout = 100 * time.Millisecond
+	}
+	retryAfter, err := time.ParseDuration(platform.GetEnv("RESERVE_RETRY_AFTER", "1s"))
+	if err != nil || retryAfter <= 0 {
+		retryAfter = time.Second
+	}
+	return &ConcurrencyLimiter{
+		slots:        make(chan struct{}, limit),
+		queueTimeout: queueTimeout,
+		retryAfter:   retryAfter,
+	}
+}
+
+// Acquire takes a slot, waiting up to queueTimeout for one to free up. It
+// reports false when none did or ctx ended first.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if l.queueTimeout == 0 {
+		return false
+	}
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (l *ConcurrencyLimiter) Release() {
+	<-l.slots
+}
+
+func (l *ConcurrencyLimiter) InFlight() int {
+	return len(l.slots)
+}
+
+// Middleware sheds requests that can't get a slot. The slot is released
+// when the handler returns, including when it panics.
+func (l *ConcurrencyLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l == nil {
+			c.Next()
+			return
+		}
+
+		if !l.Acquire(c.Request.Context()) {
+			reason := "saturated"
+			if c.Request.Context().Err() != nil {
+				reason = "cancelled"
+			}
+			retryAfter := int(math.Ceil(l.retryAfter.Seconds()))
+			logger.Warn(c.Request.Context(), "Reservation engine saturated, shedding request", map[string]interface{}{
+				"path":        c.Request.URL.Path,
+				"in_flight":   l.InFlight(),
+				"limit":       cap(l.slots),
+				"retry_after": retryAfter,
+			})
+			shedRequests.WithLabelValues(c.FullPath(), reason).Inc()
+
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Inventory service is overloaded, retry later",
+				"retry_after": retryAfter,
+			})
+			return
+		}
+		defer l.Release()
+		c.Next()
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+var lowStockAlerts = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "inventory_service_low_stock_events_total",
+		Help: "Number of times a product's available stock fell to LOW_STOCK_THRESHOLD or below",
+	},
+	[]string{"product_id"},
+)
+
+// LowStockTracker remembers which products are at or below the threshold so
+// a low_stock event fires once per drop rather than on every operation
+type LowStockTracker struct {
+	mu        sync.Mutex
+	threshold int
+	low       map[string]bool
+}
+
+var lowStock = NewLowStockTrackerFromEnv()
+
+// NewLowStockTrackerFromEnv reads LOW_STOCK_THRESHOLD (default 10, negative
+// disables)
+func NewLowStockTrackerFromEnv() *LowStockTracker {
+	threshold := 10
+	if n, err := strconv.Atoi(platform.GetEnv("LOW_STOCK_THRESHOLD", "10")); err == nil {
+		threshold = n
+	}
+	return &LowStockTracker{threshold: threshold, low: make(map[string]bool)}
+}
+
+// Observe reports whether event takes the product's available stock to the
+// threshold or below from above it. Stock rising back above the threshold
+// re-arms the tracker.
+func (t *LowStockTracker) Observe(event InventoryEvent) bool {
+	if t.threshold < 0 {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	isLow := event.Total-event.Reserved <= t.threshold
+	wasLow := t.low[event.ProductID]
+	if isLow == wasLow {
+		return false
+	}
+	if isLow {
+		t.low[event.ProductID] = true
+		return true
+	}
+	delete(t.low, event.ProductID)
+	return false
+}
+
+// checkLowStock publishes a low_stock event when event drops the product to
+// the threshold. It goes to stream subscribers only; it isn't an operation,
+// so the ledger doesn't record it.
+func checkLowStock(ctx context.Context, event InventoryEvent) {
+	if !lowStock.Observe(event) {
+		return
+	}
+
+	available := event.Total - event.Reserved
+	lowStockAlerts.WithLabelValues(event.ProductID).Inc()
+	logger.Warn(ctx, "Product stock is low", map[string]interface{}{
+		"product_id": event.ProductID,
+		"available":  available,
+		"threshold":  lowStock.threshold,
+	})
+
+	events.Publish(InventoryEvent{
+		Type:      EventLowStock,
+		ProductID: event.ProductID,
+		Quantity:  available,
+		Total:     event.Total,
+		Reserved:  event.Reserved,
+		Version:   event.Version,
+		Actor:     event.Actor,
+		TraceID:   event.TraceID,
+		Timestamp: event.Timestamp,
+	})
+}
@@ -2,43 +2,84 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
+	"platform"
+	eventbus "platform/events"
 )
 
 type InventoryStore struct {
 	mu        sync.RWMutex
 	inventory map[string]int
 	reserved  map[string]int
+	versions  map[string]int64
 }
 
 var (
-	store  *InventoryStore
-	tracer trace.Tracer
-	logger *StructuredLogger
+	// errVersionMismatch is returned when a caller's expected_version is stale
+	errVersionMismatch       = errors.New("version mismatch")
+	errProductNotFound       = errors.New("product not found")
+	errInsufficientInventory = errors.New("insufficient inventory")
+	errInvalidReservation    = errors.New("callback_url must be an http(s) URL, ttl_seconds non-negative and priority one of checkout, cart-hold, preview")
+)
+
+// bumpVersion checks the caller's expected version (if any) and advances the
+// product's version. Callers must hold store.mu.
+func (s *InventoryStore) bumpVersion(productID string, expected *int64) (int64, error) {
+	current := s.versions[productID]
+	if expected != nil && *expected != current {
+		return current, errVersionMismatch
+	}
+	s.versions[productID] = current + 1
+	return current + 1, nil
+}
+
+var (
+	store     *InventoryStore
+	telemetry = platform.Telemetry{ServiceName: "inventory-service", ServiceVersion: "1.0.0", GRPC: true}
+	tracer    = telemetry.Tracer()
+	logger    = platform.NewStructuredLogger("inventory-service")
 )
 
 func init() {
+	prometheus.MustRegister(failedReservations)
+	prometheus.MustRegister(newStockCollector())
+	prometheus.MustRegister(inventoryDrift)
+	prometheus.MustRegister(reconcileCorrections)
+	prometheus.MustRegister(lowStockAlerts)
+	prometheus.MustRegister(rateLimitedRequests)
+	prometheus.MustRegister(requestTimeouts)
+	prometheus.MustRegister(configReloads)
+	prometheus.MustRegister(chaosInjections)
+	prometheus.MustRegister(chaosActiveFaults)
+	prometheus.MustRegister(shedRequests)
+	prometheus.MustRegister(inflightRequests)
+	prometheus.MustRegister(reservationWebhooks)
+	prometheus.MustRegister(reservationPreemptions)
+	prometheus.MustRegister(availabilityChecks)
+
 	store = &InventoryStore{
 		inventory: make(map[string]int),
 		reserved:  nil,
+		versions:  make(map[string]int64),
 	}
 
 	// Initialize inventory with some stock
@@ -58,127 +99,262 @@ func init() {
 	}()
 }
 
-func initTracer() func() {
-	ctx := context.Background()
+func getInventory(c *gin.Context) {
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
 
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName("inventory-service"),
-			semconv.ServiceVersion("1.0.0"),
-		),
-	)
-	if err != nil {
-		log.Fatalf("failed to create resource: %v", err)
-		return func() {}
-	}
+	productID := c.Param("product_id")
+	span.SetAttributes(attribute.String("product.id", productID))
 
-	otelAgentAddr, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if !ok {
-		otelAgentAddr = "localhost:4317"
+	logger.Info(ctx, "Getting inventory", map[string]interface{}{"product_id": productID})
+
+	item, version, exists := lookupStock(productID)
+	if !exists {
+		logger.Warn(ctx, "Product not found", map[string]interface{}{"product_id": productID})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
 	}
 
-	traceClient := otlptracegrpc.NewClient(
-		otlptracegrpc.WithInsecure(),
-		otlptracegrpc.WithEndpoint(otelAgentAddr),
-		otlptracegrpc.WithDialOption(),
-	)
+	logger.Info(ctx, "Inventory retrieved", map[string]interface{}{
+		"product_id":     productID,
+		"total_quantity": item.Quantity,
+		"reserved":       item.Reserved,
+		"available":      item.Available,
+		"version":        version,
+	})
 
-	traceExp, err := otlptrace.New(ctx, traceClient)
-	if err != nil {
-		log.Fatalf("failed to create trace exporter: %v", err)
-		return func() {}
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": productID,
+		"quantity":   item.Quantity,
+		"reserved":   item.Reserved,
+		"available":  item.Available,
+		"version":    version,
+	})
+}
+
+// lookupStock returns a product's stock and version, and false if the
+// product doesn't exist
+func lookupStock(productID string) (InventoryItem, int64, bool) {
+	store.mu.RLock()
+	quantity, exists := store.inventory[productID]
+	version := store.versions[productID]
+	store.mu.RUnlock()
+
+	if !exists {
+		return InventoryItem{}, 0, false
 	}
 
-	bsp := sdktrace.NewBatchSpanProcessor(traceExp)
-	tracerProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithResource(res),
-		sdktrace.WithSpanProcessor(bsp),
-	)
+	// Reading reserved without lock
+	reserved := store.reserved[productID]
+	return InventoryItem{
+		ProductID: productID,
+		Quantity:  quantity,
+		Reserved:  reserved,
+		Available: quantity - reserved,
+	}, version, true
+}
 
-	otel.SetTracerProvider(tracerProvider)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
-		propagation.TraceContext{},
-		propagation.Baggage{},
-	))
+// InventoryItem is a single row in the inventory listing
+type InventoryItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+	Reserved  int    `json:"reserved"`
+	Available int    `json:"available"`
+}
 
-	tracer = otel.Tracer("inventory-service")
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
 
-	// Initialize logger
-	logger = NewStructuredLogger("inventory-service")
+func listInventory(c *gin.Context) {
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
 
-	return func() {
-		if err := tracerProvider.Shutdown(ctx); err != nil {
-			log.Printf("failed to shutdown tracer provider: %v", err)
+	limit := defaultListLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
 		}
+		limit = min(n, maxListLimit)
 	}
-}
 
-func getInventory(c *gin.Context) {
-	ctx := c.Request.Context()
-	span := trace.SpanFromContext(ctx)
+	offset := 0
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+		offset = n
+	}
 
-	productID := c.Param("product_id")
-	span.SetAttributes(attribute.String("product.id", productID))
+	minAvailable := 0
+	hasMinAvailable := false
+	if v := c.Query("min_available"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid min_available"})
+			return
+		}
+		minAvailable = n
+		hasMinAvailable = true
+	}
 
-	logger.Info(ctx, "Getting inventory", map[string]interface{}{"product_id": productID})
+	reservedOnly := c.Query("reserved_only") == "true"
+	prefix := c.Query("product_id_prefix")
+
+	span.SetAttributes(
+		attribute.Int("list.limit", limit),
+		attribute.Int("list.offset", offset),
+		attribute.String("list.product_id_prefix", prefix),
+		attribute.Bool("list.reserved_only", reservedOnly),
+	)
+
+	logger.Info(ctx, "Listing inventory", map[string]interface{}{
+		"limit":             limit,
+		"offset":            offset,
+		"min_available":     minAvailable,
+		"reserved_only":     reservedOnly,
+		"product_id_prefix": prefix,
+	})
 
 	store.mu.RLock()
-	quantity, exists := store.inventory[productID]
+	items := make([]InventoryItem, 0, len(store.inventory))
+	for productID, quantity := range store.inventory {
+		if prefix != "" && !strings.HasPrefix(productID, prefix) {
+			continue
+		}
+		reserved := store.reserved[productID]
+		available := quantity - reserved
+		if reservedOnly && reserved == 0 {
+			continue
+		}
+		if hasMinAvailable && available < minAvailable {
+			continue
+		}
+		items = append(items, InventoryItem{
+			ProductID: productID,
+			Quantity:  quantity,
+			Reserved:  reserved,
+			Available: available,
+		})
+	}
 	store.mu.RUnlock()
 
-	if !exists {
-		logger.Warn(ctx, "Product not found", map[string]interface{}{"product_id": productID})
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-		return
-	}
+	// Sort so pages are stable between requests
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ProductID < items[j].ProductID
+	})
 
-	// Reading reserved without lock
-	reserved := store.reserved[productID]
-	available := quantity - reserved
+	total := len(items)
+	page := []InventoryItem{}
+	if offset < total {
+		page = items[offset:min(offset+limit, total)]
+	}
 
-	logger.Info(ctx, "Inventory retrieved", map[string]interface{}{
-		"product_id":     productID,
-		"total_quantity": quantity,
-		"reserved":       reserved,
-		"available":      available,
-	})
+	span.SetAttributes(attribute.Int("list.total", total))
 
 	c.JSON(http.StatusOK, gin.H{
-		"product_id": productID,
-		"quantity":   quantity,
-		"reserved":   reserved,
-		"available":  available,
+		"items":  page,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
 	})
 }
 
+// reserveRequest is a reservation made through either the HTTP or the gRPC
+// API
+type reserveRequest struct {
+	ProductID       string `json:"product_id"`
+	Quantity        int    `json:"quantity"`
+	ExpectedVersion *int64 `json:"expected_version"`
+	// CallbackURL receives a webhook if the reservation expires or is
+	// force-released
+	CallbackURL string `json:"callback_url"`
+	TTLSeconds  int    `json:"ttl_seconds"`
+	// Priority is checkout (the default), cart-hold or preview. Holds
+	// below checkout are tracked so they can be preempted.
+	Priority string `json:"priority"`
+}
+
+// reserveResult describes a reservation that was made. On
+// errVersionMismatch only Version, the current version, is set.
+type reserveResult struct {
+	ReservationID string
+	Version       int64
+	ExpiresAt     *time.Time
+}
+
 func reserveInventory(c *gin.Context) {
 	ctx := c.Request.Context()
-	span := trace.SpanFromContext(ctx)
-
-	var req struct {
-		ProductID string `json:"product_id"`
-		Quantity  int    `json:"quantity"`
-	}
 
+	var req reserveRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Error(ctx, "Invalid request", map[string]interface{}{"error": err.Error()})
+		recordReservation(ctx, "invalid_request")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
+	result, err := reserveStock(ctx, requestActor(c), req)
+	switch {
+	case errors.Is(err, errInvalidReservation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errProductNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	case errors.Is(err, errInsufficientInventory):
+		c.JSON(http.StatusConflict, gin.H{"error": "Insufficient inventory"})
+		return
+	case errors.Is(err, errVersionMismatch):
+		c.JSON(http.StatusConflict, gin.H{"error": "Version mismatch", "current_version": result.Version})
+		return
+	}
+
+	response := gin.H{
+		"product_id":     req.ProductID,
+		"reserved":       req.Quantity,
+		"version":        result.Version,
+		"reservation_id": result.ReservationID,
+	}
+	if result.ExpiresAt != nil {
+		response["expires_at"] = *result.ExpiresAt
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// reserveStock runs the reservation engine for the HTTP and gRPC APIs and
+// records the outcome in the reservation metrics. It panics if it finds
+// more stock reserved than exists, unless the reconciler auto-corrects.
+func reserveStock(ctx context.Context, actor string, req reserveRequest) (reserveResult, error) {
+	span := trace.SpanFromContext(ctx)
+
+	if req.Priority == "" {
+		req.Priority = PriorityCheckout
+	}
+	if (req.CallbackURL != "" && !validCallbackURL(req.CallbackURL)) || req.TTLSeconds < 0 || priorityRank(req.Priority) < 0 {
+		recordReservation(ctx, "invalid_request")
+		return reserveResult{}, errInvalidReservation
+	}
+
 	span.SetAttributes(
 		attribute.String("product.id", req.ProductID),
 		attribute.Int("quantity", req.Quantity),
+		attribute.String("reservation.priority", req.Priority),
 	)
 
 	logger.Info(ctx, "Reserving inventory", map[string]interface{}{
 		"product_id": req.ProductID,
 		"quantity":   req.Quantity,
+		"priority":   req.Priority,
 	})
 
-	// Simulate some processing time
-	time.Sleep(time.Duration(rand.Intn(50)) * time.Millisecond)
+	// Processing time is simulated by the reserve-processing latency fault
+	// (see CHAOS_FAULTS), so it can be reshaped without a rebuild
 
 	store.mu.Lock()
 	currentQty, exists := store.inventory[req.ProductID]
@@ -188,24 +364,50 @@ func reserveInventory(c *gin.Context) {
 		logger.Warn(ctx, "Product not found for reservation", map[string]interface{}{
 			"product_id": req.ProductID,
 		})
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-		return
+		recordReservation(ctx, "not_found")
+		return reserveResult{}, errProductNotFound
 	}
 
 	// Reading reserved without lock
 	currentReserved := store.reserved[req.ProductID]
 
-	// Add small delay
+	// The gap between reading and writing reserved is the reservation race,
+	// not simulated latency, so it stays here
 	time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
 
+	// Contended stock goes to the higher priority: lower-priority holds
+	// make room when together they cover the shortfall
+	if shortfall := req.Quantity - (currentQty - currentReserved); shortfall > 0 {
+		if preempted := preemptReservations(ctx, req.ProductID, req.Priority, shortfall); preempted > 0 {
+			span.SetAttributes(attribute.Int("reservation.preempted", preempted))
+			store.mu.Lock()
+			currentReserved = store.reserved[req.ProductID]
+			store.mu.Unlock()
+		}
+	}
+
 	if currentQty-currentReserved < req.Quantity {
 		logger.Error(ctx, "Insufficient inventory", map[string]interface{}{
 			"product_id": req.ProductID,
 			"requested":  req.Quantity,
 			"available":  currentQty - currentReserved,
 		})
-		c.JSON(http.StatusConflict, gin.H{"error": "Insufficient inventory"})
-		return
+		recordReservation(ctx, "insufficient_inventory")
+		return reserveResult{}, errInsufficientInventory
+	}
+
+	store.mu.Lock()
+	version, err := store.bumpVersion(req.ProductID, req.ExpectedVersion)
+	store.mu.Unlock()
+
+	if err != nil {
+		logger.Warn(ctx, "Inventory version mismatch", map[string]interface{}{
+			"product_id":       req.ProductID,
+			"expected_version": *req.ExpectedVersion,
+			"current_version":  version,
+		})
+		recordReservation(ctx, "version_mismatch")
+		return reserveResult{Version: version}, err
 	}
 
 	// Writing to reserved without lock
@@ -224,41 +426,95 @@ func reserveInventory(c *gin.Context) {
 			"total_inventory": currentQty,
 			"reserved":        store.reserved[req.ProductID],
 		})
+		recordReservation(ctx, "data_corruption")
+		// With auto-correction enabled the reservation is left out of the
+		// ledger and the reconciler rolls the counter back to it
+		if reconciler.AutoCorrect() {
+			reconciler.Trigger()
+			return reserveResult{}, errInsufficientInventory
+		}
 		panic(fmt.Sprintf("Data corruption detected: reserved (%d) > total (%d)",
 			store.reserved[req.ProductID], currentQty))
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"product_id":     req.ProductID,
-		"reserved":       req.Quantity,
-		"reservation_id": fmt.Sprintf("RES-%d", time.Now().Unix()),
+	emitEvent(ctx, actor, InventoryEvent{
+		Type:      EventReserve,
+		ProductID: req.ProductID,
+		Quantity:  req.Quantity,
+		Total:     currentQty,
+		Reserved:  store.reserved[req.ProductID],
+		Version:   version,
 	})
+	recordReservation(ctx, "reserved")
+
+	result := reserveResult{ReservationID: reservations.NewID(), Version: version}
+	if req.CallbackURL != "" || req.TTLSeconds > 0 || req.Priority != PriorityCheckout {
+		res := Reservation{
+			ID:          result.ReservationID,
+			ProductID:   req.ProductID,
+			Quantity:    req.Quantity,
+			Priority:    req.Priority,
+			CallbackURL: req.CallbackURL,
+			CreatedAt:   time.Now().UTC(),
+		}
+		if req.TTLSeconds > 0 {
+			expires := res.CreatedAt.Add(time.Duration(req.TTLSeconds) * time.Second)
+			res.ExpiresAt = &expires
+			result.ExpiresAt = &expires
+		}
+		reservations.Add(res)
+	}
+	publishReservationCreated(ctx, ReservationCreated{
+		ReservationID: result.ReservationID,
+		ProductID:     req.ProductID,
+		Quantity:      req.Quantity,
+		Reserved:      store.reserved[req.ProductID],
+		Total:         currentQty,
+		Version:       version,
+	})
+
+	return result, nil
+}
+
+// releaseRequest is a release made through either the HTTP or the gRPC API
+type releaseRequest struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+	// ReservationID stops a tracked reservation from expiring later
+	ReservationID string `json:"reservation_id"`
 }
 
 func releaseInventory(c *gin.Context) {
 	ctx := c.Request.Context()
-	span := trace.SpanFromContext(ctx)
-
-	var req struct {
-		ProductID string `json:"product_id"`
-		Quantity  int    `json:"quantity"`
-	}
 
+	var req releaseRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Error(ctx, "Invalid request", map[string]interface{}{"error": err.Error()})
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
+	version := releaseStock(ctx, requestActor(c), req)
+	c.JSON(http.StatusOK, gin.H{"status": "released", "version": version})
+}
+
+// releaseStock returns reserved stock for the HTTP and gRPC APIs and
+// returns the product's new version
+func releaseStock(ctx context.Context, actor string, req releaseRequest) int64 {
+	span := trace.SpanFromContext(ctx)
 	span.SetAttributes(
 		attribute.String("product.id", req.ProductID),
 		attribute.Int("quantity", req.Quantity),
 	)
 
 	logger.Info(ctx, "Releasing inventory", map[string]interface{}{
-		"product_id": req.ProductID,
-		"quantity":   req.Quantity,
+		"product_id":     req.ProductID,
+		"quantity":       req.Quantity,
+		"reservation_id": req.ReservationID,
 	})
+	if req.ReservationID != "" {
+		reservations.Remove(req.ReservationID)
+	}
 
 	// Not locking when updating reserved
 	if reserved, exists := store.reserved[req.ProductID]; exists {
@@ -278,7 +534,112 @@ func releaseInventory(c *gin.Context) {
 		"new_reserved_total": store.reserved[req.ProductID],
 	})
 
-	c.JSON(http.StatusOK, gin.H{"status": "released"})
+	store.mu.Lock()
+	total := store.inventory[req.ProductID]
+	version, _ := store.bumpVersion(req.ProductID, nil)
+	store.mu.Unlock()
+
+	emitEvent(ctx, actor, InventoryEvent{
+		Type:      EventRelease,
+		ProductID: req.ProductID,
+		Quantity:  req.Quantity,
+		Total:     total,
+		Reserved:  store.reserved[req.ProductID],
+		Version:   version,
+	})
+
+	return version
+}
+
+func adjustInventory(c *gin.Context) {
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
+
+	var req struct {
+		ProductID       string `json:"product_id"`
+		Delta           int    `json:"delta"`
+		Reason          string `json:"reason"`
+		ExpectedVersion *int64 `json:"expected_version"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error(ctx, "Invalid request", map[string]interface{}{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("product.id", req.ProductID),
+		attribute.Int("delta", req.Delta),
+	)
+
+	logger.Info(ctx, "Adjusting inventory", map[string]interface{}{
+		"product_id": req.ProductID,
+		"delta":      req.Delta,
+		"reason":     req.Reason,
+	})
+
+	store.mu.Lock()
+	quantity, exists := store.inventory[req.ProductID]
+	if !exists {
+		store.mu.Unlock()
+		logger.Warn(ctx, "Product not found for adjustment", map[string]interface{}{
+			"product_id": req.ProductID,
+		})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	reserved := store.reserved[req.ProductID]
+	newQuantity := quantity + req.Delta
+	if newQuantity < reserved {
+		store.mu.Unlock()
+		logger.Warn(ctx, "Adjustment would drop stock below reserved", map[string]interface{}{
+			"product_id": req.ProductID,
+			"delta":      req.Delta,
+			"quantity":   quantity,
+			"reserved":   reserved,
+		})
+		c.JSON(http.StatusConflict, gin.H{"error": "Adjustment would drop stock below reserved quantity"})
+		return
+	}
+
+	version, err := store.bumpVersion(req.ProductID, req.ExpectedVersion)
+	if err != nil {
+		store.mu.Unlock()
+		logger.Warn(ctx, "Inventory version mismatch", map[string]interface{}{
+			"product_id":       req.ProductID,
+			"expected_version": *req.ExpectedVersion,
+			"current_version":  version,
+		})
+		c.JSON(http.StatusConflict, gin.H{"error": "Version mismatch", "current_version": version})
+		return
+	}
+	store.inventory[req.ProductID] = newQuantity
+	store.mu.Unlock()
+
+	logger.Info(ctx, "Inventory adjusted", map[string]interface{}{
+		"product_id":   req.ProductID,
+		"delta":        req.Delta,
+		"new_quantity": newQuantity,
+	})
+
+	recordEvent(c, InventoryEvent{
+		Type:      EventAdjust,
+		ProductID: req.ProductID,
+		Quantity:  req.Delta,
+		Total:     newQuantity,
+		Reserved:  reserved,
+		Version:   version,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": req.ProductID,
+		"quantity":   newQuantity,
+		"reserved":   reserved,
+		"available":  newQuantity - reserved,
+		"version":    version,
+	})
 }
 
 func healthCheck(c *gin.Context) {
@@ -286,57 +647,187 @@ func healthCheck(c *gin.Context) {
 }
 
 func main() {
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Re-read CONFIG_FILE on SIGHUP
+	watchConfigReload(ctx)
+	config.OnReload(logger.LoadSettings)
 
-	shutdown := initTracer()
-	defer shutdown()
+	tp, err := platform.InitTracer(ctx, telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		// Flush buffered spans before exiting
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			logger.Error(ctx, "Error shutting down tracer provider", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+
+	mp := initMeter()
+	if mp != nil {
+		defer func() {
+			// Push the last metrics before exiting
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := mp.Shutdown(ctx); err != nil {
+				logger.Error(ctx, "Error shutting down meter provider", map[string]interface{}{"error": err.Error()})
+			}
+		}()
+	}
+
+	// Send logs to the collector too when OTEL_LOGS_ENABLED=true
+	logExporter, err := platform.InitLogExport(ctx, logger, telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize log export: %v", err)
+	}
+	if logExporter != nil {
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := logExporter.Shutdown(ctx); err != nil {
+				log.Printf("Error shutting down log exporter: %v", err)
+			}
+		}()
+	}
+
+	// Publish reservation.created to Kafka or NATS when EVENTS_BROKER is set
+	domainEvents, err = eventbus.NewEmitterFromEnv("inventory-service", logger)
+	if err != nil {
+		log.Fatalf("Failed to initialize event publishing: %v", err)
+	}
+	if domainEvents != nil {
+		domainEvents.Start(ctx)
+		defer domainEvents.Close()
+	}
 
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 
-	// Custom structured logging middleware
+	// Gzip responses for clients that accept it
+	r.Use(platform.CompressionMiddleware())
+
+	// Correlate logs and errors by X-Request-ID, across services
+	r.Use(platform.RequestIDMiddleware())
+
+	// Request count and latency by route
 	r.Use(func(c *gin.Context) {
 		start := time.Now()
-		path := c.Request.URL.Path
-		raw := c.Request.URL.RawQuery
-
 		c.Next()
 
-		latency := time.Since(start)
-		clientIP := c.ClientIP()
-		method := c.Request.Method
-		statusCode := c.Writer.Status()
-
-		if raw != "" {
-			path = path + "?" + raw
+		endpoint := c.FullPath()
+		if endpoint == "" {
+			endpoint = "unmatched"
 		}
-
-		ctx := c.Request.Context()
-		logger.Info(ctx, "HTTP request processed", map[string]interface{}{
-			"client_ip":   clientIP,
-			"method":      method,
-			"path":        path,
-			"status_code": statusCode,
-			"latency_ms":  latency.Milliseconds(),
-			"user_agent":  c.Request.UserAgent(),
-		})
+		requestCount.WithLabelValues(c.Request.Method, endpoint, strconv.Itoa(c.Writer.Status())).Inc()
+		responseTime.WithLabelValues(c.Request.Method, endpoint).Observe(time.Since(start).Seconds())
 	})
 
 	r.Use(otelgin.Middleware("inventory-service"))
+	r.Use(platform.MetricsMiddleware("inventory-service"))
+	r.Use(platform.AccessLogMiddleware(logger))
+
+	// Per-route SLO compliance, summarized on /slo. Event streams stay open
+	// until the client disconnects, so they are left out
+	slo := platform.NewSLOTrackerFromEnv("inventory-service", "GET /inventory/events")
+	r.Use(slo.Middleware())
+
+	// Tag requests slower than their route's recent p99 on the span
+	outliers := platform.NewOutlierDetectorFromEnv("inventory-service", logger, "GET /inventory/events")
+	outliers.AddQueue("reservation_inflight", func() int {
+		if reservationLimiter == nil {
+			return 0
+		}
+		return reservationLimiter.InFlight()
+	})
+	r.Use(outliers.Middleware())
+
+	// Turn handler panics into logged, traced and counted 500s
+	r.Use(platform.RecoveryMiddleware(logger))
+
+	// Per-client rate limiting (disabled unless RATE_LIMIT_RPS is set)
+	r.Use(rateLimitMiddleware(NewRateLimiterFromEnv))
+
+	// Per-request deadlines (REQUEST_TIMEOUT, ROUTE_TIMEOUTS)
+	r.Use(timeoutMiddleware(map[string]time.Duration{
+		// Event streams stay open until the client disconnects
+		"GET /inventory/events": 0,
+	}))
+
+	// Injected faults from CHAOS_FAULTS and the /chaos API
+	StartChaosFromConfig()
+	r.Use(chaosMiddleware())
 
 	r.GET("/health", healthCheck)
+	if platform.PrometheusEnabled() {
+		r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
+	r.POST("/config/reload", postConfigReload)
+	registerChaosRoutes(r)
+	platform.RegisterLogLevelRoutes(r, logger)
+	platform.RegisterAuditRoutes(r)
+	platform.RegisterSLORoutes(r, slo)
+	platform.RegisterDependencyRoutes(r, "inventory-service")
+
+	// Hold /readyz at 503 until the collector answers
+	startup := platform.NewStartupCheckerFromEnv("inventory-service", logger,
+		telemetry.CollectorDependency(),
+	)
+	startup.Start(ctx)
+	platform.RegisterStartupRoutes(r, startup)
+	r.GET("/inventory", listInventory)
+	r.GET("/inventory/events", streamInventoryEvents)
 	r.GET("/inventory/:product_id", getInventory)
-	r.POST("/inventory/reserve", reserveInventory)
-	r.POST("/inventory/release", releaseInventory)
+	r.GET("/inventory/:product_id/history", getInventoryHistory)
+
+	// Read-only cart availability; it never reserves, so it isn't shed
+	r.POST("/inventory/check", checkAvailability)
+
+	// Shed reservation engine work past RESERVE_MAX_INFLIGHT with 429
+	reservationLimiter = NewConcurrencyLimiterFromEnv()
+	shed := reservationLimiter.Middleware()
+	r.POST("/inventory/reserve", shed, reserveInventory)
+	r.POST("/inventory/release", shed, releaseInventory)
+	r.POST("/inventory/adjust", shed, adjustInventory)
+	r.GET("/inventory/reservations/:id", getReservation)
+	r.POST("/inventory/reservations/:id/release", shed, forceReleaseReservation)
+
+	reconcileInterval, err := time.ParseDuration(platform.GetEnv("RECONCILE_INTERVAL", "30s"))
+	if err != nil {
+		logger.Error(ctx, "Invalid RECONCILE_INTERVAL, using default", map[string]interface{}{"error": err.Error()})
+		reconcileInterval = 30 * time.Second
+	}
+	reconciler = NewReconciler(reconcileInterval, platform.GetEnv("RECONCILE_AUTO_CORRECT", "false") == "true")
+	reconciler.Start(ctx)
 
-	port := os.Getenv("PORT")
+	sweepInterval, err := time.ParseDuration(platform.GetEnv("RESERVATION_SWEEP_INTERVAL", "5s"))
+	if err != nil || sweepInterval <= 0 {
+		sweepInterval = 5 * time.Second
+	}
+	reservations.Start(ctx, sweepInterval)
+
+	port := config.Get("PORT")
 	if port == "" {
 		port = "8085"
 	}
 
+	// gRPC API mirroring the stock, reserve and release endpoints, with a
+	// streaming watch in place of polling
+	grpcPort := platform.GetEnv("GRPC_PORT", "9085")
+	go func() {
+		logger.Info(ctx, "Inventory service gRPC starting", map[string]interface{}{"port": grpcPort})
+		if err := runGRPCServer(ctx, ":"+grpcPort); err != nil {
+			logger.Error(ctx, "gRPC server error", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+
 	logger.Info(ctx, "Starting inventory service", map[string]interface{}{"port": port})
-	if err := r.Run(":" + port); err != nil {
-		logger.Error(ctx, "Failed to start server", map[string]interface{}{"error": err.Error()})
-		os.Exit(1)
+	if err := runServer(ctx, ":"+port, r); err != nil {
+		logger.Error(ctx, "Server error", map[string]interface{}{"error": err.Error()})
 	}
+
+	logger.Info(context.Background(), "Inventory service stopped, flushing telemetry")
 }
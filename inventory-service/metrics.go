@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+// Prometheus metrics
+var (
+	requestCount, responseTime = platform.NewRequestMetrics("inventory_service", "inventory service")
+
+	failedReservations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "inventory_service_failed_reservations",
+			Help: "Number of reservation requests that did not reserve stock",
+		},
+		[]string{"reason"},
+	)
+)
+
+// stockCollector reports per-product stock levels from the store at scrape
+// time so the gauges never lag behind the live counters
+type stockCollector struct {
+	total     *prometheus.Desc
+	reserved  *prometheus.Desc
+	available *prometheus.Desc
+}
+
+func newStockCollector() *stockCollector {
+	labels := []string{"product_id"}
+	return &stockCollector{
+		total: prometheus.NewDesc(
+			"inventory_service_stock_total",
+			"Total stock per product",
+			labels, nil,
+		),
+		reserved: prometheus.NewDesc(
+			"inventory_service_stock_reserved",
+			"Reserved stock per product",
+			labels, nil,
+		),
+		available: prometheus.NewDesc(
+			"inventory_service_stock_available",
+			"Available (total minus reserved) stock per product",
+			labels, nil,
+		),
+	}
+}
+
+func (sc *stockCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sc.total
+	ch <- sc.reserved
+	ch <- sc.available
+}
+
+func (sc *stockCollector) Collect(ch chan<- prometheus.Metric) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for productID, quantity := range store.inventory {
+		reserved := store.reserved[productID]
+		ch <- prometheus.MustNewConstMetric(sc.total, prometheus.GaugeValue, float64(quantity), productID)
+		ch <- prometheus.MustNewConstMetric(sc.reserved, prometheus.GaugeValue, float64(reserved), productID)
+		ch <- prometheus.MustNewConstMetric(sc.available, prometheus.GaugeValue, float64(quantity-reserved), productID)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"platform"
+)
+
+// OpenTelemetry instruments, exported over OTLP alongside the Prometheus
+// metrics on /metrics
+var (
+	reservationCounter metric.Int64Counter
+)
+
+// initMeter exports metrics over OTLP and creates the business instruments.
+// It returns nil when OTEL_METRICS_ENABLED=false; the instruments are then
+// no-ops.
+func initMeter() *sdkmetric.MeterProvider {
+	mp, err := platform.InitMeter(context.Background(), telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize metrics: %v", err)
+	}
+
+	meter := otel.Meter("inventory-service")
+	reservationCounter, _ = meter.Int64Counter("inventory.reservations", metric.WithDescription("Number of reservation attempts by result"))
+
+	return mp
+}
+
+// recordReservation counts a reservation attempt. Any result other than
+// "reserved" is also counted as a failed reservation.
+func recordReservation(ctx context.Context, result string) {
+	if result != "reserved" {
+		failedReservations.WithLabelValues(result).Inc()
+	}
+	reservationCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("reservation.result", result)))
+}
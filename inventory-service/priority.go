@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"platform"
+)
+
+// Reservation priorities, lowest first. A reservation that can't be met
+// from available stock may preempt tracked reservations of a lower
+// priority for the same product.
+const (
+	// PriorityPreview holds stock while a product page is shown
+	PriorityPreview = "preview"
+	// PriorityCartHold holds stock for an item sitting in a cart
+	PriorityCartHold = "cart-hold"
+	// PriorityCheckout reserves stock for an order; it is the default
+	PriorityCheckout = "checkout"
+)
+
+// WebhookReservationPreempted is sent when a reservation's stock is taken
+// by a higher-priority one
+const WebhookReservationPreempted = "reservation.preempted"
+
+var reservationPriorities = []string{PriorityPreview, PriorityCartHold, PriorityCheckout}
+
+var reservationPreemptions = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "inventory_service_reservation_preemptions_total",
+		Help: "Number of reservations released to make room for a higher-priority one, by the priority of each",
+	},
+	[]string{"priority", "preempted_by"},
+)
+
+// preemptionEnabled is read from RESERVATION_PREEMPTION (default true)
+var preemptionEnabled = platform.GetEnv("RESERVATION_PREEMPTION", "true") != "false"
+
+// priorityRank orders priorities; an unset priority is checkout and an
+// unknown one is -1
+func priorityRank(priority string) int {
+	if priority == "" {
+		priority = PriorityCheckout
+	}
+	for rank, p := range reservationPriorities {
+		if p == priority {
+			return rank
+		}
+	}
+	return -1
+}
+
+// takePreemptible removes and returns the tracked reservations of the
+// product below priority that together free at least shortfall units,
+// lowest priority and then newest first. It takes nothing when they can't
+// cover the shortfall, so holds are never dropped for a reservation that
+// would fail anyway.
+func (r *ReservationRegistry) takePreemptible(productID, priority string, shortfall int) []Reservation {
+	rank := priorityRank(priority)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var candidates []*Reservation
+	for _, res := range r.reservations {
+		if res.ProductID == productID && priorityRank(res.Priority) < rank {
+			candidates = append(candidates, res)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := priorityRank(candidates[i].Priority), priorityRank(candidates[j].Priority)
+		if a != b {
+			return a < b
+		}
+		return candidates[i].CreatedAt.After(candidates[j].CreatedAt)
+	})
+
+	freed := 0
+	var taken []Reservation
+	for _, res := range candidates {
+		if freed >= shortfall {
+			break
+		}
+		freed += res.Quantity
+		taken = append(taken, *res)
+	}
+	if freed < shortfall {
+		return nil
+	}
+	for _, res := range taken {
+		delete(r.reservations, res.ID)
+	}
+	return taken
+}
+
+// preemptReservations releases lower-priority reservations of the product
+// to free shortfall units for a reservation at priority, notifying each
+// one's callback URL. It reports how many reservations were preempted.
+func preemptReservations(ctx context.Context, productID, priority string, shortfall int) int {
+	if !preemptionEnabled {
+		return 0
+	}
+	if priority == "" {
+		priority = PriorityCheckout
+	}
+	taken := reservations.takePreemptible(productID, priority, shortfall)
+	for _, res := range taken {
+		preemptReservation(ctx, res, priority)
+	}
+	return len(taken)
+}
+
+func preemptReservation(ctx context.Context, res Reservation, by string) {
+	ctx, span := tracer.Start(ctx, "preempt_reservation")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("reservation.id", res.ID),
+		attribute.String("reservation.priority", res.Priority),
+		attribute.String("reservation.preempted_by", by),
+	)
+
+	logger.Warn(ctx, "Reservation preempted, releasing stock", map[string]interface{}{
+		"reservation_id": res.ID,
+		"product_id":     res.ProductID,
+		"quantity":       res.Quantity,
+		"priority":       res.Priority,
+		"preempted_by":   by,
+	})
+	reservationPreemptions.WithLabelValues(res.Priority, by).Inc()
+	releaseReservedStock(ctx, res, "reservation-preemption")
+	reservations.notify(ctx, res, WebhookReservationPreempted, "preempted_by_"+by)
+}
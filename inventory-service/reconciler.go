@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"platform"
+)
+
+var (
+	inventoryDrift = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "inventory_drift",
+			Help: "Live reserved counter minus the reserved total implied by the reservation ledger",
+		},
+		[]string{"product_id"},
+	)
+	reconcileCorrections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "inventory_reconcile_corrections_total",
+			Help: "Number of reserved counters corrected by the reconciler",
+		},
+		[]string{"product_id"},
+	)
+)
+
+// Reconciler periodically compares live reserved counters against the
+// ledger and optionally corrects them
+type Reconciler struct {
+	interval    time.Duration
+	autoCorrect bool
+	trigger     chan struct{}
+}
+
+var reconciler *Reconciler
+
+func NewReconciler(interval time.Duration, autoCorrect bool) *Reconciler {
+	return &Reconciler{
+		interval:    interval,
+		autoCorrect: autoCorrect,
+		trigger:     make(chan struct{}, 1),
+	}
+}
+
+func (r *Reconciler) AutoCorrect() bool {
+	return r.autoCorrect
+}
+
+// Trigger requests an immediate reconciliation pass without blocking
+func (r *Reconciler) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Reconciler) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-r.trigger:
+			}
+			func() {
+				defer platform.RecoverPanic(ctx, logger, "reconciler")
+				r.RunOnce(ctx)
+			}()
+		}
+	}()
+}
+
+type driftCorrection struct {
+	productID string
+	total     int
+	reserved  int
+	version   int64
+}
+
+func (r *Reconciler) RunOnce(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "reconcile_inventory")
+	defer span.End()
+
+	var corrections []driftCorrection
+	drifted := 0
+
+	store.mu.Lock()
+	for productID, total := range store.inventory {
+		live := store.reserved[productID]
+		expected := ledger.ExpectedReserved(productID)
+		drift := live - expected
+		inventoryDrift.WithLabelValues(productID).Set(float64(drift))
+
+		if drift == 0 {
+			continue
+		}
+		drifted++
+
+		logger.Warn(ctx, "Inventory drift detected", map[string]interface{}{
+			"product_id":        productID,
+			"live_reserved":     live,
+			"expected_reserved": expected,
+			"drift":             drift,
+			"auto_correct":      r.autoCorrect,
+		})
+
+		if !r.autoCorrect || store.reserved == nil {
+			continue
+		}
+
+		store.reserved[productID] = expected
+		version, _ := store.bumpVersion(productID, nil)
+		reconcileCorrections.WithLabelValues(productID).Inc()
+		inventoryDrift.WithLabelValues(productID).Set(0)
+		corrections = append(corrections, driftCorrection{
+			productID: productID,
+			total:     total,
+			reserved:  expected,
+			version:   version,
+		})
+	}
+	store.mu.Unlock()
+
+	for _, corr := range corrections {
+		emitEvent(ctx, "reconciler", InventoryEvent{
+			Type:      EventReconcile,
+			ProductID: corr.productID,
+			Total:     corr.total,
+			Reserved:  corr.reserved,
+			Version:   corr.version,
+		})
+	}
+
+	span.SetAttributes(
+		attribute.Int("reconcile.drifted_products", drifted),
+		attribute.Int("reconcile.corrections", len(corrections)),
+	)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"platform"
+)
+
+// Webhook events sent to a reservation's callback URL
+const (
+	WebhookReservationExpired  = "reservation.expired"
+	WebhookReservationReleased = "reservation.released"
+)
+
+// Webhook request headers. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with RESERVATION_WEBHOOK_SECRET.
+const (
+	webhookEventHeader     = "X-Inventory-Event"
+	webhookTimestampHeader = "X-Inventory-Timestamp"
+	webhookSignatureHeader = "X-Inventory-Signature"
+)
+
+var reservationWebhooks = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "inventory_service_reservation_webhooks_total",
+		Help: "Number of reservation webhooks sent by event and result",
+	},
+	[]string{"event", "result"},
+)
+
+var errReservationNotFound = errors.New("reservation not found")
+
+// Reservation is a reservation made with a callback URL, a TTL or a
+// priority below checkout. Other reservations aren't tracked individually.
+type Reservation struct {
+	ID          string     `json:"id"`
+	ProductID   string     `json:"product_id"`
+	Quantity    int        `json:"quantity"`
+	Priority    string     `json:"priority"`
+	CallbackURL string     `json:"callback_url,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// ReservationWebhook is the body POSTed to a reservation's callback URL
+type ReservationWebhook struct {
+	Event         string    `json:"event"`
+	ReservationID string    `json:"reservation_id"`
+	ProductID     string    `json:"product_id"`
+	Quantity      int       `json:"quantity"`
+	Reason        string    `json:"reason"`
+	OccurredAt    time.Time `json:"occurred_at"`
+}
+
+// ReservationRegistry holds tracked reservations until they are released,
+// expire, are force-released or are preempted, and notifies their callback
+// URLs of the latter three
+type ReservationRegistry struct {
+	mu           sync.Mutex
+	reservations map[string]*Reservation
+	sequence     atomic.Int64
+	secret       []byte
+	client       *http.Client
+	attempts     int
+}
+
+var reservations = NewReservationRegistryFromEnv()
+
+// NewReservationRegistryFromEnv reads RESERVATION_WEBHOOK_SECRET and
+// RESERVATION_WEBHOOK_ATTEMPTS (default 3)
+func NewReservationRegistryFromEnv() *ReservationRegistry {
+	attempts, err := strconv.Atoi(platform.GetEnv("RESERVATION_WEBHOOK_ATTEMPTS", "3"))
+	if err != nil || attempts <= 0 {
+		attempts = 3
+	}
+	return &ReservationRegistry{
+		reservations: make(map[string]*Reservation),
+		secret:       []byte(platform.Get("RESERVATION_WEBHOOK_SECRET")),
+		client:       platform.NewHTTPClient(logger, 5*time.Second),
+		attempts:     attempts,
+	}
+}
+
+// NewID returns a reservation ID that is unique within this process
+func (r *ReservationRegistry) NewID() string {
+	return fmt.Sprintf("RES-%d-%d", time.Now().Unix(), r.sequence.Add(1))
+}
+
+// validCallbackURL accepts absolute http and https URLs
+func validCallbackURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (r *ReservationRegistry) Add(res Reservation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reservations[res.ID] = &res
+}
+
+func (r *ReservationRegistry) Get(id string) (Reservation, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res, ok := r.reservations[id]
+	if !ok {
+		return Reservation{}, false
+	}
+	return *res, true
+}
+
+// Remove stops tracking a reservation, reporting whether it was tracked
+func (r *ReservationRegistry) Remove(id string) (Reservation, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res, ok := r.reservations[id]
+	if !ok {
+		return Reservation{}, false
+	}
+	delete(r.reservations, id)
+	return *res, true
+}
+
+// takeExpired removes and returns the reservations whose TTL has passed
+func (r *ReservationRegistry) takeExpired(now time.Time) []Reservation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var expired []Reservation
+	for id, res := range r.reservations {
+		if res.ExpiresAt != nil && now.After(*res.ExpiresAt) {
+			expired = append(expired, *res)
+			delete(r.reservations, id)
+		}
+	}
+	return expired
+}
+
+// Start releases expired reservations every interval until ctx is done
+func (r *ReservationRegistry) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, res := range r.takeExpired(time.Now()) {
+					r.expire(ctx, res)
+				}
+			}
+		}
+	}()
+}
+
+func (r *ReservationRegistry) expire(ctx context.Context, res Reservation) {
+	ctx, span := tracer.Start(ctx, "expire_reservation")
+	defer span.End()
+	defer platform.RecoverPanic(ctx, logger, "reservation-expiry")
+	span.SetAttributes(attribute.String("reservation.id", res.ID))
+
+	logger.Warn(ctx, "Reservation expired, releasing stock", map[string]interface{}{
+		"reservation_id": res.ID,
+		"product_id":     res.ProductID,
+		"quantity":       res.Quantity,
+	})
+	releaseReservedStock(ctx, res, "reservation-expiry")
+	r.notify(ctx, res, WebhookReservationExpired, "ttl_elapsed")
+}
+
+// ForceRelease releases a tracked reservation on an operator's behalf and
+// notifies its callback URL
+func (r *ReservationRegistry) ForceRelease(ctx context.Context, id, actor string) (Reservation, error) {
+	res, ok := r.Remove(id)
+	if !ok {
+		return Reservation{}, errReservationNotFound
+	}
+	logger.Warn(ctx, "Reservation force-released", map[string]interface{}{
+		"reservation_id": res.ID,
+		"product_id":     res.ProductID,
+		"quantity":       res.Quantity,
+		"actor":          actor,
+	})
+	releaseReservedStock(ctx, res, actor)
+	r.notify(ctx, res, WebhookReservationReleased, "forced")
+	return res, nil
+}
+
+// releaseReservedStock returns a reservation's stock and records the release
+func releaseReservedStock(ctx context.Context, res Reservation, actor string) {
+	store.mu.Lock()
+	reserved := max(store.reserved[res.ProductID]-res.Quantity, 0)
+	store.reserved[res.ProductID] = reserved
+	total := store.inventory[res.ProductID]
+	version, _ := store.bumpVersion(res.ProductID, nil)
+	store.mu.Unlock()
+
+	emitEvent(ctx, actor, InventoryEvent{
+		Type:      EventRelease,
+		ProductID: res.ProductID,
+		Quantity:  res.Quantity,
+		Total:     total,
+		Reserved:  reserved,
+		Version:   version,
+	})
+}
+
+// notify POSTs the webhook in the background, retrying failures with
+// doubling backoff, so a slow callback never holds up the caller
+func (r *ReservationRegistry) notify(ctx context.Context, res Reservation, event, reason string) {
+	if res.CallbackURL == "" {
+		return
+	}
+	body, err := json.Marshal(ReservationWebhook{
+		Event:         event,
+		ReservationID: res.ID,
+		ProductID:     res.ProductID,
+		Quantity:      res.Quantity,
+		Reason:        reason,
+		OccurredAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		logger.Error(ctx, "Failed to encode reservation webhook", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	// Detached from the request, but in the same trace
+	ctx = trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+	go func() {
+		defer platform.RecoverPanic(ctx, logger, "reservation-webhook")
+		backoff := time.Second
+		for attempt := 1; ; attempt++ {
+			err := r.send(ctx, res.CallbackURL, event, body)
+			if err == nil {
+				reservationWebhooks.WithLabelValues(event, "delivered").Inc()
+				return
+			}
+			if attempt >= r.attempts {
+				reservationWebhooks.WithLabelValues(event, "failed").Inc()
+				logger.Error(ctx, "Reservation webhook failed", map[string]interface{}{
+					"reservation_id": res.ID,
+					"event":          event,
+					"callback_url":   res.CallbackURL,
+					"attempts":       attempt,
+					"error":          err.Error(),
+				})
+				return
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}()
+}
+
+func (r *ReservationRegistry) send(ctx context.Context, callbackURL, event string, body []byte) error {
+	ctx, span := tracer.Start(ctx, "send_reservation_webhook")
+	defer span.End()
+	span.SetAttributes(attribute.String("webhook.event", event))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, event)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	if len(r.secret) > 0 {
+		mac := hmac.New(sha256.New, r.secret)
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		req.Header.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("callback returned status %d", resp.StatusCode)
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+func getReservation(c *gin.Context) {
+	res, ok := reservations.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// forceReleaseReservation releases a tracked reservation's stock and tells
+// the caller that made it through its callback URL
+func forceReleaseReservation(c *gin.Context) {
+	res, err := reservations.ForceRelease(c.Request.Context(), c.Param("id"), requestActor(c))
+	if errors.Is(err, errReservationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "released", "reservation": res})
+}
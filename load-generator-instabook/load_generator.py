@@ -32,7 +32,7 @@ created_sessions = []
 def generate_session_data():
     """Generate random session data for booking."""
     user_ids = [f"user-{i}" for i in range(1, 21)]
-    statuses = ["pending", "confirmed", "processing"]
+    statuses = ["pending", "confirmed", "completed"]
     booking_types = ["flight", "hotel", "car", "package"]
 
     return {
@@ -0,0 +1,607 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"platform"
+)
+
+// Fault types. latency, error and panic apply to matching requests;
+// partial_failure fails some items of a batch request that otherwise
+// succeeds; memory_leak and cpu_burn run in the background while enabled.
+const (
+	FaultLatency        = "latency"
+	FaultError          = "error"
+	FaultPanic          = "panic"
+	FaultPartialFailure = "partial_failure"
+	FaultMemoryLeak     = "memory_leak"
+	FaultCPUBurn        = "cpu_burn"
+)
+
+// Latency distributions. fixed waits delay_ms plus up to jitter_ms; uniform
+// picks between delay_ms and max_delay_ms; pareto has a heavy tail starting
+// at delay_ms, capped at max_delay_ms.
+const (
+	DistributionFixed   = "fixed"
+	DistributionUniform = "uniform"
+	DistributionPareto  = "pareto"
+)
+
+var (
+	chaosInjections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "chaos_injections_total",
+			Help: "Number of requests affected by an injected fault",
+		},
+		[]string{"fault", "type"},
+	)
+	chaosActiveFaults = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "chaos_active_faults",
+			Help: "Number of enabled faults by type",
+		},
+		[]string{"type"},
+	)
+)
+
+// Fault is a named fault and its parameters. Unset parameters take the
+// defaults applied by validate.
+type Fault struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Route limits request faults to "METHOD /route/:param"; empty matches
+	// every route
+	Route string `json:"route,omitempty"`
+	// Probability is the fraction of matching requests affected (default 1)
+	Probability float64 `json:"probability,omitempty"`
+
+	DelayMs    int `json:"delay_ms,omitempty"`
+	JitterMs   int `json:"jitter_ms,omitempty"`
+	StatusCode int `json:"status_code,omitempty"`
+
+	// partial_failure fails each item of an affected batch with
+	// ItemProbability (default 0.5), failing at most MaxItems (0 for no
+	// limit) with StatusCode (default 503)
+	ItemProbability float64 `json:"item_probability,omitempty"`
+	MaxItems        int     `json:"max_items,omitempty"`
+
+	// latency draws each delay from Distribution (default fixed). Shape is
+	// the pareto tail index; lower values give a heavier tail.
+	Distribution string  `json:"distribution,omitempty"`
+	MaxDelayMs   int     `json:"max_delay_ms,omitempty"`
+	Shape        float64 `json:"shape,omitempty"`
+
+	// memory_leak allocates MemoryMB every Interval up to MaxMemoryMB
+	MemoryMB    int    `json:"memory_mb,omitempty"`
+	MaxMemoryMB int    `json:"max_memory_mb,omitempty"`
+	Interval    string `json:"interval,omitempty"`
+
+	// cpu_burn keeps Cores goroutines busy for Percent of the time
+	Cores   int `json:"cores,omitempty"`
+	Percent int `json:"percent,omitempty"`
+
+	// Duration disables the fault automatically, e.g. "5m"
+	Duration  string     `json:"duration,omitempty"`
+	Source    string     `json:"source"`
+	EnabledAt time.Time  `json:"enabled_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func (f *Fault) validate() error {
+	if f.Name == "" {
+		return errors.New("name is required")
+	}
+	if f.Probability == 0 {
+		f.Probability = 1
+	}
+	if f.Probability < 0 || f.Probability > 1 {
+		return errors.New("probability must be between 0 and 1")
+	}
+	if f.Route != "" {
+		if len(strings.Fields(f.Route)) != 2 {
+			return fmt.Errorf("route must look like \"GET /path\", got %q", f.Route)
+		}
+		f.Route = strings.Join(strings.Fields(f.Route), " ")
+	}
+	if f.Duration != "" {
+		if err := validDuration(f.Duration); err != nil {
+			return fmt.Errorf("duration: %w", err)
+		}
+	}
+
+	switch f.Type {
+	case FaultLatency:
+		if f.Distribution == "" {
+			f.Distribution = DistributionFixed
+		}
+		switch f.Distribution {
+		case DistributionFixed:
+			if f.DelayMs <= 0 {
+				return errors.New("delay_ms must be positive")
+			}
+		case DistributionUniform:
+			if f.DelayMs < 0 || f.MaxDelayMs <= f.DelayMs {
+				return errors.New("uniform latency needs 0 <= delay_ms < max_delay_ms")
+			}
+		case DistributionPareto:
+			if f.DelayMs <= 0 {
+				return errors.New("delay_ms must be positive")
+			}
+			if f.Shape == 0 {
+				f.Shape = 1.5
+			}
+			if f.Shape < 0 {
+				return errors.New("shape must be positive")
+			}
+			if f.MaxDelayMs == 0 {
+				f.MaxDelayMs = 10 * f.DelayMs
+			}
+			if f.MaxDelayMs < f.DelayMs {
+				return errors.New("max_delay_ms must be at least delay_ms")
+			}
+		default:
+			return fmt.Errorf("unknown distribution %q", f.Distribution)
+		}
+	case FaultError:
+		if f.StatusCode == 0 {
+			f.StatusCode = http.StatusInternalServerError
+		}
+		if f.StatusCode < 400 || f.StatusCode > 599 {
+			return errors.New("status_code must be between 400 and 599")
+		}
+	case FaultPanic:
+	case FaultPartialFailure:
+		if f.ItemProbability == 0 {
+			f.ItemProbability = 0.5
+		}
+		if f.ItemProbability < 0 || f.ItemProbability > 1 {
+			return errors.New("item_probability must be between 0 and 1")
+		}
+		if f.MaxItems < 0 {
+			return errors.New("max_items must not be negative")
+		}
+		if f.StatusCode == 0 {
+			f.StatusCode = http.StatusServiceUnavailable
+		}
+		if f.StatusCode < 400 || f.StatusCode > 599 {
+			return errors.New("status_code must be between 400 and 599")
+		}
+	case FaultMemoryLeak:
+		if f.MemoryMB <= 0 {
+			f.MemoryMB = 10
+		}
+		if f.MaxMemoryMB <= 0 {
+			f.MaxMemoryMB = 512
+		}
+		if f.Interval == "" {
+			f.Interval = "1s"
+		}
+		if d, err := time.ParseDuration(f.Interval); err != nil || d <= 0 {
+			return errors.New("interval must be a positive duration")
+		}
+	case FaultCPUBurn:
+		if f.Cores <= 0 {
+			f.Cores = 1
+		}
+		if f.Cores > runtime.NumCPU() {
+			f.Cores = runtime.NumCPU()
+		}
+		if f.Percent == 0 {
+			f.Percent = 100
+		}
+		if f.Percent < 1 || f.Percent > 100 {
+			return errors.New("percent must be between 1 and 100")
+		}
+	default:
+		return fmt.Errorf("unknown fault type %q", f.Type)
+	}
+	return nil
+}
+
+// delay draws a delay for a latency fault from its distribution
+func (f *Fault) delay() time.Duration {
+	ms := float64(f.DelayMs)
+	switch f.Distribution {
+	case DistributionUniform:
+		ms += rand.Float64() * float64(f.MaxDelayMs-f.DelayMs)
+	case DistributionPareto:
+		// Inverse transform sampling; 1-Float64 is in (0, 1]
+		ms = math.Min(ms/math.Pow(1-rand.Float64(), 1/f.Shape), float64(f.MaxDelayMs))
+	default:
+		if f.JitterMs > 0 {
+			ms += float64(rand.Intn(f.JitterMs))
+		}
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+func (f *Fault) matches(method, route string) bool {
+	switch f.Type {
+	case FaultLatency, FaultError, FaultPanic:
+	default:
+		return false
+	}
+	return f.Route == "" || f.Route == method+" "+route
+}
+
+type activeFault struct {
+	Fault
+	stop context.CancelFunc
+}
+
+// ChaosController holds the enabled faults. Faults come from the /chaos API
+// or from CHAOS_FAULTS in the config, which is re-applied on every reload.
+type ChaosController struct {
+	mu     sync.RWMutex
+	faults map[string]*activeFault
+}
+
+var chaos = &ChaosController{faults: make(map[string]*activeFault)}
+
+// parseChaosFaults reads CHAOS_FAULTS, a JSON array of faults
+func parseChaosFaults(value string) ([]Fault, error) {
+	var faults []Fault
+	if value == "" {
+		return faults, nil
+	}
+	if err := json.Unmarshal([]byte(value), &faults); err != nil {
+		return nil, err
+	}
+	for i := range faults {
+		if err := faults[i].validate(); err != nil {
+			return nil, fmt.Errorf("fault %d: %w", i, err)
+		}
+	}
+	return faults, nil
+}
+
+func validChaosFaults(value string) error {
+	_, err := parseChaosFaults(value)
+	return err
+}
+
+// StartChaosFromConfig enables the faults in CHAOS_FAULTS and keeps them in
+// step with the config on every reload
+func StartChaosFromConfig() {
+	apply := func() {
+		faults, err := parseChaosFaults(config.Get("CHAOS_FAULTS"))
+		if err != nil {
+			// Validated with the rest of the config, so this shouldn't happen
+			logger.Error(context.Background(), "Invalid CHAOS_FAULTS", map[string]interface{}{"error": err.Error()})
+			return
+		}
+		chaos.replaceSource("config", faults)
+	}
+	apply()
+	config.OnReload(apply)
+}
+
+// Enable starts f, replacing any fault with the same name
+func (cc *ChaosController) Enable(f Fault) error {
+	if err := f.validate(); err != nil {
+		return err
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.enableLocked(f)
+	return nil
+}
+
+func (cc *ChaosController) enableLocked(f Fault) {
+	cc.disableLocked(f.Name)
+
+	f.EnabledAt = time.Now()
+	f.ExpiresAt = nil
+	var ctx context.Context
+	var stop context.CancelFunc
+	if f.Duration != "" {
+		d, _ := time.ParseDuration(f.Duration)
+		expires := f.EnabledAt.Add(d)
+		f.ExpiresAt = &expires
+		ctx, stop = context.WithDeadline(context.Background(), expires)
+		go cc.expire(ctx, f.Name, f.EnabledAt)
+	} else {
+		ctx, stop = context.WithCancel(context.Background())
+	}
+
+	cc.faults[f.Name] = &activeFault{Fault: f, stop: stop}
+	chaosActiveFaults.WithLabelValues(f.Type).Inc()
+
+	switch f.Type {
+	case FaultMemoryLeak:
+		go leakMemory(ctx, f)
+	case FaultCPUBurn:
+		for i := 0; i < f.Cores; i++ {
+			go burnCPU(ctx, f.Percent)
+		}
+	}
+
+	logger.Warn(context.Background(), "Fault enabled", map[string]interface{}{
+		"fault":  f.Name,
+		"type":   f.Type,
+		"route":  f.Route,
+		"source": f.Source,
+	})
+}
+
+// expire disables the fault when its deadline passes, unless it has been
+// re-enabled since
+func (cc *ChaosController) expire(ctx context.Context, name string, enabledAt time.Time) {
+	<-ctx.Done()
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if f, ok := cc.faults[name]; ok && f.EnabledAt.Equal(enabledAt) {
+		cc.disableLocked(name)
+	}
+}
+
+// Disable stops the named fault, returning false if it wasn't enabled
+func (cc *ChaosController) Disable(name string) bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.disableLocked(name)
+}
+
+func (cc *ChaosController) disableLocked(name string) bool {
+	f, ok := cc.faults[name]
+	if !ok {
+		return false
+	}
+	f.stop()
+	delete(cc.faults, name)
+	chaosActiveFaults.WithLabelValues(f.Type).Dec()
+
+	logger.Info(context.Background(), "Fault disabled", map[string]interface{}{
+		"fault": name,
+		"type":  f.Type,
+	})
+	return true
+}
+
+// DisableAll stops every fault and returns how many were enabled
+func (cc *ChaosController) DisableAll() int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	n := len(cc.faults)
+	for name := range cc.faults {
+		cc.disableLocked(name)
+	}
+	return n
+}
+
+// replaceSource swaps the faults that came from source for faults
+func (cc *ChaosController) replaceSource(source string, faults []Fault) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	for name, f := range cc.faults {
+		if f.Source == source {
+			cc.disableLocked(name)
+		}
+	}
+	for _, f := range faults {
+		f.Source = source
+		cc.enableLocked(f)
+	}
+}
+
+// List returns the enabled faults sorted by name
+func (cc *ChaosController) List() []Fault {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	faults := make([]Fault, 0, len(cc.faults))
+	for _, f := range cc.faults {
+		faults = append(faults, f.Fault)
+	}
+	sort.Slice(faults, func(i, j int) bool { return faults[i].Name < faults[j].Name })
+	return faults
+}
+
+func (cc *ChaosController) requestFaults(method, route string) []Fault {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	var faults []Fault
+	for _, f := range cc.faults {
+		if f.matches(method, route) && rand.Float64() < f.Probability {
+			faults = append(faults, f.Fault)
+		}
+	}
+	// Delays go first so an injected error still arrives late
+	sort.Slice(faults, func(i, j int) bool {
+		return faults[i].Type == FaultLatency && faults[j].Type != FaultLatency
+	})
+	return faults
+}
+
+// itemFailer decides which items of one batch request fail. A nil
+// itemFailer fails nothing.
+type itemFailer struct {
+	faults []Fault
+	failed map[string]int
+}
+
+// ItemFailure is one item a partial_failure fault failed, as batch
+// endpoints report it
+type ItemFailure struct {
+	ID     string `json:"id"`
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+// batchFaults returns the partial_failure faults affecting this request
+// to a batch endpoint, or nil when there are none
+func (cc *ChaosController) batchFaults(method, route string) *itemFailer {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	var faults []Fault
+	for _, f := range cc.faults {
+		if f.Type == FaultPartialFailure && (f.Route == "" || f.Route == method+" "+route) && rand.Float64() < f.Probability {
+			faults = append(faults, f.Fault)
+		}
+	}
+	if len(faults) == 0 {
+		return nil
+	}
+	sort.Slice(faults, func(i, j int) bool { return faults[i].Name < faults[j].Name })
+	return &itemFailer{faults: faults, failed: make(map[string]int)}
+}
+
+// fail reports whether the item id should fail, and how
+func (b *itemFailer) fail(id string) (ItemFailure, bool) {
+	if b == nil {
+		return ItemFailure{}, false
+	}
+	for _, f := range b.faults {
+		if f.MaxItems > 0 && b.failed[f.Name] >= f.MaxItems {
+			continue
+		}
+		if rand.Float64() < f.ItemProbability {
+			b.failed[f.Name]++
+			chaosInjections.WithLabelValues(f.Name, f.Type).Inc()
+			return ItemFailure{ID: id, Status: f.StatusCode, Error: fmt.Sprintf("injected failure (fault %s)", f.Name)}, true
+		}
+	}
+	return ItemFailure{}, false
+}
+
+// leakMemory holds on to a growing set of allocations until ctx is done
+func leakMemory(ctx context.Context, f Fault) {
+	interval, _ := time.ParseDuration(f.Interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var leaked [][]byte
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if len(leaked)*f.MemoryMB >= f.MaxMemoryMB {
+				continue
+			}
+			chunk := make([]byte, f.MemoryMB<<20)
+			// Touch every page so the memory is actually resident
+			for i := 0; i < len(chunk); i += 4096 {
+				chunk[i] = 1
+			}
+			leaked = append(leaked, chunk)
+		}
+	}
+}
+
+// burnCPU spins for percent of every 100ms until ctx is done
+func burnCPU(ctx context.Context, percent int) {
+	busy := time.Duration(percent) * time.Millisecond
+	idle := 100*time.Millisecond - busy
+	for {
+		deadline := time.Now().Add(busy)
+		for time.Now().Before(deadline) {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(idle):
+		}
+	}
+}
+
+// chaosMiddleware applies the enabled request faults. Health, metrics,
+// config reloads, the admin endpoints and the chaos API itself are never
+// affected.
+func chaosMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if path == "/health" || path == "/readyz" || path == "/metrics" || path == "/config/reload" || strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "/chaos") {
+			c.Next()
+			return
+		}
+
+		for _, f := range chaos.requestFaults(c.Request.Method, c.FullPath()) {
+			chaosInjections.WithLabelValues(f.Name, f.Type).Inc()
+			switch f.Type {
+			case FaultLatency:
+				select {
+				case <-c.Request.Context().Done():
+				case <-time.After(f.delay()):
+				}
+			case FaultError:
+				c.AbortWithStatusJSON(f.StatusCode, gin.H{"error": http.StatusText(f.StatusCode)})
+				return
+			case FaultPanic:
+				panic(fmt.Sprintf("injected panic (fault %s)", f.Name))
+			}
+		}
+		c.Next()
+	}
+}
+
+// chaosAuthMiddleware requires CHAOS_TOKEN as a Bearer token when it is set
+func chaosAuthMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.Next()
+			return
+		}
+		got, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// registerChaosRoutes mounts the /chaos API when CHAOS_ENABLED=true
+func registerChaosRoutes(router gin.IRouter) {
+	if config.Get("CHAOS_ENABLED") != "true" {
+		return
+	}
+
+	group := router.Group("/chaos", chaosAuthMiddleware(config.Get("CHAOS_TOKEN")))
+	group.GET("/faults", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"faults": chaos.List()})
+	})
+	group.POST("/faults", func(c *gin.Context) {
+		var f Fault
+		if err := c.ShouldBindJSON(&f); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fault"})
+			return
+		}
+		f.Source = "api"
+		if err := chaos.Enable(f); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		platform.RecordAudit(c, "chaos.enable", map[string]interface{}{"name": f.Name, "type": f.Type, "route": f.Route})
+		c.JSON(http.StatusCreated, gin.H{"faults": chaos.List()})
+	})
+	group.DELETE("/faults/:name", func(c *gin.Context) {
+		if !chaos.Disable(c.Param("name")) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Fault not found"})
+			return
+		}
+		platform.RecordAudit(c, "chaos.disable", map[string]interface{}{"name": c.Param("name")})
+		c.Status(http.StatusNoContent)
+	})
+	group.DELETE("/faults", func(c *gin.Context) {
+		disabled := chaos.DisableAll()
+		platform.RecordAudit(c, "chaos.disable_all", map[string]interface{}{"disabled": disabled})
+		c.JSON(http.StatusOK, gin.H{"disabled": disabled})
+	})
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"platform"
+)
+
+// Reconnect backoff for event streams, doubling from the minimum
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+var (
+	eventsReceived = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_service_events_received_total",
+			Help: "Number of events read from each source stream by type",
+		},
+		[]string{"source", "type"},
+	)
+	streamConnected = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "notification_service_stream_connected",
+			Help: "Whether the event stream from each source is connected (1) or not (0)",
+		},
+		[]string{"source"},
+	)
+	streamReconnects = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_service_stream_reconnects_total",
+			Help: "Number of times each source stream was lost and reconnected",
+		},
+		[]string{"source"},
+	)
+)
+
+// EventSource is a server-sent event stream the service consumes
+type EventSource struct {
+	Name string
+	URL  string
+}
+
+// EventSourcesFromEnv returns the inventory-service and instabook streams,
+// skipping a source whose base URL is set to empty
+func EventSourcesFromEnv() []EventSource {
+	var sources []EventSource
+	if url := platform.GetEnv("INVENTORY_SERVICE", "http://localhost:8085"); url != "" {
+		sources = append(sources, EventSource{Name: "inventory", URL: url + "/inventory/events"})
+	}
+	if url := platform.GetEnv("INSTABOOK_SERVICE", "http://localhost:8087"); url != "" {
+		sources = append(sources, EventSource{Name: "booking", URL: url + "/booking/events"})
+	}
+	return sources
+}
+
+// consumeEvents reads the source's stream until ctx is done, reconnecting
+// with backoff whenever it drops. Events published while disconnected are
+// missed; the streams don't replay.
+func consumeEvents(ctx context.Context, source EventSource) {
+	delay := minReconnectDelay
+	for {
+		connected, err := readStream(ctx, source)
+		streamConnected.WithLabelValues(source.Name).Set(0)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			delay = minReconnectDelay
+			streamReconnects.WithLabelValues(source.Name).Inc()
+		}
+
+		fields := map[string]interface{}{
+			"source":   source.Name,
+			"url":      source.URL,
+			"retry_in": delay.String(),
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		}
+		logger.Warn(ctx, "Event stream disconnected", fields)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// readStream holds one connection to the source open, handling events as
+// they arrive. connected reports whether the stream was established.
+func readStream(ctx context.Context, source EventSource) (connected bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", source.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("X-Actor", "notification-service")
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("stream returned %d", resp.StatusCode)
+	}
+
+	streamConnected.WithLabelValues(source.Name).Set(1)
+	logger.Info(ctx, "Event stream connected", map[string]interface{}{
+		"source": source.Name,
+		"url":    source.URL,
+	})
+
+	var eventType string
+	var data bytes.Buffer
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// A blank line ends the event
+			if data.Len() > 0 {
+				handleEvent(source.Name, eventType, data.Bytes())
+			}
+			eventType = ""
+			data.Reset()
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// handleEvent turns one stream event into notifications. Each event gets
+// its own trace; the trace of the request that caused it is kept as the
+// source.trace_id attribute.
+func handleEvent(source, eventType string, data []byte) {
+	if eventType == "heartbeat" {
+		return
+	}
+	eventsReceived.WithLabelValues(source, eventType).Inc()
+
+	var event map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Keep integers as written rather than as floats in rendered templates
+	decoder.UseNumber()
+	if err := decoder.Decode(&event); err != nil {
+		logger.Warn(context.Background(), "Invalid event on stream", map[string]interface{}{
+			"source": source,
+			"type":   eventType,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	ctx, span := tracer.Start(context.Background(), "notification.consume")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("event.source", source),
+		attribute.String("event.type", eventType),
+	)
+	if traceID, ok := event["trace_id"].(string); ok {
+		span.SetAttributes(attribute.String("source.trace_id", traceID))
+	}
+
+	notify(ctx, source, eventType, event)
+}
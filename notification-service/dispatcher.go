@@ -0,0 +1,486 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"platform"
+)
+
+// Notification statuses. A notification is pending until its first
+// attempt, retrying between failed attempts, and dead_lettered once it runs
+// out of attempts; POST /notifications/:id/retry sends it round again.
+const (
+	StatusPending      = "pending"
+	StatusRetrying     = "retrying"
+	StatusDelivered    = "delivered"
+	StatusDeadLettered = "dead_lettered"
+)
+
+// maxNotifications bounds the in-memory delivery history; the oldest
+// notifications are forgotten first
+const maxNotifications = 10000
+
+// maxRetryBackoff caps the doubling delay between attempts
+const maxRetryBackoff = 5 * time.Minute
+
+var (
+	ErrNotificationNotFound = errors.New("notification not found")
+	ErrNotDeadLettered      = errors.New("notification is not dead-lettered")
+)
+
+var (
+	notificationsCreated = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_service_notifications_total",
+			Help: "Number of notifications created by template and channel",
+		},
+		[]string{"template", "channel"},
+	)
+	deliveryAttempts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_service_delivery_attempts_total",
+			Help: "Number of delivery attempts by channel and result",
+		},
+		[]string{"channel", "result"},
+	)
+	deliveryDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "notification_service_delivery_duration_seconds",
+			Help:    "Duration of each delivery attempt by channel",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"channel"},
+	)
+	deadLetters = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_service_dead_letters_total",
+			Help: "Number of notifications moved to the dead-letter queue by channel",
+		},
+		[]string{"channel"},
+	)
+	dlqSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "notification_service_dlq_size",
+		Help: "Number of notifications in the dead-letter queue",
+	})
+	queueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "notification_service_queue_depth",
+		Help: "Number of notifications waiting for a delivery worker",
+	})
+	renderErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_service_render_errors_total",
+			Help: "Number of events whose template failed to render",
+		},
+		[]string{"template"},
+	)
+)
+
+// Attempt records one delivery attempt
+type Attempt struct {
+	Number     int       `json:"number"`
+	At         time.Time `json:"at"`
+	DurationMs float64   `json:"duration_ms"`
+	Result     string    `json:"result"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Notification is a rendered template on its way to one channel
+type Notification struct {
+	ID            string                 `json:"id"`
+	Template      string                 `json:"template"`
+	Channel       string                 `json:"channel"`
+	Source        string                 `json:"source"`
+	EventType     string                 `json:"event_type"`
+	Subject       string                 `json:"subject"`
+	Body          string                 `json:"body"`
+	Event         map[string]interface{} `json:"event"`
+	Status        string                 `json:"status"`
+	Attempts      []Attempt              `json:"attempts"`
+	NextAttemptAt *time.Time             `json:"next_attempt_at,omitempty"`
+	TraceID       string                 `json:"trace_id,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+
+	// attemptsLeft is the remaining budget for the current round
+	attemptsLeft int
+}
+
+// Dispatcher delivers notifications on a pool of workers, retrying failed
+// attempts with exponential backoff before dead-lettering them
+type Dispatcher struct {
+	mu            sync.RWMutex
+	notifications map[string]*Notification
+	order         []string
+
+	sinks       map[string]Sink
+	queue       chan string
+	maxAttempts int
+	backoff     time.Duration
+	timeout     time.Duration
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+var dispatcher *Dispatcher
+
+// NewDispatcherFromEnv reads NOTIFY_MAX_ATTEMPTS (default 5),
+// NOTIFY_RETRY_BACKOFF (default 1s), NOTIFY_TIMEOUT (default 10s),
+// NOTIFY_WORKERS (default 4) and NOTIFY_QUEUE_SIZE (default 1000)
+func NewDispatcherFromEnv(sinks []Sink) *Dispatcher {
+	d := &Dispatcher{
+		notifications: make(map[string]*Notification),
+		sinks:         make(map[string]Sink, len(sinks)),
+		queue:         make(chan string, envInt("NOTIFY_QUEUE_SIZE", 1000)),
+		maxAttempts:   envInt("NOTIFY_MAX_ATTEMPTS", 5),
+		backoff:       envDuration("NOTIFY_RETRY_BACKOFF", time.Second),
+		timeout:       envDuration("NOTIFY_TIMEOUT", 10*time.Second),
+		done:          make(chan struct{}),
+	}
+	for _, sink := range sinks {
+		d.sinks[sink.Channel()] = sink
+	}
+
+	for i := 0; i < envInt("NOTIFY_WORKERS", 4); i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+	return d
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(config.Get(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(config.Get(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
+
+// Channels lists the configured delivery channels
+func (d *Dispatcher) Channels() []string {
+	channels := make([]string, 0, len(d.sinks))
+	for channel := range d.sinks {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// Close stops the workers once their current attempts finish. Queued and
+// retrying notifications are not delivered.
+func (d *Dispatcher) Close() {
+	d.closeOnce.Do(func() { close(d.done) })
+	d.wg.Wait()
+}
+
+// Submit stores a notification and queues its first attempt
+func (d *Dispatcher) Submit(ctx context.Context, n *Notification) {
+	now := time.Now()
+	n.ID = newID("ntf-")
+	n.Status = StatusPending
+	n.Attempts = []Attempt{}
+	n.CreatedAt = now
+	n.UpdatedAt = now
+	n.attemptsLeft = d.maxAttempts
+	if sc := trace.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		n.TraceID = sc.TraceID().String()
+	}
+
+	d.mu.Lock()
+	d.notifications[n.ID] = n
+	d.order = append(d.order, n.ID)
+	for len(d.order) > maxNotifications {
+		if old, ok := d.notifications[d.order[0]]; ok && old.Status == StatusDeadLettered {
+			dlqSize.Dec()
+		}
+		delete(d.notifications, d.order[0])
+		d.order = d.order[1:]
+	}
+	d.mu.Unlock()
+
+	notificationsCreated.WithLabelValues(n.Template, n.Channel).Inc()
+	d.enqueue(ctx, n.ID)
+}
+
+// enqueue hands the notification to a worker. A full queue dead-letters it
+// straight away rather than blocking the event stream.
+func (d *Dispatcher) enqueue(ctx context.Context, id string) {
+	select {
+	case d.queue <- id:
+		queueDepth.Inc()
+	default:
+		logger.Warn(ctx, "Notification queue full", map[string]interface{}{"notification_id": id})
+		d.update(id, func(n *Notification) {
+			d.deadLetter(n, "queue full")
+		})
+	}
+}
+
+// Depth is the number of notifications waiting for a delivery worker
+func (d *Dispatcher) Depth() int {
+	return len(d.queue)
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.done:
+			return
+		case id := <-d.queue:
+			queueDepth.Dec()
+			d.attempt(id)
+		}
+	}
+}
+
+// attempt makes one delivery attempt and schedules the next on failure
+func (d *Dispatcher) attempt(id string) {
+	defer platform.RecoverPanic(context.Background(), logger, "notification-delivery")
+	d.mu.RLock()
+	n, ok := d.notifications[id]
+	var snapshot Notification
+	if ok {
+		snapshot = *n
+	}
+	d.mu.RUnlock()
+	if !ok {
+		return
+	}
+	sink, ok := d.sinks[snapshot.Channel]
+	if !ok {
+		d.update(id, func(n *Notification) { d.deadLetter(n, "no sink for channel "+n.Channel) })
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	ctx, span := tracer.Start(ctx, "notification.deliver")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("notification.id", id),
+		attribute.String("notification.channel", snapshot.Channel),
+		attribute.String("notification.template", snapshot.Template),
+		attribute.Int("notification.attempt", len(snapshot.Attempts)+1),
+	)
+
+	start := time.Now()
+	err := sink.Deliver(ctx, &snapshot)
+	duration := time.Since(start)
+	deliveryDuration.WithLabelValues(snapshot.Channel).Observe(duration.Seconds())
+
+	result := "delivered"
+	if err != nil {
+		result = "failed"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	deliveryAttempts.WithLabelValues(snapshot.Channel, result).Inc()
+
+	var retryIn time.Duration
+	d.update(id, func(n *Notification) {
+		a := Attempt{
+			Number:     len(n.Attempts) + 1,
+			At:         start,
+			DurationMs: float64(duration.Microseconds()) / 1000,
+			Result:     result,
+		}
+		if err != nil {
+			a.Error = err.Error()
+		}
+		n.Attempts = append(n.Attempts, a)
+		n.attemptsLeft--
+		n.NextAttemptAt = nil
+
+		switch {
+		case err == nil:
+			n.Status = StatusDelivered
+		case n.attemptsLeft <= 0:
+			d.deadLetter(n, err.Error())
+		default:
+			// 1x, 2x, 4x... the base backoff within the current round
+			used := d.maxAttempts - n.attemptsLeft
+			retryIn = d.backoff << (used - 1)
+			if retryIn > maxRetryBackoff || retryIn <= 0 {
+				retryIn = maxRetryBackoff
+			}
+			next := time.Now().Add(retryIn)
+			n.Status = StatusRetrying
+			n.NextAttemptAt = &next
+		}
+	})
+
+	fields := map[string]interface{}{
+		"notification_id": id,
+		"channel":         snapshot.Channel,
+		"template":        snapshot.Template,
+		"attempt":         len(snapshot.Attempts) + 1,
+		"duration_ms":     float64(duration.Microseconds()) / 1000,
+	}
+	if err == nil {
+		logger.Info(ctx, "Notification delivered", fields)
+		return
+	}
+	fields["error"] = err.Error()
+	logger.Warn(ctx, "Notification delivery failed", fields)
+
+	if retryIn > 0 {
+		time.AfterFunc(retryIn, func() {
+			select {
+			case <-d.done:
+			default:
+				d.enqueue(context.Background(), id)
+			}
+		})
+	}
+}
+
+// deadLetter moves n to the dead-letter queue; the caller holds d.mu
+func (d *Dispatcher) deadLetter(n *Notification, reason string) {
+	if n.Status == StatusDeadLettered {
+		return
+	}
+	n.Status = StatusDeadLettered
+	n.NextAttemptAt = nil
+	n.UpdatedAt = time.Now()
+	deadLetters.WithLabelValues(n.Channel).Inc()
+	dlqSize.Inc()
+	logger.Error(context.Background(), "Notification dead-lettered", map[string]interface{}{
+		"notification_id": n.ID,
+		"channel":         n.Channel,
+		"template":        n.Template,
+		"attempts":        len(n.Attempts),
+		"reason":          reason,
+	})
+}
+
+// update applies fn to the notification under the dispatcher's lock
+func (d *Dispatcher) update(id string, fn func(*Notification)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if n, ok := d.notifications[id]; ok {
+		fn(n)
+		n.UpdatedAt = time.Now()
+	}
+}
+
+// Retry gives a dead-lettered notification a fresh round of attempts
+func (d *Dispatcher) Retry(ctx context.Context, id string) (Notification, error) {
+	d.mu.Lock()
+	n, ok := d.notifications[id]
+	if !ok {
+		d.mu.Unlock()
+		return Notification{}, ErrNotificationNotFound
+	}
+	if n.Status != StatusDeadLettered {
+		d.mu.Unlock()
+		return Notification{}, ErrNotDeadLettered
+	}
+	n.Status = StatusPending
+	n.attemptsLeft = d.maxAttempts
+	n.UpdatedAt = time.Now()
+	dlqSize.Dec()
+	copied := cloneNotification(n)
+	d.mu.Unlock()
+
+	d.enqueue(ctx, id)
+	return copied, nil
+}
+
+// Get returns a copy so callers can't race with a delivery worker
+func (d *Dispatcher) Get(id string) (Notification, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	n, ok := d.notifications[id]
+	if !ok {
+		return Notification{}, false
+	}
+	return cloneNotification(n), true
+}
+
+// List returns up to limit notifications, newest first, filtered by status
+// and template when those are non-empty
+func (d *Dispatcher) List(status, templateName string, limit int) []Notification {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	result := []Notification{}
+	for i := len(d.order) - 1; i >= 0 && len(result) < limit; i-- {
+		n := d.notifications[d.order[i]]
+		if (status != "" && n.Status != status) || (templateName != "" && n.Template != templateName) {
+			continue
+		}
+		result = append(result, cloneNotification(n))
+	}
+	return result
+}
+
+func cloneNotification(n *Notification) Notification {
+	copied := *n
+	copied.Attempts = append([]Attempt{}, n.Attempts...)
+	if n.NextAttemptAt != nil {
+		next := *n.NextAttemptAt
+		copied.NextAttemptAt = &next
+	}
+	return copied
+}
+
+func newID(prefix string) string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// notify renders the template for an event and submits one notification
+// per configured channel
+func notify(ctx context.Context, source, eventType string, event map[string]interface{}) {
+	name := source + "." + eventType
+	if !templates.Has(name) {
+		return
+	}
+
+	subject, body, err := templates.Render(name, event)
+	if err != nil {
+		logger.Error(ctx, "Failed to render notification", map[string]interface{}{
+			"template": name,
+			"error":    err.Error(),
+		})
+		renderErrors.WithLabelValues(name).Inc()
+		return
+	}
+
+	for _, channel := range dispatcher.Channels() {
+		n := &Notification{
+			Template:  name,
+			Channel:   channel,
+			Source:    source,
+			EventType: eventType,
+			Subject:   subject,
+			Body:      body,
+			Event:     event,
+		}
+		dispatcher.Submit(ctx, n)
+		logger.Info(ctx, "Notification queued", map[string]interface{}{
+			"notification_id": n.ID,
+			"template":        name,
+			"channel":         channel,
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxListLimit caps the number of notifications a list request returns
+const maxListLimit = 500
+
+// listLimit reads ?limit=, defaulting to 50
+func listLimit(c *gin.Context) (int, bool) {
+	v := c.Query("limit")
+	if v == "" {
+		return 50, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	if n > maxListLimit {
+		n = maxListLimit
+	}
+	return n, true
+}
+
+// listNotifications returns recent notifications, newest first, filtered by
+// status and template
+func listNotifications(c *gin.Context) {
+	start := time.Now()
+
+	limit, ok := listLimit(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		recordRequest("GET", "/notifications", http.StatusBadRequest, start)
+		return
+	}
+	items := dispatcher.List(c.Query("status"), c.Query("template"), limit)
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+	recordRequest("GET", "/notifications", http.StatusOK, start)
+}
+
+// listDeadLetters returns the dead-letter queue, newest first
+func listDeadLetters(c *gin.Context) {
+	start := time.Now()
+
+	limit, ok := listLimit(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		recordRequest("GET", "/notifications/dlq", http.StatusBadRequest, start)
+		return
+	}
+	items := dispatcher.List(StatusDeadLettered, c.Query("template"), limit)
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": len(items)})
+	recordRequest("GET", "/notifications/dlq", http.StatusOK, start)
+}
+
+func getNotification(c *gin.Context) {
+	start := time.Now()
+
+	n, ok := dispatcher.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		recordRequest("GET", "/notifications/:id", http.StatusNotFound, start)
+		return
+	}
+	c.JSON(http.StatusOK, n)
+	recordRequest("GET", "/notifications/:id", http.StatusOK, start)
+}
+
+// getAttempts returns just the delivery attempts of a notification
+func getAttempts(c *gin.Context) {
+	start := time.Now()
+
+	n, ok := dispatcher.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		recordRequest("GET", "/notifications/:id/attempts", http.StatusNotFound, start)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":              n.ID,
+		"status":          n.Status,
+		"attempts":        n.Attempts,
+		"next_attempt_at": n.NextAttemptAt,
+	})
+	recordRequest("GET", "/notifications/:id/attempts", http.StatusOK, start)
+}
+
+// retryNotification takes a notification out of the dead-letter queue for a
+// fresh round of attempts
+func retryNotification(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+
+	n, err := dispatcher.Retry(ctx, c.Param("id"))
+	switch {
+	case errors.Is(err, ErrNotificationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		recordRequest("POST", "/notifications/:id/retry", http.StatusNotFound, start)
+		return
+	case errors.Is(err, ErrNotDeadLettered):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only dead-lettered notifications can be retried"})
+		recordRequest("POST", "/notifications/:id/retry", http.StatusConflict, start)
+		return
+	}
+
+	logger.Info(ctx, "Notification requeued", map[string]interface{}{"notification_id": n.ID})
+	c.JSON(http.StatusAccepted, n)
+	recordRequest("POST", "/notifications/:id/retry", http.StatusAccepted, start)
+}
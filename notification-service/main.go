@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"platform"
+)
+
+// OpenTelemetry export settings
+var telemetry = platform.Telemetry{ServiceName: "notification-service"}
+
+// Logger
+var logger = platform.NewStructuredLogger("notification-service")
+
+// Tracer
+var tracer = telemetry.Tracer()
+
+// HTTP clients: httpClient for webhook deliveries, streamClient for the
+// long-lived event streams, which must not time out
+var (
+	httpClient   *http.Client
+	streamClient *http.Client
+)
+
+// Notification templates, from NOTIFICATION_TEMPLATES over the defaults
+var templates *Templates
+
+// Prometheus metrics
+var requestCount, responseTime = platform.NewRequestMetrics("notification_service", "notification service")
+
+func init() {
+	prometheus.MustRegister(eventsReceived)
+	prometheus.MustRegister(streamConnected)
+	prometheus.MustRegister(streamReconnects)
+	prometheus.MustRegister(notificationsCreated)
+	prometheus.MustRegister(deliveryAttempts)
+	prometheus.MustRegister(deliveryDuration)
+	prometheus.MustRegister(deadLetters)
+	prometheus.MustRegister(dlqSize)
+	prometheus.MustRegister(queueDepth)
+	prometheus.MustRegister(renderErrors)
+	prometheus.MustRegister(rateLimitedRequests)
+	prometheus.MustRegister(requestTimeouts)
+	prometheus.MustRegister(configReloads)
+	prometheus.MustRegister(chaosInjections)
+	prometheus.MustRegister(chaosActiveFaults)
+
+	// Outgoing calls carry the caller's trace context, over TLS when
+	// TLS_CA_FILE or a client certificate is configured
+	httpClient = platform.NewHTTPClient(logger, 10*time.Second)
+	streamClient = &http.Client{Transport: httpClient.Transport}
+}
+
+func recordRequest(method, endpoint string, status int, start time.Time) {
+	requestCount.WithLabelValues(method, endpoint, strconv.Itoa(status)).Inc()
+	responseTime.WithLabelValues(method, endpoint).Observe(time.Since(start).Seconds())
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Re-read CONFIG_FILE on SIGHUP
+	watchConfigReload(ctx)
+	config.OnReload(logger.LoadSettings)
+
+	tp, err := platform.InitTracer(ctx, telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		// Flush buffered spans before exiting
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			logger.Error(ctx, "Error shutting down tracer provider", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+
+	mp := initMeter()
+	if mp != nil {
+		defer func() {
+			// Push the last metrics before exiting
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := mp.Shutdown(ctx); err != nil {
+				logger.Error(ctx, "Error shutting down meter provider", map[string]interface{}{"error": err.Error()})
+			}
+		}()
+	}
+
+	// Send logs to the collector too when OTEL_LOGS_ENABLED=true
+	logExporter, err := platform.InitLogExport(ctx, logger, telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize log export: %v", err)
+	}
+	if logExporter != nil {
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := logExporter.Shutdown(ctx); err != nil {
+				log.Printf("Error shutting down log exporter: %v", err)
+			}
+		}()
+	}
+
+	templates, err = LoadTemplates(config.Get("NOTIFICATION_TEMPLATES"))
+	if err != nil {
+		log.Fatalf("Failed to load notification templates: %v", err)
+	}
+
+	dispatcher = NewDispatcherFromEnv(NewSinksFromEnv())
+	defer dispatcher.Close()
+
+	sources := EventSourcesFromEnv()
+	for _, source := range sources {
+		go consumeEvents(ctx, source)
+	}
+
+	// gin.New rather than gin.Default: the access log below replaces gin's
+	// plain-text request logger
+	router := gin.New()
+
+	// Gzip responses for clients that accept it
+	router.Use(platform.CompressionMiddleware())
+
+	// Correlate logs and errors by X-Request-ID, across services
+	router.Use(platform.RequestIDMiddleware())
+
+	// Add OpenTelemetry middleware
+	router.Use(otelgin.Middleware("notification-service"))
+	router.Use(platform.MetricsMiddleware("notification-service"))
+	router.Use(platform.AccessLogMiddleware(logger))
+
+	// Per-route SLO compliance, summarized on /slo
+	slo := platform.NewSLOTrackerFromEnv("notification-service")
+	router.Use(slo.Middleware())
+
+	// Tag requests slower than their route's recent p99 on the span
+	outliers := platform.NewOutlierDetectorFromEnv("notification-service", logger)
+	outliers.AddQueue("notifications", dispatcher.Depth)
+	router.Use(outliers.Middleware())
+
+	// Turn handler panics into logged, traced and counted 500s
+	router.Use(platform.RecoveryMiddleware(logger))
+
+	// Per-client rate limiting (disabled unless RATE_LIMIT_RPS is set)
+	router.Use(rateLimitMiddleware(NewRateLimiterFromEnv))
+
+	// Per-request deadlines (REQUEST_TIMEOUT, ROUTE_TIMEOUTS)
+	router.Use(timeoutMiddleware(nil))
+
+	// Injected faults from CHAOS_FAULTS and the /chaos API
+	StartChaosFromConfig()
+	router.Use(chaosMiddleware())
+
+	// Health check
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "UP"})
+	})
+
+	// Metrics
+	if platform.PrometheusEnabled() {
+		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
+	router.POST("/config/reload", postConfigReload)
+	registerChaosRoutes(router)
+	platform.RegisterLogLevelRoutes(router, logger)
+	platform.RegisterAuditRoutes(router)
+	platform.RegisterSLORoutes(router, slo)
+	platform.RegisterDependencyRoutes(router, "notification-service")
+
+	// Hold /readyz at 503 until the collector and downstream services answer
+	startup := platform.NewStartupCheckerFromEnv("notification-service", logger,
+		telemetry.CollectorDependency(),
+		platform.HTTPDependency("inventory-service", platform.GetEnv("INVENTORY_SERVICE", "http://localhost:8085")),
+		platform.HTTPDependency("instabook", platform.GetEnv("INSTABOOK_SERVICE", "http://localhost:8087")),
+	)
+	startup.Start(ctx)
+	platform.RegisterStartupRoutes(router, startup)
+
+	// Delivery history and the dead-letter queue
+	router.GET("/notifications", listNotifications)
+	router.GET("/notifications/dlq", listDeadLetters)
+	router.GET("/notifications/:id", getNotification)
+	router.GET("/notifications/:id/attempts", getAttempts)
+	router.POST("/notifications/:id/retry", retryNotification)
+
+	port := platform.GetEnv("PORT", "8089")
+	sourceNames := make([]string, len(sources))
+	for i, source := range sources {
+		sourceNames[i] = source.Name
+	}
+	logger.Info(ctx, "Notification Service starting", map[string]interface{}{
+		"port":     port,
+		"sources":  sourceNames,
+		"channels": dispatcher.Channels(),
+	})
+	if err := runServer(ctx, ":"+port, router); err != nil {
+		logger.Error(ctx, "Server error", map[string]interface{}{"error": err.Error()})
+	}
+
+	// Release pooled connections to the other services
+	httpClient.CloseIdleConnections()
+}
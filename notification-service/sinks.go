@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"platform"
+)
+
+// Sink delivers a rendered notification over one channel
+type Sink interface {
+	Channel() string
+	Deliver(ctx context.Context, n *Notification) error
+}
+
+// NewSinksFromEnv returns a sink for every configured channel:
+// NOTIFY_WEBHOOK_URL for webhooks and SMTP_ADDR for email. With neither set
+// notifications are only logged.
+func NewSinksFromEnv() []Sink {
+	var sinks []Sink
+	if url := config.Get("NOTIFY_WEBHOOK_URL"); url != "" {
+		sinks = append(sinks, &WebhookSink{url: url})
+	}
+	if addr := config.Get("SMTP_ADDR"); addr != "" {
+		var to []string
+		for _, rcpt := range strings.Split(config.Get("SMTP_TO"), ",") {
+			if rcpt = strings.TrimSpace(rcpt); rcpt != "" {
+				to = append(to, rcpt)
+			}
+		}
+		sinks = append(sinks, &SMTPSink{
+			addr:     addr,
+			from:     platform.GetEnv("SMTP_FROM", "notifications@localhost"),
+			to:       to,
+			username: config.Get("SMTP_USERNAME"),
+			password: config.Get("SMTP_PASSWORD"),
+		})
+	}
+	if len(sinks) == 0 {
+		sinks = append(sinks, LogSink{})
+	}
+	return sinks
+}
+
+// WebhookSink POSTs the notification as JSON. Receivers can use the
+// X-Notification-ID header to drop retried duplicates.
+type WebhookSink struct {
+	url string
+}
+
+func (s *WebhookSink) Channel() string { return "webhook" }
+
+func (s *WebhookSink) Deliver(ctx context.Context, n *Notification) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":       n.ID,
+		"template": n.Template,
+		"subject":  n.Subject,
+		"body":     n.Body,
+		"event":    n.Event,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Notification-ID", n.ID)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SMTPSink sends the notification as a plain-text email, upgrading to TLS
+// when the server offers STARTTLS
+type SMTPSink struct {
+	addr     string
+	from     string
+	to       []string
+	username string
+	password string
+}
+
+func (s *SMTPSink) Channel() string { return "email" }
+
+func (s *SMTPSink) Deliver(ctx context.Context, n *Notification) error {
+	if len(s.to) == 0 {
+		return fmt.Errorf("SMTP_TO is empty")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	// net/smtp has no context support; the deadline stands in for it
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	host, _, _ := net.SplitHostPort(s.addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.from); err != nil {
+		return err
+	}
+	for _, rcpt := range s.to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nX-Notification-ID: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		s.from, strings.Join(s.to, ", "), n.Subject, time.Now().Format(time.RFC1123Z), n.ID, n.Body)
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// LogSink writes notifications to the log, so the service works with no
+// channel configured
+type LogSink struct{}
+
+func (LogSink) Channel() string { return "log" }
+
+func (LogSink) Deliver(ctx context.Context, n *Notification) error {
+	logger.Info(ctx, "Notification", map[string]interface{}{
+		"notification_id": n.ID,
+		"template":        n.Template,
+		"subject":         n.Subject,
+		"body":            n.Body,
+	})
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateSpec is a notification template as written in
+// NOTIFICATION_TEMPLATES. Both fields are text/template strings executed
+// against the event's JSON fields.
+type TemplateSpec struct {
+	Subject string `yaml:"subject"`
+	Body    string `yaml:"body"`
+}
+
+// defaultTemplates are keyed by "<source>.<event type>". An event only
+// produces a notification when a template exists for it.
+var defaultTemplates = map[string]TemplateSpec{
+	"inventory.low_stock": {
+		Subject: "Low stock: product {{.product_id}}",
+		Body:    "Product {{.product_id}} is down to {{.quantity}} available ({{.reserved}} of {{.total}} reserved).",
+	},
+	"booking.confirmed": {
+		Subject: "Booking {{.booking_id}} confirmed",
+		Body:    "User {{.user_id}} booked {{.quantity}} x product {{.product_id}}.",
+	},
+	"booking.rolled_back": {
+		Subject: "Booking {{.booking_id}} rolled back",
+		Body:    "Booking {{.booking_id}} for user {{.user_id}} was rolled back{{with .error}}: {{.}}{{end}}.",
+	},
+	"booking.failed": {
+		Subject: "Booking {{.booking_id}} failed",
+		Body:    "Booking {{.booking_id}} for user {{.user_id}} failed and could not be rolled back{{with .error}}: {{.}}{{end}}.",
+	},
+}
+
+type notificationTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+// Templates renders notifications from parsed templates
+type Templates struct {
+	byName map[string]notificationTemplate
+}
+
+// LoadTemplates parses the default templates overlaid with those in the
+// YAML file at path, if any. A template in the file replaces the default of
+// the same name; an empty subject and body removes it.
+func LoadTemplates(path string) (*Templates, error) {
+	specs := make(map[string]TemplateSpec, len(defaultTemplates))
+	for name, spec := range defaultTemplates {
+		specs[name] = spec
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var overrides map[string]TemplateSpec
+		if err := yaml.Unmarshal(data, &overrides); err != nil {
+			return nil, fmt.Errorf("invalid templates file %s: %w", path, err)
+		}
+		for name, spec := range overrides {
+			if spec.Subject == "" && spec.Body == "" {
+				delete(specs, name)
+				continue
+			}
+			specs[name] = spec
+		}
+	}
+
+	t := &Templates{byName: make(map[string]notificationTemplate, len(specs))}
+	for name, spec := range specs {
+		subject, err := template.New(name + ".subject").Option("missingkey=zero").Parse(spec.Subject)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", name, err)
+		}
+		body, err := template.New(name + ".body").Option("missingkey=zero").Parse(spec.Body)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", name, err)
+		}
+		t.byName[name] = notificationTemplate{subject: subject, body: body}
+	}
+	return t, nil
+}
+
+// Has reports whether a template exists for name
+func (t *Templates) Has(name string) bool {
+	_, ok := t.byName[name]
+	return ok
+}
+
+// Render executes the named template against data
+func (t *Templates) Render(name string, data map[string]interface{}) (subject, body string, err error) {
+	tmpl, ok := t.byName[name]
+	if !ok {
+		return "", "", fmt.Errorf("no template %q", name)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.subject.Execute(&buf, data); err != nil {
+		return "", "", fmt.Errorf("template %s: %w", name, err)
+	}
+	// Subjects are a single header line
+	subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	buf.Reset()
+	if err := tmpl.body.Execute(&buf, data); err != nil {
+		return "", "", fmt.Errorf("template %s: %w", name, err)
+	}
+	return subject, buf.String(), nil
+}
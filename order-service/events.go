@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Lifecycle event types besides the order statuses, which are published as
+// events of the same name when an order moves into them
+const (
+	EventCreated  = "created"
+	EventRecorded = "recorded"
+)
+
+var orderEvents = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "order_service_order_events_total",
+		Help: "Number of order lifecycle events by type",
+	},
+	[]string{"type"},
+)
+
+// OrderEvent describes a single step in an order's lifecycle
+type OrderEvent struct {
+	Type      string    `json:"type"`
+	OrderID   string    `json:"order_id"`
+	UserID    string    `json:"user_id"`
+	Source    string    `json:"source"`
+	Status    string    `json:"status"`
+	Step      string    `json:"step,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Total     float64   `json:"total"`
+	Currency  string    `json:"currency,omitempty"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// EventBroker fans out order events to stream subscribers
+type EventBroker struct {
+	mu          sync.RWMutex
+	subscribers map[chan OrderEvent]struct{}
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+var events = NewEventBroker()
+
+func NewEventBroker() *EventBroker {
+	return &EventBroker{
+		subscribers: make(map[chan OrderEvent]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Close signals all open streams to finish, e.g. during shutdown
+func (b *EventBroker) Close() {
+	b.closeOnce.Do(func() { close(b.done) })
+}
+
+// Done is closed once the broker has been closed
+func (b *EventBroker) Done() <-chan struct{} {
+	return b.done
+}
+
+func (b *EventBroker) Subscribe() chan OrderEvent {
+	ch := make(chan OrderEvent, 64)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *EventBroker) Unsubscribe(ch chan OrderEvent) {
+	b.mu.Lock()
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+	close(ch)
+}
+
+// Publish never blocks; slow subscribers miss events rather than
+// stalling the request path.
+func (b *EventBroker) Publish(event OrderEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// emitOrderEvent logs a lifecycle event, stamped with the current trace,
+// and publishes it to stream subscribers
+func emitOrderEvent(ctx context.Context, eventType, step string, o *Order) {
+	event := OrderEvent{
+		Type:      eventType,
+		OrderID:   o.ID,
+		UserID:    o.UserID,
+		Source:    o.Source,
+		Status:    o.Status,
+		Step:      step,
+		Error:     o.Error,
+		Total:     o.Total,
+		Currency:  o.Currency,
+		Timestamp: time.Now().UTC(),
+	}
+	if sc := trace.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		event.TraceID = sc.TraceID().String()
+	}
+
+	orderEvents.WithLabelValues(eventType).Inc()
+	logger.Info(ctx, "Order event", map[string]interface{}{
+		"event":    eventType,
+		"order_id": o.ID,
+		"user_id":  o.UserID,
+		"source":   o.Source,
+		"status":   o.Status,
+		"step":     step,
+	})
+	events.Publish(event)
+}
+
+func streamOrderEvents(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.Query("user_id")
+
+	logger.Info(ctx, "Order event stream opened", map[string]interface{}{
+		"user_id":   userID,
+		"client_ip": c.ClientIP(),
+	})
+
+	ch := events.Subscribe()
+	defer events.Unsubscribe(ch)
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-events.Done():
+			return false
+		case <-heartbeat.C:
+			c.SSEvent("heartbeat", gin.H{"timestamp": time.Now().UTC()})
+			return true
+		case event := <-ch:
+			if userID != "" && event.UserID != userID {
+				return true
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		}
+	})
+
+	logger.Info(ctx, "Order event stream closed", map[string]interface{}{
+		"user_id": userID,
+	})
+}
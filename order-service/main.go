@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"platform"
+)
+
+// OpenTelemetry export settings
+var telemetry = platform.Telemetry{ServiceName: "order-service"}
+
+// Logger
+var logger = platform.NewStructuredLogger("order-service")
+
+// Tracer
+var tracer = telemetry.Tracer()
+
+// HTTP client
+var httpClient *http.Client
+
+// Configuration
+var (
+	productCatalogURL   string
+	inventoryServiceURL string
+	adServiceURL        string
+	maxCartItems        = 50
+)
+
+// Prometheus metrics
+var (
+	requestCount, responseTime = platform.NewRequestMetrics("order_service", "order service")
+
+	orderOutcomes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "order_service_orders_total",
+			Help: "Number of checkout workflows by final order status",
+		},
+		[]string{"status"},
+	)
+	compensations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "order_service_compensations_total",
+			Help: "Number of inventory reservations released after a failed checkout, by result",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(orderOutcomes)
+	prometheus.MustRegister(compensations)
+	prometheus.MustRegister(historyWrites)
+	prometheus.MustRegister(orderEvents)
+	prometheus.MustRegister(rateLimitedRequests)
+	prometheus.MustRegister(requestTimeouts)
+	prometheus.MustRegister(configReloads)
+	prometheus.MustRegister(chaosInjections)
+	prometheus.MustRegister(chaosActiveFaults)
+
+	productCatalogURL = platform.GetEnv("PRODUCT_CATALOG_SERVICE", "http://localhost:8081")
+	inventoryServiceURL = platform.GetEnv("INVENTORY_SERVICE", "http://localhost:8085")
+	adServiceURL = platform.GetEnv("AD_SERVICE", "http://localhost:8083")
+	if n, err := strconv.Atoi(config.Get("MAX_CART_ITEMS")); err == nil && n > 0 {
+		maxCartItems = n
+	}
+
+	// Outgoing calls carry the caller's trace context and baggage, over TLS
+	// when TLS_CA_FILE or a client certificate is configured
+	httpClient = platform.NewHTTPClient(logger, 10*time.Second)
+}
+
+func recordRequest(method, endpoint string, status int, start time.Time) {
+	requestCount.WithLabelValues(method, endpoint, strconv.Itoa(status)).Inc()
+	responseTime.WithLabelValues(method, endpoint).Observe(time.Since(start).Seconds())
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Re-read CONFIG_FILE on SIGHUP
+	watchConfigReload(ctx)
+	config.OnReload(logger.LoadSettings)
+
+	tp, err := platform.InitTracer(ctx, telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		// Flush buffered spans before exiting
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			logger.Error(ctx, "Error shutting down tracer provider", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+
+	mp := initMeter()
+	if mp != nil {
+		defer func() {
+			// Push the last metrics before exiting
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := mp.Shutdown(ctx); err != nil {
+				logger.Error(ctx, "Error shutting down meter provider", map[string]interface{}{"error": err.Error()})
+			}
+		}()
+	}
+
+	// Finished orders are kept in ORDER_HISTORY_BACKEND
+	history, err = NewOrderHistoryFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize order history: %v", err)
+	}
+	defer history.Close()
+
+	// Send logs to the collector too when OTEL_LOGS_ENABLED=true
+	logExporter, err := platform.InitLogExport(ctx, logger, telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize log export: %v", err)
+	}
+	if logExporter != nil {
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := logExporter.Shutdown(ctx); err != nil {
+				log.Printf("Error shutting down log exporter: %v", err)
+			}
+		}()
+	}
+
+	// gin.New rather than gin.Default: the access log below replaces gin's
+	// plain-text request logger
+	router := gin.New()
+
+	// Gzip responses for clients that accept it
+	router.Use(platform.CompressionMiddleware())
+
+	// Correlate logs and errors by X-Request-ID, across services
+	router.Use(platform.RequestIDMiddleware())
+
+	// Add OpenTelemetry middleware
+	router.Use(otelgin.Middleware("order-service"))
+	router.Use(platform.MetricsMiddleware("order-service"))
+	router.Use(platform.AccessLogMiddleware(logger))
+
+	// Per-route SLO compliance, summarized on /slo. Event streams stay open
+	// until the client disconnects, so they are left out
+	slo := platform.NewSLOTrackerFromEnv("order-service", "GET /orders/events")
+	router.Use(slo.Middleware())
+
+	// Tag requests slower than their route's recent p99 on the span
+	outliers := platform.NewOutlierDetectorFromEnv("order-service", logger, "GET /orders/events")
+	router.Use(outliers.Middleware())
+
+	// Turn handler panics into logged, traced and counted 500s
+	router.Use(platform.RecoveryMiddleware(logger))
+
+	// Per-client rate limiting (disabled unless RATE_LIMIT_RPS is set)
+	router.Use(rateLimitMiddleware(NewRateLimiterFromEnv))
+
+	// Per-request deadlines (REQUEST_TIMEOUT, ROUTE_TIMEOUTS)
+	router.Use(timeoutMiddleware(map[string]time.Duration{
+		// Event streams stay open until the client disconnects
+		"GET /orders/events": 0,
+	}))
+
+	// Injected faults from CHAOS_FAULTS and the /chaos API
+	StartChaosFromConfig()
+	router.Use(chaosMiddleware())
+
+	// Health check
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "UP"})
+	})
+
+	// Metrics
+	if platform.PrometheusEnabled() {
+		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
+	router.POST("/config/reload", postConfigReload)
+	registerChaosRoutes(router)
+	platform.RegisterLogLevelRoutes(router, logger)
+	platform.RegisterAuditRoutes(router)
+	platform.RegisterSLORoutes(router, slo)
+	platform.RegisterDependencyRoutes(router, "order-service")
+
+	// Hold /readyz at 503 until the collector and downstream services
+	// answer. The order database is already pinged above.
+	startup := platform.NewStartupCheckerFromEnv("order-service", logger,
+		telemetry.CollectorDependency(),
+		platform.HTTPDependency("product-catalog", productCatalogURL),
+		platform.HTTPDependency("inventory-service", inventoryServiceURL),
+		platform.HTTPDependency("ad-service", adServiceURL),
+	)
+	startup.Start(ctx)
+	platform.RegisterStartupRoutes(router, startup)
+
+	// Checkout workflow: validate products → reserve inventory → fetch
+	// upsells → place order
+	router.POST("/checkout", placeOrder)
+	router.GET("/order/:id", getOrder)
+
+	// Order history: the system of record for finished orders
+	router.POST("/orders", postOrder)
+	router.GET("/orders/events", streamOrderEvents)
+	router.GET("/orders/:id", getOrder)
+	router.GET("/users/:id/orders", listUserOrders)
+
+	port := platform.GetEnv("PORT", "8088")
+	logger.Info(ctx, "Order Service starting", map[string]interface{}{
+		"port":              port,
+		"product_catalog":   productCatalogURL,
+		"inventory_service": inventoryServiceURL,
+		"ad_service":        adServiceURL,
+	})
+	if err := runServer(ctx, ":"+port, router); err != nil {
+		logger.Error(ctx, "Server error", map[string]interface{}{"error": err.Error()})
+	}
+
+	// Release pooled connections to the other services
+	httpClient.CloseIdleConnections()
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"platform"
+)
+
+// Order statuses. An order moves pending → validated → reserved → placed,
+// or ends in rolled_back once its reservations have been released. rejected
+// means the cart failed validation before anything was reserved; failed
+// means a release could not be completed, leaving stock reserved.
+const (
+	OrderPending    = "pending"
+	OrderRejected   = "rejected"
+	OrderValidated  = "validated"
+	OrderReserved   = "reserved"
+	OrderPlaced     = "placed"
+	OrderRolledBack = "rolled_back"
+	OrderFailed     = "failed"
+)
+
+// maxOrders bounds the in-memory order history; the oldest orders are
+// forgotten first
+const maxOrders = 10000
+
+// compensationTimeout bounds releasing reservations, which runs even when
+// the request that placed them has been cancelled or timed out
+const compensationTimeout = 10 * time.Second
+
+type CartItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// OrderLine is a cart item priced from the product catalog
+type OrderLine struct {
+	ProductID string  `json:"product_id"`
+	Name      string  `json:"name"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	LineTotal float64 `json:"line_total"`
+	Reserved  bool    `json:"reserved"`
+}
+
+// Upsell is an ad returned by ad-service for the products in the cart
+type Upsell struct {
+	ID          string `json:"id"`
+	Text        string `json:"text"`
+	RedirectURL string `json:"redirect_url"`
+	ImageURL    string `json:"image_url"`
+}
+
+type OrderTransition struct {
+	Status string    `json:"status"`
+	Step   string    `json:"step"`
+	At     time.Time `json:"at"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Order tracks one run of the validate → reserve → upsell → place workflow
+type Order struct {
+	ID          string            `json:"id"`
+	UserID      string            `json:"user_id"`
+	Source      string            `json:"source"`
+	Reference   string            `json:"reference,omitempty"`
+	Status      string            `json:"status"`
+	Lines       []OrderLine       `json:"lines"`
+	Total       float64           `json:"total"`
+	Currency    string            `json:"currency"`
+	Upsells     []Upsell          `json:"upsells"`
+	Error       string            `json:"error,omitempty"`
+	Transitions []OrderTransition `json:"transitions"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// OrderStore keeps recent orders in memory, ordered by creation
+type OrderStore struct {
+	mu     sync.RWMutex
+	orders map[string]*Order
+	order  []string
+}
+
+var orders = NewOrderStore()
+
+func NewOrderStore() *OrderStore {
+	return &OrderStore{orders: make(map[string]*Order)}
+}
+
+func (s *OrderStore) Add(o *Order) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.orders[o.ID] = o
+	s.order = append(s.order, o.ID)
+	for len(s.order) > maxOrders {
+		delete(s.orders, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// Get returns a copy so callers can't race with an in-flight workflow
+func (s *OrderStore) Get(id string) (Order, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	o, ok := s.orders[id]
+	if !ok {
+		return Order{}, false
+	}
+	return cloneOrder(o), true
+}
+
+// cloneOrder copies an order deeply enough that the copy shares no slices
+func cloneOrder(o *Order) Order {
+	copied := *o
+	copied.Lines = append([]OrderLine(nil), o.Lines...)
+	copied.Upsells = append([]Upsell(nil), o.Upsells...)
+	copied.Transitions = append([]OrderTransition(nil), o.Transitions...)
+	return copied
+}
+
+// update applies fn to the order under the store's lock
+func (s *OrderStore) update(o *Order, fn func(*Order)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(o)
+}
+
+// transition records a status change for the order and publishes a
+// lifecycle event when the status actually changed
+func (s *OrderStore) transition(ctx context.Context, o *Order, status, step string, err error) {
+	var changed bool
+	var snapshot Order
+	s.update(o, func(o *Order) {
+		now := time.Now()
+		t := OrderTransition{Status: status, Step: step, At: now}
+		if err != nil {
+			t.Error = err.Error()
+			o.Error = err.Error()
+		}
+		changed = o.Status != status
+		o.Status = status
+		o.UpdatedAt = now
+		o.Transitions = append(o.Transitions, t)
+		snapshot = cloneOrder(o)
+	})
+	if changed {
+		emitOrderEvent(ctx, status, step, &snapshot)
+	}
+}
+
+func newID(prefix string) string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// stepError carries the HTTP status a failed step maps to
+type stepError struct {
+	status int
+	err    error
+}
+
+func (e *stepError) Error() string { return e.err.Error() }
+
+func stepStatus(err error) int {
+	if se, ok := err.(*stepError); ok {
+		return se.status
+	}
+	return http.StatusInternalServerError
+}
+
+// runStep wraps a workflow step in its own span
+func runStep(ctx context.Context, o *Order, name string, fn func(context.Context) error) error {
+	ctx, span := tracer.Start(ctx, "order."+name)
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("order.id", o.ID),
+		attribute.String("order.step", name),
+	)
+
+	err := fn(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		logger.Error(ctx, "Order step failed", map[string]interface{}{
+			"order_id": o.ID,
+			"step":     name,
+			"error":    err.Error(),
+		})
+	}
+	return err
+}
+
+// detachedContext keeps a context's values (trace, baggage, request ID) but
+// not its cancellation, so compensation outlives the request
+type detachedContext struct{ context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func placeOrder(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+
+	var req struct {
+		UserID string     `json:"user_id"`
+		Items  []CartItem `json:"items"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == "" || len(req.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id and at least one item are required"})
+		recordRequest("POST", "/checkout", http.StatusBadRequest, start)
+		return
+	}
+	if len(req.Items) > maxCartItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d items per cart", maxCartItems)})
+		recordRequest("POST", "/checkout", http.StatusBadRequest, start)
+		return
+	}
+
+	// Repeated products are merged into one line, so each is reserved once
+	var lines []OrderLine
+	index := make(map[string]int)
+	for _, item := range req.Items {
+		if item.ProductID == "" || item.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Every item needs a product_id and a positive quantity"})
+			recordRequest("POST", "/checkout", http.StatusBadRequest, start)
+			return
+		}
+		if i, ok := index[item.ProductID]; ok {
+			lines[i].Quantity += item.Quantity
+			continue
+		}
+		index[item.ProductID] = len(lines)
+		lines = append(lines, OrderLine{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+
+	now := time.Now()
+	order := &Order{
+		ID:        newID("ord-"),
+		UserID:    req.UserID,
+		Source:    SourceCheckout,
+		Status:    OrderPending,
+		Lines:     lines,
+		Upsells:   []Upsell{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	orders.Add(order)
+
+	// Tag every downstream span of the order, in product-catalog,
+	// inventory-service and ad-service too
+	ctx = platform.WithBaggage(ctx, "order.id", order.ID)
+	ctx = platform.WithBaggage(ctx, "user.id", req.UserID)
+
+	logger.Info(ctx, "Starting checkout", map[string]interface{}{
+		"order_id": order.ID,
+		"user_id":  req.UserID,
+		"lines":    len(lines),
+	})
+	created, _ := orders.Get(order.ID)
+	emitOrderEvent(ctx, EventCreated, "", &created)
+
+	status := runCheckout(ctx, order)
+	result, _ := orders.Get(order.ID)
+	recordOrderOutcome(ctx, result.Status)
+
+	// Every finished checkout goes into the order history, whatever its
+	// outcome, so a missing order can be told apart from a failed one
+	recordOrder(ctx, &result)
+
+	logger.Info(ctx, "Checkout finished", map[string]interface{}{
+		"order_id": order.ID,
+		"status":   result.Status,
+	})
+	c.JSON(status, result)
+	recordRequest("POST", "/checkout", status, start)
+}
+
+// runCheckout executes the workflow, releasing any reservations when a
+// later step fails. It returns the HTTP status for the caller.
+func runCheckout(ctx context.Context, o *Order) int {
+	err := runStep(ctx, o, "validate_products", func(ctx context.Context) error {
+		return validateProducts(ctx, o)
+	})
+	if err != nil {
+		orders.transition(ctx, o, OrderRejected, "validate_products", err)
+		return stepStatus(err)
+	}
+	orders.transition(ctx, o, OrderValidated, "validate_products", nil)
+
+	err = runStep(ctx, o, "reserve_inventory", func(ctx context.Context) error {
+		return reserveLines(ctx, o)
+	})
+	if err != nil {
+		return rollbackOrder(ctx, o, "reserve_inventory", err)
+	}
+	orders.transition(ctx, o, OrderReserved, "reserve_inventory", nil)
+
+	// Upsells are best effort; an order is never failed for want of ads
+	err = runStep(ctx, o, "fetch_upsells", func(ctx context.Context) error {
+		return fetchUpsells(ctx, o)
+	})
+	if err != nil {
+		orders.transition(ctx, o, OrderReserved, "fetch_upsells", err)
+	}
+
+	err = runStep(ctx, o, "place_order", func(ctx context.Context) error {
+		// Nothing is placed for a caller that has given up; its
+		// reservations are released instead
+		if err := ctx.Err(); err != nil {
+			return &stepError{status: http.StatusGatewayTimeout, err: fmt.Errorf("checkout abandoned: %w", err)}
+		}
+		emitOrderRecord(ctx, o)
+		return nil
+	})
+	if err != nil {
+		return rollbackOrder(ctx, o, "place_order", err)
+	}
+	orders.transition(ctx, o, OrderPlaced, "place_order", nil)
+	return http.StatusCreated
+}
+
+// rollbackOrder releases every reservation made for the order, most recent
+// first
+func rollbackOrder(ctx context.Context, o *Order, failedStep string, cause error) int {
+	orders.transition(ctx, o, o.Status, failedStep, cause)
+	status := stepStatus(cause)
+
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, compensationTimeout)
+	defer cancel()
+
+	err := runStep(ctx, o, "release_inventory", func(ctx context.Context) error {
+		var failed []string
+		for i := len(o.Lines) - 1; i >= 0; i-- {
+			line := o.Lines[i]
+			if !line.Reserved {
+				continue
+			}
+			if err := releaseInventory(ctx, line.ProductID, line.Quantity); err != nil {
+				recordCompensation("failed")
+				failed = append(failed, line.ProductID)
+				continue
+			}
+			recordCompensation("released")
+			orders.update(o, func(o *Order) { o.Lines[i].Reserved = false })
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to release products %s", strings.Join(failed, ", "))
+		}
+		return nil
+	})
+	if err != nil {
+		orders.transition(ctx, o, OrderFailed, "release_inventory", err)
+		return http.StatusInternalServerError
+	}
+	orders.transition(ctx, o, OrderRolledBack, "release_inventory", nil)
+	return status
+}
+
+// validateProducts prices every line from product-catalog
+func validateProducts(ctx context.Context, o *Order) error {
+	for i, line := range o.Lines {
+		var product struct {
+			Name     string  `json:"name"`
+			Price    float64 `json:"price"`
+			Currency string  `json:"currency"`
+		}
+		status, err := callService(ctx, http.MethodGet, productCatalogURL+"/product/"+url.PathEscape(line.ProductID), nil, &product)
+		if err != nil {
+			return &stepError{status: http.StatusServiceUnavailable, err: fmt.Errorf("product catalog: %w", err)}
+		}
+		switch {
+		case status == http.StatusNotFound || status == http.StatusBadRequest:
+			return &stepError{status: http.StatusUnprocessableEntity, err: fmt.Errorf("unknown product %s", line.ProductID)}
+		case status >= 400:
+			return &stepError{status: http.StatusBadGateway, err: fmt.Errorf("product catalog returned %d", status)}
+		}
+		if o.Currency != "" && product.Currency != o.Currency {
+			return &stepError{status: http.StatusUnprocessableEntity, err: fmt.Errorf("product %s is priced in %s, not %s", line.ProductID, product.Currency, o.Currency)}
+		}
+
+		orders.update(o, func(o *Order) {
+			o.Currency = product.Currency
+			o.Lines[i].Name = product.Name
+			o.Lines[i].UnitPrice = product.Price
+			o.Lines[i].LineTotal = product.Price * float64(line.Quantity)
+			o.Total += o.Lines[i].LineTotal
+		})
+	}
+	return nil
+}
+
+// reserveLines reserves stock line by line, stopping at the first failure.
+// Lines reserved so far stay marked so rollbackOrder can release them.
+func reserveLines(ctx context.Context, o *Order) error {
+	for i, line := range o.Lines {
+		status, err := callService(ctx, http.MethodPost, inventoryServiceURL+"/inventory/reserve", map[string]interface{}{
+			"product_id": line.ProductID,
+			"quantity":   line.Quantity,
+		}, nil)
+		if err != nil {
+			return &stepError{status: http.StatusServiceUnavailable, err: fmt.Errorf("inventory service: %w", err)}
+		}
+		switch {
+		case status == http.StatusNotFound || status == http.StatusConflict:
+			return &stepError{status: http.StatusConflict, err: fmt.Errorf("insufficient inventory for product %s", line.ProductID)}
+		case status >= 400:
+			return &stepError{status: http.StatusBadGateway, err: fmt.Errorf("inventory service returned %d", status)}
+		}
+		orders.update(o, func(o *Order) { o.Lines[i].Reserved = true })
+	}
+	return nil
+}
+
+func releaseInventory(ctx context.Context, productID string, quantity int) error {
+	status, err := callService(ctx, http.MethodPost, inventoryServiceURL+"/inventory/release", map[string]interface{}{
+		"product_id": productID,
+		"quantity":   quantity,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if status >= 400 {
+		return fmt.Errorf("inventory service returned %d", status)
+	}
+	return nil
+}
+
+// fetchUpsells asks ad-service for ads matching the products in the order
+func fetchUpsells(ctx context.Context, o *Order) error {
+	ids := make([]string, len(o.Lines))
+	for i, line := range o.Lines {
+		ids[i] = line.ProductID
+	}
+
+	var ads []Upsell
+	status, err := callService(ctx, http.MethodGet, adServiceURL+"/ads?product_ids="+url.QueryEscape(strings.Join(ids, ",")), nil, &ads)
+	if err != nil {
+		return fmt.Errorf("ad service: %w", err)
+	}
+	if status >= 400 {
+		return fmt.Errorf("ad service returned %d", status)
+	}
+	if ads == nil {
+		ads = []Upsell{}
+	}
+	orders.update(o, func(o *Order) { o.Upsells = ads })
+	return nil
+}
+
+// emitOrderRecord writes the placed order as a structured log line, the
+// record downstream consumers read
+func emitOrderRecord(ctx context.Context, o *Order) {
+	placed, _ := orders.Get(o.ID)
+	productIDs := make([]string, len(placed.Lines))
+	for i, line := range placed.Lines {
+		productIDs[i] = line.ProductID
+	}
+	logger.Info(ctx, "Order placed", map[string]interface{}{
+		"order_id":    placed.ID,
+		"user_id":     placed.UserID,
+		"product_ids": productIDs,
+		"lines":       len(placed.Lines),
+		"total":       placed.Total,
+		"currency":    placed.Currency,
+		"upsells":     len(placed.Upsells),
+	})
+}
+
+// callService sends a JSON request and decodes a successful response into
+// out when it is non-nil. It returns the response status; errors are for
+// requests that got no response.
+func callService(ctx context.Context, method, target string, body, out interface{}) (int, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Actor", "order-service")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 400 && out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"platform"
+)
+
+// OpenTelemetry instruments, exported over OTLP alongside the Prometheus
+// metrics on /metrics
+var orderCounter metric.Int64Counter
+
+// initMeter exports metrics over OTLP and creates the business instruments.
+// It returns nil when OTEL_METRICS_ENABLED=false; the instruments are then
+// no-ops.
+func initMeter() *sdkmetric.MeterProvider {
+	mp, err := platform.InitMeter(context.Background(), telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize metrics: %v", err)
+	}
+
+	meter := otel.Meter("order-service")
+	orderCounter, _ = meter.Int64Counter("order.outcomes", metric.WithDescription("Number of checkout workflows by final order status"))
+
+	return mp
+}
+
+// recordOrderOutcome counts a finished checkout workflow
+func recordOrderOutcome(ctx context.Context, status string) {
+	orderOutcomes.WithLabelValues(status).Inc()
+	orderCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("order.status", status)))
+}
+
+// recordCompensation counts a reservation released, or not, after a
+// failed checkout
+func recordCompensation(result string) {
+	compensations.WithLabelValues(result).Inc()
+}
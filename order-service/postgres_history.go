@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// historySchema is applied on startup; every statement is idempotent
+const historySchema = `
+CREATE TABLE IF NOT EXISTS orders (
+	id         TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL,
+	source     TEXT NOT NULL,
+	reference  TEXT NOT NULL DEFAULT '',
+	status     TEXT NOT NULL,
+	total      DOUBLE PRECISION NOT NULL,
+	currency   TEXT NOT NULL,
+	body       JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS orders_user_created_at ON orders (user_id, created_at DESC);
+`
+
+// PostgresHistory stores orders in a Postgres table. The indexed columns
+// serve lookups; body holds the full order as JSON.
+type PostgresHistory struct {
+	db *sql.DB
+}
+
+func NewPostgresHistory(dsn string) (*PostgresHistory, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create orders table: %w", err)
+	}
+
+	return &PostgresHistory{db: db}, nil
+}
+
+func (h *PostgresHistory) Close() error {
+	return h.db.Close()
+}
+
+func (h *PostgresHistory) Save(ctx context.Context, o *Order) (bool, error) {
+	ctx, span := tracer.Start(ctx, "history.save")
+	defer span.End()
+	span.SetAttributes(attribute.String("db.system", "postgresql"), attribute.String("order.id", o.ID))
+
+	body, err := json.Marshal(o)
+	if err != nil {
+		return false, err
+	}
+
+	// xmax is 0 only for a freshly inserted row
+	var created bool
+	err = h.db.QueryRowContext(ctx, `
+		INSERT INTO orders (id, user_id, source, reference, status, total, currency, body, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (id) DO UPDATE SET
+			user_id = EXCLUDED.user_id,
+			source = EXCLUDED.source,
+			reference = EXCLUDED.reference,
+			status = EXCLUDED.status,
+			total = EXCLUDED.total,
+			currency = EXCLUDED.currency,
+			body = EXCLUDED.body,
+			updated_at = EXCLUDED.updated_at
+		RETURNING (xmax = 0)`,
+		o.ID, o.UserID, o.Source, o.Reference, o.Status, o.Total, o.Currency, body, o.CreatedAt, o.UpdatedAt,
+	).Scan(&created)
+	if err != nil {
+		span.RecordError(err)
+		return false, err
+	}
+	return created, nil
+}
+
+func (h *PostgresHistory) Get(ctx context.Context, id string) (*Order, error) {
+	ctx, span := tracer.Start(ctx, "history.get")
+	defer span.End()
+	span.SetAttributes(attribute.String("db.system", "postgresql"), attribute.String("order.id", id))
+
+	var body []byte
+	err := h.db.QueryRowContext(ctx, `SELECT body FROM orders WHERE id = $1`, id).Scan(&body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var o Order
+	if err := json.Unmarshal(body, &o); err != nil {
+		return nil, fmt.Errorf("failed to decode order %s: %w", id, err)
+	}
+	return &o, nil
+}
+
+func (h *PostgresHistory) ListByUser(ctx context.Context, userID, status string, limit int) ([]Order, error) {
+	ctx, span := tracer.Start(ctx, "history.list_by_user")
+	defer span.End()
+	span.SetAttributes(attribute.String("db.system", "postgresql"), attribute.String("user.id", userID))
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT body FROM orders
+		WHERE user_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3`,
+		userID, status, limit,
+	)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Order
+	for rows.Next() {
+		var body []byte
+		if err := rows.Scan(&body); err != nil {
+			return nil, err
+		}
+		var o Order
+		if err := json.Unmarshal(body, &o); err != nil {
+			return nil, fmt.Errorf("failed to decode order: %w", err)
+		}
+		result = append(result, o)
+	}
+	return result, rows.Err()
+}
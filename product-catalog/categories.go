@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Category is a node in the category tree. Products reference leaf
+// categories by ID; filtering by a parent matches all of its descendants.
+type Category struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Parent string `json:"parent,omitempty"`
+}
+
+// CategoryNode is a category with its children, as served by
+// GET /categories/tree
+type CategoryNode struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Path     []string        `json:"path"`
+	Leaf     bool            `json:"leaf"`
+	Children []*CategoryNode `json:"children,omitempty"`
+}
+
+// CategoryTree indexes categories by ID and by name. It is built once and
+// never modified, so it needs no locking.
+type CategoryTree struct {
+	byID     map[string]Category
+	byName   map[string]string
+	children map[string][]string
+	order    []string
+}
+
+var categoryTree = NewCategoryTree(defaultCategories())
+
+func defaultCategories() []Category {
+	return []Category{
+		{ID: "electronics", Name: "Electronics"},
+		{ID: "phones", Name: "Phones", Parent: "electronics"},
+		{ID: "computers", Name: "Computers", Parent: "electronics"},
+		{ID: "audio", Name: "Audio", Parent: "electronics"},
+		{ID: "headphones", Name: "Headphones", Parent: "audio"},
+		{ID: "speakers", Name: "Speakers", Parent: "audio"},
+		{ID: "wearables", Name: "Wearables", Parent: "electronics"},
+	}
+}
+
+// NewCategoryTree indexes categories, which must list parents before their
+// children. Categories whose parent is unknown become roots.
+func NewCategoryTree(categories []Category) *CategoryTree {
+	t := &CategoryTree{
+		byID:     make(map[string]Category),
+		byName:   make(map[string]string),
+		children: make(map[string][]string),
+	}
+	for _, cat := range categories {
+		if _, ok := t.byID[cat.Parent]; !ok {
+			cat.Parent = ""
+		}
+		t.byID[cat.ID] = cat
+		t.byName[cat.Name] = cat.ID
+		t.children[cat.Parent] = append(t.children[cat.Parent], cat.ID)
+		t.order = append(t.order, cat.ID)
+	}
+	return t
+}
+
+// Resolve finds a category by ID or name
+func (t *CategoryTree) Resolve(ref string) (Category, bool) {
+	if cat, ok := t.byID[ref]; ok {
+		return cat, true
+	}
+	if id, ok := t.byName[ref]; ok {
+		return t.byID[id], true
+	}
+	return Category{}, false
+}
+
+func (t *CategoryTree) IsLeaf(id string) bool {
+	_, ok := t.byID[id]
+	return ok && len(t.children[id]) == 0
+}
+
+// Path returns the names from the root down to the category
+func (t *CategoryTree) Path(id string) []string {
+	var path []string
+	for cat, ok := t.byID[id]; ok; cat, ok = t.byID[cat.Parent] {
+		path = append([]string{cat.Name}, path...)
+	}
+	return path
+}
+
+// IsDescendant reports whether id is ancestor itself or below it
+func (t *CategoryTree) IsDescendant(id, ancestor string) bool {
+	for cat, ok := t.byID[id]; ok; cat, ok = t.byID[cat.Parent] {
+		if cat.ID == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// Names returns every category name in tree order
+func (t *CategoryTree) Names() []string {
+	names := make([]string, 0, len(t.order))
+	for _, id := range t.order {
+		names = append(names, t.byID[id].Name)
+	}
+	return names
+}
+
+// Nodes returns the tree's roots with their descendants
+func (t *CategoryTree) Nodes() []*CategoryNode {
+	var build func(parent string) []*CategoryNode
+	build = func(parent string) []*CategoryNode {
+		var nodes []*CategoryNode
+		for _, id := range t.children[parent] {
+			cat := t.byID[id]
+			nodes = append(nodes, &CategoryNode{
+				ID:       cat.ID,
+				Name:     cat.Name,
+				Path:     t.Path(id),
+				Leaf:     t.IsLeaf(id),
+				Children: build(id),
+			})
+		}
+		return nodes
+	}
+	return build("")
+}
+
+// inCategory reports whether the product is in the category named or
+// identified by ref: either tagged with it, or filed under a leaf below it
+func inCategory(p Product, ref string) bool {
+	for _, cat := range p.Categories {
+		if cat == ref {
+			return true
+		}
+	}
+	if p.CategoryID == "" {
+		return false
+	}
+	cat, ok := categoryTree.Resolve(ref)
+	return ok && categoryTree.IsDescendant(p.CategoryID, cat.ID)
+}
+
+// checkProductCategories warns about products filed under a category that
+// is missing from the tree or isn't a leaf
+func checkProductCategories(ctx context.Context, products []Product) {
+	for _, p := range products {
+		if p.CategoryID == "" || categoryTree.IsLeaf(p.CategoryID) {
+			continue
+		}
+		logger.Warn(ctx, "Product is not filed under a leaf category", map[string]interface{}{
+			"product_id":  p.ID,
+			"category_id": p.CategoryID,
+		})
+	}
+}
+
+func getCategoryTree(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "get_category_tree")
+	defer span.End()
+
+	start := time.Now()
+
+	logger.Info(ctx, "Handling get category tree request", map[string]interface{}{"method": "GET", "path": "/categories/tree"})
+
+	nodes := categoryTree.Nodes()
+	span.SetAttributes(attribute.Int("categories_count", len(categoryTree.order)))
+
+	c.JSON(http.StatusOK, nodes)
+
+	duration := time.Since(start).Seconds()
+	requestCount.WithLabelValues("GET", "/categories/tree", "200").Inc()
+	responseTime.WithLabelValues("GET", "/categories/tree").Observe(duration)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"platform"
+)
+
+// Change operations
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// Page size bounds for GET /products/changes
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+)
+
+var (
+	// ErrCursorExpired means changes after the cursor may have been
+	// compacted away, so the caller must resync from GET /products
+	ErrCursorExpired = errors.New("cursor expired")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// ProductChange is one entry of the catalog change feed
+type ProductChange struct {
+	Seq       uint64 `json:"seq"`
+	Op        string `json:"op"`
+	ProductID int    `json:"product_id"`
+	// Product is the product as of this change; deletes leave it out
+	Product *Product  `json:"product,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// ChangePage is a page of the change feed. Cursor resumes after the last
+// change returned.
+type ChangePage struct {
+	Changes []ProductChange `json:"changes"`
+	Cursor  string          `json:"cursor"`
+	HasMore bool            `json:"has_more"`
+}
+
+// ChangeLog records product creates, updates and deletes in order. Cursors
+// are "<epoch>.<seq>"; the epoch is new on every start, since the log is
+// not persisted, so cursors from an earlier process expire.
+//
+// Once the log holds more than maxEntries changes it is compacted: changes
+// superseded by a later change to the same product are dropped, then
+// deletes older than tombstoneTTL, then the oldest changes until it fits.
+// Dropping superseded changes keeps every cursor valid, because a reader
+// still ends up with each product's latest state. The other two steps
+// raise the floor, and cursors below it expire.
+//
+// ChangeLog is not safe for concurrent use; MemoryCatalogStore guards it
+// with its own lock.
+type ChangeLog struct {
+	epoch        string
+	seq          uint64
+	floor        uint64
+	entries      []ProductChange
+	maxEntries   int
+	tombstoneTTL time.Duration
+}
+
+// NewChangeLogFromEnv reads CHANGE_FEED_MAX_ENTRIES (default 1000) and
+// CHANGE_FEED_TOMBSTONE_TTL (default 24h)
+func NewChangeLogFromEnv() *ChangeLog {
+	maxEntries, err := strconv.Atoi(platform.GetEnv("CHANGE_FEED_MAX_ENTRIES", "1000"))
+	if err != nil || maxEntries <= 0 {
+		maxEntries = 1000
+	}
+	tombstoneTTL, err := time.ParseDuration(platform.GetEnv("CHANGE_FEED_TOMBSTONE_TTL", "24h"))
+	if err != nil || tombstoneTTL < 0 {
+		tombstoneTTL = 24 * time.Hour
+	}
+	return NewChangeLog(maxEntries, tombstoneTTL)
+}
+
+func NewChangeLog(maxEntries int, tombstoneTTL time.Duration) *ChangeLog {
+	return &ChangeLog{
+		epoch:        newID(""),
+		maxEntries:   maxEntries,
+		tombstoneTTL: tombstoneTTL,
+	}
+}
+
+// Record appends a change. Deletes pass a nil product.
+func (l *ChangeLog) Record(op string, productID int, product *Product) {
+	l.seq++
+	l.entries = append(l.entries, ProductChange{
+		Seq:       l.seq,
+		Op:        op,
+		ProductID: productID,
+		Product:   product,
+		At:        time.Now().UTC(),
+	})
+	if len(l.entries) > l.maxEntries {
+		l.compact(time.Now())
+	}
+}
+
+func (l *ChangeLog) compact(now time.Time) {
+	latest := make(map[int]uint64, len(l.entries))
+	for _, change := range l.entries {
+		latest[change.ProductID] = change.Seq
+	}
+
+	kept := l.entries[:0]
+	for _, change := range l.entries {
+		if latest[change.ProductID] != change.Seq {
+			continue
+		}
+		if change.Op == ChangeDelete && now.Sub(change.At) > l.tombstoneTTL {
+			l.raiseFloor(change.Seq)
+			continue
+		}
+		kept = append(kept, change)
+	}
+	if excess := len(kept) - l.maxEntries; excess > 0 {
+		l.raiseFloor(kept[excess-1].Seq)
+		kept = kept[excess:]
+	}
+	// Copy so the dropped entries' products can be collected
+	l.entries = append([]ProductChange(nil), kept...)
+}
+
+func (l *ChangeLog) raiseFloor(seq uint64) {
+	if seq > l.floor {
+		l.floor = seq
+	}
+}
+
+// Cursor is the position after the latest change
+func (l *ChangeLog) Cursor() string {
+	return l.epoch + "." + strconv.FormatUint(l.seq, 10)
+}
+
+// parseCursor returns the sequence number a cursor points after. An empty
+// cursor starts from the beginning of the log.
+func (l *ChangeLog) parseCursor(cursor string) (uint64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	epoch, seqStr, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return 0, ErrInvalidCursor
+	}
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	if epoch != l.epoch {
+		return 0, ErrCursorExpired
+	}
+	if seq > l.seq {
+		return 0, ErrInvalidCursor
+	}
+	return seq, nil
+}
+
+// Since returns up to limit changes after cursor, oldest first
+func (l *ChangeLog) Since(cursor string, limit int) (ChangePage, error) {
+	since, err := l.parseCursor(cursor)
+	if err != nil {
+		return ChangePage{}, err
+	}
+	if since < l.floor {
+		return ChangePage{}, ErrCursorExpired
+	}
+
+	start := sort.Search(len(l.entries), func(i int) bool { return l.entries[i].Seq > since })
+	end := start + limit
+	if end > len(l.entries) {
+		end = len(l.entries)
+	}
+	page := ChangePage{
+		Changes: append([]ProductChange{}, l.entries[start:end]...),
+		Cursor:  l.epoch + "." + strconv.FormatUint(since, 10),
+		HasMore: end < len(l.entries),
+	}
+	if end > start {
+		page.Cursor = l.epoch + "." + strconv.FormatUint(l.entries[end-1].Seq, 10)
+	}
+	if !page.HasMore {
+		// Nothing left to read, so skip past compacted sequence numbers
+		page.Cursor = l.Cursor()
+	}
+	return page, nil
+}
+
+// listChanges answers GET /products/changes?since=&limit= so ad-service and
+// search indexes can sync incrementally instead of re-fetching the catalog
+func listChanges(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "list_product_changes")
+	defer span.End()
+
+	start := time.Now()
+
+	limit := defaultChangesLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			requestCount.WithLabelValues("GET", "/products/changes", "400").Inc()
+			return
+		}
+		if n > maxChangesLimit {
+			n = maxChangesLimit
+		}
+		limit = n
+	}
+
+	cursor := c.Query("since")
+	page, err := catalogStore.Changes(cursor, limit)
+	if errors.Is(err, ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		requestCount.WithLabelValues("GET", "/products/changes", "400").Inc()
+		return
+	}
+	if errors.Is(err, ErrCursorExpired) {
+		logger.Info(ctx, "Change feed cursor expired", map[string]interface{}{"cursor": cursor})
+		c.JSON(http.StatusGone, gin.H{
+			"error":  "Cursor expired; resync from GET /products and resume from its X-Changes-Cursor",
+			"resync": "/products",
+		})
+		requestCount.WithLabelValues("GET", "/products/changes", "410").Inc()
+		return
+	}
+
+	span.SetAttributes(
+		attribute.Int("changes_count", len(page.Changes)),
+		attribute.Bool("has_more", page.HasMore),
+	)
+	c.JSON(http.StatusOK, page)
+
+	duration := time.Since(start).Seconds()
+	requestCount.WithLabelValues("GET", "/products/changes", "200").Inc()
+	responseTime.WithLabelValues("GET", "/products/changes").Observe(duration)
+}
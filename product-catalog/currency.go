@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"platform"
+)
+
+// Where the rates a conversion used came from, also the values of the
+// conversions counter's rates label
+const (
+	ratesFresh       = "fresh"
+	ratesStale       = "stale"
+	ratesUnavailable = "unavailable"
+)
+
+var errCurrencyCircuitOpen = errors.New("currency-service circuit breaker is open")
+
+var (
+	currencyRateFetches = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "product_catalog_currency_rate_fetches_total",
+			Help: "Number of exchange rate fetches from currency-service by result: success, error or circuit_open",
+		},
+		[]string{"result"},
+	)
+	currencyConversions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "product_catalog_currency_conversions_total",
+			Help: "Number of ?currency= responses by the rates used: fresh, stale or unavailable (prices left unconverted)",
+		},
+		[]string{"rates"},
+	)
+	currencyCircuitState = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "product_catalog_currency_circuit_state",
+			Help: "State of the currency-service circuit breaker (0 closed, 1 half-open, 2 open)",
+		},
+	)
+)
+
+// currencyBreaker stops calling currency-service after consecutive failed
+// rate fetches, and lets one fetch through once openTimeout has passed
+type currencyBreaker struct {
+	mu          sync.Mutex
+	threshold   int
+	openTimeout time.Duration
+	failures    int
+	openedAt    time.Time
+	open        bool
+	probing     bool
+}
+
+func (b *currencyBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return true
+	}
+	if b.probing || time.Since(b.openedAt) < b.openTimeout {
+		return false
+	}
+	b.probing = true
+	currencyCircuitState.Set(1)
+	return true
+}
+
+func (b *currencyBreaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if ok {
+		b.failures = 0
+		b.open = false
+		currencyCircuitState.Set(0)
+		return
+	}
+	b.failures++
+	if b.open || b.failures >= b.threshold {
+		b.open = true
+		b.openedAt = time.Now()
+		currencyCircuitState.Set(2)
+	}
+}
+
+// rateFetch is a fetch that concurrent callers wait on together
+type rateFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// CurrencyRates caches currency-service's exchange rates. All rates come
+// from one GET /rates call, so a page of products in several currencies
+// costs at most one request. Rates younger than ttl are used as they are;
+// older ones, up to maxStale, are still used while a background fetch
+// replaces them, so a slow or failing currency-service never holds up a
+// catalog response that has rates to fall back on.
+type CurrencyRates struct {
+	baseURL  string
+	client   *http.Client
+	ttl      time.Duration
+	maxStale time.Duration
+	breaker  *currencyBreaker
+
+	mu        sync.Mutex
+	rates     map[string]float64 // units per USD
+	fetchedAt time.Time
+	inflight  *rateFetch
+}
+
+var currencyRates *CurrencyRates
+
+// NewCurrencyRatesFromEnv reads CURRENCY_SERVICE (default
+// http://localhost:8082), CURRENCY_RATE_TTL (default 5m),
+// CURRENCY_RATE_MAX_STALENESS (default 1h), CURRENCY_TIMEOUT (default 1s),
+// CURRENCY_CB_FAILURE_THRESHOLD (default 5) and CURRENCY_CB_OPEN_TIMEOUT
+// (default 30s)
+func NewCurrencyRatesFromEnv() *CurrencyRates {
+	envDuration := func(key string, fallback time.Duration) time.Duration {
+		if d, err := time.ParseDuration(platform.GetEnv(key, "")); err == nil && d > 0 {
+			return d
+		}
+		return fallback
+	}
+	threshold, err := strconv.Atoi(platform.GetEnv("CURRENCY_CB_FAILURE_THRESHOLD", "5"))
+	if err != nil || threshold <= 0 {
+		threshold = 5
+	}
+	return &CurrencyRates{
+		baseURL:  strings.TrimRight(platform.GetEnv("CURRENCY_SERVICE", "http://localhost:8082"), "/"),
+		client:   platform.NewHTTPClient(logger, envDuration("CURRENCY_TIMEOUT", time.Second)),
+		ttl:      envDuration("CURRENCY_RATE_TTL", 5*time.Minute),
+		maxStale: envDuration("CURRENCY_RATE_MAX_STALENESS", time.Hour),
+		breaker: &currencyBreaker{
+			threshold:   threshold,
+			openTimeout: envDuration("CURRENCY_CB_OPEN_TIMEOUT", 30*time.Second),
+		},
+	}
+}
+
+// Age is how old the held rates are, or -1 when there are none
+func (r *CurrencyRates) Age() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rates == nil {
+		return -1
+	}
+	return time.Since(r.fetchedAt).Seconds()
+}
+
+// Rates returns the rates to convert with, how old they are and whether
+// they are fresh or stale. It only waits on currency-service when there
+// are no rates younger than maxStale.
+func (r *CurrencyRates) Rates(ctx context.Context) (map[string]float64, time.Duration, string, error) {
+	r.mu.Lock()
+	rates, age := r.rates, time.Since(r.fetchedAt)
+	refreshing := r.inflight != nil
+	r.mu.Unlock()
+
+	if rates != nil && age < r.ttl {
+		return rates, age, ratesFresh, nil
+	}
+	if rates != nil && age < r.maxStale {
+		if !refreshing {
+			// Keep the caller's trace, but not its deadline
+			bg := trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+			go r.refresh(bg)
+		}
+		return rates, age, ratesStale, nil
+	}
+
+	if err := r.refresh(ctx); err != nil {
+		return nil, 0, ratesUnavailable, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rates, time.Since(r.fetchedAt), ratesFresh, nil
+}
+
+// refresh fetches new rates, sharing a fetch already in progress
+func (r *CurrencyRates) refresh(ctx context.Context) error {
+	r.mu.Lock()
+	if f := r.inflight; f != nil {
+		r.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	f := &rateFetch{done: make(chan struct{})}
+	r.inflight = f
+	r.mu.Unlock()
+
+	rates, err := r.fetch(ctx)
+
+	r.mu.Lock()
+	if err == nil {
+		r.rates = rates
+		r.fetchedAt = time.Now()
+	}
+	r.inflight = nil
+	r.mu.Unlock()
+	f.err = err
+	close(f.done)
+	return err
+}
+
+func (r *CurrencyRates) fetch(ctx context.Context) (map[string]float64, error) {
+	ctx, span := tracer.Start(ctx, "currency.fetch_rates")
+	defer span.End()
+
+	if !r.breaker.allow() {
+		currencyRateFetches.WithLabelValues("circuit_open").Inc()
+		return nil, errCurrencyCircuitOpen
+	}
+	rates, err := r.get(ctx)
+	r.breaker.record(err == nil)
+	if err != nil {
+		currencyRateFetches.WithLabelValues("error").Inc()
+		span.RecordError(err)
+		logger.Warn(ctx, "Failed to fetch exchange rates", map[string]interface{}{"error": err.Error()})
+		return nil, err
+	}
+	currencyRateFetches.WithLabelValues("success").Inc()
+	span.SetAttributes(attribute.Int("currency.rates", len(rates)))
+	return rates, nil
+}
+
+func (r *CurrencyRates) get(ctx context.Context) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.baseURL+"/rates?base=USD", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("currency-service returned %d", resp.StatusCode)
+	}
+	var body struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding rates: %w", err)
+	}
+	if len(body.Rates) == 0 {
+		return nil, errors.New("currency-service returned no rates")
+	}
+	for currency, rate := range body.Rates {
+		if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+			return nil, fmt.Errorf("currency-service returned an invalid %s rate: %v", currency, rate)
+		}
+	}
+	return body.Rates, nil
+}
+
+// convertPrices returns products priced in currency. Products in a
+// currency the rates don't cover keep their own price and currency.
+func convertPrices(products []Product, currency string, rates map[string]float64) []Product {
+	converted := make([]Product, len(products))
+	for i, p := range products {
+		converted[i] = p
+		from, okFrom := rates[p.Currency]
+		to, okTo := rates[currency]
+		if p.Currency == currency || !okFrom || !okTo {
+			continue
+		}
+		converted[i].Price = math.Round(p.Price*to/from*100) / 100
+		if p.ListPrice != nil {
+			listPrice := math.Round(*p.ListPrice*to/from*100) / 100
+			converted[i].ListPrice = &listPrice
+		}
+		converted[i].Currency = currency
+	}
+	return converted
+}
+
+// applyCurrency converts products to the ?currency= of the request, if
+// any. An unsupported currency is answered with a 400 and reports false.
+// When no usable rates can be had, prices are served unconverted, each
+// still labelled with its own currency, and X-Currency-Fallback says so.
+func applyCurrency(c *gin.Context, products []Product) ([]Product, bool) {
+	currency := strings.ToUpper(c.Query("currency"))
+	if currency == "" {
+		return products, true
+	}
+	supported := false
+	for _, code := range supportedCurrencies {
+		supported = supported || code == currency
+	}
+	if !supported {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency", "supported": supportedCurrencies})
+		return nil, false
+	}
+
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("currency", currency))
+	rates, age, source, err := currencyRates.Rates(ctx)
+	currencyConversions.WithLabelValues(source).Inc()
+	span.SetAttributes(attribute.String("currency.rates", source))
+	if err != nil {
+		logger.Warn(ctx, "Serving unconverted prices", map[string]interface{}{
+			"currency": currency,
+			"error":    err.Error(),
+		})
+		c.Header("X-Currency-Fallback", "unconverted")
+		return products, true
+	}
+
+	c.Header("X-Currency-Rate-Age", strconv.Itoa(int(age.Seconds())))
+	if source == ratesStale {
+		c.Header("X-Currency-Fallback", "stale")
+	}
+	return convertPrices(products, currency, rates), true
+}
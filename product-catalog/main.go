@@ -5,7 +5,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,33 +16,12 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
-	"go.opentelemetry.io/otel/trace"
+	"platform"
 )
 
 // Prometheus metrics
-var (
-	requestCount = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "product_catalog_request_count",
-			Help: "Number of requests received by the product catalog service",
-		},
-		[]string{"method", "endpoint", "status"},
-	)
-	responseTime = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "product_catalog_response_time",
-			Help:    "Response time of the product catalog service",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "endpoint"},
-	)
-)
+var requestCount, responseTime = platform.NewRequestMetrics("product_catalog", "product catalog service")
 
 // Product represents a product in the catalog
 type Product struct {
@@ -50,50 +32,22 @@ type Product struct {
 	Currency    string   `json:"currency"`
 	ImageURL    string   `json:"image_url"`
 	Categories  []string `json:"categories"`
+	// CategoryID is the leaf of the category tree the product is filed under
+	CategoryID string `json:"category_id,omitempty"`
+	// Rating is derived from the product's reviews
+	Rating RatingSummary `json:"rating"`
+	// ListPrice and PriceRule are set on reads while a pricing rule
+	// overrides Price; they are never stored
+	ListPrice *float64          `json:"list_price,omitempty"`
+	PriceRule *AppliedPriceRule `json:"price_rule,omitempty"`
 }
 
 // Global variables
 var products []Product
 
-var tracer trace.Tracer
-var logger *StructuredLogger
-
-func initOTelSDK(ctx context.Context) (*sdktrace.TracerProvider, error) {
-	otlpEndpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if otlpEndpoint == "" {
-		otlpEndpoint = "http://otel-collector:4318/v1/traces"
-	}
-
-	exporter, err := otlptracehttp.New(ctx,
-		otlptracehttp.WithEndpoint(otlpEndpoint),
-		otlptracehttp.WithInsecure(),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	resources, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String("product-catalog"),
-			attribute.String("deployment.environment", os.Getenv("DEPLOYMENT_ENVIRONMENT")),
-		),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	tracerProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(resources),
-	)
-	otel.SetTracerProvider(tracerProvider)
-	tracer = otel.Tracer("product-catalog")
-	
-	// Initialize logger
-	logger = NewStructuredLogger("product-catalog")
-
-	return tracerProvider, nil
-}
+var telemetry = platform.Telemetry{ServiceName: "product-catalog"}
+var tracer = telemetry.Tracer()
+var logger = platform.NewStructuredLogger("product-catalog")
 
 func initProducts() {
 	products = []Product{
@@ -105,6 +59,7 @@ func initProducts() {
 			Currency:    "USD",
 			ImageURL:    "https://example.com/smartphone.jpg",
 			Categories:  []string{"Electronics", "Phones"},
+			CategoryID:  "phones",
 		},
 		{
 			ID:          2,
@@ -114,6 +69,7 @@ func initProducts() {
 			Currency:    "USD",
 			ImageURL:    "https://example.com/laptop.jpg",
 			Categories:  []string{"Electronics", "Computers"},
+			CategoryID:  "computers",
 		},
 		{
 			ID:          3,
@@ -123,6 +79,7 @@ func initProducts() {
 			Currency:    "USD",
 			ImageURL:    "https://example.com/headphones.jpg",
 			Categories:  []string{"Electronics", "Audio"},
+			CategoryID:  "headphones",
 		},
 		{
 			ID:          4,
@@ -132,6 +89,7 @@ func initProducts() {
 			Currency:    "USD",
 			ImageURL:    "https://example.com/smartwatch.jpg",
 			Categories:  []string{"Electronics", "Wearables"},
+			CategoryID:  "wearables",
 		},
 		{
 			ID:          5,
@@ -141,38 +99,177 @@ func initProducts() {
 			Currency:    "USD",
 			ImageURL:    "https://example.com/speaker.jpg",
 			Categories:  []string{"Electronics", "Audio"},
+			CategoryID:  "speakers",
 		},
 	}
+	suggestIndex = NewSuggestIndex(products)
+}
+
+// categoryNames returns the distinct product categories and category tree
+// names in sorted order
+func categoryNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range categoryTree.Names() {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, p := range catalogStore.ListProducts() {
+		for _, cat := range p.Categories {
+			if !seen[cat] {
+				seen[cat] = true
+				names = append(names, cat)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 func init() {
 	// Register prometheus metrics
-	prometheus.MustRegister(requestCount)
-	prometheus.MustRegister(responseTime)
+	prometheus.MustRegister(rateLimitedRequests)
+	prometheus.MustRegister(requestTimeouts)
+	prometheus.MustRegister(configReloads)
+	prometheus.MustRegister(chaosInjections)
+	prometheus.MustRegister(chaosActiveFaults)
+	prometheus.MustRegister(suggestResults)
+	prometheus.MustRegister(reviewsCreated)
+	prometheus.MustRegister(currencyRateFetches)
+	prometheus.MustRegister(currencyConversions)
+	prometheus.MustRegister(currencyCircuitState)
+	prometheus.MustRegister(priceRuleApplications)
+	prometheus.MustRegister(priceRulesActive)
 
 	// Initialize products
 	initProducts()
+	catalogStore = NewMemoryCatalogStore(products)
+
+	// Exchange rates for ?currency=
+	currencyRates = NewCurrencyRatesFromEnv()
+	prometheus.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "product_catalog_currency_rate_age_seconds",
+			Help: "Age of the exchange rates held for ?currency= conversions, or -1 before the first fetch",
+		},
+		currencyRates.Age,
+	))
 }
 
 func main() {
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Re-read CONFIG_FILE on SIGHUP
+	watchConfigReload(ctx)
+	config.OnReload(logger.LoadSettings)
 
 	// Initialize OpenTelemetry
-	tracerProvider, err := initOTelSDK(ctx)
+	tracerProvider, err := platform.InitTracer(ctx, telemetry)
 	if err != nil {
 		log.Fatalf("Error initializing OpenTelemetry: %v", err)
 	}
 	defer func() {
+		// Flush buffered spans before exiting
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+		defer cancel()
 		if err := tracerProvider.Shutdown(ctx); err != nil {
 			logger.Error(ctx, "Error shutting down tracer provider", map[string]interface{}{"error": err.Error()})
 		}
 	}()
 
-	// Set up Gin
-	router := gin.Default()
+	mp := initMeter()
+	if mp != nil {
+		defer func() {
+			// Push the last metrics before exiting
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := mp.Shutdown(ctx); err != nil {
+				logger.Error(ctx, "Error shutting down meter provider", map[string]interface{}{"error": err.Error()})
+			}
+		}()
+	}
+
+	// Send logs to the collector too when OTEL_LOGS_ENABLED=true
+	logExporter, err := platform.InitLogExport(ctx, logger, telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize log export: %v", err)
+	}
+	if logExporter != nil {
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+			defer cancel()
+			if err := logExporter.Shutdown(ctx); err != nil {
+				log.Printf("Error shutting down log exporter: %v", err)
+			}
+		}()
+	}
+
+	// Scheduled price overrides from PRICING_RULES
+	if err := LoadPriceRulesFromEnv(); err != nil {
+		log.Fatalf("Failed to load pricing rules: %v", err)
+	}
+
+	// Set up Gin without gin.Default's plain-text request logger; the
+	// access log below replaces it
+	router := gin.New()
+
+	// Gzip responses for clients that accept it
+	router.Use(platform.CompressionMiddleware())
+
+	// Correlate logs and errors by X-Request-ID, across services
+	router.Use(platform.RequestIDMiddleware())
 
 	// Add OpenTelemetry middleware
 	router.Use(otelgin.Middleware("product-catalog"))
+	router.Use(platform.MetricsMiddleware("product-catalog"))
+	router.Use(platform.AccessLogMiddleware(logger))
+
+	// Per-route SLO compliance, summarized on /slo
+	slo := platform.NewSLOTrackerFromEnv("product-catalog")
+	router.Use(slo.Middleware())
+
+	// Tag requests slower than their route's recent p99 on the span
+	outliers := platform.NewOutlierDetectorFromEnv("product-catalog", logger)
+	router.Use(outliers.Middleware())
+
+	// Turn handler panics into logged, traced and counted 500s
+	router.Use(platform.RecoveryMiddleware(logger))
+
+	// Browser access from the storefront (CORS_* settings)
+	router.Use(platform.CORSMiddleware(platform.CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "HEAD"},
+		AllowedHeaders: []string{"Content-Type", "X-Request-ID"},
+		ExposedHeaders: []string{"X-Request-ID", "X-Changes-Cursor", "X-Currency-Rate-Age", "X-Currency-Fallback"},
+		MaxAge:         10 * time.Minute,
+	}))
+
+	// Opt-in capture of request and response bodies (DEBUG_RECORDER_*)
+	router.Use(platform.RecorderMiddleware())
+
+	// Per-client rate limiting (disabled unless RATE_LIMIT_RPS is set)
+	router.Use(rateLimitMiddleware(NewRateLimiterFromEnv))
+
+	// Per-request deadlines (REQUEST_TIMEOUT, ROUTE_TIMEOUTS)
+	router.Use(timeoutMiddleware(nil))
+
+	// Injected faults from CHAOS_FAULTS and the /chaos API
+	StartChaosFromConfig()
+	router.Use(chaosMiddleware())
+
+	// Persist products and reviews to disk when configured
+	if path := config.Get("CATALOG_STORE_PATH"); path != "" {
+		fileStore, err := NewFileCatalogStore(path, products)
+		if err != nil {
+			log.Fatalf("Failed to open catalog store %s: %v", path, err)
+		}
+		catalogStore = fileStore
+	}
+	checkProductCategories(ctx, catalogStore.ListProducts())
+	rebuildSuggestIndex()
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
@@ -182,7 +279,24 @@ func main() {
 	})
 
 	// Metrics endpoint
-	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	if platform.PrometheusEnabled() {
+		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
+	router.POST("/config/reload", postConfigReload)
+	registerChaosRoutes(router)
+	platform.RegisterLogLevelRoutes(router, logger)
+	platform.RegisterAuditRoutes(router)
+	platform.RegisterRecordingRoutes(router)
+	platform.RegisterSLORoutes(router, slo)
+	platform.RegisterDependencyRoutes(router, "product-catalog")
+
+	// Hold /readyz at 503 until the collector and downstream services answer
+	startup := platform.NewStartupCheckerFromEnv("product-catalog", logger,
+		telemetry.CollectorDependency(),
+		platform.HTTPDependency("currency-service", platform.GetEnv("CURRENCY_SERVICE", "http://localhost:8082")),
+	)
+	startup.Start(ctx)
+	platform.RegisterStartupRoutes(router, startup)
 
 	// Get all products
 	router.GET("/products", func(c *gin.Context) {
@@ -199,22 +313,41 @@ func main() {
 		}
 
 		var filteredProducts []Product
+		// Taken before the list, so a change feed reader resuming from it
+		// may see a change twice but never misses one
+		c.Header("X-Changes-Cursor", catalogStore.ChangesCursor())
+		all := catalogStore.ListProducts()
 
 		if category != "" {
-			for _, p := range products {
-				for _, cat := range p.Categories {
-					if cat == category {
-						filteredProducts = append(filteredProducts, p)
-						break
-					}
+			for _, p := range all {
+				if inCategory(p, category) {
+					filteredProducts = append(filteredProducts, p)
 				}
 			}
 		} else {
-			filteredProducts = products
+			filteredProducts = all
+		}
+
+		// Highest rated first, for callers that want to favour them
+		if c.Query("sort") == "rating" {
+			sort.SliceStable(filteredProducts, func(i, j int) bool {
+				a, b := filteredProducts[i].Rating, filteredProducts[j].Rating
+				if a.Average != b.Average {
+					return a.Average > b.Average
+				}
+				return a.Count > b.Count
+			})
 		}
 
 		span.SetAttributes(attribute.Int("products_count", len(filteredProducts)))
 
+		filteredProducts = applyPriceRules(c, filteredProducts)
+		filteredProducts, ok := applyCurrency(c, filteredProducts)
+		if !ok {
+			requestCount.WithLabelValues("GET", "/products", "400").Inc()
+			return
+		}
+
 		c.JSON(http.StatusOK, filteredProducts)
 
 		duration := time.Since(start).Seconds()
@@ -222,6 +355,33 @@ func main() {
 		responseTime.WithLabelValues("GET", "/products").Observe(duration)
 	})
 
+	// Search-as-you-type suggestions
+	router.GET("/products/suggest", suggestProducts)
+
+	// Incremental sync of product creates, updates and deletes
+	router.GET("/products/changes", listChanges)
+
+	// List product categories
+	router.GET("/categories", func(c *gin.Context) {
+		ctx, span := tracer.Start(c.Request.Context(), "get_categories")
+		defer span.End()
+
+		start := time.Now()
+
+		names := categoryNames()
+		span.SetAttributes(attribute.Int("categories_count", len(names)))
+		logger.Info(ctx, "Handling get categories request", map[string]interface{}{"method": "GET", "path": "/categories"})
+
+		c.JSON(http.StatusOK, names)
+
+		duration := time.Since(start).Seconds()
+		requestCount.WithLabelValues("GET", "/categories", "200").Inc()
+		responseTime.WithLabelValues("GET", "/categories").Observe(duration)
+	})
+
+	// Category hierarchy
+	router.GET("/categories/tree", getCategoryTree)
+
 	// Get a specific product
 	router.GET("/product/:id", func(c *gin.Context) {
 		ctx, span := tracer.Start(c.Request.Context(), "get_product")
@@ -244,18 +404,22 @@ func main() {
 			return
 		}
 
-		for _, p := range products {
-			if p.ID == id {
-				span.SetAttributes(
-					attribute.String("product_name", p.Name),
-					attribute.Float64("price", p.Price),
-				)
-				c.JSON(http.StatusOK, p)
-				duration := time.Since(start).Seconds()
-				requestCount.WithLabelValues("GET", "/product/:id", "200").Inc()
-				responseTime.WithLabelValues("GET", "/product/:id").Observe(duration)
+		if p, err := catalogStore.GetProduct(id); err == nil {
+			span.SetAttributes(
+				attribute.String("product_name", p.Name),
+				attribute.Float64("price", p.Price),
+			)
+			priced, ok := applyCurrency(c, applyPriceRules(c, []Product{p}))
+			if !ok {
+				requestCount.WithLabelValues("GET", "/product/:id", "400").Inc()
 				return
 			}
+			c.JSON(http.StatusOK, priced[0])
+			recordProductView(ctx, p.ID)
+			duration := time.Since(start).Seconds()
+			requestCount.WithLabelValues("GET", "/product/:id", "200").Inc()
+			responseTime.WithLabelValues("GET", "/product/:id").Observe(duration)
+			return
 		}
 
 		span.SetAttributes(attribute.String("error", "product_not_found"))
@@ -264,12 +428,26 @@ func main() {
 		requestCount.WithLabelValues("GET", "/product/:id", "404").Inc()
 	})
 
+	// Product reviews
+	router.PUT("/product/:id", putProduct)
+	router.DELETE("/product/:id", deleteProduct)
+	router.GET("/product/:id/reviews", listReviews)
+	router.POST("/product/:id/reviews", createReview)
+
+	// Scheduled price overrides
+	router.GET("/pricing/rules", listPriceRules)
+	router.POST("/pricing/rules", createPriceRule)
+	router.GET("/pricing/rules/:id", getPriceRule)
+	router.DELETE("/pricing/rules/:id", deletePriceRule)
+
 	// Get server port from environment or use default
-	port := os.Getenv("PORT")
+	port := config.Get("PORT")
 	if port == "" {
 		port = "8081"
 	}
 
 	logger.Info(ctx, "Product Catalog Service starting", map[string]interface{}{"port": port})
-	router.Run(":" + port)
+	if err := runServer(ctx, ":"+port, router); err != nil {
+		logger.Error(ctx, "Server error", map[string]interface{}{"error": err.Error()})
+	}
 }
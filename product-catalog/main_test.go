@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"platform/validate"
 )
 
 func setupRouter() *gin.Engine {
@@ -128,3 +133,345 @@ func TestGetProduct(t *testing.T) {
 		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
 	}
 }
+
+func TestCategoryNames(t *testing.T) {
+	initProducts()
+
+	names := categoryNames()
+	expected := []string{"Audio", "Computers", "Electronics", "Phones", "Wearables"}
+
+	if len(names) != len(expected) {
+		t.Fatalf("Expected %d categories, got %d: %v", len(expected), len(names), names)
+	}
+	for i, name := range expected {
+		if names[i] != name {
+			t.Errorf("Expected category %d to be %s, got %s", i, name, names[i])
+		}
+	}
+}
+
+func TestSuggestIndex(t *testing.T) {
+	initProducts()
+
+	tests := []struct {
+		prefix   string
+		limit    int
+		expected []int
+	}{
+		{"sma", 10, []int{4, 1}},
+		{"sma", 1, []int{4}},
+		{"head", 10, []int{3}},
+		{"  Wireless   HEAD", 10, []int{3}},
+		{"series 5", 10, []int{4}},
+		{"smart ", 10, []int{4}},
+		{"tablet", 10, []int{}},
+	}
+	for _, tt := range tests {
+		matches := suggestIndex.Lookup(tt.prefix, tt.limit)
+		if len(matches) != len(tt.expected) {
+			t.Errorf("Lookup(%q, %d): expected %d matches, got %v", tt.prefix, tt.limit, len(tt.expected), matches)
+			continue
+		}
+		for i, id := range tt.expected {
+			if matches[i].ID != id {
+				t.Errorf("Lookup(%q, %d): expected match %d to be product %d, got %d", tt.prefix, tt.limit, i, id, matches[i].ID)
+			}
+		}
+	}
+}
+
+func TestCatalogStoreReviews(t *testing.T) {
+	initProducts()
+	store := NewMemoryCatalogStore(products)
+
+	for _, rating := range []int{5, 4, 4} {
+		if _, err := store.AddReview(Review{ProductID: 2, Rating: rating}); err != nil {
+			t.Fatalf("Failed to add review: %v", err)
+		}
+	}
+	if _, err := store.AddReview(Review{ProductID: 999, Rating: 5}); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for unknown product, got %v", err)
+	}
+
+	product, err := store.GetProduct(2)
+	if err != nil {
+		t.Fatalf("Failed to get product: %v", err)
+	}
+	if product.Rating.Count != 3 || product.Rating.Average != 4.33 {
+		t.Errorf("Expected rating 4.33 from 3 reviews, got %.2f from %d", product.Rating.Average, product.Rating.Count)
+	}
+
+	reviews, err := store.ListReviews(2)
+	if err != nil {
+		t.Fatalf("Failed to list reviews: %v", err)
+	}
+	if len(reviews) != 3 || reviews[0].Rating != 4 || reviews[2].Rating != 5 {
+		t.Errorf("Expected 3 reviews newest first, got %v", reviews)
+	}
+
+	if unrated, _ := store.GetProduct(1); unrated.Rating.Count != 0 {
+		t.Errorf("Expected product 1 to have no reviews, got %d", unrated.Rating.Count)
+	}
+}
+
+func TestCategoryHierarchy(t *testing.T) {
+	initProducts()
+
+	tests := []struct {
+		category string
+		expected []int
+	}{
+		{"Electronics", []int{1, 2, 3, 4, 5}},
+		{"Audio", []int{3, 5}},
+		{"Headphones", []int{3}},
+		{"speakers", []int{5}},
+		{"Tablets", []int{}},
+	}
+	for _, tt := range tests {
+		matched := []int{}
+		for _, p := range products {
+			if inCategory(p, tt.category) {
+				matched = append(matched, p.ID)
+			}
+		}
+		if len(matched) != len(tt.expected) {
+			t.Errorf("Category %q: expected products %v, got %v", tt.category, tt.expected, matched)
+			continue
+		}
+		for i, id := range tt.expected {
+			if matched[i] != id {
+				t.Errorf("Category %q: expected products %v, got %v", tt.category, tt.expected, matched)
+				break
+			}
+		}
+	}
+
+	path := categoryTree.Path("headphones")
+	if len(path) != 3 || path[0] != "Electronics" || path[2] != "Headphones" {
+		t.Errorf("Expected path Electronics > Audio > Headphones, got %v", path)
+	}
+	if categoryTree.IsLeaf("audio") || !categoryTree.IsLeaf("headphones") {
+		t.Errorf("Expected audio to be a parent and headphones a leaf")
+	}
+}
+
+func TestChangeLog(t *testing.T) {
+	initProducts()
+	store := NewMemoryCatalogStore(products)
+
+	page, err := store.Changes("", 10)
+	if err != nil {
+		t.Fatalf("Failed to read changes: %v", err)
+	}
+	if len(page.Changes) != len(products) || page.Changes[0].Op != ChangeCreate || page.HasMore {
+		t.Fatalf("Expected %d seeded creates, got %v", len(products), page.Changes)
+	}
+	cursor := page.Cursor
+
+	updated := products[1]
+	updated.Price = 1199.99
+	if _, created, _ := store.PutProduct(updated); created {
+		t.Errorf("Expected product 2 to be updated, not created")
+	}
+	if err := store.DeleteProduct(5); err != nil {
+		t.Fatalf("Failed to delete product: %v", err)
+	}
+	if err := store.DeleteProduct(5); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound deleting product 5 twice, got %v", err)
+	}
+
+	page, err = store.Changes(cursor, 1)
+	if err != nil {
+		t.Fatalf("Failed to read changes: %v", err)
+	}
+	if len(page.Changes) != 1 || page.Changes[0].Op != ChangeUpdate || page.Changes[0].Product.Price != 1199.99 || !page.HasMore {
+		t.Fatalf("Expected the product 2 update with more to come, got %+v", page)
+	}
+	page, _ = store.Changes(page.Cursor, 10)
+	if len(page.Changes) != 1 || page.Changes[0].Op != ChangeDelete || page.Changes[0].Product != nil {
+		t.Fatalf("Expected the product 5 delete, got %+v", page)
+	}
+
+	if _, err := store.Changes("bogus", 10); err != ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+	if _, err := store.Changes("other-epoch.1", 10); err != ErrCursorExpired {
+		t.Errorf("Expected ErrCursorExpired for a cursor from another process, got %v", err)
+	}
+
+	// Past maxEntries, superseded changes are compacted without expiring
+	// cursors, and truncation expires the ones it skips
+	changes := NewChangeLog(3, time.Hour)
+	for i := 0; i < 3; i++ {
+		changes.Record(ChangeUpdate, 1, &Product{ID: 1})
+	}
+	changes.Record(ChangeCreate, 2, &Product{ID: 2})
+	if page, err := changes.Since(changes.epoch+".1", 10); err != nil || len(page.Changes) != 2 {
+		t.Errorf("Expected the latest change to each product after compaction, got %v, %v", page.Changes, err)
+	}
+	changes.Record(ChangeCreate, 3, &Product{ID: 3})
+	changes.Record(ChangeCreate, 4, &Product{ID: 4})
+	if _, err := changes.Since(changes.epoch+".1", 10); err != ErrCursorExpired {
+		t.Errorf("Expected ErrCursorExpired below the compaction floor, got %v", err)
+	}
+	if _, err := changes.Since("", 10); err != ErrCursorExpired {
+		t.Errorf("Expected an empty cursor to expire once history is truncated, got %v", err)
+	}
+}
+
+func TestValidateProduct(t *testing.T) {
+	initProducts()
+	for _, p := range products {
+		if err := validateProduct(p); err != nil {
+			t.Errorf("Expected seeded product %d to be valid, got %v", p.ID, err)
+		}
+	}
+
+	p := products[0]
+	p.Name = " "
+	p.Price = -1
+	p.Currency = "XYZ"
+	p.ImageURL = "smartphone.jpg"
+	p.Categories = []string{"Electronics", "Toys"}
+	err := validateProduct(p)
+	errs, ok := err.(validate.Errors)
+	if !ok {
+		t.Fatalf("Expected validate.Errors, got %v", err)
+	}
+	fields := make(map[string]bool)
+	for _, f := range errs {
+		fields[f.Field] = true
+	}
+	for _, field := range []string{"name", "price", "currency", "image_url", "categories[1]"} {
+		if !fields[field] {
+			t.Errorf("Expected an error for %s, got %v", field, errs)
+		}
+	}
+	if len(errs) != 5 {
+		t.Errorf("Expected 5 field errors, got %v", errs)
+	}
+}
+
+func TestCurrencyRates(t *testing.T) {
+	var fail atomic.Bool
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"base":  "USD",
+			"rates": map[string]float64{"USD": 1, "EUR": 0.85, "JPY": 110},
+		})
+	}))
+	defer server.Close()
+
+	rates := &CurrencyRates{
+		baseURL:  server.URL,
+		client:   server.Client(),
+		ttl:      time.Hour,
+		maxStale: 2 * time.Hour,
+		breaker:  &currencyBreaker{threshold: 1, openTimeout: time.Hour},
+	}
+	age := func(d time.Duration) {
+		rates.mu.Lock()
+		rates.fetchedAt = time.Now().Add(-d)
+		rates.mu.Unlock()
+	}
+
+	got, _, source, err := rates.Rates(context.Background())
+	if err != nil || source != ratesFresh {
+		t.Fatalf("Expected fresh rates, got %s, %v", source, err)
+	}
+	converted := convertPrices([]Product{{ID: 1, Price: 10, Currency: "EUR"}, {ID: 2, Price: 5, Currency: "JPY"}}, "USD", got)
+	if converted[0].Price != 11.76 || converted[0].Currency != "USD" {
+		t.Errorf("Expected 10 EUR to be 11.76 USD, got %v %s", converted[0].Price, converted[0].Currency)
+	}
+	if converted[1].Price != 0.05 {
+		t.Errorf("Expected 5 JPY to be 0.05 USD, got %v", converted[1].Price)
+	}
+
+	// Stale rates are served while currency-service fails, and the failed
+	// refresh opens the circuit
+	fail.Store(true)
+	age(90 * time.Minute)
+	if _, _, source, err := rates.Rates(context.Background()); err != nil || source != ratesStale {
+		t.Errorf("Expected stale rates, got %s, %v", source, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for fetches.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Past maxStale there's nothing to fall back on, and the open circuit
+	// keeps the request from waiting on currency-service
+	age(3 * time.Hour)
+	for {
+		rates.mu.Lock()
+		busy := rates.inflight != nil
+		rates.mu.Unlock()
+		if !busy {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, _, source, err := rates.Rates(context.Background()); !errors.Is(err, errCurrencyCircuitOpen) || source != ratesUnavailable {
+		t.Errorf("Expected the open circuit to refuse the fetch, got %s, %v", source, err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("Expected 2 requests to currency-service, got %d", n)
+	}
+}
+
+func TestPriceRules(t *testing.T) {
+	initProducts()
+	at := func(value string) time.Time {
+		parsed, _ := time.Parse(time.RFC3339, value)
+		return parsed
+	}
+	flashPrice := 499.0
+	starts, ends := at("2026-10-16T20:00:00Z"), at("2026-10-17T00:00:00Z")
+	happyHour := PriceRule{Name: "Happy hour", DiscountPercent: 20, DailyStart: "22:00", DailyEnd: "02:00", Days: []string{"Fri"}}
+	flashSale := PriceRule{Name: "Flash sale", ProductIDs: []int{1}, Price: &flashPrice, StartsAt: &starts, EndsAt: &ends, Priority: 1}
+	for _, rule := range []*PriceRule{&happyHour, &flashSale} {
+		if err := validatePriceRule(rule); err != nil {
+			t.Fatalf("Expected %s to be valid, got %v", rule.Name, err)
+		}
+	}
+	invalid := PriceRule{Name: "Broken", DiscountPercent: 10, Price: &flashPrice, DailyStart: "25:00", DailyEnd: "02:00", Timezone: "Mars/Olympus"}
+	errs, ok := validatePriceRule(&invalid).(validate.Errors)
+	if !ok || len(errs) != 3 {
+		t.Errorf("Expected 3 field errors, got %v", errs)
+	}
+
+	rules := NewPriceRules()
+	happyHour = rules.Add(happyHour)
+	flashSale = rules.Add(flashSale)
+
+	// Friday 23:00: both rules are active, and the flash sale outranks the
+	// happy hour for the product it names
+	priced := rules.Apply(products[:2], at("2026-10-16T23:00:00Z"))
+	if priced[0].Price != 499 || priced[0].PriceRule.ID != flashSale.ID || *priced[0].ListPrice != 699.99 {
+		t.Errorf("Expected the flash sale price for product 1, got %v", priced[0])
+	}
+	if priced[1].Price != 1039.99 || priced[1].PriceRule.ID != happyHour.ID {
+		t.Errorf("Expected 20%% off product 2, got %v", priced[1])
+	}
+	if until := priced[1].PriceRule.Until; until == nil || !until.Equal(at("2026-10-17T02:00:00Z")) {
+		t.Errorf("Expected the happy hour to run until 02:00, got %v", until)
+	}
+
+	// The window opened on Friday still applies after midnight, but not on
+	// Saturday night
+	if priced := rules.Apply(products[:1], at("2026-10-17T01:00:00Z")); priced[0].PriceRule == nil || priced[0].PriceRule.ID != happyHour.ID {
+		t.Errorf("Expected the happy hour after midnight, got %v", priced[0])
+	}
+	if priced := rules.Apply(products[:1], at("2026-10-17T23:00:00Z")); priced[0].PriceRule != nil || priced[0].Price != 699.99 {
+		t.Errorf("Expected the list price on Saturday night, got %v", priced[0])
+	}
+	if products[0].ListPrice != nil {
+		t.Error("Expected stored products to keep their list price")
+	}
+}
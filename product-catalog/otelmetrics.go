@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"platform"
+)
+
+// OpenTelemetry instruments, exported over OTLP alongside the Prometheus
+// metrics on /metrics
+var (
+	productViewCounter metric.Int64Counter
+)
+
+// initMeter exports metrics over OTLP and creates the business instruments.
+// It returns nil when OTEL_METRICS_ENABLED=false; the instruments are then
+// no-ops.
+func initMeter() *sdkmetric.MeterProvider {
+	mp, err := platform.InitMeter(context.Background(), telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize metrics: %v", err)
+	}
+
+	meter := otel.Meter("product-catalog")
+	productViewCounter, _ = meter.Int64Counter("product.views", metric.WithDescription("Number of product detail lookups by product"))
+
+	return mp
+}
+
+// recordProductView counts a successful product detail lookup
+func recordProductView(ctx context.Context, productID int) {
+	productViewCounter.Add(ctx, 1, metric.WithAttributes(attribute.Int("product.id", productID)))
+}
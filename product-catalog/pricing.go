@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	// Rules name their timezone, and the alpine image has no zoneinfo
+	_ "time/tzdata"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"platform"
+	"platform/validate"
+)
+
+var (
+	priceRuleApplications = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "product_catalog_price_rule_applications_total",
+			Help: "Number of product prices served with a pricing rule applied, by rule",
+		},
+		[]string{"rule"},
+	)
+	priceRulesActive = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "product_catalog_price_rules_active",
+			Help: "Number of pricing rules whose schedule is active now",
+		},
+		func() float64 {
+			return float64(len(priceRules.Active(time.Now())))
+		},
+	)
+)
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// PriceRule overrides the price of matching products while its schedule is
+// active: between StartsAt and EndsAt, and within the daily window from
+// DailyStart to DailyEnd (e.g. a happy hour) on Days, in Timezone. Unset
+// parts of the schedule don't restrict it. A rule matches ProductIDs, or
+// products in Category, or every product when neither is set.
+type PriceRule struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	ProductIDs []int  `json:"product_ids,omitempty"`
+	Category   string `json:"category,omitempty"`
+	// DiscountPercent takes a percentage off the list price; Price
+	// replaces it, in the product's own currency. Rules set one of them.
+	DiscountPercent float64  `json:"discount_percent,omitempty"`
+	Price           *float64 `json:"price,omitempty"`
+
+	StartsAt   *time.Time `json:"starts_at,omitempty"`
+	EndsAt     *time.Time `json:"ends_at,omitempty"`
+	DailyStart string     `json:"daily_start,omitempty"`
+	DailyEnd   string     `json:"daily_end,omitempty"`
+	Days       []string   `json:"days,omitempty"`
+	Timezone   string     `json:"timezone,omitempty"`
+
+	// Priority picks between active rules for the same product, highest
+	// first; ties go to the lower price
+	Priority  int       `json:"priority"`
+	CreatedAt time.Time `json:"created_at"`
+
+	location *time.Location
+}
+
+// AppliedPriceRule is the rule behind a product's price in a response
+type AppliedPriceRule struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Until is when the rule's current window closes, if it does
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// parseClock reads "HH:MM" as minutes after midnight
+func parseClock(value string) (int, bool) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// validatePriceRule checks a rule created through POST /pricing/rules and
+// resolves its timezone
+func validatePriceRule(r *PriceRule) error {
+	var v validate.Validator
+	v.Required("name", r.Name)
+	v.Check((r.Price == nil) != (r.DiscountPercent == 0), "discount_percent", "set exactly one of price and discount_percent")
+	v.Check(r.DiscountPercent >= 0 && r.DiscountPercent <= 100, "discount_percent", "must be between 0 and 100")
+	if r.Price != nil {
+		v.NonNegative("price", *r.Price)
+	}
+	for i, id := range r.ProductIDs {
+		v.Check(id > 0, fmt.Sprintf("product_ids[%d]", i), "must be a positive product ID")
+	}
+	if r.Category != "" {
+		_, ok := categoryTree.Resolve(r.Category)
+		v.Check(ok, "category", "must be a category from GET /categories/tree")
+	}
+	v.Check(r.StartsAt == nil || r.EndsAt == nil || r.EndsAt.After(*r.StartsAt), "ends_at", "must be after starts_at")
+
+	start, okStart := parseClock(r.DailyStart)
+	end, okEnd := parseClock(r.DailyEnd)
+	if r.DailyStart != "" || r.DailyEnd != "" {
+		v.Check(okStart, "daily_start", "must be a time of day as HH:MM")
+		v.Check(okEnd, "daily_end", "must be a time of day as HH:MM")
+		v.Check(!okStart || !okEnd || start != end, "daily_end", "must differ from daily_start")
+	}
+	for i, day := range r.Days {
+		r.Days[i] = strings.ToLower(day)
+		v.OneOf(fmt.Sprintf("days[%d]", i), r.Days[i], weekdays)
+	}
+	r.location = time.UTC
+	if r.Timezone != "" {
+		loc, err := time.LoadLocation(r.Timezone)
+		v.Check(err == nil, "timezone", "must be an IANA timezone such as Europe/London")
+		if err == nil {
+			r.location = loc
+		}
+	}
+	return v.Errors()
+}
+
+// activeUntil reports whether the rule's schedule is active at now, and
+// when its current window closes (zero if it doesn't)
+func (r *PriceRule) activeUntil(now time.Time) (bool, time.Time) {
+	if r.StartsAt != nil && now.Before(*r.StartsAt) {
+		return false, time.Time{}
+	}
+	if r.EndsAt != nil && !now.Before(*r.EndsAt) {
+		return false, time.Time{}
+	}
+	var until time.Time
+	if r.EndsAt != nil {
+		until = *r.EndsAt
+	}
+	if r.DailyStart == "" {
+		return true, until
+	}
+
+	local := now.In(r.location)
+	minute := local.Hour()*60 + local.Minute()
+	start, _ := parseClock(r.DailyStart)
+	end, _ := parseClock(r.DailyEnd)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, r.location)
+
+	// A window past midnight, e.g. 22:00-02:00, belongs to the day it
+	// opened on
+	day := local.Weekday()
+	closes := midnight.Add(time.Duration(end) * time.Minute)
+	switch {
+	case start < end:
+		if minute < start || minute >= end {
+			return false, time.Time{}
+		}
+	case minute >= start:
+		closes = closes.AddDate(0, 0, 1)
+	case minute < end:
+		day = (day + 6) % 7
+	default:
+		return false, time.Time{}
+	}
+	if len(r.Days) > 0 && !containsDay(r.Days, weekdays[day]) {
+		return false, time.Time{}
+	}
+	if until.IsZero() || closes.Before(until) {
+		until = closes
+	}
+	return true, until
+}
+
+func containsDay(days []string, day string) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *PriceRule) matches(p Product) bool {
+	if len(r.ProductIDs) == 0 && r.Category == "" {
+		return true
+	}
+	for _, id := range r.ProductIDs {
+		if id == p.ID {
+			return true
+		}
+	}
+	return r.Category != "" && inCategory(p, r.Category)
+}
+
+func (r *PriceRule) priceFor(listPrice float64) float64 {
+	if r.Price != nil {
+		return *r.Price
+	}
+	return math.Round(listPrice*(100-r.DiscountPercent)) / 100
+}
+
+// PriceRules holds the pricing rules, in memory. They are evaluated when
+// products are read, so a rule takes effect the moment its window opens
+// without anything being rewritten; stored products and the change feed
+// always carry list prices.
+type PriceRules struct {
+	mu    sync.RWMutex
+	rules map[string]*PriceRule
+}
+
+var priceRules = NewPriceRules()
+
+func NewPriceRules() *PriceRules {
+	return &PriceRules{rules: make(map[string]*PriceRule)}
+}
+
+// LoadPriceRulesFromEnv adds the rules in PRICING_RULES, a JSON array of
+// rules in the POST /pricing/rules format
+func LoadPriceRulesFromEnv() error {
+	raw := platform.Get("PRICING_RULES")
+	if raw == "" {
+		return nil
+	}
+	var rules []PriceRule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return fmt.Errorf("invalid PRICING_RULES: %w", err)
+	}
+	for i := range rules {
+		if err := validatePriceRule(&rules[i]); err != nil {
+			return fmt.Errorf("invalid PRICING_RULES[%d]: %w", i, err)
+		}
+		priceRules.Add(rules[i])
+	}
+	return nil
+}
+
+// Add stores a validated rule, assigning its ID unless it has one
+func (s *PriceRules) Add(rule PriceRule) PriceRule {
+	if rule.ID == "" {
+		rule.ID = newID("rule_")
+	}
+	rule.CreatedAt = time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules[rule.ID] = &rule
+	return rule
+}
+
+func (s *PriceRules) Get(id string) (PriceRule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rule, ok := s.rules[id]
+	if !ok {
+		return PriceRule{}, false
+	}
+	return *rule, true
+}
+
+func (s *PriceRules) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rules[id]; !ok {
+		return false
+	}
+	delete(s.rules, id)
+	return true
+}
+
+// List returns every rule, oldest first
+func (s *PriceRules) List() []PriceRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]PriceRule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		result = append(result, *rule)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// Active returns the rules whose schedule is active at now
+func (s *PriceRules) Active(now time.Time) []PriceRule {
+	var active []PriceRule
+	for _, rule := range s.List() {
+		if ok, _ := rule.activeUntil(now); ok {
+			active = append(active, rule)
+		}
+	}
+	return active
+}
+
+// Apply prices products by the rules active at now. A product a rule
+// applies to keeps its list price in ListPrice and names the rule in
+// PriceRule.
+func (s *PriceRules) Apply(products []Product, now time.Time) []Product {
+	type activeRule struct {
+		rule  PriceRule
+		until time.Time
+	}
+	var active []activeRule
+	for _, rule := range s.List() {
+		if ok, until := rule.activeUntil(now); ok {
+			active = append(active, activeRule{rule, until})
+		}
+	}
+	if len(active) == 0 {
+		return products
+	}
+
+	priced := make([]Product, len(products))
+	for i, p := range products {
+		priced[i] = p
+		var best *activeRule
+		var bestPrice float64
+		for j := range active {
+			candidate := &active[j]
+			if !candidate.rule.matches(p) {
+				continue
+			}
+			price := candidate.rule.priceFor(p.Price)
+			if best == nil || candidate.rule.Priority > best.rule.Priority ||
+				(candidate.rule.Priority == best.rule.Priority && price < bestPrice) {
+				best, bestPrice = candidate, price
+			}
+		}
+		if best == nil {
+			continue
+		}
+		listPrice := p.Price
+		priced[i].ListPrice = &listPrice
+		priced[i].Price = bestPrice
+		applied := &AppliedPriceRule{ID: best.rule.ID, Name: best.rule.Name}
+		if !best.until.IsZero() {
+			until := best.until.UTC()
+			applied.Until = &until
+		}
+		priced[i].PriceRule = applied
+	}
+	return priced
+}
+
+// applyPriceRules prices products by the active rules and records the
+// rules used on the request's span
+func applyPriceRules(c *gin.Context, products []Product) []Product {
+	priced := priceRules.Apply(products, time.Now())
+	seen := make(map[string]bool)
+	var ruleIDs []string
+	discounted := 0
+	for _, p := range priced {
+		if p.PriceRule == nil {
+			continue
+		}
+		discounted++
+		priceRuleApplications.WithLabelValues(p.PriceRule.ID).Inc()
+		if !seen[p.PriceRule.ID] {
+			seen[p.PriceRule.ID] = true
+			ruleIDs = append(ruleIDs, p.PriceRule.ID)
+		}
+	}
+	if discounted > 0 {
+		span := trace.SpanFromContext(c.Request.Context())
+		span.SetAttributes(
+			attribute.StringSlice("pricing.rule_ids", ruleIDs),
+			attribute.Int("pricing.repriced_products", discounted),
+		)
+		if len(priced) == 1 {
+			span.SetAttributes(
+				attribute.Float64("pricing.list_price", *priced[0].ListPrice),
+				attribute.Float64("pricing.price", priced[0].Price),
+			)
+		}
+	}
+	return priced
+}
+
+func listPriceRules(c *gin.Context) {
+	rules := priceRules.List()
+	if c.Query("active") == "true" {
+		rules = priceRules.Active(time.Now())
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+func createPriceRule(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "create_price_rule")
+	defer span.End()
+
+	var rule PriceRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule: " + err.Error()})
+		requestCount.WithLabelValues("POST", "/pricing/rules", "400").Inc()
+		return
+	}
+	rule.ID = ""
+	if err := validatePriceRule(&rule); err != nil {
+		validate.Respond(c, "Pricing rule failed validation", err)
+		requestCount.WithLabelValues("POST", "/pricing/rules", "422").Inc()
+		return
+	}
+
+	rule = priceRules.Add(rule)
+	span.SetAttributes(attribute.String("pricing.rule_id", rule.ID))
+	logger.Info(ctx, "Pricing rule created", map[string]interface{}{
+		"rule_id":          rule.ID,
+		"name":             rule.Name,
+		"product_ids":      rule.ProductIDs,
+		"category":         rule.Category,
+		"discount_percent": rule.DiscountPercent,
+		"priority":         rule.Priority,
+	})
+	platform.RecordAudit(c, "pricing_rule.create", map[string]interface{}{"rule_id": rule.ID, "name": rule.Name})
+	c.JSON(http.StatusCreated, rule)
+	requestCount.WithLabelValues("POST", "/pricing/rules", "201").Inc()
+}
+
+func getPriceRule(c *gin.Context) {
+	rule, ok := priceRules.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pricing rule not found"})
+		return
+	}
+	active, _ := rule.activeUntil(time.Now())
+	c.JSON(http.StatusOK, gin.H{"rule": rule, "active": active})
+}
+
+func deletePriceRule(c *gin.Context) {
+	id := c.Param("id")
+	if !priceRules.Delete(id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pricing rule not found"})
+		requestCount.WithLabelValues("DELETE", "/pricing/rules/:id", "404").Inc()
+		return
+	}
+	logger.Info(c.Request.Context(), "Pricing rule deleted", map[string]interface{}{"rule_id": id})
+	platform.RecordAudit(c, "pricing_rule.delete", map[string]interface{}{"rule_id": id})
+	c.Status(http.StatusNoContent)
+	requestCount.WithLabelValues("DELETE", "/pricing/rules/:id", "204").Inc()
+}
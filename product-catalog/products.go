@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"platform"
+	"platform/validate"
+)
+
+// supportedCurrencies are the product currencies accepted, from
+// SUPPORTED_CURRENCIES (default: those currency-service converts)
+var supportedCurrencies = supportedCurrenciesFromEnv()
+
+func supportedCurrenciesFromEnv() []string {
+	var codes []string
+	for _, code := range strings.Split(platform.GetEnv("SUPPORTED_CURRENCIES", ""), ",") {
+		if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return validate.DefaultCurrencies
+	}
+	return codes
+}
+
+// validateProduct checks a product written through PUT /product/:id and
+// returns every field that is wrong as validate.Errors
+func validateProduct(p Product) error {
+	var v validate.Validator
+	v.Required("name", p.Name)
+	v.NonNegative("price", p.Price)
+	v.Currency("currency", p.Currency, supportedCurrencies)
+	v.URL("image_url", p.ImageURL)
+	// Category tags must name a category of the tree, by name or ID
+	for i, cat := range p.Categories {
+		_, ok := categoryTree.Resolve(cat)
+		v.Check(ok, fmt.Sprintf("categories[%d]", i), "must be a category from GET /categories/tree")
+	}
+	v.Check(p.CategoryID == "" || categoryTree.IsLeaf(p.CategoryID), "category_id", "must be a leaf of the category tree")
+	return v.Errors()
+}
+
+// rebuildSuggestIndex re-indexes product names after a product is written
+func rebuildSuggestIndex() {
+	index := NewSuggestIndex(catalogStore.ListProducts())
+	suggestMu.Lock()
+	suggestIndex = index
+	suggestMu.Unlock()
+}
+
+// putProduct creates or replaces a product. The change shows up in
+// GET /products/changes.
+func putProduct(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "put_product")
+	defer span.End()
+
+	start := time.Now()
+	idStr := c.Param("id")
+	span.SetAttributes(attribute.String("product_id", idStr))
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		requestCount.WithLabelValues("PUT", "/product/:id", "400").Inc()
+		return
+	}
+
+	var p Product
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product: " + err.Error()})
+		requestCount.WithLabelValues("PUT", "/product/:id", "400").Inc()
+		return
+	}
+	p.ID = id
+	// Ratings are derived from reviews, and pricing rules apply on reads
+	p.Rating = RatingSummary{}
+	p.ListPrice, p.PriceRule = nil, nil
+	if p.Currency == "" {
+		p.Currency = "USD"
+	}
+	if err := validateProduct(p); err != nil {
+		validate.Respond(c, "Product failed validation", err)
+		requestCount.WithLabelValues("PUT", "/product/:id", "422").Inc()
+		return
+	}
+
+	p, created, err := catalogStore.PutProduct(p)
+	if err != nil {
+		logger.Error(ctx, "Failed to store product", map[string]interface{}{"product_id": id, "error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store product"})
+		requestCount.WithLabelValues("PUT", "/product/:id", "500").Inc()
+		return
+	}
+	rebuildSuggestIndex()
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	logger.Info(ctx, "Product written", map[string]interface{}{"product_id": id, "created": created})
+	c.JSON(status, p)
+
+	duration := time.Since(start).Seconds()
+	requestCount.WithLabelValues("PUT", "/product/:id", strconv.Itoa(status)).Inc()
+	responseTime.WithLabelValues("PUT", "/product/:id").Observe(duration)
+}
+
+// deleteProduct removes a product and its reviews
+func deleteProduct(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "delete_product")
+	defer span.End()
+
+	start := time.Now()
+	idStr := c.Param("id")
+	span.SetAttributes(attribute.String("product_id", idStr))
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		requestCount.WithLabelValues("DELETE", "/product/:id", "400").Inc()
+		return
+	}
+
+	err = catalogStore.DeleteProduct(id)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		requestCount.WithLabelValues("DELETE", "/product/:id", "404").Inc()
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to delete product", map[string]interface{}{"product_id": id, "error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
+		requestCount.WithLabelValues("DELETE", "/product/:id", "500").Inc()
+		return
+	}
+	rebuildSuggestIndex()
+
+	logger.Info(ctx, "Product deleted", map[string]interface{}{"product_id": id})
+	c.Status(http.StatusNoContent)
+
+	duration := time.Since(start).Seconds()
+	requestCount.WithLabelValues("DELETE", "/product/:id", "204").Inc()
+	responseTime.WithLabelValues("DELETE", "/product/:id").Observe(duration)
+}
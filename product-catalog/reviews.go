@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Review limits
+const (
+	maxReviewTitle  = 120
+	maxReviewBody   = 2000
+	maxReviewsLimit = 100
+)
+
+var reviewsCreated = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "product_catalog_reviews_created_total",
+		Help: "Number of product reviews submitted by star rating",
+	},
+	[]string{"rating"},
+)
+
+// ReviewRequest is the body of POST /product/:id/reviews
+type ReviewRequest struct {
+	UserID string `json:"user_id"`
+	Rating int    `json:"rating"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+}
+
+func (r ReviewRequest) validate() error {
+	if r.Rating < 1 || r.Rating > 5 {
+		return errors.New("rating must be between 1 and 5")
+	}
+	if len(r.Title) > maxReviewTitle {
+		return errors.New("title must be at most " + strconv.Itoa(maxReviewTitle) + " characters")
+	}
+	if len(r.Body) > maxReviewBody {
+		return errors.New("body must be at most " + strconv.Itoa(maxReviewBody) + " characters")
+	}
+	return nil
+}
+
+// createReview adds a review to the product and returns it with the
+// product's updated rating
+func createReview(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "create_review")
+	defer span.End()
+
+	start := time.Now()
+	idStr := c.Param("id")
+	span.SetAttributes(attribute.String("product_id", idStr))
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		requestCount.WithLabelValues("POST", "/product/:id/reviews", "400").Inc()
+		return
+	}
+
+	var req ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review: " + err.Error()})
+		requestCount.WithLabelValues("POST", "/product/:id/reviews", "400").Inc()
+		return
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	req.Body = strings.TrimSpace(req.Body)
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		requestCount.WithLabelValues("POST", "/product/:id/reviews", "422").Inc()
+		return
+	}
+
+	review, err := catalogStore.AddReview(Review{
+		ProductID: id,
+		UserID:    req.UserID,
+		Rating:    req.Rating,
+		Title:     req.Title,
+		Body:      req.Body,
+	})
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		requestCount.WithLabelValues("POST", "/product/:id/reviews", "404").Inc()
+		return
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to store review", map[string]interface{}{"product_id": id, "error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store review"})
+		requestCount.WithLabelValues("POST", "/product/:id/reviews", "500").Inc()
+		return
+	}
+
+	product, _ := catalogStore.GetProduct(id)
+	span.SetAttributes(
+		attribute.Int("review.rating", review.Rating),
+		attribute.Float64("product.rating", product.Rating.Average),
+	)
+	reviewsCreated.WithLabelValues(strconv.Itoa(review.Rating)).Inc()
+	logger.Info(ctx, "Review created", map[string]interface{}{
+		"product_id":   id,
+		"review_id":    review.ID,
+		"rating":       review.Rating,
+		"review_count": product.Rating.Count,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{"review": review, "rating": product.Rating})
+
+	duration := time.Since(start).Seconds()
+	requestCount.WithLabelValues("POST", "/product/:id/reviews", "201").Inc()
+	responseTime.WithLabelValues("POST", "/product/:id/reviews").Observe(duration)
+}
+
+// listReviews returns the product's newest reviews with its rating summary
+func listReviews(c *gin.Context) {
+	_, span := tracer.Start(c.Request.Context(), "list_reviews")
+	defer span.End()
+
+	start := time.Now()
+	idStr := c.Param("id")
+	span.SetAttributes(attribute.String("product_id", idStr))
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		requestCount.WithLabelValues("GET", "/product/:id/reviews", "400").Inc()
+		return
+	}
+
+	limit := 20
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			requestCount.WithLabelValues("GET", "/product/:id/reviews", "400").Inc()
+			return
+		}
+		if n > maxReviewsLimit {
+			n = maxReviewsLimit
+		}
+		limit = n
+	}
+
+	reviews, err := catalogStore.ListReviews(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		requestCount.WithLabelValues("GET", "/product/:id/reviews", "404").Inc()
+		return
+	}
+	product, _ := catalogStore.GetProduct(id)
+	total := len(reviews)
+	if len(reviews) > limit {
+		reviews = reviews[:limit]
+	}
+	span.SetAttributes(attribute.Int("reviews_count", total))
+
+	c.JSON(http.StatusOK, gin.H{"items": reviews, "total": total, "rating": product.Rating})
+
+	duration := time.Since(start).Seconds()
+	requestCount.WithLabelValues("GET", "/product/:id/reviews", "200").Inc()
+	responseTime.WithLabelValues("GET", "/product/:id/reviews").Observe(duration)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"platform"
+)
+
+const defaultShutdownTimeout = 15 * time.Second
+
+// shutdownTimeout is how long in-flight requests get to drain on shutdown,
+// configurable via SHUTDOWN_TIMEOUT (e.g. "30s")
+func shutdownTimeout() time.Duration {
+	if v := config.Get("SHUTDOWN_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return defaultShutdownTimeout
+}
+
+// runServer serves handler on addr until ctx is cancelled, then stops
+// accepting new connections and waits for in-flight requests to finish. It
+// serves TLS when TLS_CERT_FILE is set.
+func runServer(ctx context.Context, addr string, handler http.Handler) error {
+	tlsConfig, err := platform.ServerTLSConfig(logger)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			logger.Info(context.Background(), "Serving TLS", map[string]interface{}{
+				"addr":        addr,
+				"client_auth": config.Get("TLS_CLIENT_CA_FILE") != "",
+			})
+			// The certificate comes from TLSConfig so it can be reloaded
+			errCh <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := shutdownTimeout()
+	logger.Info(context.Background(), "Shutdown signal received, draining requests", map[string]interface{}{
+		"timeout": timeout.String(),
+	})
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	logger.Info(context.Background(), "Server drained")
+	return nil
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Review is a customer's rating of a product, from 1 to 5 stars
+type Review struct {
+	ID        string    `json:"id"`
+	ProductID int       `json:"product_id"`
+	UserID    string    `json:"user_id,omitempty"`
+	Rating    int       `json:"rating"`
+	Title     string    `json:"title,omitempty"`
+	Body      string    `json:"body,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RatingSummary aggregates a product's reviews. Average is 0 while Count is.
+type RatingSummary struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
+
+// CatalogStore persists products and their reviews. Products it returns
+// carry their current RatingSummary.
+type CatalogStore interface {
+	ListProducts() []Product
+	GetProduct(id int) (Product, error)
+	// PutProduct creates or replaces the product with p.ID and reports
+	// whether it was created
+	PutProduct(p Product) (Product, bool, error)
+	// DeleteProduct removes the product and its reviews
+	DeleteProduct(id int) error
+
+	// Changes returns up to limit product changes after cursor, and
+	// ChangesCursor the position after the latest one; see ChangeLog
+	Changes(cursor string, limit int) (ChangePage, error)
+	ChangesCursor() string
+
+	// ListReviews returns the product's reviews, newest first
+	ListReviews(productID int) ([]Review, error)
+	AddReview(review Review) (Review, error)
+}
+
+var catalogStore CatalogStore
+
+func newID(prefix string) string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+type ratingTotal struct {
+	sum   int
+	count int
+}
+
+func (t ratingTotal) summary() RatingSummary {
+	if t.count == 0 {
+		return RatingSummary{}
+	}
+	average := float64(t.sum) / float64(t.count)
+	return RatingSummary{Average: math.Round(average*100) / 100, Count: t.count}
+}
+
+// MemoryCatalogStore keeps products and reviews in memory. Rating totals
+// are kept up to date as reviews are added, so listing products doesn't
+// walk every review. Every change to a product, including its rating, is
+// recorded in the change log.
+type MemoryCatalogStore struct {
+	mu       sync.RWMutex
+	products []Product
+	reviews  map[int][]Review
+	ratings  map[int]ratingTotal
+	changes  *ChangeLog
+}
+
+func NewMemoryCatalogStore(seed []Product) *MemoryCatalogStore {
+	s := &MemoryCatalogStore{
+		reviews: make(map[int][]Review),
+		ratings: make(map[int]ratingTotal),
+		changes: NewChangeLogFromEnv(),
+	}
+	s.load(seed)
+	return s
+}
+
+// load adds products at startup, recording them as created so a reader
+// starting from an empty cursor sees the whole catalog. Callers must hold
+// s.mu or own s.
+func (s *MemoryCatalogStore) load(products []Product) {
+	for _, p := range products {
+		s.products = append(s.products, p)
+		s.recordChange(ChangeCreate, p)
+	}
+}
+
+// recordChange logs a create or update of p. Callers must hold s.mu.
+func (s *MemoryCatalogStore) recordChange(op string, p Product) {
+	p = s.withRating(p)
+	s.changes.Record(op, p.ID, &p)
+}
+
+// withRating returns p with its rating summary. Callers must hold s.mu.
+func (s *MemoryCatalogStore) withRating(p Product) Product {
+	p.Rating = s.ratings[p.ID].summary()
+	return p
+}
+
+func (s *MemoryCatalogStore) ListProducts() []Product {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]Product, len(s.products))
+	for i, p := range s.products {
+		result[i] = s.withRating(p)
+	}
+	return result
+}
+
+func (s *MemoryCatalogStore) GetProduct(id int) (Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.products {
+		if p.ID == id {
+			return s.withRating(p), nil
+		}
+	}
+	return Product{}, ErrNotFound
+}
+
+func (s *MemoryCatalogStore) PutProduct(p Product) (Product, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.products {
+		if s.products[i].ID == p.ID {
+			s.products[i] = p
+			s.recordChange(ChangeUpdate, p)
+			return s.withRating(p), false, nil
+		}
+	}
+	s.products = append(s.products, p)
+	s.recordChange(ChangeCreate, p)
+	return s.withRating(p), true, nil
+}
+
+func (s *MemoryCatalogStore) DeleteProduct(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range s.products {
+		if p.ID == id {
+			s.products = append(s.products[:i:i], s.products[i+1:]...)
+			delete(s.reviews, id)
+			delete(s.ratings, id)
+			s.changes.Record(ChangeDelete, id, nil)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryCatalogStore) Changes(cursor string, limit int) (ChangePage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changes.Since(cursor, limit)
+}
+
+func (s *MemoryCatalogStore) ChangesCursor() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changes.Cursor()
+}
+
+// hasProduct reports whether the product exists. Callers must hold s.mu.
+func (s *MemoryCatalogStore) hasProduct(id int) bool {
+	for _, p := range s.products {
+		if p.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryCatalogStore) ListReviews(productID int) ([]Review, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.hasProduct(productID) {
+		return nil, ErrNotFound
+	}
+	reviews := s.reviews[productID]
+	result := make([]Review, len(reviews))
+	for i, review := range reviews {
+		result[len(reviews)-1-i] = review
+	}
+	return result, nil
+}
+
+func (s *MemoryCatalogStore) AddReview(review Review) (Review, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.hasProduct(review.ProductID) {
+		return Review{}, ErrNotFound
+	}
+	if review.ID == "" {
+		review.ID = newID("rev-")
+	}
+	if review.CreatedAt.IsZero() {
+		review.CreatedAt = time.Now().UTC()
+	}
+	s.addReview(review)
+	// The product's rating changed
+	for _, p := range s.products {
+		if p.ID == review.ProductID {
+			s.recordChange(ChangeUpdate, p)
+			break
+		}
+	}
+	return review, nil
+}
+
+// addReview appends the review and updates the product's rating total.
+// Callers must hold s.mu.
+func (s *MemoryCatalogStore) addReview(review Review) {
+	s.reviews[review.ProductID] = append(s.reviews[review.ProductID], review)
+	total := s.ratings[review.ProductID]
+	total.sum += review.Rating
+	total.count++
+	s.ratings[review.ProductID] = total
+}
+
+// allReviews returns every review in the order they were added
+func (s *MemoryCatalogStore) allReviews() []Review {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []Review
+	for _, reviews := range s.reviews {
+		result = append(result, reviews...)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// FileCatalogStore is a MemoryCatalogStore that writes a JSON snapshot to
+// disk after every change and loads it on startup
+type FileCatalogStore struct {
+	*MemoryCatalogStore
+	path    string
+	writeMu sync.Mutex
+}
+
+type catalogSnapshot struct {
+	Products []Product `json:"products"`
+	Reviews  []Review  `json:"reviews"`
+}
+
+// NewFileCatalogStore loads the snapshot at path, falling back to seed when
+// the file does not exist yet
+func NewFileCatalogStore(path string, seed []Product) (*FileCatalogStore, error) {
+	s := &FileCatalogStore{MemoryCatalogStore: NewMemoryCatalogStore(nil), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.load(seed)
+		return s, s.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot catalogSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	for _, review := range snapshot.Reviews {
+		s.addReview(review)
+	}
+	s.load(snapshot.Products)
+	return s, nil
+}
+
+func (s *FileCatalogStore) save() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	products := s.ListProducts()
+	// Ratings are derived from the reviews, so they aren't stored
+	for i := range products {
+		products[i].Rating = RatingSummary{}
+	}
+	snapshot := catalogSnapshot{Products: products, Reviews: s.allReviews()}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *FileCatalogStore) PutProduct(p Product) (Product, bool, error) {
+	p, created, err := s.MemoryCatalogStore.PutProduct(p)
+	if err != nil {
+		return p, created, err
+	}
+	return p, created, s.save()
+}
+
+func (s *FileCatalogStore) DeleteProduct(id int) error {
+	if err := s.MemoryCatalogStore.DeleteProduct(id); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *FileCatalogStore) AddReview(review Review) (Review, error) {
+	review, err := s.MemoryCatalogStore.AddReview(review)
+	if err != nil {
+		return review, err
+	}
+	return review, s.save()
+}
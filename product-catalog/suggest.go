@@ -0,0 +1,214 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Suggestion limits. Each prefix keeps at most maxSuggestions matches, and
+// prefixes longer than maxIndexedPrefix runes are matched by filtering the
+// entries of their first maxIndexedPrefix runes.
+const (
+	defaultSuggestions = 5
+	maxSuggestions     = 10
+	maxIndexedPrefix   = 32
+)
+
+var suggestResults = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "product_catalog_suggest_requests_total",
+		Help: "Number of suggestion lookups by whether they matched any product",
+	},
+	[]string{"result"},
+)
+
+// Suggestion is the lightweight product match returned while typing
+type Suggestion struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type suggestEntry struct {
+	Suggestion
+	// normalized is the lower-cased name the prefix is checked against
+	normalized string
+	// rank is 0 when the whole name starts with the prefix and 1 when a
+	// later word does
+	rank int
+}
+
+// SuggestIndex maps every prefix of every word-boundary suffix of the
+// product names to its best matches, so "head" and "wireless head" both
+// find "Wireless Headphones" with a single map lookup
+type SuggestIndex struct {
+	prefixes map[string][]suggestEntry
+}
+
+// suggestIndex is rebuilt whenever the product list is; suggestMu guards
+// swapping it once the server is running
+var (
+	suggestIndex = NewSuggestIndex(nil)
+	suggestMu    sync.RWMutex
+)
+
+// normalizeQuery lower-cases s and collapses runs of whitespace into one
+// space. Leading whitespace is dropped but trailing whitespace is kept, so
+// "smart " only matches names with a word after "smart".
+func normalizeQuery(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.TrimLeftFunc(s, unicode.IsSpace) {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+func NewSuggestIndex(products []Product) *SuggestIndex {
+	prefixes := make(map[string][]suggestEntry)
+	for _, p := range products {
+		name := []rune(strings.TrimSpace(normalizeQuery(p.Name)))
+		seen := make(map[string]bool)
+		for start := range name {
+			if start > 0 && name[start-1] != ' ' {
+				continue
+			}
+			rank := 1
+			if start == 0 {
+				rank = 0
+			}
+			for end := start + 1; end <= len(name) && end-start <= maxIndexedPrefix; end++ {
+				prefix := string(name[start:end])
+				if seen[prefix] {
+					continue
+				}
+				seen[prefix] = true
+				prefixes[prefix] = append(prefixes[prefix], suggestEntry{
+					Suggestion: Suggestion{ID: p.ID, Name: p.Name},
+					normalized: string(name),
+					rank:       rank,
+				})
+			}
+		}
+	}
+
+	for prefix, entries := range prefixes {
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].rank != entries[j].rank {
+				return entries[i].rank < entries[j].rank
+			}
+			return entries[i].Name < entries[j].Name
+		})
+		// Long prefixes are filtered at lookup, so keep every candidate
+		if len(entries) > maxSuggestions && len([]rune(prefix)) < maxIndexedPrefix {
+			prefixes[prefix] = entries[:maxSuggestions]
+		}
+	}
+	return &SuggestIndex{prefixes: prefixes}
+}
+
+// Lookup returns up to limit products with a word starting with prefix,
+// names starting with it first
+func (idx *SuggestIndex) Lookup(prefix string, limit int) []Suggestion {
+	key := normalizeQuery(prefix)
+	runes := []rune(key)
+	long := len(runes) > maxIndexedPrefix
+	if long {
+		key = string(runes[:maxIndexedPrefix])
+	}
+
+	matches := make([]Suggestion, 0, limit)
+	for _, entry := range idx.prefixes[key] {
+		if len(matches) == limit {
+			break
+		}
+		if long && !hasWordPrefix(entry.normalized, normalizeQuery(prefix)) {
+			continue
+		}
+		matches = append(matches, entry.Suggestion)
+	}
+	return matches
+}
+
+// hasWordPrefix reports whether a word in name starts a run matching prefix
+func hasWordPrefix(name, prefix string) bool {
+	for i := 0; i < len(name); i++ {
+		if (i == 0 || name[i-1] == ' ') && strings.HasPrefix(name[i:], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestProducts answers GET /products/suggest?prefix=&limit= from the
+// prefix index, for search boxes that ask on every keystroke
+func suggestProducts(c *gin.Context) {
+	ctx, span := tracer.Start(c.Request.Context(), "suggest_products")
+	defer span.End()
+
+	start := time.Now()
+
+	prefix := c.Query("prefix")
+	if strings.TrimSpace(prefix) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "prefix is required"})
+		requestCount.WithLabelValues("GET", "/products/suggest", "400").Inc()
+		return
+	}
+
+	limit := defaultSuggestions
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			requestCount.WithLabelValues("GET", "/products/suggest", "400").Inc()
+			return
+		}
+		if n > maxSuggestions {
+			n = maxSuggestions
+		}
+		limit = n
+	}
+
+	suggestMu.RLock()
+	index := suggestIndex
+	suggestMu.RUnlock()
+	matches := index.Lookup(prefix, limit)
+	span.SetAttributes(
+		attribute.Int("suggest.prefix_length", len([]rune(prefix))),
+		attribute.Int("suggest.matches", len(matches)),
+	)
+	result := "hit"
+	if len(matches) == 0 {
+		result = "miss"
+	}
+	suggestResults.WithLabelValues(result).Inc()
+	logger.Debug(ctx, "Handled suggest request", map[string]interface{}{"prefix": prefix, "matches": len(matches)})
+
+	// Suggestions only change with the catalog, so let browsers reuse them
+	// while the user edits the query
+	c.Header("Cache-Control", "public, max-age=60")
+	c.JSON(http.StatusOK, matches)
+
+	duration := time.Since(start).Seconds()
+	requestCount.WithLabelValues("GET", "/products/suggest", "200").Inc()
+	responseTime.WithLabelValues("GET", "/products/suggest").Observe(duration)
+}
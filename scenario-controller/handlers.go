@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxScenarioBytes bounds a scenario definition posted to the API
+const maxScenarioBytes = 1 << 20
+
+// actor names who asked for a change, for the run record
+func actor(c *gin.Context) string {
+	if a := c.GetHeader("X-Actor"); a != "" {
+		return a
+	}
+	return c.ClientIP()
+}
+
+func listScenarios(c *gin.Context) {
+	start := time.Now()
+	list := scenarios.List()
+	c.JSON(http.StatusOK, gin.H{"items": list, "total": len(list)})
+	recordRequest("GET", "/scenarios", http.StatusOK, start)
+}
+
+func getScenario(c *gin.Context) {
+	start := time.Now()
+
+	scenario, ok := scenarios.Get(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scenario not found"})
+		recordRequest("GET", "/scenarios/:name", http.StatusNotFound, start)
+		return
+	}
+	c.JSON(http.StatusOK, scenario)
+	recordRequest("GET", "/scenarios/:name", http.StatusOK, start)
+}
+
+// putScenario registers a scenario from a YAML or JSON body, replacing one
+// with the same name. Scenarios added this way are lost on restart; add
+// them to SCENARIOS_DIR to keep them.
+func putScenario(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxScenarioBytes+1))
+	if err != nil || len(data) > maxScenarioBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Scenario definition too large"})
+		recordRequest("POST", "/scenarios", http.StatusRequestEntityTooLarge, start)
+		return
+	}
+	scenario, err := ParseScenario(data)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		recordRequest("POST", "/scenarios", http.StatusUnprocessableEntity, start)
+		return
+	}
+	scenario.Source = "api"
+
+	status := http.StatusCreated
+	if scenarios.Put(scenario) {
+		status = http.StatusOK
+	}
+	logger.Info(ctx, "Scenario registered", map[string]interface{}{
+		"scenario": scenario.Name,
+		"steps":    len(scenario.Steps),
+		"actor":    actor(c),
+	})
+	c.JSON(status, scenario)
+	recordRequest("POST", "/scenarios", status, start)
+}
+
+// runScenario starts a run; 409 while another run is active
+func runScenario(c *gin.Context) {
+	start := time.Now()
+
+	scenario, ok := scenarios.Get(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scenario not found"})
+		recordRequest("POST", "/scenarios/:name/run", http.StatusNotFound, start)
+		return
+	}
+	run, err := runner.Start(scenario, actor(c))
+	if errors.Is(err, ErrRunActive) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "active": run})
+		recordRequest("POST", "/scenarios/:name/run", http.StatusConflict, start)
+		return
+	}
+	c.JSON(http.StatusAccepted, run)
+	recordRequest("POST", "/scenarios/:name/run", http.StatusAccepted, start)
+}
+
+func listRuns(c *gin.Context) {
+	start := time.Now()
+
+	limit := 20
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			recordRequest("GET", "/runs", http.StatusBadRequest, start)
+			return
+		}
+		limit = n
+	}
+	runs := runner.List(c.Query("scenario"), limit)
+	c.JSON(http.StatusOK, gin.H{"items": runs, "total": len(runs)})
+	recordRequest("GET", "/runs", http.StatusOK, start)
+}
+
+// getActiveRun reports the run in progress, with the time until its next
+// step
+func getActiveRun(c *gin.Context) {
+	start := time.Now()
+
+	run, ok := runner.Active()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No scenario is running"})
+		recordRequest("GET", "/runs/active", http.StatusNotFound, start)
+		return
+	}
+
+	response := gin.H{"run": run}
+	for _, step := range run.Steps {
+		if step.Status == StepPending && step.ScheduledAt != nil {
+			response["next_step"] = step
+			response["next_step_in"] = time.Until(*step.ScheduledAt).Round(time.Second).String()
+			break
+		}
+	}
+	c.JSON(http.StatusOK, response)
+	recordRequest("GET", "/runs/active", http.StatusOK, start)
+}
+
+func getRun(c *gin.Context) {
+	start := time.Now()
+
+	run, ok := runner.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		recordRequest("GET", "/runs/:id", http.StatusNotFound, start)
+		return
+	}
+	c.JSON(http.StatusOK, run)
+	recordRequest("GET", "/runs/:id", http.StatusOK, start)
+}
+
+// abortRun cancels the remaining steps of the active run and runs the
+// scenario's cleanup steps before answering
+func abortRun(c *gin.Context) {
+	ctx := c.Request.Context()
+	start := time.Now()
+
+	run, err := runner.Abort(c.Param("id"), actor(c))
+	switch {
+	case errors.Is(err, ErrRunNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		recordRequest("POST", "/runs/:id/abort", http.StatusNotFound, start)
+		return
+	case errors.Is(err, ErrRunNotActive):
+		c.JSON(http.StatusConflict, gin.H{"error": "Run has already finished", "run": run})
+		recordRequest("POST", "/runs/:id/abort", http.StatusConflict, start)
+		return
+	}
+
+	logger.Warn(ctx, "Scenario run aborted", map[string]interface{}{
+		"run_id":   run.ID,
+		"scenario": run.Scenario,
+		"actor":    run.AbortedBy,
+	})
+	c.JSON(http.StatusOK, run)
+	recordRequest("POST", "/runs/:id/abort", http.StatusOK, start)
+}
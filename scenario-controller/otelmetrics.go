@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"platform"
+)
+
+// initMeter exports metrics over OTLP. It returns nil when
+// OTEL_METRICS_ENABLED=false.
+func initMeter() *sdkmetric.MeterProvider {
+	mp, err := platform.InitMeter(context.Background(), telemetry)
+	if err != nil {
+		log.Fatalf("Failed to initialize metrics: %v", err)
+	}
+	return mp
+}
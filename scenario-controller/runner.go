@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"platform"
+)
+
+// Run statuses
+const (
+	RunRunning   = "running"
+	RunCompleted = "completed"
+	RunAborted   = "aborted"
+)
+
+// Step statuses within a run
+const (
+	StepPending   = "pending"
+	StepDone      = "done"
+	StepSkipped   = "skipped"
+	StepFailed    = "failed"
+	StepCancelled = "cancelled"
+)
+
+// maxRuns is how many finished runs are kept for GET /runs
+const maxRuns = 100
+
+var (
+	ErrRunActive    = errors.New("a scenario is already running")
+	ErrRunNotFound  = errors.New("run not found")
+	ErrRunNotActive = errors.New("run is not active")
+)
+
+var (
+	scenarioRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scenario_controller_runs_total",
+			Help: "Number of finished scenario runs by result",
+		},
+		[]string{"scenario", "result"},
+	)
+	scenarioSteps = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scenario_controller_steps_total",
+			Help: "Number of scenario steps executed by action, target service and result",
+		},
+		[]string{"action", "service", "result"},
+	)
+	activeScenario = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "scenario_controller_active_run",
+			Help: "Whether a run of the scenario is in progress (1) or not (0)",
+		},
+		[]string{"scenario"},
+	)
+)
+
+// StepRecord is what happened to one step of a run
+type StepRecord struct {
+	Step
+	Status      string     `json:"status"`
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+	ExecutedAt  *time.Time `json:"executed_at,omitempty"`
+	StatusCode  int        `json:"status_code,omitempty"`
+	Response    string     `json:"response,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Run is one execution of a scenario
+type Run struct {
+	ID          string       `json:"id"`
+	Scenario    string       `json:"scenario"`
+	Status      string       `json:"status"`
+	StartedBy   string       `json:"started_by,omitempty"`
+	AbortedBy   string       `json:"aborted_by,omitempty"`
+	StartedAt   time.Time    `json:"started_at"`
+	EndsAt      time.Time    `json:"ends_at"`
+	FinishedAt  *time.Time   `json:"finished_at,omitempty"`
+	FailedSteps int          `json:"failed_steps"`
+	Steps       []StepRecord `json:"steps"`
+	Cleanup     []StepRecord `json:"cleanup,omitempty"`
+}
+
+func cloneRun(r *Run) Run {
+	c := *r
+	c.Steps = append([]StepRecord(nil), r.Steps...)
+	c.Cleanup = append([]StepRecord(nil), r.Cleanup...)
+	return c
+}
+
+// Runner executes one scenario run at a time, so two scenarios never fight
+// over the same faults, and keeps a record of recent runs
+type Runner struct {
+	mu          sync.Mutex
+	runs        []*Run
+	active      *Run
+	cancel      context.CancelFunc
+	done        chan struct{}
+	stepTimeout time.Duration
+}
+
+var runner *Runner
+
+func NewRunnerFromEnv() *Runner {
+	stepTimeout, err := time.ParseDuration(platform.GetEnv("SCENARIO_STEP_TIMEOUT", "10s"))
+	if err != nil || stepTimeout <= 0 {
+		stepTimeout = 10 * time.Second
+	}
+	return &Runner{stepTimeout: stepTimeout}
+}
+
+// Start begins a run of the scenario. Its steps fire at their offsets from
+// now.
+func (r *Runner) Start(scenario *Scenario, actor string) (Run, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active != nil {
+		return cloneRun(r.active), ErrRunActive
+	}
+
+	now := time.Now().UTC()
+	run := &Run{
+		ID:        newID("run-"),
+		Scenario:  scenario.Name,
+		Status:    RunRunning,
+		StartedBy: actor,
+		StartedAt: now,
+		EndsAt:    now.Add(scenario.Duration()),
+		Steps:     make([]StepRecord, len(scenario.Steps)),
+	}
+	for i, step := range scenario.Steps {
+		scheduledAt := now.Add(step.Offset())
+		run.Steps[i] = StepRecord{Step: step, Status: StepPending, ScheduledAt: &scheduledAt}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.runs = append(r.runs, run)
+	if len(r.runs) > maxRuns {
+		r.runs = r.runs[len(r.runs)-maxRuns:]
+	}
+	r.active = run
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	activeScenario.WithLabelValues(scenario.Name).Set(1)
+
+	go r.execute(ctx, run, scenario, r.done)
+	return cloneRun(run), nil
+}
+
+// execute fires each step at its offset. Once aborted, the remaining steps
+// are cancelled and the scenario's cleanup steps run instead.
+func (r *Runner) execute(ctx context.Context, run *Run, scenario *Scenario, done chan struct{}) {
+	defer close(done)
+	defer platform.RecoverPanic(ctx, logger, "scenario-run")
+
+	logger.Info(ctx, "Scenario run started", map[string]interface{}{
+		"run_id":     run.ID,
+		"scenario":   scenario.Name,
+		"started_by": run.StartedBy,
+		"steps":      len(scenario.Steps),
+		"ends_at":    run.EndsAt.Format(time.RFC3339),
+	})
+
+	for i, step := range scenario.Steps {
+		timer := time.NewTimer(time.Until(run.StartedAt.Add(step.Offset())))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			r.abort(run, scenario, i)
+			return
+		case <-timer.C:
+		}
+		r.runStep(run, &run.Steps[i], "step")
+	}
+	r.finish(run, RunCompleted)
+}
+
+// abort cancels the steps from index on and runs the cleanup steps
+func (r *Runner) abort(run *Run, scenario *Scenario, index int) {
+	r.mu.Lock()
+	for i := index; i < len(run.Steps); i++ {
+		run.Steps[i].Status = StepCancelled
+	}
+	run.Cleanup = make([]StepRecord, len(scenario.Cleanup))
+	for i, step := range scenario.Cleanup {
+		run.Cleanup[i] = StepRecord{Step: step, Status: StepPending}
+	}
+	r.mu.Unlock()
+
+	for i := range run.Cleanup {
+		r.runStep(run, &run.Cleanup[i], "cleanup")
+	}
+	r.finish(run, RunAborted)
+}
+
+// runStep executes one step and records the outcome. Failed steps don't
+// stop the run; later steps, such as the one restoring a fault, still
+// fire.
+func (r *Runner) runStep(run *Run, record *StepRecord, phase string) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.stepTimeout)
+	defer cancel()
+	ctx, span := tracer.Start(ctx, "scenario.step")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("scenario.name", run.Scenario),
+		attribute.String("scenario.run_id", run.ID),
+		attribute.String("scenario.phase", phase),
+		attribute.String("step.action", record.Action),
+		attribute.String("step.service", record.Service),
+	)
+
+	result, err := execute(ctx, record.Step)
+	executedAt := time.Now().UTC()
+
+	status := StepDone
+	switch {
+	case err != nil:
+		status = StepFailed
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	case result.Skipped:
+		status = StepSkipped
+	}
+	scenarioSteps.WithLabelValues(record.Action, record.Service, status).Inc()
+
+	r.mu.Lock()
+	record.Status = status
+	record.ExecutedAt = &executedAt
+	record.StatusCode = result.StatusCode
+	record.Response = result.Response
+	if err != nil {
+		record.Error = err.Error()
+		run.FailedSteps++
+	}
+	r.mu.Unlock()
+
+	fields := map[string]interface{}{
+		"run_id":      run.ID,
+		"scenario":    run.Scenario,
+		"phase":       phase,
+		"action":      record.Action,
+		"service":     record.Service,
+		"status":      status,
+		"status_code": result.StatusCode,
+	}
+	if record.Description != "" {
+		fields["description"] = record.Description
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		logger.Error(ctx, "Scenario step failed", fields)
+		return
+	}
+	logger.Info(ctx, "Scenario step executed", fields)
+}
+
+func (r *Runner) finish(run *Run, status string) {
+	r.mu.Lock()
+	finishedAt := time.Now().UTC()
+	run.Status = status
+	run.FinishedAt = &finishedAt
+	if r.active == run {
+		r.active = nil
+		r.cancel = nil
+	}
+	failed := run.FailedSteps
+	r.mu.Unlock()
+
+	scenarioRuns.WithLabelValues(run.Scenario, status).Inc()
+	activeScenario.WithLabelValues(run.Scenario).Set(0)
+	logger.Info(context.Background(), "Scenario run finished", map[string]interface{}{
+		"run_id":       run.ID,
+		"scenario":     run.Scenario,
+		"status":       status,
+		"failed_steps": failed,
+	})
+}
+
+// Abort stops the active run with the given ID, waiting for its cleanup
+// steps to finish
+func (r *Runner) Abort(id, actor string) (Run, error) {
+	r.mu.Lock()
+	run := r.find(id)
+	if run == nil {
+		r.mu.Unlock()
+		return Run{}, ErrRunNotFound
+	}
+	if run != r.active {
+		defer r.mu.Unlock()
+		return cloneRun(run), ErrRunNotActive
+	}
+	run.AbortedBy = actor
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+
+	cancel()
+	<-done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return cloneRun(run), nil
+}
+
+// Active returns the run in progress, if any
+func (r *Runner) Active() (Run, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.active == nil {
+		return Run{}, false
+	}
+	return cloneRun(r.active), true
+}
+
+func (r *Runner) Get(id string) (Run, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run := r.find(id)
+	if run == nil {
+		return Run{}, false
+	}
+	return cloneRun(run), true
+}
+
+// find returns the run with the given ID. Callers must hold r.mu.
+func (r *Runner) find(id string) *Run {
+	for _, run := range r.runs {
+		if run.ID == id {
+			return run
+		}
+	}
+	return nil
+}
+
+// List returns up to limit runs, newest first, optionally for one scenario
+func (r *Runner) List(scenario string, limit int) []Run {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	runs := []Run{}
+	for i := len(r.runs) - 1; i >= 0 && len(runs) < limit; i-- {
+		if scenario == "" || r.runs[i].Scenario == scenario {
+			runs = append(runs, cloneRun(r.runs[i]))
+		}
+	}
+	return runs
+}
+
+// Close aborts the active run, so stopping the controller mid-scenario
+// still runs its cleanup steps
+func (r *Runner) Close() {
+	if run, ok := r.Active(); ok {
+		r.Abort(run.ID, "shutdown")
+	}
+}
+
+func newID(prefix string) string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Step actions
+const (
+	// ActionChaosEnable posts Fault to the service's /chaos/faults API
+	ActionChaosEnable = "chaos.enable"
+	// ActionChaosDisable removes the fault named FaultName, or every fault
+	// when it is empty
+	ActionChaosDisable = "chaos.disable"
+	// ActionCacheToken switches instabook-cache's token authentication to
+	// Enabled, toggling /admin/token only if it isn't already
+	ActionCacheToken = "cache_token"
+	// ActionHTTP sends Method Path with Body to the service
+	ActionHTTP = "http"
+)
+
+// Scenario is a scripted incident: steps run at fixed offsets from the
+// start of a run, so every run of a scenario injects the same faults at the
+// same times. Cleanup steps run straight away if a run is aborted, to put
+// the services back the way the scenario found them.
+type Scenario struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Steps       []Step `yaml:"steps" json:"steps"`
+	Cleanup     []Step `yaml:"cleanup,omitempty" json:"cleanup,omitempty"`
+	// Source is the file the scenario was loaded from, or "api"
+	Source string `yaml:"-" json:"source"`
+}
+
+// Step is one action against one service
+type Step struct {
+	// At is the offset from the start of the run, e.g. "5m"; ignored for
+	// cleanup steps
+	At          string `yaml:"at,omitempty" json:"at,omitempty"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Action      string `yaml:"action" json:"action"`
+	Service     string `yaml:"service" json:"service"`
+
+	Fault     map[string]interface{} `yaml:"fault,omitempty" json:"fault,omitempty"`
+	FaultName string                 `yaml:"fault_name,omitempty" json:"fault_name,omitempty"`
+	Enabled   *bool                  `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	Method    string                 `yaml:"method,omitempty" json:"method,omitempty"`
+	Path      string                 `yaml:"path,omitempty" json:"path,omitempty"`
+	Body      interface{}            `yaml:"body,omitempty" json:"body,omitempty"`
+
+	offset time.Duration
+}
+
+// Offset is the parsed At
+func (s Step) Offset() time.Duration {
+	return s.offset
+}
+
+// Duration is the offset of the last step
+func (s *Scenario) Duration() time.Duration {
+	if len(s.Steps) == 0 {
+		return 0
+	}
+	return s.Steps[len(s.Steps)-1].offset
+}
+
+// Validate checks every step and sorts the steps by offset, keeping the
+// written order of steps at the same offset
+func (s *Scenario) Validate() error {
+	if s.Name == "" {
+		return errors.New("scenario requires a name")
+	}
+	if strings.ContainsAny(s.Name, "/ ") {
+		return fmt.Errorf("scenario name %q can't contain spaces or slashes", s.Name)
+	}
+	if len(s.Steps) == 0 {
+		return fmt.Errorf("scenario %s has no steps", s.Name)
+	}
+
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		offset, err := time.ParseDuration(step.At)
+		if err != nil || offset < 0 {
+			return fmt.Errorf("step %d: at must be a duration like \"5m\", got %q", i+1, step.At)
+		}
+		step.offset = offset
+		if err := step.validate(); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	for i := range s.Cleanup {
+		if err := s.Cleanup[i].validate(); err != nil {
+			return fmt.Errorf("cleanup step %d: %w", i+1, err)
+		}
+	}
+
+	sort.SliceStable(s.Steps, func(i, j int) bool {
+		return s.Steps[i].offset < s.Steps[j].offset
+	})
+	return nil
+}
+
+func (s *Step) validate() error {
+	if s.Action == ActionCacheToken && s.Service == "" {
+		s.Service = "instabook-cache"
+	}
+	if s.Service == "" {
+		return errors.New("service is required")
+	}
+	if _, ok := serviceURL(s.Service); !ok {
+		return fmt.Errorf("unknown service %q", s.Service)
+	}
+
+	switch s.Action {
+	case ActionChaosEnable:
+		if name, _ := s.Fault["name"].(string); name == "" {
+			return errors.New("chaos.enable requires a fault with a name")
+		}
+		if kind, _ := s.Fault["type"].(string); kind == "" {
+			return errors.New("chaos.enable requires a fault with a type")
+		}
+	case ActionChaosDisable:
+	case ActionCacheToken:
+		if s.Enabled == nil {
+			return errors.New("cache_token requires enabled")
+		}
+	case ActionHTTP:
+		if s.Method == "" || !strings.HasPrefix(s.Path, "/") {
+			return errors.New("http requires a method and a path starting with /")
+		}
+		s.Method = strings.ToUpper(s.Method)
+	default:
+		return fmt.Errorf("unknown action %q", s.Action)
+	}
+	return nil
+}
+
+// ParseScenario reads a scenario from YAML, which also accepts JSON
+func ParseScenario(data []byte) (*Scenario, error) {
+	var s Scenario
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	// Bodies are sent as JSON, so maps with non-string keys have to go
+	for i := range s.Steps {
+		s.Steps[i].Body = jsonCompatible(s.Steps[i].Body)
+	}
+	for i := range s.Cleanup {
+		s.Cleanup[i].Body = jsonCompatible(s.Cleanup[i].Body)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// jsonCompatible converts map[interface{}]interface{} values, which
+// encoding/json rejects, into map[string]interface{}
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonCompatible(value)
+		}
+		return m
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = jsonCompatible(value)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = jsonCompatible(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// ScenarioStore holds the scenarios that can be run
+type ScenarioStore struct {
+	mu        sync.RWMutex
+	scenarios map[string]*Scenario
+}
+
+var scenarios = &ScenarioStore{scenarios: make(map[string]*Scenario)}
+
+// LoadDir loads every .yaml and .yml file in dir. A missing directory is
+// not an error; an invalid scenario is.
+func (s *ScenarioStore) LoadDir(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	loaded := 0
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return loaded, err
+		}
+		scenario, err := ParseScenario(data)
+		if err != nil {
+			return loaded, fmt.Errorf("%s: %w", path, err)
+		}
+		scenario.Source = path
+		s.Put(scenario)
+		loaded++
+	}
+	return loaded, nil
+}
+
+// Put adds the scenario, replacing any with the same name. It reports
+// whether one was replaced.
+func (s *ScenarioStore) Put(scenario *Scenario) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, replaced := s.scenarios[scenario.Name]
+	s.scenarios[scenario.Name] = scenario
+	return replaced
+}
+
+func (s *ScenarioStore) Get(name string) (*Scenario, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	scenario, ok := s.scenarios[name]
+	return scenario, ok
+}
+
+// List returns the scenarios sorted by name
+func (s *ScenarioStore) List() []*Scenario {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]*Scenario, 0, len(s.scenarios))
+	for _, scenario := range s.scenarios {
+		list = append(list, scenario)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"platform"
+)
+
+// defaultPorts are the ports services listen on in docker-compose and the
+// Helm chart. A service not listed here needs its <NAME>_SERVICE setting.
+var defaultPorts = map[string]int{
+	"gateway":              8080,
+	"product-catalog":      8081,
+	"currency-service":     8082,
+	"ad-service":           8083,
+	"checkout-service":     8084,
+	"inventory-service":    8085,
+	"instabook-cache":      8086,
+	"instabook":            8087,
+	"order-service":        8088,
+	"notification-service": 8089,
+}
+
+// serviceEnvKey is the setting holding a service's base URL, following the
+// names the services already use for each other, e.g. INVENTORY_SERVICE
+// or PRODUCT_CATALOG_SERVICE
+func serviceEnvKey(service string) string {
+	key := strings.ToUpper(strings.ReplaceAll(service, "-", "_"))
+	if !strings.HasSuffix(key, "_SERVICE") {
+		key += "_SERVICE"
+	}
+	return key
+}
+
+// serviceURL returns the base URL for service: its <NAME>_SERVICE setting,
+// or http://<service>:<port> for the services in defaultPorts
+func serviceURL(service string) (string, bool) {
+	if base := platform.Get(serviceEnvKey(service)); base != "" {
+		return strings.TrimSuffix(base, "/"), true
+	}
+	if port, ok := defaultPorts[service]; ok {
+		return fmt.Sprintf("http://%s:%d", service, port), true
+	}
+	return "", false
+}
+
+// StepResult is what a step got back from the service
+type StepResult struct {
+	StatusCode int
+	Response   string
+	// Skipped is set when the service was already in the requested state
+	Skipped bool
+}
+
+// maxResponseBytes bounds the response kept in a run's record
+const maxResponseBytes = 2048
+
+// execute performs the step against its service
+func execute(ctx context.Context, step Step) (StepResult, error) {
+	base, ok := serviceURL(step.Service)
+	if !ok {
+		return StepResult{}, fmt.Errorf("unknown service %q", step.Service)
+	}
+
+	switch step.Action {
+	case ActionChaosEnable:
+		return call(ctx, "POST", base+"/chaos/faults", step.Fault, true)
+	case ActionChaosDisable:
+		if step.FaultName == "" {
+			return call(ctx, "DELETE", base+"/chaos/faults", nil, true)
+		}
+		result, err := call(ctx, "DELETE", base+"/chaos/faults/"+url.PathEscape(step.FaultName), nil, true)
+		// Already gone, e.g. cleanup after a run aborted before the fault
+		// was enabled
+		if result.StatusCode == http.StatusNotFound {
+			result.Skipped = true
+			return result, nil
+		}
+		return result, err
+	case ActionCacheToken:
+		return setCacheToken(ctx, base, *step.Enabled)
+	case ActionHTTP:
+		return call(ctx, step.Method, base+step.Path, step.Body, false)
+	default:
+		return StepResult{}, fmt.Errorf("unknown action %q", step.Action)
+	}
+}
+
+// setCacheToken reads instabook-cache's token state and toggles it only if
+// it differs, since the admin endpoint can only flip it
+func setCacheToken(ctx context.Context, base string, enabled bool) (StepResult, error) {
+	result, err := call(ctx, "GET", base+"/admin/token", nil, false)
+	if err != nil {
+		return result, err
+	}
+	var status struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.Unmarshal([]byte(result.Response), &status); err != nil {
+		return result, fmt.Errorf("invalid token status: %w", err)
+	}
+	if status.Enabled == enabled {
+		result.Skipped = true
+		return result, nil
+	}
+	return call(ctx, "POST", base+"/admin/token", nil, false)
+}
+
+// call sends the request, JSON-encoding body when it is set. chaos adds
+// the CHAOS_TOKEN the services' /chaos APIs expect. A response of 400 or
+// above is returned as an error along with the result.
+func call(ctx context.Context, method, target string, body interface{}, chaos bool) (StepResult, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return StepResult{}, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return StepResult{}, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Actor", "scenario-controller")
+	if token := config.Get("CHAOS_TOKEN"); chaos && token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return StepResult{}, err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	result := StepResult{StatusCode: resp.StatusCode, Response: string(data)}
+	if resp.StatusCode >= 400 {
+		return result, fmt.Errorf("%s %s returned %d", method, target, resp.StatusCode)
+	}
+	return result, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var requestTimeouts = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "request_timeouts_total",
+		Help: "Number of requests that exceeded their deadline",
+	},
+	[]string{"method", "endpoint"},
+)
+
+// TimeoutConfig holds the default request deadline and per-route overrides
+// keyed by "METHOD /route/:param". A zero timeout disables the deadline.
+type TimeoutConfig struct {
+	defaultTimeout time.Duration
+	routes         map[string]time.Duration
+}
+
+// NewTimeoutConfigFromEnv reads REQUEST_TIMEOUT (default 30s, 0 disables)
+// and ROUTE_TIMEOUTS, a comma-separated list such as
+// "GET /booking/:id=2s,POST /booking=15s". defaults are per-route timeouts
+// the service needs, e.g. 0 for streaming endpoints; ROUTE_TIMEOUTS wins
+// over them.
+func NewTimeoutConfigFromEnv(defaults map[string]time.Duration) *TimeoutConfig {
+	cfg := &TimeoutConfig{defaultTimeout: 30 * time.Second, routes: make(map[string]time.Duration)}
+	if d, err := time.ParseDuration(config.Get("REQUEST_TIMEOUT")); err == nil && d >= 0 {
+		cfg.defaultTimeout = d
+	}
+	for route, d := range defaults {
+		cfg.routes[route] = d
+	}
+
+	for _, entry := range strings.Split(config.Get("ROUTE_TIMEOUTS"), ",") {
+		route, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		if d, err := time.ParseDuration(strings.TrimSpace(value)); err == nil && d >= 0 {
+			cfg.routes[strings.Join(strings.Fields(route), " ")] = d
+		}
+	}
+	return cfg
+}
+
+func (cfg *TimeoutConfig) timeout(method, route string) time.Duration {
+	if d, ok := cfg.routes[method+" "+route]; ok {
+		return d
+	}
+	return cfg.defaultTimeout
+}
+
+// timeoutWriter drops whatever the handler writes once the deadline has
+// passed, so the middleware's 504 is the only response
+type timeoutWriter struct {
+	gin.ResponseWriter
+	mu       sync.Mutex
+	timedOut bool
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// expire marks the response as timed out unless the handler has already
+// started writing its body
+func (w *timeoutWriter) expire() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.ResponseWriter.Written() {
+		return false
+	}
+	w.timedOut = true
+	return true
+}
+
+// timeoutMiddleware gives each request a deadline on its context. Handlers
+// and downstream calls that honour the context are cancelled when it
+// passes, and the client gets a 504 instead of whatever the handler writes
+// afterwards. The deadlines are re-read on every config reload; defaults
+// are passed to NewTimeoutConfigFromEnv.
+func timeoutMiddleware(defaults map[string]time.Duration) gin.HandlerFunc {
+	timeouts := reloadable(func() *TimeoutConfig { return NewTimeoutConfigFromEnv(defaults) })
+	return func(c *gin.Context) {
+		timeout := timeouts().timeout(c.Request.Method, c.FullPath())
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		tw := &timeoutWriter{ResponseWriter: c.Writer}
+		c.Writer = tw
+
+		done := make(chan struct{})
+		expired := make(chan bool, 1)
+		go func() {
+			select {
+			case <-ctx.Done():
+				expired <- errors.Is(ctx.Err(), context.DeadlineExceeded) && tw.expire()
+			case <-done:
+				expired <- false
+			}
+		}()
+
+		c.Next()
+		close(done)
+		c.Writer = tw.ResponseWriter
+		if !<-expired {
+			return
+		}
+
+		logger.Warn(ctx, "Request timed out", map[string]interface{}{
+			"path":       c.Request.URL.Path,
+			"method":     c.Request.Method,
+			"timeout_ms": timeout.Milliseconds(),
+		})
+		requestTimeouts.WithLabelValues(c.Request.Method, c.FullPath()).Inc()
+
+		c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{
+			"error":      "Request timed out",
+			"timeout_ms": timeout.Milliseconds(),
+		})
+	}
+}